@@ -4,7 +4,11 @@
 // Package apitype contains types for the Tailscale LocalAPI and control plane API.
 package apitype
 
-import "tailscale.com/tailcfg"
+import (
+	"time"
+
+	"tailscale.com/tailcfg"
+)
 
 // LocalAPIHost is the Host header value used by the LocalAPI.
 const LocalAPIHost = "local-tailscaled.sock"
@@ -35,8 +39,104 @@ type WaitingFile struct {
 	Size int64
 }
 
+// PartialFileInfo describes what a peer has already received of a file
+// whose Taildrop transfer was interrupted, so the sender can resume it. It's
+// the response to a GET of the file's LocalAPI file-put (or peerAPI put) URL.
+type PartialFileInfo struct {
+	// Size is how many bytes of the file were received. It's zero if
+	// nothing was.
+	Size int64
+
+	// SHA256 is the hex SHA-256 of those bytes, for the sender to check
+	// that they're the start of the file it's sending.
+	SHA256 string `json:",omitempty"`
+}
+
 // SetPushDeviceTokenRequest is the body POSTed to the LocalAPI endpoint /set-device-token.
 type SetPushDeviceTokenRequest struct {
 	// PushDeviceToken is the iOS/macOS APNs device token (and any future Android equivalent).
 	PushDeviceToken string
 }
+
+// DNSOSConfigResponse is the JSON type returned by the LocalAPI
+// /dns-osconfig handler. It describes how tailscaled configures the
+// operating system's DNS.
+type DNSOSConfigResponse struct {
+	// Mode is the kind of DNS manager in use, such as "systemd-resolved",
+	// "network-manager", "debian-resolvconf", "openresolv" or "direct".
+	// It's empty on platforms with only one way to configure DNS.
+	Mode string
+
+	// Forced is whether Mode was forced rather than detected, by the
+	// DNSMode system policy, the DNSMode preference or the TS_DNS_MODE
+	// environment variable.
+	Forced bool
+
+	// Notes are the "key=value" observations that led to Mode, in the
+	// order they were made.
+	Notes []string `json:",omitempty"`
+}
+
+// LocalAPIAuditEntry is a record of a state-changing LocalAPI request. A
+// list of them, oldest first, is returned by the LocalAPI /localapi-audit
+// handler.
+type LocalAPIAuditEntry struct {
+	Time time.Time
+
+	// Method and Endpoint are the HTTP method and the path of the
+	// request, such as "PATCH" and "/localapi/v0/prefs".
+	Method   string
+	Endpoint string
+
+	// Caller describes the local user and process that made the
+	// request, such as "uid=1000 pid=1234" or, on Windows,
+	// "sid=S-1-5-21-... pid=1234".
+	Caller string
+
+	// Summary is a short description of the change requested, such as
+	// the edited prefs or the query parameters.
+	Summary string `json:",omitempty"`
+
+	// Status is the HTTP status code of the response.
+	Status int
+}
+
+// ErrorCode is a machine-readable code for the kind of failure of a LocalAPI
+// request. More codes may be added over time, so clients should handle
+// unknown codes like errors without a code.
+type ErrorCode string
+
+const (
+	// ErrCodeAccessDenied is when the caller isn't permitted to make the
+	// request, such as a change of state by a user who is neither root
+	// nor the operator.
+	ErrCodeAccessDenied ErrorCode = "access-denied"
+
+	// ErrCodePreconditionFailed is when the state that a request was
+	// conditional on has changed, such as when the serve config ETag
+	// doesn't match.
+	ErrCodePreconditionFailed ErrorCode = "precondition-failed"
+
+	// ErrCodeFunnelNotEnabled is when Funnel was requested but isn't
+	// available to the node, or on the requested port.
+	ErrCodeFunnelNotEnabled ErrorCode = "funnel-not-enabled"
+
+	// ErrCodeNetworkLockNotTrusted is when a tailnet lock operation
+	// needs the node's tailnet lock key to be trusted, and it isn't.
+	ErrCodeNetworkLockNotTrusted ErrorCode = "network-lock-not-trusted"
+)
+
+// ErrorResponse is the JSON body of a failed LocalAPI request. Some handlers
+// respond with a plain text error message instead, in which case clients
+// derive the code from the HTTP status, if any.
+type ErrorResponse struct {
+	// Error is the human-readable error message.
+	Error string `json:"error"`
+
+	// Code is the kind of error, or empty if it has none.
+	Code ErrorCode `json:"code,omitempty"`
+
+	// Details are additional machine-readable facts about the error,
+	// depending on its Code.
+	Details map[string]string `json:"details,omitempty"`
+}
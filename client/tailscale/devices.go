@@ -12,12 +12,18 @@
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
+	"time"
 
 	"tailscale.com/types/opt"
 )
 
 type GetDevicesResponse struct {
 	Devices []*Device `json:"devices"`
+
+	// NextCursor, if non-empty, is the DeviceListOpts.Cursor with which to
+	// request the next page of devices.
+	NextCursor string `json:"nextCursor,omitempty"`
 }
 
 type DerpRegion struct {
@@ -105,6 +111,58 @@ func (d *DeviceFieldsOpts) addFieldsToQueryParameter() string {
 	DeviceDefaultFields = &DeviceFieldsOpts{}
 )
 
+// DeviceListOpts are the options of DevicesPage and AllDevices. The zero
+// value lists all devices with DeviceDefaultFields.
+//
+// The filters are applied by the server; devices must match all of them.
+type DeviceListOpts struct {
+	// Fields specifies which fields of the devices to return, as in Devices.
+	Fields *DeviceFieldsOpts
+
+	// Tags, if non-empty, limits the devices to those with any of these
+	// ACL tags (e.g. "tag:server").
+	Tags []string
+	// OS, if non-empty, limits the devices to those with this OS, as
+	// reported in Device.OS (e.g. "linux").
+	OS string
+	// LastSeenSince, if non-zero, limits the devices to those seen since
+	// then.
+	LastSeenSince time.Time
+
+	// PageSize is the maximum number of devices per page. Zero means the
+	// server's default.
+	PageSize int
+	// Cursor is the GetDevicesResponse.NextCursor of the previous page, or
+	// empty for the first page.
+	Cursor string
+}
+
+// queryParams returns the query parameters of the device list request with
+// opts.
+func (opts *DeviceListOpts) queryParams() url.Values {
+	q := url.Values{}
+	if opts == nil {
+		opts = &DeviceListOpts{}
+	}
+	q.Set("fields", opts.Fields.addFieldsToQueryParameter())
+	for _, tag := range opts.Tags {
+		q.Add("tag", tag)
+	}
+	if opts.OS != "" {
+		q.Set("os", opts.OS)
+	}
+	if !opts.LastSeenSince.IsZero() {
+		q.Set("lastSeenSince", opts.LastSeenSince.UTC().Format(time.RFC3339))
+	}
+	if opts.PageSize > 0 {
+		q.Set("limit", strconv.Itoa(opts.PageSize))
+	}
+	if opts.Cursor != "" {
+		q.Set("cursor", opts.Cursor)
+	}
+	return q
+}
+
 // Devices retrieves the list of devices for a tailnet.
 //
 // See the Device structure for the list of fields hidden for external devices.
@@ -117,17 +175,67 @@ func (c *Client) Devices(ctx context.Context, fields *DeviceFieldsOpts) (deviceL
 			err = fmt.Errorf("tailscale.Devices: %w", err)
 		}
 	}()
+	res, err := c.devices(ctx, &DeviceListOpts{Fields: fields})
+	if err != nil {
+		return nil, err
+	}
+	return res.Devices, nil
+}
 
+// DevicesPage retrieves a page of the devices of a tailnet that match the
+// filters of opts. The NextCursor of the response, if non-empty, is the
+// Cursor of the next page. A nil opts is equivalent to the zero value.
+//
+// Rate-limited requests are retried until ctx is done.
+func (c *Client) DevicesPage(ctx context.Context, opts *DeviceListOpts) (res *GetDevicesResponse, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("tailscale.DevicesPage: %w", err)
+		}
+	}()
+	return c.devices(ctx, opts)
+}
+
+// AllDevices retrieves all devices of a tailnet that match the filters of
+// opts, one page of opts.PageSize devices at a time, starting at opts.Cursor.
+// A nil opts is equivalent to the zero value.
+//
+// Rate-limited requests are retried until ctx is done.
+func (c *Client) AllDevices(ctx context.Context, opts *DeviceListOpts) (deviceList []*Device, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("tailscale.AllDevices: %w", err)
+		}
+	}()
+	pageOpts := DeviceListOpts{}
+	if opts != nil {
+		pageOpts = *opts
+	}
+	for {
+		res, err := c.devices(ctx, &pageOpts)
+		if err != nil {
+			return nil, err
+		}
+		deviceList = append(deviceList, res.Devices...)
+		if res.NextCursor == "" {
+			return deviceList, nil
+		}
+		if res.NextCursor == pageOpts.Cursor {
+			return nil, fmt.Errorf("server returned the same cursor %q twice", res.NextCursor)
+		}
+		pageOpts.Cursor = res.NextCursor
+	}
+}
+
+// devices retrieves the page of devices of the Client's tailnet requested by
+// opts.
+func (c *Client) devices(ctx context.Context, opts *DeviceListOpts) (*GetDevicesResponse, error) {
 	path := fmt.Sprintf("%s/api/v2/tailnet/%s/devices", c.baseURL(), c.tailnet)
 	req, err := http.NewRequestWithContext(ctx, "GET", path, nil)
 	if err != nil {
 		return nil, err
 	}
-	// Add fields.
-	fieldStr := fields.addFieldsToQueryParameter()
-	q := req.URL.Query()
-	q.Add("fields", fieldStr)
-	req.URL.RawQuery = q.Encode()
+	req.URL.RawQuery = opts.queryParams().Encode()
 
 	b, resp, err := c.sendRequest(req)
 	if err != nil {
@@ -139,9 +247,11 @@ func (c *Client) Devices(ctx context.Context, fields *DeviceFieldsOpts) (deviceL
 		return nil, handleErrorResponse(b, resp)
 	}
 
-	var devices GetDevicesResponse
-	err = json.Unmarshal(b, &devices)
-	return devices.Devices, err
+	res := new(GetDevicesResponse)
+	if err := json.Unmarshal(b, res); err != nil {
+		return nil, err
+	}
+	return res, nil
 }
 
 // Device retrieved the details for a specific device.
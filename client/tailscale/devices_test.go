@@ -0,0 +1,117 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build go1.19
+
+package tailscale
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestAllDevices(t *testing.T) {
+	I_Acknowledge_This_API_Is_Unstable = true
+	t.Cleanup(func() { I_Acknowledge_This_API_Is_Unstable = false })
+
+	const numDevices = 5
+	rateLimited := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/tailnet/example.com/devices" {
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+		q := r.URL.Query()
+		if got, want := q["tag"], []string{"tag:a", "tag:b"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("tag = %q, want %q", got, want)
+		}
+		if got, want := q.Get("os"), "linux"; got != want {
+			t.Errorf("os = %q, want %q", got, want)
+		}
+		if got, want := q.Get("lastSeenSince"), "2023-11-14T22:13:20Z"; got != want {
+			t.Errorf("lastSeenSince = %q, want %q", got, want)
+		}
+		if got, want := q.Get("fields"), "all"; got != want {
+			t.Errorf("fields = %q, want %q", got, want)
+		}
+		limit, _ := strconv.Atoi(q.Get("limit"))
+		if limit != 2 {
+			t.Errorf("limit = %d, want 2", limit)
+		}
+
+		// Rate limit the second page once.
+		start, _ := strconv.Atoi(q.Get("cursor"))
+		if start > 0 && !rateLimited {
+			rateLimited = true
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+
+		var res GetDevicesResponse
+		for i := start; i < numDevices && i < start+limit; i++ {
+			res.Devices = append(res.Devices, &Device{DeviceID: strconv.Itoa(i)})
+		}
+		if start+limit < numDevices {
+			res.NextCursor = strconv.Itoa(start + limit)
+		}
+		json.NewEncoder(w).Encode(res)
+	}))
+	defer srv.Close()
+
+	c := NewClient("example.com", nil)
+	c.BaseURL = srv.URL
+	devices, err := c.AllDevices(context.Background(), &DeviceListOpts{
+		Fields:        DeviceAllFields,
+		Tags:          []string{"tag:a", "tag:b"},
+		OS:            "linux",
+		LastSeenSince: time.Unix(1700000000, 0),
+		PageSize:      2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, d := range devices {
+		ids = append(ids, d.DeviceID)
+	}
+	if want := []string{"0", "1", "2", "3", "4"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("got devices %q, want %q", ids, want)
+	}
+	if !rateLimited {
+		t.Error("rate limited request wasn't exercised")
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryAfter string
+		attempt    int
+		want       time.Duration
+	}{
+		{"backoff-first", "", 0, retryDelayBase},
+		{"backoff-third", "", 2, 4 * retryDelayBase},
+		{"backoff-capped", "", 10, maxRetryDelay},
+		{"retry-after-seconds", "7", 3, 7 * time.Second},
+		{"retry-after-capped", "3600", 0, maxRetryDelay},
+		{"retry-after-past-date", "Mon, 02 Jan 2006 15:04:05 GMT", 0, 0},
+		{"retry-after-invalid", "soon", 1, 2 * retryDelayBase},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{Header: http.Header{}}
+			if tt.retryAfter != "" {
+				resp.Header.Set("Retry-After", tt.retryAfter)
+			}
+			if got := retryDelay(resp, tt.attempt); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
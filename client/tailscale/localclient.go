@@ -28,6 +28,7 @@
 	"go4.org/mem"
 	"tailscale.com/client/tailscale/apitype"
 	"tailscale.com/envknob"
+	"tailscale.com/health"
 	"tailscale.com/ipn"
 	"tailscale.com/ipn/ipnstate"
 	"tailscale.com/net/netutil"
@@ -138,11 +139,17 @@ func (lc *LocalClient) doLocalRequestNiceError(req *http.Request) (*http.Respons
 		}
 		if res.StatusCode == 403 {
 			all, _ := io.ReadAll(res.Body)
-			return nil, &AccessDeniedError{errors.New(errorMessageFromBody(all))}
+			le := localAPIError(all, apitype.ErrCodeAccessDenied)
+			if le.Code != apitype.ErrCodeAccessDenied {
+				// Refused for a reason other than the caller's
+				// permissions, such as Funnel not being enabled.
+				return nil, le
+			}
+			return nil, &AccessDeniedError{le}
 		}
 		if res.StatusCode == http.StatusPreconditionFailed {
 			all, _ := io.ReadAll(res.Body)
-			return nil, &PreconditionsFailedError{errors.New(errorMessageFromBody(all))}
+			return nil, &PreconditionsFailedError{localAPIError(all, apitype.ErrCodePreconditionFailed)}
 		}
 		return res, nil
 	}
@@ -156,8 +163,76 @@ func (lc *LocalClient) doLocalRequestNiceError(req *http.Request) (*http.Respons
 	return nil, err
 }
 
-type errorJSON struct {
-	Error string
+// Errors that LocalAPI errors match with errors.Is, according to their
+// error code. See LocalAPIError.
+var (
+	// ErrAccessDenied is when the caller isn't permitted to make a
+	// request, such as a change of state by a user who is neither root
+	// nor the operator.
+	ErrAccessDenied = errors.New("access denied")
+
+	// ErrPreconditionFailed is when the state that a request was
+	// conditional on has changed, such as when another client changed
+	// the serve config concurrently.
+	ErrPreconditionFailed = errors.New("precondition failed")
+
+	// ErrFunnelNotEnabled is when Funnel was requested but isn't
+	// available to the node, or on the requested port.
+	ErrFunnelNotEnabled = errors.New("Funnel not enabled")
+
+	// ErrNetworkLockNotTrusted is when a tailnet lock operation needs
+	// the node's tailnet lock key to be trusted, and it isn't.
+	ErrNetworkLockNotTrusted = errors.New("node not trusted by tailnet lock")
+)
+
+var errorsByCode = map[apitype.ErrorCode]error{
+	apitype.ErrCodeAccessDenied:          ErrAccessDenied,
+	apitype.ErrCodePreconditionFailed:    ErrPreconditionFailed,
+	apitype.ErrCodeFunnelNotEnabled:      ErrFunnelNotEnabled,
+	apitype.ErrCodeNetworkLockNotTrusted: ErrNetworkLockNotTrusted,
+}
+
+// LocalAPIError is an error response of the LocalAPI. Use errors.Is with the
+// Err* values of this package, or ErrorCode, to check for specific errors.
+type LocalAPIError struct {
+	Message string
+	Code    apitype.ErrorCode // or empty if unknown
+	Details map[string]string // see apitype.ErrorResponse
+}
+
+func (e *LocalAPIError) Error() string { return e.Message }
+
+// Is reports whether target is the Err* value of this package for e's code.
+func (e *LocalAPIError) Is(target error) bool {
+	return e.Code != "" && errorsByCode[e.Code] == target
+}
+
+// ErrorCode returns the LocalAPI error code of err, or the empty string if
+// err isn't or doesn't wrap a LocalAPIError with a code.
+func ErrorCode(err error) apitype.ErrorCode {
+	var le *LocalAPIError
+	if errors.As(err, &le) {
+		return le.Code
+	}
+	return ""
+}
+
+// localAPIError returns the error of a LocalAPI response with the given body,
+// which is either an apitype.ErrorResponse or a plain text message. The
+// defaultCode is used if the body has no code.
+func localAPIError(body []byte, defaultCode apitype.ErrorCode) *LocalAPIError {
+	e := &LocalAPIError{Code: defaultCode}
+	var res apitype.ErrorResponse
+	if err := json.Unmarshal(body, &res); err == nil && res.Error != "" {
+		e.Message = res.Error
+		e.Details = res.Details
+		if res.Code != "" {
+			e.Code = res.Code
+		}
+		return e
+	}
+	e.Message = strings.TrimSpace(string(body))
+	return e
 }
 
 // AccessDeniedError is an error due to permissions.
@@ -193,23 +268,15 @@ func IsPreconditionsFailedError(err error) bool {
 }
 
 // bestError returns either err, or if body contains a valid JSON
-// object of type errorJSON, its non-empty error body.
+// apitype.ErrorResponse with a non-empty error, it as a *LocalAPIError.
 func bestError(err error, body []byte) error {
-	var j errorJSON
-	if err := json.Unmarshal(body, &j); err == nil && j.Error != "" {
-		return errors.New(j.Error)
+	var res apitype.ErrorResponse
+	if err := json.Unmarshal(body, &res); err == nil && res.Error != "" {
+		return &LocalAPIError{Message: res.Error, Code: res.Code, Details: res.Details}
 	}
 	return err
 }
 
-func errorMessageFromBody(body []byte) string {
-	var j errorJSON
-	if err := json.Unmarshal(body, &j); err == nil && j.Error != "" {
-		return j.Error
-	}
-	return strings.TrimSpace(string(body))
-}
-
 var onVersionMismatch func(clientVer, serverVer string)
 
 // SetVersionMismatchHandler sets f as the version mismatch handler
@@ -336,6 +403,27 @@ func (lc *LocalClient) TailDaemonLogs(ctx context.Context) (io.Reader, error) {
 	return res.Body, nil
 }
 
+// LocalDaemonLogs returns the logs that the Tailscale daemon has retained in
+// local-only logging mode, as a stream of JSON objects. If follow is true,
+// the stream continues with new logs as they arrive; close the context to
+// stop it.
+func (lc *LocalClient) LocalDaemonLogs(ctx context.Context, follow bool) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", "http://"+apitype.LocalAPIHost+"/localapi/v0/local-logs?follow="+strconv.FormatBool(follow), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := lc.doLocalRequestNiceError(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != 200 {
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		return nil, bestError(fmt.Errorf("HTTP %s: %s", res.Status, body), body)
+	}
+	return res.Body, nil
+}
+
 // Pprof returns a pprof profile of the Tailscale daemon.
 func (lc *LocalClient) Pprof(ctx context.Context, pprofType string, sec int) ([]byte, error) {
 	var secArg string
@@ -467,6 +555,11 @@ type DebugPortmapOpts struct {
 	// LogHTTP instructs the debug-portmap endpoint to print all HTTP
 	// requests and responses made to the logs.
 	LogHTTP bool
+
+	// Watch instructs the debug-portmap endpoint to keep the mapping and
+	// renew it, logging each lease acquisition, renewal and failure, until
+	// the request is canceled. Duration is ignored.
+	Watch bool
 }
 
 // DebugPortmap invokes the debug-portmap endpoint, and returns an
@@ -483,6 +576,9 @@ func (lc *LocalClient) DebugPortmap(ctx context.Context, opts *DebugPortmapOpts)
 	vals.Set("duration", cmpx.Or(opts.Duration, 5*time.Second).String())
 	vals.Set("type", opts.Type)
 	vals.Set("log_http", strconv.FormatBool(opts.LogHTTP))
+	if opts.Watch {
+		vals.Set("watch", "true")
+	}
 
 	if opts.GatewayAddr.IsValid() != opts.SelfAddr.IsValid() {
 		return nil, fmt.Errorf("both GatewayAddr and SelfAddr must be provided if one is")
@@ -640,7 +736,19 @@ func (lc *LocalClient) FileTargets(ctx context.Context) ([]apitype.FileTarget, e
 // A size of -1 means unknown.
 // The name parameter is the original filename, not escaped.
 func (lc *LocalClient) PushFile(ctx context.Context, target tailcfg.StableNodeID, size int64, name string, r io.Reader) error {
-	req, err := http.NewRequestWithContext(ctx, "PUT", "http://"+apitype.LocalAPIHost+"/localapi/v0/file-put/"+string(target)+"/"+url.PathEscape(name), r)
+	return lc.PushFileFrom(ctx, target, 0, size, name, r)
+}
+
+// PushFileFrom is like PushFile, but resumes an interrupted transfer of the
+// file at offset, which must not be past the Size that PushFilePartial
+// reports. r supplies the file from offset on, and size is how many bytes
+// it supplies, or -1 if unknown.
+func (lc *LocalClient) PushFileFrom(ctx context.Context, target tailcfg.StableNodeID, offset, size int64, name string, r io.Reader) error {
+	u := "http://" + apitype.LocalAPIHost + "/localapi/v0/file-put/" + string(target) + "/" + url.PathEscape(name)
+	if offset > 0 {
+		u += "?offset=" + strconv.FormatInt(offset, 10)
+	}
+	req, err := http.NewRequestWithContext(ctx, "PUT", u, r)
 	if err != nil {
 		return err
 	}
@@ -659,6 +767,42 @@ func (lc *LocalClient) PushFile(ctx context.Context, target tailcfg.StableNodeID
 	return bestError(fmt.Errorf("%s: %s", res.Status, all), all)
 }
 
+// PushFilePartial returns what target received of the file name in an
+// interrupted transfer, for PushFileFrom to resume. It returns an error if
+// target or the local tailscaled don't support resuming transfers.
+func (lc *LocalClient) PushFilePartial(ctx context.Context, target tailcfg.StableNodeID, name string) (*apitype.PartialFileInfo, error) {
+	body, err := lc.get200(ctx, "/localapi/v0/file-put/"+string(target)+"/"+url.PathEscape(name))
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON[*apitype.PartialFileInfo](body)
+}
+
+// Health returns the node's current health problems, most severe first.
+// It returns an empty slice if the node is healthy.
+func (lc *LocalClient) Health(ctx context.Context) ([]health.Warning, error) {
+	body, err := lc.get200(ctx, "/localapi/v0/health")
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON[[]health.Warning](body)
+}
+
+// ListenPort returns the UDP port that the local Tailscale daemon listens
+// on for WireGuard and peer-to-peer traffic, such as to open it in a
+// firewall.
+func (lc *LocalClient) ListenPort(ctx context.Context) (uint16, error) {
+	body, err := lc.get200(ctx, "/localapi/v0/listen-port")
+	if err != nil {
+		return 0, err
+	}
+	res, err := decodeJSON[struct{ Port uint16 }](body)
+	if err != nil {
+		return 0, err
+	}
+	return res.Port, nil
+}
+
 // CheckIPForwarding asks the local Tailscale daemon whether it looks like the
 // machine is properly configured to forward IP packets as a subnet router
 // or exit node.
@@ -1023,6 +1167,22 @@ type modifyRequest struct {
 	return nil
 }
 
+// NetworkLockRotateKey replaces the node's tailnet lock key with a newly
+// generated one, returning its public key. If the old key was trusted, the
+// new key is trusted alongside it; the old key must then be removed with
+// NetworkLockModify, after re-signing the signatures it made.
+func (lc *LocalClient) NetworkLockRotateKey(ctx context.Context) (key.NLPublic, error) {
+	body, err := lc.send(ctx, "POST", "/localapi/v0/tka/rotate-key", 200, nil)
+	if err != nil {
+		return key.NLPublic{}, fmt.Errorf("error: %w", err)
+	}
+	res, err := decodeJSON[struct{ NewKey key.NLPublic }](body)
+	if err != nil {
+		return key.NLPublic{}, err
+	}
+	return res.NewKey, nil
+}
+
 // NetworkLockSign signs the specified node-key and transmits that signature to the control plane.
 // rotationPublic, if specified, must be an ed25519 public key.
 func (lc *LocalClient) NetworkLockSign(ctx context.Context, nodeKey key.NodePublic, rotationPublic []byte) error {
@@ -1129,6 +1289,13 @@ func (lc *LocalClient) NetworkLockSubmitRecoveryAUM(ctx context.Context, aum tka
 
 // SetServeConfig sets or replaces the serving settings.
 // If config is nil, settings are cleared and serving is disabled.
+//
+// If config.ETag is non-empty, as it is when config was returned by
+// GetServeConfig, the config is only replaced if it hasn't changed since.
+// Otherwise SetServeConfig returns an error for which
+// IsPreconditionsFailedError reports true, and the caller should get the
+// config again and reapply its changes. An empty ETag replaces the config
+// unconditionally.
 func (lc *LocalClient) SetServeConfig(ctx context.Context, config *ipn.ServeConfig) error {
 	h := make(http.Header)
 	if config != nil {
@@ -1149,9 +1316,10 @@ func (lc *LocalClient) NetworkLockDisable(ctx context.Context, secret []byte) er
 	return nil
 }
 
-// GetServeConfig return the current serve config.
+// GetServeConfig returns the current serve config, with its ETag set to
+// pass back to SetServeConfig.
 //
-// If the serve config is empty, it returns (nil, nil).
+// If the serve config is empty, it returns an empty, non-nil config.
 func (lc *LocalClient) GetServeConfig(ctx context.Context) (*ipn.ServeConfig, error) {
 	body, h, err := lc.sendWithHeaders(ctx, "GET", "/localapi/v0/serve-config", 200, nil, nil)
 	if err != nil {
@@ -1168,6 +1336,130 @@ func (lc *LocalClient) GetServeConfig(ctx context.Context) (*ipn.ServeConfig, er
 	return sc, nil
 }
 
+// DNSOSConfig returns how tailscaled configures the operating system's DNS.
+func (lc *LocalClient) DNSOSConfig(ctx context.Context) (*apitype.DNSOSConfigResponse, error) {
+	body, err := lc.get200(ctx, "/localapi/v0/dns-osconfig")
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON[*apitype.DNSOSConfigResponse](body)
+}
+
+// LocalAPIAudit returns the recent state-changing LocalAPI requests, oldest
+// first, as recorded by tailscaled since it started.
+func (lc *LocalClient) LocalAPIAudit(ctx context.Context) ([]apitype.LocalAPIAuditEntry, error) {
+	body, err := lc.get200(ctx, "/localapi/v0/localapi-audit")
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON[[]apitype.LocalAPIAuditEntry](body)
+}
+
+// SSHSessions returns the running Tailscale SSH sessions, oldest first.
+// To follow sessions as they start and end, use WatchIPNBus with
+// ipn.NotifySSHSessions.
+func (lc *LocalClient) SSHSessions(ctx context.Context) ([]ipn.SSHSession, error) {
+	body, err := lc.get200(ctx, "/localapi/v0/ssh-sessions")
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON[[]ipn.SSHSession](body)
+}
+
+// GetServeConfigHistory returns the previous serve configs of the current
+// profile, newest first.
+func (lc *LocalClient) GetServeConfigHistory(ctx context.Context) ([]ipn.ServeConfigRevision, error) {
+	body, err := lc.get200(ctx, "/localapi/v0/serve-config-history")
+	if err != nil {
+		return nil, fmt.Errorf("getting serve config history: %w", err)
+	}
+	return decodeJSON[[]ipn.ServeConfigRevision](body)
+}
+
+// UpdateState returns the versions of tailscaled that ran on the node, for
+// rolling back client updates.
+func (lc *LocalClient) UpdateState(ctx context.Context) (*ipn.UpdateState, error) {
+	body, err := lc.get200(ctx, "/localapi/v0/update/state")
+	if err != nil {
+		return nil, fmt.Errorf("getting update state: %w", err)
+	}
+	return decodeJSON[*ipn.UpdateState](body)
+}
+
+// ServeCertStatus returns the status of the TLS certificates that
+// tailscaled gets and renews in the background for the hosts of the serve
+// config.
+func (lc *LocalClient) ServeCertStatus(ctx context.Context) ([]ipn.ServeCertStatus, error) {
+	body, err := lc.get200(ctx, "/localapi/v0/serve-certs")
+	if err != nil {
+		return nil, fmt.Errorf("getting serve cert status: %w", err)
+	}
+	return decodeJSON[[]ipn.ServeCertStatus](body)
+}
+
+// RollbackServeConfig replaces the current serve config with the n-th most
+// recent previous one, as returned by GetServeConfigHistory, where 1 is the
+// config that the current one replaced.
+func (lc *LocalClient) RollbackServeConfig(ctx context.Context, n int) error {
+	_, err := lc.send(ctx, "POST", "/localapi/v0/serve-config-rollback?to="+strconv.Itoa(n), 200, nil)
+	if err != nil {
+		return fmt.Errorf("rolling back serve config: %w", err)
+	}
+	return nil
+}
+
+// StreamServe serves config until ctx is done, then returns nil.
+//
+// Rather than replacing the node's serve config, config is added to it as
+// a foreground config, tied to a WatchIPNBus session that StreamServe holds
+// open. tailscaled removes it when the session ends, so the ports config
+// serves aren't left exposed if the caller exits without cleaning up. This
+// is how 'tailscale serve' runs in the foreground.
+//
+// If another client changes the serve config while StreamServe is adding
+// config, it retries. If the connection to tailscaled is lost before ctx is
+// done, it returns an error.
+func (lc *LocalClient) StreamServe(ctx context.Context, config *ipn.ServeConfig) error {
+	w, err := lc.WatchIPNBus(ctx, ipn.NotifyInitialState)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	n, err := w.Next()
+	if err != nil {
+		return err
+	}
+	if n.SessionID == "" {
+		return errors.New("missing SessionID")
+	}
+	const maxAttempts = 5
+	for attempt := 1; ; attempt++ {
+		sc, err := lc.GetServeConfig(ctx)
+		if err != nil {
+			return err
+		}
+		if sc.Foreground == nil {
+			sc.Foreground = make(map[string]*ipn.ServeConfig)
+		}
+		sc.Foreground[n.SessionID] = config
+		err = lc.SetServeConfig(ctx, sc)
+		if err == nil {
+			break
+		}
+		if !IsPreconditionsFailedError(err) || attempt == maxAttempts {
+			return err
+		}
+	}
+	for {
+		if _, err := w.Next(); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("watching IPN bus: %w", err)
+		}
+	}
+}
+
 func getServeConfigFromJSON(body []byte) (sc *ipn.ServeConfig, err error) {
 	if err := json.Unmarshal(body, &sc); err != nil {
 		return nil, err
@@ -1266,6 +1558,42 @@ func (lc *LocalClient) DeleteProfile(ctx context.Context, profile ipn.ProfileID)
 	return err
 }
 
+// PrefsPresets returns the prefs presets of the current profile, sorted by
+// name.
+func (lc *LocalClient) PrefsPresets(ctx context.Context) ([]ipn.PrefsPreset, error) {
+	body, err := lc.get200(ctx, "/localapi/v0/prefs-presets/")
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON[[]ipn.PrefsPreset](body)
+}
+
+// SavePrefsPreset saves the current prefs as the preset name of the current
+// profile, replacing any existing preset of that name.
+func (lc *LocalClient) SavePrefsPreset(ctx context.Context, name string) (*ipn.PrefsPreset, error) {
+	body, err := lc.send(ctx, "PUT", "/localapi/v0/prefs-presets/"+url.PathEscape(name), 200, nil)
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON[*ipn.PrefsPreset](body)
+}
+
+// UsePrefsPreset applies the preset name of the current profile to the
+// current prefs, and returns the new prefs.
+func (lc *LocalClient) UsePrefsPreset(ctx context.Context, name string) (*ipn.Prefs, error) {
+	body, err := lc.send(ctx, "POST", "/localapi/v0/prefs-presets/"+url.PathEscape(name), 200, nil)
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON[*ipn.Prefs](body)
+}
+
+// DeletePrefsPreset deletes the preset name of the current profile.
+func (lc *LocalClient) DeletePrefsPreset(ctx context.Context, name string) error {
+	_, err := lc.send(ctx, "DELETE", "/localapi/v0/prefs-presets/"+url.PathEscape(name), http.StatusNoContent, nil)
+	return err
+}
+
 // QueryFeature makes a request for instructions on how to enable
 // a feature, such as Funnel, for the node's tailnet. If relevant,
 // this includes a control server URL the user can visit to enable
@@ -1296,6 +1624,16 @@ func (lc *LocalClient) DebugDERPRegion(ctx context.Context, regionIDOrCode strin
 	return decodeJSON[*ipnstate.DebugDERPRegionReport](body)
 }
 
+// DebugNetstackConns returns the TCP and UDP flows that netstack forwards to
+// backends, for userspace-networking nodes and subnet routers.
+func (lc *LocalClient) DebugNetstackConns(ctx context.Context) ([]ipnstate.NetstackConn, error) {
+	body, err := lc.get200(ctx, "/localapi/v0/debug-netstack-conns")
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON[[]ipnstate.NetstackConn](body)
+}
+
 // DebugSetExpireIn marks the current node key to expire in d.
 //
 // This is meant primarily for debug and testing.
@@ -1310,7 +1648,37 @@ func (lc *LocalClient) DebugSetExpireIn(ctx context.Context, d time.Duration) er
 // The provided context does not determine the lifetime of the
 // returned io.ReadCloser.
 func (lc *LocalClient) StreamDebugCapture(ctx context.Context) (io.ReadCloser, error) {
-	req, err := http.NewRequestWithContext(ctx, "POST", "http://"+apitype.LocalAPIHost+"/localapi/v0/debug-capture", nil)
+	return lc.StreamDebugCaptureWithOpts(ctx, nil)
+}
+
+// DebugCaptureOpts contains options for StreamDebugCaptureWithOpts.
+type DebugCaptureOpts struct {
+	// Hosts, if non-empty, limits the capture to the IP packets from or
+	// to one of these addresses.
+	Hosts []netip.Addr
+
+	// Ports, if non-empty, limits the capture to the TCP, UDP and SCTP
+	// packets from or to one of these ports.
+	Ports []uint16
+}
+
+// StreamDebugCaptureWithOpts is like StreamDebugCapture, but only captures
+// the packets selected by opts. A nil opts captures all packets.
+func (lc *LocalClient) StreamDebugCaptureWithOpts(ctx context.Context, opts *DebugCaptureOpts) (io.ReadCloser, error) {
+	v := url.Values{}
+	if opts != nil {
+		for _, ip := range opts.Hosts {
+			v.Add("host", ip.String())
+		}
+		for _, port := range opts.Ports {
+			v.Add("port", strconv.Itoa(int(port)))
+		}
+	}
+	u := "http://" + apitype.LocalAPIHost + "/localapi/v0/debug-capture"
+	if len(v) > 0 {
+		u += "?" + v.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", u, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -5,7 +5,21 @@
 
 package tailscale
 
-import "testing"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"tailscale.com/client/tailscale/apitype"
+	"tailscale.com/ipn"
+)
 
 func TestGetServeConfigFromJSON(t *testing.T) {
 	sc, err := getServeConfigFromJSON([]byte("null"))
@@ -25,3 +39,190 @@ func TestGetServeConfigFromJSON(t *testing.T) {
 		t.Errorf("want non-nil TCP for object")
 	}
 }
+
+func TestLocalAPIError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		wantIs   error
+		wantCode apitype.ErrorCode
+		wantMsg  string
+	}{
+		{
+			name:     "coded",
+			err:      bestError(errors.New("500"), []byte(`{"error":"Funnel not available","code":"funnel-not-enabled","details":{"port":"443"}}`)),
+			wantIs:   ErrFunnelNotEnabled,
+			wantCode: apitype.ErrCodeFunnelNotEnabled,
+			wantMsg:  "Funnel not available",
+		},
+		{
+			name:    "uncoded",
+			err:     bestError(errors.New("500"), []byte(`{"error":"boom"}`)),
+			wantMsg: "boom",
+		},
+		{
+			name:    "not-json",
+			err:     bestError(errors.New("500: boom"), []byte("boom")),
+			wantMsg: "500: boom",
+		},
+		{
+			name:     "access-denied-text",
+			err:      fmt.Errorf("wrapped: %w", &AccessDeniedError{localAPIError([]byte("prefs access denied\n"), apitype.ErrCodeAccessDenied)}),
+			wantIs:   ErrAccessDenied,
+			wantCode: apitype.ErrCodeAccessDenied,
+			wantMsg:  "wrapped: Access denied: prefs access denied",
+		},
+		{
+			name:     "precondition-json",
+			err:      &PreconditionsFailedError{localAPIError([]byte(`{"error":"etag mismatch","code":"precondition-failed"}`), apitype.ErrCodePreconditionFailed)},
+			wantIs:   ErrPreconditionFailed,
+			wantCode: apitype.ErrCodePreconditionFailed,
+			wantMsg:  "Preconditions failed: etag mismatch",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.err.Error(); got != tt.wantMsg {
+				t.Errorf("Error() = %q, want %q", got, tt.wantMsg)
+			}
+			if got := ErrorCode(tt.err); got != tt.wantCode {
+				t.Errorf("ErrorCode = %q, want %q", got, tt.wantCode)
+			}
+			for _, e := range errorsByCode {
+				if got, want := errors.Is(tt.err, e), e == tt.wantIs; got != want {
+					t.Errorf("errors.Is(err, %v) = %v, want %v", e, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestForbiddenResponses(t *testing.T) {
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, body)
+	}))
+	defer srv.Close()
+	lc := &LocalClient{
+		Dial: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "tcp", srv.Listener.Addr().String())
+		},
+	}
+
+	tests := []struct {
+		name         string
+		body         string
+		wantIs       error
+		accessDenied bool
+	}{
+		{
+			name:         "text",
+			body:         "serve config denied\n",
+			wantIs:       ErrAccessDenied,
+			accessDenied: true,
+		},
+		{
+			name:   "funnel",
+			body:   `{"error":"Funnel not available on port 8443","code":"funnel-not-enabled","details":{"port":"8443"}}`,
+			wantIs: ErrFunnelNotEnabled,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body = tt.body
+			_, err := lc.send(context.Background(), "POST", "/localapi/v0/serve-config", 200, nil)
+			if !errors.Is(err, tt.wantIs) {
+				t.Errorf("err = %v, want %v", err, tt.wantIs)
+			}
+			if got := IsAccessDeniedError(err); got != tt.accessDenied {
+				t.Errorf("IsAccessDeniedError = %v, want %v", got, tt.accessDenied)
+			}
+		})
+	}
+}
+
+func TestStreamServe(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		posts   int
+		applied *ipn.ServeConfig
+	)
+	watching := make(chan bool, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/localapi/v0/watch-ipn-bus":
+			w.Write([]byte(`{"SessionID":"sess1"}` + "\n"))
+			w.(http.Flusher).Flush()
+			watching <- true
+			<-r.Context().Done()
+		case r.URL.Path == "/localapi/v0/serve-config" && r.Method == "GET":
+			w.Header().Set("Etag", "etag1")
+			w.Write([]byte(`{"TCP":{"80":{"HTTP":true}}}`))
+		case r.URL.Path == "/localapi/v0/serve-config" && r.Method == "POST":
+			mu.Lock()
+			defer mu.Unlock()
+			posts++
+			if posts == 1 {
+				// Another client changed the config in between.
+				w.WriteHeader(http.StatusPreconditionFailed)
+				w.Write([]byte(`{"error":"etag mismatch","code":"precondition-failed"}`))
+				return
+			}
+			if got := r.Header.Get("If-Match"); got != "etag1" {
+				t.Errorf("If-Match = %q; want etag1", got)
+			}
+			applied = new(ipn.ServeConfig)
+			if err := json.NewDecoder(r.Body).Decode(applied); err != nil {
+				t.Error(err)
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	lc := &LocalClient{
+		Dial: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "tcp", srv.Listener.Addr().String())
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fg := &ipn.ServeConfig{TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}}}
+	done := make(chan error, 1)
+	go func() { done <- lc.StreamServe(ctx, fg) }()
+	<-watching
+	for {
+		mu.Lock()
+		ok := applied != nil
+		mu.Unlock()
+		if ok {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("StreamServe: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("StreamServe didn't return after its context was done")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if posts != 2 {
+		t.Errorf("got %d posts; want 2", posts)
+	}
+	if !applied.TCP[80].HTTP {
+		t.Errorf("background config lost: %+v", applied.TCP)
+	}
+	if got := applied.Foreground["sess1"]; got == nil || !got.TCP[443].HTTPS {
+		t.Errorf("Foreground = %+v; want the streamed config under sess1", applied.Foreground)
+	}
+}
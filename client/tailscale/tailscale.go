@@ -16,6 +16,8 @@
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 // I_Acknowledge_This_API_Is_Unstable must be set true to use this package
@@ -32,6 +34,20 @@
 // maxSize is the maximum read size (10MB) of responses from the server.
 const maxReadSize = 10 << 20
 
+const (
+	// maxRetries is the maximum number of times that a request rate limited
+	// by the server (with a 429 status) is retried.
+	maxRetries = 5
+	// maxRetryDelay is the longest wait before retrying a rate-limited
+	// request, even if the server asks for longer.
+	maxRetryDelay = time.Minute
+)
+
+// retryDelayBase is the wait before the first retry of a rate-limited
+// request, if the server doesn't say how long to wait. It doubles with each
+// retry. It's a variable for tests.
+var retryDelayBase = time.Second
+
 // Client makes API calls to the Tailscale control plane API server.
 //
 // Use NewClient to instantiate one. Exported fields should be set before
@@ -115,15 +131,63 @@ func (c *Client) Do(req *http.Request) (*http.Response, error) {
 
 // sendRequest add the authentication key to the request and sends it. It
 // receives the response and reads up to 10MB of it.
+//
+// Requests rate limited by the server are retried up to maxRetries times,
+// with exponential backoff or after the delay requested by the server, until
+// the request's context is done.
 func (c *Client) sendRequest(req *http.Request) ([]byte, *http.Response, error) {
 	if !I_Acknowledge_This_API_Is_Unstable {
 		return nil, nil, errors.New("use of Client without setting I_Acknowledge_This_API_Is_Unstable")
 	}
 	c.setAuth(req)
-	resp, err := c.httpClient().Do(req)
-	if err != nil {
-		return nil, resp, err
+	for attempt := 0; ; attempt++ {
+		resp, err := c.httpClient().Do(req)
+		if err != nil {
+			return nil, resp, err
+		}
+		canRetry := req.Body == nil || req.GetBody != nil
+		if resp.StatusCode != http.StatusTooManyRequests || attempt == maxRetries || !canRetry {
+			return readResponse(resp)
+		}
+		resp.Body.Close()
+
+		timer := time.NewTimer(retryDelay(resp, attempt))
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, resp, req.Context().Err()
+		case <-timer.C:
+		}
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return nil, nil, err
+			}
+		}
 	}
+}
+
+// retryDelay returns how long to wait before retrying a request after its
+// attempt number attempt (starting at 0) was rate limited with resp.
+func retryDelay(resp *http.Response, attempt int) time.Duration {
+	d := retryDelayBase << attempt
+	if v := resp.Header.Get("Retry-After"); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+			d = time.Duration(secs) * time.Second
+		} else if t, err := http.ParseTime(v); err == nil {
+			d = time.Until(t)
+		}
+	}
+	if d < 0 {
+		return 0
+	}
+	if d > maxRetryDelay {
+		return maxRetryDelay
+	}
+	return d
+}
+
+// readResponse reads up to 10MB of the body of resp and closes it.
+func readResponse(resp *http.Response) ([]byte, *http.Response, error) {
 	defer resp.Body.Close()
 
 	// Read response. Limit the response to 10MB.
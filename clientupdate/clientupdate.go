@@ -84,6 +84,12 @@ type Arguments struct {
 	// PkgsAddr is the address of the pkgs server to fetch updates from.
 	// Defaults to "https://pkgs.tailscale.com".
 	PkgsAddr string
+	// PkgsMirrors are mirrors of the pkgs server, tried in order when
+	// PkgsAddr is unreachable or serves a file that fails validation.
+	PkgsMirrors []string
+	// TLog, if true, requires downloaded packages to be included in the
+	// transparency log of the pkgs server, in addition to being signed.
+	TLog bool
 }
 
 func (args Arguments) validate() error {
@@ -806,10 +812,11 @@ func makeSelfCopy() (tmpPathExe string, err error) {
 }
 
 func (up *Updater) downloadURLToFile(pathSrc, fileDst string) (ret error) {
-	c, err := distsign.NewClient(up.Logf, up.PkgsAddr)
+	c, err := distsign.NewClient(up.Logf, append([]string{up.PkgsAddr}, up.PkgsMirrors...)...)
 	if err != nil {
 		return err
 	}
+	c.TLog = up.TLog
 	return c.Download(context.Background(), pathSrc, fileDst)
 }
 
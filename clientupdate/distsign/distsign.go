@@ -35,6 +35,13 @@
 // The signing public keys are fetched by the client dynamically before every
 // download and can be rotated more readily, assuming that most deployed
 // clients trust the root keys used to issue fresh signing keys.
+//
+// Optionally, clients can also require files to be included in an
+// append-only transparency log, whose root is signed by one of the root keys.
+// The server then additionally serves:
+//   - tlog.root - the current root of the transparency log
+//   - tlog.root.sig - signature of tlog.root using one of the root keys
+//   - $file.tlog - proof of inclusion of $file in the log of that root
 package distsign
 
 import (
@@ -150,6 +157,22 @@ func (s *SigningKey) SignPackageHash(hash []byte, len int64) ([]byte, error) {
 	return ed25519.Sign(s.k, msg), nil
 }
 
+// VerifyPackage verifies that sig, as made by SignPackageHash, is a valid
+// signature of the package read from r by any of the signing keys. It's for
+// packages distributed outside of a distribution server, with signing keys
+// that the caller already trusts.
+func VerifyPackage(keys []ed25519.PublicKey, r io.Reader, sig []byte) error {
+	h := NewPackageHash()
+	if _, err := io.Copy(h, r); err != nil {
+		return err
+	}
+	msg := binary.LittleEndian.AppendUint64(h.Sum(nil), uint64(h.Len()))
+	if !VerifyAny(keys, msg, sig) {
+		return errors.New("signature does not validate with any of the signing keys")
+	}
+	return nil
+}
+
 // PackageHash is a hash.Hash that counts the number of bytes written. Use it
 // to get the hash and length inputs to SigningKey.SignPackageHash.
 type PackageHash struct {
@@ -183,33 +206,87 @@ func (ph *PackageHash) Len() int64 { return ph.len }
 
 // Client downloads and validates files from a distribution server.
 type Client struct {
-	logf     logger.Logf
-	roots    []ed25519.PublicKey
+	// TLog, if true, makes Download and ValidateLocalBinary also require
+	// the file to be included in the transparency log. See TLogRoot.
+	TLog bool
+
+	logf    logger.Logf
+	roots   []ed25519.PublicKey
+	mirrors []*url.URL // in order of preference
+
+	// pkgsAddr is the mirror that url uses, set by eachMirror.
 	pkgsAddr *url.URL
 }
 
-// NewClient returns a new client for distribution server located at pkgsAddr,
-// and uses embedded root keys from the roots/ subdirectory of this package.
-func NewClient(logf logger.Logf, pkgsAddr string) (*Client, error) {
+// NewClient returns a new client for distribution server located at
+// pkgsAddrs, and uses embedded root keys from the roots/ subdirectory of this
+// package.
+//
+// If multiple pkgsAddrs are given, they are mirrors of the same server, tried
+// in order until one of them succeeds. Files from any mirror are validated
+// the same way, so mirrors don't need to be trusted.
+func NewClient(logf logger.Logf, pkgsAddrs ...string) (*Client, error) {
 	if logf == nil {
 		logf = log.Printf
 	}
-	u, err := url.Parse(pkgsAddr)
-	if err != nil {
-		return nil, fmt.Errorf("invalid pkgsAddr %q: %w", pkgsAddr, err)
+	if len(pkgsAddrs) == 0 {
+		return nil, errors.New("no pkgsAddr given")
+	}
+	c := &Client{logf: logf, roots: roots()}
+	for _, addr := range pkgsAddrs {
+		u, err := url.Parse(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pkgsAddr %q: %w", addr, err)
+		}
+		c.mirrors = append(c.mirrors, u)
 	}
-	return &Client{logf: logf, roots: roots(), pkgsAddr: u}, nil
+	c.pkgsAddr = c.mirrors[0]
+	return c, nil
 }
 
 func (c *Client) url(path string) string {
 	return c.pkgsAddr.JoinPath(path).String()
 }
 
-// Download fetches a file at path srcPath from pkgsAddr passed in NewClient.
-// The file is downloaded to dstPath and its signature is validated using the
-// embedded root keys. Download returns an error if anything goes wrong with
-// the actual file download or with signature validation.
+// eachMirror calls f with a copy of c for each mirror in turn, until f
+// succeeds or ctx is done. It returns the errors of all attempts if none
+// succeeded.
+func (c *Client) eachMirror(ctx context.Context, f func(*Client) error) error {
+	var errs []error
+	for i, u := range c.mirrors {
+		mc := *c
+		mc.pkgsAddr = u
+		err := f(&mc)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+		if i < len(c.mirrors)-1 {
+			c.logf("Failed using %v, trying next mirror: %v", u, err)
+		}
+	}
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	return errors.Join(errs...)
+}
+
+// Download fetches a file at path srcPath from the pkgsAddrs passed in
+// NewClient. The file is downloaded to dstPath and its signature is validated
+// using the embedded root keys. Download returns an error if anything goes
+// wrong with the actual file download or with signature validation on every
+// mirror.
 func (c *Client) Download(ctx context.Context, srcPath, dstPath string) error {
+	return c.eachMirror(ctx, func(c *Client) error {
+		return c.download1(ctx, srcPath, dstPath)
+	})
+}
+
+// download1 is Download from a single mirror.
+func (c *Client) download1(ctx context.Context, srcPath, dstPath string) error {
 	// Always fetch a fresh signing key.
 	sigPub, err := c.signingKeys()
 	if err != nil {
@@ -239,6 +316,13 @@ func (c *Client) Download(ctx context.Context, srcPath, dstPath string) error {
 		return fmt.Errorf("signature %q for file %q does not validate with the current release signing key; either you are under attack, or attempting to download an old version of Tailscale which was signed with an older signing key", sigURL, srcURL)
 	}
 	c.logf("Signature OK")
+	if c.TLog {
+		if err := c.verifyTLog(srcPath, hash, len); err != nil {
+			// Best-effort clean up of downloaded package.
+			os.Remove(dstPathUnverified)
+			return err
+		}
+	}
 
 	if err := os.Rename(dstPathUnverified, dstPath); err != nil {
 		return fmt.Errorf("failed to move %q to %q after signature validation", dstPathUnverified, dstPath)
@@ -250,8 +334,15 @@ func (c *Client) Download(ctx context.Context, srcPath, dstPath string) error {
 // ValidateLocalBinary fetches the latest signature associated with the binary
 // at srcURLPath and uses it to validate the file located on disk via
 // localFilePath. ValidateLocalBinary returns an error if anything goes wrong
-// with the signature download or with signature validation.
+// with the signature download or with signature validation on every mirror.
 func (c *Client) ValidateLocalBinary(srcURLPath, localFilePath string) error {
+	return c.eachMirror(context.Background(), func(c *Client) error {
+		return c.validateLocalBinary(srcURLPath, localFilePath)
+	})
+}
+
+// validateLocalBinary is ValidateLocalBinary using a single mirror.
+func (c *Client) validateLocalBinary(srcURLPath, localFilePath string) error {
 	// Always fetch a fresh signing key.
 	sigPub, err := c.signingKeys()
 	if err != nil {
@@ -285,6 +376,11 @@ func (c *Client) ValidateLocalBinary(srcURLPath, localFilePath string) error {
 		return fmt.Errorf("signature %q for file %q does not validate with the current release signing key; either you are under attack, or attempting to download an old version of Tailscale which was signed with an older signing key", sigURL, localFilePath)
 	}
 	c.logf("Signature OK")
+	if c.TLog {
+		if err := c.verifyTLog(srcURLPath, hash, hashLen); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
@@ -320,6 +320,108 @@ func TestRotateSigning(t *testing.T) {
 	}
 }
 
+func TestDownloadMirrors(t *testing.T) {
+	primary := newTestServer(t)
+	mirror := newTestServer(t)
+	mirror.roots = primary.roots
+	mirror.sign = primary.sign
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	c := primary.client(t)
+	for _, s := range []string{down.URL, mirror.srv.URL} {
+		u, err := url.Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.mirrors = append(c.mirrors, u)
+	}
+
+	tests := []struct {
+		desc    string
+		before  func(*testing.T)
+		wantErr bool
+	}{
+		{
+			desc: "primary",
+			before: func(*testing.T) {
+				primary.addSigned("hello", []byte("world"))
+			},
+		},
+		{
+			desc: "missing on primary",
+			before: func(*testing.T) {
+				mirror.addSigned("hello", []byte("world"))
+			},
+		},
+		{
+			desc: "tampered on primary",
+			before: func(*testing.T) {
+				primary.addSigned("hello", []byte("world"))
+				primary.add("hello", []byte("evil"))
+				mirror.addSigned("hello", []byte("world"))
+			},
+		},
+		{
+			desc: "tampered on mirror",
+			before: func(*testing.T) {
+				mirror.addSigned("hello", []byte("world"))
+				mirror.add("hello", []byte("evil"))
+			},
+			wantErr: true,
+		},
+		{
+			desc:    "missing everywhere",
+			before:  func(*testing.T) {},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			primary.reset()
+			mirror.reset()
+			tt.before(t)
+
+			dst := filepath.Join(t.TempDir(), "hello")
+			err := c.Download(context.Background(), "hello", dst)
+			if err != nil {
+				if tt.wantErr {
+					return
+				}
+				t.Fatalf("unexpected error from Download: %v", err)
+			}
+			if tt.wantErr {
+				t.Fatal("Download succeeded, expected an error")
+			}
+			got, err := os.ReadFile(dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := []byte("world"); !bytes.Equal(got, want) {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestVerifyPackage(t *testing.T) {
+	signing1, signing2 := newSigningKeyPair(t), newSigningKeyPair(t)
+	keys, err := ParseSigningKeyBundle(signing1.pubRaw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg := []byte("derp map")
+	if err := VerifyPackage(keys, bytes.NewReader(pkg), signing1.sign(pkg)); err != nil {
+		t.Errorf("valid signature: %v", err)
+	}
+	if err := VerifyPackage(keys, bytes.NewReader(pkg), signing2.sign(pkg)); err == nil {
+		t.Error("signature by unknown key validated")
+	}
+	if err := VerifyPackage(keys, bytes.NewReader([]byte("derp map!")), signing1.sign(pkg)); err == nil {
+		t.Error("signature of different package validated")
+	}
+}
+
 func TestParseRootKey(t *testing.T) {
 	tests := []struct {
 		desc     string
@@ -475,6 +577,7 @@ func (s *testServer) client(t *testing.T) *Client {
 	return &Client{
 		logf:     t.Logf,
 		roots:    roots,
+		mirrors:  []*url.URL{u},
 		pkgsAddr: u,
 	}
 }
@@ -0,0 +1,273 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package distsign
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+
+	"tailscale.com/util/cmpver"
+)
+
+// manifestSizeLimit is the maximum size of a manifest file.
+const manifestSizeLimit = 1 << 20 // 1MB
+
+// manifestSigPrefix is prepended to manifests before they're signed, so that
+// a manifest signature can never be mistaken for a package signature.
+const manifestSigPrefix = "tailscale distsign manifest v1\n"
+
+// Manifest lists a set of distributable files, such as the artifacts of a
+// release for all platforms. A single signature of the manifest, made with a
+// signing key, vouches for all of the files in it, which are then checked
+// against their sizes and SHA-512 hashes.
+//
+// Manifests are served as JSON, next to a $manifest.sig signature made with
+// SigningKey.SignManifest.
+type Manifest struct {
+	// Version is the release version that the artifacts belong to.
+	Version string `json:"version"`
+
+	// Artifacts are the files listed by the manifest.
+	Artifacts []ManifestArtifact `json:"artifacts"`
+}
+
+// ManifestArtifact is a file listed in a Manifest.
+type ManifestArtifact struct {
+	// Name is the path of the file, relative to the root of the
+	// distribution server. Files extracted from a tarball, such as
+	// binaries, can be listed under the path of the directory they're
+	// extracted to.
+	Name string `json:"name"`
+
+	// Platform, if non-empty, is the GOOS/GOARCH the file is built for.
+	Platform string `json:"platform,omitempty"`
+
+	// Size is the size of the file in bytes.
+	Size int64 `json:"size"`
+
+	// SHA512 is the hex-encoded SHA-512 hash of the file.
+	SHA512 string `json:"sha512"`
+
+	// MinClientVersion, if non-empty, is the oldest client version that
+	// may install the file, such as when an update requires a migration
+	// only newer clients know how to perform.
+	MinClientVersion string `json:"minClientVersion,omitempty"`
+}
+
+// NewManifestArtifact returns a ManifestArtifact named name for the
+// contents read from r.
+func NewManifestArtifact(name string, r io.Reader) (ManifestArtifact, error) {
+	h := sha512.New()
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return ManifestArtifact{}, err
+	}
+	return ManifestArtifact{
+		Name:   name,
+		Size:   n,
+		SHA512: hex.EncodeToString(h.Sum(nil)),
+	}, nil
+}
+
+// ParseManifest parses and validates the JSON-encoded manifest raw. It
+// does not check its signature; see Client.DownloadManifest.
+func ParseManifest(raw []byte) (*Manifest, error) {
+	m := new(Manifest)
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.DisallowUnknownFields()
+	if err := d.Decode(m); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if len(m.Artifacts) == 0 {
+		return nil, errors.New("invalid manifest: no artifacts")
+	}
+	seen := make(map[string]bool)
+	for _, a := range m.Artifacts {
+		if !fs.ValidPath(a.Name) || a.Name == "." {
+			return nil, fmt.Errorf("invalid manifest: invalid artifact name %q", a.Name)
+		}
+		if seen[a.Name] {
+			return nil, fmt.Errorf("invalid manifest: duplicate artifact %q", a.Name)
+		}
+		seen[a.Name] = true
+		if a.Size <= 0 {
+			return nil, fmt.Errorf("invalid manifest: artifact %q has size %d", a.Name, a.Size)
+		}
+		if b, err := hex.DecodeString(a.SHA512); err != nil || len(b) != sha512.Size {
+			return nil, fmt.Errorf("invalid manifest: artifact %q has invalid SHA-512 %q", a.Name, a.SHA512)
+		}
+	}
+	return m, nil
+}
+
+// Artifact returns the artifact named name, if m lists it.
+func (m *Manifest) Artifact(name string) (_ ManifestArtifact, ok bool) {
+	for _, a := range m.Artifacts {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return ManifestArtifact{}, false
+}
+
+// VerifyFS verifies that fsys contains every artifact listed in m, at its
+// Name, with the expected size and hash. It returns an error describing all
+// missing or mismatched files, if any. Files in fsys that aren't in m are
+// ignored.
+//
+// It's used by mirrors to check that they have a complete, intact copy of
+// a release.
+func (m *Manifest) VerifyFS(fsys fs.FS) error {
+	var errs []error
+	for _, a := range m.Artifacts {
+		f, err := fsys.Open(a.Name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		err = a.Verify(f)
+		f.Close()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Verify reports an error if the contents read from r don't have a's size
+// and hash.
+func (a ManifestArtifact) Verify(r io.Reader) error {
+	got, err := NewManifestArtifact(a.Name, io.LimitReader(r, a.Size+1))
+	if err != nil {
+		return fmt.Errorf("reading %q: %w", a.Name, err)
+	}
+	if got.Size != a.Size {
+		return fmt.Errorf("%q has size %d, manifest says %d", a.Name, got.Size, a.Size)
+	}
+	if got.SHA512 != a.SHA512 {
+		return fmt.Errorf("%q does not match the SHA-512 hash in the manifest", a.Name)
+	}
+	return nil
+}
+
+// VerifyFile is like Verify, for the local file at path.
+func (a ManifestArtifact) VerifyFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return a.Verify(f)
+}
+
+// SupportsClientVersion reports whether a client running version v may
+// install a, according to its MinClientVersion.
+func (a ManifestArtifact) SupportsClientVersion(v string) bool {
+	return a.MinClientVersion == "" || cmpver.Compare(v, a.MinClientVersion) >= 0
+}
+
+// SignManifest signs the JSON-encoded manifest raw, which must be valid.
+func (s *SigningKey) SignManifest(raw []byte) ([]byte, error) {
+	if _, err := ParseManifest(raw); err != nil {
+		return nil, err
+	}
+	return ed25519.Sign(s.k, manifestSigMessage(raw)), nil
+}
+
+func manifestSigMessage(raw []byte) []byte {
+	return append([]byte(manifestSigPrefix), raw...)
+}
+
+// DownloadManifest fetches the manifest at path srcPath from the pkgsAddrs
+// passed in NewClient, and its signature at srcPath+".sig". It returns the
+// manifest if its signature validates with the current signing keys.
+func (c *Client) DownloadManifest(ctx context.Context, srcPath string) (*Manifest, error) {
+	var m *Manifest
+	err := c.eachMirror(ctx, func(c *Client) (err error) {
+		m, err = c.downloadManifest(srcPath)
+		return err
+	})
+	return m, err
+}
+
+// downloadManifest is DownloadManifest from a single mirror.
+func (c *Client) downloadManifest(srcPath string) (*Manifest, error) {
+	// Always fetch a fresh signing key.
+	sigPub, err := c.signingKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	srcURL := c.url(srcPath)
+	sigURL := srcURL + ".sig"
+	c.logf("Downloading %q", srcURL)
+	raw, err := fetch(srcURL, manifestSizeLimit)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := fetch(sigURL, signatureSizeLimit)
+	if err != nil {
+		return nil, err
+	}
+	if !VerifyAny(sigPub, manifestSigMessage(raw), sig) {
+		return nil, fmt.Errorf("signature %q for manifest %q does not validate with the current release signing key; either you are under attack, or attempting to use an old manifest which was signed with an older signing key", sigURL, srcURL)
+	}
+	c.logf("Manifest signature OK")
+	return ParseManifest(raw)
+}
+
+// DownloadFromManifest fetches the artifact named name in m, which must have
+// come from DownloadManifest, to dstPath. Unlike Download, it doesn't fetch a
+// signature for the file, but checks it against its size and hash in m.
+func (c *Client) DownloadFromManifest(ctx context.Context, m *Manifest, name, dstPath string) error {
+	a, ok := m.Artifact(name)
+	if !ok {
+		return fmt.Errorf("%q is not in the manifest for version %q", name, m.Version)
+	}
+	return c.eachMirror(ctx, func(c *Client) error {
+		return c.downloadArtifact(ctx, a, dstPath)
+	})
+}
+
+// downloadArtifact fetches a from a single mirror to dstPath.
+func (c *Client) downloadArtifact(ctx context.Context, a ManifestArtifact, dstPath string) error {
+	srcURL := c.url(a.Name)
+	c.logf("Downloading %q", srcURL)
+	dstPathUnverified := dstPath + ".unverified"
+	if _, _, err := c.download(ctx, srcURL, dstPathUnverified, a.Size); err != nil {
+		return err
+	}
+	if err := a.VerifyFile(dstPathUnverified); err != nil {
+		// Best-effort clean up of downloaded package.
+		os.Remove(dstPathUnverified)
+		return err
+	}
+	c.logf("Hash OK")
+
+	if err := os.Rename(dstPathUnverified, dstPath); err != nil {
+		return fmt.Errorf("failed to move %q to %q after hash validation", dstPathUnverified, dstPath)
+	}
+	return nil
+}
+
+// ArtifactsForPlatform returns the artifacts in m for the GOOS/GOARCH
+// platform, along with any that aren't specific to a platform.
+func (m *Manifest) ArtifactsForPlatform(platform string) []ManifestArtifact {
+	var ret []ManifestArtifact
+	for _, a := range m.Artifacts {
+		if a.Platform == "" || a.Platform == platform {
+			ret = append(ret, a)
+		}
+	}
+	return ret
+}
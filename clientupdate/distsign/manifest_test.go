@@ -0,0 +1,215 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package distsign
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"tailscale.com/util/must"
+)
+
+func newTestManifest(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	m := Manifest{Version: "1.2.3"}
+	for _, name := range []string{"tailscale_1.2.3_amd64.tgz", "tailscale_1.2.3_amd64/tailscaled"} {
+		a, err := NewManifestArtifact(name, bytes.NewReader(files[name]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.Platform = "linux/amd64"
+		m.Artifacts = append(m.Artifacts, a)
+	}
+	raw, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestDownloadManifest(t *testing.T) {
+	srv := newTestServer(t)
+	c := srv.client(t)
+	ctx := context.Background()
+
+	files := map[string][]byte{
+		"tailscale_1.2.3_amd64.tgz":        []byte("tarball"),
+		"tailscale_1.2.3_amd64/tailscaled": []byte("binary"),
+	}
+	raw := newTestManifest(t, files)
+
+	tests := []struct {
+		desc    string
+		sig     func(*testing.T) []byte
+		wantErr bool
+	}{
+		{
+			desc: "success",
+			sig: func(t *testing.T) []byte {
+				return must.Get(srv.sign[0].SignManifest(raw))
+			},
+		},
+		{
+			desc: "signed as a package",
+			sig: func(t *testing.T) []byte {
+				return srv.sign[0].sign(raw)
+			},
+			wantErr: true,
+		},
+		{
+			desc: "signed with untrusted key",
+			sig: func(t *testing.T) []byte {
+				return must.Get(newSigningKeyPair(t).SignManifest(raw))
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			srv.reset()
+			srv.add("manifest.json", raw)
+			srv.add("manifest.json.sig", tt.sig(t))
+			m, err := c.DownloadManifest(ctx, "manifest.json")
+			if err != nil {
+				if tt.wantErr {
+					return
+				}
+				t.Fatalf("unexpected error from DownloadManifest: %v", err)
+			}
+			if tt.wantErr {
+				t.Fatal("DownloadManifest succeeded, expected an error")
+			}
+			if m.Version != "1.2.3" || len(m.Artifacts) != 2 {
+				t.Fatalf("unexpected manifest %+v", m)
+			}
+		})
+	}
+
+	// Download the artifacts using the manifest.
+	srv.reset()
+	srv.add("manifest.json", raw)
+	srv.add("manifest.json.sig", must.Get(srv.sign[0].SignManifest(raw)))
+	for name, data := range files {
+		srv.add(name, data)
+	}
+	m, err := c.DownloadManifest(ctx, "manifest.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(t.TempDir(), "tailscaled")
+	if err := c.DownloadFromManifest(ctx, m, "tailscale_1.2.3_amd64/tailscaled", dst); err != nil {
+		t.Fatalf("DownloadFromManifest: %v", err)
+	}
+	if got, err := os.ReadFile(dst); err != nil || !bytes.Equal(got, files["tailscale_1.2.3_amd64/tailscaled"]) {
+		t.Errorf("downloaded %q, %v", got, err)
+	}
+
+	srv.add("tailscale_1.2.3_amd64/tailscaled", []byte("BINARY"))
+	if err := c.DownloadFromManifest(ctx, m, "tailscale_1.2.3_amd64/tailscaled", dst+"2"); err == nil {
+		t.Error("DownloadFromManifest succeeded for a modified file")
+	}
+	if err := c.DownloadFromManifest(ctx, m, "unlisted", dst+"3"); err == nil {
+		t.Error("DownloadFromManifest succeeded for an unlisted file")
+	}
+}
+
+func TestManifestVerifyFS(t *testing.T) {
+	files := map[string][]byte{
+		"tailscale_1.2.3_amd64.tgz":        []byte("tarball"),
+		"tailscale_1.2.3_amd64/tailscaled": []byte("binary"),
+	}
+	m, err := ParseManifest(newTestManifest(t, files))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fsys := fstest.MapFS{}
+	for name, data := range files {
+		fsys[name] = &fstest.MapFile{Data: data}
+	}
+	fsys["unrelated"] = &fstest.MapFile{Data: []byte("ignored")}
+	if err := m.VerifyFS(fsys); err != nil {
+		t.Errorf("complete mirror: %v", err)
+	}
+
+	fsys["tailscale_1.2.3_amd64/tailscaled"] = &fstest.MapFile{Data: []byte("binary!")}
+	delete(fsys, "tailscale_1.2.3_amd64.tgz")
+	err = m.VerifyFS(fsys)
+	if err == nil {
+		t.Fatal("VerifyFS succeeded for an incomplete mirror")
+	}
+	for _, want := range []string{"tailscale_1.2.3_amd64.tgz", "tailscale_1.2.3_amd64/tailscaled"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+}
+
+func TestParseManifest(t *testing.T) {
+	const hash = "cf83e1357eefb8bdf1542850d66d8007d620e4050b5715dc83f4a921d36ce9ce47d0d13c5d85f2b0ff8318d2877eec2f63b931bd47417a81a538327af927da3e"
+	tests := []struct {
+		desc    string
+		raw     string
+		wantErr bool
+	}{
+		{
+			desc: "valid",
+			raw:  `{"version":"1.2.3","artifacts":[{"name":"a/b","size":1,"sha512":"` + hash + `","minClientVersion":"1.0.0"}]}`,
+		},
+		{
+			desc:    "no artifacts",
+			raw:     `{"version":"1.2.3","artifacts":[]}`,
+			wantErr: true,
+		},
+		{
+			desc:    "unknown field",
+			raw:     `{"version":"1.2.3","artifacts":[{"name":"a","size":1,"sha512":"` + hash + `","sha256":""}]}`,
+			wantErr: true,
+		},
+		{
+			desc:    "path traversal",
+			raw:     `{"version":"1.2.3","artifacts":[{"name":"../a","size":1,"sha512":"` + hash + `"}]}`,
+			wantErr: true,
+		},
+		{
+			desc:    "duplicate",
+			raw:     `{"version":"1.2.3","artifacts":[{"name":"a","size":1,"sha512":"` + hash + `"},{"name":"a","size":1,"sha512":"` + hash + `"}]}`,
+			wantErr: true,
+		},
+		{
+			desc:    "short hash",
+			raw:     `{"version":"1.2.3","artifacts":[{"name":"a","size":1,"sha512":"cf83"}]}`,
+			wantErr: true,
+		},
+		{
+			desc:    "zero size",
+			raw:     `{"version":"1.2.3","artifacts":[{"name":"a","size":0,"sha512":"` + hash + `"}]}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			m, err := ParseManifest([]byte(tt.raw))
+			if err != nil {
+				if tt.wantErr {
+					return
+				}
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantErr {
+				t.Fatal("expected non-nil error")
+			}
+			a := m.Artifacts[0]
+			if a.SupportsClientVersion("0.9.9") || !a.SupportsClientVersion("1.0.0") || !a.SupportsClientVersion("1.50.1") {
+				t.Errorf("SupportsClientVersion disagrees with MinClientVersion %q", a.MinClientVersion)
+			}
+		})
+	}
+}
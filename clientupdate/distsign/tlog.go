@@ -0,0 +1,136 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package distsign
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// tlogSizeLimit is the maximum size of a transparency log root or inclusion
+// proof.
+const tlogSizeLimit = 64 << 10 // 64KB
+
+// tlogRootSigPrefix is prepended to transparency log roots before they're
+// signed, so that a root signature can never be mistaken for a signature of
+// a signing key bundle.
+const tlogRootSigPrefix = "tailscale distsign tlog root v1\n"
+
+// tlogRootPath is the path of the transparency log root on the distribution
+// server. Its signature is at tlogRootPath+".sig".
+const tlogRootPath = "tlog.root"
+
+// TLogRoot is the root of the append-only transparency log of all files
+// published on the distribution server. The log is a Merkle tree in the
+// format used by the Go checksum database, with one record per file, as
+// returned by TLogRecord.
+//
+// By checking that a file is included in a log whose root is signed by a
+// root key, clients know that the file was published to everyone: a
+// malicious release served only to some clients would need to be logged,
+// where it can be found by anyone monitoring the log.
+//
+// The root is served as JSON at tlog.root, next to a tlog.root.sig
+// signature made with RootKey.SignTLogRoot. The inclusion proof of $file in
+// the log of that size is served as JSON at $file.tlog.
+type TLogRoot struct {
+	// Size is the number of records in the log.
+	Size int64 `json:"size"`
+
+	// Hash is the hash of the Merkle tree of the log's records.
+	Hash tlog.Hash `json:"hash"`
+}
+
+// TLogProof is a proof that a record is included in the log of the size of
+// the current TLogRoot.
+type TLogProof struct {
+	// Index is the index of the record in the log.
+	Index int64 `json:"index"`
+
+	// Proof is the list of hashes that prove the inclusion of the record at
+	// Index in the log, as returned by tlog.ProveRecord.
+	Proof tlog.RecordProof `json:"proof"`
+}
+
+// TLogRecord returns the transparency log record of the file at path name on
+// the distribution server, with the hash and length as computed by
+// PackageHash.
+func TLogRecord(name string, hash []byte, len int64) []byte {
+	return []byte(fmt.Sprintf("%s\n%x %d\n", name, hash, len))
+}
+
+// ParseTLogRoot parses a JSON-encoded transparency log root.
+func ParseTLogRoot(raw []byte) (*TLogRoot, error) {
+	var r TLogRoot
+	if err := json.Unmarshal(raw, &r); err != nil {
+		return nil, fmt.Errorf("invalid transparency log root: %w", err)
+	}
+	if r.Size <= 0 {
+		return nil, fmt.Errorf("invalid transparency log root: size must be positive, got %d", r.Size)
+	}
+	return &r, nil
+}
+
+// SignTLogRoot signs the JSON-encoded transparency log root raw.
+func (r *RootKey) SignTLogRoot(raw []byte) ([]byte, error) {
+	if _, err := ParseTLogRoot(raw); err != nil {
+		return nil, err
+	}
+	return ed25519.Sign(r.k, tlogRootSigMessage(raw)), nil
+}
+
+func tlogRootSigMessage(raw []byte) []byte {
+	return append([]byte(tlogRootSigPrefix), raw...)
+}
+
+// tlogRoot fetches the current transparency log root from the server and
+// validates it against the roots.
+func (c *Client) tlogRoot() (*TLogRoot, error) {
+	rootURL := c.url(tlogRootPath)
+	sigURL := rootURL + ".sig"
+	raw, err := fetch(rootURL, tlogSizeLimit)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := fetch(sigURL, signatureSizeLimit)
+	if err != nil {
+		return nil, err
+	}
+	if !VerifyAny(c.roots, tlogRootSigMessage(raw), sig) {
+		return nil, fmt.Errorf("signature %q for transparency log root %q does not validate with any known root key; either you are under attack, or running a very old version of Tailscale with outdated root keys", sigURL, rootURL)
+	}
+	return ParseTLogRoot(raw)
+}
+
+// verifyTLog checks that the file at srcPath, with the hash and length as
+// computed by PackageHash, is included in the current transparency log.
+func (c *Client) verifyTLog(srcPath string, hash []byte, len int64) error {
+	root, err := c.tlogRoot()
+	if err != nil {
+		return err
+	}
+	proofURL := c.url(srcPath) + ".tlog"
+	c.logf("Downloading %q", proofURL)
+	raw, err := fetch(proofURL, tlogSizeLimit)
+	if err != nil {
+		return err
+	}
+	var p TLogProof
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return fmt.Errorf("invalid transparency log proof %q: %w", proofURL, err)
+	}
+	if p.Index < 0 {
+		return errors.New("invalid transparency log proof: negative index")
+	}
+	rh := tlog.RecordHash(TLogRecord(srcPath, hash, len))
+	if err := tlog.CheckRecord(p.Proof, root.Size, root.Hash, p.Index, rh); err != nil {
+		return fmt.Errorf("file %q is not included in the transparency log of size %d; either you are under attack, or the file was published after the log root: %w", srcPath, root.Size, err)
+	}
+	c.logf("Transparency log inclusion OK")
+	return nil
+}
@@ -0,0 +1,213 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package distsign
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/blake2s"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+func TestDownloadTLog(t *testing.T) {
+	srv := newTestServer(t)
+	c := srv.client(t)
+	c.TLog = true
+
+	tests := []struct {
+		desc    string
+		before  func(*testing.T)
+		wantErr bool
+	}{
+		{
+			desc: "success",
+			before: func(*testing.T) {
+				l := new(testTLog)
+				l.add("other", []byte("stuff"))
+				l.add("hello", []byte("world"))
+				l.add("more", []byte("stuff"))
+				srv.publishTLog(t, l, srv.roots[1])
+			},
+		},
+		{
+			desc: "not logged",
+			before: func(*testing.T) {
+				l := new(testTLog)
+				l.add("other", []byte("stuff"))
+				srv.publishTLog(t, l, srv.roots[0])
+				srv.add("hello.tlog", srv.files["other.tlog"])
+			},
+			wantErr: true,
+		},
+		{
+			desc: "different file logged",
+			before: func(*testing.T) {
+				// A release served only to some clients can't reuse the
+				// proof of the release logged for everyone.
+				l := new(testTLog)
+				l.add("hello", []byte("earth"))
+				srv.publishTLog(t, l, srv.roots[0])
+			},
+			wantErr: true,
+		},
+		{
+			desc: "logged after root",
+			before: func(*testing.T) {
+				l := new(testTLog)
+				l.add("other", []byte("stuff"))
+				srv.publishTLog(t, l, srv.roots[0])
+				l.add("hello", []byte("world"))
+				srv.add("hello.tlog", l.proof(t, "hello"))
+			},
+			wantErr: true,
+		},
+		{
+			desc: "no proof",
+			before: func(*testing.T) {
+				l := new(testTLog)
+				l.add("hello", []byte("world"))
+				srv.publishTLog(t, l, srv.roots[0])
+				delete(srv.files, "hello.tlog")
+			},
+			wantErr: true,
+		},
+		{
+			desc: "root signed with signing key",
+			before: func(*testing.T) {
+				l := new(testTLog)
+				l.add("hello", []byte("world"))
+				srv.publishTLog(t, l, srv.roots[0])
+				srv.add("tlog.root.sig", srv.sign[0].sign(srv.files["tlog.root"]))
+			},
+			wantErr: true,
+		},
+		{
+			desc: "root signed with untrusted key",
+			before: func(t *testing.T) {
+				l := new(testTLog)
+				l.add("hello", []byte("world"))
+				srv.publishTLog(t, l, newRootKeyPair(t))
+			},
+			wantErr: true,
+		},
+		{
+			desc:    "no log",
+			before:  func(*testing.T) {},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			srv.reset()
+			srv.addSigned("hello", []byte("world"))
+			tt.before(t)
+
+			dst := filepath.Join(t.TempDir(), "hello")
+			err := c.Download(context.Background(), "hello", dst)
+			if err != nil {
+				if tt.wantErr {
+					if _, err := os.Stat(dst); err == nil {
+						t.Errorf("Download failed but left %q behind", dst)
+					}
+					return
+				}
+				t.Fatalf("unexpected error from Download: %v", err)
+			}
+			if tt.wantErr {
+				t.Fatal("Download succeeded, expected an error")
+			}
+
+			if err := c.ValidateLocalBinary("hello", dst); err != nil {
+				t.Errorf("ValidateLocalBinary: %v", err)
+			}
+		})
+	}
+}
+
+func TestSignTLogRoot(t *testing.T) {
+	root := newRootKeyPair(t)
+	for _, raw := range []string{"", "{}", `{"size":-1}`, `{"size":1,"hash":"potato"}`} {
+		if _, err := root.SignTLogRoot([]byte(raw)); err == nil {
+			t.Errorf("SignTLogRoot(%q) succeeded, expected an error", raw)
+		}
+	}
+}
+
+// testTLog is an in-memory transparency log.
+type testTLog struct {
+	hashes  []tlog.Hash // stored hashes, see tlog.StoredHashes
+	records map[string]int64
+	n       int64
+}
+
+func (l *testTLog) ReadHashes(indexes []int64) ([]tlog.Hash, error) {
+	ret := make([]tlog.Hash, len(indexes))
+	for i, idx := range indexes {
+		if idx < 0 || idx >= int64(len(l.hashes)) {
+			return nil, fmt.Errorf("hash %d not stored", idx)
+		}
+		ret[i] = l.hashes[idx]
+	}
+	return ret, nil
+}
+
+func (l *testTLog) add(name string, data []byte) {
+	hash := blake2s.Sum256(data)
+	hashes, err := tlog.StoredHashes(l.n, TLogRecord(name, hash[:], int64(len(data))), l)
+	if err != nil {
+		panic(err)
+	}
+	l.hashes = append(l.hashes, hashes...)
+	if l.records == nil {
+		l.records = make(map[string]int64)
+	}
+	l.records[name] = l.n
+	l.n++
+}
+
+// proof returns the JSON-encoded proof of the inclusion of name in the log
+// of its current size.
+func (l *testTLog) proof(t *testing.T, name string) []byte {
+	idx, ok := l.records[name]
+	if !ok {
+		t.Fatalf("%q is not in the log", name)
+	}
+	p, err := tlog.ProveRecord(l.n, idx, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := json.Marshal(TLogProof{Index: idx, Proof: p})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+// publishTLog serves the root of l signed by root, and the proofs of all its
+// records.
+func (s *testServer) publishTLog(t *testing.T, l *testTLog, root rootKeyPair) {
+	th, err := tlog.TreeHash(l.n, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := json.Marshal(TLogRoot{Size: l.n, Hash: th})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := root.SignTLogRoot(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.add("tlog.root", raw)
+	s.add("tlog.root.sig", sig)
+	for name := range l.records {
+		s.add(name+".tlog", l.proof(t, name))
+	}
+}
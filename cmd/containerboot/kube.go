@@ -13,6 +13,8 @@
 	"net/http"
 	"net/netip"
 	"os"
+	"strconv"
+	"time"
 
 	"tailscale.com/kube"
 	"tailscale.com/tailcfg"
@@ -88,6 +90,42 @@ func deleteAuthKey(ctx context.Context, secretName string) error {
 	return nil
 }
 
+// proxyReadyCondition is the type of the pod condition, and the key of the
+// pod annotation, that containerboot sets when TS_KUBE_READINESS_GATE is set.
+// Pods that list it in their readinessGates are only added to the endpoints of
+// their Services once the proxy is ready to forward traffic.
+const proxyReadyCondition = "tailscale.com/proxy-ready"
+
+// setPodReadiness sets the proxyReadyCondition condition and annotation of
+// the pod podName to ready.
+func setPodReadiness(ctx context.Context, podName string, ready bool) error {
+	cond := kube.PodCondition{
+		Type:               proxyReadyCondition,
+		Status:             "False",
+		LastTransitionTime: time.Now().UTC(),
+		Reason:             "ProxyStarting",
+	}
+	if ready {
+		cond.Status = "True"
+		cond.Reason = "ProxyReady"
+	}
+	p := &kube.Pod{
+		Status: kube.PodStatus{Conditions: []kube.PodCondition{cond}},
+	}
+	if err := kc.StrategicMergePatchPodStatus(ctx, podName, p, "tailscale-container"); err != nil {
+		return fmt.Errorf("setting pod condition: %w", err)
+	}
+	p = &kube.Pod{
+		ObjectMeta: kube.ObjectMeta{
+			Annotations: map[string]string{proxyReadyCondition: strconv.FormatBool(ready)},
+		},
+	}
+	if err := kc.StrategicMergePatchPod(ctx, podName, p, "tailscale-container"); err != nil {
+		return fmt.Errorf("setting pod annotation: %w", err)
+	}
+	return nil
+}
+
 var kc *kube.Client
 
 func initKube(root string) {
@@ -0,0 +1,107 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"time"
+
+	"tailscale.com/client/tailscale"
+	"tailscale.com/client/tailscale/apitype"
+	"tailscale.com/ipn/ipnstate"
+)
+
+// tailnetLocalAPI serves a read-only subset of tailscaled's LocalAPI to
+// tailnet peers carrying one of a set of tags, such as the Kubernetes
+// operator that manages this proxy. Only the status of this node, without
+// its peers, is served.
+type tailnetLocalAPI struct {
+	// tags are the ACL tags of which a peer needs at least one.
+	tags []string
+
+	whoIs  func(ctx context.Context, remoteAddr string) (*apitype.WhoIsResponse, error)
+	status func(ctx context.Context) (*ipnstate.Status, error)
+}
+
+func (h *tailnetLocalAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	who, err := h.whoIs(r.Context(), r.RemoteAddr)
+	if err != nil || who.Node == nil || !h.allowed(who.Node.Tags) {
+		http.Error(w, "access denied", http.StatusForbidden)
+		return
+	}
+	if r.URL.Path != "/localapi/v0/status" {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if r.Method != "GET" {
+		http.Error(w, "want GET", http.StatusMethodNotAllowed)
+		return
+	}
+	st, err := h.status(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(st)
+}
+
+func (h *tailnetLocalAPI) allowed(nodeTags []string) bool {
+	for _, t := range nodeTags {
+		for _, want := range h.tags {
+			if t == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// serveTailnetLocalAPI serves the tailnetLocalAPI subset of lc's LocalAPI on
+// port of each of the node's Tailscale addrs, until ctx is done. tailscaled
+// may not have configured the addresses on the tun device yet, so listening
+// is retried until it succeeds.
+func serveTailnetLocalAPI(ctx context.Context, lc *tailscale.LocalClient, addrs []netip.Prefix, port uint16, tags []string) {
+	srv := &http.Server{
+		Handler: &tailnetLocalAPI{
+			tags:   tags,
+			whoIs:  lc.WhoIs,
+			status: lc.StatusWithoutPeers,
+		},
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	for _, pfx := range addrs {
+		addr := net.JoinHostPort(pfx.Addr().String(), strconv.Itoa(int(port)))
+		go func() {
+			for {
+				ln, err := net.Listen("tcp", addr)
+				if err == nil {
+					log.Printf("Serving LocalAPI status to %v on %v", tags, addr)
+					if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+						log.Printf("serving LocalAPI on %v: %v", addr, err)
+					}
+					return
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(time.Second):
+				}
+			}
+		}()
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"tailscale.com/client/tailscale/apitype"
+	"tailscale.com/ipn/ipnstate"
+	"tailscale.com/tailcfg"
+)
+
+func TestTailnetLocalAPI(t *testing.T) {
+	peers := map[string]*apitype.WhoIsResponse{
+		"100.64.0.1:1234": {Node: &tailcfg.Node{Tags: []string{"tag:k8s-operator"}}},
+		"100.64.0.2:1234": {Node: &tailcfg.Node{Tags: []string{"tag:other"}}},
+		"100.64.0.3:1234": {Node: &tailcfg.Node{}},
+	}
+	h := &tailnetLocalAPI{
+		tags: []string{"tag:k8s-operator"},
+		whoIs: func(ctx context.Context, remoteAddr string) (*apitype.WhoIsResponse, error) {
+			if who, ok := peers[remoteAddr]; ok {
+				return who, nil
+			}
+			return nil, errors.New("no match for IP:port")
+		},
+		status: func(ctx context.Context) (*ipnstate.Status, error) {
+			return &ipnstate.Status{BackendState: "Running"}, nil
+		},
+	}
+	tests := []struct {
+		name       string
+		remoteAddr string
+		method     string
+		path       string
+		wantCode   int
+	}{
+		{"tagged", "100.64.0.1:1234", "GET", "/localapi/v0/status?peers=false", http.StatusOK},
+		{"other_tag", "100.64.0.2:1234", "GET", "/localapi/v0/status", http.StatusForbidden},
+		{"untagged", "100.64.0.3:1234", "GET", "/localapi/v0/status", http.StatusForbidden},
+		{"not_a_peer", "10.0.0.1:1234", "GET", "/localapi/v0/status", http.StatusForbidden},
+		{"other_endpoint", "100.64.0.1:1234", "GET", "/localapi/v0/prefs", http.StatusNotFound},
+		{"post", "100.64.0.1:1234", "POST", "/localapi/v0/status", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "http://local-tailscaled.sock"+tt.path, nil)
+			req.RemoteAddr = tt.remoteAddr
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("code = %d; want %d; body: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			var st ipnstate.Status
+			if err := json.Unmarshal(rec.Body.Bytes(), &st); err != nil {
+				t.Fatal(err)
+			}
+			if st.BackendState != "Running" {
+				t.Errorf("BackendState = %q; want Running", st.BackendState)
+			}
+		})
+	}
+}
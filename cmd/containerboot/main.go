@@ -14,10 +14,18 @@
 //   - TS_AUTHKEY: the authkey to use for login.
 //   - TS_HOSTNAME: the hostname to request for the node.
 //   - TS_ROUTES: subnet routes to advertise.
+//   - TS_ROUTES_FILE: instead of TS_ROUTES, the path of a file with the
+//     comma-separated subnet routes to advertise, such as a key of a mounted
+//     Secret that the Kubernetes operator keeps up to date. The file is
+//     watched for changes, which are applied without a restart.
 //   - TS_DEST_IP: proxy all incoming Tailscale traffic to the given
 //     destination.
 //   - TS_TAILNET_TARGET_IP: proxy all incoming non-Tailscale traffic to the given
 //     destination.
+//   - TS_CLAMP_MSS: if true, clamp the MSS of TCP connections forwarded
+//     through the node to the path MTU. It fixes connections to advertised
+//     TS_ROUTES that hang when the host's uplink has a small MTU, such as
+//     with PPPoE. It's read by tailscaled, and requires kernel networking.
 //   - TS_TAILSCALED_EXTRA_ARGS: extra arguments to 'tailscaled'.
 //   - TS_EXTRA_ARGS: extra arguments to 'tailscale login', these are not
 //     reset on restart.
@@ -29,6 +37,20 @@
 //   - TS_ACCEPT_DNS: whether to use the tailnet's DNS configuration.
 //   - TS_KUBE_SECRET: the name of the Kubernetes secret in which to
 //     store tailscaled state.
+//   - TS_KUBE_READINESS_GATE: if true, set the "tailscale.com/proxy-ready"
+//     condition and annotation of the pod to false on startup, and to true
+//     once the node is connected and any proxy rules are installed. Listing
+//     the condition in the pod's readinessGates keeps Services from routing
+//     to the pod before it can forward traffic, such as during rollouts.
+//     It requires the patch permission on the pod and its pods/status.
+//   - TS_KUBE_READINESS_WAIT_FOR_ROUTES: if true, with TS_KUBE_READINESS_GATE,
+//     only mark the pod ready once all TS_ROUTES are approved in the admin
+//     panel, and mark it not ready again if any are unapproved, so that
+//     clients of a subnet router don't route to it while its traffic would
+//     be dropped.
+//   - TS_KUBE_POD_NAME: the name of the pod, for TS_KUBE_READINESS_GATE,
+//     typically set from metadata.name with the downward API. Defaults to
+//     the hostname, which is the pod name unless spec.hostname is set.
 //   - TS_SOCKS5_SERVER: the address on which to listen for SOCKS5
 //     proxying into the tailnet.
 //   - TS_OUTBOUND_HTTP_PROXY_LISTEN: the address on which to listen
@@ -44,6 +66,37 @@
 //     ${TS_CERT_DOMAIN}, it will be replaced with the value of the available FQDN.
 //     It cannot be used in conjunction with TS_DEST_IP. The file is watched for changes,
 //     and will be re-applied when it changes.
+//   - TS_CERT_FETCH: if true, get a TLS cert for the node's MagicDNS name once
+//     it's known, and get it again periodically so that tailscaled renews it
+//     before it expires. With TS_KUBE_SECRET, tailscaled stores the cert and
+//     its key in the secret as "<domain>.crt" and "<domain>.key".
+//   - TS_MODE: if "sidecar-routes", don't run tailscaled. Instead, route the
+//     tailnet's IP ranges and any TS_ROUTES out of the container's network
+//     namespace via a tailscale router pod, for running next to an app in
+//     clusters that only allow one privileged tailscale pod per node. It only
+//     needs the NET_ADMIN capability. The routes are onlink, so the router
+//     must be on the same layer 2 network, such as on the same node with a
+//     bridge CNI.
+//   - TS_ROUTER_ADDR: with TS_MODE=sidecar-routes, the IP address of the
+//     router pod.
+//   - TS_ROUTER_SERVICE: with TS_MODE=sidecar-routes, instead of
+//     TS_ROUTER_ADDR, the name of a headless Service in the pod's namespace
+//     whose ready pods are routers. The Service's Endpoints are looked up
+//     periodically with the Kubernetes API, so the pod's service account
+//     needs to be able to get Services and Endpoints.
+//   - TS_KUBE_NODE_NAME: with TS_ROUTER_SERVICE, the name of the pod's node,
+//     set from spec.nodeName with the downward API. If set, only router pods
+//     on that node are used.
+//   - TS_SIDECAR_SOURCES: comma-separated CIDRs of pods that route via this
+//     container with TS_MODE=sidecar-routes, such as the node's pod CIDR.
+//     Their traffic to the tailnet is masqueraded as coming from this node's
+//     Tailscale IP. Requires TS_USERSPACE=false.
+//   - TS_TAILNET_LOCALAPI_PORT: if set, serve the node's LocalAPI status on
+//     this port of its Tailscale IPs to tailnet peers with one of the
+//     TS_TAILNET_LOCALAPI_TAGS, such as the Kubernetes operator managing the
+//     proxy. Requires TS_USERSPACE=false.
+//   - TS_TAILNET_LOCALAPI_TAGS: comma-separated ACL tags of the peers that
+//     TS_TAILNET_LOCALAPI_PORT serves.
 //
 // When running on Kubernetes, containerboot defaults to storing state in the
 // "tailscale" kube secret. To store state on local disk instead, set
@@ -68,11 +121,13 @@
 	"os/signal"
 	"path/filepath"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
 	"sync/atomic"
 	"syscall"
 	"time"
+	"unicode"
 
 	"github.com/fsnotify/fsnotify"
 	"golang.org/x/sys/unix"
@@ -90,7 +145,17 @@ func main() {
 		AuthKey:         defaultEnvs([]string{"TS_AUTHKEY", "TS_AUTH_KEY"}, ""),
 		Hostname:        defaultEnv("TS_HOSTNAME", ""),
 		Routes:          defaultEnv("TS_ROUTES", ""),
+		RoutesFile:      defaultEnv("TS_ROUTES_FILE", ""),
+		ClampMSS:        defaultBool("TS_CLAMP_MSS", false),
 		ServeConfigPath: defaultEnv("TS_SERVE_CONFIG", ""),
+		CertFetch:       defaultBool("TS_CERT_FETCH", false),
+		Mode:            defaultEnv("TS_MODE", ""),
+		RouterAddr:      defaultEnv("TS_ROUTER_ADDR", ""),
+		RouterService:   defaultEnv("TS_ROUTER_SERVICE", ""),
+		KubeNodeName:    defaultEnv("TS_KUBE_NODE_NAME", ""),
+		SidecarSources:  defaultEnv("TS_SIDECAR_SOURCES", ""),
+		LocalAPIPort:    defaultEnv("TS_TAILNET_LOCALAPI_PORT", ""),
+		LocalAPITags:    defaultEnv("TS_TAILNET_LOCALAPI_TAGS", ""),
 		ProxyTo:         defaultEnv("TS_DEST_IP", ""),
 		TailnetTargetIP: defaultEnv("TS_TAILNET_TARGET_IP", ""),
 		DaemonExtraArgs: defaultEnv("TS_TAILSCALED_EXTRA_ARGS", ""),
@@ -100,27 +165,87 @@ func main() {
 		StateDir:        defaultEnv("TS_STATE_DIR", ""),
 		AcceptDNS:       defaultBool("TS_ACCEPT_DNS", false),
 		KubeSecret:      defaultEnv("TS_KUBE_SECRET", "tailscale"),
+		KubeReadiness:   defaultBool("TS_KUBE_READINESS_GATE", false),
+		KubePodName:     defaultEnv("TS_KUBE_POD_NAME", ""),
 		SOCKSProxyAddr:  defaultEnv("TS_SOCKS5_SERVER", ""),
 		HTTPProxyAddr:   defaultEnv("TS_OUTBOUND_HTTP_PROXY_LISTEN", ""),
 		Socket:          defaultEnv("TS_SOCKET", "/tmp/tailscaled.sock"),
 		AuthOnce:        defaultBool("TS_AUTH_ONCE", false),
 		Root:            defaultEnv("TS_TEST_ONLY_ROOT", "/"),
+
+		KubeReadinessRoutes: defaultBool("TS_KUBE_READINESS_WAIT_FOR_ROUTES", false),
+	}
+
+	switch cfg.Mode {
+	case "":
+	case modeSidecarRoutes:
+		runSidecarRoutes(cfg)
+		return
+	default:
+		log.Fatalf("unknown TS_MODE %q", cfg.Mode)
 	}
 
 	if cfg.ProxyTo != "" && cfg.UserspaceMode {
 		log.Fatal("TS_DEST_IP is not supported with TS_USERSPACE")
 	}
 
+	if cfg.Routes != "" && cfg.RoutesFile != "" {
+		log.Fatal("TS_ROUTES and TS_ROUTES_FILE are mutually exclusive")
+	}
+
 	if cfg.TailnetTargetIP != "" && cfg.UserspaceMode {
 		log.Fatal("TS_TAILNET_TARGET_IP is not supported with TS_USERSPACE")
 	}
 
+	if cfg.ClampMSS && cfg.UserspaceMode {
+		log.Fatal("TS_CLAMP_MSS is not supported with TS_USERSPACE")
+	}
+
+	var sidecarSources []netip.Prefix
+	for _, s := range strings.Split(cfg.SidecarSources, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			log.Fatalf("invalid TS_SIDECAR_SOURCES entry %q: %v", s, err)
+		}
+		sidecarSources = append(sidecarSources, p.Masked())
+	}
+	if len(sidecarSources) > 0 && cfg.UserspaceMode {
+		log.Fatal("TS_SIDECAR_SOURCES is not supported with TS_USERSPACE")
+	}
+
+	var localAPIPort uint16
+	if cfg.LocalAPIPort != "" {
+		if cfg.UserspaceMode {
+			log.Fatal("TS_TAILNET_LOCALAPI_PORT is not supported with TS_USERSPACE")
+		}
+		p, err := strconv.ParseUint(cfg.LocalAPIPort, 10, 16)
+		if err != nil || p == 0 {
+			log.Fatalf("invalid TS_TAILNET_LOCALAPI_PORT %q", cfg.LocalAPIPort)
+		}
+		if cfg.LocalAPITags == "" {
+			log.Fatal("TS_TAILNET_LOCALAPI_PORT requires TS_TAILNET_LOCALAPI_TAGS")
+		}
+		localAPIPort = uint16(p)
+	}
+
 	if !cfg.UserspaceMode {
 		if err := ensureTunFile(cfg.Root); err != nil {
 			log.Fatalf("Unable to create tuntap device file: %v", err)
 		}
-		if cfg.ProxyTo != "" || cfg.Routes != "" || cfg.TailnetTargetIP != "" {
-			if err := ensureIPForwarding(cfg.Root, cfg.ProxyTo, cfg.TailnetTargetIP, cfg.Routes); err != nil {
+		if cfg.ProxyTo != "" || cfg.Routes != "" || cfg.RoutesFile != "" || cfg.TailnetTargetIP != "" || len(sidecarSources) > 0 {
+			fwdRoutes := cfg.Routes
+			if cfg.RoutesFile != "" {
+				// The routes in the file can change to either address
+				// family at any time.
+				fwdRoutes = "0.0.0.0/0,::/0"
+			}
+			for _, p := range sidecarSources {
+				fwdRoutes = strings.TrimPrefix(fwdRoutes+","+p.String(), ",")
+			}
+			if err := ensureIPForwarding(cfg.Root, cfg.ProxyTo, cfg.TailnetTargetIP, fwdRoutes); err != nil {
 				log.Printf("Failed to enable IP forwarding: %v", err)
 				log.Printf("To run tailscale as a proxy or router container, IP forwarding must be enabled.")
 				if cfg.InKubernetes {
@@ -132,9 +257,30 @@ func main() {
 		}
 	}
 
+	if len(sidecarSources) > 0 {
+		if err := installSidecarMasquerade(context.Background(), sidecarSources); err != nil {
+			log.Fatalf("installing sidecar masquerade rules: %v", err)
+		}
+	}
+
 	if cfg.InKubernetes {
 		initKube(cfg.Root)
 	}
+	if cfg.KubeReadinessRoutes && (!cfg.KubeReadiness || cfg.Routes == "") {
+		log.Fatal("TS_KUBE_READINESS_WAIT_FOR_ROUTES requires TS_KUBE_READINESS_GATE and TS_ROUTES")
+	}
+	if cfg.KubeReadiness {
+		if !cfg.InKubernetes {
+			log.Fatal("TS_KUBE_READINESS_GATE is only supported on Kubernetes")
+		}
+		if cfg.KubePodName == "" {
+			name, err := os.Hostname()
+			if err != nil {
+				log.Fatalf("TS_KUBE_POD_NAME not set and getting hostname failed: %v", err)
+			}
+			cfg.KubePodName = name
+		}
+	}
 
 	// Context is used for all setup stuff until we're in steady
 	// state, so that if something is hanging we eventually time out
@@ -142,6 +288,14 @@ func main() {
 	bootCtx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
 	defer cancel()
 
+	if cfg.KubeReadiness {
+		// The pod's conditions outlive container restarts, so reset the
+		// readiness left behind by a previous run before anything else.
+		if err := setPodReadiness(bootCtx, cfg.KubePodName, false); err != nil {
+			log.Fatalf("Resetting pod readiness: %v", err)
+		}
+	}
+
 	if cfg.InKubernetes && cfg.KubeSecret != "" {
 		canPatch, err := kc.CheckSecretPermissions(bootCtx, cfg.KubeSecret)
 		if err != nil {
@@ -280,12 +434,23 @@ func main() {
 		currentIPs        deephash.Sum // tailscale IPs assigned to device
 		currentDeviceInfo deephash.Sum // device ID and fqdn
 
+		podReady       = false // last readiness set with TS_KUBE_READINESS_GATE
+		routesApproved = !cfg.KubeReadinessRoutes
+		lastUnapproved string // unapproved routes last logged
+
 		certDomain        = new(atomic.Pointer[string])
 		certDomainChanged = make(chan bool, 1)
+		certFetchDomain   string // domain that fetchCerts is running for
+		cancelCertFetch   context.CancelFunc
+
+		localAPIServing = false // whether serveTailnetLocalAPI is running
 	)
 	if cfg.ServeConfigPath != "" {
 		go watchServeConfigChanges(ctx, cfg.ServeConfigPath, certDomainChanged, certDomain, client)
 	}
+	if cfg.RoutesFile != "" {
+		go watchRoutesFile(ctx, cfg.RoutesFile, client)
+	}
 	for {
 		n, err := w.Next()
 		if err != nil {
@@ -298,6 +463,13 @@ func main() {
 			// control flow required to make it work now is hard. So, just crash
 			// the container and rely on the container runtime to restart us,
 			// whereupon we'll go through initial auth again.
+			if podReady {
+				// Don't leave Services routing to the pod until
+				// the restart resets its readiness.
+				if err := setPodReadiness(ctx, cfg.KubePodName, false); err != nil {
+					log.Printf("Marking pod not ready: %v", err)
+				}
+			}
 			log.Fatalf("tailscaled left running state (now in state %q), exiting", *n.State)
 		}
 		if n.NetMap != nil {
@@ -320,13 +492,41 @@ func main() {
 					}
 				}
 			}
+			if cfg.CertFetch && len(n.NetMap.DNS.CertDomains) > 0 {
+				if cd := n.NetMap.DNS.CertDomains[0]; cd != certFetchDomain {
+					if cancelCertFetch != nil {
+						cancelCertFetch()
+					}
+					var certCtx context.Context
+					certCtx, cancelCertFetch = context.WithCancel(ctx)
+					go fetchCerts(certCtx, client, cd)
+					certFetchDomain = cd
+				}
+			}
 			if cfg.TailnetTargetIP != "" && ipsHaveChanged && len(addrs) > 0 {
 				if err := installEgressForwardingRule(ctx, cfg.TailnetTargetIP, addrs); err != nil {
 					log.Fatalf("installing egress proxy rules: %v", err)
 				}
 			}
+			if localAPIPort != 0 && !localAPIServing && len(addrs) > 0 {
+				go serveTailnetLocalAPI(ctx, client, addrs, localAPIPort, strings.Split(cfg.LocalAPITags, ","))
+				localAPIServing = true
+			}
 			currentIPs = newCurrentIPs
 
+			if cfg.KubeReadinessRoutes {
+				unapproved := unapprovedRoutes(cfg.Routes, n.NetMap.SelfNode.AllowedIPs().AsSlice())
+				if s := fmt.Sprint(unapproved); s != lastUnapproved {
+					if len(unapproved) == 0 {
+						log.Printf("All advertised routes are approved")
+					} else {
+						log.Printf("Waiting for advertised routes %v to be approved", unapproved)
+					}
+					lastUnapproved = s
+				}
+				routesApproved = len(unapproved) == 0
+			}
+
 			deviceInfo := []any{n.NetMap.SelfNode.StableID(), n.NetMap.SelfNode.Name()}
 			if cfg.InKubernetes && cfg.KubernetesCanPatch && cfg.KubeSecret != "" && deephash.Update(&currentDeviceInfo, &deviceInfo) {
 				if err := storeDeviceInfo(ctx, cfg.KubeSecret, n.NetMap.SelfNode.StableID(), n.NetMap.SelfNode.Name(), n.NetMap.SelfNode.Addresses().AsSlice()); err != nil {
@@ -363,7 +563,33 @@ func main() {
 				}()
 			}
 		}
+		if cfg.KubeReadiness && startupTasksDone {
+			if ready := routesApproved; ready != podReady {
+				if err := setPodReadiness(ctx, cfg.KubePodName, ready); err != nil {
+					log.Fatalf("Marking pod ready=%v: %v", ready, err)
+				}
+				podReady = ready
+			}
+		}
+	}
+}
+
+// unapprovedRoutes returns the routes of the comma-separated list of
+// advertised routes that aren't among the allowed IPs of the node, as
+// approved by its tailnet's admin.
+func unapprovedRoutes(routes string, allowedIPs []netip.Prefix) []netip.Prefix {
+	var unapproved []netip.Prefix
+	for _, r := range strings.Split(routes, ",") {
+		p, err := netip.ParsePrefix(strings.TrimSpace(r))
+		if err != nil {
+			// tailscale set already rejected it.
+			continue
+		}
+		if !slices.Contains(allowedIPs, p.Masked()) {
+			unapproved = append(unapproved, p)
+		}
 	}
+	return unapproved
 }
 
 // watchServeConfigChanges watches path for changes, and when it sees one, reads
@@ -421,6 +647,105 @@ func watchServeConfigChanges(ctx context.Context, path string, cdChanged <-chan
 	}
 }
 
+// fetchCerts gets the TLS cert for domain from lc, and gets it again every
+// certFetchInterval, which makes tailscaled renew it when it's due, until
+// ctx is canceled.
+func fetchCerts(ctx context.Context, lc *tailscale.LocalClient, domain string) {
+	for {
+		wait := certFetchInterval
+		if _, _, err := lc.CertPair(ctx, domain); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Getting TLS cert for %s: %v", domain, err)
+			wait = time.Minute
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// certFetchInterval is how often fetchCerts gets the TLS cert of the node.
+const certFetchInterval = 12 * time.Hour
+
+// watchRoutesFile advertises the subnet routes in the file at path, and
+// advertises them again whenever they change, until ctx is done.
+func watchRoutesFile(ctx context.Context, path string, lc *tailscale.LocalClient) {
+	var tickChan <-chan time.Time
+	var events <-chan fsnotify.Event
+	w, err := fsnotify.NewWatcher()
+	if err == nil {
+		err = w.Add(filepath.Dir(path))
+	}
+	if err != nil {
+		log.Printf("failed to watch %s, timer-only mode: %v", path, err)
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+		tickChan = ticker.C
+	}
+	if w != nil {
+		defer w.Close()
+		events = w.Events
+	}
+	var prev []netip.Prefix
+	first := true
+	for {
+		routes, err := readRoutesFile(path)
+		if err != nil {
+			log.Printf("reading routes file: %v", err)
+		} else if first || !slices.Equal(routes, prev) {
+			log.Printf("Advertising routes %v", routes)
+			if _, err := lc.EditPrefs(ctx, &ipn.MaskedPrefs{
+				Prefs:              ipn.Prefs{AdvertiseRoutes: routes},
+				AdvertiseRoutesSet: true,
+			}); err != nil {
+				log.Fatalf("failed to advertise routes: %v", err)
+			}
+			prev, first = routes, false
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-tickChan:
+		case <-events:
+			// As with the serve config, Kubernetes updates mounted
+			// Secrets by swapping symlinks, so any event in the
+			// directory means the file may have changed.
+		}
+	}
+}
+
+// readRoutesFile reads the comma- or whitespace-separated subnet routes in
+// the file at path, sorted. A missing file, such as an optional key of a
+// Secret that's not set yet, has no routes.
+func readRoutesFile(path string) ([]netip.Prefix, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var routes []netip.Prefix
+	for _, s := range strings.FieldsFunc(string(b), func(r rune) bool { return r == ',' || unicode.IsSpace(r) }) {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid route %q: %w", s, err)
+		}
+		routes = append(routes, p.Masked())
+	}
+	slices.SortFunc(routes, func(a, b netip.Prefix) int {
+		if c := a.Addr().Compare(b.Addr()); c != 0 {
+			return c
+		}
+		return a.Bits() - b.Bits()
+	})
+	return slices.Compact(routes), nil
+}
+
 // readServeConfig reads the ipn.ServeConfig from path, replacing
 // ${TS_CERT_DOMAIN} with certDomain.
 func readServeConfig(path, certDomain string) (*ipn.ServeConfig, error) {
@@ -752,6 +1077,13 @@ type settings struct {
 	AuthKey  string
 	Hostname string
 	Routes   string
+	// RoutesFile is the path of a file with the routes to advertise,
+	// instead of Routes.
+	RoutesFile string
+	// ClampMSS is whether tailscaled clamps the MSS of forwarded TCP
+	// connections to the path MTU. tailscaled reads it from the
+	// environment itself; it's only validated here.
+	ClampMSS bool
 	// ProxyTo is the destination IP to which all incoming
 	// Tailscale traffic should be proxied. If empty, no proxying
 	// is done. This is typically a locally reachable IP.
@@ -768,12 +1100,42 @@ type settings struct {
 	StateDir           string
 	AcceptDNS          bool
 	KubeSecret         string
+	KubeReadiness      bool
+	KubePodName        string
 	SOCKSProxyAddr     string
 	HTTPProxyAddr      string
 	Socket             string
 	AuthOnce           bool
 	Root               string
 	KubernetesCanPatch bool
+
+	// KubeReadinessRoutes is whether KubeReadiness also waits for all
+	// Routes to be approved.
+	KubeReadinessRoutes bool
+
+	// CertFetch is whether to get and periodically renew a TLS cert for
+	// the node's MagicDNS name.
+	CertFetch bool
+
+	// Mode is the mode of operation: empty to run tailscaled, or
+	// modeSidecarRoutes.
+	Mode string
+	// RouterAddr is the IP address of the router that modeSidecarRoutes
+	// routes the tailnet's traffic via.
+	RouterAddr string
+	// RouterService is the name of the headless Service whose pods are
+	// the routers for modeSidecarRoutes, if RouterAddr is empty.
+	RouterService string
+	// KubeNodeName is the name of the pod's node, to pick a router of
+	// RouterService on it.
+	KubeNodeName string
+	// SidecarSources are the CIDRs of pods in modeSidecarRoutes whose
+	// traffic this container masquerades into the tailnet.
+	SidecarSources string
+	// LocalAPIPort is the port on which to serve the LocalAPI status to
+	// tailnet peers with one of LocalAPITags, or empty not to.
+	LocalAPIPort string
+	LocalAPITags string
 }
 
 // defaultEnv returns the value of the given envvar name, or defVal if
@@ -22,6 +22,7 @@
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -59,6 +60,7 @@ func TestContainerBoot(t *testing.T) {
 		"dev/net",
 		"proc/sys/net/ipv4",
 		"proc/sys/net/ipv6/conf/all",
+		"proc/net",
 	}
 	for _, path := range dirs {
 		if err := os.MkdirAll(filepath.Join(d, path), 0700); err != nil {
@@ -70,6 +72,8 @@ func TestContainerBoot(t *testing.T) {
 		"usr/bin/tailscale":                     fakeTailscale,
 		"usr/bin/iptables":                      fakeTailscale,
 		"usr/bin/ip6tables":                     fakeTailscale,
+		"usr/bin/ip":                            fakeTailscale,
+		"proc/net/route":                        fakeRouteTable,
 		"dev/net/tun":                           []byte(""),
 		"proc/sys/net/ipv4/ip_forward":          []byte("0"),
 		"proc/sys/net/ipv6/conf/all/forwarding": []byte("0"),
@@ -108,6 +112,10 @@ type phase struct {
 		// WantFiles files that should exist in the container and their
 		// contents.
 		WantFiles map[string]string
+		// WantPodReadiness, if non-empty, is the status of the proxy-ready
+		// condition of the pod and the value of its annotation, separated
+		// by a slash.
+		WantPodReadiness string
 	}
 	runningNotify := &ipn.Notify{
 		State: ptr.To(ipn.Running),
@@ -119,6 +127,16 @@ type phase struct {
 			}).View(),
 		},
 	}
+	// routesNotify returns a netmap update in which the node's approved
+	// routes are routes.
+	routesNotify := func(routes ...string) *ipn.Notify {
+		self := runningNotify.NetMap.SelfNode.AsStruct()
+		self.AllowedIPs = append([]netip.Prefix{}, self.Addresses...)
+		for _, r := range routes {
+			self.AllowedIPs = append(self.AllowedIPs, netip.MustParsePrefix(r))
+		}
+		return &ipn.Notify{NetMap: &netmap.NetworkMap{SelfNode: self.View()}}
+	}
 	tests := []struct {
 		Name          string
 		Env           map[string]string
@@ -449,6 +467,86 @@ type phase struct {
 				},
 			},
 		},
+		{
+			Name: "kube_readiness_gate",
+			Env: map[string]string{
+				"KUBERNETES_SERVICE_HOST":       kube.Host,
+				"KUBERNETES_SERVICE_PORT_HTTPS": kube.Port,
+				"TS_KUBE_SECRET":                "",
+				"TS_STATE_DIR":                  filepath.Join(d, "tmp"),
+				"TS_AUTHKEY":                    "tskey-key",
+				"TS_KUBE_READINESS_GATE":        "true",
+				"TS_KUBE_POD_NAME":              "test-pod",
+			},
+			KubeSecret: map[string]string{},
+			Phases: []phase{
+				{
+					WantCmds: []string{
+						"/usr/bin/tailscaled --socket=/tmp/tailscaled.sock --statedir=/tmp --tun=userspace-networking",
+						"/usr/bin/tailscale --socket=/tmp/tailscaled.sock login --authkey=tskey-key",
+					},
+					WantKubeSecret:   map[string]string{},
+					WantPodReadiness: "False/false",
+				},
+				{
+					Notify: runningNotify,
+					WantCmds: []string{
+						"/usr/bin/tailscale --socket=/tmp/tailscaled.sock set --accept-dns=false",
+					},
+					WantKubeSecret:   map[string]string{},
+					WantPodReadiness: "True/true",
+				},
+			},
+		},
+		{
+			Name: "kube_readiness_wait_for_routes",
+			Env: map[string]string{
+				"KUBERNETES_SERVICE_HOST":           kube.Host,
+				"KUBERNETES_SERVICE_PORT_HTTPS":     kube.Port,
+				"TS_KUBE_SECRET":                    "",
+				"TS_STATE_DIR":                      filepath.Join(d, "tmp"),
+				"TS_AUTHKEY":                        "tskey-key",
+				"TS_ROUTES":                         "1.2.3.0/24,10.20.30.0/24",
+				"TS_KUBE_READINESS_GATE":            "true",
+				"TS_KUBE_READINESS_WAIT_FOR_ROUTES": "true",
+				"TS_KUBE_POD_NAME":                  "test-pod",
+			},
+			KubeSecret: map[string]string{},
+			Phases: []phase{
+				{
+					WantCmds: []string{
+						"/usr/bin/tailscaled --socket=/tmp/tailscaled.sock --statedir=/tmp --tun=userspace-networking",
+						"/usr/bin/tailscale --socket=/tmp/tailscaled.sock login --authkey=tskey-key",
+					},
+					WantKubeSecret:   map[string]string{},
+					WantPodReadiness: "False/false",
+				},
+				{
+					Notify: runningNotify,
+					WantCmds: []string{
+						"/usr/bin/tailscale --socket=/tmp/tailscaled.sock set --accept-dns=false --advertise-routes=1.2.3.0/24,10.20.30.0/24",
+					},
+					WantKubeSecret:   map[string]string{},
+					WantPodReadiness: "False/false",
+				},
+				{
+					Notify:           routesNotify("1.2.3.0/24"),
+					WantKubeSecret:   map[string]string{},
+					WantPodReadiness: "False/false",
+				},
+				{
+					Notify:           routesNotify("1.2.3.0/24", "10.20.30.0/24"),
+					WantKubeSecret:   map[string]string{},
+					WantPodReadiness: "True/true",
+				},
+				{
+					// A route is unapproved again.
+					Notify:           routesNotify("10.20.30.0/24"),
+					WantKubeSecret:   map[string]string{},
+					WantPodReadiness: "False/false",
+				},
+			},
+		},
 		{
 			Name: "kube_storage_no_patch",
 			Env: map[string]string{
@@ -632,6 +730,66 @@ type phase struct {
 				},
 			},
 		},
+		{
+			Name: "sidecar_routes",
+			Env: map[string]string{
+				"TS_MODE":        "sidecar-routes",
+				"TS_ROUTER_ADDR": "10.0.0.5",
+				"TS_ROUTES":      "192.168.1.0/24",
+			},
+			Phases: []phase{
+				{
+					WantCmds: []string{
+						"/usr/bin/ip route replace 100.64.0.0/10 via 10.0.0.5 dev eth0 onlink",
+						"/usr/bin/ip route replace 192.168.1.0/24 via 10.0.0.5 dev eth0 onlink",
+					},
+				},
+			},
+		},
+		{
+			Name: "sidecar_routes_service",
+			Env: map[string]string{
+				"KUBERNETES_SERVICE_HOST":       kube.Host,
+				"KUBERNETES_SERVICE_PORT_HTTPS": kube.Port,
+				"TS_MODE":                       "sidecar-routes",
+				"TS_ROUTER_SERVICE":             "tailscale-router",
+				"TS_KUBE_NODE_NAME":             "node-b",
+			},
+			Phases: []phase{
+				{
+					WantCmds: []string{
+						"/usr/bin/ip route replace 100.64.0.0/10 via 10.244.2.7 dev eth0 onlink",
+					},
+				},
+			},
+		},
+		{
+			Name: "sidecar_sources",
+			Env: map[string]string{
+				"TS_AUTHKEY":         "tskey-key",
+				"TS_USERSPACE":       "false",
+				"TS_SIDECAR_SOURCES": "10.244.2.0/24",
+			},
+			Phases: []phase{
+				{
+					WantCmds: []string{
+						"/usr/bin/iptables -t nat -A POSTROUTING -s 10.244.2.0/24 -o tailscale0 -j MASQUERADE",
+						"/usr/bin/tailscaled --socket=/tmp/tailscaled.sock --state=mem: --statedir=/tmp",
+						"/usr/bin/tailscale --socket=/tmp/tailscaled.sock login --authkey=tskey-key",
+					},
+					WantFiles: map[string]string{
+						"proc/sys/net/ipv4/ip_forward":          "1",
+						"proc/sys/net/ipv6/conf/all/forwarding": "0",
+					},
+				},
+				{
+					Notify: runningNotify,
+					WantCmds: []string{
+						"/usr/bin/tailscale --socket=/tmp/tailscaled.sock set --accept-dns=false",
+					},
+				},
+			},
+		},
 		{
 			Name: "hostname",
 			Env: map[string]string{
@@ -710,6 +868,11 @@ type phase struct {
 							return fmt.Errorf("kube secret unexpectedly not empty, got %#v", got)
 						}
 					}
+					if p.WantPodReadiness != "" {
+						if got := kube.PodReadiness(); got != p.WantPodReadiness {
+							return fmt.Errorf("pod readiness = %q, want %q", got, p.WantPodReadiness)
+						}
+					}
 					return nil
 				})
 				if err != nil {
@@ -819,6 +982,40 @@ func waitArgs(t *testing.T, timeout time.Duration, removeStr, path, wantArgs str
 //go:embed test_tailscale.sh
 var fakeTailscale []byte
 
+// fakeRouteTable is a /proc/net/route with a default route via eth0.
+var fakeRouteTable = []byte("Iface\tDestination\tGateway \tFlags\tRefCnt\tUse\tMetric\tMask\t\tMTU\tWindow\tIRTT\n" +
+	"eth0\t00000000\t0101A8C0\t0003\t0\t0\t0\t00000000\t0\t0\t0\n")
+
+func TestReadRoutesFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "routes")
+	routes, err := readRoutesFile(path)
+	if err != nil || routes != nil {
+		t.Fatalf("missing file: got %v, %v; want no routes", routes, err)
+	}
+	if err := os.WriteFile(path, []byte("10.0.1.7/32,fd00::/64\n10.0.0.0/24, 10.0.0.1/24\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	routes, err = readRoutesFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/24"),
+		netip.MustParsePrefix("10.0.1.7/32"),
+		netip.MustParsePrefix("fd00::/64"),
+	}
+	if !slices.Equal(routes, want) {
+		t.Errorf("routes = %v; want %v", routes, want)
+	}
+	if err := os.WriteFile(path, []byte("10.0.0.0/24,bogus"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readRoutesFile(path); err == nil {
+		t.Error("invalid route accepted")
+	}
+}
+
 // localAPI is a minimal fake tailscaled LocalAPI server that presents
 // just enough functionality for containerboot to function
 // correctly. In practice this means it only supports querying
@@ -916,8 +1113,9 @@ func (l *localAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 // kubeServer is a minimal fake Kubernetes server that presents just
 // enough functionality for containerboot to function correctly. In
 // practice this means it only supports reading and modifying a single
-// kube secret, and panics on all other uses to make it very obvious
-// that something unexpected happened.
+// kube secret, patching the readiness of a single pod, and reading a single
+// headless Service and its Endpoints, and panics on all other uses to make it
+// very obvious that something unexpected happened.
 type kubeServer struct {
 	FSRoot     string
 	Host, Port string // populated by Start
@@ -927,6 +1125,9 @@ type kubeServer struct {
 	sync.Mutex
 	secret   map[string]string
 	canPatch bool
+
+	podCondition  string // status of the proxy-ready condition of the pod
+	podAnnotation string // value of the proxy-ready annotation of the pod
 }
 
 func (k *kubeServer) Secret() map[string]string {
@@ -939,6 +1140,14 @@ func (k *kubeServer) Secret() map[string]string {
 	return ret
 }
 
+// PodReadiness returns the status of the proxy-ready condition of the pod and
+// the value of its annotation, separated by a slash.
+func (k *kubeServer) PodReadiness() string {
+	k.Lock()
+	defer k.Unlock()
+	return k.podCondition + "/" + k.podAnnotation
+}
+
 func (k *kubeServer) SetSecret(key, val string) {
 	k.Lock()
 	defer k.Unlock()
@@ -955,6 +1164,8 @@ func (k *kubeServer) Reset() {
 	k.Lock()
 	defer k.Unlock()
 	k.secret = map[string]string{}
+	k.podCondition = ""
+	k.podAnnotation = ""
 }
 
 func (k *kubeServer) Start() error {
@@ -999,6 +1210,16 @@ func (k *kubeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		k.serveSecret(w, r)
 	case "/apis/authorization.k8s.io/v1/selfsubjectaccessreviews":
 		k.serveSSAR(w, r)
+	case "/api/v1/namespaces/default/services/tailscale-router":
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"metadata":{"name":"tailscale-router"},"spec":{"clusterIP":"None"}}`))
+	case "/api/v1/namespaces/default/endpoints/tailscale-router":
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"metadata":{"name":"tailscale-router"},"subsets":[{"addresses":[` +
+			`{"ip":"10.244.1.5","nodeName":"node-a"},` +
+			`{"ip":"10.244.2.7","nodeName":"node-b"}]}]}`))
+	case "/api/v1/namespaces/default/pods/test-pod", "/api/v1/namespaces/default/pods/test-pod/status":
+		k.servePod(w, r)
 	default:
 		panic(fmt.Sprintf("unhandled fake kube api path %q", r.URL.Path))
 	}
@@ -1092,3 +1313,39 @@ func (k *kubeServer) serveSecret(w http.ResponseWriter, r *http.Request) {
 		panic(fmt.Sprintf("unhandled HTTP method %q", r.Method))
 	}
 }
+
+func (k *kubeServer) servePod(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "PATCH" {
+		panic(fmt.Sprintf("unhandled HTTP method %q", r.Method))
+	}
+	if ct := r.Header.Get("Content-Type"); ct != "application/strategic-merge-patch+json" {
+		panic(fmt.Sprintf("unknown content type %q", ct))
+	}
+	var req struct {
+		Metadata struct {
+			Annotations map[string]string `json:"annotations"`
+		} `json:"metadata"`
+		Status struct {
+			Conditions []struct {
+				Type   string `json:"type"`
+				Status string `json:"status"`
+			} `json:"conditions"`
+		} `json:"status"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		panic(fmt.Sprintf("json decode failed: %v", err))
+	}
+	k.Lock()
+	defer k.Unlock()
+	if strings.HasSuffix(r.URL.Path, "/status") {
+		for _, c := range req.Status.Conditions {
+			if c.Type == "tailscale.com/proxy-ready" {
+				k.podCondition = c.Status
+			}
+		}
+	} else if v, ok := req.Metadata.Annotations["tailscale.com/proxy-ready"]; ok {
+		k.podAnnotation = v
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte("{}"))
+}
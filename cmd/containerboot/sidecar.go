@@ -0,0 +1,230 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/netip"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"tailscale.com/kube"
+	"tailscale.com/net/tsaddr"
+)
+
+// modeSidecarRoutes is the TS_MODE in which containerboot doesn't run
+// tailscaled, and only routes the tailnet's traffic out of the pod's network
+// namespace through a tailscale router pod elsewhere, such as a privileged
+// one per node.
+const modeSidecarRoutes = "sidecar-routes"
+
+// routerResolveInterval is how often runSidecarRoutes looks up the router
+// pods of TS_ROUTER_SERVICE again, in case they changed.
+const routerResolveInterval = 30 * time.Second
+
+// runSidecarRoutes routes the tailnet's IP ranges, and any TS_ROUTES, via a
+// tailscale router pod until containerboot is told to shut down. It needs
+// the NET_ADMIN capability, but no tun device or IP forwarding in the pod.
+//
+// The routes are "onlink" via the router pod's IP, so the router must be on
+// the same layer 2 network as this pod, such as a pod on the same node with a
+// bridge CNI. It can't be a Service's cluster IP, which isn't a host on the
+// pod network. The router must forward the traffic into the tailnet and
+// masquerade it as coming from its own Tailscale IP, since the tailnet doesn't
+// know the pod's IP; containerboot does that with TS_SIDECAR_SOURCES.
+func runSidecarRoutes(cfg *settings) {
+	if (cfg.RouterAddr == "") == (cfg.RouterService == "") {
+		log.Fatalf("TS_MODE=%s requires exactly one of TS_ROUTER_ADDR and TS_ROUTER_SERVICE", modeSidecarRoutes)
+	}
+	if cfg.ProxyTo != "" || cfg.TailnetTargetIP != "" || cfg.ServeConfigPath != "" {
+		log.Fatalf("TS_MODE=%s can't be used with TS_DEST_IP, TS_TAILNET_TARGET_IP or TS_SERVE_CONFIG", modeSidecarRoutes)
+	}
+	prefixes := []netip.Prefix{tsaddr.CGNATRange(), tsaddr.TailscaleULARange()}
+	for _, r := range strings.Split(cfg.Routes, ",") {
+		if r = strings.TrimSpace(r); r == "" {
+			continue
+		}
+		p, err := netip.ParsePrefix(r)
+		if err != nil {
+			log.Fatalf("invalid TS_ROUTES entry %q: %v", r, err)
+		}
+		prefixes = append(prefixes, p.Masked())
+	}
+	dev, err := defaultRouteDev(cfg.Root)
+	if err != nil {
+		log.Fatalf("finding the pod's network interface: %v", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), unix.SIGTERM, unix.SIGINT)
+	defer cancel()
+
+	if cfg.RouterAddr != "" {
+		router, err := netip.ParseAddr(cfg.RouterAddr)
+		if err != nil {
+			log.Fatalf("TS_ROUTER_ADDR must be the router pod's IP address; use TS_ROUTER_SERVICE to find it by a headless Service: %v", err)
+		}
+		log.Printf("Routing tailnet traffic via %v", router)
+		if err := installSidecarRoutes(ctx, prefixes, router, dev); err != nil {
+			log.Fatalf("installing routes: %v", err)
+		}
+		// This log message is used in tests to detect when all
+		// configuration is done.
+		log.Println("Startup complete, waiting for shutdown signal")
+		<-ctx.Done()
+		return
+	}
+
+	if !cfg.InKubernetes {
+		log.Fatal("TS_ROUTER_SERVICE is only supported on Kubernetes")
+	}
+	initKube(cfg.Root)
+	var router netip.Addr
+	for {
+		addr, err := routerFromService(ctx, kc, cfg.RouterService, cfg.KubeNodeName)
+		switch {
+		case err != nil && !router.IsValid():
+			log.Fatalf("finding a router pod: %v", err)
+		case err != nil:
+			log.Printf("finding a router pod, keeping routes via %v: %v", router, err)
+		case addr != router:
+			log.Printf("Routing tailnet traffic via %v", addr)
+			if err := installSidecarRoutes(ctx, prefixes, addr, dev); err != nil {
+				log.Fatalf("installing routes: %v", err)
+			}
+			if !router.IsValid() {
+				log.Println("Startup complete, waiting for shutdown signal")
+			}
+			router = addr
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(routerResolveInterval):
+		}
+	}
+}
+
+// serviceGetter gets Services and their Endpoints. It's implemented by
+// *kube.Client.
+type serviceGetter interface {
+	GetService(ctx context.Context, name string) (*kube.Service, error)
+	GetEndpoints(ctx context.Context, name string) (*kube.Endpoints, error)
+}
+
+// routerFromService returns the IP address of a ready router pod of the
+// headless Service svcName. If nodeName is non-empty, only pods on that node
+// are considered. IPv4 addresses, which all clusters have, are preferred,
+// then the lowest address, so that the choice is stable.
+func routerFromService(ctx context.Context, kc serviceGetter, svcName, nodeName string) (netip.Addr, error) {
+	svc, err := kc.GetService(ctx, svcName)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	if svc.Spec.ClusterIP != "None" {
+		return netip.Addr{}, fmt.Errorf("service %q must be headless (clusterIP: None), as routes can't go via a cluster IP", svcName)
+	}
+	ep, err := kc.GetEndpoints(ctx, svcName)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	var ips []netip.Addr
+	for _, ss := range ep.Subsets {
+		for _, a := range ss.Addresses {
+			if nodeName != "" && (a.NodeName == nil || *a.NodeName != nodeName) {
+				continue
+			}
+			if ip, err := netip.ParseAddr(a.IP); err == nil {
+				ips = append(ips, ip.Unmap())
+			}
+		}
+	}
+	if len(ips) == 0 {
+		if nodeName != "" {
+			return netip.Addr{}, fmt.Errorf("no ready router pods of service %q on node %q", svcName, nodeName)
+		}
+		return netip.Addr{}, fmt.Errorf("no ready router pods of service %q", svcName)
+	}
+	slices.SortFunc(ips, func(a, b netip.Addr) int {
+		if a.Is4() != b.Is4() {
+			if a.Is4() {
+				return -1
+			}
+			return 1
+		}
+		return a.Compare(b)
+	})
+	return ips[0], nil
+}
+
+// installSidecarMasquerade masquerades traffic from the sources to the
+// tailnet as coming from this node's Tailscale IP, for pods that route their
+// tailnet traffic via this one with TS_MODE=sidecar-routes.
+func installSidecarMasquerade(ctx context.Context, sources []netip.Prefix) error {
+	for _, p := range sources {
+		argv0 := "iptables"
+		if p.Addr().Is6() {
+			argv0 = "ip6tables"
+		}
+		cmd := exec.CommandContext(ctx, argv0, "-t", "nat", "-A", "POSTROUTING", "-s", p.String(), "-o", "tailscale0", "-j", "MASQUERADE")
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("masquerading %v: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// installSidecarRoutes routes prefixes of the same IP family as router via
+// router on dev, replacing any routes to them. The routes are "onlink", as
+// the router is usually on another subnet, but reachable on dev.
+func installSidecarRoutes(ctx context.Context, prefixes []netip.Prefix, router netip.Addr, dev string) error {
+	for _, p := range prefixes {
+		if p.Addr().Is4() != router.Is4() {
+			log.Printf("Not routing %v via %v, which is of another IP family", p, router)
+			continue
+		}
+		cmd := exec.CommandContext(ctx, "ip", "route", "replace", p.String(), "via", router.String(), "dev", dev, "onlink")
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("routing %v via %v: %w", p, router, err)
+		}
+	}
+	return nil
+}
+
+// defaultRouteDev returns the network interface of the IPv4 default route,
+// read from /proc/net/route under root.
+func defaultRouteDev(root string) (string, error) {
+	f, err := os.Open(filepath.Join(root, "proc/net/route"))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		// Iface Destination Gateway Flags ...
+		fields := strings.Fields(s.Text())
+		if len(fields) > 1 && fields[1] == "00000000" {
+			return fields[0], nil
+		}
+	}
+	if err := s.Err(); err != nil {
+		return "", err
+	}
+	return "", errors.New("no default route")
+}
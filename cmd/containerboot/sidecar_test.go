@@ -0,0 +1,91 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+
+	"tailscale.com/kube"
+	"tailscale.com/types/ptr"
+)
+
+type fakeServiceGetter struct {
+	svc *kube.Service
+	ep  *kube.Endpoints
+}
+
+func (f *fakeServiceGetter) GetService(ctx context.Context, name string) (*kube.Service, error) {
+	return f.svc, nil
+}
+
+func (f *fakeServiceGetter) GetEndpoints(ctx context.Context, name string) (*kube.Endpoints, error) {
+	return f.ep, nil
+}
+
+func TestRouterFromService(t *testing.T) {
+	headless := &kube.Service{Spec: kube.ServiceSpec{ClusterIP: "None"}}
+	endpoints := func(addrs ...kube.EndpointAddress) *kube.Endpoints {
+		return &kube.Endpoints{Subsets: []kube.EndpointSubset{{
+			Addresses:         addrs,
+			NotReadyAddresses: []kube.EndpointAddress{{IP: "10.0.0.1", NodeName: ptr.To("node-a")}},
+		}}}
+	}
+	tests := []struct {
+		name    string
+		svc     *kube.Service
+		ep      *kube.Endpoints
+		node    string
+		want    netip.Addr
+		wantErr bool
+	}{
+		{
+			name:    "cluster_ip",
+			svc:     &kube.Service{Spec: kube.ServiceSpec{ClusterIP: "10.96.0.10"}},
+			ep:      endpoints(kube.EndpointAddress{IP: "10.244.1.5"}),
+			wantErr: true,
+		},
+		{
+			name: "lowest_ipv4",
+			svc:  headless,
+			ep: endpoints(
+				kube.EndpointAddress{IP: "fd00::5"},
+				kube.EndpointAddress{IP: "10.244.2.7"},
+				kube.EndpointAddress{IP: "10.244.1.5"},
+			),
+			want: netip.MustParseAddr("10.244.1.5"),
+		},
+		{
+			name: "same_node",
+			svc:  headless,
+			ep: endpoints(
+				kube.EndpointAddress{IP: "10.244.1.5", NodeName: ptr.To("node-a")},
+				kube.EndpointAddress{IP: "10.244.2.7", NodeName: ptr.To("node-b")},
+			),
+			node: "node-b",
+			want: netip.MustParseAddr("10.244.2.7"),
+		},
+		{
+			name:    "none_ready_on_node",
+			svc:     headless,
+			ep:      endpoints(kube.EndpointAddress{IP: "10.244.2.7", NodeName: ptr.To("node-b")}),
+			node:    "node-a",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := routerFromService(context.Background(), &fakeServiceGetter{tt.svc, tt.ep}, "tailscale-router", tt.node)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
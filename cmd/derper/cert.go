@@ -8,9 +8,11 @@
 	"crypto/x509"
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"path/filepath"
 	"regexp"
+	"strings"
 
 	"golang.org/x/crypto/acme/autocert"
 )
@@ -29,52 +31,78 @@ type certProvider interface {
 	HTTPHandler(fallback http.Handler) http.Handler
 }
 
-func certProviderByCertMode(mode, dir, hostname string) (certProvider, error) {
+// certProviderByCertMode returns the cert provider for mode that serves
+// certs for hostnames, keeping its state in dir. dnsProvider is the value of
+// the --acme-dns-provider flag, used only by the "dns01" mode.
+func certProviderByCertMode(mode, dir string, hostnames []string, dnsProvider string) (certProvider, error) {
 	if dir == "" {
 		return nil, errors.New("missing required --certdir flag")
 	}
+	if len(hostnames) == 0 {
+		return nil, errors.New("missing required --hostname flag")
+	}
 	switch mode {
 	case "letsencrypt":
 		certManager := &autocert.Manager{
 			Prompt:     autocert.AcceptTOS,
-			HostPolicy: autocert.HostWhitelist(hostname),
+			HostPolicy: autocert.HostWhitelist(hostnames...),
 			Cache:      autocert.DirCache(dir),
 		}
-		if hostname == "derp.tailscale.com" {
+		if len(hostnames) == 1 && hostnames[0] == "derp.tailscale.com" {
 			certManager.HostPolicy = prodAutocertHostPolicy
 			certManager.Email = "security@tailscale.com"
 		}
 		return certManager, nil
 	case "manual":
-		return NewManualCertManager(dir, hostname)
+		return NewManualCertManager(dir, hostnames...)
+	case "dns01":
+		p, err := dnsProviderByName(dnsProvider)
+		if err != nil {
+			return nil, err
+		}
+		return newDNS01CertManager(dir, hostnames, p, log.Printf)
 	default:
 		return nil, fmt.Errorf("unsupport cert mode: %q", mode)
 	}
 }
 
+// parseHostnames splits the comma-separated --hostname flag value.
+func parseHostnames(v string) []string {
+	var hosts []string
+	for _, h := range strings.Split(v, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			hosts = append(hosts, h)
+		}
+	}
+	return hosts
+}
+
 type manualCertManager struct {
-	cert     *tls.Certificate
-	hostname string
+	certs map[string]*tls.Certificate // keyed by hostname
 }
 
-// NewManualCertManager returns a cert provider which read certificate by given hostname on create.
-func NewManualCertManager(certdir, hostname string) (certProvider, error) {
-	keyname := unsafeHostnameCharacters.ReplaceAllString(hostname, "")
-	crtPath := filepath.Join(certdir, keyname+".crt")
-	keyPath := filepath.Join(certdir, keyname+".key")
-	cert, err := tls.LoadX509KeyPair(crtPath, keyPath)
-	if err != nil {
-		return nil, fmt.Errorf("can not load x509 key pair for hostname %q: %w", keyname, err)
-	}
-	// ensure hostname matches with the certificate
-	x509Cert, err := x509.ParseCertificate(cert.Certificate[0])
-	if err != nil {
-		return nil, fmt.Errorf("can not load cert: %w", err)
-	}
-	if err := x509Cert.VerifyHostname(hostname); err != nil {
-		return nil, fmt.Errorf("cert invalid for hostname %q: %w", hostname, err)
+// NewManualCertManager returns a cert provider which read certificate by given hostnames on create.
+func NewManualCertManager(certdir string, hostnames ...string) (certProvider, error) {
+	m := &manualCertManager{certs: make(map[string]*tls.Certificate)}
+	for _, hostname := range hostnames {
+		keyname := unsafeHostnameCharacters.ReplaceAllString(hostname, "")
+		crtPath := filepath.Join(certdir, keyname+".crt")
+		keyPath := filepath.Join(certdir, keyname+".key")
+		cert, err := tls.LoadX509KeyPair(crtPath, keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("can not load x509 key pair for hostname %q: %w", keyname, err)
+		}
+		// ensure hostname matches with the certificate
+		x509Cert, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return nil, fmt.Errorf("can not load cert: %w", err)
+		}
+		if err := x509Cert.VerifyHostname(hostname); err != nil {
+			return nil, fmt.Errorf("cert invalid for hostname %q: %w", hostname, err)
+		}
+		m.certs[hostname] = &cert
 	}
-	return &manualCertManager{cert: &cert, hostname: hostname}, nil
+	return m, nil
 }
 
 func (m *manualCertManager) TLSConfig() *tls.Config {
@@ -88,16 +116,20 @@ func (m *manualCertManager) TLSConfig() *tls.Config {
 }
 
 func (m *manualCertManager) getCertificate(hi *tls.ClientHelloInfo) (*tls.Certificate, error) {
-	if hi.ServerName != m.hostname {
+	cert, ok := m.certs[hi.ServerName]
+	if !ok {
 		return nil, fmt.Errorf("cert mismatch with hostname: %q", hi.ServerName)
 	}
+	return copyCert(cert), nil
+}
 
-	// Return a shallow copy of the cert so the caller can append to its
-	// Certificate field.
+// copyCert returns a shallow copy of cert so the caller can append to its
+// Certificate field.
+func copyCert(cert *tls.Certificate) *tls.Certificate {
 	certCopy := new(tls.Certificate)
-	*certCopy = *m.cert
+	*certCopy = *cert
 	certCopy.Certificate = certCopy.Certificate[:len(certCopy.Certificate):len(certCopy.Certificate)]
-	return certCopy, nil
+	return certCopy
 }
 
 func (m *manualCertManager) HTTPHandler(fallback http.Handler) http.Handler {
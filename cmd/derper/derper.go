@@ -38,13 +38,13 @@
 
 var (
 	dev        = flag.Bool("dev", false, "run in localhost development mode (overrides -a)")
-	addr       = flag.String("a", ":443", "server HTTP/HTTPS listen address, in form \":port\", \"ip:port\", or for IPv6 \"[ip]:port\". If the IP is omitted, it defaults to all interfaces. Serves HTTPS if the port is 443 and/or -certmode is manual, otherwise HTTP.")
+	addr       = flag.String("a", ":443", "server HTTP/HTTPS listen address, in form \":port\", \"ip:port\", or for IPv6 \"[ip]:port\". If the IP is omitted, it defaults to all interfaces. Serves HTTPS if the port is 443 and/or -certmode is manual or dns01, otherwise HTTP.")
 	httpPort   = flag.Int("http-port", 80, "The port on which to serve HTTP. Set to -1 to disable. The listener is bound to the same IP (if any) as specified in the -a flag.")
 	stunPort   = flag.Int("stun-port", 3478, "The UDP port on which to serve STUN. The listener is bound to the same IP (if any) as specified in the -a flag.")
 	configPath = flag.String("c", "", "config file path")
-	certMode   = flag.String("certmode", "letsencrypt", "mode for getting a cert. possible options: manual, letsencrypt")
+	certMode   = flag.String("certmode", "letsencrypt", "mode for getting a cert. possible options: manual, letsencrypt, dns01")
 	certDir    = flag.String("certdir", tsweb.DefaultCertDir("derper-certs"), "directory to store LetsEncrypt certs, if addr's port is :443")
-	hostname   = flag.String("hostname", "derp.tailscale.com", "LetsEncrypt host name, if addr's port is :443")
+	hostname   = flag.String("hostname", "derp.tailscale.com", "comma-separated LetsEncrypt host names, if addr's port is :443; with -certmode=dns01, they may include wildcards")
 	runSTUN    = flag.Bool("stun", true, "whether to run a STUN server. It will bind to the same IP (if any) as the --addr flag value.")
 	runDERP    = flag.Bool("derp", true, "whether to run a DERP server. The only reason to set this false is if you're decommissioning a server but want to keep its bootstrap DNS functionality still running.")
 
@@ -53,9 +53,15 @@
 	bootstrapDNS   = flag.String("bootstrap-dns-names", "", "optional comma-separated list of hostnames to make available at /bootstrap-dns")
 	unpublishedDNS = flag.String("unpublished-bootstrap-dns-names", "", "optional comma-separated list of hostnames to make available at /bootstrap-dns and not publish in the list")
 	verifyClients  = flag.Bool("verify-clients", false, "verify clients to this DERP server through a local tailscaled instance.")
+	bandwidthProbe = flag.Bool("bandwidth-probe", false, "whether to serve bandwidth probes to netcheck clients at "+derphttp.BandwidthProbePath+". Each probe transfers up to 16 MiB in each direction.")
 
 	acceptConnLimit = flag.Float64("accept-connection-limit", math.Inf(+1), "rate limit for accepting new connection")
 	acceptConnBurst = flag.Int("accept-connection-burst", math.MaxInt, "burst limit for accepting new connection")
+	maxClients      = flag.Int("max-clients", 0, "if non-zero, the maximum number of concurrent client connections; mesh peers are always accepted")
+	clientRateLimit = flag.Int("per-client-rate-limit", 0, "if non-zero, the rate in bytes per second at which each client can send packets; mesh peers aren't limited")
+	clientRateBurst = flag.Int("per-client-rate-burst", 0, "burst, in bytes, of --per-client-rate-limit; raised to the largest packet size if smaller")
+
+	acmeDNSProvider = flag.String("acme-dns-provider", "", `with -certmode=dns01, the DNS provider that creates the ACME challenge TXT records, as "name:arg"; "exec:/path/to/prog" runs "prog present|cleanup <fqdn> <value>"`)
 )
 
 var (
@@ -148,10 +154,12 @@ func main() {
 
 	cfg := loadConfig()
 
-	serveTLS := tsweb.IsProd443(*addr) || *certMode == "manual"
+	serveTLS := tsweb.IsProd443(*addr) || *certMode == "manual" || *certMode == "dns01"
 
 	s := derp.NewServer(cfg.PrivateKey, log.Printf)
 	s.SetVerifyClient(*verifyClients)
+	s.SetMaxClients(*maxClients)
+	s.SetPerClientRateLimit(*clientRateLimit, *clientRateBurst)
 
 	if *meshPSKFile != "" {
 		b, err := os.ReadFile(*meshPSKFile)
@@ -181,6 +189,9 @@ func main() {
 		}))
 	}
 	mux.HandleFunc("/derp/probe", probeHandler)
+	if *bandwidthProbe {
+		mux.HandleFunc(derphttp.BandwidthProbePath, derphttp.BandwidthProbeHandler)
+	}
 	go refreshBootstrapDNSLoop()
 	mux.HandleFunc("/bootstrap-dns", tsweb.BrowserHeaderHandlerFunc(handleBootstrapDNS))
 	mux.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -245,7 +256,7 @@ func main() {
 	if serveTLS {
 		log.Printf("derper: serving on %s with TLS", *addr)
 		var certManager certProvider
-		certManager, err = certProviderByCertMode(*certMode, *certDir, *hostname)
+		certManager, err = certProviderByCertMode(*certMode, *certDir, parseHostnames(*hostname), *acmeDNSProvider)
 		if err != nil {
 			log.Fatalf("derper: can not start cert provider: %v", err)
 		}
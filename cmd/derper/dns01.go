@@ -0,0 +1,386 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"tailscale.com/types/logger"
+)
+
+// dnsProvider creates and removes the TXT records of ACME DNS-01 challenges.
+type dnsProvider interface {
+	// Present creates a TXT record at fqdn with the given value. It must
+	// not return until the record is visible to the ACME server.
+	Present(ctx context.Context, fqdn, value string) error
+	// CleanUp removes the TXT record created by Present.
+	CleanUp(ctx context.Context, fqdn, value string) error
+}
+
+// dnsProviders are the DNS providers that --acme-dns-provider can name, keyed
+// by name. The flag value is of the form "name:arg", and each constructor is
+// passed the arg.
+var dnsProviders = map[string]func(arg string) (dnsProvider, error){
+	"exec": newExecDNSProvider,
+}
+
+// dnsProviderByName returns the DNS provider named by v, the value of the
+// --acme-dns-provider flag.
+func dnsProviderByName(v string) (dnsProvider, error) {
+	if v == "" {
+		return nil, errors.New("--certmode=dns01 requires --acme-dns-provider")
+	}
+	name, arg, _ := strings.Cut(v, ":")
+	newProvider, ok := dnsProviders[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown DNS provider %q", name)
+	}
+	return newProvider(arg)
+}
+
+// execDNSProvider is a dnsProvider that runs a program to change DNS records,
+// as "prog present <fqdn> <value>" and "prog cleanup <fqdn> <value>".
+type execDNSProvider struct {
+	prog string
+}
+
+func newExecDNSProvider(prog string) (dnsProvider, error) {
+	if prog == "" {
+		return nil, errors.New(`DNS provider "exec" requires a program path, as exec:/path/to/prog`)
+	}
+	return execDNSProvider{prog: prog}, nil
+}
+
+func (p execDNSProvider) Present(ctx context.Context, fqdn, value string) error {
+	return p.run(ctx, "present", fqdn, value)
+}
+
+func (p execDNSProvider) CleanUp(ctx context.Context, fqdn, value string) error {
+	return p.run(ctx, "cleanup", fqdn, value)
+}
+
+func (p execDNSProvider) run(ctx context.Context, args ...string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, p.prog, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s: %w; output: %s", p.prog, args[0], err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+const (
+	// dns01RenewBefore is how long before its expiry the dns01CertManager
+	// renews its cert.
+	dns01RenewBefore = 30 * 24 * time.Hour
+	// dns01CheckInterval is how often the dns01CertManager checks whether
+	// its cert needs renewing.
+	dns01CheckInterval = 12 * time.Hour
+)
+
+// dns01CertManager is a certProvider that gets a single cert for all of its
+// hostnames from an ACME server using DNS-01 challenges, so the relay doesn't
+// need to be reachable on port 80 or 443 to get one. Unlike the other cert
+// providers, its hostnames may include wildcards.
+type dns01CertManager struct {
+	hostnames []string
+	dir       string
+	dns       dnsProvider
+	logf      logger.Logf
+	client    *acme.Client
+
+	mu   sync.Mutex
+	cert *tls.Certificate // with Leaf set
+}
+
+// newDNS01CertManager returns a dns01CertManager for hostnames that keeps its
+// ACME account key and cert in dir. It loads the cert from dir, getting a new
+// one first if needed, and starts renewing it in the background.
+func newDNS01CertManager(dir string, hostnames []string, dns dnsProvider, logf logger.Logf) (*dns01CertManager, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	key, err := loadOrCreateKey(filepath.Join(dir, "acme-account.key"))
+	if err != nil {
+		return nil, fmt.Errorf("ACME account key: %w", err)
+	}
+	m := &dns01CertManager{
+		hostnames: hostnames,
+		dir:       dir,
+		dns:       dns,
+		logf:      logger.WithPrefix(logf, "dns01: "),
+		client:    &acme.Client{Key: key, UserAgent: "derper"},
+	}
+	if err := m.load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		m.logf("ignoring cached cert: %v", err)
+	}
+	if m.needsRenewal(time.Now()) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+		if err := m.renew(ctx); err != nil {
+			return nil, err
+		}
+	}
+	go m.renewLoop()
+	return m, nil
+}
+
+func (m *dns01CertManager) TLSConfig() *tls.Config {
+	return &tls.Config{
+		NextProtos: []string{
+			"http/1.1",
+		},
+		GetCertificate: m.getCertificate,
+	}
+}
+
+func (m *dns01CertManager) getCertificate(hi *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	m.mu.Lock()
+	cert := m.cert
+	m.mu.Unlock()
+	if err := cert.Leaf.VerifyHostname(hi.ServerName); err != nil {
+		return nil, fmt.Errorf("cert mismatch with hostname: %q", hi.ServerName)
+	}
+	return copyCert(cert), nil
+}
+
+func (m *dns01CertManager) HTTPHandler(fallback http.Handler) http.Handler {
+	return fallback
+}
+
+func (m *dns01CertManager) certFile() string {
+	return filepath.Join(m.dir, unsafeHostnameCharacters.ReplaceAllString(m.hostnames[0], "")+".dns01.crt")
+}
+
+func (m *dns01CertManager) keyFile() string {
+	return filepath.Join(m.dir, unsafeHostnameCharacters.ReplaceAllString(m.hostnames[0], "")+".dns01.key")
+}
+
+// load loads the cached cert from m.dir.
+func (m *dns01CertManager) load() error {
+	cert, err := tls.LoadX509KeyPair(m.certFile(), m.keyFile())
+	if err != nil {
+		return err
+	}
+	return m.setCert(&cert)
+}
+
+// setCert makes cert the current cert, if it's valid for all of
+// m.hostnames.
+func (m *dns01CertManager) setCert(cert *tls.Certificate) error {
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return err
+	}
+	for _, h := range m.hostnames {
+		// VerifyHostname doesn't accept wildcard names, so check them
+		// with a name that the wildcard matches.
+		if err := leaf.VerifyHostname(strings.Replace(h, "*", "x", 1)); err != nil {
+			return fmt.Errorf("cert invalid for hostname %q: %w", h, err)
+		}
+	}
+	cert.Leaf = leaf
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cert = cert
+	return nil
+}
+
+// needsRenewal reports whether m has no cert, or one that expires within
+// dns01RenewBefore of now.
+func (m *dns01CertManager) needsRenewal(now time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.cert == nil || m.cert.Leaf.NotAfter.Sub(now) < dns01RenewBefore
+}
+
+func (m *dns01CertManager) renewLoop() {
+	for {
+		time.Sleep(dns01CheckInterval)
+		if !m.needsRenewal(time.Now()) {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		if err := m.renew(ctx); err != nil {
+			m.logf("renewing cert: %v", err)
+		}
+		cancel()
+	}
+}
+
+// renew gets a new cert for m.hostnames from the ACME server, writes it to
+// m.dir and makes it the current cert.
+func (m *dns01CertManager) renew(ctx context.Context) error {
+	if err := m.register(ctx); err != nil {
+		return err
+	}
+	ids := make([]acme.AuthzID, len(m.hostnames))
+	for i, h := range m.hostnames {
+		ids[i] = acme.AuthzID{Type: "dns", Value: h}
+	}
+	order, err := m.client.AuthorizeOrder(ctx, ids)
+	if err != nil {
+		return fmt.Errorf("AuthorizeOrder: %w", err)
+	}
+	for _, u := range order.AuthzURLs {
+		az, err := m.client.GetAuthorization(ctx, u)
+		if err != nil {
+			return fmt.Errorf("GetAuthorization: %w", err)
+		}
+		if az.Status == acme.StatusValid {
+			continue
+		}
+		if err := m.solve(ctx, az); err != nil {
+			return err
+		}
+	}
+	order, err = m.client.WaitOrder(ctx, order.URI)
+	if err != nil {
+		return fmt.Errorf("WaitOrder: %w", err)
+	}
+
+	certKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: m.hostnames[0]},
+		DNSNames: m.hostnames,
+	}, certKey)
+	if err != nil {
+		return err
+	}
+	der, _, err := m.client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return fmt.Errorf("CreateOrderCert: %w", err)
+	}
+
+	var certPEM bytes.Buffer
+	for _, b := range der {
+		if err := pem.Encode(&certPEM, &pem.Block{Type: "CERTIFICATE", Bytes: b}); err != nil {
+			return err
+		}
+	}
+	keyPEM, err := encodeKey(certKey)
+	if err != nil {
+		return err
+	}
+	cert, err := tls.X509KeyPair(certPEM.Bytes(), keyPEM)
+	if err != nil {
+		return err
+	}
+	if err := m.setCert(&cert); err != nil {
+		return err
+	}
+	if err := os.WriteFile(m.keyFile(), keyPEM, 0600); err != nil {
+		return err
+	}
+	if err := os.WriteFile(m.certFile(), certPEM.Bytes(), 0644); err != nil {
+		return err
+	}
+	m.logf("got cert for %v, valid until %v", m.hostnames, cert.Leaf.NotAfter)
+	return nil
+}
+
+// register registers m's ACME account, if it isn't already.
+func (m *dns01CertManager) register(ctx context.Context) error {
+	_, err := m.client.GetReg(ctx, "" /* pre-RFC param */)
+	if err == acme.ErrNoAccount {
+		_, err = m.client.Register(ctx, new(acme.Account), acme.AcceptTOS)
+		if err == acme.ErrAccountAlreadyExists {
+			err = nil
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("registering ACME account: %w", err)
+	}
+	return nil
+}
+
+// solve completes the DNS-01 challenge of az.
+func (m *dns01CertManager) solve(ctx context.Context, az *acme.Authorization) error {
+	for _, ch := range az.Challenges {
+		if ch.Type != "dns-01" {
+			continue
+		}
+		rec, err := m.client.DNS01ChallengeRecord(ch.Token)
+		if err != nil {
+			return err
+		}
+		// Wildcard names are validated with the record of their base name.
+		fqdn := "_acme-challenge." + strings.TrimPrefix(az.Identifier.Value, "*.")
+		if err := m.dns.Present(ctx, fqdn, rec); err != nil {
+			return fmt.Errorf("creating TXT record %q: %w", fqdn, err)
+		}
+		defer func() {
+			if err := m.dns.CleanUp(ctx, fqdn, rec); err != nil {
+				m.logf("removing TXT record %q: %v", fqdn, err)
+			}
+		}()
+		if _, err := m.client.Accept(ctx, ch); err != nil {
+			return fmt.Errorf("Accept: %w", err)
+		}
+		if _, err := m.client.WaitAuthorization(ctx, az.URI); err != nil {
+			return fmt.Errorf("WaitAuthorization %q: %w", az.Identifier.Value, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("no dns-01 challenge for %q", az.Identifier.Value)
+}
+
+// loadOrCreateKey loads the PEM-encoded EC private key at path, first
+// creating one if path doesn't exist.
+func loadOrCreateKey(path string) (crypto.Signer, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		b, err := encodeKey(k)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, b, 0600); err != nil {
+			return nil, err
+		}
+		return k, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	blk, _ := pem.Decode(b)
+	if blk == nil {
+		return nil, fmt.Errorf("%s: no PEM data", path)
+	}
+	return x509.ParseECPrivateKey(blk.Bytes)
+}
+
+func encodeKey(k *ecdsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalECPrivateKey(k)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
@@ -0,0 +1,127 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCert returns a self-signed cert for names that expires at notAfter.
+func testCert(t *testing.T, notAfter time.Time, names ...string) *tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: names[0]},
+		DNSNames:     names,
+		NotBefore:    notAfter.Add(-90 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestDNS01CertManager(t *testing.T) {
+	now := time.Now()
+	m := &dns01CertManager{hostnames: []string{"derp.example.com", "*.derp.example.com"}}
+	if !m.needsRenewal(now) {
+		t.Error("needsRenewal = false without a cert")
+	}
+
+	if err := m.setCert(testCert(t, now.Add(60*24*time.Hour), "derp.example.com")); err == nil {
+		t.Error("setCert accepted a cert missing a hostname")
+	}
+	if err := m.setCert(testCert(t, now.Add(60*24*time.Hour), "derp.example.com", "*.derp.example.com")); err != nil {
+		t.Fatalf("setCert: %v", err)
+	}
+	if m.needsRenewal(now) {
+		t.Error("needsRenewal = true with a fresh cert")
+	}
+	if !m.needsRenewal(now.Add(40 * 24 * time.Hour)) {
+		t.Error("needsRenewal = false with a cert expiring soon")
+	}
+
+	for _, tt := range []struct {
+		name   string
+		wantOK bool
+	}{
+		{"derp.example.com", true},
+		{"sfo.derp.example.com", true},
+		{"example.com", false},
+		{"a.b.derp.example.com", false},
+	} {
+		cert, err := m.getCertificate(&tls.ClientHelloInfo{ServerName: tt.name})
+		if (err == nil) != tt.wantOK {
+			t.Errorf("getCertificate(%q) error = %v; want ok %v", tt.name, err, tt.wantOK)
+		}
+		if err == nil && cert == m.cert {
+			t.Errorf("getCertificate(%q) returned the cert itself, not a copy", tt.name)
+		}
+	}
+}
+
+func TestExecDNSProvider(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test uses a shell script")
+	}
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+	prog := filepath.Join(dir, "hook.sh")
+	script := "#!/bin/sh\necho \"$@\" >> " + out + "\n[ \"$1\" = present ]\n"
+	if err := os.WriteFile(prog, []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := dnsProviderByName("exec:" + prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := p.Present(ctx, "_acme-challenge.derp.example.com", "tok"); err != nil {
+		t.Errorf("Present: %v", err)
+	}
+	if err := p.CleanUp(ctx, "_acme-challenge.derp.example.com", "tok"); err == nil {
+		t.Error("CleanUp succeeded; want the script's failure")
+	}
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "present _acme-challenge.derp.example.com tok\ncleanup _acme-challenge.derp.example.com tok\n"
+	if string(got) != want {
+		t.Errorf("script ran with:\n%s\nwant:\n%s", got, want)
+	}
+
+	for _, v := range []string{"", "exec", "nope:foo"} {
+		if _, err := dnsProviderByName(v); err == nil {
+			t.Errorf("dnsProviderByName(%q) succeeded; want error", v)
+		}
+	}
+}
+
+func TestParseHostnames(t *testing.T) {
+	got := strings.Join(parseHostnames(" a.example.com,,b.example.com "), "|")
+	if want := "a.example.com|b.example.com"; got != want {
+		t.Errorf("parseHostnames = %q; want %q", got, want)
+	}
+}
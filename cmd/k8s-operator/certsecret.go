@@ -0,0 +1,194 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !plan9
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"tailscale.com/types/ptr"
+)
+
+// certSecretName returns the name of the Secret that the tailnet TLS cert of
+// the proxy of a Service or Ingress with the given annotations is exported
+// to, or "" if it isn't exported.
+func certSecretName(annotations map[string]string) (string, error) {
+	name := annotations[AnnotationCertSecret]
+	if name == "" {
+		return "", nil
+	}
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		return "", fmt.Errorf("invalid %s annotation %q: %s", AnnotationCertSecret, name, strings.Join(errs, "; "))
+	}
+	return name, nil
+}
+
+// reconcileCertSecret makes the Secret name in the namespace of parent, a
+// Service or Ingress, hold the TLS cert of parent's proxy, which has the given
+// child labels. If name differs from the Secret that the cert was last
+// exported to, that Secret is deleted first; an empty name just deletes it.
+//
+// The name of the exported Secret is recorded in an annotation on parent, so
+// that it can be found again after the cert-secret annotation changes.
+func (a *tailscaleSTSReconciler) reconcileCertSecret(ctx context.Context, logger *zap.SugaredLogger, parent client.Object, childLabels map[string]string, name string) error {
+	anns := parent.GetAnnotations()
+	if last := anns[annotationLastSetCertSecret]; last != "" && last != name {
+		if err := a.deleteCertSecret(ctx, logger, parent, last); err != nil {
+			return err
+		}
+		delete(anns, annotationLastSetCertSecret)
+		parent.SetAnnotations(anns)
+		if err := a.Update(ctx, parent); err != nil {
+			return fmt.Errorf("failed to remove %s annotation: %w", annotationLastSetCertSecret, err)
+		}
+	}
+	if name == "" {
+		return nil
+	}
+	if anns[annotationLastSetCertSecret] != name {
+		// Record the name before creating the Secret, so that it is never
+		// left behind.
+		if anns == nil {
+			anns = map[string]string{}
+		}
+		anns[annotationLastSetCertSecret] = name
+		parent.SetAnnotations(anns)
+		if err := a.Update(ctx, parent); err != nil {
+			return fmt.Errorf("failed to set %s annotation: %w", annotationLastSetCertSecret, err)
+		}
+	}
+	return a.syncCertSecret(ctx, logger, parent, childLabels, name)
+}
+
+// syncCertSecret copies the TLS cert and key that the proxy with the given
+// labels stores in its state Secret into the kubernetes.io/tls Secret name in
+// the namespace of parent, creating it if needed, so that other ingress
+// controllers can terminate TLS with the proxy's tailnet cert. It does nothing
+// until the proxy has got its cert; the proxy renewing its cert updates its
+// state Secret, which triggers another reconcile.
+//
+// The Secret is created with parent as its controller, and existing Secrets
+// that parent doesn't control are never overwritten.
+func (a *tailscaleSTSReconciler) syncCertSecret(ctx context.Context, logger *zap.SugaredLogger, parent client.Object, childLabels map[string]string, name string) error {
+	sec, err := getSingleObject[corev1.Secret](ctx, a.Client, a.operatorNamespace, childLabels)
+	if err != nil {
+		return err
+	}
+	if sec == nil {
+		return nil
+	}
+	domain := strings.TrimSuffix(string(sec.Data["device_fqdn"]), ".")
+	if domain == "" {
+		return nil
+	}
+	cert, key := sec.Data[domain+".crt"], sec.Data[domain+".key"]
+	if len(cert) == 0 || len(key) == 0 {
+		logger.Debugf("no TLS cert for %s yet, waiting for proxy to get it", domain)
+		return nil
+	}
+	data := map[string][]byte{
+		corev1.TLSCertKey:       cert,
+		corev1.TLSPrivateKeyKey: key,
+	}
+
+	ns := parent.GetNamespace()
+	out, err := a.getCertSecret(ctx, parent, name)
+	if err != nil {
+		return err
+	}
+	if out == nil {
+		ref, err := a.controllerRef(parent)
+		if err != nil {
+			return err
+		}
+		out = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            name,
+				Namespace:       ns,
+				OwnerReferences: []metav1.OwnerReference{ref},
+			},
+			Type: corev1.SecretTypeTLS,
+			Data: data,
+		}
+		err = a.Create(ctx, out)
+	} else {
+		out.Data = data
+		err = a.Update(ctx, out)
+	}
+	if err != nil {
+		return fmt.Errorf("exporting TLS cert to Secret %s/%s: %w", ns, name, err)
+	}
+	logger.Debugf("exported TLS cert for %s to Secret %s/%s", domain, ns, name)
+	return nil
+}
+
+// deleteCertSecret deletes the Secret name in the namespace of parent that
+// syncCertSecret exported a TLS cert to. Secrets that don't exist or that
+// parent doesn't control are left alone.
+func (a *tailscaleSTSReconciler) deleteCertSecret(ctx context.Context, logger *zap.SugaredLogger, parent client.Object, name string) error {
+	ns := parent.GetNamespace()
+	sec, err := a.getCertSecret(ctx, parent, name)
+	if err != nil {
+		logger.Infof("not deleting Secret %s/%s: %v", ns, name, err)
+		return nil
+	}
+	if sec == nil {
+		return nil
+	}
+	err = a.Delete(ctx, sec, client.Preconditions{UID: &sec.UID})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("deleting TLS cert Secret %s/%s: %w", ns, name, err)
+	}
+	return nil
+}
+
+// getCertSecret returns the Secret name in the namespace of parent, or nil
+// if there is none. It returns an error if the Secret exists but wasn't
+// created for parent by syncCertSecret.
+func (a *tailscaleSTSReconciler) getCertSecret(ctx context.Context, parent client.Object, name string) (*corev1.Secret, error) {
+	ns := parent.GetNamespace()
+	// The operator only caches Secrets in its own namespace, so read the
+	// Secret from the API server.
+	sec := new(corev1.Secret)
+	err := a.apiReader.Get(ctx, types.NamespacedName{Namespace: ns, Name: name}, sec)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting Secret %s/%s: %w", ns, name, err)
+	}
+	if !metav1.IsControlledBy(sec, parent) {
+		return nil, fmt.Errorf("Secret %s/%s already exists and was not created by the operator for %s", ns, name, parent.GetName())
+	}
+	return sec, nil
+}
+
+// controllerRef returns an owner reference that makes parent the controller
+// of a Secret exported by syncCertSecret, so that the Secret is garbage
+// collected with parent. It doesn't block the deletion of parent, which would
+// need permission to update parent's finalizers.
+func (a *tailscaleSTSReconciler) controllerRef(parent client.Object) (metav1.OwnerReference, error) {
+	gvk, err := apiutil.GVKForObject(parent, a.Scheme())
+	if err != nil {
+		return metav1.OwnerReference{}, err
+	}
+	return metav1.OwnerReference{
+		APIVersion: gvk.GroupVersion().String(),
+		Kind:       gvk.Kind,
+		Name:       parent.GetName(),
+		UID:        parent.GetUID(),
+		Controller: ptr.To(true),
+	}, nil
+}
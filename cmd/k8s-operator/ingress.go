@@ -85,6 +85,9 @@ func (a *IngressReconciler) maybeCleanup(ctx context.Context, logger *zap.Sugare
 		logger.Debugf("cleanup not done yet, waiting for next reconcile")
 		return nil
 	}
+	if err := a.ssr.reconcileCertSecret(ctx, logger, ing, nil, ""); err != nil {
+		return err
+	}
 
 	ing.Finalizers = append(ing.Finalizers[:ix], ing.Finalizers[ix+1:]...)
 	if err := a.Update(ctx, ing); err != nil {
@@ -125,7 +128,12 @@ func (a *IngressReconciler) maybeProvision(ctx context.Context, logger *zap.Suga
 	gaugeIngressResources.Set(int64(a.managedIngresses.Len()))
 	a.mu.Unlock()
 
-	if !a.ssr.IsHTTPSEnabledOnTailnet() {
+	tailnet, err := a.ssr.tailnetFromAnnotations(ing.Annotations)
+	if err != nil {
+		return err
+	}
+	// The operator only knows whether HTTPS is enabled on its own tailnet.
+	if tailnet == "" && !a.ssr.IsHTTPSEnabledOnTailnet() {
 		a.recorder.Event(ing, corev1.EventTypeWarning, "HTTPSNotEnabled", "HTTPS is not enabled on the tailnet; ingress may not work")
 	}
 
@@ -151,6 +159,7 @@ func (a *IngressReconciler) maybeProvision(ctx context.Context, logger *zap.Suga
 	}
 
 	web := sc.Web[magic443]
+	var backends []*corev1.Service
 	addIngressBackend := func(b *networkingv1.IngressBackend, path string) {
 		if b == nil {
 			return
@@ -190,6 +199,7 @@ func (a *IngressReconciler) maybeProvision(ctx context.Context, logger *zap.Suga
 		web.Handlers[path] = &ipn.HTTPHandler{
 			Proxy: proto + svc.Spec.ClusterIP + ":" + fmt.Sprint(port) + path,
 		}
+		backends = append(backends, &svc)
 	}
 	addIngressBackend(ing.Spec.DefaultBackend, "/")
 	for _, rule := range ing.Spec.Rules {
@@ -207,6 +217,14 @@ func (a *IngressReconciler) maybeProvision(ctx context.Context, logger *zap.Suga
 	if tstr, ok := ing.Annotations[AnnotationTags]; ok {
 		tags = strings.Split(tstr, ",")
 	}
+	acceptDNS, searchDomains, err := proxyDNSConfig(ing.Annotations)
+	if err != nil {
+		return err
+	}
+	certSecret, err := certSecretName(ing.Annotations)
+	if err != nil {
+		return err
+	}
 	hostname := ing.Namespace + "-" + ing.Name + "-ingress"
 	if ing.Spec.TLS != nil && len(ing.Spec.TLS) > 0 && len(ing.Spec.TLS[0].Hosts) > 0 {
 		hostname, _, _ = strings.Cut(ing.Spec.TLS[0].Hosts[0], ".")
@@ -219,12 +237,21 @@ func (a *IngressReconciler) maybeProvision(ctx context.Context, logger *zap.Suga
 		ServeConfig:         sc,
 		Tags:                tags,
 		ChildResourceLabels: crl,
+		AcceptDNS:           acceptDNS,
+		DNSSearchDomains:    searchDomains,
+		FetchCert:           certSecret != "",
+		Tailnet:             tailnet,
+		ProxiedServices:     backends,
 	}
 
 	if _, err := a.ssr.Provision(ctx, logger, sts); err != nil {
 		return fmt.Errorf("failed to provision: %w", err)
 	}
 
+	if err := a.ssr.reconcileCertSecret(ctx, logger, ing, crl, certSecret); err != nil {
+		return err
+	}
+
 	_, tsHost, _, err := a.ssr.DeviceInfo(ctx, crl)
 	if err != nil {
 		return fmt.Errorf("failed to get device ID: %w", err)
@@ -0,0 +1,156 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !plan9
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+)
+
+// migration is an in-place update of the resources of an older operator
+// installation to the scheme of the current one. Migrations must not
+// recreate proxies, so that their tailnet devices are kept.
+type migration struct {
+	name string
+	// run applies the migration, or only finds what it would change if
+	// dryRun is set, and returns a description of each change.
+	run func(ctx context.Context, cl client.Client, operatorNamespace string, dryRun bool) ([]string, error)
+}
+
+// migrations are the migrations run by 'k8s-operator migrate', in order.
+var migrations = []migration{
+	{"deprecated tailnet target IP annotation", migrateTailnetTargetIPAnnotation},
+	{"parent type labels", migrateParentTypeLabels},
+}
+
+// runMigrate implements 'k8s-operator migrate', which updates the resources
+// of an older operator installation to the current scheme and prints a
+// report of the changes. It's safe to run repeatedly, and before or after
+// the operator is upgraded.
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "only report the changes that would be made")
+	namespace := fs.String("namespace", defaultEnv("OPERATOR_NAMESPACE", "tailscale"), "namespace of the operator")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %q", fs.Args())
+	}
+
+	cl, err := client.New(config.GetConfigOrDie(), client.Options{})
+	if err != nil {
+		return fmt.Errorf("creating client: %w", err)
+	}
+	return migrate(context.Background(), os.Stdout, cl, *namespace, *dryRun)
+}
+
+// migrate runs all migrations against the installation of the operator in
+// operatorNamespace, and writes a report to w.
+func migrate(ctx context.Context, w io.Writer, cl client.Client, operatorNamespace string, dryRun bool) error {
+	if dryRun {
+		fmt.Fprintf(w, "Dry run, no changes will be made.\n")
+	}
+	total := 0
+	for _, m := range migrations {
+		changes, err := m.run(ctx, cl, operatorNamespace, dryRun)
+		if err != nil {
+			return fmt.Errorf("migrating %s: %w", m.name, err)
+		}
+		fmt.Fprintf(w, "%s: %d change(s)\n", m.name, len(changes))
+		for _, c := range changes {
+			fmt.Fprintf(w, "  %s\n", c)
+		}
+		total += len(changes)
+	}
+	if total == 0 {
+		fmt.Fprintf(w, "Nothing to migrate.\n")
+	}
+	return nil
+}
+
+// migrateTailnetTargetIPAnnotation replaces the deprecated
+// tailscale.com/ts-tailnet-target-ip annotation of Services with
+// tailscale.com/tailnet-ip. As the target IP is unchanged, egress proxies
+// aren't restarted.
+func migrateTailnetTargetIPAnnotation(ctx context.Context, cl client.Client, _ string, dryRun bool) ([]string, error) {
+	svcs := new(corev1.ServiceList)
+	if err := cl.List(ctx, svcs); err != nil {
+		return nil, fmt.Errorf("listing services: %w", err)
+	}
+	var changes []string
+	for i := range svcs.Items {
+		svc := &svcs.Items[i]
+		old, ok := svc.Annotations[annotationTailnetTargetIPOld]
+		if !ok {
+			continue
+		}
+		orig := svc.DeepCopy()
+		var change string
+		if svc.Annotations[AnnotationTailnetTargetIP] == "" {
+			svc.Annotations[AnnotationTailnetTargetIP] = old
+			change = fmt.Sprintf("Service %s/%s: renamed annotation %s to %s", svc.Namespace, svc.Name, annotationTailnetTargetIPOld, AnnotationTailnetTargetIP)
+		} else {
+			change = fmt.Sprintf("Service %s/%s: removed annotation %s, superseded by %s", svc.Namespace, svc.Name, annotationTailnetTargetIPOld, AnnotationTailnetTargetIP)
+		}
+		delete(svc.Annotations, annotationTailnetTargetIPOld)
+		if !dryRun {
+			if err := cl.Patch(ctx, svc, client.MergeFrom(orig)); err != nil {
+				return changes, fmt.Errorf("updating Service %s/%s: %w", svc.Namespace, svc.Name, err)
+			}
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// migrateParentTypeLabels adds the parent type label to the managed resources
+// that lack it. These predate Ingress support, so their parent is a Service.
+// Without the label, the operator can't find them to update or clean them
+// up.
+func migrateParentTypeLabels(ctx context.Context, cl client.Client, operatorNamespace string, dryRun bool) ([]string, error) {
+	objs, err := listManagedResources(ctx, cl, operatorNamespace)
+	if err != nil {
+		return nil, err
+	}
+	var changes []string
+	for _, o := range objs {
+		if _, ok := o.GetLabels()[LabelParentType]; ok {
+			continue
+		}
+		orig := o.DeepCopyObject().(client.Object)
+		ls := o.GetLabels()
+		ls[LabelParentType] = "svc"
+		o.SetLabels(ls)
+		if !dryRun {
+			if err := cl.Patch(ctx, o, client.MergeFrom(orig)); err != nil {
+				return changes, fmt.Errorf("updating %s %s/%s: %w", kindOf(o), o.GetNamespace(), o.GetName(), err)
+			}
+		}
+		changes = append(changes, fmt.Sprintf("%s %s/%s: added label %s=svc", kindOf(o), o.GetNamespace(), o.GetName(), LabelParentType))
+	}
+	return changes, nil
+}
+
+// kindOf returns the kind of the operator-managed resource o, whose TypeMeta
+// isn't set when listed.
+func kindOf(o client.Object) string {
+	switch o.(type) {
+	case *appsv1.StatefulSet:
+		return "StatefulSet"
+	case *corev1.Secret:
+		return "Secret"
+	case *corev1.Service:
+		return "Service"
+	}
+	return fmt.Sprintf("%T", o)
+}
@@ -0,0 +1,113 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !plan9
+
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestMigrate(t *testing.T) {
+	fc := fake.NewFakeClient()
+	mustCreate(t, fc, &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "egress",
+			Namespace:   "default",
+			Annotations: map[string]string{annotationTailnetTargetIPOld: "100.99.99.99"},
+		},
+	})
+	mustCreate(t, fc, &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "egress-both",
+			Namespace: "default",
+			Annotations: map[string]string{
+				annotationTailnetTargetIPOld: "100.99.99.98",
+				AnnotationTailnetTargetIP:    "100.99.99.97",
+			},
+		},
+	})
+	legacyLabels := map[string]string{
+		LabelManaged:         "true",
+		LabelParentName:      "test",
+		LabelParentNamespace: "default",
+	}
+	mustCreate(t, fc, &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "ts-test-abcde", Namespace: "operator-ns", Labels: legacyLabels},
+	})
+	mustCreate(t, fc, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "ts-test-abcde-0", Namespace: "operator-ns", Labels: legacyLabels},
+	})
+	mustCreate(t, fc, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "ts-ing-fghij-0", Namespace: "operator-ns", Labels: childResourceLabels("ing", "default", "ingress")},
+	})
+
+	// A dry run reports the changes without making them.
+	var report strings.Builder
+	if err := migrate(context.Background(), &report, fc, "operator-ns", true); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"Service default/egress: renamed annotation",
+		"Service default/egress-both: removed annotation",
+		"StatefulSet operator-ns/ts-test-abcde: added label",
+		"Secret operator-ns/ts-test-abcde-0: added label",
+	} {
+		if !strings.Contains(report.String(), want) {
+			t.Errorf("dry run report lacks %q:\n%s", want, report.String())
+		}
+	}
+	if strings.Contains(report.String(), "ts-ing-fghij-0") {
+		t.Errorf("dry run report mentions an up to date resource:\n%s", report.String())
+	}
+	if got := getService(t, fc, "default", "egress").Annotations; got[annotationTailnetTargetIPOld] == "" {
+		t.Errorf("dry run changed annotations: %v", got)
+	}
+
+	report.Reset()
+	if err := migrate(context.Background(), &report, fc, "operator-ns", false); err != nil {
+		t.Fatal(err)
+	}
+	if got := getService(t, fc, "default", "egress").Annotations; len(got) != 1 || got[AnnotationTailnetTargetIP] != "100.99.99.99" {
+		t.Errorf("egress annotations = %v", got)
+	}
+	if got := getService(t, fc, "default", "egress-both").Annotations; len(got) != 1 || got[AnnotationTailnetTargetIP] != "100.99.99.97" {
+		t.Errorf("egress-both annotations = %v", got)
+	}
+	wantLabels := childResourceLabels("test", "default", "svc")
+	sts, err := getSingleObject[appsv1.StatefulSet](context.Background(), fc, "operator-ns", wantLabels)
+	if err != nil || sts == nil {
+		t.Errorf("StatefulSet not labeled: %v, %v", sts, err)
+	}
+	sec, err := getSingleObject[corev1.Secret](context.Background(), fc, "operator-ns", wantLabels)
+	if err != nil || sec == nil {
+		t.Errorf("Secret not labeled: %v, %v", sec, err)
+	}
+
+	// Nothing is left to migrate.
+	report.Reset()
+	if err := migrate(context.Background(), &report, fc, "operator-ns", false); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(report.String(), "Nothing to migrate.") {
+		t.Errorf("second migration made changes:\n%s", report.String())
+	}
+}
+
+func getService(t *testing.T, cl client.Client, ns, name string) *corev1.Service {
+	t.Helper()
+	svc := new(corev1.Service)
+	if err := cl.Get(context.Background(), client.ObjectKey{Namespace: ns, Name: name}, svc); err != nil {
+		t.Fatal(err)
+	}
+	return svc
+}
@@ -0,0 +1,183 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !plan9
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"tailscale.com/types/ptr"
+)
+
+// parseClusterCIDRs parses the comma-separated CIDRs of
+// PROXY_NETWORK_POLICY_CLUSTER_CIDRS.
+func parseClusterCIDRs(s string) ([]netip.Prefix, error) {
+	var ret []netip.Prefix
+	for _, c := range strings.Split(s, ",") {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+		p, err := netip.ParsePrefix(c)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, p.Masked())
+	}
+	if len(ret) == 0 {
+		return nil, errors.New("no cluster CIDRs")
+	}
+	return ret, nil
+}
+
+// reconcileNetworkPolicy ensures that the proxy of sts, whose headless
+// Service is hsvc, has a NetworkPolicy that only lets it send traffic to:
+//
+//   - DNS servers,
+//   - the Kubernetes API server, to keep its state in its Secret,
+//   - outside the cluster, for the control server, DERP and its peers, and
+//   - the pods of the Services that it proxies to, on their ports.
+//
+// Anything else in a.proxyNetworkPolicyCIDRs is blocked.
+func (a *tailscaleSTSReconciler) reconcileNetworkPolicy(ctx context.Context, logger *zap.SugaredLogger, sts *tailscaleSTSConfig, hsvc *corev1.Service) error {
+	egress := []networkingv1.NetworkPolicyEgressRule{
+		{
+			Ports: []networkingv1.NetworkPolicyPort{
+				{Protocol: ptr.To(corev1.ProtocolUDP), Port: ptr.To(intstr.FromInt(53))},
+				{Protocol: ptr.To(corev1.ProtocolTCP), Port: ptr.To(intstr.FromInt(53))},
+			},
+		},
+		{To: outsideClusterPeers(a.proxyNetworkPolicyCIDRs)},
+	}
+	apiServer, err := a.endpointsEgressRule(ctx, "default", "kubernetes")
+	if err != nil {
+		return fmt.Errorf("getting API server endpoints: %w", err)
+	}
+	if apiServer != nil {
+		egress = append(egress, *apiServer)
+	}
+	for _, svc := range sts.ProxiedServices {
+		if len(svc.Spec.Selector) == 0 {
+			// The Service's endpoints are managed by hand, so allow
+			// their current addresses.
+			r, err := a.endpointsEgressRule(ctx, svc.Namespace, svc.Name)
+			if err != nil {
+				return fmt.Errorf("getting endpoints of %s/%s: %w", svc.Namespace, svc.Name, err)
+			}
+			if r != nil {
+				egress = append(egress, *r)
+			}
+			continue
+		}
+		egress = append(egress, networkingv1.NetworkPolicyEgressRule{
+			To: []networkingv1.NetworkPolicyPeer{{
+				NamespaceSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{"kubernetes.io/metadata.name": svc.Namespace},
+				},
+				PodSelector: &metav1.LabelSelector{MatchLabels: svc.Spec.Selector},
+			}},
+			Ports: servicePolicyPorts(svc),
+		})
+	}
+
+	np := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      hsvc.Name,
+			Namespace: a.operatorNamespace,
+			Labels:    sts.ChildResourceLabels,
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: map[string]string{"app": sts.ParentResourceUID},
+			},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+			Egress:      egress,
+		},
+	}
+	logger.Debugf("reconciling networkpolicy %s/%s", np.Namespace, np.Name)
+	_, err = createOrUpdate(ctx, a.Client, a.operatorNamespace, np, func(p *networkingv1.NetworkPolicy) { p.Spec = np.Spec })
+	return err
+}
+
+// outsideClusterPeers returns the peers of everywhere but clusterCIDRs.
+func outsideClusterPeers(clusterCIDRs []netip.Prefix) []networkingv1.NetworkPolicyPeer {
+	v4 := &networkingv1.IPBlock{CIDR: "0.0.0.0/0"}
+	v6 := &networkingv1.IPBlock{CIDR: "::/0"}
+	for _, p := range clusterCIDRs {
+		if p.Addr().Is4() {
+			v4.Except = append(v4.Except, p.String())
+		} else {
+			v6.Except = append(v6.Except, p.String())
+		}
+	}
+	return []networkingv1.NetworkPolicyPeer{{IPBlock: v4}, {IPBlock: v6}}
+}
+
+// servicePolicyPorts returns the ports of the pods behind svc.
+func servicePolicyPorts(svc *corev1.Service) []networkingv1.NetworkPolicyPort {
+	var ports []networkingv1.NetworkPolicyPort
+	for _, p := range svc.Spec.Ports {
+		target := p.TargetPort
+		if target.Type == intstr.Int && target.IntVal == 0 {
+			// The API server defaults it to the Service port.
+			target = intstr.FromInt(int(p.Port))
+		}
+		proto := p.Protocol
+		if proto == "" {
+			proto = corev1.ProtocolTCP
+		}
+		ports = append(ports, networkingv1.NetworkPolicyPort{
+			Protocol: ptr.To(proto),
+			Port:     ptr.To(target),
+		})
+	}
+	return ports
+}
+
+// endpointsEgressRule returns the rule that allows traffic to the current
+// endpoints of the Service ns/name, or nil if there are none.
+func (a *tailscaleSTSReconciler) endpointsEgressRule(ctx context.Context, ns, name string) (*networkingv1.NetworkPolicyEgressRule, error) {
+	ep := new(corev1.Endpoints)
+	err := a.apiReader.Get(ctx, client.ObjectKey{Namespace: ns, Name: name}, ep)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var r networkingv1.NetworkPolicyEgressRule
+	for _, ss := range ep.Subsets {
+		for _, addr := range ss.Addresses {
+			ip, err := netip.ParseAddr(addr.IP)
+			if err != nil {
+				continue
+			}
+			r.To = append(r.To, networkingv1.NetworkPolicyPeer{
+				IPBlock: &networkingv1.IPBlock{CIDR: netip.PrefixFrom(ip, ip.BitLen()).String()},
+			})
+		}
+		for _, p := range ss.Ports {
+			r.Ports = append(r.Ports, networkingv1.NetworkPolicyPort{
+				Protocol: ptr.To(p.Protocol),
+				Port:     ptr.To(intstr.FromInt(int(p.Port))),
+			})
+		}
+	}
+	if len(r.To) == 0 {
+		return nil, nil
+	}
+	return &r, nil
+}
@@ -9,6 +9,10 @@
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
 	"os"
 	"strings"
 	"time"
@@ -16,6 +20,7 @@
 	"github.com/go-logr/zapr"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/clientcredentials"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -36,12 +41,22 @@
 	"tailscale.com/hostinfo"
 	"tailscale.com/ipn"
 	"tailscale.com/ipn/store/kubestore"
+	"tailscale.com/kube"
+	"tailscale.com/tailcfg"
 	"tailscale.com/tsnet"
 	"tailscale.com/types/logger"
 	"tailscale.com/version"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "migrate: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Required to use our client API. We're fine with the instability since the
 	// client lives in the same repo as this code.
 	tailscale.I_Acknowledge_This_API_Is_Unstable = true
@@ -52,6 +67,7 @@ func main() {
 		image             = defaultEnv("PROXY_IMAGE", "tailscale/tailscale:latest")
 		priorityClassName = defaultEnv("PROXY_PRIORITY_CLASS_NAME", "")
 		tags              = defaultEnv("PROXY_TAGS", "tag:k8s")
+		tailnetEgress     = defaultBool("OPERATOR_TAILNET_EGRESS", false)
 	)
 
 	var opts []kzap.Opts
@@ -66,17 +82,32 @@ func main() {
 	zlog := kzap.NewRaw(opts...).Sugar()
 	logf.SetLogger(zapr.NewLogger(zlog.Desugar()))
 
-	s, tsClient := initTSNet(zlog)
+	s, tsClient := initTSNet(zlog, tailnetEgress)
 	defer s.Close()
+	var egressClient *http.Client
+	if tailnetEgress {
+		egressClient = s.HTTPClient()
+	}
+	tailnetClients, err := loadTailnetClients(defaultEnv("OPERATOR_TAILNETS_DIR", ""), egressClient)
+	if err != nil {
+		zlog.Fatalf("loading tailnet credentials from OPERATOR_TAILNETS_DIR: %v", err)
+	}
 	restConfig := config.GetConfigOrDie()
 	maybeLaunchAPIServerProxy(zlog, restConfig, s)
-	runReconcilers(zlog, s, tsNamespace, restConfig, tsClient, image, priorityClassName, tags)
+	runReconcilers(zlog, s, tsNamespace, restConfig, tsClient, tailnetClients, image, priorityClassName, tags, tailnetEgress)
 }
 
 // initTSNet initializes the tsnet.Server and logs in to Tailscale. It uses the
 // CLIENT_ID_FILE and CLIENT_SECRET_FILE environment variables to authenticate
 // with Tailscale.
-func initTSNet(zlog *zap.SugaredLogger) (*tsnet.Server, *tailscale.Client) {
+//
+// If tailnetEgress is true, requests to the Tailscale API are sent over the
+// tailnet where it routes their destination, such as through a subnet router
+// advertising a route to the API, so that the cluster needs no public egress
+// other than to the control server and DERP. As the API can't then be used
+// to create the operator's own auth key before it joins the tailnet,
+// OPERATOR_AUTH_KEY_FILE can provide one.
+func initTSNet(zlog *zap.SugaredLogger, tailnetEgress bool) (*tsnet.Server, *tailscale.Client) {
 	hostinfo.SetApp("k8s-operator")
 	var (
 		clientIDPath     = defaultEnv("CLIENT_ID_FILE", "")
@@ -84,6 +115,7 @@ func initTSNet(zlog *zap.SugaredLogger) (*tsnet.Server, *tailscale.Client) {
 		hostname         = defaultEnv("OPERATOR_HOSTNAME", "tailscale-operator")
 		kubeSecret       = defaultEnv("OPERATOR_SECRET", "")
 		operatorTags     = defaultEnv("OPERATOR_INITIAL_TAGS", "tag:k8s-operator")
+		authKeyPath      = defaultEnv("OPERATOR_AUTH_KEY_FILE", "")
 	)
 	startlog := zlog.Named("startup")
 	if clientIDPath == "" || clientSecretPath == "" {
@@ -102,13 +134,16 @@ func initTSNet(zlog *zap.SugaredLogger) (*tsnet.Server, *tailscale.Client) {
 		ClientSecret: string(clientSecret),
 		TokenURL:     "https://login.tailscale.com/api/v2/oauth/token",
 	}
-	tsClient := tailscale.NewClient("-", nil)
-	tsClient.HTTPClient = credentials.Client(context.Background())
-
 	s := &tsnet.Server{
 		Hostname: hostname,
 		Logf:     zlog.Named("tailscaled").Debugf,
 	}
+	var egressClient *http.Client
+	if tailnetEgress {
+		egressClient = s.HTTPClient()
+	}
+	tsClient := tailscale.NewClient("-", nil)
+	tsClient.HTTPClient = apiHTTPClient(credentials, egressClient)
 	if kubeSecret != "" {
 		st, err := kubestore.New(logger.Discard, kubeSecret)
 		if err != nil {
@@ -141,18 +176,30 @@ func initTSNet(zlog *zap.SugaredLogger) (*tsnet.Server, *tailscale.Client) {
 			if loginDone {
 				break
 			}
-			caps := tailscale.KeyCapabilities{
-				Devices: tailscale.KeyDeviceCapabilities{
-					Create: tailscale.KeyDeviceCreateCapabilities{
-						Reusable:      false,
-						Preauthorized: true,
-						Tags:          strings.Split(operatorTags, ","),
+			var authkey string
+			if authKeyPath != "" {
+				b, err := os.ReadFile(authKeyPath)
+				if err != nil {
+					startlog.Fatalf("reading operator authkey %q: %v", authKeyPath, err)
+				}
+				authkey = strings.TrimSpace(string(b))
+			} else {
+				caps := tailscale.KeyCapabilities{
+					Devices: tailscale.KeyDeviceCapabilities{
+						Create: tailscale.KeyDeviceCreateCapabilities{
+							Reusable:      false,
+							Preauthorized: true,
+							Tags:          strings.Split(operatorTags, ","),
+						},
 					},
-				},
-			}
-			authkey, _, err := tsClient.CreateKey(ctx, caps)
-			if err != nil {
-				startlog.Fatalf("creating operator authkey: %v", err)
+				}
+				authkey, _, err = tsClient.CreateKey(ctx, caps)
+				if err != nil {
+					if tailnetEgress {
+						startlog.Fatalf("creating operator authkey: %v; set OPERATOR_AUTH_KEY_FILE if the Tailscale API is only reachable over the tailnet", err)
+					}
+					startlog.Fatalf("creating operator authkey: %v", err)
+				}
 			}
 			if err := lc.Start(ctx, ipn.Options{
 				AuthKey: authkey,
@@ -174,14 +221,88 @@ func initTSNet(zlog *zap.SugaredLogger) (*tsnet.Server, *tailscale.Client) {
 		}
 		time.Sleep(time.Second)
 	}
+
+	st, err := lc.StatusWithoutPeers(ctx)
+	if err != nil {
+		startlog.Fatalf("getting status: %v", err)
+	}
+	startlog.Infof("Operator is on the tailnet as %s (%v), tailnet egress: %v", st.Self.DNSName, st.TailscaleIPs, tailnetEgress)
+	if kubeSecret != "" {
+		kc, err := kube.New()
+		if err == nil {
+			err = storeOperatorDeviceInfo(ctx, kc, kubeSecret, st.Self.ID, st.Self.DNSName, st.TailscaleIPs)
+		}
+		if err != nil {
+			startlog.Warnf("storing operator device info in Secret %q: %v", kubeSecret, err)
+		}
+	}
 	return s, tsClient
 }
 
+// apiHTTPClient returns the HTTP client for the Tailscale API, which
+// authenticates with the OAuth client credentials. If egressClient is
+// non-nil, both the token and API requests are sent with it, such as the
+// tsnet HTTP client, which dials over the tailnet if the destination is
+// routed there and over the cluster network otherwise.
+func apiHTTPClient(credentials clientcredentials.Config, egressClient *http.Client) *http.Client {
+	ctx := context.Background()
+	if egressClient != nil {
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, egressClient)
+	}
+	return credentials.Client(ctx)
+}
+
+// secretPatcher is the subset of kube.Client used to update the
+// operator's state Secret.
+type secretPatcher interface {
+	StrategicMergePatchSecret(ctx context.Context, name string, s *kube.Secret, fieldManager string) error
+}
+
+// storeOperatorDeviceInfo records the operator's own tailnet identity in the
+// "device_id", "device_fqdn" and "device_ips" fields of its state Secret,
+// like the proxies do in theirs.
+func storeOperatorDeviceInfo(ctx context.Context, kc secretPatcher, secretName string, id tailcfg.StableNodeID, fqdn string, ips []netip.Addr) error {
+	ipStrs := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		ipStrs = append(ipStrs, ip.String())
+	}
+	deviceIPs, err := json.Marshal(ipStrs)
+	if err != nil {
+		return err
+	}
+	return kc.StrategicMergePatchSecret(ctx, secretName, &kube.Secret{
+		Data: map[string][]byte{
+			"device_id":   []byte(id),
+			"device_fqdn": []byte(fqdn),
+			"device_ips":  deviceIPs,
+		},
+	}, "tailscale-operator")
+}
+
 // runReconcilers starts the controller-runtime manager and registers the
 // ServiceReconciler. It blocks forever.
-func runReconcilers(zlog *zap.SugaredLogger, s *tsnet.Server, tsNamespace string, restConfig *rest.Config, tsClient *tailscale.Client, image, priorityClassName, tags string) {
+//
+// If tailnetEgress is true, the proxies that the operator manages serve
+// their LocalAPI status over the tailnet to the operator's
+// OPERATOR_INITIAL_TAGS, and the operator checks that they're running
+// before publishing their addresses.
+//
+// If OPERATOR_ROUTES_SELECTOR is set, the RoutesReconciler keeps the routes
+// of the Services it selects in the OPERATOR_ROUTES_SECRET Secret.
+//
+// If PROXY_NETWORK_POLICY_CLUSTER_CIDRS is set to the cluster's pod and
+// service CIDRs, each proxy gets a NetworkPolicy that only lets it reach
+// the cluster destinations it proxies to.
+//
+// Proxies join the operator's tailnet, using tsClient, or the one in
+// tailnetClients that their tailscale.com/tailnet annotation names.
+func runReconcilers(zlog *zap.SugaredLogger, s *tsnet.Server, tsNamespace string, restConfig *rest.Config, tsClient *tailscale.Client, tailnetClients map[string]tsClient, image, priorityClassName, tags string, tailnetEgress bool) {
 	var (
 		isDefaultLoadBalancer = defaultBool("OPERATOR_DEFAULT_LOAD_BALANCER", false)
+		operatorTags          = defaultEnv("OPERATOR_INITIAL_TAGS", "tag:k8s-operator")
+		routesSelector        = defaultEnv("OPERATOR_ROUTES_SELECTOR", "")
+		routesSecret          = defaultEnv("OPERATOR_ROUTES_SECRET", "tailscale-routes")
+		netpolCIDRs           = defaultEnv("PROXY_NETWORK_POLICY_CLUSTER_CIDRS", "")
 	)
 	startlog := zlog.Named("startReconcilers")
 	// For secrets and statefulsets, we only get permission to touch the objects
@@ -196,8 +317,9 @@ func runReconcilers(zlog *zap.SugaredLogger, s *tsnet.Server, tsNamespace string
 	mgr, err := manager.New(restConfig, manager.Options{
 		Cache: cache.Options{
 			ByObject: map[client.Object]cache.ByObject{
-				&corev1.Secret{}:      nsFilter,
-				&appsv1.StatefulSet{}: nsFilter,
+				&corev1.Secret{}:              nsFilter,
+				&appsv1.StatefulSet{}:         nsFilter,
+				&networkingv1.NetworkPolicy{}: nsFilter,
 			},
 		},
 	})
@@ -210,13 +332,24 @@ func runReconcilers(zlog *zap.SugaredLogger, s *tsnet.Server, tsNamespace string
 	eventRecorder := mgr.GetEventRecorderFor("tailscale-operator")
 	ssr := &tailscaleSTSReconciler{
 		Client:                 mgr.GetClient(),
+		apiReader:              mgr.GetAPIReader(),
 		tsnetServer:            s,
 		tsClient:               tsClient,
+		tailnetClients:         tailnetClients,
 		defaultTags:            strings.Split(tags, ","),
 		operatorNamespace:      tsNamespace,
 		proxyImage:             image,
 		proxyPriorityClassName: priorityClassName,
 	}
+	if tailnetEgress {
+		ssr.proxyLocalAPITags = strings.Split(operatorTags, ",")
+	}
+	if netpolCIDRs != "" {
+		ssr.proxyNetworkPolicyCIDRs, err = parseClusterCIDRs(netpolCIDRs)
+		if err != nil {
+			startlog.Fatalf("invalid PROXY_NETWORK_POLICY_CLUSTER_CIDRS: %v", err)
+		}
+	}
 	err = builder.
 		ControllerManagedBy(mgr).
 		Named("service-reconciler").
@@ -248,6 +381,30 @@ func runReconcilers(zlog *zap.SugaredLogger, s *tsnet.Server, tsNamespace string
 	if err != nil {
 		startlog.Fatalf("could not create controller: %v", err)
 	}
+	if routesSelector != "" {
+		selectors, err := parseLabelSelectors(routesSelector)
+		if err != nil {
+			startlog.Fatalf("invalid OPERATOR_ROUTES_SELECTOR: %v", err)
+		}
+		err = builder.
+			ControllerManagedBy(mgr).
+			Named("routes-reconciler").
+			For(&corev1.Service{}).
+			Watches(&corev1.Endpoints{}, &handler.EnqueueRequestForObject{}).
+			Complete(newRoutesReconciler(mgr.GetClient(), zlog.Named("routes-reconciler"), selectors, tsNamespace, routesSecret))
+		if err != nil {
+			startlog.Fatalf("could not create controller: %v", err)
+		}
+	}
+	err = mgr.Add(&orphanSweeper{
+		Client:   mgr.GetClient(),
+		ssr:      ssr,
+		recorder: eventRecorder,
+		logger:   zlog.Named("orphan-sweeper"),
+	})
+	if err != nil {
+		startlog.Fatalf("could not add orphan sweeper: %v", err)
+	}
 
 	startlog.Infof("Startup complete, operator running, version: %s", version.Long())
 	if err := mgr.Start(signals.SetupSignalHandler()); err != nil {
@@ -7,14 +7,23 @@
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"go.uber.org/zap"
+	"golang.org/x/oauth2/clientcredentials"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
@@ -24,6 +33,8 @@
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"tailscale.com/client/tailscale"
+	"tailscale.com/ipn/ipnstate"
+	"tailscale.com/kube"
 	"tailscale.com/types/ptr"
 )
 
@@ -768,6 +779,226 @@ func TestCustomPriorityClassName(t *testing.T) {
 	expectEqual(t, fc, expectedSTS(shortName, fullName, "custom-priority-class-name", "tailscale-critical"))
 }
 
+func TestProxyDNSConfig(t *testing.T) {
+	fc := fake.NewFakeClient()
+	ft := &fakeTSClient{}
+	zl, err := zap.NewDevelopment()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sr := &ServiceReconciler{
+		Client: fc,
+		ssr: &tailscaleSTSReconciler{
+			Client:            fc,
+			tsClient:          ft,
+			defaultTags:       []string{"tag:k8s"},
+			operatorNamespace: "operator-ns",
+			proxyImage:        "tailscale/tailscale",
+		},
+		logger: zl.Sugar(),
+	}
+
+	mustCreate(t, fc, &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: "default",
+			UID:       types.UID("1234-UID"),
+			Annotations: map[string]string{
+				"tailscale.com/expose":             "true",
+				"tailscale.com/accept-dns":         "false",
+				"tailscale.com/dns-search-domains": "corp.example.com, example.net",
+			},
+		},
+		Spec: corev1.ServiceSpec{
+			ClusterIP: "10.20.30.40",
+			Type:      corev1.ServiceTypeClusterIP,
+		},
+	})
+
+	expectReconciled(t, sr, "default", "test")
+
+	fullName, shortName := findGenName(t, fc, "default", "test")
+	want := expectedSTS(shortName, fullName, "default-test", "")
+	c := &want.Spec.Template.Spec.Containers[0]
+	c.Env = append(c.Env, corev1.EnvVar{Name: "TS_ACCEPT_DNS", Value: "false"})
+	want.Spec.Template.Spec.DNSConfig = &corev1.PodDNSConfig{
+		Searches: []string{"corp.example.com", "example.net"},
+	}
+	expectEqual(t, fc, want)
+
+	// Invalid annotations fail the reconcile.
+	mustUpdate(t, fc, "default", "test", func(s *corev1.Service) {
+		s.Annotations["tailscale.com/accept-dns"] = "maybe"
+	})
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "test"}}
+	if _, err := sr.Reconcile(context.Background(), req); err == nil {
+		t.Error("reconcile succeeded with invalid accept-dns annotation")
+	}
+	mustUpdate(t, fc, "default", "test", func(s *corev1.Service) {
+		s.Annotations["tailscale.com/accept-dns"] = "true"
+		s.Annotations["tailscale.com/dns-search-domains"] = "not a domain"
+	})
+	if _, err := sr.Reconcile(context.Background(), req); err == nil {
+		t.Error("reconcile succeeded with invalid search domain")
+	}
+}
+
+func TestCertSecret(t *testing.T) {
+	fc := fake.NewFakeClient()
+	ft := &fakeTSClient{}
+	zl, err := zap.NewDevelopment()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sr := &ServiceReconciler{
+		Client: fc,
+		ssr: &tailscaleSTSReconciler{
+			Client:            fc,
+			apiReader:         fc,
+			tsClient:          ft,
+			defaultTags:       []string{"tag:k8s"},
+			operatorNamespace: "operator-ns",
+			proxyImage:        "tailscale/tailscale",
+		},
+		logger: zl.Sugar(),
+	}
+
+	mustCreate(t, fc, &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: "default",
+			UID:       types.UID("1234-UID"),
+			Annotations: map[string]string{
+				"tailscale.com/expose":      "true",
+				"tailscale.com/cert-secret": "test-tls",
+			},
+		},
+		Spec: corev1.ServiceSpec{
+			ClusterIP: "10.20.30.40",
+			Type:      corev1.ServiceTypeClusterIP,
+		},
+	})
+
+	expectReconciled(t, sr, "default", "test")
+
+	fullName, shortName := findGenName(t, fc, "default", "test")
+	want := expectedSTS(shortName, fullName, "default-test", "")
+	c := &want.Spec.Template.Spec.Containers[0]
+	c.Env = append(c.Env, corev1.EnvVar{Name: "TS_CERT_FETCH", Value: "true"})
+	expectEqual(t, fc, want)
+	// The proxy hasn't got its cert yet.
+	expectMissing[corev1.Secret](t, fc, "default", "test-tls")
+
+	setCert := func(cert string) {
+		mustUpdate(t, fc, "operator-ns", fullName, func(s *corev1.Secret) {
+			if s.Data == nil {
+				s.Data = map[string][]byte{}
+			}
+			s.Data["device_id"] = []byte("ts-id-1234")
+			s.Data["device_fqdn"] = []byte("tailscale.device.name.")
+			s.Data["tailscale.device.name.crt"] = []byte(cert)
+			s.Data["tailscale.device.name.key"] = []byte("key-pem")
+		})
+	}
+	wantSecret := func(name, cert string) *corev1.Secret {
+		return &corev1.Secret{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "Secret",
+				APIVersion: "v1",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion: "v1",
+					Kind:       "Service",
+					Name:       "test",
+					UID:        "1234-UID",
+					Controller: ptr.To(true),
+				}},
+			},
+			Type: corev1.SecretTypeTLS,
+			Data: map[string][]byte{
+				"tls.crt": []byte(cert),
+				"tls.key": []byte("key-pem"),
+			},
+		}
+	}
+	setCert("cert-pem")
+	expectReconciled(t, sr, "default", "test")
+	expectEqual(t, fc, wantSecret("test-tls", "cert-pem"))
+
+	// Renewals are exported too.
+	setCert("renewed-cert-pem")
+	expectReconciled(t, sr, "default", "test")
+	expectEqual(t, fc, wantSecret("test-tls", "renewed-cert-pem"))
+
+	// Changing the annotation moves the cert to the new Secret.
+	mustUpdate(t, fc, "default", "test", func(s *corev1.Service) {
+		s.Annotations["tailscale.com/cert-secret"] = "other-tls"
+	})
+	expectReconciled(t, sr, "default", "test")
+	expectMissing[corev1.Secret](t, fc, "default", "test-tls")
+	expectEqual(t, fc, wantSecret("other-tls", "renewed-cert-pem"))
+
+	// Secrets that the operator didn't create are neither overwritten nor
+	// deleted.
+	mustCreate(t, fc, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "user-tls",
+			Namespace: "default",
+		},
+		Data: map[string][]byte{"user": []byte("data")},
+	})
+	userSecret := &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Secret",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "user-tls",
+			Namespace: "default",
+		},
+		Data: map[string][]byte{"user": []byte("data")},
+	}
+	mustUpdate(t, fc, "default", "test", func(s *corev1.Service) {
+		s.Annotations["tailscale.com/cert-secret"] = "user-tls"
+	})
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "test"}}
+	if _, err := sr.Reconcile(context.Background(), req); err == nil {
+		t.Error("reconcile succeeded with cert-secret annotation naming a foreign Secret")
+	}
+	expectMissing[corev1.Secret](t, fc, "default", "other-tls")
+	expectEqual(t, fc, userSecret)
+	mustUpdate(t, fc, "default", "test", func(s *corev1.Service) {
+		delete(s.Annotations, "tailscale.com/cert-secret")
+	})
+	expectReconciled(t, sr, "default", "test")
+	expectEqual(t, fc, userSecret)
+
+	// Unexposing the Service deletes the exported Secret.
+	mustUpdate(t, fc, "default", "test", func(s *corev1.Service) {
+		s.Annotations["tailscale.com/cert-secret"] = "test-tls"
+	})
+	expectReconciled(t, sr, "default", "test")
+	expectEqual(t, fc, wantSecret("test-tls", "renewed-cert-pem"))
+	mustUpdate(t, fc, "default", "test", func(s *corev1.Service) {
+		delete(s.Annotations, "tailscale.com/expose")
+	})
+	expectReconciled(t, sr, "default", "test")
+	expectReconciled(t, sr, "default", "test")
+	expectMissing[corev1.Secret](t, fc, "default", "test-tls")
+
+	// Invalid Secret names fail the reconcile.
+	mustUpdate(t, fc, "default", "test", func(s *corev1.Service) {
+		s.Annotations["tailscale.com/expose"] = "true"
+		s.Annotations["tailscale.com/cert-secret"] = "Not_A_Name"
+	})
+	if _, err := sr.Reconcile(context.Background(), req); err == nil {
+		t.Error("reconcile succeeded with invalid cert-secret annotation")
+	}
+}
+
 func TestDefaultLoadBalancer(t *testing.T) {
 	fc := fake.NewFakeClient()
 	ft := &fakeTSClient{}
@@ -1162,3 +1393,193 @@ func (c *fakeTSClient) Deleted() []string {
 	defer c.Unlock()
 	return c.deleted
 }
+
+func TestProxyStatusOverTailnet(t *testing.T) {
+	var backendState atomic.Value
+	backendState.Store("Starting")
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/localapi/v0/status" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(&ipnstate.Status{BackendState: backendState.Load().(string)})
+	}))
+	defer ts.Close()
+
+	fc := fake.NewFakeClient()
+	ft := &fakeTSClient{}
+	zl, err := zap.NewDevelopment()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dialed []string
+	sr := &ServiceReconciler{
+		Client: fc,
+		ssr: &tailscaleSTSReconciler{
+			Client:            fc,
+			tsClient:          ft,
+			defaultTags:       []string{"tag:k8s"},
+			operatorNamespace: "operator-ns",
+			proxyImage:        "tailscale/tailscale",
+			proxyLocalAPITags: []string{"tag:k8s-operator"},
+			tailnetDial: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				dialed = append(dialed, addr)
+				var d net.Dialer
+				return d.DialContext(ctx, "tcp", ts.Listener.Addr().String())
+			},
+		},
+		logger: zl.Sugar(),
+	}
+	mustCreate(t, fc, &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: "default",
+			UID:       types.UID("1234-UID"),
+		},
+		Spec: corev1.ServiceSpec{
+			ClusterIP:         "10.20.30.40",
+			Type:              corev1.ServiceTypeLoadBalancer,
+			LoadBalancerClass: ptr.To("tailscale"),
+		},
+	})
+	expectReconciled(t, sr, "default", "test")
+	fullName, shortName := findGenName(t, fc, "default", "test")
+	wantSTS := expectedSTS(shortName, fullName, "default-test", "")
+	wantSTS.Spec.Template.Spec.Containers[0].Env = append(wantSTS.Spec.Template.Spec.Containers[0].Env,
+		corev1.EnvVar{Name: "TS_TAILNET_LOCALAPI_PORT", Value: "41113"},
+		corev1.EnvVar{Name: "TS_TAILNET_LOCALAPI_TAGS", Value: "tag:k8s-operator"},
+	)
+	expectEqual(t, fc, wantSTS)
+	if len(dialed) != 0 {
+		t.Fatalf("dialed %v before the proxy has an IP", dialed)
+	}
+
+	mustUpdate(t, fc, "operator-ns", fullName, func(s *corev1.Secret) {
+		if s.Data == nil {
+			s.Data = map[string][]byte{}
+		}
+		s.Data["device_id"] = []byte("ts-id-1234")
+		s.Data["device_fqdn"] = []byte("tailscale.device.name.")
+		s.Data["device_ips"] = []byte(`["100.99.98.97"]`)
+	})
+
+	// The proxy's Secret is filled in, but it reports that it's not
+	// running yet, so its addresses aren't published.
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "test"}}
+	if _, err := sr.Reconcile(context.Background(), req); err == nil {
+		t.Fatal("Reconcile succeeded with the proxy not running")
+	}
+	if want := []string{"100.99.98.97:41113"}; !reflect.DeepEqual(dialed, want) {
+		t.Fatalf("dialed %v; want %v", dialed, want)
+	}
+	svc := new(corev1.Service)
+	if err := fc.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "test"}, svc); err != nil {
+		t.Fatal(err)
+	}
+	if len(svc.Status.LoadBalancer.Ingress) != 0 {
+		t.Fatalf("ingress = %v; want none", svc.Status.LoadBalancer.Ingress)
+	}
+
+	backendState.Store("Running")
+	expectReconciled(t, sr, "default", "test")
+	if err := fc.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "test"}, svc); err != nil {
+		t.Fatal(err)
+	}
+	want := []corev1.LoadBalancerIngress{{Hostname: "tailscale.device.name"}, {IP: "100.99.98.97"}}
+	if !reflect.DeepEqual(svc.Status.LoadBalancer.Ingress, want) {
+		t.Fatalf("ingress = %v; want %v", svc.Status.LoadBalancer.Ingress, want)
+	}
+
+	// If the proxy can't be reached, the operator goes by its Secret.
+	ts.Close()
+	expectReconciled(t, sr, "default", "test")
+}
+
+type countingTransport struct {
+	n atomic.Int32
+}
+
+func (c *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	c.n.Add(1)
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestAPIHTTPClient(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"access_token":"tok","token_type":"Bearer","expires_in":3600}`)
+		case "/api":
+			io.WriteString(w, r.Header.Get("Authorization"))
+		}
+	}))
+	defer ts.Close()
+	credentials := clientcredentials.Config{
+		ClientID:     "id",
+		ClientSecret: "secret",
+		TokenURL:     ts.URL + "/token",
+	}
+
+	for _, egress := range []bool{false, true} {
+		t.Run(fmt.Sprintf("egress=%v", egress), func(t *testing.T) {
+			tr := new(countingTransport)
+			var egressClient *http.Client
+			if egress {
+				egressClient = &http.Client{Transport: tr}
+			}
+			c := apiHTTPClient(credentials, egressClient)
+			res, err := c.Get(ts.URL + "/api")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			b, err := io.ReadAll(res.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := string(b), "Bearer tok"; got != want {
+				t.Errorf("Authorization = %q; want %q", got, want)
+			}
+			// With tailnet egress, both the token and the API request go
+			// through the egress client.
+			wantN := int32(0)
+			if egress {
+				wantN = 2
+			}
+			if got := tr.n.Load(); got != wantN {
+				t.Errorf("egress client sent %d requests; want %d", got, wantN)
+			}
+		})
+	}
+}
+
+type fakeSecretPatcher struct {
+	name         string
+	secret       *kube.Secret
+	fieldManager string
+}
+
+func (f *fakeSecretPatcher) StrategicMergePatchSecret(ctx context.Context, name string, s *kube.Secret, fieldManager string) error {
+	f.name, f.secret, f.fieldManager = name, s, fieldManager
+	return nil
+}
+
+func TestStoreOperatorDeviceInfo(t *testing.T) {
+	kc := new(fakeSecretPatcher)
+	ips := []netip.Addr{netip.MustParseAddr("100.64.0.1"), netip.MustParseAddr("fd7a:115c:a1e0::1")}
+	if err := storeOperatorDeviceInfo(context.Background(), kc, "operator", "nodeid", "operator.tails.ts.net.", ips); err != nil {
+		t.Fatal(err)
+	}
+	if kc.name != "operator" || kc.fieldManager != "tailscale-operator" {
+		t.Errorf("patched Secret %q as %q; want %q as %q", kc.name, kc.fieldManager, "operator", "tailscale-operator")
+	}
+	want := map[string][]byte{
+		"device_id":   []byte("nodeid"),
+		"device_fqdn": []byte("operator.tails.ts.net."),
+		"device_ips":  []byte(`["100.64.0.1","fd7a:115c:a1e0::1"]`),
+	}
+	if diff := cmp.Diff(want, kc.secret.Data); diff != "" {
+		t.Errorf("Secret data mismatch (-want +got):\n%s", diff)
+	}
+}
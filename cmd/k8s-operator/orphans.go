@@ -0,0 +1,177 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !plan9
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"tailscale.com/util/clientmetric"
+)
+
+const (
+	// orphanSweepInterval is how often the operator looks for resources it
+	// created for a parent that no longer exists.
+	orphanSweepInterval = 10 * time.Minute
+	// orphanCleanupRetryInterval is how soon the operator looks again after
+	// a sweep that left some cleanups unfinished, such as while a
+	// StatefulSet is being deleted.
+	orphanCleanupRetryInterval = 30 * time.Second
+)
+
+// counterOrphansRemoved counts the parent resources whose orphaned child
+// resources were removed.
+var counterOrphansRemoved = clientmetric.NewCounter("k8s_orphaned_resources_removed")
+
+// orphanSweeper periodically removes the resources that the operator created
+// for a Service or Ingress that no longer exists, such as one deleted along
+// with its finalizer while the operator was down, including its tailnet
+// device. It's a manager.Runnable.
+type orphanSweeper struct {
+	client.Client
+
+	ssr      *tailscaleSTSReconciler
+	recorder record.EventRecorder
+	logger   *zap.SugaredLogger
+}
+
+// parentRef identifies the parent resource of operator-managed resources, as
+// recorded in their labels.
+type parentRef struct {
+	typ, namespace, name string
+}
+
+func (p parentRef) String() string {
+	return fmt.Sprintf("%s %s/%s", p.typ, p.namespace, p.name)
+}
+
+// Start runs the sweeper until ctx is done.
+func (s *orphanSweeper) Start(ctx context.Context) error {
+	for {
+		wait := orphanSweepInterval
+		done, err := s.sweep(ctx)
+		if err != nil {
+			s.logger.Errorf("sweeping orphaned resources: %v", err)
+		}
+		if err != nil || !done {
+			wait = orphanCleanupRetryInterval
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+	}
+}
+
+// sweep cleans up the managed resources in the operator namespace whose
+// parent no longer exists. It reports whether all cleanups are complete.
+func (s *orphanSweeper) sweep(ctx context.Context) (done bool, _ error) {
+	children, err := listManagedResources(ctx, s.Client, s.ssr.operatorNamespace)
+	if err != nil {
+		return false, err
+	}
+	orphans := map[parentRef]client.Object{} // to one of the parent's children
+	checked := map[parentRef]bool{}
+	for _, o := range children {
+		ls := o.GetLabels()
+		p := parentRef{ls[LabelParentType], ls[LabelParentNamespace], ls[LabelParentName]}
+		if checked[p] {
+			continue
+		}
+		checked[p] = true
+		exists, err := s.parentExists(ctx, p)
+		if err != nil {
+			return false, fmt.Errorf("getting parent %s: %w", p, err)
+		}
+		if !exists {
+			orphans[p] = o
+		}
+	}
+
+	done = true
+	for p, o := range orphans {
+		logger := s.logger.With("parent-type", p.typ, "parent-ns", p.namespace, "parent-name", p.name)
+		logger.Infof("parent no longer exists, cleaning up its resources")
+		cleaned, err := s.ssr.Cleanup(ctx, logger, childResourceLabels(p.name, p.namespace, p.typ))
+		if err != nil {
+			logger.Errorf("cleaning up orphaned resources: %v", err)
+			done = false
+			continue
+		}
+		if !cleaned {
+			done = false
+			continue
+		}
+		logger.Infof("removed orphaned resources")
+		s.recorder.Eventf(o, corev1.EventTypeNormal, "OrphanedResourcesRemoved", "removed resources of %s, which no longer exists", p)
+		counterOrphansRemoved.Add(1)
+	}
+	return done, nil
+}
+
+// listManagedResources returns the StatefulSets, Secrets and Services in the
+// operator namespace ns that are managed by the operator.
+func listManagedResources(ctx context.Context, cl client.Client, ns string) ([]client.Object, error) {
+	opts := []client.ListOption{
+		client.InNamespace(ns),
+		client.MatchingLabels{LabelManaged: "true"},
+	}
+	var objs []client.Object
+	stss := new(appsv1.StatefulSetList)
+	if err := cl.List(ctx, stss, opts...); err != nil {
+		return nil, fmt.Errorf("listing statefulsets: %w", err)
+	}
+	for i := range stss.Items {
+		objs = append(objs, &stss.Items[i])
+	}
+	secrets := new(corev1.SecretList)
+	if err := cl.List(ctx, secrets, opts...); err != nil {
+		return nil, fmt.Errorf("listing secrets: %w", err)
+	}
+	for i := range secrets.Items {
+		objs = append(objs, &secrets.Items[i])
+	}
+	svcs := new(corev1.ServiceList)
+	if err := cl.List(ctx, svcs, opts...); err != nil {
+		return nil, fmt.Errorf("listing services: %w", err)
+	}
+	for i := range svcs.Items {
+		objs = append(objs, &svcs.Items[i])
+	}
+	return objs, nil
+}
+
+// parentExists reports whether the parent p exists. Parents of unknown types
+// or without a name are assumed to exist, so that their children are left
+// alone.
+func (s *orphanSweeper) parentExists(ctx context.Context, p parentRef) (bool, error) {
+	if p.name == "" {
+		return true, nil
+	}
+	var obj client.Object
+	switch p.typ {
+	case "svc":
+		obj = new(corev1.Service)
+	case "ingress":
+		obj = new(networkingv1.Ingress)
+	default:
+		return true, nil
+	}
+	err := s.Get(ctx, client.ObjectKey{Namespace: p.namespace, Name: p.name}, obj)
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,112 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !plan9
+
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"tailscale.com/types/ptr"
+)
+
+func TestOrphanSweeper(t *testing.T) {
+	fc := fake.NewFakeClient()
+	ft := &fakeTSClient{}
+	zl, err := zap.NewDevelopment()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ssr := &tailscaleSTSReconciler{
+		Client:            fc,
+		tsClient:          ft,
+		defaultTags:       []string{"tag:k8s"},
+		operatorNamespace: "operator-ns",
+		proxyImage:        "tailscale/tailscale",
+	}
+	sr := &ServiceReconciler{
+		Client: fc,
+		ssr:    ssr,
+		logger: zl.Sugar(),
+	}
+	recorder := record.NewFakeRecorder(10)
+	sweeper := &orphanSweeper{
+		Client:   fc,
+		ssr:      ssr,
+		recorder: recorder,
+		logger:   zl.Sugar(),
+	}
+
+	mustCreate(t, fc, &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: "default",
+			UID:       types.UID("1234-UID"),
+		},
+		Spec: corev1.ServiceSpec{
+			ClusterIP:         "10.20.30.40",
+			Type:              corev1.ServiceTypeLoadBalancer,
+			LoadBalancerClass: ptr.To("tailscale"),
+		},
+	})
+	expectReconciled(t, sr, "default", "test")
+	fullName, shortName := findGenName(t, fc, "default", "test")
+	mustUpdate(t, fc, "operator-ns", fullName, func(s *corev1.Secret) {
+		if s.Data == nil {
+			s.Data = map[string][]byte{}
+		}
+		s.Data["device_id"] = []byte("ts-id-1234")
+		s.Data["device_fqdn"] = []byte("tailscale.device.name.")
+	})
+
+	// Nothing to do while the Service exists.
+	if done, err := sweeper.sweep(context.Background()); err != nil || !done {
+		t.Fatalf("sweep = %v, %v; want true, nil", done, err)
+	}
+	expectEqual(t, fc, expectedSTS(shortName, fullName, "default-test", ""))
+
+	// Delete the Service behind the operator's back, finalizer and all.
+	mustUpdate(t, fc, "default", "test", func(s *corev1.Service) {
+		s.Finalizers = nil
+	})
+	if err := fc.Delete(context.Background(), &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first sweep deletes the StatefulSet, the second the rest.
+	if done, err := sweeper.sweep(context.Background()); err != nil || done {
+		t.Fatalf("first sweep = %v, %v; want false, nil", done, err)
+	}
+	expectMissing[appsv1.StatefulSet](t, fc, "operator-ns", shortName)
+	if done, err := sweeper.sweep(context.Background()); err != nil || !done {
+		t.Fatalf("second sweep = %v, %v; want true, nil", done, err)
+	}
+	expectMissing[corev1.Service](t, fc, "operator-ns", shortName)
+	expectMissing[corev1.Secret](t, fc, "operator-ns", fullName)
+	if got := ft.Deleted(); len(got) != 1 || got[0] != "ts-id-1234" {
+		t.Errorf("deleted devices = %q, want [ts-id-1234]", got)
+	}
+	select {
+	case ev := <-recorder.Events:
+		if !strings.Contains(ev, "OrphanedResourcesRemoved") {
+			t.Errorf("unexpected event %q", ev)
+		}
+	default:
+		t.Error("no event recorded")
+	}
+
+	// Nothing is left to clean up.
+	if done, err := sweeper.sweep(context.Background()); err != nil || !done {
+		t.Fatalf("final sweep = %v, %v; want true, nil", done, err)
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !plan9
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"tailscale.com/kube"
+	"tailscale.com/util/mak"
+)
+
+// RoutesReconciler advertises the cluster IPs of the Services matching a
+// set of label selectors, and the IPs of their endpoints, as subnet routes.
+// It keeps them in the "routes" key of a Secret, which a subnet router
+// mounts as its TS_ROUTES_FILE.
+type RoutesReconciler struct {
+	client.Client
+	logger *zap.SugaredLogger
+	mapper *kube.RouteMapper
+
+	mu     sync.Mutex // protects following
+	primed bool       // whether mapper holds all matching objects
+}
+
+// newRoutesReconciler returns a RoutesReconciler for the Services matching
+// any of selectors, which advertises their routes in the Secret
+// namespace/name.
+func newRoutesReconciler(c client.Client, logger *zap.SugaredLogger, selectors []kube.LabelSelector, namespace, name string) *RoutesReconciler {
+	return &RoutesReconciler{
+		Client: c,
+		logger: logger,
+		mapper: &kube.RouteMapper{
+			Selectors: selectors,
+			Target:    &secretRoutes{Client: c, namespace: namespace, name: name},
+		},
+	}
+}
+
+// Reconcile updates the routes of the Service named in req and its
+// Endpoints, and advertises the result if it changed.
+func (r *RoutesReconciler) Reconcile(ctx context.Context, req reconcile.Request) (_ reconcile.Result, err error) {
+	logger := r.logger.With("service-ns", req.Namespace, "service-name", req.Name)
+	logger.Debugf("starting reconcile")
+	defer logger.Debugf("reconcile finished")
+
+	if err := r.prime(ctx); err != nil {
+		return reconcile.Result{}, err
+	}
+	svc := new(corev1.Service)
+	if err := r.Get(ctx, req.NamespacedName, svc); apierrors.IsNotFound(err) {
+		r.mapper.DeleteService(req.Namespace, req.Name)
+	} else if err != nil {
+		return reconcile.Result{}, fmt.Errorf("failed to get svc: %w", err)
+	} else {
+		r.mapper.UpdateService(kubeService(svc))
+	}
+	ep := new(corev1.Endpoints)
+	if err := r.Get(ctx, req.NamespacedName, ep); apierrors.IsNotFound(err) {
+		r.mapper.DeleteEndpoints(req.Namespace, req.Name)
+	} else if err != nil {
+		return reconcile.Result{}, fmt.Errorf("failed to get endpoints: %w", err)
+	} else {
+		r.mapper.UpdateEndpoints(kubeEndpoints(ep))
+	}
+	if err := r.mapper.Sync(ctx); err != nil {
+		return reconcile.Result{}, fmt.Errorf("failed to advertise routes: %w", err)
+	}
+	return reconcile.Result{}, nil
+}
+
+// prime feeds r.mapper all the matching Services and Endpoints before the
+// first routes are advertised, so that the subnet router isn't briefly
+// given only those of the first Service reconciled after a restart.
+func (r *RoutesReconciler) prime(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.primed {
+		return nil
+	}
+	for _, sel := range r.mapper.Selectors {
+		var svcs corev1.ServiceList
+		if err := r.List(ctx, &svcs, client.MatchingLabels(sel)); err != nil {
+			return fmt.Errorf("failed to list services: %w", err)
+		}
+		for i := range svcs.Items {
+			r.mapper.UpdateService(kubeService(&svcs.Items[i]))
+		}
+		var eps corev1.EndpointsList
+		if err := r.List(ctx, &eps, client.MatchingLabels(sel)); err != nil {
+			return fmt.Errorf("failed to list endpoints: %w", err)
+		}
+		for i := range eps.Items {
+			r.mapper.UpdateEndpoints(kubeEndpoints(&eps.Items[i]))
+		}
+	}
+	r.primed = true
+	return nil
+}
+
+// kubeObjectMeta converts m to the subset of it that package kube uses.
+func kubeObjectMeta(m metav1.ObjectMeta) kube.ObjectMeta {
+	return kube.ObjectMeta{
+		Name:      m.Name,
+		Namespace: m.Namespace,
+		Labels:    m.Labels,
+	}
+}
+
+func kubeService(svc *corev1.Service) *kube.Service {
+	return &kube.Service{
+		ObjectMeta: kubeObjectMeta(svc.ObjectMeta),
+		Spec: kube.ServiceSpec{
+			Type:       string(svc.Spec.Type),
+			ClusterIP:  svc.Spec.ClusterIP,
+			ClusterIPs: svc.Spec.ClusterIPs,
+		},
+	}
+}
+
+func kubeEndpoints(ep *corev1.Endpoints) *kube.Endpoints {
+	ret := &kube.Endpoints{ObjectMeta: kubeObjectMeta(ep.ObjectMeta)}
+	addrs := func(eas []corev1.EndpointAddress) []kube.EndpointAddress {
+		var ret []kube.EndpointAddress
+		for _, ea := range eas {
+			ret = append(ret, kube.EndpointAddress{IP: ea.IP, Hostname: ea.Hostname, NodeName: ea.NodeName})
+		}
+		return ret
+	}
+	for _, ss := range ep.Subsets {
+		ret.Subsets = append(ret.Subsets, kube.EndpointSubset{
+			Addresses:         addrs(ss.Addresses),
+			NotReadyAddresses: addrs(ss.NotReadyAddresses),
+		})
+	}
+	return ret
+}
+
+// secretRoutes is a kube.RouteTarget that writes the routes, comma
+// separated, to the "routes" key of the Secret namespace/name.
+type secretRoutes struct {
+	client.Client
+	namespace, name string
+}
+
+func (s *secretRoutes) SetRoutes(ctx context.Context, routes []netip.Prefix) error {
+	strs := make([]string, 0, len(routes))
+	for _, r := range routes {
+		strs = append(strs, r.String())
+	}
+	data := []byte(strings.Join(strs, ","))
+	sec := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      s.name,
+			Namespace: s.namespace,
+		},
+		Data: map[string][]byte{"routes": data},
+	}
+	_, err := createOrUpdate(ctx, s.Client, s.namespace, sec, func(sec *corev1.Secret) {
+		mak.Set(&sec.Data, "routes", data)
+	})
+	return err
+}
+
+// parseLabelSelectors parses selectors separated by semicolons, each of
+// comma-separated key=value labels, such as "app=web,tier=frontend;app=db".
+func parseLabelSelectors(s string) ([]kube.LabelSelector, error) {
+	var ret []kube.LabelSelector
+	for _, sel := range strings.Split(s, ";") {
+		if sel = strings.TrimSpace(sel); sel == "" {
+			continue
+		}
+		ls := kube.LabelSelector{}
+		for _, kv := range strings.Split(sel, ",") {
+			k, v, ok := strings.Cut(strings.TrimSpace(kv), "=")
+			if !ok || k == "" {
+				return nil, fmt.Errorf("invalid label selector %q: want key=value labels", sel)
+			}
+			ls[k] = v
+		}
+		ret = append(ret, ls)
+	}
+	return ret, nil
+}
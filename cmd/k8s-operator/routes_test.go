@@ -0,0 +1,124 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !plan9
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"tailscale.com/kube"
+)
+
+func TestRoutesReconciler(t *testing.T) {
+	fc := fake.NewFakeClient()
+	zl, err := zap.NewDevelopment()
+	if err != nil {
+		t.Fatal(err)
+	}
+	selectors, err := parseLabelSelectors("tailscale.com/advertise=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := newRoutesReconciler(fc, zl.Sugar(), selectors, "operator-ns", "tailscale-routes")
+	reconcileRoutes := func(ns, name string) {
+		t.Helper()
+		req := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: ns, Name: name}}
+		if _, err := rr.Reconcile(context.Background(), req); err != nil {
+			t.Fatalf("Reconcile: %v", err)
+		}
+	}
+	wantRoutes := func(want string) {
+		t.Helper()
+		sec := new(corev1.Secret)
+		if err := fc.Get(context.Background(), types.NamespacedName{Namespace: "operator-ns", Name: "tailscale-routes"}, sec); err != nil {
+			t.Fatal(err)
+		}
+		if got := string(sec.Data["routes"]); got != want {
+			t.Errorf("routes = %q; want %q", got, want)
+		}
+	}
+	labels := map[string]string{"tailscale.com/advertise": "true"}
+
+	mustCreate(t, fc, &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", Labels: labels},
+		Spec:       corev1.ServiceSpec{ClusterIP: "10.20.30.40", ClusterIPs: []string{"10.20.30.40"}},
+	})
+	mustCreate(t, fc, &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", Labels: labels},
+		Subsets: []corev1.EndpointSubset{{
+			Addresses:         []corev1.EndpointAddress{{IP: "10.0.0.2"}, {IP: "10.0.0.3"}},
+			NotReadyAddresses: []corev1.EndpointAddress{{IP: "10.0.0.9"}},
+		}},
+	})
+	mustCreate(t, fc, &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "data", Labels: labels},
+		Spec:       corev1.ServiceSpec{ClusterIP: "10.20.30.41"},
+	})
+	mustCreate(t, fc, &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "private", Namespace: "default"},
+		Spec:       corev1.ServiceSpec{ClusterIP: "10.20.30.50"},
+	})
+
+	// The first reconcile advertises all the selected Services, not just
+	// the one it's for.
+	reconcileRoutes("default", "private")
+	wantRoutes("10.0.0.2/31,10.20.30.40/31")
+
+	// Endpoints churn.
+	mustUpdate(t, fc, "default", "web", func(ep *corev1.Endpoints) {
+		ep.Subsets[0].Addresses = []corev1.EndpointAddress{{IP: "10.0.0.3"}}
+	})
+	reconcileRoutes("default", "web")
+	wantRoutes("10.0.0.3/32,10.20.30.40/31")
+
+	// A Service that's no longer selected is withdrawn.
+	mustUpdate(t, fc, "data", "db", func(svc *corev1.Service) {
+		svc.Labels = nil
+	})
+	reconcileRoutes("data", "db")
+	wantRoutes("10.0.0.3/32,10.20.30.40/32")
+
+	// As is a deleted one.
+	for _, obj := range []client.Object{
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}},
+		&corev1.Endpoints{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}},
+	} {
+		if err := fc.Delete(context.Background(), obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reconcileRoutes("default", "web")
+	wantRoutes("")
+}
+
+func TestParseLabelSelectors(t *testing.T) {
+	got, err := parseLabelSelectors("app=web, tier=frontend;app=db;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []kube.LabelSelector{
+		{"app": "web", "tier": "frontend"},
+		{"app": "db"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	for i := range want {
+		if got[i].String() != want[i].String() {
+			t.Errorf("selector %d = %v; want %v", i, got[i], want[i])
+		}
+	}
+	if _, err := parseLabelSelectors("app"); err == nil {
+		t.Error("selector without a value accepted")
+	}
+}
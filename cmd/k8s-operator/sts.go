@@ -10,12 +10,16 @@
 	_ "embed"
 	"encoding/json"
 	"fmt"
+	"net"
+	"net/netip"
 	"os"
+	"strconv"
 	"strings"
 
 	"go.uber.org/zap"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -23,6 +27,7 @@
 	"sigs.k8s.io/yaml"
 	"tailscale.com/client/tailscale"
 	"tailscale.com/ipn"
+	"tailscale.com/ipn/ipnstate"
 	"tailscale.com/tailcfg"
 	"tailscale.com/tsnet"
 	"tailscale.com/types/opt"
@@ -48,11 +53,35 @@
 	// Annotations settable by users on ingresses.
 	AnnotationFunnel = "tailscale.com/funnel"
 
+	// Annotations settable by users on services and ingresses to configure
+	// the DNS of their proxies.
+	AnnotationAcceptDNS        = "tailscale.com/accept-dns"
+	AnnotationDNSSearchDomains = "tailscale.com/dns-search-domains"
+
+	// AnnotationTailnet is settable by users on services and ingresses to
+	// have their proxy join a tailnet other than the operator's own, by
+	// the name of its credentials in OPERATOR_TAILNETS_DIR. The operator
+	// also sets it on the state Secrets of those proxies.
+	AnnotationTailnet = "tailscale.com/tailnet"
+
+	// AnnotationCertSecret is settable by users on services and ingresses
+	// to have the operator keep the tailnet TLS cert of their proxy in a
+	// kubernetes.io/tls Secret of that name in their namespace. The
+	// tailscale-operator-cert-secrets ClusterRole must be bound to the
+	// operator in that namespace.
+	AnnotationCertSecret = "tailscale.com/cert-secret"
+
 	// Annotations set by the operator on pods to trigger restarts when the
 	// hostname or IP changes.
 	podAnnotationLastSetClusterIP       = "tailscale.com/operator-last-set-cluster-ip"
 	podAnnotationLastSetHostname        = "tailscale.com/operator-last-set-hostname"
 	podAnnotationLastSetTailnetTargetIP = "tailscale.com/operator-last-set-ts-tailnet-target-ip"
+
+	// annotationLastSetCertSecret is set by the operator on services and
+	// ingresses to the name of the Secret it exported their proxy's TLS
+	// cert to, so that the Secret can be deleted when AnnotationCertSecret
+	// changes.
+	annotationLastSetCertSecret = "tailscale.com/operator-last-set-cert-secret"
 )
 
 type tailscaleSTSConfig struct {
@@ -69,18 +98,58 @@ type tailscaleSTSConfig struct {
 
 	Hostname string
 	Tags     []string // if empty, use defaultTags
+
+	// AcceptDNS is whether the proxy uses the tailnet's DNS configuration.
+	// If unset, containerboot's default, false, applies.
+	AcceptDNS opt.Bool
+	// DNSSearchDomains are DNS search domains added to those of the
+	// cluster in the proxy pod's DNS configuration.
+	DNSSearchDomains []string
+
+	// FetchCert is whether the proxy gets a TLS cert for its MagicDNS name
+	// and keeps it renewed, so that it can be exported to a Secret.
+	FetchCert bool
+
+	// Tailnet is the name of the tailnet that the proxy joins, from
+	// tailnetClients, or "" for the operator's own.
+	Tailnet string
+
+	// ProxiedServices are the cluster Services that the proxy sends
+	// traffic to, which its NetworkPolicy allows.
+	ProxiedServices []*corev1.Service
 }
 
 type tailscaleSTSReconciler struct {
 	client.Client
+	// apiReader reads Secrets outside operatorNamespace, which the
+	// Client's cache doesn't hold.
+	apiReader              client.Reader
 	tsnetServer            *tsnet.Server
 	tsClient               tsClient
 	defaultTags            []string
 	operatorNamespace      string
 	proxyImage             string
 	proxyPriorityClassName string
+
+	// proxyLocalAPITags, if non-empty, are the operator's ACL tags, to
+	// which the kernel mode proxies serve their LocalAPI status over the
+	// tailnet on proxyLocalAPIPort.
+	proxyLocalAPITags []string
+	// tailnetClients are the Tailscale API clients of the tailnets other
+	// than the operator's own that proxies can join, by name.
+	tailnetClients map[string]tsClient
+	// proxyNetworkPolicyCIDRs, if non-empty, are the pod and service
+	// CIDRs of the cluster. Each proxy then gets a NetworkPolicy that
+	// blocks its traffic to them, other than to what it proxies to.
+	proxyNetworkPolicyCIDRs []netip.Prefix
+	// tailnetDial, if non-nil, replaces tsnetServer.Dial in tests.
+	tailnetDial func(ctx context.Context, network, addr string) (net.Conn, error)
 }
 
+// proxyLocalAPIPort is the port on the proxies' Tailscale IPs on which they
+// serve their LocalAPI status to the operator.
+const proxyLocalAPIPort = 41113
+
 // IsHTTPSEnabledOnTailnet reports whether HTTPS is enabled on the tailnet.
 func (a *tailscaleSTSReconciler) IsHTTPSEnabledOnTailnet() bool {
 	return len(a.tsnetServer.CertDomains()) > 0
@@ -103,6 +172,11 @@ func (a *tailscaleSTSReconciler) Provision(ctx context.Context, logger *zap.Suga
 	if err != nil {
 		return nil, fmt.Errorf("failed to reconcile statefulset: %w", err)
 	}
+	if len(a.proxyNetworkPolicyCIDRs) > 0 {
+		if err := a.reconcileNetworkPolicy(ctx, logger, sts, hsvc); err != nil {
+			return nil, fmt.Errorf("failed to reconcile networkpolicy: %w", err)
+		}
+	}
 
 	return hsvc, nil
 }
@@ -141,9 +215,17 @@ func (a *tailscaleSTSReconciler) Cleanup(ctx context.Context, logger *zap.Sugare
 		return false, fmt.Errorf("getting device info: %w", err)
 	}
 	if id != "" {
+		tailnet, err := a.proxyTailnet(ctx, labels)
+		if err != nil {
+			return false, fmt.Errorf("getting proxy tailnet: %w", err)
+		}
+		tsc, err := a.tsClientForTailnet(tailnet)
+		if err != nil {
+			return false, err
+		}
 		// TODO: handle case where the device is already deleted, but the secret
 		// is still around.
-		if err := a.tsClient.DeleteDevice(ctx, string(id)); err != nil {
+		if err := tsc.DeleteDevice(ctx, string(id)); err != nil {
 			return false, fmt.Errorf("deleting device: %w", err)
 		}
 	}
@@ -152,6 +234,9 @@ func (a *tailscaleSTSReconciler) Cleanup(ctx context.Context, logger *zap.Sugare
 		&corev1.Service{},
 		&corev1.Secret{},
 	}
+	if len(a.proxyNetworkPolicyCIDRs) > 0 {
+		types = append(types, &networkingv1.NetworkPolicy{})
+	}
 	for _, typ := range types {
 		if err := a.DeleteAllOf(ctx, typ, client.InNamespace(a.operatorNamespace), client.MatchingLabels(labels)); err != nil {
 			return false, err
@@ -196,6 +281,11 @@ func (a *tailscaleSTSReconciler) createOrGetSecret(ctx context.Context, logger *
 	} else if !apierrors.IsNotFound(err) {
 		return "", err
 	}
+	if orig != nil && orig.Annotations[AnnotationTailnet] != stsC.Tailnet {
+		// The proxy would need a new auth key and state to join another
+		// tailnet.
+		return "", fmt.Errorf("proxy already joined tailnet %q; remove and re-add the Tailscale configuration of %s to move it to %q", orig.Annotations[AnnotationTailnet], stsC.ParentResourceName, stsC.Tailnet)
+	}
 
 	if orig == nil {
 		// Secret doesn't exist yet, create one. Initially it contains
@@ -218,12 +308,15 @@ func (a *tailscaleSTSReconciler) createOrGetSecret(ctx context.Context, logger *
 		if len(tags) == 0 {
 			tags = a.defaultTags
 		}
-		authKey, err := a.newAuthKey(ctx, tags)
+		authKey, err := a.newAuthKey(ctx, stsC.Tailnet, tags)
 		if err != nil {
 			return "", err
 		}
 
 		mak.Set(&secret.StringData, "authkey", authKey)
+		if stsC.Tailnet != "" {
+			mak.Set(&secret.Annotations, AnnotationTailnet, stsC.Tailnet)
+		}
 	}
 	if stsC.ServeConfig != nil {
 		j, err := json.Marshal(stsC.ServeConfig)
@@ -273,7 +366,31 @@ func (a *tailscaleSTSReconciler) DeviceInfo(ctx context.Context, childLabels map
 	return id, hostname, ips, nil
 }
 
-func (a *tailscaleSTSReconciler) newAuthKey(ctx context.Context, tags []string) (string, error) {
+// ProxyStatus returns the status of the proxy with the given Tailscale IPs
+// from its LocalAPI, which it serves to the operator over the tailnet. It
+// returns nil and no error if the proxies don't serve their LocalAPI to the
+// operator.
+func (a *tailscaleSTSReconciler) ProxyStatus(ctx context.Context, ips []string) (*ipnstate.Status, error) {
+	if len(a.proxyLocalAPITags) == 0 || len(ips) == 0 {
+		return nil, nil
+	}
+	dial := a.tailnetDial
+	if dial == nil {
+		dial = a.tsnetServer.Dial
+	}
+	lc := &tailscale.LocalClient{
+		Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dial(ctx, "tcp", net.JoinHostPort(ips[0], strconv.Itoa(proxyLocalAPIPort)))
+		},
+	}
+	return lc.StatusWithoutPeers(ctx)
+}
+
+func (a *tailscaleSTSReconciler) newAuthKey(ctx context.Context, tailnet string, tags []string) (string, error) {
+	tsc, err := a.tsClientForTailnet(tailnet)
+	if err != nil {
+		return "", err
+	}
 	caps := tailscale.KeyCapabilities{
 		Devices: tailscale.KeyDeviceCapabilities{
 			Create: tailscale.KeyDeviceCreateCapabilities{
@@ -284,7 +401,7 @@ func (a *tailscaleSTSReconciler) newAuthKey(ctx context.Context, tags []string)
 		},
 	}
 
-	key, _, err := a.tsClient.CreateKey(ctx, caps)
+	key, _, err := tsc.CreateKey(ctx, caps)
 	if err != nil {
 		return "", err
 	}
@@ -353,6 +470,36 @@ func (a *tailscaleSTSReconciler) reconcileSTS(ctx context.Context, logger *zap.S
 			},
 		})
 	}
+	if v, ok := sts.AcceptDNS.Get(); ok {
+		container.Env = append(container.Env, corev1.EnvVar{
+			Name:  "TS_ACCEPT_DNS",
+			Value: strconv.FormatBool(v),
+		})
+	}
+	if sts.FetchCert {
+		container.Env = append(container.Env, corev1.EnvVar{
+			Name:  "TS_CERT_FETCH",
+			Value: "true",
+		})
+	}
+	if len(a.proxyLocalAPITags) > 0 && sts.ServeConfig == nil && sts.Tailnet == "" {
+		// Only kernel mode proxies can listen on their Tailscale IPs, and
+		// the operator can only reach those in its own tailnet.
+		container.Env = append(container.Env,
+			corev1.EnvVar{
+				Name:  "TS_TAILNET_LOCALAPI_PORT",
+				Value: strconv.Itoa(proxyLocalAPIPort),
+			},
+			corev1.EnvVar{
+				Name:  "TS_TAILNET_LOCALAPI_TAGS",
+				Value: strings.Join(a.proxyLocalAPITags, ","),
+			})
+	}
+	if len(sts.DNSSearchDomains) > 0 {
+		ss.Spec.Template.Spec.DNSConfig = &corev1.PodDNSConfig{
+			Searches: sts.DNSSearchDomains,
+		}
+	}
 	ss.ObjectMeta = metav1.ObjectMeta{
 		Name:      headlessSvc.Name,
 		Namespace: a.operatorNamespace,
@@ -492,3 +639,28 @@ func nameForService(svc *corev1.Service) (string, error) {
 	}
 	return svc.Namespace + "-" + svc.Name, nil
 }
+
+// proxyDNSConfig returns the DNS configuration of the proxy of a Service or
+// Ingress with the given annotations.
+func proxyDNSConfig(annotations map[string]string) (acceptDNS opt.Bool, searchDomains []string, err error) {
+	if v, ok := annotations[AnnotationAcceptDNS]; ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid %s annotation %q: must be true or false", AnnotationAcceptDNS, v)
+		}
+		acceptDNS.Set(b)
+	}
+	if v := annotations[AnnotationDNSSearchDomains]; v != "" {
+		for _, d := range strings.Split(v, ",") {
+			d = strings.TrimSpace(d)
+			if d == "" {
+				continue
+			}
+			if err := dnsname.ValidHostname(d); err != nil {
+				return "", nil, fmt.Errorf("invalid DNS search domain %q: %w", d, err)
+			}
+			searchDomains = append(searchDomains, d)
+		}
+	}
+	return acceptDNS, searchDomains, nil
+}
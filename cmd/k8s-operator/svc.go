@@ -19,6 +19,8 @@
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"tailscale.com/ipn"
+	"tailscale.com/ipn/ipnstate"
 	"tailscale.com/util/clientmetric"
 	"tailscale.com/util/set"
 )
@@ -109,6 +111,9 @@ func (a *ServiceReconciler) maybeCleanup(ctx context.Context, logger *zap.Sugare
 		logger.Debugf("cleanup not done yet, waiting for next reconcile")
 		return nil
 	}
+	if err := a.ssr.reconcileCertSecret(ctx, logger, svc, nil, ""); err != nil {
+		return err
+	}
 
 	svc.Finalizers = append(svc.Finalizers[:ix], svc.Finalizers[ix+1:]...)
 	if err := a.Update(ctx, svc); err != nil {
@@ -140,6 +145,18 @@ func (a *ServiceReconciler) maybeProvision(ctx context.Context, logger *zap.Suga
 	if err != nil {
 		return err
 	}
+	acceptDNS, searchDomains, err := proxyDNSConfig(svc.Annotations)
+	if err != nil {
+		return err
+	}
+	certSecret, err := certSecretName(svc.Annotations)
+	if err != nil {
+		return err
+	}
+	tailnet, err := a.ssr.tailnetFromAnnotations(svc.Annotations)
+	if err != nil {
+		return err
+	}
 
 	if !slices.Contains(svc.Finalizers, FinalizerName) {
 		// This log line is printed exactly once during initial provisioning,
@@ -164,11 +181,16 @@ func (a *ServiceReconciler) maybeProvision(ctx context.Context, logger *zap.Suga
 		Hostname:            hostname,
 		Tags:                tags,
 		ChildResourceLabels: crl,
+		AcceptDNS:           acceptDNS,
+		DNSSearchDomains:    searchDomains,
+		Tailnet:             tailnet,
 	}
 
 	a.mu.Lock()
 	if a.shouldExpose(svc) {
 		sts.ClusterTargetIP = svc.Spec.ClusterIP
+		sts.ProxiedServices = []*corev1.Service{svc}
+		sts.FetchCert = certSecret != ""
 		a.managedIngressProxies.Add(svc.UID)
 		gaugeIngressProxies.Set(int64(a.managedIngressProxies.Len()))
 	} else if ip := a.tailnetTargetAnnotation(svc); ip != "" {
@@ -183,6 +205,14 @@ func (a *ServiceReconciler) maybeProvision(ctx context.Context, logger *zap.Suga
 		return fmt.Errorf("failed to provision: %w", err)
 	}
 
+	exportTo := ""
+	if sts.FetchCert {
+		exportTo = certSecret
+	}
+	if err := a.ssr.reconcileCertSecret(ctx, logger, svc, crl, exportTo); err != nil {
+		return err
+	}
+
 	if sts.TailnetTargetIP != "" {
 		// TODO (irbekrm): cluster.local is the default DNS name, but
 		// can be changed by users. Make this configurable or figure out
@@ -218,6 +248,23 @@ func (a *ServiceReconciler) maybeProvision(ctx context.Context, logger *zap.Suga
 		return nil
 	}
 
+	var st *ipnstate.Status
+	if tailnet == "" {
+		// The operator can only reach proxies in its own tailnet.
+		st, err = a.ssr.ProxyStatus(ctx, tsIPs)
+	}
+	if err != nil {
+		// The proxy may be restarting, or the tailnet's ACLs may not let
+		// the operator reach it. Its Secret is good enough to go on.
+		logger.Infof("could not get proxy status over the tailnet: %v", err)
+	} else if st != nil && st.BackendState != ipn.Running.String() {
+		svc.Status.LoadBalancer.Ingress = nil
+		if err := a.Status().Update(ctx, svc); err != nil {
+			return fmt.Errorf("failed to update service status: %w", err)
+		}
+		return fmt.Errorf("proxy is in state %q, waiting for it to run", st.BackendState)
+	}
+
 	logger.Debugf("setting ingress to %q, %s", tsHost, strings.Join(tsIPs, ", "))
 	ingress := []corev1.LoadBalancerIngress{
 		{Hostname: tsHost},
@@ -0,0 +1,102 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !plan9
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/oauth2/clientcredentials"
+	corev1 "k8s.io/api/core/v1"
+	"tailscale.com/client/tailscale"
+	"tailscale.com/util/dnsname"
+)
+
+// loadTailnetClients returns Tailscale API clients for the tailnets other
+// than the operator's own that proxies can join, by name. Each
+// subdirectory of dir is a tailnet, named after the subdirectory, with the
+// OAuth client credentials for it in its client_id and client_secret
+// files, such as a mounted Secret. It returns nil if dir is empty.
+func loadTailnetClients(dir string, egressClient *http.Client) (map[string]tsClient, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	ents, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	clients := make(map[string]tsClient)
+	for _, ent := range ents {
+		name := ent.Name()
+		if strings.HasPrefix(name, ".") {
+			// Such as the ..data symlink of a mounted Secret.
+			continue
+		}
+		fi, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			continue
+		}
+		if err := dnsname.ValidLabel(name); err != nil {
+			return nil, fmt.Errorf("invalid tailnet name %q: %w", name, err)
+		}
+		clientID, err := os.ReadFile(filepath.Join(dir, name, "client_id"))
+		if err != nil {
+			return nil, fmt.Errorf("tailnet %q: %w", name, err)
+		}
+		clientSecret, err := os.ReadFile(filepath.Join(dir, name, "client_secret"))
+		if err != nil {
+			return nil, fmt.Errorf("tailnet %q: %w", name, err)
+		}
+		c := tailscale.NewClient("-", nil)
+		c.HTTPClient = apiHTTPClient(clientcredentials.Config{
+			ClientID:     strings.TrimSpace(string(clientID)),
+			ClientSecret: strings.TrimSpace(string(clientSecret)),
+			TokenURL:     "https://login.tailscale.com/api/v2/oauth/token",
+		}, egressClient)
+		clients[name] = c
+	}
+	return clients, nil
+}
+
+// tailnetFromAnnotations returns the name of the tailnet that the proxy of
+// a Service or Ingress with the given annotations joins, or "" for the
+// operator's own.
+func (a *tailscaleSTSReconciler) tailnetFromAnnotations(annotations map[string]string) (string, error) {
+	name := annotations[AnnotationTailnet]
+	if _, err := a.tsClientForTailnet(name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// tsClientForTailnet returns the Tailscale API client for the named
+// tailnet, or for the operator's own tailnet if name is "".
+func (a *tailscaleSTSReconciler) tsClientForTailnet(name string) (tsClient, error) {
+	if name == "" {
+		return a.tsClient, nil
+	}
+	if c, ok := a.tailnetClients[name]; ok {
+		return c, nil
+	}
+	return nil, fmt.Errorf("unknown tailnet %q in %s annotation; the operator has no credentials for it", name, AnnotationTailnet)
+}
+
+// proxyTailnet returns the name of the tailnet that the proxy with the
+// given child labels joined, as recorded on its state Secret.
+func (a *tailscaleSTSReconciler) proxyTailnet(ctx context.Context, childLabels map[string]string) (string, error) {
+	sec, err := getSingleObject[corev1.Secret](ctx, a.Client, a.operatorNamespace, childLabels)
+	if err != nil || sec == nil {
+		return "", err
+	}
+	return sec.Annotations[AnnotationTailnet], nil
+}
@@ -0,0 +1,166 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !plan9
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"tailscale.com/util/mak"
+)
+
+func TestLoadTailnetClients(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"prod", "staging"} {
+		if err := os.Mkdir(filepath.Join(dir, name), 0700); err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range []string{"client_id", "client_secret"} {
+			if err := os.WriteFile(filepath.Join(dir, name, f), []byte(name+"-"+f+"\n"), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// Mounted Secrets have hidden entries, which aren't tailnets.
+	if err := os.Mkdir(filepath.Join(dir, "..data"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	clients, err := loadTailnetClients(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for name := range clients {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	if want := []string{"prod", "staging"}; !slices.Equal(names, want) {
+		t.Errorf("tailnets = %q; want %q", names, want)
+	}
+
+	if err := os.Remove(filepath.Join(dir, "staging", "client_secret")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadTailnetClients(dir, nil); err == nil {
+		t.Error("loaded a tailnet without a client secret")
+	}
+	if clients, err := loadTailnetClients("", nil); err != nil || clients != nil {
+		t.Errorf("loadTailnetClients(\"\") = %v, %v; want nil, nil", clients, err)
+	}
+}
+
+func TestServiceInOtherTailnet(t *testing.T) {
+	fc := fake.NewFakeClient()
+	ft := &fakeTSClient{}
+	ftOther := &fakeTSClient{}
+	zl, err := zap.NewDevelopment()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sr := &ServiceReconciler{
+		Client: fc,
+		ssr: &tailscaleSTSReconciler{
+			Client:            fc,
+			tsClient:          ft,
+			tailnetClients:    map[string]tsClient{"other": ftOther},
+			defaultTags:       []string{"tag:k8s"},
+			operatorNamespace: "operator-ns",
+			proxyImage:        "tailscale/tailscale",
+		},
+		logger: zl.Sugar(),
+	}
+
+	mustCreate(t, fc, &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: "default",
+			UID:       types.UID("1234-UID"),
+			Annotations: map[string]string{
+				AnnotationExpose:  "true",
+				AnnotationTailnet: "other",
+			},
+		},
+		Spec: corev1.ServiceSpec{
+			ClusterIP: "10.20.30.40",
+			Type:      corev1.ServiceTypeClusterIP,
+		},
+	})
+	expectReconciled(t, sr, "default", "test")
+
+	if len(ft.KeyRequests()) != 0 || len(ftOther.KeyRequests()) != 1 {
+		t.Errorf("auth keys created in operator's tailnet: %d, other tailnet: %d; want 0, 1", len(ft.KeyRequests()), len(ftOther.KeyRequests()))
+	}
+	fullName, shortName := findGenName(t, fc, "default", "test")
+	secret := expectedSecret(fullName)
+	secret.Annotations = map[string]string{AnnotationTailnet: "other"}
+	expectEqual(t, fc, secret)
+
+	// Moving the proxy to another tailnet isn't supported.
+	mustUpdate(t, fc, "default", "test", func(s *corev1.Service) {
+		delete(s.Annotations, AnnotationTailnet)
+	})
+	if _, err := sr.Reconcile(context.Background(), reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "test"}}); err == nil || !strings.Contains(err.Error(), "already joined tailnet") {
+		t.Errorf("moving proxy to operator's tailnet: err = %v; want already joined error", err)
+	}
+
+	// The device is deleted from the tailnet it joined.
+	mustUpdate(t, fc, "operator-ns", fullName, func(s *corev1.Secret) {
+		mak.Set(&s.Data, "device_id", []byte("ts-id-1234"))
+		mak.Set(&s.Data, "device_fqdn", []byte("test.other.ts.net."))
+	})
+	mustUpdate(t, fc, "default", "test", func(s *corev1.Service) {
+		delete(s.Annotations, AnnotationExpose)
+	})
+	expectReconciled(t, sr, "default", "test")
+	expectMissing[appsv1.StatefulSet](t, fc, "operator-ns", shortName)
+	expectReconciled(t, sr, "default", "test")
+	if got := ftOther.Deleted(); !slices.Equal(got, []string{"ts-id-1234"}) {
+		t.Errorf("deleted from other tailnet: %q; want [ts-id-1234]", got)
+	}
+	if got := ft.Deleted(); len(got) != 0 {
+		t.Errorf("deleted from operator's tailnet: %q; want none", got)
+	}
+
+	// Unknown tailnets are rejected.
+	mustCreate(t, fc, &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "unknown",
+			Namespace: "default",
+			UID:       types.UID("5678-UID"),
+			Annotations: map[string]string{
+				AnnotationExpose:  "true",
+				AnnotationTailnet: "nope",
+			},
+		},
+		Spec: corev1.ServiceSpec{
+			ClusterIP: "10.20.30.41",
+			Type:      corev1.ServiceTypeClusterIP,
+		},
+	})
+	if _, err := sr.Reconcile(context.Background(), reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "unknown"}}); err == nil {
+		t.Error("exposed a Service in an unknown tailnet")
+	}
+	var secrets corev1.SecretList
+	if err := fc.List(context.Background(), &secrets, client.InNamespace("operator-ns"), client.MatchingLabels(childResourceLabels("unknown", "default", "svc"))); err != nil {
+		t.Fatal(err)
+	}
+	if len(secrets.Items) != 0 {
+		t.Error("created a proxy for a Service in an unknown tailnet")
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+// The mkpolicy command generates documentation and administrative templates
+// for the system policies defined in tailscale.com/util/winutil/policy.
+//
+// Usage:
+//
+//	mkpolicy [--docs=policies.md] [--admx=tailscale.admx --adml=tailscale.adml] [--plist=tailscale.plist]
+//
+// The ADMX and ADML files are Group Policy administrative templates for the
+// policies that apply to Windows. The plist is a template of the preferences
+// for the policies that apply to macOS and iOS, for use in MDM configuration
+// profiles.
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"flag"
+	"log"
+	"os"
+	"strings"
+	"text/template"
+
+	"tailscale.com/util/winutil/policy"
+)
+
+var (
+	docsPath  = flag.String("docs", "", "if non-empty, path to write Markdown documentation of all policies to")
+	admxPath  = flag.String("admx", "", "if non-empty, path to write the ADMX template of the Windows policies to")
+	admlPath  = flag.String("adml", "", "if non-empty, path to write the en-US ADML resources of the ADMX template to")
+	plistPath = flag.String("plist", "", "if non-empty, path to write the plist template of the macOS and iOS policies to")
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() > 0 {
+		log.Fatalf("unexpected arguments: %q", flag.Args())
+	}
+	outputs := []struct {
+		path string
+		gen  func() ([]byte, error)
+	}{
+		{*docsPath, genDocs},
+		{*admxPath, genADMX},
+		{*admlPath, genADML},
+		{*plistPath, genPlist},
+	}
+	for _, o := range outputs {
+		if o.path == "" {
+			continue
+		}
+		b, err := o.gen()
+		if err != nil {
+			log.Fatalf("generating %s: %v", o.path, err)
+		}
+		if err := os.WriteFile(o.path, b, 0644); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// policies returns the policies that apply to any of the platforms goos,
+// or all policies if goos is empty.
+func policies(goos ...string) []*policy.Definition {
+	var ret []*policy.Definition
+	for _, d := range policy.Definitions() {
+		if len(goos) == 0 {
+			ret = append(ret, d)
+			continue
+		}
+		for _, g := range goos {
+			if d.AppliesTo(g) {
+				ret = append(ret, d)
+				break
+			}
+		}
+	}
+	return ret
+}
+
+func execute(tmpl string, data any) ([]byte, error) {
+	t, err := template.New("").Funcs(template.FuncMap{
+		"xml": func(s string) (string, error) {
+			var buf bytes.Buffer
+			err := xml.EscapeText(&buf, []byte(s))
+			return buf.String(), err
+		},
+		"md": func(s string) string {
+			return strings.ReplaceAll(s, "|", `\|`)
+		},
+		"join": strings.Join,
+		"isBool": func(d *policy.Definition) bool {
+			return d.Type == policy.BooleanType
+		},
+	}).Parse(tmpl)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func genDocs() ([]byte, error) {
+	return execute(docsTmpl, policies())
+}
+
+func genADMX() ([]byte, error) {
+	return execute(admxTmpl, policies("windows"))
+}
+
+func genADML() ([]byte, error) {
+	return execute(admlTmpl, policies("windows"))
+}
+
+func genPlist() ([]byte, error) {
+	return execute(plistTmpl, policies("darwin", "ios"))
+}
+
+const docsTmpl = `# Tailscale system policies
+
+<!-- Code generated by cmd/mkpolicy; DO NOT EDIT. -->
+
+| Policy | Type | Default | Allowed values | Platforms | Description |
+|--------|------|---------|----------------|-----------|-------------|
+{{range .}}| ` + "`{{.Key}}`" + ` | {{.Type}} | {{.Default}} | {{join .Allowed ", "}} | {{join .Platforms ", "}} | {{md .Description}} |
+{{end}}`
+
+const admxTmpl = `<?xml version="1.0" encoding="utf-8"?>
+<!-- Code generated by cmd/mkpolicy; DO NOT EDIT. -->
+<policyDefinitions xmlns:xsd="http://www.w3.org/2001/XMLSchema" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" revision="1.0" schemaVersion="1.0" xmlns="http://schemas.microsoft.com/GroupPolicy/2006/07/PolicyDefinitions">
+  <policyNamespaces>
+    <target prefix="tailscale" namespace="Tailscale.Policies" />
+    <using prefix="windows" namespace="Microsoft.Policies.Windows" />
+  </policyNamespaces>
+  <resources minRequiredRevision="1.0" />
+  <categories>
+    <category name="Tailscale" displayName="$(string.Tailscale)" />
+  </categories>
+  <policies>
+{{- range .}}
+{{- if isBool .}}
+    <policy name="{{.Key}}" class="Machine" displayName="$(string.{{.Key}})" explainText="$(string.{{.Key}}_Help)" key="Software\Policies\Tailscale" valueName="{{.Key}}">
+      <parentCategory ref="Tailscale" />
+      <supportedOn ref="windows:SUPPORTED_WIN10" />
+      <enabledValue><decimal value="1" /></enabledValue>
+      <disabledValue><decimal value="0" /></disabledValue>
+    </policy>
+{{- else}}
+    <policy name="{{.Key}}" class="Machine" displayName="$(string.{{.Key}})" explainText="$(string.{{.Key}}_Help)" presentation="$(presentation.{{.Key}})" key="Software\Policies\Tailscale">
+      <parentCategory ref="Tailscale" />
+      <supportedOn ref="windows:SUPPORTED_WIN10" />
+      <elements>
+{{- if .Allowed}}
+{{- $key := .Key}}
+        <enum id="{{.Key}}" valueName="{{.Key}}">
+{{- range .Allowed}}
+          <item displayName="$(string.{{$key}}_{{.}})"><value><string>{{xml .}}</string></value></item>
+{{- end}}
+        </enum>
+{{- else}}
+        <text id="{{.Key}}" valueName="{{.Key}}" />
+{{- end}}
+      </elements>
+    </policy>
+{{- end}}
+{{- end}}
+  </policies>
+</policyDefinitions>
+`
+
+const admlTmpl = `<?xml version="1.0" encoding="utf-8"?>
+<!-- Code generated by cmd/mkpolicy; DO NOT EDIT. -->
+<policyDefinitionResources xmlns:xsd="http://www.w3.org/2001/XMLSchema" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" revision="1.0" schemaVersion="1.0" xmlns="http://schemas.microsoft.com/GroupPolicy/2006/07/PolicyDefinitions">
+  <displayName>Tailscale</displayName>
+  <description>Tailscale system policies</description>
+  <resources>
+    <stringTable>
+      <string id="Tailscale">Tailscale</string>
+{{- range .}}
+{{- $key := .Key}}
+      <string id="{{.Key}}">{{.Key}}</string>
+      <string id="{{.Key}}_Help">{{xml .Description}}{{if .Default}} Default: {{xml .Default}}.{{end}}</string>
+{{- range .Allowed}}
+      <string id="{{$key}}_{{.}}">{{xml .}}</string>
+{{- end}}
+{{- end}}
+    </stringTable>
+    <presentationTable>
+{{- range .}}
+{{- if not (isBool .)}}
+      <presentation id="{{.Key}}">
+{{- if .Allowed}}
+        <dropdownList refId="{{.Key}}">{{.Key}}</dropdownList>
+{{- else}}
+        <textBox refId="{{.Key}}"><label>{{.Key}}</label></textBox>
+{{- end}}
+      </presentation>
+{{- end}}
+{{- end}}
+    </presentationTable>
+  </resources>
+</policyDefinitionResources>
+`
+
+const plistTmpl = `<?xml version="1.0" encoding="UTF-8"?>
+<!-- Code generated by cmd/mkpolicy; DO NOT EDIT. -->
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+{{- range .}}
+	<key>{{.Key}}</key>
+{{- if isBool .}}
+	<{{if eq .Default "1"}}true{{else}}false{{end}}/>
+{{- else}}
+	<string>{{xml .Default}}</string>
+{{- end}}
+{{- end}}
+</dict>
+</plist>
+`
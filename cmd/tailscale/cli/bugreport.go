@@ -22,6 +22,8 @@
 		fs := newFlagSet("bugreport")
 		fs.BoolVar(&bugReportArgs.diagnose, "diagnose", false, "run additional in-depth checks")
 		fs.BoolVar(&bugReportArgs.record, "record", false, "if true, pause and then write another bugreport")
+		fs.StringVar(&bugReportArgs.collect, "collect", "", "if non-empty, path of a .tar.gz file to write a redacted diagnostic bundle to, for attaching to a support ticket")
+		fs.BoolVar(&bugReportArgs.yes, "yes", false, "with --collect, write the bundle without asking for consent")
 		return fs
 	})(),
 }
@@ -29,6 +31,8 @@
 var bugReportArgs struct {
 	diagnose bool
 	record   bool
+	collect  string
+	yes      bool
 }
 
 func runBugReport(ctx context.Context, args []string) error {
@@ -44,6 +48,21 @@ func runBugReport(ctx context.Context, args []string) error {
 		Note:     note,
 		Diagnose: bugReportArgs.diagnose,
 	}
+	if bugReportArgs.collect != "" {
+		if bugReportArgs.record {
+			return errors.New("--collect and --record can't be used together")
+		}
+		if !confirmCollect(bugReportArgs.collect) {
+			return errors.New("aborted; no bundle written")
+		}
+		logMarker, err := collectBundle(ctx, bugReportArgs.collect, opts)
+		if err != nil {
+			return err
+		}
+		outln(logMarker)
+		printf("Wrote %s; please attach it to your support ticket or GitHub issue.\n", bugReportArgs.collect)
+		return nil
+	}
 	if !bugReportArgs.record {
 		// Simple, non-record case
 		logMarker, err := localClient.BugReportWithOpts(ctx, opts)
@@ -0,0 +1,248 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"tailscale.com/client/tailscale"
+	"tailscale.com/net/netcheck"
+	"tailscale.com/types/logger"
+	"tailscale.com/version"
+)
+
+// maxBundleItemSize is the most bytes of each item, such as the daemon
+// logs or a firewall dump, that a bugreport bundle contains.
+const maxBundleItemSize = 10 << 20
+
+// bundleContents describes what bugreport --collect puts in the bundle,
+// for the consent prompt.
+const bundleContents = `The bundle contains:
+  - the bugreport marker and the version of Tailscale
+  - the output of "tailscale status --json"
+  - your preferences, without their keys
+  - a netcheck report
+  - the daemon's logs while the bundle is collected, and its retained
+    logs if it runs with --logs-local-only
+  - a dump of your OS firewall rules
+Private and auth keys are removed. It still contains the names and IP
+addresses of your devices and networks.
+`
+
+// bundleFile is a file in a bugreport bundle.
+type bundleFile struct {
+	name string
+	data []byte
+}
+
+// confirmCollect asks the user for consent to write a bugreport bundle to
+// path, and reports whether they gave it.
+func confirmCollect(path string) bool {
+	printf("%s\n", bundleContents)
+	if bugReportArgs.yes {
+		printf("Writing the bundle to %s; --yes given, continuing without prompts.\n", path)
+		return true
+	}
+	printf("Write the bundle to %s? [y/n] ", path)
+	var resp string
+	fmt.Scanln(&resp)
+	switch strings.ToLower(resp) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+// collectBundle files a bug report with opts and writes a redacted
+// diagnostic bundle to path, as a gzipped tarball. It returns the
+// bugreport marker.
+//
+// Items of the bundle that can't be collected are listed in its
+// errors.txt rather than failing the whole bundle.
+func collectBundle(ctx context.Context, path string, opts tailscale.BugReportOpts) (string, error) {
+	// Tail the daemon's logs while it files the bug report, which logs
+	// what it knows about its state, more so with --diagnose.
+	logsCtx, stopLogs := context.WithCancel(ctx)
+	defer stopLogs()
+	logs := new(bytes.Buffer)
+	logsDone := make(chan error, 1)
+	if r, err := localClient.TailDaemonLogs(logsCtx); err != nil {
+		logsDone <- err
+	} else {
+		go func() {
+			_, err := io.Copy(logs, io.LimitReader(r, maxBundleItemSize))
+			logsDone <- err
+		}()
+	}
+
+	marker, err := localClient.BugReportWithOpts(ctx, opts)
+	if err != nil {
+		return "", err
+	}
+
+	var files []bundleFile
+	var errs []string
+	add := func(name string, data []byte, err error) {
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+			return
+		}
+		files = append(files, bundleFile{name, redactBundleData(data)})
+	}
+
+	addJSON := func(name string, v any, err error) {
+		var b []byte
+		if err == nil {
+			b, err = json.MarshalIndent(v, "", "\t")
+		}
+		add(name, b, err)
+	}
+
+	add("marker.txt", []byte(fmt.Sprintf("%s\n%s\n", marker, version.String())), nil)
+	st, err := localClient.Status(ctx)
+	addJSON("status.json", st, err)
+	prefs, err := localClient.GetPrefs(ctx)
+	if err == nil {
+		prefs.Persist = nil
+	}
+	addJSON("prefs.json", prefs, err)
+	report, err := bundleNetcheck(ctx)
+	addJSON("netcheck.json", report, err)
+	fw, err := dumpFirewall(ctx)
+	add("firewall.txt", fw, err)
+	if r, err := localClient.LocalDaemonLogs(ctx, false); err == nil {
+		b, err := io.ReadAll(io.LimitReader(r, maxBundleItemSize))
+		r.Close()
+		add("local-logs.json", b, err)
+	}
+
+	// Give the tail a moment to catch up with the bug report's logs.
+	time.Sleep(time.Second)
+	stopLogs()
+	if err := <-logsDone; err != nil && logsCtx.Err() == nil {
+		add("logs.txt", nil, err)
+	} else {
+		add("logs.txt", logs.Bytes(), nil)
+	}
+
+	if len(errs) > 0 {
+		add("errors.txt", []byte(strings.Join(errs, "\n")+"\n"), nil)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return "", err
+	}
+	if err := writeBundle(f, files); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	return marker, nil
+}
+
+// bundleNetcheck returns a netcheck report, as "tailscale netcheck" does.
+func bundleNetcheck(ctx context.Context) (*netcheck.Report, error) {
+	dm, err := netcheckDERPMap(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c := &netcheck.Client{Logf: logger.Discard}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	// A failure to set up UDP shows up in the report as no UDP, which is
+	// useful to know in itself.
+	c.Standalone(ctx, "")
+	return c.GetReport(ctx, dm)
+}
+
+// dumpFirewall returns the firewall rules of the OS, from the commands that
+// list them. It's fine for some of them to fail, such as for the firewall
+// that isn't in use.
+func dumpFirewall(ctx context.Context) ([]byte, error) {
+	var cmds [][]string
+	switch runtime.GOOS {
+	case "linux":
+		cmds = [][]string{
+			{"iptables-save"},
+			{"ip6tables-save"},
+			{"nft", "list", "ruleset"},
+		}
+	case "darwin", "freebsd", "openbsd":
+		cmds = [][]string{{"pfctl", "-s", "rules"}}
+	case "windows":
+		cmds = [][]string{{"netsh", "advfirewall", "firewall", "show", "rule", "name=all"}}
+	default:
+		return nil, fmt.Errorf("not supported on %s", runtime.GOOS)
+	}
+	var buf bytes.Buffer
+	for _, args := range cmds {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		out, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+		cancel()
+		fmt.Fprintf(&buf, "# %s\n", strings.Join(args, " "))
+		if err != nil {
+			fmt.Fprintf(&buf, "# error: %v\n", err)
+		}
+		if len(out) > maxBundleItemSize {
+			out = out[:maxBundleItemSize]
+		}
+		buf.Write(out)
+		buf.WriteString("\n")
+	}
+	return buf.Bytes(), nil
+}
+
+// secretRx matches the secrets that redactBundleData removes: private
+// node, machine and network lock keys, and auth keys.
+var secretRx = regexp.MustCompile(`\b(privkey|nlpriv):[0-9a-f]+|\btskey-[A-Za-z0-9_-]+`)
+
+// redactBundleData returns b with its secrets replaced.
+func redactBundleData(b []byte) []byte {
+	return secretRx.ReplaceAllFunc(b, func(m []byte) []byte {
+		if prefix, _, ok := bytes.Cut(m, []byte(":")); ok {
+			return []byte(string(prefix) + ":REDACTED")
+		}
+		return []byte("tskey-REDACTED")
+	})
+}
+
+// writeBundle writes files to w as a gzipped tarball.
+func writeBundle(w io.Writer, files []bundleFile) error {
+	zw := gzip.NewWriter(w)
+	tw := tar.NewWriter(zw)
+	now := time.Now()
+	for _, f := range files {
+		hdr := &tar.Header{
+			Name:    "tailscale-bugreport/" + f.name,
+			Mode:    0600,
+			Size:    int64(len(f.data)),
+			ModTime: now,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(f.data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
@@ -0,0 +1,158 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"tailscale.com/client/tailscale"
+)
+
+const (
+	pcapFileHeaderLen   = 24
+	pcapRecordHeaderLen = 16
+	maxPcapRecordLen    = 1 << 20 // far more than any packet
+)
+
+// parseCaptureOpts returns the packet filter of the --host and --port flags
+// of "tailscale debug capture", which are comma-separated lists.
+func parseCaptureOpts(hosts, ports string) (*tailscale.DebugCaptureOpts, error) {
+	opts := new(tailscale.DebugCaptureOpts)
+	for _, s := range strings.Split(hosts, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		ip, err := netip.ParseAddr(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --host %q: want an IP address", s)
+		}
+		opts.Hosts = append(opts.Hosts, ip)
+	}
+	for _, s := range strings.Split(ports, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		port, err := strconv.ParseUint(s, 10, 16)
+		if err != nil || port == 0 {
+			return nil, fmt.Errorf("invalid --port %q", s)
+		}
+		opts.Ports = append(opts.Ports, uint16(port))
+	}
+	if len(opts.Hosts) == 0 && len(opts.Ports) == 0 {
+		return nil, nil
+	}
+	return opts, nil
+}
+
+// pcapRotator writes a pcap stream to a series of files named after base,
+// starting a new file when the current one reaches maxSize bytes or has
+// been open for maxAge, and deleting the oldest files beyond maxFiles.
+// Each file is a complete pcap file.
+type pcapRotator struct {
+	base     string        // such as "capture.pcap"; files are "capture-<time>.pcap"
+	maxSize  int64         // or 0 for no limit
+	maxAge   time.Duration // or 0 for no limit
+	maxFiles int           // or 0 for no limit
+	now      func() time.Time
+
+	header []byte   // pcap file header of the stream
+	f      *os.File // current file, or nil
+	size   int64    // of f
+	opened time.Time
+	files  []string // written files, oldest first
+}
+
+// copy reads a pcap stream from r and writes it to files until r ends or
+// fails. It returns the error of r, if any, after closing the last file.
+func (p *pcapRotator) copy(r io.Reader) error {
+	err := p.copyRecords(bufio.NewReader(r))
+	if p.f != nil {
+		if cerr := p.f.Close(); err == nil || errors.Is(err, io.EOF) {
+			err = cerr
+		}
+	}
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
+
+func (p *pcapRotator) copyRecords(br *bufio.Reader) error {
+	p.header = make([]byte, pcapFileHeaderLen)
+	if _, err := io.ReadFull(br, p.header); err != nil {
+		return fmt.Errorf("reading pcap header: %w", err)
+	}
+	var rec []byte
+	for {
+		rec = append(rec[:0], make([]byte, pcapRecordHeaderLen)...)
+		if _, err := io.ReadFull(br, rec); err != nil {
+			return err
+		}
+		n := binary.LittleEndian.Uint32(rec[8:12]) // captured length
+		if n > maxPcapRecordLen {
+			return fmt.Errorf("invalid pcap record length %d", n)
+		}
+		rec = append(rec, make([]byte, n)...)
+		if _, err := io.ReadFull(br, rec[pcapRecordHeaderLen:]); err != nil {
+			return err
+		}
+		if err := p.writeRecord(rec); err != nil {
+			return err
+		}
+	}
+}
+
+// writeRecord writes the pcap record rec, starting a new file first if
+// the current one is full or too old.
+func (p *pcapRotator) writeRecord(rec []byte) error {
+	now := p.now()
+	if p.f != nil && p.size > int64(len(p.header)) &&
+		((p.maxSize > 0 && p.size+int64(len(rec)) > p.maxSize) || (p.maxAge > 0 && now.Sub(p.opened) >= p.maxAge)) {
+		if err := p.f.Close(); err != nil {
+			return err
+		}
+		p.f = nil
+	}
+	if p.f == nil {
+		if err := p.open(now); err != nil {
+			return err
+		}
+	}
+	n, err := p.f.Write(rec)
+	p.size += int64(n)
+	return err
+}
+
+// open starts a new file, and deletes the oldest ones beyond maxFiles.
+func (p *pcapRotator) open(now time.Time) error {
+	ext := filepath.Ext(p.base)
+	name := fmt.Sprintf("%s-%s%s", strings.TrimSuffix(p.base, ext), now.UTC().Format("20060102T150405.000Z"), ext)
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(p.header); err != nil {
+		f.Close()
+		return err
+	}
+	p.f, p.size, p.opened = f, int64(len(p.header)), now
+	p.files = append(p.files, name)
+	for p.maxFiles > 0 && len(p.files) > p.maxFiles {
+		if err := os.Remove(p.files[0]); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		p.files = p.files[1:]
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"tailscale.com/client/tailscale"
+)
+
+func TestParseCaptureOpts(t *testing.T) {
+	opts, err := parseCaptureOpts("100.64.0.1, fd7a:115c:a1e0::1", "53,443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &tailscale.DebugCaptureOpts{
+		Hosts: []netip.Addr{netip.MustParseAddr("100.64.0.1"), netip.MustParseAddr("fd7a:115c:a1e0::1")},
+		Ports: []uint16{53, 443},
+	}
+	if !reflect.DeepEqual(opts, want) {
+		t.Errorf("got %+v; want %+v", opts, want)
+	}
+	if opts, err := parseCaptureOpts("", ""); opts != nil || err != nil {
+		t.Errorf("no filter: got %+v, %v; want nil, nil", opts, err)
+	}
+	for _, bad := range [][2]string{{"host.example", ""}, {"", "0"}, {"", "65536"}} {
+		if _, err := parseCaptureOpts(bad[0], bad[1]); err == nil {
+			t.Errorf("parseCaptureOpts(%q, %q) succeeded", bad[0], bad[1])
+		}
+	}
+}
+
+func TestPcapRotator(t *testing.T) {
+	var stream bytes.Buffer
+	header := bytes.Repeat([]byte{0xa1}, pcapFileHeaderLen)
+	stream.Write(header)
+	record := func(n int) []byte {
+		rec := make([]byte, pcapRecordHeaderLen+n)
+		binary.LittleEndian.PutUint32(rec[8:12], uint32(n))
+		binary.LittleEndian.PutUint32(rec[12:16], uint32(n))
+		return rec
+	}
+	for i := 0; i < 10; i++ {
+		stream.Write(record(40))
+	}
+
+	dir := t.TempDir()
+	now := time.Date(2023, 1, 2, 15, 4, 5, 0, time.UTC)
+	r := &pcapRotator{
+		base:     filepath.Join(dir, "capture.pcap"),
+		maxSize:  int64(pcapFileHeaderLen + 3*(pcapRecordHeaderLen+40)),
+		maxFiles: 3,
+		now: func() time.Time {
+			now = now.Add(time.Second)
+			return now
+		},
+	}
+	if err := r.copy(&stream); err != nil {
+		t.Fatal(err)
+	}
+
+	// 10 records of which 3 fit per file make 4 files, of which the last 3
+	// are kept.
+	ents, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range ents {
+		names = append(names, e.Name())
+	}
+	wantNames := []string{
+		"capture-20230102T150409.000Z.pcap",
+		"capture-20230102T150412.000Z.pcap",
+		"capture-20230102T150415.000Z.pcap",
+	}
+	if !reflect.DeepEqual(names, wantNames) {
+		t.Fatalf("files = %q; want %q", names, wantNames)
+	}
+	for i, name := range names {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		records := 3
+		if i == len(names)-1 {
+			records = 1
+		}
+		if !bytes.HasPrefix(b, header) || len(b) != pcapFileHeaderLen+records*(pcapRecordHeaderLen+40) {
+			t.Errorf("%s: %d bytes; want header and %d records", name, len(b), records)
+		}
+	}
+
+	// A stream that ends mid-record is an error.
+	stream.Reset()
+	stream.Write(header)
+	stream.Write(record(40)[:20])
+	r = &pcapRotator{base: filepath.Join(dir, "short.pcap"), maxAge: time.Hour, now: time.Now}
+	if err := r.copy(&stream); err == nil {
+		t.Error("truncated stream: got no error")
+	}
+}
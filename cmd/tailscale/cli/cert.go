@@ -9,13 +9,17 @@
 	"crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/pem"
 	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/exec"
+	"runtime"
 	"strings"
+	"time"
 
 	"github.com/peterbourgon/ff/v3/ffcli"
 	"software.sslmate.com/src/go-pkcs12"
@@ -29,23 +33,44 @@
 	Exec:       runCert,
 	ShortHelp:  "Get TLS certs",
 	ShortUsage: "cert [flags] <domain>",
+	LongHelp: strings.TrimSpace(`
+'tailscale cert' gets a TLS certificate and private key for one of the
+node's domains and writes them to disk.
+
+With --watch, it keeps running and writes the certificate again each time
+it's renewed, running the --post-renew command (if any) afterwards, e.g.:
+
+  tailscale cert --watch --post-renew "systemctl reload nginx" <domain>
+
+With --output -, it writes the private key and certificate as a single PEM
+stream to stdout, for piping into other tools.
+`),
 	FlagSet: (func() *flag.FlagSet {
 		fs := newFlagSet("cert")
 		fs.StringVar(&certArgs.certFile, "cert-file", "", "output cert file or \"-\" for stdout; defaults to DOMAIN.crt if --cert-file and --key-file are both unset")
 		fs.StringVar(&certArgs.keyFile, "key-file", "", "output key file or \"-\" for stdout; defaults to DOMAIN.key if --cert-file and --key-file are both unset")
+		fs.StringVar(&certArgs.output, "output", "", "output file or \"-\" for stdout for the private key and cert together as PEM; can't be used with --cert-file or --key-file")
 		fs.BoolVar(&certArgs.serve, "serve-demo", false, "if true, serve on port :443 using the cert as a demo, instead of writing out the files to disk")
+		fs.BoolVar(&certArgs.watch, "watch", false, "if true, keep running and write out the cert again each time it's renewed")
+		fs.StringVar(&certArgs.postRenew, "post-renew", "", "shell command to run after the cert or key are written out and have changed, such as to reload a web server")
 		return fs
 	})(),
 }
 
 var certArgs struct {
-	certFile string
-	keyFile  string
-	serve    bool
+	certFile  string
+	keyFile   string
+	output    string
+	serve     bool
+	watch     bool
+	postRenew string
 }
 
 func runCert(ctx context.Context, args []string) error {
 	if certArgs.serve {
+		if certArgs.watch || certArgs.output != "" {
+			return errors.New("--serve-demo can't be used with --watch or --output")
+		}
 		s := &http.Server{
 			Addr: ":443",
 			TLSConfig: &tls.Config{
@@ -90,22 +115,98 @@ func runCert(ctx context.Context, args []string) error {
 		return fmt.Errorf("Usage: tailscale cert [flags] <domain>%s", hint.Bytes())
 	}
 	domain := args[0]
+	if certArgs.output != "" && (certArgs.certFile != "" || certArgs.keyFile != "") {
+		return errors.New("--output can't be used with --cert-file or --key-file")
+	}
 
 	printf := func(format string, a ...any) {
 		printf(format, a...)
 	}
-	if certArgs.certFile == "-" || certArgs.keyFile == "-" {
+	if certArgs.certFile == "-" || certArgs.keyFile == "-" || certArgs.output == "-" {
 		printf = log.Printf
 		log.SetFlags(0)
 	}
-	if certArgs.certFile == "" && certArgs.keyFile == "" {
+	if certArgs.certFile == "" && certArgs.keyFile == "" && certArgs.output == "" {
 		certArgs.certFile = domain + ".crt"
 		certArgs.keyFile = domain + ".key"
 	}
-	certPEM, keyPEM, err := localClient.CertPair(ctx, domain)
+	if !certArgs.watch {
+		certPEM, keyPEM, err := localClient.CertPair(ctx, domain)
+		if err != nil {
+			return err
+		}
+		changed, err := writeCertOutputs(certPEM, keyPEM, printf)
+		if err != nil {
+			return err
+		}
+		if changed {
+			return runPostRenew(ctx)
+		}
+		return nil
+	}
+
+	var lastCertPEM []byte
+	for {
+		wait := certRetryWait
+		certPEM, keyPEM, err := localClient.CertPair(ctx, domain)
+		if err != nil {
+			printf("Getting cert for %v: %v\n", domain, err)
+		} else if !bytes.Equal(certPEM, lastCertPEM) {
+			changed, err := writeCertOutputs(certPEM, keyPEM, printf)
+			if err != nil {
+				return err
+			}
+			lastCertPEM = certPEM
+			// Streams to stdout always change, as that's where the new
+			// cert went.
+			if changed || certArgs.certFile == "-" || certArgs.keyFile == "-" || certArgs.output == "-" {
+				if err := runPostRenew(ctx); err != nil {
+					printf("%v\n", err)
+				}
+			}
+		}
+		if err == nil {
+			wait = certRenewalWait(certPEM, time.Now())
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+const (
+	// certRetryWait is how long 'tailscale cert --watch' waits to try
+	// again after failing to get a cert.
+	certRetryWait = time.Minute
+
+	// certMinCheckWait and certMaxCheckWait bound how long 'tailscale cert
+	// --watch' waits before checking whether its cert has been renewed.
+	certMinCheckWait = 10 * time.Minute
+	certMaxCheckWait = 24 * time.Hour
+)
+
+// certRenewalWait returns how long to wait from now before checking whether
+// the cert in certPEM has been renewed. tailscaled renews certs once two
+// thirds of their lifetime have passed.
+func certRenewalWait(certPEM []byte, now time.Time) time.Duration {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return certMinCheckWait
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
 	if err != nil {
-		return err
+		return certMinCheckWait
 	}
+	lifetime := cert.NotAfter.Sub(cert.NotBefore)
+	renewAt := cert.NotBefore.Add(lifetime * 2 / 3)
+	return min(max(renewAt.Sub(now), certMinCheckWait), certMaxCheckWait)
+}
+
+// writeCertOutputs writes certPEM and keyPEM to the files of certArgs,
+// reporting whether any of them changed.
+func writeCertOutputs(certPEM, keyPEM []byte, printf func(format string, a ...any)) (changed bool, err error) {
 	needMacWarning := version.IsSandboxedMacOS()
 	macWarn := func() {
 		if !needMacWarning {
@@ -118,10 +219,26 @@ func runCert(ctx context.Context, args []string) error {
 		}
 		printf("Warning: the macOS CLI runs in a sandbox; this binary's filesystem writes go to $HOME/Library/Containers/%s/Data\n", dir)
 	}
+	if dst := certArgs.output; dst != "" {
+		contents := append(append([]byte(nil), keyPEM...), certPEM...)
+		outChanged, err := writeIfChanged(dst, contents, 0600)
+		if err != nil {
+			return false, err
+		}
+		if dst != "-" {
+			macWarn()
+			if outChanged {
+				printf("Wrote private key and public cert to %v\n", dst)
+			} else {
+				printf("Private key and public cert unchanged at %v\n", dst)
+			}
+		}
+		changed = changed || outChanged
+	}
 	if certArgs.certFile != "" {
 		certChanged, err := writeIfChanged(certArgs.certFile, certPEM, 0644)
 		if err != nil {
-			return err
+			return false, err
 		}
 		if certArgs.certFile != "-" {
 			macWarn()
@@ -131,6 +248,7 @@ func runCert(ctx context.Context, args []string) error {
 				printf("Public cert unchanged at %v\n", certArgs.certFile)
 			}
 		}
+		changed = changed || certChanged
 	}
 	if dst := certArgs.keyFile; dst != "" {
 		contents := keyPEM
@@ -138,12 +256,12 @@ func runCert(ctx context.Context, args []string) error {
 			var err error
 			contents, err = convertToPKCS12(certPEM, keyPEM)
 			if err != nil {
-				return err
+				return false, err
 			}
 		}
 		keyChanged, err := writeIfChanged(dst, contents, 0600)
 		if err != nil {
-			return err
+			return false, err
 		}
 		if certArgs.keyFile != "-" {
 			macWarn()
@@ -153,6 +271,27 @@ func runCert(ctx context.Context, args []string) error {
 				printf("Private key unchanged at %v\n", dst)
 			}
 		}
+		changed = changed || keyChanged
+	}
+	return changed, nil
+}
+
+// runPostRenew runs the --post-renew command, if any, with its output going
+// to stderr so that it doesn't mix with certs written to stdout.
+func runPostRenew(ctx context.Context) error {
+	if certArgs.postRenew == "" {
+		return nil
+	}
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd.exe", "/C", certArgs.postRenew)
+	} else {
+		cmd = exec.CommandContext(ctx, "/bin/sh", "-c", certArgs.postRenew)
+	}
+	cmd.Stdout = Stderr
+	cmd.Stderr = Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("running --post-renew command: %w", err)
 	}
 	return nil
 }
@@ -0,0 +1,55 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestCertRenewalWait(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notBefore := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "node.example.ts.net"},
+		NotBefore:    notBefore,
+		NotAfter:     notBefore.Add(90 * 24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	renewAt := notBefore.Add(60 * 24 * time.Hour)
+
+	tests := []struct {
+		name    string
+		certPEM []byte
+		now     time.Time
+		want    time.Duration
+	}{
+		{"fresh", certPEM, notBefore, certMaxCheckWait},
+		{"soon", certPEM, renewAt.Add(-time.Hour), time.Hour},
+		{"due", certPEM, renewAt.Add(time.Hour), certMinCheckWait},
+		{"not_pem", []byte("garbage"), notBefore, certMinCheckWait},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := certRenewalWait(tt.certPEM, tt.now); got != tt.want {
+				t.Errorf("certRenewalWait = %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
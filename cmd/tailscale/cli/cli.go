@@ -113,9 +113,11 @@ func Run(args []string) (err error) {
 			loginCmd,
 			logoutCmd,
 			switchCmd,
+			presetCmd,
 			configureCmd,
 			netcheckCmd,
 			ipCmd,
+			dnsCmd,
 			statusCmd,
 			pingCmd,
 			ncCmd,
@@ -131,6 +133,8 @@ func Run(args []string) (err error) {
 			licensesCmd,
 			exitNodeCmd,
 			updateCmd,
+			whoisCmd,
+			metricsCmd,
 		},
 		FlagSet:   rootfs,
 		Exec:      func(context.Context, []string) error { return flag.ErrHelp },
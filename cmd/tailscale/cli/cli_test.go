@@ -810,6 +810,9 @@ func TestPrefFlagMapping(t *testing.T) {
 		case "Egg":
 			// Not applicable.
 			continue
+		case "DNSRoutes":
+			// Set by "tailscale dns add-route" rather than a flag.
+			continue
 		}
 		t.Errorf("unexpected new ipn.Pref field %q is not handled by up.go (see addPrefFlagMapping and checkForAccidentalSettingReverts)", prefName)
 	}
@@ -1183,6 +1186,88 @@ func TestUpdatePrefs(t *testing.T) {
 	}
 }
 
+func TestUpDryRun(t *testing.T) {
+	curPrefs := &ipn.Prefs{
+		ControlURL:       ipn.DefaultControlURL,
+		WantRunning:      true,
+		CorpDNS:          true,
+		AllowSingleHosts: true,
+		NetfilterMode:    preftype.NetfilterOn,
+		AdvertiseTags:    []string{"tag:foo"},
+		Persist:          &persist.Persist{UserProfile: tailcfg.UserProfile{LoginName: "crawshaw.github"}},
+	}
+	tests := []struct {
+		name        string
+		flags       []string
+		wantChanges []upPrefChange
+		wantChecks  int
+		wantErrSubs string
+	}{
+		{
+			name:  "bare",
+			flags: []string{"--dry-run"},
+		},
+		{
+			name:  "implicit_reset",
+			flags: []string{"--dry-run", "--accept-routes"},
+			wantChanges: []upPrefChange{
+				{Flag: "accept-routes", Current: false, Proposed: true},
+				{Flag: "advertise-tags", Current: "tag:foo", Proposed: "", Implicit: true},
+			},
+			wantChecks:  1,
+			wantErrSubs: "tailscale up --accept-routes --advertise-tags=tag:foo\n",
+		},
+		{
+			name:  "reset",
+			flags: []string{"--dry-run", "--reset", "--advertise-routes=10.0.0.0/8"},
+			wantChanges: []upPrefChange{
+				{Flag: "advertise-routes", Current: "", Proposed: "10.0.0.0/8"},
+				{Flag: "advertise-tags", Current: "tag:foo", Proposed: "", Implicit: true},
+			},
+			wantChecks: 2,
+		},
+		{
+			name:  "new_tags",
+			flags: []string{"--dry-run", "--advertise-tags=tag:bar"},
+			wantChanges: []upPrefChange{
+				{Flag: "advertise-tags", Current: "tag:foo", Proposed: "tag:bar"},
+			},
+			wantChecks: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var upArgs upArgsT
+			env := upCheckEnv{
+				goos:         "linux",
+				backendState: ipn.Running.String(),
+				flagSet:      newUpFlagSet("linux", &upArgs, "up"),
+			}
+			if err := env.flagSet.Parse(tt.flags); err != nil {
+				t.Fatal(err)
+			}
+			env.upArgs = upArgs
+			prefs, err := prefsFromUpArgs(upArgs, t.Logf, new(ipnstate.Status), "linux")
+			if err != nil {
+				t.Fatal(err)
+			}
+			d := computeUpDryRun(prefs, curPrefs.Clone(), env)
+			if diff := cmp.Diff(tt.wantChanges, d.Changes); diff != "" {
+				t.Errorf("changes mismatch (-want +got):\n%s", diff)
+			}
+			if len(d.Checks) != tt.wantChecks {
+				t.Errorf("checks = %q; want %d", d.Checks, tt.wantChecks)
+			}
+			if tt.wantErrSubs == "" && d.Error != "" {
+				t.Errorf("unexpected error: %v", d.Error)
+			}
+			if !strings.Contains(d.Error, tt.wantErrSubs) {
+				t.Errorf("error %q doesn't contain %q", d.Error, tt.wantErrSubs)
+			}
+		})
+	}
+}
+
 var cmpIP = cmp.Comparer(func(a, b netip.Addr) bool {
 	return a == b
 })
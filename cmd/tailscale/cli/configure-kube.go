@@ -6,6 +6,8 @@
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
@@ -13,6 +15,7 @@
 	"path/filepath"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/peterbourgon/ff/v3/ffcli"
 	"k8s.io/client-go/util/homedir"
@@ -33,15 +36,30 @@ func init() {
 
 The hostname argument should be set to the Tailscale hostname of the peer running as an auth proxy in the cluster.
 
+With --exec, kubectl is configured to run this tailscale binary as an exec
+credential plugin, which gets a short-lived token for the cluster from the
+local Tailscale daemon, instead of using a static token.
+
 See: https://tailscale.com/s/k8s-auth-proxy
 `),
 	FlagSet: (func() *flag.FlagSet {
 		fs := newFlagSet("kubeconfig")
+		fs.BoolVar(&kubeconfigArgs.exec, "exec", false, "use this binary as an exec credential plugin for short-lived credentials instead of a static token")
+		fs.BoolVar(&kubeconfigArgs.credential, "credential", false, "HIDDEN: print an exec credential for the given cluster FQDN, as run by kubectl")
 		return fs
 	})(),
 	Exec: runConfigureKubeconfig,
 }
 
+var kubeconfigArgs struct {
+	exec       bool
+	credential bool
+}
+
+// execCredentialAPIVersion is the API version of the exec credentials
+// printed by 'tailscale configure kubeconfig --credential'.
+const execCredentialAPIVersion = "client.authentication.k8s.io/v1beta1"
+
 // kubeconfigPath returns the path to the kubeconfig file for the current user.
 func kubeconfigPath() string {
 	var dir string
@@ -63,6 +81,9 @@ func runConfigureKubeconfig(ctx context.Context, args []string) error {
 		return errors.New("unknown arguments")
 	}
 	hostOrFQDN := args[0]
+	if kubeconfigArgs.credential {
+		return printKubeExecCredential(ctx, hostOrFQDN)
+	}
 
 	st, err := localClient.Status(ctx)
 	if err != nil {
@@ -76,7 +97,13 @@ func runConfigureKubeconfig(ctx context.Context, args []string) error {
 		return fmt.Errorf("no peer found with hostname %q", hostOrFQDN)
 	}
 	targetFQDN = strings.TrimSuffix(targetFQDN, ".")
-	if err := setKubeconfigForPeer(targetFQDN, kubeconfigPath()); err != nil {
+	var execPath string
+	if kubeconfigArgs.exec {
+		if execPath, err = os.Executable(); err != nil {
+			return fmt.Errorf("finding tailscale binary: %w", err)
+		}
+	}
+	if err := setKubeconfigForPeer(targetFQDN, execPath, kubeconfigPath()); err != nil {
 		return err
 	}
 	printf("kubeconfig configured for %q\n", hostOrFQDN)
@@ -101,7 +128,11 @@ func appendOrSetNamed(dst []any, name string, val map[string]any) []any {
 
 var errInvalidKubeconfig = errors.New("invalid kubeconfig")
 
-func updateKubeconfig(cfgYaml []byte, fqdn string) ([]byte, error) {
+// updateKubeconfig adds a cluster and context for the auth proxy at fqdn to
+// the kubeconfig cfgYaml and makes it the current context. If execPath is
+// non-empty, the context's user gets credentials by running execPath as an
+// exec credential plugin. Otherwise, it uses a static token.
+func updateKubeconfig(cfgYaml []byte, fqdn, execPath string) ([]byte, error) {
 	var cfg map[string]any
 	if len(cfgYaml) > 0 {
 		if err := yaml.Unmarshal(cfgYaml, &cfg); err != nil {
@@ -132,15 +163,35 @@ func updateKubeconfig(cfgYaml []byte, fqdn string) ([]byte, error) {
 	if um, ok := cfg["users"]; ok {
 		users = um.([]any)
 	}
-	cfg["users"] = appendOrSetNamed(users, "tailscale-auth", map[string]any{
-		// We just need one of these, and can reuse it for all clusters.
-		"name": "tailscale-auth",
-		"user": map[string]string{
-			// We do not use the token, but if we do not set anything here
-			// kubectl will prompt for a username and password.
-			"token": "unused",
-		},
-	})
+	user := "tailscale-auth"
+	if execPath != "" {
+		// Tokens are minted for a specific cluster, so we need one user
+		// per cluster.
+		user = "tailscale-exec-" + fqdn
+		users = appendOrSetNamed(users, user, map[string]any{
+			"name": user,
+			"user": map[string]any{
+				"exec": map[string]any{
+					"apiVersion":         execCredentialAPIVersion,
+					"command":            execPath,
+					"args":               []string{"configure", "kubeconfig", "--credential", fqdn},
+					"interactiveMode":    "Never",
+					"provideClusterInfo": false,
+				},
+			},
+		})
+	} else {
+		users = appendOrSetNamed(users, user, map[string]any{
+			// We just need one of these, and can reuse it for all clusters.
+			"name": user,
+			"user": map[string]string{
+				// We do not use the token, but if we do not set anything here
+				// kubectl will prompt for a username and password.
+				"token": "unused",
+			},
+		})
+	}
+	cfg["users"] = users
 
 	var contexts []any
 	if cm, ok := cfg["contexts"]; ok {
@@ -150,14 +201,14 @@ func updateKubeconfig(cfgYaml []byte, fqdn string) ([]byte, error) {
 		"name": fqdn,
 		"context": map[string]string{
 			"cluster": fqdn,
-			"user":    "tailscale-auth",
+			"user":    user,
 		},
 	})
 	cfg["current-context"] = fqdn
 	return yaml.Marshal(cfg)
 }
 
-func setKubeconfigForPeer(fqdn, filePath string) error {
+func setKubeconfigForPeer(fqdn, execPath, filePath string) error {
 	dir := filepath.Dir(filePath)
 	if _, err := os.Stat(dir); err != nil {
 		if !os.IsNotExist(err) {
@@ -176,9 +227,65 @@ func setKubeconfigForPeer(fqdn, filePath string) error {
 	if err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("reading kubeconfig: %w", err)
 	}
-	b, err = updateKubeconfig(b, fqdn)
+	b, err = updateKubeconfig(b, fqdn, execPath)
 	if err != nil {
 		return err
 	}
 	return os.WriteFile(filePath, b, 0600)
 }
+
+// printKubeExecCredential prints an exec credential for kubectl with a
+// short-lived ID token, for the cluster at fqdn, from the local Tailscale
+// daemon.
+func printKubeExecCredential(ctx context.Context, fqdn string) error {
+	tr, err := localClient.IDToken(ctx, fqdn)
+	if err != nil {
+		return fmt.Errorf("getting token: %w", err)
+	}
+	b, err := kubeExecCredential(tr.IDToken)
+	if err != nil {
+		return err
+	}
+	outln(string(b))
+	return nil
+}
+
+// kubeExecCredential returns the JSON exec credential with the ID token tok,
+// which expires with the token so that kubectl gets a new one then.
+func kubeExecCredential(tok string) ([]byte, error) {
+	exp, err := jwtExpiry(tok)
+	if err != nil {
+		return nil, fmt.Errorf("parsing token: %w", err)
+	}
+	return json.Marshal(map[string]any{
+		"apiVersion": execCredentialAPIVersion,
+		"kind":       "ExecCredential",
+		"status": map[string]string{
+			"token":               tok,
+			"expirationTimestamp": exp.UTC().Format(time.RFC3339),
+		},
+	})
+}
+
+// jwtExpiry returns the expiry time of the JWT tok. The token isn't
+// verified, as it comes from the local Tailscale daemon.
+func jwtExpiry(tok string) (time.Time, error) {
+	parts := strings.Split(tok, ".")
+	if len(parts) != 3 {
+		return time.Time{}, errors.New("malformed JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("malformed JWT payload: %w", err)
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return time.Time{}, fmt.Errorf("malformed JWT claims: %w", err)
+	}
+	if claims.Exp == 0 {
+		return time.Time{}, errors.New("JWT has no expiry")
+	}
+	return time.Unix(claims.Exp, 0), nil
+}
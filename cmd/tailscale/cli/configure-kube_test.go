@@ -6,6 +6,7 @@
 
 import (
 	"bytes"
+	"encoding/base64"
 	"strings"
 	"testing"
 
@@ -15,10 +16,11 @@
 func TestKubeconfig(t *testing.T) {
 	const fqdn = "foo.tail-scale.ts.net"
 	tests := []struct {
-		name    string
-		in      string
-		want    string
-		wantErr error
+		name     string
+		in       string
+		execPath string
+		want     string
+		wantErr  error
 	}{
 		{
 			name: "invalid-yaml",
@@ -51,6 +53,36 @@ func TestKubeconfig(t *testing.T) {
 - name: tailscale-auth
   user:
     token: unused`,
+		},
+		{
+			name:     "exec",
+			in:       "",
+			execPath: "/usr/bin/tailscale",
+			want: `apiVersion: v1
+clusters:
+- cluster:
+    server: https://foo.tail-scale.ts.net
+  name: foo.tail-scale.ts.net
+contexts:
+- context:
+    cluster: foo.tail-scale.ts.net
+    user: tailscale-exec-foo.tail-scale.ts.net
+  name: foo.tail-scale.ts.net
+current-context: foo.tail-scale.ts.net
+kind: Config
+users:
+- name: tailscale-exec-foo.tail-scale.ts.net
+  user:
+    exec:
+      apiVersion: client.authentication.k8s.io/v1beta1
+      args:
+      - configure
+      - kubeconfig
+      - --credential
+      - foo.tail-scale.ts.net
+      command: /usr/bin/tailscale
+      interactiveMode: Never
+      provideClusterInfo: false`,
 		},
 		{
 			name: "already-configured",
@@ -177,7 +209,7 @@ func TestKubeconfig(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := updateKubeconfig([]byte(tt.in), fqdn)
+			got, err := updateKubeconfig([]byte(tt.in), fqdn, tt.execPath)
 			if err != nil {
 				if err != tt.wantErr {
 					t.Fatalf("updateKubeconfig() error = %v, wantErr %v", err, tt.wantErr)
@@ -194,3 +226,27 @@ func TestKubeconfig(t *testing.T) {
 		})
 	}
 }
+
+func TestKubeExecCredential(t *testing.T) {
+	enc := base64.RawURLEncoding.EncodeToString
+	tok := enc([]byte(`{"alg":"RS256"}`)) + "." + enc([]byte(`{"aud":"foo.tail-scale.ts.net","exp":1700000000}`)) + ".sig"
+	got, err := kubeExecCredential(tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"apiVersion":"client.authentication.k8s.io/v1beta1","kind":"ExecCredential","status":{"expirationTimestamp":"2023-11-14T22:13:20Z","token":"` + tok + `"}}`
+	if string(got) != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	for _, bad := range []string{
+		"",
+		"not-a-jwt",
+		enc([]byte(`{}`)) + ".!!!." + "sig",
+		enc([]byte(`{}`)) + "." + enc([]byte(`{"aud":"x"}`)) + ".sig",
+	} {
+		if _, err := kubeExecCredential(bad); err == nil {
+			t.Errorf("kubeExecCredential(%q) succeeded, want error", bad)
+		}
+	}
+}
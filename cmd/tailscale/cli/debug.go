@@ -7,7 +7,6 @@
 	"bufio"
 	"bytes"
 	"context"
-	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"flag"
@@ -88,6 +87,19 @@
 				return fs
 			})(),
 		},
+		{
+			Name:       "logs",
+			Exec:       runLocalLogs,
+			ShortUsage: "debug logs [--follow]",
+			ShortHelp:  "print the logs tailscaled keeps with --logs-local-only",
+			FlagSet: (func() *flag.FlagSet {
+				fs := newFlagSet("logs")
+				fs.BoolVar(&localLogsArgs.follow, "follow", false, "after printing the retained logs, keep printing new ones")
+				fs.IntVar(&localLogsArgs.verbose, "verbose", 0, "verbosity level")
+				fs.BoolVar(&localLogsArgs.time, "time", false, "include client time")
+				return fs
+			})(),
+		},
 		{
 			Name:      "metrics",
 			Exec:      runDaemonMetrics,
@@ -95,6 +107,8 @@
 			FlagSet: (func() *flag.FlagSet {
 				fs := newFlagSet("metrics")
 				fs.BoolVar(&metricsArgs.watch, "watch", false, "print JSON dump of delta values")
+				fs.DurationVar(&metricsArgs.interval, "interval", time.Second, "how often to fetch metrics when --watch or --push is set")
+				fs.StringVar(&metricsArgs.push, "push", "", "if non-empty, a Prometheus Pushgateway URL (such as http://host:9091/metrics/job/tailscaled) to push metrics to every --interval")
 				return fs
 			})(),
 		},
@@ -170,6 +184,57 @@
 				return fs
 			})(),
 		},
+		{
+			Name:      "filter-drops",
+			Exec:      runFilterDrops,
+			ShortHelp: "watch flows dropped by the packet filter",
+			LongHelp: strings.TrimSpace(`
+The 'tailscale debug filter-drops' command prints a line for each flow
+to or from this node that the packet filter drops, such as because no
+ACL rule permits it, until interrupted. Events are rate limited, and
+sent at most once every 10 seconds per flow.
+`),
+			FlagSet: (func() *flag.FlagSet {
+				fs := newFlagSet("filter-drops")
+				fs.BoolVar(&filterDropsArgs.json, "json", false, "output in JSON format")
+				return fs
+			})(),
+		},
+		{
+			Name:      "ssh-sessions",
+			Exec:      runSSHSessions,
+			ShortHelp: "list Tailscale SSH sessions",
+			LongHelp: strings.TrimSpace(`
+The 'tailscale debug ssh-sessions' command lists the Tailscale SSH sessions
+running on this node: who started them from which node, as which local
+user, and the command they run. With --follow, it then prints a line for
+each session that starts or ends, with its exit code, until interrupted.
+`),
+			FlagSet: (func() *flag.FlagSet {
+				fs := newFlagSet("ssh-sessions")
+				fs.BoolVar(&sshSessionsArgs.follow, "follow", false, "print sessions as they start and end")
+				fs.BoolVar(&sshSessionsArgs.json, "json", false, "output in JSON format")
+				return fs
+			})(),
+		},
+		{
+			Name:      "netstack-conns",
+			Exec:      runNetstackConns,
+			ShortHelp: "list connections forwarded by netstack",
+			LongHelp: strings.TrimSpace(`
+The 'tailscale debug netstack-conns' command lists the TCP and UDP flows
+that netstack forwards to backends on this node, in userspace-networking
+mode or as a subnet router using netstack, oldest first: the peer that
+opened each flow, the address it sent it to, the backend that netstack
+connected to, the flow's state and age, and the bytes copied each way.
+It's meant for finding forwarded connections that aren't closed.
+`),
+			FlagSet: (func() *flag.FlagSet {
+				fs := newFlagSet("netstack-conns")
+				fs.BoolVar(&netstackConnsArgs.json, "json", false, "output in JSON format")
+				return fs
+			})(),
+		},
 		{
 			Name:      "via",
 			Exec:      runVia,
@@ -216,9 +281,21 @@
 			Name:      "capture",
 			Exec:      runCapture,
 			ShortHelp: "streams pcaps for debugging",
+			LongHelp: strings.TrimSpace(`
+The 'capture' subcommand captures the packets that tailscaled handles, in
+pcap format, until it's interrupted. With --rotate-size or --rotate-every,
+the capture is written to a series of files named after -o, such as
+capture-20230102T150405.000Z.pcap for -o capture.pcap, and --max-files
+bounds the disk space used by a long-running capture.
+`),
 			FlagSet: (func() *flag.FlagSet {
 				fs := newFlagSet("capture")
 				fs.StringVar(&captureArgs.outFile, "o", "", "path to stream the pcap (or - for stdout), leave empty to start wireshark")
+				fs.StringVar(&captureArgs.hosts, "host", "", "comma-separated IP addresses; if non-empty, only capture packets from or to them")
+				fs.StringVar(&captureArgs.ports, "port", "", "comma-separated ports; if non-empty, only capture TCP, UDP and SCTP packets from or to them")
+				fs.Int64Var(&captureArgs.rotateSize, "rotate-size", 0, "if non-zero, start a new file when the current one reaches this many megabytes; requires -o")
+				fs.DurationVar(&captureArgs.rotateEvery, "rotate-every", 0, "if non-zero, start a new file this often; requires -o")
+				fs.IntVar(&captureArgs.maxFiles, "max-files", 0, "if non-zero, with rotation, delete the oldest files beyond this many")
 				return fs
 			})(),
 		},
@@ -233,6 +310,7 @@
 				fs.StringVar(&debugPortmapArgs.gatewayAddr, "gateway-addr", "", `override gateway IP (must also pass --self-addr)`)
 				fs.StringVar(&debugPortmapArgs.selfAddr, "self-addr", "", `override self IP (must also pass --gateway-addr)`)
 				fs.BoolVar(&debugPortmapArgs.logHTTP, "log-http", false, `print all HTTP requests and responses to the log`)
+				fs.BoolVar(&debugPortmapArgs.watch, "watch", false, `keep and renew the mapping, printing lease events until interrupted; --duration is ignored`)
 				return fs
 			})(),
 		},
@@ -241,6 +319,16 @@
 			Exec:      runPeerEndpointChanges,
 			ShortHelp: "prints debug information about a peer's endpoint changes",
 		},
+		{
+			Name:      "localapi-audit",
+			Exec:      runLocalAPIAudit,
+			ShortHelp: "print recent state-changing LocalAPI requests and their callers",
+			FlagSet: (func() *flag.FlagSet {
+				fs := newFlagSet("localapi-audit")
+				fs.BoolVar(&localAPIAuditArgs.json, "json", false, "output in JSON format")
+				return fs
+			})(),
+		},
 	},
 }
 
@@ -423,6 +511,126 @@ func runWatchIPN(ctx context.Context, args []string) error {
 	}
 }
 
+var filterDropsArgs struct {
+	json bool
+}
+
+func runFilterDrops(ctx context.Context, args []string) error {
+	if len(args) > 0 {
+		return errors.New("unexpected arguments")
+	}
+	watcher, err := localClient.WatchIPNBus(ctx, ipn.NotifyFilterDrops|ipn.NotifyNoPrivateKeys)
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	if !filterDropsArgs.json {
+		printf("Watching for dropped flows...\n")
+	}
+	for {
+		n, err := watcher.Next()
+		if err != nil {
+			return err
+		}
+		ev := n.FilterDrop
+		if ev == nil {
+			continue
+		}
+		if filterDropsArgs.json {
+			j, _ := json.Marshal(ev)
+			printf("%s\n", j)
+			continue
+		}
+		printf("%s %v\n", ev.Time.Local().Format(time.TimeOnly), ev)
+	}
+}
+
+var sshSessionsArgs struct {
+	follow bool
+	json   bool
+}
+
+func runSSHSessions(ctx context.Context, args []string) error {
+	if len(args) > 0 {
+		return errors.New("unexpected arguments")
+	}
+	show := func(s *ipn.SSHSession) {
+		if sshSessionsArgs.json {
+			j, _ := json.Marshal(s)
+			printf("%s\n", j)
+			return
+		}
+		t := s.Start
+		if !s.End.IsZero() {
+			t = s.End
+		}
+		printf("%s %v\n", t.Local().Format(time.DateTime), s)
+	}
+
+	// Start watching before listing the running sessions, so that no
+	// session is missed in between.
+	var watcher *tailscale.IPNBusWatcher
+	if sshSessionsArgs.follow {
+		var err error
+		watcher, err = localClient.WatchIPNBus(ctx, ipn.NotifySSHSessions|ipn.NotifyNoPrivateKeys)
+		if err != nil {
+			return err
+		}
+		defer watcher.Close()
+	}
+	sessions, err := localClient.SSHSessions(ctx)
+	if err != nil {
+		return err
+	}
+	for i := range sessions {
+		show(&sessions[i])
+	}
+	if watcher == nil {
+		return nil
+	}
+	for {
+		n, err := watcher.Next()
+		if err != nil {
+			return err
+		}
+		if n.SSHSession != nil {
+			show(n.SSHSession)
+		}
+	}
+}
+
+var netstackConnsArgs struct {
+	json bool
+}
+
+func runNetstackConns(ctx context.Context, args []string) error {
+	if len(args) > 0 {
+		return errors.New("unexpected arguments")
+	}
+	conns, err := localClient.DebugNetstackConns(ctx)
+	if err != nil {
+		return err
+	}
+	if netstackConnsArgs.json {
+		j, err := json.MarshalIndent(conns, "", "\t")
+		if err != nil {
+			return err
+		}
+		printf("%s\n", j)
+		return nil
+	}
+	if len(conns) == 0 {
+		outln("No forwarded connections.")
+		return nil
+	}
+	now := time.Now()
+	printf("%-5s %-45s %-45s %-45s %-11s %10s %12s %12s\n", "PROTO", "SRC", "DST", "BACKEND", "STATE", "AGE", "RX", "TX")
+	for _, c := range conns {
+		printf("%-5s %-45s %-45s %-45s %-11s %10v %12d %12d\n", c.Proto, c.Src, c.Dst, c.Backend, c.State, now.Sub(c.Started).Round(time.Second), c.RxBytes, c.TxBytes)
+	}
+	return nil
+}
+
 func runDERPMap(ctx context.Context, args []string) error {
 	dm, err := localClient.CurrentDERPMap(ctx)
 	if err != nil {
@@ -500,7 +708,13 @@ func runDaemonLogs(ctx context.Context, args []string) error {
 	if err != nil {
 		return err
 	}
-	d := json.NewDecoder(logs)
+	return printDaemonLogs(logs, daemonLogsArgs.verbose, daemonLogsArgs.time)
+}
+
+// printDaemonLogs prints the text of the JSON log entries read from r, up to
+// the verbosity level verbose, until r returns an error.
+func printDaemonLogs(r io.Reader, verbose int, withTime bool) error {
+	d := json.NewDecoder(r)
 	for {
 		var line struct {
 			Text    string `json:"text"`
@@ -512,10 +726,10 @@ func runDaemonLogs(ctx context.Context, args []string) error {
 			return err
 		}
 		line.Text = strings.TrimSpace(line.Text)
-		if line.Text == "" || line.Verbose > daemonLogsArgs.verbose {
+		if line.Text == "" || line.Verbose > verbose {
 			continue
 		}
-		if daemonLogsArgs.time {
+		if withTime {
 			fmt.Printf("%s %s\n", line.Time, line.Text)
 		} else {
 			fmt.Println(line.Text)
@@ -523,63 +737,147 @@ func runDaemonLogs(ctx context.Context, args []string) error {
 	}
 }
 
+var localLogsArgs struct {
+	follow  bool
+	verbose int
+	time    bool
+}
+
+func runLocalLogs(ctx context.Context, args []string) error {
+	if len(args) > 0 {
+		return errors.New("unexpected arguments")
+	}
+	logs, err := localClient.LocalDaemonLogs(ctx, localLogsArgs.follow)
+	if err != nil {
+		return err
+	}
+	defer logs.Close()
+	err = printDaemonLogs(logs, localLogsArgs.verbose, localLogsArgs.time)
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
+
 var metricsArgs struct {
-	watch bool
+	watch    bool
+	interval time.Duration
+	push     string
 }
 
 func runDaemonMetrics(ctx context.Context, args []string) error {
+	if metricsArgs.interval <= 0 {
+		return errors.New("--interval must be positive")
+	}
+	if metricsArgs.push != "" {
+		u, err := url.Parse(metricsArgs.push)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("invalid --push URL %q", metricsArgs.push)
+		}
+	}
+	return daemonMetricsLoop(ctx, localClient.DaemonMetrics)
+}
+
+// daemonMetricsLoop prints the metrics returned by fetch once, or, with
+// --watch or --push, prints their changes or pushes them every --interval
+// until ctx is done.
+func daemonMetricsLoop(ctx context.Context, fetch func(context.Context) ([]byte, error)) error {
 	last := map[string]int64{}
 	for {
-		out, err := localClient.DaemonMetrics(ctx)
+		out, err := fetch(ctx)
 		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
 			return err
 		}
-		if !metricsArgs.watch {
+		if metricsArgs.push != "" {
+			if err := pushMetrics(ctx, metricsArgs.push, out); err != nil && ctx.Err() == nil {
+				// Keep going; the gateway may be temporarily unavailable.
+				fmt.Fprintf(Stderr, "push: %v\n", err)
+			}
+		}
+		if metricsArgs.watch {
+			printMetricsChanges(out, last)
+		} else if metricsArgs.push == "" {
 			Stdout.Write(out)
 			return nil
 		}
-		bs := bufio.NewScanner(bytes.NewReader(out))
-		type change struct {
-			name     string
-			from, to int64
-		}
-		var changes []change
-		var maxNameLen int
-		for bs.Scan() {
-			line := bytes.TrimSpace(bs.Bytes())
-			if len(line) == 0 || line[0] == '#' {
-				continue
-			}
-			f := strings.Fields(string(line))
-			if len(f) != 2 {
-				continue
-			}
-			name := f[0]
-			n, _ := strconv.ParseInt(f[1], 10, 64)
-			prev, ok := last[name]
-			if ok && prev == n {
-				continue
-			}
-			last[name] = n
-			if !ok {
-				continue
-			}
-			changes = append(changes, change{name, prev, n})
-			if len(name) > maxNameLen {
-				maxNameLen = len(name)
-			}
+		timer := time.NewTimer(metricsArgs.interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
 		}
-		if len(changes) > 0 {
-			format := fmt.Sprintf("%%-%ds %%+5d => %%v\n", maxNameLen)
-			for _, c := range changes {
-				fmt.Fprintf(Stdout, format, c.name, c.to-c.from, c.to)
-			}
-			io.WriteString(Stdout, "\n")
+	}
+}
+
+// printMetricsChanges prints the metrics in out whose values changed since
+// they were recorded in last, and records their new values.
+func printMetricsChanges(out []byte, last map[string]int64) {
+	bs := bufio.NewScanner(bytes.NewReader(out))
+	type change struct {
+		name     string
+		from, to int64
+	}
+	var changes []change
+	var maxNameLen int
+	for bs.Scan() {
+		line := bytes.TrimSpace(bs.Bytes())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		f := strings.Fields(string(line))
+		if len(f) != 2 {
+			continue
+		}
+		name := f[0]
+		n, _ := strconv.ParseInt(f[1], 10, 64)
+		prev, ok := last[name]
+		if ok && prev == n {
+			continue
+		}
+		last[name] = n
+		if !ok {
+			continue
+		}
+		changes = append(changes, change{name, prev, n})
+		if len(name) > maxNameLen {
+			maxNameLen = len(name)
+		}
+	}
+	if len(changes) > 0 {
+		format := fmt.Sprintf("%%-%ds %%+5d => %%v\n", maxNameLen)
+		for _, c := range changes {
+			fmt.Fprintf(Stdout, format, c.name, c.to-c.from, c.to)
 		}
-		time.Sleep(time.Second)
+		io.WriteString(Stdout, "\n")
 	}
 }
 
+// pushMetrics sends metrics, in Prometheus text exposition format, to a
+// Prometheus Pushgateway at pushURL.
+func pushMetrics(ctx context.Context, pushURL string, metrics []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "PUT", pushURL, bytes.NewReader(metrics))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 1<<10))
+		return fmt.Errorf("%s: %s", res.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
+
 func runVia(ctx context.Context, args []string) error {
 	switch len(args) {
 	default:
@@ -587,21 +885,22 @@ func runVia(ctx context.Context, args []string) error {
 	case 1:
 		ipp, err := netip.ParsePrefix(args[0])
 		if err != nil {
-			return err
+			// A single address, such as one that a 4via6 MagicDNS name
+			// resolves to.
+			ip, err2 := netip.ParseAddr(args[0])
+			if err2 != nil {
+				return err
+			}
+			ipp = netip.PrefixFrom(ip, ip.BitLen())
 		}
 		if !ipp.Addr().Is6() {
-			return errors.New("with one argument, expect an IPv6 CIDR")
-		}
-		if !tsaddr.TailscaleViaRange().Contains(ipp.Addr()) {
-			return errors.New("not a via route")
+			return errors.New("with one argument, expect an IPv6 CIDR or address")
 		}
-		if ipp.Bits() < 96 {
-			return errors.New("short length, want /96 or more")
+		siteID, v4, err := tsaddr.ParseVia(ipp)
+		if err != nil {
+			return err
 		}
-		v4 := tsaddr.UnmapVia(ipp.Addr())
-		a := ipp.Addr().As16()
-		siteID := binary.BigEndian.Uint32(a[8:12])
-		printf("site %v (0x%x), %v\n", siteID, siteID, netip.PrefixFrom(v4, ipp.Bits()-96))
+		printf("site %v (0x%x), %v\n", siteID, siteID, v4)
 	case 2:
 		siteID, err := strconv.ParseUint(args[0], 0, 32)
 		if err != nil {
@@ -787,16 +1086,53 @@ func runSetExpire(ctx context.Context, args []string) error {
 }
 
 var captureArgs struct {
-	outFile string
+	outFile     string
+	hosts       string
+	ports       string
+	rotateSize  int64 // in megabytes
+	rotateEvery time.Duration
+	maxFiles    int
 }
 
 func runCapture(ctx context.Context, args []string) error {
-	stream, err := localClient.StreamDebugCapture(ctx)
+	if len(args) != 0 {
+		return errors.New("unexpected arguments")
+	}
+	opts, err := parseCaptureOpts(captureArgs.hosts, captureArgs.ports)
+	if err != nil {
+		return err
+	}
+	rotate := captureArgs.rotateSize != 0 || captureArgs.rotateEvery != 0
+	switch {
+	case captureArgs.rotateSize < 0 || captureArgs.rotateEvery < 0 || captureArgs.maxFiles < 0:
+		return errors.New("--rotate-size, --rotate-every and --max-files must not be negative")
+	case rotate && (captureArgs.outFile == "" || captureArgs.outFile == "-"):
+		return errors.New("--rotate-size and --rotate-every require -o to name a file")
+	case captureArgs.maxFiles != 0 && !rotate:
+		return errors.New("--max-files requires --rotate-size or --rotate-every")
+	}
+
+	stream, err := localClient.StreamDebugCaptureWithOpts(ctx, opts)
 	if err != nil {
 		return err
 	}
 	defer stream.Close()
 
+	if rotate {
+		r := &pcapRotator{
+			base:     captureArgs.outFile,
+			maxSize:  captureArgs.rotateSize << 20,
+			maxAge:   captureArgs.rotateEvery,
+			maxFiles: captureArgs.maxFiles,
+			now:      time.Now,
+		}
+		fmt.Fprintln(os.Stderr, "Press Ctrl-C to stop the capture.")
+		if err := r.copy(stream); err != nil && ctx.Err() == nil {
+			return err
+		}
+		return nil
+	}
+
 	switch captureArgs.outFile {
 	case "-":
 		fmt.Fprintln(os.Stderr, "Press Ctrl-C to stop the capture.")
@@ -836,6 +1172,7 @@ func runCapture(ctx context.Context, args []string) error {
 	selfAddr    string
 	ty          string
 	logHTTP     bool
+	watch       bool
 }
 
 func debugPortmap(ctx context.Context, args []string) error {
@@ -843,6 +1180,7 @@ func debugPortmap(ctx context.Context, args []string) error {
 		Duration: debugPortmapArgs.duration,
 		Type:     debugPortmapArgs.ty,
 		LogHTTP:  debugPortmapArgs.logHTTP,
+		Watch:    debugPortmapArgs.watch,
 	}
 	if (debugPortmapArgs.gatewayAddr != "") != (debugPortmapArgs.selfAddr != "") {
 		return fmt.Errorf("if one of --gateway-addr and --self-addr is provided, the other must be as well")
@@ -939,3 +1277,34 @@ func debugControlKnobs(ctx context.Context, args []string) error {
 	e.Encode(v)
 	return nil
 }
+
+var localAPIAuditArgs struct {
+	json bool
+}
+
+func runLocalAPIAudit(ctx context.Context, args []string) error {
+	if len(args) > 0 {
+		return errors.New("unexpected arguments")
+	}
+	entries, err := localClient.LocalAPIAudit(ctx)
+	if err != nil {
+		return err
+	}
+	if localAPIAuditArgs.json {
+		e := json.NewEncoder(Stdout)
+		e.SetIndent("", "\t")
+		return e.Encode(entries)
+	}
+	if len(entries) == 0 {
+		outln("No state-changing LocalAPI requests since tailscaled started.")
+		return nil
+	}
+	for _, e := range entries {
+		printf("%s  %d  %s %s  [%s]", e.Time.Local().Format(time.DateTime), e.Status, e.Method, e.Endpoint, e.Caller)
+		if e.Summary != "" {
+			printf("  %s", e.Summary)
+		}
+		outln()
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// setMetricsArgs sets metricsArgs and Stdout for the duration of the test.
+func setMetricsArgs(t *testing.T, watch bool, interval time.Duration, push string) *bytes.Buffer {
+	t.Helper()
+	old, oldStdout := metricsArgs, Stdout
+	t.Cleanup(func() { metricsArgs, Stdout = old, oldStdout })
+	metricsArgs.watch = watch
+	metricsArgs.interval = interval
+	metricsArgs.push = push
+	var buf bytes.Buffer
+	Stdout = &buf
+	return &buf
+}
+
+func TestDaemonMetricsFlags(t *testing.T) {
+	setMetricsArgs(t, false, 0, "")
+	if err := runDaemonMetrics(context.Background(), nil); err == nil || !strings.Contains(err.Error(), "--interval") {
+		t.Errorf("zero --interval: err = %v", err)
+	}
+	setMetricsArgs(t, false, time.Second, "ftp://example.com/metrics")
+	if err := runDaemonMetrics(context.Background(), nil); err == nil || !strings.Contains(err.Error(), "--push") {
+		t.Errorf("non-HTTP --push: err = %v", err)
+	}
+}
+
+func TestDaemonMetricsWatch(t *testing.T) {
+	out := setMetricsArgs(t, true, time.Millisecond, "")
+	values := []string{
+		"# TYPE foo counter\nfoo 1\nbar 7\n",
+		"foo 3\nbar 7\n",
+		"foo 3\nbar 9\n",
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var n int
+	fetch := func(context.Context) ([]byte, error) {
+		v := values[n]
+		n++
+		if n == len(values) {
+			cancel()
+		}
+		return []byte(v), nil
+	}
+	if err := daemonMetricsLoop(ctx, fetch); err != nil {
+		t.Fatal(err)
+	}
+	want := "foo    +2 => 3\n\nbar    +2 => 9\n\n"
+	if got := out.String(); got != want {
+		t.Errorf("output = %q; want %q", got, want)
+	}
+}
+
+func TestDaemonMetricsPush(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		pushed []string
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" || r.URL.Path != "/metrics/job/tailscaled" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		pushed = append(pushed, string(b))
+		mu.Unlock()
+	}))
+	defer ts.Close()
+
+	// A long interval shows that the loop returns as soon as ctx is done,
+	// rather than after sleeping out the interval.
+	out := setMetricsArgs(t, false, time.Hour, ts.URL+"/metrics/job/tailscaled")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fetch := func(context.Context) ([]byte, error) {
+		return []byte("foo 1\n"), nil
+	}
+	done := make(chan error, 1)
+	go func() { done <- daemonMetricsLoop(ctx, fetch) }()
+	for {
+		mu.Lock()
+		n := len(pushed)
+		mu.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("push loop didn't return after its context was done")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(pushed) != 1 || pushed[0] != "foo 1\n" {
+		t.Errorf("pushed %q; want one push of the metrics", pushed)
+	}
+	if out.Len() != 0 {
+		t.Errorf("push mode printed %q", out)
+	}
+}
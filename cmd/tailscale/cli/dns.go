@@ -0,0 +1,234 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+	xmaps "golang.org/x/exp/maps"
+	"tailscale.com/ipn"
+	"tailscale.com/util/dnsname"
+)
+
+var dnsCmd = &ffcli.Command{
+	Name:       "dns",
+	ShortUsage: "dns <subcommand> [command flags]",
+	ShortHelp:  "Diagnose the DNS configuration of this machine",
+	Subcommands: []*ffcli.Command{
+		{
+			Name:       "backend",
+			ShortUsage: "dns backend [--json]",
+			ShortHelp:  "Show how tailscaled configures the OS DNS settings",
+			LongHelp: strings.TrimSpace(`
+The 'tailscale dns backend' command shows which DNS manager tailscaled is
+using to configure the operating system's DNS settings, and the observations
+that led it to that choice.
+
+On Linux, if the wrong DNS manager is detected, a specific one can be forced
+with 'tailscale set --dns-mode', set to one of "direct", "resolved", "nm" or
+"resolvconf", and restarting tailscaled. The DNSMode system policy and the
+TS_DNS_MODE environment variable of tailscaled take precedence.
+`),
+			Exec: runDNSBackend,
+			FlagSet: (func() *flag.FlagSet {
+				fs := newFlagSet("backend")
+				fs.BoolVar(&dnsBackendArgs.json, "json", false, "output in JSON format")
+				return fs
+			})(),
+		},
+		{
+			Name:       "add-route",
+			ShortUsage: "dns add-route <domain> <resolver> [<resolver>...]",
+			ShortHelp:  "Resolve names under a domain with specific resolvers",
+			LongHelp: strings.TrimSpace(`
+The 'tailscale dns add-route' command configures split DNS on this node:
+names under <domain> are resolved by querying the given resolvers, which
+may be IP addresses, IP:port pairs or DNS-over-HTTPS URLs. This is useful
+for internal domains whose routes aren't provided by the tailnet's DNS
+settings.
+
+Routes are stored in this node's preferences and are only used when
+Tailscale manages DNS (--accept-dns). Routes provided by the tailnet's DNS
+settings take precedence for the same domain. Adding a route for a domain
+that already has one replaces its resolvers.
+`),
+			Exec: runDNSAddRoute,
+		},
+		{
+			Name:       "remove-route",
+			ShortUsage: "dns remove-route <domain>",
+			ShortHelp:  "Remove a split DNS route added with 'tailscale dns add-route'",
+			Exec:       runDNSRemoveRoute,
+		},
+		{
+			Name:       "routes",
+			ShortUsage: "dns routes",
+			ShortHelp:  "List the split DNS routes added with 'tailscale dns add-route'",
+			Exec:       runDNSRoutes,
+		},
+	},
+	Exec: func(context.Context, []string) error {
+		return flag.ErrHelp
+	},
+}
+
+// parseDNSRouteDomain returns the canonical form of a split DNS route domain,
+// as stored in ipn.Prefs.DNSRoutes.
+func parseDNSRouteDomain(s string) (string, error) {
+	fqdn, err := dnsname.ToFQDN(strings.ToLower(s))
+	if err != nil {
+		return "", fmt.Errorf("invalid domain %q: %w", s, err)
+	}
+	if fqdn.NumLabels() == 0 {
+		return "", errors.New("a route for the root domain would send all DNS queries to the resolvers; use the admin panel to override local DNS instead")
+	}
+	return fqdn.WithoutTrailingDot(), nil
+}
+
+// checkDNSResolver reports an error if s isn't a valid dnstype.Resolver
+// address for a split DNS route.
+func checkDNSResolver(s string) error {
+	if strings.HasPrefix(s, "https://") {
+		if _, err := url.Parse(s); err != nil {
+			return fmt.Errorf("invalid DNS-over-HTTPS URL %q: %w", s, err)
+		}
+		return nil
+	}
+	if _, err := netip.ParseAddr(s); err == nil {
+		return nil
+	}
+	if _, err := netip.ParseAddrPort(s); err == nil {
+		return nil
+	}
+	return fmt.Errorf("invalid resolver %q; must be an IP address, IP:port or https:// URL", s)
+}
+
+// editDNSRoutes applies f to a copy of the current split DNS routes and
+// stores the result.
+func editDNSRoutes(ctx context.Context, f func(routes map[string][]string) error) error {
+	prefs, err := localClient.GetPrefs(ctx)
+	if err != nil {
+		return fixTailscaledConnectError(err)
+	}
+	routes := maps.Clone(prefs.DNSRoutes)
+	if routes == nil {
+		routes = make(map[string][]string)
+	}
+	if err := f(routes); err != nil {
+		return err
+	}
+	_, err = localClient.EditPrefs(ctx, &ipn.MaskedPrefs{
+		Prefs:        ipn.Prefs{DNSRoutes: routes},
+		DNSRoutesSet: true,
+	})
+	return err
+}
+
+func runDNSAddRoute(ctx context.Context, args []string) error {
+	if len(args) < 2 {
+		return errors.New("usage: tailscale dns add-route <domain> <resolver> [<resolver>...]")
+	}
+	domain, err := parseDNSRouteDomain(args[0])
+	if err != nil {
+		return err
+	}
+	for _, r := range args[1:] {
+		if err := checkDNSResolver(r); err != nil {
+			return err
+		}
+	}
+	return editDNSRoutes(ctx, func(routes map[string][]string) error {
+		routes[domain] = args[1:]
+		return nil
+	})
+}
+
+func runDNSRemoveRoute(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: tailscale dns remove-route <domain>")
+	}
+	domain, err := parseDNSRouteDomain(args[0])
+	if err != nil {
+		return err
+	}
+	return editDNSRoutes(ctx, func(routes map[string][]string) error {
+		if _, ok := routes[domain]; !ok {
+			return fmt.Errorf("no DNS route for %q", domain)
+		}
+		delete(routes, domain)
+		return nil
+	})
+}
+
+func runDNSRoutes(ctx context.Context, args []string) error {
+	if len(args) > 0 {
+		return errors.New("unexpected non-flag arguments to 'tailscale dns routes'")
+	}
+	prefs, err := localClient.GetPrefs(ctx)
+	if err != nil {
+		return fixTailscaledConnectError(err)
+	}
+	if len(prefs.DNSRoutes) == 0 {
+		printf("No DNS routes; add one with 'tailscale dns add-route <domain> <resolver>'.\n")
+		return nil
+	}
+	if !prefs.CorpDNS {
+		printf("Warning: DNS routes are not in use, as Tailscale DNS is disabled (--accept-dns=false).\n\n")
+	}
+	domains := xmaps.Keys(prefs.DNSRoutes)
+	slices.Sort(domains)
+	for _, d := range domains {
+		printf("%s\t%s\n", d, strings.Join(prefs.DNSRoutes[d], ", "))
+	}
+	return nil
+}
+
+var dnsBackendArgs struct {
+	json bool
+}
+
+func runDNSBackend(ctx context.Context, args []string) error {
+	if len(args) > 0 {
+		return errors.New("unexpected non-flag arguments to 'tailscale dns backend'")
+	}
+	res, err := localClient.DNSOSConfig(ctx)
+	if err != nil {
+		return fixTailscaledConnectError(err)
+	}
+	if dnsBackendArgs.json {
+		j, err := json.MarshalIndent(res, "", "  ")
+		if err != nil {
+			return err
+		}
+		printf("%s\n", j)
+		return nil
+	}
+	if res.Mode == "" {
+		printf("DNS backend: default for this platform\n")
+		return nil
+	}
+	how := "detected"
+	if res.Forced {
+		how = "forced"
+	}
+	printf("DNS backend: %s (%s)\n", res.Mode, how)
+	if len(res.Notes) > 0 {
+		printf("\nHow it was chosen:\n")
+		for _, n := range res.Notes {
+			k, v, _ := strings.Cut(n, "=")
+			printf("  %-16s %s\n", k, v)
+		}
+	}
+	return nil
+}
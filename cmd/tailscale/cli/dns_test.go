@@ -0,0 +1,39 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import "testing"
+
+func TestParseDNSRouteDomain(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "corp.example", want: "corp.example"},
+		{in: "Corp.Example.", want: "corp.example"},
+		{in: ".", wantErr: true},
+		{in: "", wantErr: true},
+		{in: "corp..example", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseDNSRouteDomain(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseDNSRouteDomain(%q) = %q, %v; want %q, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestCheckDNSResolver(t *testing.T) {
+	for _, ok := range []string{"10.0.0.53", "fd7a::53", "10.0.0.53:5353", "[fd7a::53]:5353", "https://dns.corp.example/dns-query"} {
+		if err := checkDNSResolver(ok); err != nil {
+			t.Errorf("checkDNSResolver(%q) = %v, want nil", ok, err)
+		}
+	}
+	for _, bad := range []string{"", "dns.corp.example", "10.0.0.53:", "tls://10.0.0.53"} {
+		if err := checkDNSResolver(bad); err == nil {
+			t.Errorf("checkDNSResolver(%q) = nil, want error", bad)
+		}
+	}
+}
@@ -5,13 +5,17 @@
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"net/netip"
 	"os"
 	"slices"
 	"strings"
+	"sync"
 	"text/tabwriter"
+	"time"
 
 	"github.com/peterbourgon/ff/v3/ffcli"
 	xmaps "golang.org/x/exp/maps"
@@ -32,6 +36,8 @@
 			FlagSet: (func() *flag.FlagSet {
 				fs := newFlagSet("list")
 				fs.StringVar(&exitNodeArgs.filter, "filter", "", "filter exit nodes by country")
+				fs.BoolVar(&exitNodeArgs.latency, "latency", false, "measure the latency to each listed exit node")
+				fs.BoolVar(&exitNodeArgs.json, "json", false, "output in JSON format")
 				return fs
 			})(),
 		},
@@ -42,9 +48,53 @@
 }
 
 var exitNodeArgs struct {
-	filter string
+	filter  string
+	latency bool
+	json    bool
 }
 
+// exitNodeList is the output of 'tailscale exit-node list --json'.
+type exitNodeList struct {
+	// AllowLANAccess is whether locally accessible subnets remain
+	// reachable while using an exit node, per the
+	// --exit-node-allow-lan-access setting. It applies to all exit nodes.
+	AllowLANAccess bool
+
+	ExitNodes []exitNodeInfo
+}
+
+// exitNodeInfo describes an exit node in the output of
+// 'tailscale exit-node list --json'.
+type exitNodeInfo struct {
+	ID       tailcfg.StableNodeID
+	IP       string
+	Hostname string
+
+	// Country, CountryCode, City and CityCode are the location of the
+	// exit node, if known. City is "Any" for the best exit node of a
+	// country with several cities.
+	Country     string `json:",omitempty"`
+	CountryCode string `json:",omitempty"`
+	City        string `json:",omitempty"`
+	CityCode    string `json:",omitempty"`
+
+	// Priority is the exit node's priority within its location, as a
+	// load hint: higher is preferred.
+	Priority int `json:",omitempty"`
+
+	Online   bool
+	Selected bool
+	Status   string // as in the STATUS column of the table
+
+	// LatencySeconds is the measured round-trip time to the exit node,
+	// if --latency was given and it replied.
+	LatencySeconds float64 `json:",omitempty"`
+}
+
+// exitNodePingTimeout is how long to wait for an exit node to reply to a
+// latency measurement.
+const exitNodePingTimeout = 2 * time.Second
+
 // runExitNodeList returns a formatted list of exit nodes for a tailnet.
 // If the exit node has location and priority data, only the highest
 // priority node for each city location is shown to the user.
@@ -82,24 +132,120 @@ func runExitNodeList(ctx context.Context, args []string) error {
 		return fmt.Errorf("no exit nodes found for %q", exitNodeArgs.filter)
 	}
 
+	prefs, err := localClient.GetPrefs(ctx)
+	if err != nil {
+		return err
+	}
+	list := exitNodeList{
+		AllowLANAccess: prefs.ExitNodeAllowLANAccess,
+		ExitNodes:      exitNodeInfos(filteredPeers),
+	}
+	if exitNodeArgs.latency {
+		measureExitNodeLatencies(ctx, list.ExitNodes)
+	}
+
+	if exitNodeArgs.json {
+		j, err := json.MarshalIndent(list, "", "  ")
+		if err != nil {
+			return err
+		}
+		printf("%s\n", j)
+		return nil
+	}
+
 	w := tabwriter.NewWriter(os.Stdout, 10, 5, 5, ' ', 0)
 	defer w.Flush()
-	fmt.Fprintf(w, "\n %s\t%s\t%s\t%s\t%s\t", "IP", "HOSTNAME", "COUNTRY", "CITY", "STATUS")
-	for _, country := range filteredPeers.Countries {
-		for _, city := range country.Cities {
-			for _, peer := range city.Peers {
-
-				fmt.Fprintf(w, "\n %s\t%s\t%s\t%s\t%s\t", peer.TailscaleIPs[0], strings.Trim(peer.DNSName, "."), country.Name, city.Name, peerStatus(peer))
+	if exitNodeArgs.latency {
+		fmt.Fprintf(w, "\n %s\t%s\t%s\t%s\t%s\t%s\t", "IP", "HOSTNAME", "COUNTRY", "CITY", "LATENCY", "STATUS")
+	} else {
+		fmt.Fprintf(w, "\n %s\t%s\t%s\t%s\t%s\t", "IP", "HOSTNAME", "COUNTRY", "CITY", "STATUS")
+	}
+	for _, n := range list.ExitNodes {
+		country, city := cmpx.Or(n.Country, noLocationData), cmpx.Or(n.City, noLocationData)
+		if exitNodeArgs.latency {
+			latency := noLocationData
+			if n.LatencySeconds > 0 {
+				latency = time.Duration(n.LatencySeconds * float64(time.Second)).Round(time.Millisecond).String()
 			}
+			fmt.Fprintf(w, "\n %s\t%s\t%s\t%s\t%s\t%s\t", n.IP, n.Hostname, country, city, latency, n.Status)
+		} else {
+			fmt.Fprintf(w, "\n %s\t%s\t%s\t%s\t%s\t", n.IP, n.Hostname, country, city, n.Status)
 		}
 	}
 	fmt.Fprintln(w)
 	fmt.Fprintln(w)
 	fmt.Fprintln(w, "# To use an exit node, use `tailscale set --exit-node=` followed by the hostname or IP")
+	if list.AllowLANAccess {
+		fmt.Fprintln(w, "# Local network access is allowed while using an exit node (--exit-node-allow-lan-access)")
+	} else {
+		fmt.Fprintln(w, "# Local network access is blocked while using an exit node; see --exit-node-allow-lan-access")
+	}
 
 	return nil
 }
 
+// exitNodeInfos returns the exit nodes of filtered in the order they're
+// listed.
+func exitNodeInfos(filtered filteredExitNodes) []exitNodeInfo {
+	var infos []exitNodeInfo
+	for _, country := range filtered.Countries {
+		for _, city := range country.Cities {
+			for _, peer := range city.Peers {
+				info := exitNodeInfo{
+					ID:       peer.ID,
+					Hostname: strings.Trim(peer.DNSName, "."),
+					Online:   peer.Online,
+					Selected: peer.ExitNode,
+					Status:   peerStatus(peer),
+				}
+				if len(peer.TailscaleIPs) > 0 {
+					info.IP = peer.TailscaleIPs[0].String()
+				}
+				if country.Name != noLocationData {
+					info.Country = country.Name
+					info.City = city.Name
+					if loc := peer.Location; loc != nil {
+						info.CountryCode = loc.CountryCode
+						info.Priority = loc.Priority
+						if city.Name == loc.City {
+							info.CityCode = loc.CityCode
+						}
+					}
+				}
+				infos = append(infos, info)
+			}
+		}
+	}
+	return infos
+}
+
+// measureExitNodeLatencies pings each of nodes concurrently and sets its
+// LatencySeconds if it replies in time. WireGuard-only exit nodes don't
+// reply to disco pings, so an ICMP ping is tried if the disco ping fails.
+func measureExitNodeLatencies(ctx context.Context, nodes []exitNodeInfo) {
+	var wg sync.WaitGroup
+	for i := range nodes {
+		ip, err := netip.ParseAddr(nodes[i].IP)
+		if err != nil {
+			continue
+		}
+		wg.Add(1)
+		go func(n *exitNodeInfo) {
+			defer wg.Done()
+			for _, typ := range []tailcfg.PingType{tailcfg.PingDisco, tailcfg.PingICMP} {
+				ctx, cancel := context.WithTimeout(ctx, exitNodePingTimeout)
+				pr, err := localClient.Ping(ctx, ip, typ)
+				cancel()
+				if err == nil && pr.Err == "" {
+					n.LatencySeconds = pr.LatencySeconds
+					return
+				}
+			}
+		}(&nodes[i])
+	}
+	wg.Wait()
+}
+
 // peerStatus returns a string representing the current state of
 // a peer. If there is no notable state, a - is returned.
 func peerStatus(peer *ipnstate.PeerStatus) string {
@@ -4,6 +4,7 @@
 package cli
 
 import (
+	"net/netip"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -306,3 +307,39 @@ func TestSortByCityName(t *testing.T) {
 		t.Fatalf("sortByCityName did not order cities by alphabetical order, got %v, want %v", fc[0].Name, noLocationData)
 	}
 }
+
+func TestExitNodeInfos(t *testing.T) {
+	ps := []*ipnstate.PeerStatus{
+		{
+			ID:           "n1",
+			DNSName:      "se-got-1.example.ts.net.",
+			TailscaleIPs: []netip.Addr{netip.MustParseAddr("100.64.0.1")},
+			Online:       true,
+			Active:       true,
+			ExitNode:     true,
+			Location:     &tailcfg.Location{Country: "Sweden", CountryCode: "se", City: "Goteborg", CityCode: "got", Priority: 100},
+		},
+		{
+			ID:           "n2",
+			DNSName:      "se-sto-1.example.ts.net.",
+			TailscaleIPs: []netip.Addr{netip.MustParseAddr("100.64.0.2")},
+			Online:       true,
+			Location:     &tailcfg.Location{Country: "Sweden", CountryCode: "se", City: "Stockholm", CityCode: "sto", Priority: 200},
+		},
+		{
+			ID:           "n3",
+			DNSName:      "home.example.ts.net.",
+			TailscaleIPs: []netip.Addr{netip.MustParseAddr("100.64.0.3")},
+		},
+	}
+	got := exitNodeInfos(filterFormatAndSortExitNodes(ps, ""))
+	want := []exitNodeInfo{
+		{ID: "n3", IP: "100.64.0.3", Hostname: "home.example.ts.net", Status: "offline"},
+		{ID: "n2", IP: "100.64.0.2", Hostname: "se-sto-1.example.ts.net", Country: "Sweden", CountryCode: "se", City: "Any", Priority: 200, Online: true, Status: "-"},
+		{ID: "n1", IP: "100.64.0.1", Hostname: "se-got-1.example.ts.net", Country: "Sweden", CountryCode: "se", City: "Goteborg", CityCode: "got", Priority: 100, Online: true, Selected: true, Status: "selected"},
+		{ID: "n2", IP: "100.64.0.2", Hostname: "se-sto-1.example.ts.net", Country: "Sweden", CountryCode: "se", City: "Stockholm", CityCode: "sto", Priority: 200, Online: true, Status: "-"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("exitNodeInfos mismatch (-want +got):\n%s", diff)
+	}
+}
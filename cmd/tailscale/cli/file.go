@@ -6,6 +6,8 @@
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"flag"
 	"fmt"
@@ -128,104 +130,209 @@ func runCp(ctx context.Context, args []string) error {
 	}
 
 	for _, fileArg := range files {
-		var fileContents *countingReader
-		var name = cpArgs.name
-		var contentLength int64 = -1
 		if fileArg == "-" {
-			fileContents = &countingReader{Reader: os.Stdin}
+			name := cpArgs.name
+			fileContents := &countingReader{Reader: os.Stdin}
 			if name == "" {
 				name, fileContents, err = pickStdinFilename()
 				if err != nil {
 					return err
 				}
 			}
-		} else {
-			f, err := os.Open(fileArg)
-			if err != nil {
-				if version.IsSandboxedMacOS() {
-					return errors.New("the GUI version of Tailscale on macOS runs in a macOS sandbox that can't read files")
-				}
-				return err
-			}
-			defer f.Close()
-			fi, err := f.Stat()
-			if err != nil {
+			if err := pushFile(ctx, target, ip, stableID, name, 0, -1, fileContents); err != nil {
 				return err
 			}
-			if fi.IsDir() {
-				return errors.New("directories not supported")
-			}
-			contentLength = fi.Size()
-			fileContents = &countingReader{Reader: io.LimitReader(f, contentLength)}
-			if name == "" {
-				name = filepath.Base(fileArg)
-			}
-
-			if envknob.Bool("TS_DEBUG_SLOW_PUSH") {
-				fileContents = &countingReader{Reader: &slowReader{r: fileContents}}
-			}
+			continue
 		}
-
-		if cpArgs.verbose {
-			log.Printf("sending %q to %v/%v/%v ...", name, target, ip, stableID)
+		if err := pushRegularFile(ctx, target, ip, stableID, fileArg); err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		var (
-			done = make(chan struct{}, 1)
-			wg   sync.WaitGroup
-		)
-		if isatty.IsTerminal(os.Stderr.Fd()) {
-			go printProgress(&wg, done, fileContents, name, contentLength)
-			wg.Add(1)
-		}
+// maxPushAttempts is how many times pushRegularFile tries to send a file
+// whose transfer keeps being interrupted.
+const maxPushAttempts = 3
 
-		err := localClient.PushFile(ctx, stableID, contentLength, name, fileContents)
-		if err != nil {
+// pushRegularFile sends the file at path to the peer stableID. If the
+// transfer is interrupted, or an earlier one was, it resumes it where the
+// peer left off.
+func pushRegularFile(ctx context.Context, target, ip string, stableID tailcfg.StableNodeID, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if version.IsSandboxedMacOS() {
+			return errors.New("the GUI version of Tailscale on macOS runs in a macOS sandbox that can't read files")
+		}
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return errors.New("directories not supported")
+	}
+	size := fi.Size()
+	name := cpArgs.name
+	if name == "" {
+		name = filepath.Base(path)
+	}
+	for attempt := 1; ; attempt++ {
+		offset := resumeOffset(ctx, stableID, name, f, size)
+		if offset > 0 {
+			fmt.Fprintf(Stderr, "# resuming %s at byte %d\n", name, offset)
+		}
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
 			return err
 		}
-		if cpArgs.verbose {
-			log.Printf("sent %q", name)
+		fileContents := &countingReader{Reader: io.LimitReader(f, size-offset)}
+		if envknob.Bool("TS_DEBUG_SLOW_PUSH") {
+			fileContents = &countingReader{Reader: &slowReader{r: fileContents}}
+		}
+		fileContents.n.Store(uint64(offset))
+		err := pushFile(ctx, target, ip, stableID, name, offset, size, fileContents)
+		if err == nil {
+			return nil
+		}
+		// Only retry transfers that got somewhere; others, such as
+		// ones refused by the peer, would just fail the same way.
+		progressed := fileContents.n.Load() > uint64(offset)
+		if attempt == maxPushAttempts || !progressed || ctx.Err() != nil {
+			return err
 		}
-		done <- struct{}{}
-		wg.Wait()
+		fmt.Fprintf(Stderr, "# sending %s: %v; retrying\n", name, err)
+	}
+}
+
+// resumeOffset returns where to resume sending f, of the given size, to the
+// peer stableID as name. That's how much of it the peer received in an
+// interrupted transfer, or zero if it received none of it, something else
+// of the same name, or doesn't support resuming.
+func resumeOffset(ctx context.Context, stableID tailcfg.StableNodeID, name string, f io.ReaderAt, size int64) int64 {
+	pf, err := localClient.PushFilePartial(ctx, stableID, name)
+	if err != nil || pf.Size <= 0 || pf.Size > size {
+		return 0
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(f, 0, pf.Size)); err != nil {
+		return 0
+	}
+	if hex.EncodeToString(h.Sum(nil)) != pf.SHA256 {
+		return 0
+	}
+	return pf.Size
+}
+
+// pushFile sends the file name, of the given size (-1 if unknown), from
+// offset on, read from r, to the peer stableID, showing its progress if
+// stderr is a terminal.
+func pushFile(ctx context.Context, target, ip string, stableID tailcfg.StableNodeID, name string, offset, size int64, r *countingReader) error {
+	if cpArgs.verbose {
+		log.Printf("sending %q to %v/%v/%v ...", name, target, ip, stableID)
+	}
+	var (
+		done = make(chan struct{})
+		wg   sync.WaitGroup
+	)
+	if isatty.IsTerminal(os.Stderr.Fd()) {
+		wg.Add(1)
+		go printProgress(&wg, done, r, name, size)
+	}
+	length := int64(-1)
+	if size != -1 {
+		length = size - offset
+	}
+	err := localClient.PushFileFrom(ctx, stableID, offset, length, name, r)
+	close(done)
+	wg.Wait()
+	if err != nil {
+		return err
+	}
+	if cpArgs.verbose {
+		log.Printf("sent %q", name)
 	}
 	return nil
 }
 
 const vtRestartLine = "\r\x1b[K"
 
+// printProgress prints the progress of sending name, of contentLength
+// bytes (-1 if unknown), as read from r, every second until done is
+// closed.
 func printProgress(wg *sync.WaitGroup, done <-chan struct{}, r *countingReader, name string, contentLength int64) {
 	defer wg.Done()
-	var lastBytesRead uint64
-
+	start := int64(r.n.Load())
+	last := start
+	var rate float64 // bytes/second, smoothed
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
 	for {
 		select {
 		case <-done:
 			fmt.Fprintln(os.Stderr)
 			return
-		case <-time.After(time.Second):
-			n := r.n.Load()
-			contentLengthStr := "???"
-			if contentLength > 0 {
-				contentLengthStr = fmt.Sprint(contentLength / 1024)
-			}
-
-			fmt.Fprintf(os.Stderr, "%s%s\t\t%s", vtRestartLine, padTruncateString(name, 36), padTruncateString(fmt.Sprintf("%d/%s kb", n/1024, contentLengthStr), 16))
-			if contentLength > 0 {
-				fmt.Fprintf(os.Stderr, "\t%.02f%%", float64(n)/float64(contentLength)*100)
-			} else {
-				fmt.Fprintf(os.Stderr, "\t-------%%")
+		case <-tick.C:
+			n := int64(r.n.Load())
+			if n == start && last == start {
+				// Nothing sent yet; the rate is unknown.
+				fmt.Fprintf(os.Stderr, "%s%s", vtRestartLine, progressLine(name, n, contentLength, -1))
+				continue
 			}
-			if lastBytesRead > 0 {
-				fmt.Fprintf(os.Stderr, "\t%d kb/s", (n-lastBytesRead)/1024)
+			cur := float64(n - last)
+			if last == start {
+				rate = cur
 			} else {
-				fmt.Fprintf(os.Stderr, "\t-------")
+				rate = 0.7*rate + 0.3*cur
 			}
-			lastBytesRead = n
+			last = n
+			fmt.Fprintf(os.Stderr, "%s%s", vtRestartLine, progressLine(name, n, contentLength, rate))
 		}
 	}
 }
 
+// progressBarWidth is the number of cells in the progress bar.
+const progressBarWidth = 20
+
+// progressLine formats the progress of sending name: n of total bytes
+// (total is -1 if unknown), at rate bytes per second (-1 if unknown).
+func progressLine(name string, n, total int64, rate float64) string {
+	var sb strings.Builder
+	sb.WriteString(padTruncateString(name, 36))
+	if total > 0 {
+		filled := int(n * progressBarWidth / total)
+		fmt.Fprintf(&sb, " [%s%s] %6.2f%%", strings.Repeat("#", filled), strings.Repeat(".", progressBarWidth-filled), float64(n)/float64(total)*100)
+		fmt.Fprintf(&sb, "  %s/%s", formatBytes(n), formatBytes(total))
+	} else {
+		fmt.Fprintf(&sb, "  %s", formatBytes(n))
+	}
+	if rate < 0 {
+		sb.WriteString("  ---/s")
+		return sb.String()
+	}
+	fmt.Fprintf(&sb, "  %s/s", formatBytes(int64(rate)))
+	if total > 0 && rate > 0 {
+		eta := time.Duration(float64(total-n) / rate * float64(time.Second))
+		fmt.Fprintf(&sb, "  ETA %v", eta.Round(time.Second))
+	}
+	return sb.String()
+}
+
+// formatBytes formats n bytes with a binary unit, such as "1.5 MiB".
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit && exp < 4; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTP"[exp])
+}
+
 func padTruncateString(str string, truncateAt int) string {
 	if len(str) <= truncateAt {
 		return str + strings.Repeat(" ", truncateAt-len(str))
@@ -385,14 +492,16 @@ func (v *onConflict) Set(s string) error {
 
 var fileGetCmd = &ffcli.Command{
 	Name:       "get",
-	ShortUsage: "file get [--wait] [--verbose] [--conflict=(skip|overwrite|rename)] <target-directory>",
+	ShortUsage: "file get [--wait] [--verbose] [--conflict=(skip|overwrite|rename)] <target-directory>\nfile get --to-dir=<target-directory> [--verbose] [--conflict=(skip|overwrite|rename)]",
 	ShortHelp:  "Move files out of the Tailscale file inbox",
 	Exec:       runFileGet,
 	FlagSet: (func() *flag.FlagSet {
 		fs := newFlagSet("get")
+		fileGetFlags = fs
 		fs.BoolVar(&getArgs.wait, "wait", false, "wait for a file to arrive if inbox is empty")
 		fs.BoolVar(&getArgs.loop, "loop", false, "run get in a loop, receiving files as they come in")
 		fs.BoolVar(&getArgs.verbose, "verbose", false, "verbose output")
+		fs.StringVar(&getArgs.toDir, "to-dir", "", "receive files into this directory as they arrive, until stopped, as for running as a service; implies --loop and, unless --conflict is given, --conflict=rename")
 		fs.Var(&getArgs.conflict, "conflict", `behavior when a conflicting (same-named) file already exists in the target directory.
 	skip:       skip conflicting files: leave them in the taildrop inbox and print an error. get any non-conflicting files
 	overwrite:  overwrite existing file
@@ -401,10 +510,14 @@ func (v *onConflict) Set(s string) error {
 	})(),
 }
 
+// fileGetFlags is the FlagSet of fileGetCmd.
+var fileGetFlags *flag.FlagSet
+
 var getArgs = struct {
 	wait     bool
 	loop     bool
 	verbose  bool
+	toDir    string
 	conflict onConflict
 }{conflict: skipOnExist}
 
@@ -532,6 +645,25 @@ func runFileGetOneBatch(ctx context.Context, dir string) []error {
 }
 
 func runFileGet(ctx context.Context, args []string) error {
+	if getArgs.toDir != "" {
+		if len(args) != 0 {
+			return errors.New("can't use --to-dir with a target directory argument")
+		}
+		if getArgs.wait {
+			return errors.New("can't use --wait with --to-dir")
+		}
+		args = []string{getArgs.toDir}
+		getArgs.loop = true
+		conflictSet := false
+		fileGetFlags.Visit(func(f *flag.Flag) {
+			conflictSet = conflictSet || f.Name == "conflict"
+		})
+		if !conflictSet {
+			// Unattended, skipped files would pile up in the inbox
+			// with no one to resolve the conflicts.
+			getArgs.conflict = createNumberedFiles
+		}
+	}
 	if len(args) != 1 {
 		return errors.New("usage: file get <target-directory>")
 	}
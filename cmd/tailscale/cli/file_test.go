@@ -0,0 +1,73 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{5 << 20, "5.0 MiB"},
+		{3 << 30, "3.0 GiB"},
+	}
+	for _, tt := range tests {
+		if got := formatBytes(tt.n); got != tt.want {
+			t.Errorf("formatBytes(%d) = %q; want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestProgressLine(t *testing.T) {
+	tests := []struct {
+		name  string
+		n     int64
+		total int64
+		rate  float64
+		want  []string // substrings
+	}{
+		{
+			name:  "half",
+			n:     5 << 20,
+			total: 10 << 20,
+			rate:  1 << 20,
+			want:  []string{"[##########..........]", " 50.00%", "5.0 MiB/10.0 MiB", "1.0 MiB/s", "ETA 5s"},
+		},
+		{
+			name:  "no_rate_yet",
+			n:     0,
+			total: 1 << 20,
+			rate:  -1,
+			want:  []string{"[....................]", "---/s"},
+		},
+		{
+			name:  "unknown_size",
+			n:     2048,
+			total: -1,
+			rate:  1024,
+			want:  []string{"2.0 KiB", "1.0 KiB/s"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := progressLine("file.txt", tt.n, tt.total, tt.rate)
+			for _, w := range tt.want {
+				if !strings.Contains(got, w) {
+					t.Errorf("progressLine = %q; want it to contain %q", got, w)
+				}
+			}
+			if tt.total < 0 && strings.Contains(got, "ETA") {
+				t.Errorf("progressLine = %q; want no ETA for unknown size", got)
+			}
+		})
+	}
+}
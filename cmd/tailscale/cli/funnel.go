@@ -5,12 +5,14 @@
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"net"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/peterbourgon/ff/v3/ffcli"
 	"tailscale.com/envknob"
@@ -43,7 +45,7 @@ func newFunnelCommand(e *serveEnv) *ffcli.Command {
 		Name:      "funnel",
 		ShortHelp: "Turn on/off Funnel service",
 		ShortUsage: strings.Join([]string{
-			"funnel <serve-port> {on|off}",
+			"funnel [--dry-run [--json]] [--expire <duration>] <serve-port> {on|off}",
 			"funnel status [--json]",
 		}, "\n  "),
 		LongHelp: strings.Join([]string{
@@ -52,8 +54,15 @@ func newFunnelCommand(e *serveEnv) *ffcli.Command {
 			"",
 			"Turning off Funnel only turns off serving to the internet.",
 			"It does not affect serving to your tailnet.",
+			"",
+			"With --expire, Funnel is turned off automatically once the",
+			"given duration (such as 2h) has passed.",
 		}, "\n"),
-		Exec:      e.runFunnel,
+		Exec: e.runFunnel,
+		FlagSet: e.newFlags("funnel", func(fs *flag.FlagSet) {
+			addDryRunFlags(e)(fs)
+			addFunnelExpireFlag(e)(fs)
+		}),
 		UsageFunc: usageFunc,
 		Subcommands: []*ffcli.Command{
 			{
@@ -85,6 +94,9 @@ func (e *serveEnv) runFunnel(ctx context.Context, args []string) error {
 	default:
 		return flag.ErrHelp
 	}
+	if e.expire < 0 || (e.expire > 0 && !on) {
+		return errors.New("--expire must be a positive duration, and is only valid with \"on\"")
+	}
 	sc, err := e.lc.GetServeConfig(ctx)
 	if err != nil {
 		return err
@@ -114,27 +126,51 @@ func (e *serveEnv) runFunnel(ctx context.Context, args []string) error {
 
 	dnsName := strings.TrimSuffix(st.Self.DNSName, ".")
 	hp := ipn.HostPort(dnsName + ":" + strconv.Itoa(int(port)))
-	if on == sc.AllowFunnel[hp] {
+	_, hasExpiry := sc.FunnelExpiry[hp]
+	if on == sc.AllowFunnel[hp] && e.expire == 0 && !hasExpiry {
 		printFunnelWarning(sc)
 		// Nothing to do.
 		return nil
 	}
 	if on {
 		mak.Set(&sc.AllowFunnel, hp, true)
+		setFunnelExpiry(sc, hp, e.expire)
 	} else {
 		delete(sc.AllowFunnel, hp)
+		setFunnelExpiry(sc, hp, 0)
 		// clear map mostly for testing
 		if len(sc.AllowFunnel) == 0 {
 			sc.AllowFunnel = nil
 		}
 	}
-	if err := e.lc.SetServeConfig(ctx, sc); err != nil {
+	if err := e.setServeConfig(ctx, sc); err != nil {
 		return err
 	}
 	printFunnelWarning(sc)
 	return nil
 }
 
+// addFunnelExpireFlag returns a flag setup func registering the --expire
+// flag of the funnel commands.
+func addFunnelExpireFlag(e *serveEnv) func(fs *flag.FlagSet) {
+	return func(fs *flag.FlagSet) {
+		fs.DurationVar(&e.expire, "expire", 0, "turn off Funnel automatically after this duration, such as 2h (default: never)")
+	}
+}
+
+// setFunnelExpiry sets funnel access for hp to expire after d, or to not
+// expire if d is zero.
+func setFunnelExpiry(sc *ipn.ServeConfig, hp ipn.HostPort, d time.Duration) {
+	if d > 0 {
+		mak.Set(&sc.FunnelExpiry, hp, time.Now().Add(d).Round(time.Second))
+		return
+	}
+	delete(sc.FunnelExpiry, hp)
+	if len(sc.FunnelExpiry) == 0 {
+		sc.FunnelExpiry = nil
+	}
+}
+
 // verifyFunnelEnabled verifies that the self node is allowed to use Funnel.
 //
 // If Funnel is not yet enabled by the current node capabilities,
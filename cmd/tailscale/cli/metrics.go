@@ -0,0 +1,108 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+)
+
+var metricsCmd = &ffcli.Command{
+	Name:       "metrics",
+	ShortUsage: "metrics [--format=text|prometheus] [name-prefix]",
+	ShortHelp:  "Print tailscaled's client metrics",
+	LongHelp: strings.TrimSpace(`
+'tailscale metrics' prints the counters, gauges and histograms that
+tailscaled keeps in memory. They're normally uploaded with its logs, so
+this is a way to see them on machines that have logging disabled.
+
+With a name prefix, only the metrics whose names start with it are printed.
+The prometheus format can be scraped by a Prometheus node exporter's
+textfile collector, or pushed with 'tailscale debug metrics --push'.
+`),
+	Exec: runMetrics,
+	FlagSet: (func() *flag.FlagSet {
+		fs := newFlagSet("metrics")
+		fs.StringVar(&metricsCmdArgs.format, "format", "text", `output format: "text" or "prometheus"`)
+		return fs
+	})(),
+}
+
+var metricsCmdArgs struct {
+	format string
+}
+
+func runMetrics(ctx context.Context, args []string) error {
+	if len(args) > 1 {
+		return flag.ErrHelp
+	}
+	var prefix string
+	if len(args) == 1 {
+		prefix = args[0]
+	}
+	switch metricsCmdArgs.format {
+	case "text", "prometheus":
+	default:
+		return fmt.Errorf("invalid --format %q; want text or prometheus", metricsCmdArgs.format)
+	}
+	out, err := localClient.DaemonMetrics(ctx)
+	if err != nil {
+		return fixTailscaledConnectError(err)
+	}
+	if metricsCmdArgs.format == "prometheus" {
+		_, err := Stdout.Write(filterPrometheusMetrics(out, prefix))
+		return err
+	}
+	return writeMetricsText(Stdout, out, prefix)
+}
+
+// filterPrometheusMetrics returns the metrics of out, in Prometheus text
+// exposition format, whose names start with prefix.
+func filterPrometheusMetrics(out []byte, prefix string) []byte {
+	if prefix == "" {
+		return out
+	}
+	var buf bytes.Buffer
+	bs := bufio.NewScanner(bytes.NewReader(out))
+	for bs.Scan() {
+		line := bs.Text()
+		name := line
+		if f := strings.Fields(line); len(f) == 4 && f[0] == "#" && f[1] == "TYPE" {
+			name = f[2]
+		}
+		if strings.HasPrefix(name, prefix) {
+			buf.WriteString(line)
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes()
+}
+
+// writeMetricsText writes the metrics of out, in Prometheus text exposition
+// format, whose names start with prefix to w as a table of their names,
+// types and values.
+func writeMetricsText(w io.Writer, out []byte, prefix string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "NAME\tTYPE\tVALUE\n")
+	var typ string // of the metric whose samples follow
+	bs := bufio.NewScanner(bytes.NewReader(filterPrometheusMetrics(out, prefix)))
+	for bs.Scan() {
+		f := strings.Fields(bs.Text())
+		switch {
+		case len(f) == 4 && f[0] == "#" && f[1] == "TYPE":
+			typ = f[3]
+		case len(f) == 2 && !strings.HasPrefix(f[0], "#"):
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", f[0], typ, f[1])
+		}
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,49 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"bytes"
+	"testing"
+)
+
+const testPrometheusMetrics = `# TYPE magicsock_recv_data_ipv4 counter
+magicsock_recv_data_ipv4 12
+# TYPE derp_home_region gauge
+derp_home_region 1
+# TYPE magicsock_latency histogram
+magicsock_latency_bucket{le="1"} 2
+magicsock_latency_bucket{le="+Inf"} 3
+magicsock_latency_sum 4.5
+magicsock_latency_count 3
+`
+
+func TestFilterPrometheusMetrics(t *testing.T) {
+	if got := string(filterPrometheusMetrics([]byte(testPrometheusMetrics), "")); got != testPrometheusMetrics {
+		t.Errorf("no prefix: got %q", got)
+	}
+	want := `# TYPE derp_home_region gauge
+derp_home_region 1
+`
+	if got := string(filterPrometheusMetrics([]byte(testPrometheusMetrics), "derp_")); got != want {
+		t.Errorf("derp_ prefix: got %q; want %q", got, want)
+	}
+}
+
+func TestWriteMetricsText(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeMetricsText(&buf, []byte(testPrometheusMetrics), "magicsock_"); err != nil {
+		t.Fatal(err)
+	}
+	want := `NAME                                 TYPE       VALUE
+magicsock_recv_data_ipv4             counter    12
+magicsock_latency_bucket{le="1"}     histogram  2
+magicsock_latency_bucket{le="+Inf"}  histogram  3
+magicsock_latency_sum                histogram  4.5
+magicsock_latency_count              histogram  3
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
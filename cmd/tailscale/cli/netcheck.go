@@ -36,14 +36,16 @@
 		fs.StringVar(&netcheckArgs.format, "format", "", `output format; empty (for human-readable), "json" or "json-line"`)
 		fs.DurationVar(&netcheckArgs.every, "every", 0, "if non-zero, do an incremental report with the given frequency")
 		fs.BoolVar(&netcheckArgs.verbose, "verbose", false, "verbose logs")
+		fs.BoolVar(&netcheckArgs.bandwidth, "bandwidth", false, "also estimate the bandwidth to the nearest DERP region, if its servers allow it; transfers several megabytes")
 		return fs
 	})(),
 }
 
 var netcheckArgs struct {
-	format  string
-	every   time.Duration
-	verbose bool
+	format    string
+	every     time.Duration
+	verbose   bool
+	bandwidth bool
 }
 
 func runNetcheck(ctx context.Context, args []string) error {
@@ -53,8 +55,9 @@ func runNetcheck(ctx context.Context, args []string) error {
 		return err
 	}
 	c := &netcheck.Client{
-		PortMapper:  portmapper.NewClient(logf, netMon, nil, nil, nil),
-		UseDNSCache: false, // always resolve, don't cache
+		PortMapper:     portmapper.NewClient(logf, netMon, nil, nil, nil),
+		UseDNSCache:    false, // always resolve, don't cache
+		ProbeBandwidth: netcheckArgs.bandwidth,
 	}
 	if netcheckArgs.verbose {
 		c.Logf = logger.WithPrefix(log.Printf, "netcheck: ")
@@ -71,17 +74,9 @@ func runNetcheck(ctx context.Context, args []string) error {
 		fmt.Fprintln(Stderr, "netcheck: UDP test failure:", err)
 	}
 
-	dm, err := localClient.CurrentDERPMap(ctx)
-	noRegions := dm != nil && len(dm.Regions) == 0
-	if noRegions {
-		log.Printf("No DERP map from tailscaled; using default.")
-	}
-	if err != nil || noRegions {
-		hc := &http.Client{Transport: tlsdial.NewTransport()}
-		dm, err = prodDERPMap(ctx, hc)
-		if err != nil {
-			return err
-		}
+	dm, err := netcheckDERPMap(ctx)
+	if err != nil {
+		return err
 	}
 	for {
 		t0 := time.Now()
@@ -188,9 +183,22 @@ func printReport(dm *tailcfg.DERPMap, report *netcheck.Report) error {
 			printf("\t\t- %3s: %-7s (%s%s)\n", r.RegionCode, latency, derpNum, r.RegionName)
 		}
 	}
+	if netcheckArgs.bandwidth {
+		if r := dm.Regions[report.BandwidthRegion]; r != nil {
+			printf("\t* Bandwidth (%s): %s down, %s up\n", r.RegionName,
+				formatBandwidth(report.DownloadBandwidth), formatBandwidth(report.UploadBandwidth))
+		} else {
+			printf("\t* Bandwidth: unknown (probe failed or not served by the DERP region)\n")
+		}
+	}
 	return nil
 }
 
+// formatBandwidth formats bps, in bytes per second, in megabits per second.
+func formatBandwidth(bps int64) string {
+	return fmt.Sprintf("%.1f Mbit/s", float64(bps)*8/1e6)
+}
+
 func portMapping(r *netcheck.Report) string {
 	if !r.AnyPortMappingChecked() {
 		return "not checked"
@@ -208,6 +216,21 @@ func portMapping(r *netcheck.Report) string {
 	return strings.Join(got, ", ")
 }
 
+// netcheckDERPMap returns the DERP map to run netcheck against: that of
+// tailscaled, or the default one if tailscaled has none.
+func netcheckDERPMap(ctx context.Context) (*tailcfg.DERPMap, error) {
+	dm, err := localClient.CurrentDERPMap(ctx)
+	noRegions := dm != nil && len(dm.Regions) == 0
+	if noRegions {
+		log.Printf("No DERP map from tailscaled; using default.")
+	}
+	if err != nil || noRegions {
+		hc := &http.Client{Transport: tlsdial.NewTransport()}
+		return prodDERPMap(ctx, hc)
+	}
+	return dm, nil
+}
+
 func prodDERPMap(ctx context.Context, httpc *http.Client) (*tailcfg.DERPMap, error) {
 	req, err := http.NewRequestWithContext(ctx, "GET", ipn.DefaultControlURL+"/derpmap/default", nil)
 	if err != nil {
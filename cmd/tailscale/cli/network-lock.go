@@ -12,16 +12,21 @@
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/mattn/go-colorable"
 	"github.com/mattn/go-isatty"
 	"github.com/peterbourgon/ff/v3/ffcli"
+	"tailscale.com/client/tailscale"
 	"tailscale.com/ipn/ipnstate"
 	"tailscale.com/tka"
+	"tailscale.com/tka/escrow"
 	"tailscale.com/types/key"
 	"tailscale.com/types/tkatype"
 )
@@ -39,9 +44,11 @@
 		nlSignCmd,
 		nlDisableCmd,
 		nlDisablementKDFCmd,
+		nlEscrowCmd,
 		nlLogCmd,
 		nlLocalDisableCmd,
 		nlRevokeKeysCmd,
+		nlRotateSigningKeyCmd,
 	},
 	Exec: runNetworkLockNoSubcommand,
 }
@@ -59,11 +66,13 @@ func runNetworkLockNoSubcommand(ctx context.Context, args []string) error {
 	numDisablements       int
 	disablementForSupport bool
 	confirm               bool
+	escrowRecipientsFile  string
+	escrowOut             string
 }
 
 var nlInitCmd = &ffcli.Command{
 	Name:       "init",
-	ShortUsage: "init [--gen-disablement-for-support] --gen-disablements N <trusted-key>...",
+	ShortUsage: "init [--gen-disablement-for-support] [--escrow-recipients-file=F --escrow-out=F] --gen-disablements N <trusted-key>...",
 	ShortHelp:  "Initialize tailnet lock",
 	LongHelp: strings.TrimSpace(`
 
@@ -85,6 +94,10 @@ func runNetworkLockNoSubcommand(ctx context.Context, args []string) error {
 will be generated and transmitted to Tailscale, which support can use to disable
 tailnet lock. We recommend setting this flag.
 
+If --escrow-out is specified, the disablement secrets are not printed but
+written to that file, encrypted to the public keys in --escrow-recipients-file.
+See 'tailscale lock escrow --help'.
+
 `),
 	Exec: runNetworkLockInit,
 	FlagSet: (func() *flag.FlagSet {
@@ -92,6 +105,8 @@ func runNetworkLockNoSubcommand(ctx context.Context, args []string) error {
 		fs.IntVar(&nlInitArgs.numDisablements, "gen-disablements", 1, "number of disablement secrets to generate")
 		fs.BoolVar(&nlInitArgs.disablementForSupport, "gen-disablement-for-support", false, "generates and transmits a disablement secret for Tailscale support")
 		fs.BoolVar(&nlInitArgs.confirm, "confirm", false, "do not prompt for confirmation")
+		fs.StringVar(&nlInitArgs.escrowRecipientsFile, "escrow-recipients-file", "", "file of age or ssh-ed25519 public keys to encrypt the disablement secrets to, one per line")
+		fs.StringVar(&nlInitArgs.escrowOut, "escrow-out", "", "file to write the encrypted disablement secrets to, instead of printing them")
 		return fs
 	})(),
 }
@@ -110,6 +125,15 @@ func runNetworkLockInit(ctx context.Context, args []string) error {
 	if err != nil {
 		return err
 	}
+	if (nlInitArgs.escrowRecipientsFile == "") != (nlInitArgs.escrowOut == "") {
+		return errors.New("--escrow-recipients-file and --escrow-out must be used together")
+	}
+	var escrowRecipients []escrow.Recipient
+	if nlInitArgs.escrowRecipientsFile != "" {
+		if escrowRecipients, err = readEscrowRecipients(nlInitArgs.escrowRecipientsFile); err != nil {
+			return err
+		}
+	}
 
 	// Common mistake: Not specifying the current node's key as one of the trusted keys.
 	foundSelfKey := false
@@ -143,20 +167,37 @@ func runNetworkLockInit(ctx context.Context, args []string) error {
 		if nlInitArgs.disablementForSupport {
 			genSupportFlag = "--gen-disablement-for-support "
 		}
+		if nlInitArgs.escrowOut != "" {
+			fmt.Printf("They will be encrypted to %d escrow recipients and written to %s.\n", len(escrowRecipients), nlInitArgs.escrowOut)
+			genSupportFlag += fmt.Sprintf("--escrow-recipients-file=%s --escrow-out=%s ", nlInitArgs.escrowRecipientsFile, nlInitArgs.escrowOut)
+		}
 		fmt.Println("\nIf this is correct, please re-run this command with the --confirm flag:")
 		fmt.Printf("\t%s lock init --confirm --gen-disablements %d %s%s", os.Args[0], nlInitArgs.numDisablements, genSupportFlag, strings.Join(args, " "))
 		fmt.Println()
 		return nil
 	}
 
-	fmt.Printf("%d disablement secrets have been generated and are printed below. Take note of them now, they WILL NOT be shown again.\n", nlInitArgs.numDisablements)
+	var secrets [][]byte
 	for i := 0; i < nlInitArgs.numDisablements; i++ {
-		var secret [32]byte
-		if _, err := rand.Read(secret[:]); err != nil {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
 			return err
 		}
-		fmt.Printf("\tdisablement-secret:%X\n", secret[:])
-		disablementValues = append(disablementValues, tka.DisablementKDF(secret[:]))
+		secrets = append(secrets, secret)
+		disablementValues = append(disablementValues, tka.DisablementKDF(secret))
+	}
+	if nlInitArgs.escrowOut != "" {
+		// Write the bundle before initializing, so that the secrets
+		// can't be lost if that fails.
+		if err := writeEscrowBundle(nlInitArgs.escrowOut, secrets, escrowRecipients); err != nil {
+			return err
+		}
+		fmt.Printf("%d disablement secrets have been generated, encrypted to %d escrow recipients, and written to %s.\n", len(secrets), len(escrowRecipients), nlInitArgs.escrowOut)
+	} else {
+		fmt.Printf("%d disablement secrets have been generated and are printed below. Take note of them now, they WILL NOT be shown again.\n", nlInitArgs.numDisablements)
+		for _, secret := range secrets {
+			fmt.Printf("\tdisablement-secret:%X\n", secret)
+		}
 	}
 
 	var supportDisablement []byte
@@ -333,35 +374,47 @@ func runNetworkLockRemove(ctx context.Context, args []string) error {
 			}
 		}
 
-		// Resign affected signatures for each of the keys we are removing.
-		for _, k := range removeKeys {
-			kID, _ := k.ID() // err already checked above
-			sigs, err := localClient.NetworkLockAffectedSigs(ctx, kID)
-			if err != nil {
-				return fmt.Errorf("affected sigs for key %X: %w", kID, err)
-			}
+		if err := resignAffectedSigs(ctx, removeKeys); err != nil {
+			return err
+		}
+	}
 
-			for _, sigBytes := range sigs {
-				var sig tka.NodeKeySignature
-				if err := sig.Unserialize(sigBytes); err != nil {
-					return fmt.Errorf("failed decoding signature: %w", err)
-				}
-				var nodeKey key.NodePublic
-				if err := nodeKey.UnmarshalBinary(sig.Pubkey); err != nil {
-					return fmt.Errorf("failed decoding pubkey for signature: %w", err)
-				}
+	return localClient.NetworkLockModify(ctx, nil, removeKeys)
+}
 
-				// Safety: NetworkLockAffectedSigs() verifies all signatures before
-				// successfully returning.
-				rotationKey, _ := sig.UnverifiedWrappingPublic()
-				if err := localClient.NetworkLockSign(ctx, nodeKey, []byte(rotationKey)); err != nil {
-					return fmt.Errorf("failed to sign %v: %w", nodeKey, err)
-				}
+// resignAffectedSigs re-signs, with this node's tailnet lock key, all
+// signatures made by the given keys, so that they stay valid once those
+// keys are removed.
+func resignAffectedSigs(ctx context.Context, keys []tka.Key) error {
+	for _, k := range keys {
+		kID, err := k.ID()
+		if err != nil {
+			return fmt.Errorf("computing KeyID for key %v: %w", k, err)
+		}
+		sigs, err := localClient.NetworkLockAffectedSigs(ctx, kID)
+		if err != nil {
+			return fmt.Errorf("affected sigs for key %X: %w", kID, err)
+		}
+
+		for _, sigBytes := range sigs {
+			var sig tka.NodeKeySignature
+			if err := sig.Unserialize(sigBytes); err != nil {
+				return fmt.Errorf("failed decoding signature: %w", err)
+			}
+			var nodeKey key.NodePublic
+			if err := nodeKey.UnmarshalBinary(sig.Pubkey); err != nil {
+				return fmt.Errorf("failed decoding pubkey for signature: %w", err)
+			}
+
+			// Safety: NetworkLockAffectedSigs() verifies all signatures before
+			// successfully returning.
+			rotationKey, _ := sig.UnverifiedWrappingPublic()
+			if err := localClient.NetworkLockSign(ctx, nodeKey, []byte(rotationKey)); err != nil {
+				return fmt.Errorf("failed to sign %v: %w", nodeKey, err)
 			}
 		}
 	}
-
-	return localClient.NetworkLockModify(ctx, nil, removeKeys)
+	return nil
 }
 
 // parseNLArgs parses a slice of strings into slices of tka.Key & disablement
@@ -435,17 +488,48 @@ func runNetworkLockModify(ctx context.Context, addArgs, removeArgs []string) err
 	return nil
 }
 
+var nlSignArgs struct {
+	allPending bool
+	tags       string
+	owner      string
+	dryRun     bool
+	yes        bool
+}
+
 var nlSignCmd = &ffcli.Command{
 	Name:       "sign",
-	ShortUsage: "sign <node-key> [<rotation-key>] or sign <auth-key>",
+	ShortUsage: "sign <node-key> [<rotation-key>] or sign <auth-key> or sign --all-pending [--tags=<tags>] [--owner=<login>] [--dry-run]",
 	ShortHelp:  "Signs a node or pre-approved auth key",
 	LongHelp: `Either:
   - signs a node key and transmits the signature to the coordination server, or
-  - signs a pre-approved auth key, printing it in a form that can be used to bring up nodes under tailnet lock`,
+  - signs a pre-approved auth key, printing it in a form that can be used to bring up nodes under tailnet lock, or
+  - with --all-pending, signs all nodes that are locked out by tailnet lock, optionally
+    filtered by --tags and --owner, after showing them and asking for confirmation
+
+With --all-pending, untagged nodes and nodes created less than ` + nlSignPendingMinAge.String() + ` ago are
+never signed: they must be reviewed and signed individually.`,
 	Exec: runNetworkLockSign,
+	FlagSet: (func() *flag.FlagSet {
+		fs := newFlagSet("lock sign")
+		fs.BoolVar(&nlSignArgs.allPending, "all-pending", false, "sign all nodes locked out by tailnet lock")
+		fs.StringVar(&nlSignArgs.tags, "tags", "", "with --all-pending, only sign nodes with any of these comma-separated tags")
+		fs.StringVar(&nlSignArgs.owner, "owner", "", "with --all-pending, only sign nodes owned by this login name")
+		fs.BoolVar(&nlSignArgs.dryRun, "dry-run", false, "with --all-pending, show which nodes would be signed without signing them")
+		fs.BoolVar(&nlSignArgs.yes, "yes", false, "with --all-pending, sign without interactive prompts")
+		return fs
+	})(),
 }
 
 func runNetworkLockSign(ctx context.Context, args []string) error {
+	if nlSignArgs.allPending {
+		if len(args) > 0 {
+			return errors.New("usage: lock sign --all-pending [--tags=<tags>] [--owner=<login>] [--dry-run]")
+		}
+		return runNetworkLockSignAllPending(ctx)
+	}
+	if nlSignArgs.tags != "" || nlSignArgs.owner != "" || nlSignArgs.dryRun || nlSignArgs.yes {
+		return errors.New("--tags, --owner, --dry-run and --yes require --all-pending")
+	}
 	if len(args) > 0 && strings.HasPrefix(args[0], "tskey-auth-") {
 		return runTskeyWrapCmd(ctx, args)
 	}
@@ -470,7 +554,7 @@ func runNetworkLockSign(ctx context.Context, args []string) error {
 	err := localClient.NetworkLockSign(ctx, nodeKey, []byte(rotationKey.Verifier()))
 	// Provide a better help message for when someone clicks through the signing flow
 	// on the wrong device.
-	if err != nil && strings.Contains(err.Error(), "this node is not trusted by network lock") {
+	if errors.Is(err, tailscale.ErrNetworkLockNotTrusted) {
 		fmt.Fprintln(os.Stderr, "Error: Signing is not available on this device because it does not have a trusted tailnet lock key.")
 		fmt.Fprintln(os.Stderr)
 		fmt.Fprintln(os.Stderr, "Try again on a signing device instead. Tailnet admins can see signing devices on the admin panel.")
@@ -479,6 +563,111 @@ func runNetworkLockSign(ctx context.Context, args []string) error {
 	return err
 }
 
+// nlSignPendingMinAge is how long a node must have existed before
+// "lock sign --all-pending" signs it, so that nodes created by a leaked auth
+// key aren't signed in bulk before an admin had a chance to notice them.
+const nlSignPendingMinAge = time.Hour
+
+// nlPendingNode is a node considered by "lock sign --all-pending".
+type nlPendingNode struct {
+	peer *ipnstate.TKAFilteredPeer
+	skip string // why the node won't be signed, or empty to sign it
+}
+
+// nlSelectPending returns the nodes of peers that match the filters of
+// "lock sign --all-pending": at least one of tags, if any, and owner, if
+// non-empty. Matching nodes that must never be signed in bulk have their
+// skip reason set.
+func nlSelectPending(peers []*ipnstate.TKAFilteredPeer, tags []string, owner string, now time.Time) []nlPendingNode {
+	var ret []nlPendingNode
+	for _, p := range peers {
+		if len(tags) > 0 && !slices.ContainsFunc(p.Tags, func(t string) bool { return slices.Contains(tags, t) }) {
+			continue
+		}
+		if owner != "" && !strings.EqualFold(p.Owner, owner) {
+			continue
+		}
+		n := nlPendingNode{peer: p}
+		switch {
+		case len(p.Tags) == 0:
+			n.skip = "untagged"
+		case p.Created.IsZero():
+			n.skip = "unknown creation time"
+		case now.Sub(p.Created) < nlSignPendingMinAge:
+			n.skip = "created less than " + nlSignPendingMinAge.String() + " ago"
+		}
+		ret = append(ret, n)
+	}
+	return ret
+}
+
+func runNetworkLockSignAllPending(ctx context.Context) error {
+	st, err := localClient.NetworkLockStatus(ctx)
+	if err != nil {
+		return fixTailscaledConnectError(err)
+	}
+	if !st.Enabled {
+		return errors.New("tailnet lock is not enabled")
+	}
+	var tags []string
+	if nlSignArgs.tags != "" {
+		tags = strings.Split(nlSignArgs.tags, ",")
+	}
+	nodes := nlSelectPending(st.FilteredPeers, tags, nlSignArgs.owner, time.Now())
+	if len(nodes) == 0 {
+		fmt.Println("No pending nodes match.")
+		return nil
+	}
+
+	var toSign []*ipnstate.TKAFilteredPeer
+	w := tabwriter.NewWriter(os.Stdout, 10, 5, 3, ' ', 0)
+	fmt.Fprintln(w, "NODE\tNODE KEY\tTAGS\tOWNER\tCREATED\tACTION")
+	for _, n := range nodes {
+		created := "unknown"
+		if !n.peer.Created.IsZero() {
+			created = n.peer.Created.Local().Format(time.DateTime)
+		}
+		action := "sign"
+		if n.skip != "" {
+			action = "skip: " + n.skip
+		} else {
+			toSign = append(toSign, n.peer)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", n.peer.Name, n.peer.NodeKey.ShortString(), strings.Join(n.peer.Tags, ","), n.peer.Owner, created, action)
+	}
+	w.Flush()
+	fmt.Println()
+
+	if len(toSign) == 0 {
+		fmt.Println("No nodes can be signed in bulk; sign them individually with 'tailscale lock sign <node-key>' after reviewing them.")
+		return nil
+	}
+	if nlSignArgs.dryRun {
+		fmt.Printf("Dry run: %d node(s) would be signed.\n", len(toSign))
+		return nil
+	}
+	if !nlSignArgs.yes {
+		fmt.Printf("Sign %d node(s)? [y/n] ", len(toSign))
+		var resp string
+		fmt.Scanln(&resp)
+		switch strings.ToLower(resp) {
+		case "y", "yes":
+		default:
+			return errors.New("aborted")
+		}
+	}
+
+	var errs []error
+	for _, p := range toSign {
+		if err := localClient.NetworkLockSign(ctx, p.NodeKey, nil); err != nil {
+			errs = append(errs, fmt.Errorf("signing %s: %w", p.Name, err))
+			continue
+		}
+		fmt.Printf("Signed %s\n", p.Name)
+	}
+	return errors.Join(errs...)
+}
+
 var nlDisableCmd = &ffcli.Command{
 	Name:       "disable",
 	ShortUsage: "disable <disablement-secret>",
@@ -508,6 +697,120 @@ func runNetworkLockDisable(ctx context.Context, args []string) error {
 	return localClient.NetworkLockDisable(ctx, secrets[0])
 }
 
+var nlEscrowArgs struct {
+	recipientsFile string
+	out            string
+}
+
+var nlEscrowCmd = &ffcli.Command{
+	Name:       "escrow",
+	ShortUsage: "escrow --recipients-file=<file> --out=<file> [disablement-secret:...]...",
+	ShortHelp:  "Encrypts disablement secrets to a set of public keys for safekeeping",
+	LongHelp: strings.TrimSpace(`
+
+The 'tailscale lock escrow' command writes disablement secrets to a
+recovery bundle encrypted with age (https://age-encryption.org) to the
+public keys in the recipients file, which has one age ("age1...") or
+ssh-ed25519 public key per line. Blank lines and lines starting with '#'
+are ignored.
+
+The disablement secrets are read from the arguments, or from standard
+input if there are none. Any one of the recipients can decrypt the bundle
+with the age tool, for example:
+
+	age -d -i ~/.ssh/id_ed25519 lock-recovery.age
+
+To escrow the secrets when they are generated, rather than printing them,
+use the --escrow-recipients-file and --escrow-out flags of
+'tailscale lock init'.
+
+`),
+	Exec: runNetworkLockEscrow,
+	FlagSet: (func() *flag.FlagSet {
+		fs := newFlagSet("lock escrow")
+		fs.StringVar(&nlEscrowArgs.recipientsFile, "recipients-file", "", "file of age or ssh-ed25519 public keys to encrypt to, one per line")
+		fs.StringVar(&nlEscrowArgs.out, "out", "", "file to write the recovery bundle to; it must not exist")
+		return fs
+	})(),
+}
+
+func runNetworkLockEscrow(ctx context.Context, args []string) error {
+	if nlEscrowArgs.recipientsFile == "" || nlEscrowArgs.out == "" {
+		return errors.New("--recipients-file and --out are required")
+	}
+	recipients, err := readEscrowRecipients(nlEscrowArgs.recipientsFile)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		in, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		args = strings.Fields(string(in))
+	}
+	secrets, err := parseDisablementSecrets(args)
+	if err != nil {
+		return err
+	}
+	if err := writeEscrowBundle(nlEscrowArgs.out, secrets, recipients); err != nil {
+		return err
+	}
+	printf("Wrote %d disablement secrets, encrypted to %d recipients, to %s.\n", len(secrets), len(recipients), nlEscrowArgs.out)
+	return nil
+}
+
+// parseDisablementSecrets parses "disablement-secret:" arguments, as printed
+// by 'tailscale lock init'. Unlike parseNLArgs, it doesn't accept disablement
+// values, which can't be used to disable tailnet lock.
+func parseDisablementSecrets(args []string) ([][]byte, error) {
+	var secrets [][]byte
+	for i, a := range args {
+		h, ok := strings.CutPrefix(a, "disablement-secret:")
+		if !ok {
+			return nil, fmt.Errorf("argument %d: expected value with \"disablement-secret:\" prefix, got %q", i+1, a)
+		}
+		b, err := hex.DecodeString(h)
+		if err != nil {
+			return nil, fmt.Errorf("parsing disablement secret %d: %v", i+1, err)
+		}
+		secrets = append(secrets, b)
+	}
+	if len(secrets) == 0 {
+		return nil, errors.New("no disablement secrets given")
+	}
+	return secrets, nil
+}
+
+func readEscrowRecipients(path string) ([]escrow.Recipient, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	recipients, err := escrow.ParseRecipients(f)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return recipients, nil
+}
+
+// writeEscrowBundle writes a new recovery bundle of secrets to path. It
+// doesn't overwrite an existing file, which may be the only copy of
+// previously escrowed secrets.
+func writeEscrowBundle(path string, secrets [][]byte, recipients []escrow.Recipient) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if err := escrow.WriteBundle(f, secrets, recipients, time.Now()); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
+
 var nlLocalDisableCmd = &ffcli.Command{
 	Name:       "local-disable",
 	ShortUsage: "local-disable",
@@ -557,10 +860,21 @@ func runNetworkLockDisablementKDF(ctx context.Context, args []string) error {
 
 var nlLogCmd = &ffcli.Command{
 	Name:       "log",
-	ShortUsage: "log [--limit N]",
+	ShortUsage: "log [--limit N] [--json]",
 	ShortHelp:  "List changes applied to tailnet lock",
-	LongHelp:   "List changes applied to tailnet lock",
-	Exec:       runNetworkLockLog,
+	LongHelp: strings.TrimSpace(`
+
+The 'tailscale lock log' command lists the changes applied to tailnet lock,
+newest first, along with whether each change is validly signed by keys that
+were trusted before it.
+
+With --json, each change also includes the full decoded AUM, its serialized
+form, and whether its hash, its link to the previous change, and each of its
+signatures verify, so that the history can be archived and independently
+verified.
+
+`),
+	Exec: runNetworkLockLog,
 	FlagSet: (func() *flag.FlagSet {
 		fs := newFlagSet("lock log")
 		fs.IntVar(&nlLogArgs.limit, "limit", 50, "max number of updates to list")
@@ -598,6 +912,16 @@ func nlDescribeUpdate(update ipnstate.NetworkLockUpdate, color bool) (string, er
 	}
 
 	fmt.Fprintf(&stanza, "%supdate %x (%s)%s\n", terminalYellow, update.Hash, update.Change, terminalClear)
+	if update.VerificationError != "" {
+		fmt.Fprintf(&stanza, "Signatures: <not verified: %s>\n", update.VerificationError)
+	}
+	for _, sig := range update.Signatures {
+		if sig.Valid {
+			fmt.Fprintf(&stanza, "Signed by: %x\n", sig.KeyID)
+		} else {
+			fmt.Fprintf(&stanza, "Signed by: %x <INVALID: %s>\n", sig.KeyID, sig.Error)
+		}
+	}
 
 	switch update.Change {
 	case tka.AUMAddKey.String():
@@ -643,9 +967,13 @@ func runNetworkLockLog(ctx context.Context, args []string) error {
 		return fixTailscaledConnectError(err)
 	}
 	if nlLogArgs.json {
+		entries, err := nlLogEntries(updates)
+		if err != nil {
+			return err
+		}
 		enc := json.NewEncoder(os.Stdout)
 		enc.SetIndent("", "  ")
-		return enc.Encode(updates)
+		return enc.Encode(entries)
 	}
 
 	useColor := isatty.IsTerminal(os.Stdout.Fd())
@@ -661,6 +989,70 @@ func runNetworkLockLog(ctx context.Context, args []string) error {
 	return nil
 }
 
+// nlLogEntry is an entry of the output of 'tailscale lock log --json'.
+type nlLogEntry struct {
+	Hash   tka.AUMHash
+	Parent *tka.AUMHash `json:",omitempty"` // or nil for the genesis AUM
+	Change string       // values of tka.AUMKind.String()
+
+	// AUM is the decoded AUM, and Raw is its serialized form. Hash is
+	// the BLAKE2s hash of Raw, and the signatures sign the hash of Raw
+	// without its signatures.
+	AUM tka.AUM
+	Raw []byte
+
+	// HashValid is whether Raw hashes to Hash.
+	HashValid bool
+	// ChainValid is whether Parent is the Hash of the next, older, entry.
+	// It's true for the oldest entry, whose parent isn't listed.
+	ChainValid bool
+	// Signatures is whether each of the AUM's signatures is valid, as
+	// verified by tailscaled against the keys trusted before the AUM.
+	Signatures []ipnstate.NetworkLockSignatureStatus
+	// VerificationError, if non-empty, is why the signatures couldn't be
+	// verified.
+	VerificationError string `json:",omitempty"`
+
+	// Verified is whether the hash, chain and all signatures are valid.
+	Verified bool
+}
+
+// nlLogEntries returns the entries of 'tailscale lock log --json' for
+// updates, which are newest first.
+func nlLogEntries(updates []ipnstate.NetworkLockUpdate) ([]nlLogEntry, error) {
+	entries := make([]nlLogEntry, len(updates))
+	for i, update := range updates {
+		e := &entries[i]
+		if err := e.AUM.Unserialize(update.Raw); err != nil {
+			return nil, fmt.Errorf("decoding update %x: %w", update.Hash, err)
+		}
+		e.Hash = tka.AUMHash(update.Hash)
+		if parent, ok := e.AUM.Parent(); ok {
+			e.Parent = &parent
+		}
+		e.Change = update.Change
+		e.Raw = update.Raw
+		e.HashValid = e.AUM.Hash() == e.Hash
+		e.Signatures = update.Signatures
+		e.VerificationError = update.VerificationError
+
+		e.Verified = e.HashValid && update.VerificationError == "" && len(update.Signatures) > 0
+		for _, sig := range update.Signatures {
+			e.Verified = e.Verified && sig.Valid
+		}
+	}
+	for i := range entries {
+		e := &entries[i]
+		if i == len(entries)-1 {
+			e.ChainValid = true
+			continue
+		}
+		e.ChainValid = e.Parent != nil && *e.Parent == entries[i+1].Hash
+		e.Verified = e.Verified && e.ChainValid
+	}
+	return entries, nil
+}
+
 func runTskeyWrapCmd(ctx context.Context, args []string) error {
 	if len(args) != 1 {
 		return errors.New("usage: lock tskey-wrap <tailscale pre-auth key>")
@@ -824,3 +1216,120 @@ func runNetworkLockRevokeKeys(ctx context.Context, args []string) error {
 
 	return nil
 }
+
+var nlRotateSigningKeyArgs struct {
+	yes bool
+}
+
+var nlRotateSigningKeyCmd = &ffcli.Command{
+	Name:       "rotate-signing-key",
+	ShortUsage: "rotate-signing-key [--yes]",
+	ShortHelp:  "Replaces this node's tailnet lock key with a new one",
+	LongHelp: strings.TrimSpace(`
+
+The 'tailscale lock rotate-signing-key' command generates a new tailnet
+lock key for this node and replaces the current one.
+
+If the current key is a trusted signing key, the new key is trusted in its
+place with the same number of votes: it's added to tailnet lock, all
+signatures made by the old key are re-signed with the new key, and the old
+key is removed.
+
+Otherwise, the signature of this node must be updated to use the new key,
+and the command prints what to run on a node with a trusted key to do so.
+
+`),
+	Exec: runNetworkLockRotateSigningKey,
+	FlagSet: (func() *flag.FlagSet {
+		fs := newFlagSet("lock rotate-signing-key")
+		fs.BoolVar(&nlRotateSigningKeyArgs.yes, "yes", false, "rotate without interactive prompts")
+		return fs
+	})(),
+}
+
+func runNetworkLockRotateSigningKey(ctx context.Context, args []string) error {
+	if len(args) > 0 {
+		return errors.New("usage: lock rotate-signing-key [--yes]")
+	}
+	st, err := localClient.NetworkLockStatus(ctx)
+	if err != nil {
+		return fixTailscaledConnectError(err)
+	}
+	if !st.Enabled {
+		return errors.New("tailnet lock is not enabled")
+	}
+	if st.NodeKey == nil || st.PublicKey.IsZero() {
+		return errors.New("no tailnet lock key: is tailscale logged in?")
+	}
+	oldKey := st.PublicKey
+	var oldTrusted *ipnstate.TKAKey
+	for i, k := range st.TrustedKeys {
+		if k.Key == oldKey {
+			oldTrusted = &st.TrustedKeys[i]
+		}
+	}
+
+	fmt.Printf("This node's tailnet lock key %s will be replaced with a newly generated key.\n", oldKey.CLIString())
+	if oldTrusted != nil {
+		fmt.Printf("The new key will be trusted with %d votes, signatures made by the old key will be re-signed, and the old key will be removed.\n", oldTrusted.Votes)
+	} else {
+		fmt.Println("The signature of this node will have to be updated by a node with a trusted key.")
+	}
+	if !nlRotateSigningKeyArgs.yes {
+		fmt.Print("Continue? [y/n] ")
+		var resp string
+		fmt.Scanln(&resp)
+		switch strings.ToLower(resp) {
+		case "y", "yes":
+		default:
+			return errors.New("aborted")
+		}
+	}
+
+	newKey, err := localClient.NetworkLockRotateKey(ctx)
+	if err != nil {
+		return fmt.Errorf("rotating tailnet lock key: %w", err)
+	}
+	fmt.Printf("This node's new tailnet lock key: %s\n", newKey.CLIString())
+
+	if oldTrusted == nil {
+		fmt.Printf(`
+To update the signature of this node, run the following command on a node with a trusted tailnet lock key:
+	%s lock sign %v %s
+`, os.Args[0], st.NodeKey, newKey.CLIString())
+		return nil
+	}
+
+	// The new key is now trusted and held by this node, so it can
+	// re-sign everything the old key signed before the old key is removed.
+	oldTKAKey := tka.Key{
+		Kind:   tka.Key25519,
+		Public: oldKey.Verifier(),
+		Votes:  oldTrusted.Votes,
+	}
+	finish := func(err error) error {
+		fmt.Fprintf(os.Stderr, `
+The new key is trusted, but the old key could not be removed. To finish the
+rotation, run the following command on this node:
+	%s lock remove %s
+`, os.Args[0], oldKey.CLIString())
+		return err
+	}
+	if err := resignAffectedSigs(ctx, []tka.Key{oldTKAKey}); err != nil {
+		return finish(err)
+	}
+	if err := localClient.NetworkLockModify(ctx, nil, []tka.Key{oldTKAKey}); err != nil {
+		return finish(err)
+	}
+	if err := localClient.NetworkLockSign(ctx, *st.NodeKey, []byte(newKey.Verifier())); err != nil {
+		return fmt.Errorf("re-signing this node with the new key: %w", err)
+	}
+
+	fmt.Printf(`Removed the old key %s.
+
+Other nodes pick up the change automatically. Admins can confirm the new
+set of trusted keys by running the following command on any node:
+	%s lock status
+`, oldKey.CLIString(), os.Args[0])
+	return nil
+}
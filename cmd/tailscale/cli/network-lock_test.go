@@ -0,0 +1,195 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"tailscale.com/ipn/ipnstate"
+	"tailscale.com/tka"
+)
+
+func TestNLSelectPending(t *testing.T) {
+	now := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+	old := now.Add(-48 * time.Hour)
+	peers := []*ipnstate.TKAFilteredPeer{
+		{Name: "web1", Tags: []string{"tag:web"}, Owner: "admin@example.com", Created: old},
+		{Name: "web2", Tags: []string{"tag:web", "tag:prod"}, Owner: "ops@example.com", Created: old},
+		{Name: "db1", Tags: []string{"tag:db"}, Owner: "admin@example.com", Created: old},
+		{Name: "laptop", Owner: "admin@example.com", Created: old},
+		{Name: "web3", Tags: []string{"tag:web"}, Owner: "admin@example.com", Created: now.Add(-time.Minute)},
+		{Name: "web4", Tags: []string{"tag:web"}, Owner: "admin@example.com"},
+	}
+	tests := []struct {
+		name  string
+		tags  []string
+		owner string
+		want  map[string]string // node name => skip reason
+	}{
+		{
+			name: "all",
+			want: map[string]string{
+				"web1":   "",
+				"web2":   "",
+				"db1":    "",
+				"laptop": "untagged",
+				"web3":   "created less than 1h0m0s ago",
+				"web4":   "unknown creation time",
+			},
+		},
+		{
+			name: "tags",
+			tags: []string{"tag:prod", "tag:db"},
+			want: map[string]string{
+				"web2": "",
+				"db1":  "",
+			},
+		},
+		{
+			name:  "owner",
+			owner: "OPS@example.com",
+			want: map[string]string{
+				"web2": "",
+			},
+		},
+		{
+			name:  "tags-and-owner",
+			tags:  []string{"tag:web"},
+			owner: "admin@example.com",
+			want: map[string]string{
+				"web1": "",
+				"web3": "created less than 1h0m0s ago",
+				"web4": "unknown creation time",
+			},
+		},
+		{
+			name:  "none",
+			tags:  []string{"tag:none"},
+			owner: "",
+			want:  map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := map[string]string{}
+			for _, n := range nlSelectPending(peers, tt.tags, tt.owner, now) {
+				got[n.peer.Name] = n.skip
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNLLogEntries(t *testing.T) {
+	genesis := tka.AUM{MessageKind: tka.AUMNoOp}
+	gh := genesis.Hash()
+	next := tka.AUM{MessageKind: tka.AUMNoOp, PrevAUMHash: gh[:], Meta: map[string]string{"n": "1"}}
+	unlinked := tka.AUM{MessageKind: tka.AUMNoOp, PrevAUMHash: make([]byte, 32)}
+
+	update := func(a tka.AUM, sigs ...ipnstate.NetworkLockSignatureStatus) ipnstate.NetworkLockUpdate {
+		return ipnstate.NetworkLockUpdate{
+			Hash:       a.Hash(),
+			Change:     a.MessageKind.String(),
+			Raw:        a.Serialize(),
+			Signatures: sigs,
+		}
+	}
+	valid := ipnstate.NetworkLockSignatureStatus{KeyID: []byte{1}, Valid: true}
+	invalid := ipnstate.NetworkLockSignatureStatus{KeyID: []byte{2}, Error: "bad"}
+
+	tampered := update(next, valid)
+	tampered.Hash[0] ^= 1
+
+	tests := []struct {
+		name         string
+		updates      []ipnstate.NetworkLockUpdate
+		wantVerified []bool
+	}{
+		{"valid", []ipnstate.NetworkLockUpdate{update(next, valid), update(genesis, valid)}, []bool{true, true}},
+		{"bad-sig", []ipnstate.NetworkLockUpdate{update(next, valid, invalid), update(genesis, valid)}, []bool{false, true}},
+		{"unsigned", []ipnstate.NetworkLockUpdate{update(next), update(genesis, valid)}, []bool{false, true}},
+		{"broken-chain", []ipnstate.NetworkLockUpdate{update(unlinked, valid), update(genesis, valid)}, []bool{false, true}},
+		{"bad-hash", []ipnstate.NetworkLockUpdate{tampered, update(genesis, valid)}, []bool{false, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := nlLogEntries(tt.updates)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []bool
+			for _, e := range entries {
+				got = append(got, e.Verified)
+			}
+			if !reflect.DeepEqual(got, tt.wantVerified) {
+				t.Errorf("Verified = %v, want %v", got, tt.wantVerified)
+			}
+			if entries[len(entries)-1].Parent != nil {
+				t.Errorf("genesis has parent %v", entries[len(entries)-1].Parent)
+			}
+		})
+	}
+}
+
+func TestNetworkLockEscrow(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wire []byte
+	for _, f := range [][]byte{[]byte("ssh-ed25519"), pub} {
+		wire = binary.BigEndian.AppendUint32(wire, uint32(len(f)))
+		wire = append(wire, f...)
+	}
+	dir := t.TempDir()
+	rcpts := filepath.Join(dir, "recipients.txt")
+	if err := os.WriteFile(rcpts, []byte("# ops\nssh-ed25519 "+base64.StdEncoding.EncodeToString(wire)+" ops@example.com\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "lock-recovery.age")
+
+	old, oldStdout := nlEscrowArgs, Stdout
+	t.Cleanup(func() { nlEscrowArgs, Stdout = old, oldStdout })
+	Stdout = new(bytes.Buffer)
+	nlEscrowArgs.recipientsFile = rcpts
+	nlEscrowArgs.out = out
+
+	secret := "disablement-secret:" + strings.Repeat("AB", 32)
+	if err := runNetworkLockEscrow(context.Background(), []string{secret}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(b, []byte("age-encryption.org/v1\n-> ssh-ed25519 ")) {
+		t.Errorf("bundle isn't encrypted to the ssh key: %q", b)
+	}
+	if bytes.Contains(b, []byte(strings.Repeat("AB", 32))) {
+		t.Error("bundle contains the secret in plain text")
+	}
+
+	// An existing bundle is never overwritten.
+	if err := runNetworkLockEscrow(context.Background(), []string{secret}); err == nil {
+		t.Error("escrow overwrote an existing bundle")
+	}
+	// Disablement values aren't secrets.
+	nlEscrowArgs.out = filepath.Join(dir, "other.age")
+	if err := runNetworkLockEscrow(context.Background(), []string{"disablement:" + strings.Repeat("AB", 32)}); err == nil {
+		t.Error("escrow accepted a disablement value")
+	}
+}
@@ -4,14 +4,19 @@
 package cli
 
 import (
+	"bufio"
 	"context"
+	"crypto/tls"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net"
+	"net/http"
 	"net/netip"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -43,6 +48,20 @@
 (e.g. 100.x.y.z) or a subnet IP advertised by a Tailscale
 relay node.
 
+With --json, a JSON object is printed per line for each ping, with
+the path it took ("direct" or "derp"), its round-trip time, and, for
+the first direct pong, the time it took to establish the direct path.
+Scripts can use 'tailscale ping --until-direct --json' to check that
+NAT traversal works.
+
+With --tcp or --https, 'tailscale ping' instead checks that a service
+of the peer is reachable through the tailnet, by connecting to the
+given --port (443 by default for --https) and, for --https, doing a
+GET of "/" over TLS. It reports the time taken by the TCP and TLS
+handshakes and until the first byte of the response. This helps tell
+apart an unreachable peer from an unreachable service on a reachable
+peer.
+
 `),
 	Exec: runPing,
 	FlagSet: (func() *flag.FlagSet {
@@ -52,9 +71,13 @@
 		fs.BoolVar(&pingArgs.tsmp, "tsmp", false, "do a TSMP-level ping (through WireGuard, but not either host OS stack)")
 		fs.BoolVar(&pingArgs.icmp, "icmp", false, "do a ICMP-level ping (through WireGuard, but not the local host OS stack)")
 		fs.BoolVar(&pingArgs.peerAPI, "peerapi", false, "try hitting the peer's peerapi HTTP server")
+		fs.BoolVar(&pingArgs.tcp, "tcp", false, "connect to the peer's TCP --port through the tailnet")
+		fs.BoolVar(&pingArgs.https, "https", false, "do an HTTPS GET of the peer's --port through the tailnet")
+		fs.IntVar(&pingArgs.port, "port", 0, "port to connect to with --tcp or --https; 0 for 443 with --https")
 		fs.IntVar(&pingArgs.num, "c", 10, "max number of pings to send. 0 for infinity.")
 		fs.DurationVar(&pingArgs.timeout, "timeout", 5*time.Second, "timeout before giving up on a ping")
 		fs.IntVar(&pingArgs.size, "size", 0, "size of the ping message (disco pings only). 0 for minimum size.")
+		fs.BoolVar(&pingArgs.json, "json", false, "output a JSON object per ping")
 		return fs
 	})(),
 }
@@ -67,9 +90,78 @@
 	tsmp        bool
 	icmp        bool
 	peerAPI     bool
+	tcp         bool
+	https       bool
+	port        int
+	json        bool
 	timeout     time.Duration
 }
 
+// pingRecord is the JSON object printed per ping by 'tailscale ping --json'.
+type pingRecord struct {
+	Seq  int       // 1-based number of the ping
+	Time time.Time // when the ping completed or timed out
+
+	// Timeout is whether no pong was received in time. Only Seq and Time
+	// are set otherwise.
+	Timeout bool `json:",omitempty"`
+
+	NodeName string `json:",omitempty"`
+	NodeIP   string `json:",omitempty"`
+
+	// Path is "direct" or "derp" for disco pings, or the ping type, such
+	// as "TSMP", for other pings.
+	Path           string `json:",omitempty"`
+	Endpoint       string `json:",omitempty"` // the direct ip:port, if Path is "direct"
+	DERPRegionID   int    `json:",omitempty"`
+	DERPRegionCode string `json:",omitempty"`
+
+	RTTSeconds float64 `json:",omitempty"`
+
+	// TimeToDirectSeconds is, for the first pong over a direct path, the
+	// time since the first ping was sent.
+	TimeToDirectSeconds float64 `json:",omitempty"`
+
+	// The fields below are set for --tcp and --https pings only.
+
+	Error               string  `json:",omitempty"` // why the ping failed, if not a timeout
+	ConnectSeconds      float64 `json:",omitempty"` // the TCP handshake
+	TLSHandshakeSeconds float64 `json:",omitempty"` // --https only
+	TTFBSeconds         float64 `json:",omitempty"` // --https only; from the request to the first response byte
+	HTTPStatus          int     `json:",omitempty"` // --https only
+}
+
+// newPingRecord returns the pingRecord of the pong pr of ping seq.
+func newPingRecord(seq int, now time.Time, pr *ipnstate.PingResult, typ tailcfg.PingType) pingRecord {
+	rec := pingRecord{
+		Seq:            seq,
+		Time:           now,
+		NodeName:       pr.NodeName,
+		NodeIP:         pr.NodeIP,
+		Endpoint:       pr.Endpoint,
+		DERPRegionID:   pr.DERPRegionID,
+		DERPRegionCode: pr.DERPRegionCode,
+		RTTSeconds:     pr.LatencySeconds,
+	}
+	switch {
+	case pr.Endpoint != "":
+		rec.Path = "direct"
+	case pr.DERPRegionID != 0:
+		rec.Path = "derp"
+	default:
+		rec.Path = string(typ)
+	}
+	return rec
+}
+
+func printPingRecord(rec pingRecord) {
+	j, err := json.Marshal(rec)
+	if err != nil {
+		log.Fatalf("encoding ping record: %v", err)
+	}
+	printf("%s\n", j)
+}
+
 func pingType() tailcfg.PingType {
 	if pingArgs.tsmp {
 		return tailcfg.PingTSMP
@@ -97,6 +189,9 @@ func runPing(ctx context.Context, args []string) error {
 	if len(args) != 1 || args[0] == "" {
 		return errors.New("usage: ping <hostname-or-IP>")
 	}
+	if err := checkAppPingArgs(); err != nil {
+		return err
+	}
 	var ip string
 
 	hostOrIP := args[0]
@@ -113,8 +208,14 @@ func runPing(ctx context.Context, args []string) error {
 		log.Printf("lookup %q => %q", hostOrIP, ip)
 	}
 
+	if pingArgs.tcp || pingArgs.https {
+		return runAppPing(ctx, st, hostOrIP, ip)
+	}
+
 	n := 0
 	anyPong := false
+	anyDirect := false
+	start := time.Now()
 	for {
 		n++
 		ctx, cancel := context.WithTimeout(ctx, pingArgs.timeout)
@@ -122,7 +223,11 @@ func runPing(ctx context.Context, args []string) error {
 		cancel()
 		if err != nil {
 			if errors.Is(err, context.DeadlineExceeded) {
-				printf("ping %q timed out\n", ip)
+				if pingArgs.json {
+					printPingRecord(pingRecord{Seq: n, Time: time.Now(), Timeout: true})
+				} else {
+					printf("ping %q timed out\n", ip)
+				}
 				if n == pingArgs.num {
 					if !anyPong {
 						return errors.New("no reply")
@@ -154,12 +259,22 @@ func runPing(ctx context.Context, args []string) error {
 			printf("hit peerapi of %s (%s) at %s in %s\n", pr.NodeIP, pr.NodeName, pr.PeerAPIURL, latency)
 			return nil
 		}
-		anyPong = true
-		extra := ""
-		if pr.PeerAPIPort != 0 {
-			extra = fmt.Sprintf(", %d", pr.PeerAPIPort)
+		if pingArgs.json {
+			now := time.Now()
+			rec := newPingRecord(n, now, pr, pingType())
+			if pr.Endpoint != "" && !anyDirect {
+				rec.TimeToDirectSeconds = now.Sub(start).Seconds()
+			}
+			printPingRecord(rec)
+		} else {
+			extra := ""
+			if pr.PeerAPIPort != 0 {
+				extra = fmt.Sprintf(", %d", pr.PeerAPIPort)
+			}
+			printf("pong from %s (%s%s) via %v in %v\n", pr.NodeName, pr.NodeIP, extra, via, latency)
 		}
-		printf("pong from %s (%s%s) via %v in %v\n", pr.NodeName, pr.NodeIP, extra, via, latency)
+		anyPong = true
+		anyDirect = anyDirect || pr.Endpoint != ""
 		if pingArgs.tsmp || pingArgs.icmp {
 			return nil
 		}
@@ -180,6 +295,187 @@ func runPing(ctx context.Context, args []string) error {
 	}
 }
 
+// checkAppPingArgs checks the flags of 'tailscale ping --tcp' and
+// 'tailscale ping --https'.
+func checkAppPingArgs() error {
+	if !pingArgs.tcp && !pingArgs.https {
+		if pingArgs.port != 0 {
+			return errors.New("--port requires --tcp or --https")
+		}
+		return nil
+	}
+	switch {
+	case pingArgs.tcp && pingArgs.https:
+		return errors.New("--tcp and --https are mutually exclusive")
+	case pingArgs.tsmp || pingArgs.icmp || pingArgs.peerAPI:
+		return errors.New("--tcp and --https can't be used with --tsmp, --icmp or --peerapi")
+	case pingArgs.tcp && pingArgs.port == 0:
+		return errors.New("--tcp requires --port")
+	case pingArgs.port < 0 || pingArgs.port > 65535:
+		return fmt.Errorf("invalid --port %d", pingArgs.port)
+	}
+	return nil
+}
+
+// runAppPing runs 'tailscale ping --tcp' or 'tailscale ping --https' against
+// ip, resolved from hostOrIP, and prints the result of each ping.
+func runAppPing(ctx context.Context, st *ipnstate.Status, hostOrIP, ip string) error {
+	port := uint16(pingArgs.port)
+	typ := "TCP"
+	var tlsConf *tls.Config
+	nodeName := peerDNSName(st, ip)
+	if pingArgs.https {
+		if port == 0 {
+			port = 443
+		}
+		typ = "HTTPS"
+		// The certificates of tailnet nodes are issued for their MagicDNS
+		// names, not their IPs.
+		serverName := nodeName
+		if serverName == "" {
+			serverName = hostOrIP
+		}
+		tlsConf = &tls.Config{ServerName: serverName}
+	}
+	target := net.JoinHostPort(ip, strconv.Itoa(int(port)))
+
+	anyReply := false
+	for n := 1; ; n++ {
+		pctx, cancel := context.WithTimeout(ctx, pingArgs.timeout)
+		res, err := appPing(pctx, localClient.DialTCP, ip, port, tlsConf)
+		cancel()
+		rec := pingRecord{Seq: n, Time: time.Now(), NodeName: nodeName, NodeIP: ip, Path: typ}
+		switch {
+		case err != nil && ctx.Err() != nil:
+			return ctx.Err()
+		case errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded):
+			rec = pingRecord{Seq: n, Time: rec.Time, Timeout: true}
+			if !pingArgs.json {
+				printf("%s ping to %s timed out\n", typ, target)
+			}
+		case err != nil:
+			rec.Error = err.Error()
+			if !pingArgs.json {
+				printf("%s ping to %s failed: %v\n", typ, target, err)
+			}
+		default:
+			anyReply = true
+			rec.RTTSeconds = res.total().Seconds()
+			rec.ConnectSeconds = res.Connect.Seconds()
+			rec.TLSHandshakeSeconds = res.TLSHandshake.Seconds()
+			rec.TTFBSeconds = res.TTFB.Seconds()
+			rec.HTTPStatus = res.StatusCode
+			if !pingArgs.json {
+				printf("%s\n", res.describe(target, tlsConf))
+			}
+		}
+		if pingArgs.json {
+			printPingRecord(rec)
+		}
+		if n == pingArgs.num {
+			break
+		}
+		time.Sleep(time.Second)
+	}
+	if !anyReply {
+		return errors.New("no reply")
+	}
+	return nil
+}
+
+// peerDNSName returns the MagicDNS name, without the trailing dot, of the
+// peer with Tailscale IP ip, or the empty string if there's no such peer.
+func peerDNSName(st *ipnstate.Status, ip string) string {
+	for _, ps := range st.Peer {
+		for _, a := range ps.TailscaleIPs {
+			if a.String() == ip {
+				return strings.TrimSuffix(ps.DNSName, ".")
+			}
+		}
+	}
+	return ""
+}
+
+// appPingResult is the result of a single 'tailscale ping --tcp' or
+// 'tailscale ping --https'.
+type appPingResult struct {
+	Connect      time.Duration // TCP handshake
+	TLSHandshake time.Duration // zero without TLS
+	TTFB         time.Duration // from sending the request to the first response byte; zero without TLS
+	Status       string        // HTTP response status; empty without TLS
+	StatusCode   int           // HTTP response status code; zero without TLS
+}
+
+// total returns the total duration of the ping.
+func (r *appPingResult) total() time.Duration {
+	return r.Connect + r.TLSHandshake + r.TTFB
+}
+
+// describe returns the human-readable result of a ping to target, as printed
+// by 'tailscale ping' without --json.
+func (r *appPingResult) describe(target string, tlsConf *tls.Config) string {
+	round := func(d time.Duration) time.Duration { return d.Round(100 * time.Microsecond) }
+	if tlsConf == nil {
+		return fmt.Sprintf("TCP connect to %s in %v", target, round(r.Connect))
+	}
+	return fmt.Sprintf("HTTPS GET from %s (%s): %s; connect %v, TLS handshake %v, first byte %v",
+		tlsConf.ServerName, target, r.Status, round(r.Connect), round(r.TLSHandshake), round(r.TTFB))
+}
+
+// appPing connects to ip:port with dial and, if tlsConf is non-nil, does a
+// GET of "/" over TLS with it, timing each step. The response body isn't
+// read.
+func appPing(ctx context.Context, dial func(ctx context.Context, host string, port uint16) (net.Conn, error), ip string, port uint16, tlsConf *tls.Config) (*appPingResult, error) {
+	res := new(appPingResult)
+	start := time.Now()
+	c, err := dial(ctx, ip, port)
+	if err != nil {
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+	defer c.Close()
+	res.Connect = time.Since(start)
+	if tlsConf == nil {
+		return res, nil
+	}
+	if d, ok := ctx.Deadline(); ok {
+		c.SetDeadline(d)
+	}
+
+	start = time.Now()
+	tc := tls.Client(c, tlsConf)
+	if err := tc.HandshakeContext(ctx); err != nil {
+		return nil, fmt.Errorf("TLS handshake: %w", err)
+	}
+	res.TLSHandshake = time.Since(start)
+
+	host := tlsConf.ServerName
+	if port != 443 {
+		host = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", "https://"+host+"/", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Close = true
+	start = time.Now()
+	if err := req.Write(tc); err != nil {
+		return nil, fmt.Errorf("sending request: %w", err)
+	}
+	br := bufio.NewReader(tc)
+	if _, err := br.Peek(1); err != nil {
+		return nil, fmt.Errorf("reading response: %w", err)
+	}
+	res.TTFB = time.Since(start)
+	hres, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, fmt.Errorf("reading response: %w", err)
+	}
+	hres.Body.Close()
+	res.Status = hres.Status
+	res.StatusCode = hres.StatusCode
+	return res, nil
+}
+
 func tailscaleIPFromArg(ctx context.Context, hostOrIP string) (ip string, self bool, err error) {
 	// If the argument is an IP address, use it directly without any resolution.
 	if net.ParseIP(hostOrIP) != nil {
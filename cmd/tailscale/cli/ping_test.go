@@ -0,0 +1,101 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"testing"
+	"time"
+
+	"tailscale.com/ipn/ipnstate"
+	"tailscale.com/tailcfg"
+)
+
+func TestNewPingRecord(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	tests := []struct {
+		name string
+		pr   *ipnstate.PingResult
+		typ  tailcfg.PingType
+		want pingRecord
+	}{
+		{
+			name: "derp",
+			pr:   &ipnstate.PingResult{NodeName: "peer", NodeIP: "100.64.0.2", DERPRegionID: 1, DERPRegionCode: "nyc", LatencySeconds: 0.05},
+			typ:  tailcfg.PingDisco,
+			want: pingRecord{Seq: 1, Time: now, NodeName: "peer", NodeIP: "100.64.0.2", Path: "derp", DERPRegionID: 1, DERPRegionCode: "nyc", RTTSeconds: 0.05},
+		},
+		{
+			name: "direct",
+			pr:   &ipnstate.PingResult{NodeName: "peer", NodeIP: "100.64.0.2", Endpoint: "203.0.113.2:41641", LatencySeconds: 0.01},
+			typ:  tailcfg.PingDisco,
+			want: pingRecord{Seq: 1, Time: now, NodeName: "peer", NodeIP: "100.64.0.2", Path: "direct", Endpoint: "203.0.113.2:41641", RTTSeconds: 0.01},
+		},
+		{
+			name: "tsmp",
+			pr:   &ipnstate.PingResult{NodeName: "peer", NodeIP: "100.64.0.2", LatencySeconds: 0.02},
+			typ:  tailcfg.PingTSMP,
+			want: pingRecord{Seq: 1, Time: now, NodeName: "peer", NodeIP: "100.64.0.2", Path: "TSMP", RTTSeconds: 0.02},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newPingRecord(1, now, tt.pr, tt.typ); got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAppPing(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h, _, _ := net.SplitHostPort(r.Host); h != "example.com" {
+			t.Errorf("Host = %q", r.Host)
+		}
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer srv.Close()
+	ap, err := netip.ParseAddrPort(srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dial := func(ctx context.Context, host string, port uint16) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(int(port))))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	res, err := appPing(ctx, dial, ap.Addr().String(), ap.Port(), nil)
+	if err != nil {
+		t.Fatalf("TCP: %v", err)
+	}
+	if res.Connect <= 0 || res.TLSHandshake != 0 || res.TTFB != 0 || res.StatusCode != 0 {
+		t.Errorf("TCP: unexpected result %+v", res)
+	}
+
+	// The certificate of httptest servers is valid for example.com.
+	tlsConf := srv.Client().Transport.(*http.Transport).TLSClientConfig.Clone()
+	tlsConf.ServerName = "example.com"
+	res, err = appPing(ctx, dial, ap.Addr().String(), ap.Port(), tlsConf)
+	if err != nil {
+		t.Fatalf("HTTPS: %v", err)
+	}
+	if res.Connect <= 0 || res.TLSHandshake <= 0 || res.TTFB <= 0 {
+		t.Errorf("HTTPS: missing timings in %+v", res)
+	}
+	if res.StatusCode != http.StatusTeapot {
+		t.Errorf("HTTPS: status = %q, want %d", res.Status, http.StatusTeapot)
+	}
+
+	tlsConf.ServerName = "wrong.example.net"
+	if _, err := appPing(ctx, dial, ap.Addr().String(), ap.Port(), tlsConf); err == nil {
+		t.Error("HTTPS: no error with mismatched server name")
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+	"tailscale.com/ipn"
+)
+
+var presetCmd = &ffcli.Command{
+	Name:       "preset",
+	ShortUsage: "preset <list|save|use|delete> [name]",
+	ShortHelp:  "Save and switch between named sets of routing preferences",
+	LongHelp: strings.TrimSpace(`
+
+The 'tailscale preset' commands save the current routing preferences of the
+current account under a name, and switch back to them later. A preset has
+the exit node, --exit-node-allow-lan-access, --accept-routes, --accept-dns
+and --shields-up settings.
+
+For example, to switch between using an exit node at work and not at home:
+
+  tailscale set --exit-node=work-exit --shields-up
+  tailscale preset save work
+  tailscale set --exit-node= --shields-up=false
+  tailscale preset save home
+  tailscale preset use work
+
+`),
+	Subcommands: []*ffcli.Command{
+		{
+			Name:       "list",
+			ShortUsage: "preset list",
+			ShortHelp:  "List the saved presets",
+			Exec:       runPresetList,
+		},
+		{
+			Name:       "save",
+			ShortUsage: "preset save <name>",
+			ShortHelp:  "Save the current preferences as a preset, replacing any of the same name",
+			Exec:       runPresetSave,
+		},
+		{
+			Name:       "use",
+			ShortUsage: "preset use <name>",
+			ShortHelp:  "Apply a preset to the current preferences",
+			Exec:       runPresetUse,
+		},
+		{
+			Name:       "delete",
+			ShortUsage: "preset delete <name>",
+			ShortHelp:  "Delete a preset",
+			Exec:       runPresetDelete,
+		},
+	},
+	Exec: func(context.Context, []string) error {
+		return errors.New("preset subcommand required; run 'tailscale preset -h' for details")
+	},
+}
+
+func runPresetList(ctx context.Context, args []string) error {
+	if len(args) > 0 {
+		return errors.New("unexpected arguments")
+	}
+	presets, err := localClient.PrefsPresets(ctx)
+	if err != nil {
+		return err
+	}
+	if len(presets) == 0 {
+		outln("No presets saved. Save one with 'tailscale preset save <name>'.")
+		return nil
+	}
+	w := tabwriter.NewWriter(Stdout, 10, 5, 5, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintf(w, "NAME\tEXIT NODE\tSETTINGS\n")
+	for _, p := range presets {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", p.Name, presetExitNode(p), presetSettings(p))
+	}
+	return nil
+}
+
+// presetExitNode returns how the exit node of p is shown by
+// 'tailscale preset list'.
+func presetExitNode(p ipn.PrefsPreset) string {
+	switch {
+	case !p.ExitNodeID.IsZero():
+		return string(p.ExitNodeID)
+	case p.ExitNodeIP.IsValid():
+		return p.ExitNodeIP.String()
+	}
+	return "-"
+}
+
+// presetSettings returns the flags that p sets, as shown by
+// 'tailscale preset list'.
+func presetSettings(p ipn.PrefsPreset) string {
+	var s []string
+	if p.ExitNodeAllowLANAccess {
+		s = append(s, "exit-node-allow-lan-access")
+	}
+	if p.RouteAll {
+		s = append(s, "accept-routes")
+	}
+	if p.CorpDNS {
+		s = append(s, "accept-dns")
+	}
+	if p.ShieldsUp {
+		s = append(s, "shields-up")
+	}
+	if len(s) == 0 {
+		return "-"
+	}
+	return strings.Join(s, ",")
+}
+
+func runPresetSave(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: tailscale preset save <name>")
+	}
+	if err := ipn.CheckPrefsPresetName(args[0]); err != nil {
+		return err
+	}
+	p, err := localClient.SavePrefsPreset(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	printf("Saved preset %q (exit node: %s; settings: %s).\n", p.Name, presetExitNode(*p), presetSettings(*p))
+	return nil
+}
+
+func runPresetUse(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: tailscale preset use <name>")
+	}
+	if _, err := localClient.UsePrefsPreset(ctx, args[0]); err != nil {
+		return err
+	}
+	printf("Switched to preset %q.\n", args[0])
+	return nil
+}
+
+func runPresetDelete(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: tailscale preset delete <name>")
+	}
+	return localClient.DeletePrefsPreset(ctx, args[0])
+}
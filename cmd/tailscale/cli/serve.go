@@ -21,6 +21,7 @@
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/peterbourgon/ff/v3/ffcli"
 	"tailscale.com/client/tailscale"
@@ -54,7 +55,11 @@ func newServeCommand(e *serveEnv) *ffcli.Command {
 			"serve tcp:<port> tcp://localhost:<local-port> [off]",
 			"serve tls-terminated-tcp:<port> tcp://localhost:<local-port> [off]",
 			"serve status [--json]",
-			"serve reset",
+			"serve reset [--port N] [--path /mount] [--type TYPE] [--dry-run [--json]]",
+			"serve rollback [--to N | --list]",
+			"serve export > cfg.json",
+			"serve import [--dry-run [--json]] <cfg.json | ->",
+			"serve wizard",
 		}, "\n  "),
 		LongHelp: strings.TrimSpace(`
 *** BETA; all of this is subject to change ***
@@ -82,6 +87,19 @@ func newServeCommand(e *serveEnv) *ffcli.Command {
   - To serve simple static text:
     $ tailscale serve https:8080 / text:"Hello, world!"
 
+  - To serve a fixed JSON document:
+    $ tailscale serve https:8080 /status.json json:'{"ok":true}'
+
+  - To redirect to another URL (a 302 by default; 301, 303, 307 and 308
+    may be given before the URL):
+    $ tailscale serve https /docs redirect:https://example.com/docs
+    $ tailscale serve https /docs redirect:301:https://example.com/docs
+
+  - To see how a command would change the serve config, as a diff or a
+    JSON patch, without applying it:
+    $ tailscale serve --dry-run https / http://127.0.0.1:3000
+    $ tailscale serve --dry-run --json https / off
+
   - To serve over HTTP (tailnet only):
     $ tailscale serve http:80 / http://127.0.0.1:3000
 
@@ -97,6 +115,7 @@ func newServeCommand(e *serveEnv) *ffcli.Command {
     $ tailscale serve tls-terminated-tcp:443 tcp://localhost:80
 `),
 		Exec:      e.runServe,
+		FlagSet:   e.newFlags("serve", addDryRunFlags(e)),
 		UsageFunc: usageFunc,
 		Subcommands: []*ffcli.Command{
 			{
@@ -108,17 +127,72 @@ func newServeCommand(e *serveEnv) *ffcli.Command {
 				}),
 				UsageFunc: usageFunc,
 			},
-			{
-				Name:      "reset",
-				Exec:      e.runServeReset,
-				ShortHelp: "reset current serve/funnel config",
-				FlagSet:   e.newFlags("serve-reset", nil),
-				UsageFunc: usageFunc,
-			},
+			newServeResetCommand(e),
+			newServeRollbackCommand(e),
+			newServeExportCommand(e),
+			newServeImportCommand(e),
+			newServeWizardCommand(e),
 		},
 	}
 }
 
+// newServeResetCommand returns the "reset" subcommand of serve and funnel,
+// using e as its environment.
+func newServeResetCommand(e *serveEnv) *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "reset",
+		ShortUsage: "reset [--port N] [--path /mount] [--type TYPE] [--dry-run [--json]]",
+		ShortHelp:  "reset current serve/funnel config",
+		LongHelp: strings.TrimSpace(`
+The 'reset' subcommand removes the whole serve/funnel config or, with
+--port, --path or --type, only the handlers that match all of the given
+ones. Ports and Funnel settings left without handlers are removed too.
+--type is one of web (any web handler), proxy, path, text, redirect or
+tcp (TCP forwarding).
+`),
+		Exec: e.runServeReset,
+		FlagSet: e.newFlags("serve-reset", func(fs *flag.FlagSet) {
+			fs.StringVar(&e.resetPort, "port", "", "only reset the handlers on this port")
+			fs.StringVar(&e.resetPath, "path", "", "only reset the web handlers at this mount point")
+			fs.StringVar(&e.resetType, "type", "", "only reset handlers of this type")
+			addDryRunFlags(e)(fs)
+		}),
+		UsageFunc: usageFunc,
+	}
+}
+
+// newServeRollbackCommand returns the "rollback" subcommand of serve and
+// funnel, using e as its environment.
+func newServeRollbackCommand(e *serveEnv) *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "rollback",
+		ShortUsage: "rollback [--to N | --list]",
+		ShortHelp:  "restore a previous serve/funnel config",
+		LongHelp: strings.TrimSpace(`
+The 'rollback' subcommand restores a previous serve/funnel config.
+The last few configs are kept by tailscaled, newest first, so
+'--to 1' (the default) undoes the most recent change. A rollback is
+itself recorded, so running 'rollback' twice returns to where you started.
+`),
+		Exec: e.runServeRollback,
+		FlagSet: e.newFlags("serve-rollback", func(fs *flag.FlagSet) {
+			fs.IntVar(&e.rollbackTo, "to", 1, "revision to restore, as numbered by --list")
+			fs.BoolVar(&e.rollbackList, "list", false, "list the available revisions instead of restoring one")
+			fs.BoolVar(&e.json, "json", false, "output JSON (with --list)")
+		}),
+		UsageFunc: usageFunc,
+	}
+}
+
+// addDryRunFlags returns a flag setup func registering the flags of
+// commands that change the serve config and support --dry-run.
+func addDryRunFlags(e *serveEnv) func(fs *flag.FlagSet) {
+	return func(fs *flag.FlagSet) {
+		fs.BoolVar(&e.dryRun, "dry-run", false, "print how the serve config would change, as a diff, instead of applying it")
+		fs.BoolVar(&e.json, "json", false, "print the change as a JSON patch (with --dry-run)")
+	}
+}
+
 // errHelp is standard error text that prompts users to
 // run `serve --help` for information on how to use serve.
 var errHelp = errors.New("try `tailscale serve --help` for usage info")
@@ -147,6 +221,9 @@ type localServeClient interface {
 	SetServeConfig(context.Context, *ipn.ServeConfig) error
 	QueryFeature(ctx context.Context, feature string) (*tailcfg.QueryFeatureResponse, error)
 	WatchIPNBus(ctx context.Context, mask ipn.NotifyWatchOpt) (*tailscale.IPNBusWatcher, error)
+	GetServeConfigHistory(context.Context) ([]ipn.ServeConfigRevision, error)
+	RollbackServeConfig(ctx context.Context, n int) error
+	ServeCertStatus(context.Context) ([]ipn.ServeCertStatus, error)
 	IncrementCounter(ctx context.Context, name string, delta int) error
 }
 
@@ -167,13 +244,29 @@ type serveEnv struct {
 	http             string    // HTTP port
 	tcp              string    // TCP port
 	tlsTerminatedTCP string    // a TLS terminated TCP port
+	backendProtocol  string    // protocol to speak to a proxy backend
+	contentType      string    // Content-Type of text responses
+	statusCode       int       // HTTP status code of text responses
+	rollbackTo       int       // serve config revision to roll back to
+	rollbackList     bool      // list serve config revisions
+	resetPort        string    // only reset handlers on this port
+	resetPath        string    // only reset web handlers at this mount
+	resetType        string    // only reset handlers of this type
+	dryRun           bool      // print serve config changes instead of applying them
+	tailnetOnly      bool      // keep the mount off Funnel (--funnel=false)
+	basicAuth        string    // "user:bcrypt-hash" to require of web clients
 	subcmd           serveMode // subcommand
 
+	// expire is how long funnel access lasts, for both v1 and v2.
+	// Zero means no limit.
+	expire time.Duration
+
 	lc localServeClient // localClient interface, specific to serve
 
 	// optional stuff for tests:
 	testFlagOut io.Writer
 	testStdout  io.Writer
+	testStdin   io.Reader
 }
 
 // getSelfDNSName returns the DNS name of the current node.
@@ -235,7 +328,7 @@ func (e *serveEnv) runServe(ctx context.Context, args []string) error {
 		if err := json.Unmarshal(valb, sc); err != nil {
 			return fmt.Errorf("invalid JSON: %w", err)
 		}
-		return e.lc.SetServeConfig(ctx, sc)
+		return e.setServeConfig(ctx, sc)
 	}
 
 	srcType, srcPortStr, found := strings.Cut(args[0], ":")
@@ -307,6 +400,8 @@ func (e *serveEnv) runServe(ctx context.Context, args []string) error {
 //   - tailscale serve https / http://localhost:3000
 //   - tailscale serve https:8443 /files/ /home/alice/shared-files/
 //   - tailscale serve https:10000 /motd.txt text:"Hello, world!"
+//   - tailscale serve https:10000 /status.json json:'{"ok":true}'
+//   - tailscale serve https /docs redirect:301:https://example.com/docs
 func (e *serveEnv) handleWebServe(ctx context.Context, srvPort uint16, useTLS bool, mount, source string) error {
 	h := new(ipn.HTTPHandler)
 
@@ -318,6 +413,20 @@ func (e *serveEnv) handleWebServe(ctx context.Context, srvPort uint16, useTLS bo
 			return errors.New("unable to serve; text cannot be an empty string")
 		}
 		h.Text = text
+	case ts == "json":
+		j, err := parseJSONTarget(source)
+		if err != nil {
+			return err
+		}
+		h.Text = j
+		h.ContentType = "application/json"
+	case ts == "redirect":
+		u, code, err := parseRedirectTarget(source)
+		if err != nil {
+			return err
+		}
+		h.Redirect = u
+		h.StatusCode = code
 	case isProxyTarget(source):
 		t, err := expandProxyTarget(source)
 		if err != nil {
@@ -390,7 +499,7 @@ func (e *serveEnv) handleWebServe(ctx context.Context, srvPort uint16, useTLS bo
 	}
 
 	if !reflect.DeepEqual(cursc, sc) {
-		if err := e.lc.SetServeConfig(ctx, sc); err != nil {
+		if err := e.setServeConfig(ctx, sc); err != nil {
 			return err
 		}
 	}
@@ -459,7 +568,7 @@ func (e *serveEnv) handleWebServeRemove(ctx context.Context, srvPort uint16, mou
 	if len(sc.TCP) == 0 {
 		sc.TCP = nil
 	}
-	if err := e.lc.SetServeConfig(ctx, sc); err != nil {
+	if err := e.setServeConfig(ctx, sc); err != nil {
 		return err
 	}
 	return nil
@@ -605,7 +714,7 @@ func (e *serveEnv) handleTCPServe(ctx context.Context, srcType string, srcPort u
 	}
 
 	if !reflect.DeepEqual(cursc, sc) {
-		if err := e.lc.SetServeConfig(ctx, sc); err != nil {
+		if err := e.setServeConfig(ctx, sc); err != nil {
 			return err
 		}
 	}
@@ -633,7 +742,7 @@ func (e *serveEnv) handleTCPServeRemove(ctx context.Context, src uint16) error {
 		if len(sc.TCP) == 0 {
 			sc.TCP = nil
 		}
-		return e.lc.SetServeConfig(ctx, sc)
+		return e.setServeConfig(ctx, sc)
 	}
 	return errors.New("error: serve config does not exist")
 }
@@ -680,10 +789,41 @@ func (e *serveEnv) runServeStatus(ctx context.Context, args []string) error {
 		}
 		printf("\n")
 	}
+	// Older versions of tailscaled don't report certificates; that's fine.
+	if certs, err := e.lc.ServeCertStatus(ctx); err == nil && len(certs) > 0 {
+		printf("Certificates:\n")
+		now := time.Now()
+		for _, c := range certs {
+			printf("|-- %s\n", fmtServeCertStatus(c, now))
+		}
+		printf("\n")
+	}
 	printFunnelWarning(sc)
 	return nil
 }
 
+// fmtServeCertStatus describes the certificate c for "serve status".
+func fmtServeCertStatus(c ipn.ServeCertStatus, now time.Time) string {
+	var s string
+	switch {
+	case c.NotAfter.IsZero() && c.LastAttempt.IsZero():
+		s = c.Domain + ": fetching"
+	case c.NotAfter.IsZero():
+		s = c.Domain + ": not issued"
+	case now.After(c.NotAfter):
+		s = fmt.Sprintf("%s: expired %s", c.Domain, c.NotAfter.Format(time.DateOnly))
+	default:
+		s = fmt.Sprintf("%s: valid until %s", c.Domain, c.NotAfter.Format(time.DateOnly))
+		if !c.RenewAt.IsZero() {
+			s += fmt.Sprintf(", renews %s", c.RenewAt.Format(time.DateOnly))
+		}
+	}
+	if c.LastError != "" {
+		s += fmt.Sprintf(" (last attempt %v ago failed: %s)", now.Sub(c.LastAttempt).Round(time.Second), c.LastError)
+	}
+	return s
+}
+
 func (e *serveEnv) stdout() io.Writer {
 	if e.testStdout != nil {
 		return e.testStdout
@@ -702,11 +842,7 @@ func printTCPStatusTree(ctx context.Context, sc *ipn.ServeConfig, st *ipnstate.S
 		if h.TerminateTLS != "" {
 			tlsStatus = "TLS terminated"
 		}
-		fStatus := "tailnet only"
-		if sc.AllowFunnel[hp] {
-			fStatus = "Funnel on"
-		}
-		printf("|-- tcp://%s (%s, %s)\n", hp, tlsStatus, fStatus)
+		printf("|-- tcp://%s (%s, %s)\n", hp, tlsStatus, funnelStatus(sc, hp))
 		for _, a := range st.TailscaleIPs {
 			ipp := net.JoinHostPort(a.String(), strconv.Itoa(int(p)))
 			printf("|-- tcp://%s\n", ipp)
@@ -716,15 +852,23 @@ func printTCPStatusTree(ctx context.Context, sc *ipn.ServeConfig, st *ipnstate.S
 	return nil
 }
 
+// funnelStatus describes whether funnel access is on for hp, and until when.
+func funnelStatus(sc *ipn.ServeConfig, hp ipn.HostPort) string {
+	if !sc.AllowFunnel[hp] {
+		return "tailnet only"
+	}
+	if exp, ok := sc.FunnelExpiry[hp]; ok {
+		return "Funnel on until " + exp.Local().Format("2006-01-02 15:04 MST")
+	}
+	return "Funnel on"
+}
+
 func (e *serveEnv) printWebStatusTree(sc *ipn.ServeConfig, hp ipn.HostPort) error {
 	// No-op if no serve config
 	if sc == nil {
 		return nil
 	}
-	fStatus := "tailnet only"
-	if sc.AllowFunnel[hp] {
-		fStatus = "Funnel on"
-	}
+	fStatus := funnelStatus(sc, hp)
 	host, portStr, _ := net.SplitHostPort(string(hp))
 
 	port, err := parseServePort(portStr)
@@ -755,6 +899,8 @@ func (e *serveEnv) printWebStatusTree(sc *ipn.ServeConfig, hp ipn.HostPort) erro
 			return "proxy", h.Proxy
 		case h.Text != "":
 			return "text", "\"" + elipticallyTruncate(h.Text, 20) + "\""
+		case h.Redirect != "":
+			return "redirect", h.Redirect
 		}
 		return "", ""
 	}
@@ -784,16 +930,256 @@ func elipticallyTruncate(s string, max int) string {
 	return s[:max-3] + "..."
 }
 
-// runServeReset clears out the current serve config.
+// runServeReset clears out the current serve config, or only the parts of
+// it that match --port, --path and --type.
 //
 // Usage:
 //   - tailscale serve reset
+//   - tailscale serve reset --port 8443
+//   - tailscale serve reset --port 443 --path /api
+//   - tailscale serve reset --type tcp
 func (e *serveEnv) runServeReset(ctx context.Context, args []string) error {
 	if len(args) != 0 {
 		return flag.ErrHelp
 	}
-	sc := new(ipn.ServeConfig)
-	return e.lc.SetServeConfig(ctx, sc)
+	if e.resetPort == "" && e.resetPath == "" && e.resetType == "" {
+		sc := new(ipn.ServeConfig)
+		return e.setServeConfig(ctx, sc)
+	}
+	f := serveResetFilter{handlerType: e.resetType}
+	if e.resetPort != "" {
+		port, err := parseServePort(e.resetPort)
+		if err != nil {
+			return fmt.Errorf("invalid --port: %w", err)
+		}
+		f.port = port
+	}
+	if e.resetPath != "" {
+		mount, err := cleanMountPoint(e.resetPath)
+		if err != nil {
+			return fmt.Errorf("invalid --path: %w", err)
+		}
+		f.mount = mount
+	}
+	switch f.handlerType {
+	case "", "web", "proxy", "path", "text", "redirect":
+	case "tcp":
+		if f.mount != "" {
+			return errors.New("--path can't be used with --type=tcp")
+		}
+	default:
+		return fmt.Errorf("invalid --type %q; must be web, proxy, path, text, redirect or tcp", f.handlerType)
+	}
+	cur, err := e.lc.GetServeConfig(ctx)
+	if err != nil {
+		return err
+	}
+	sc := cur.Clone()
+	if !f.apply(sc) {
+		return errors.New("error: no matching serve config")
+	}
+	return e.setServeConfig(ctx, sc)
+}
+
+// serveResetFilter selects the parts of a serve config that a selective
+// "serve reset" removes. Its zero fields match anything.
+type serveResetFilter struct {
+	port        uint16
+	mount       string
+	handlerType string // "web", a webHandlerType or "tcp"
+}
+
+// webHandlerType returns the kind of target that h serves: "proxy", "path",
+// "text" or "redirect".
+func webHandlerType(h *ipn.HTTPHandler) string {
+	switch {
+	case h.Proxy != "":
+		return "proxy"
+	case h.Path != "":
+		return "path"
+	case h.Redirect != "":
+		return "redirect"
+	default:
+		return "text"
+	}
+}
+
+func (f serveResetFilter) matchesPort(port uint16) bool {
+	return f.port == 0 || f.port == port
+}
+
+func (f serveResetFilter) matchesWebHandler(mount string, h *ipn.HTTPHandler) bool {
+	if f.mount != "" && f.mount != mount {
+		return false
+	}
+	switch f.handlerType {
+	case "", "web":
+		return true
+	default:
+		return f.handlerType == webHandlerType(h)
+	}
+}
+
+// apply removes the handlers that f matches from sc, along with the ports
+// and Funnel settings that are left without any, including in foreground
+// sessions' configs. It reports whether anything was removed.
+func (f serveResetFilter) apply(sc *ipn.ServeConfig) (removed bool) {
+	if sc == nil {
+		return false
+	}
+	removePort := func(port uint16) {
+		delete(sc.TCP, port)
+		for hp := range sc.AllowFunnel {
+			if p, err := hp.Port(); err == nil && p == port {
+				delete(sc.AllowFunnel, hp)
+			}
+		}
+		for hp := range sc.FunnelExpiry {
+			if p, err := hp.Port(); err == nil && p == port {
+				delete(sc.FunnelExpiry, hp)
+			}
+		}
+	}
+	if f.mount == "" && f.handlerType == "" {
+		// The whole port goes, whatever is on it.
+		for hp := range sc.Web {
+			if p, err := hp.Port(); err == nil && p == f.port {
+				delete(sc.Web, hp)
+				removed = true
+			}
+		}
+		if sc.TCP[f.port] != nil || removed {
+			removePort(f.port)
+			removed = true
+		}
+	}
+	for port, h := range sc.TCP {
+		if h.TCPForward == "" || !f.matchesPort(port) || f.mount != "" {
+			continue
+		}
+		if f.handlerType == "" || f.handlerType == "tcp" {
+			removePort(port)
+			removed = true
+		}
+	}
+	for hp, web := range sc.Web {
+		port, err := hp.Port()
+		if err != nil || !f.matchesPort(port) || web == nil {
+			continue
+		}
+		for mount, h := range web.Handlers {
+			if f.matchesWebHandler(mount, h) {
+				delete(web.Handlers, mount)
+				removed = true
+			}
+		}
+		if len(web.Handlers) == 0 {
+			delete(sc.Web, hp)
+			if th := sc.TCP[port]; th != nil && th.TCPForward == "" {
+				removePort(port)
+			}
+		}
+	}
+	for _, fg := range sc.Foreground {
+		if f.apply(fg) {
+			removed = true
+		}
+	}
+	// clear empty maps mostly for testing
+	if len(sc.TCP) == 0 {
+		sc.TCP = nil
+	}
+	if len(sc.Web) == 0 {
+		sc.Web = nil
+	}
+	if len(sc.AllowFunnel) == 0 {
+		sc.AllowFunnel = nil
+	}
+	if len(sc.FunnelExpiry) == 0 {
+		sc.FunnelExpiry = nil
+	}
+	return removed
+}
+
+// runServeRollback is the entry point for the "serve rollback" subcommand.
+//
+// Examples:
+//   - tailscale serve rollback
+//   - tailscale serve rollback --list
+//   - tailscale serve rollback --to 3
+func (e *serveEnv) runServeRollback(ctx context.Context, args []string) error {
+	if len(args) != 0 {
+		return flag.ErrHelp
+	}
+	if !e.rollbackList {
+		if e.rollbackTo < 1 {
+			return errors.New("--to must be 1 or greater")
+		}
+		return e.lc.RollbackServeConfig(ctx, e.rollbackTo)
+	}
+	hist, err := e.lc.GetServeConfigHistory(ctx)
+	if err != nil {
+		return err
+	}
+	if e.json {
+		j, err := json.MarshalIndent(hist, "", "  ")
+		if err != nil {
+			return err
+		}
+		j = append(j, '\n')
+		e.stdout().Write(j)
+		return nil
+	}
+	if len(hist) == 0 {
+		fmt.Fprintln(e.stdout(), "No previous serve configs")
+		return nil
+	}
+	for i, rev := range hist {
+		var ports []string
+		for p := range rev.Config.TCP {
+			ports = append(ports, strconv.Itoa(int(p)))
+		}
+		sort.Strings(ports)
+		fmt.Fprintf(e.stdout(), "%d\treplaced %s\tports %s\n", i+1, rev.Replaced.Local().Format(time.DateTime), strings.Join(ports, ","))
+	}
+	return nil
+}
+
+// parseJSONTarget parses a serve target of the form "json:VALUE" and
+// returns VALUE, which must be valid JSON.
+func parseJSONTarget(target string) (string, error) {
+	j := strings.TrimPrefix(target, "json:")
+	if j == "" {
+		return "", errors.New("unable to serve; JSON cannot be an empty string")
+	}
+	if !json.Valid([]byte(j)) {
+		return "", fmt.Errorf("unable to serve; invalid JSON %q", j)
+	}
+	return j, nil
+}
+
+// parseRedirectTarget parses a serve target of the form
+// "redirect:[code:]URL", where the optional code is an HTTP redirect status
+// code. The URL must be absolute. A zero code means the default (302).
+func parseRedirectTarget(target string) (redirectURL string, code int, err error) {
+	rest, ok := strings.CutPrefix(target, "redirect:")
+	if !ok {
+		return "", 0, fmt.Errorf("invalid redirect target %q", target)
+	}
+	if c, u, ok := strings.Cut(rest, ":"); ok && len(c) == 3 && allNumeric(c) {
+		code, _ = strconv.Atoi(c)
+		switch code {
+		case 301, 302, 303, 307, 308:
+		default:
+			return "", 0, fmt.Errorf("invalid redirect status code %d; must be one of 301, 302, 303, 307 or 308", code)
+		}
+		rest = u
+	}
+	u, err := url.Parse(rest)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", 0, fmt.Errorf("invalid redirect URL %q; must be an absolute http:// or https:// URL", rest)
+	}
+	return rest, code, nil
 }
 
 // parseServePort parses a port number from a string and returns it as a
@@ -21,6 +21,7 @@
 	"strings"
 
 	"github.com/peterbourgon/ff/v3/ffcli"
+	"golang.org/x/crypto/bcrypt"
 	"tailscale.com/client/tailscale"
 	"tailscale.com/ipn"
 	"tailscale.com/ipn/ipnstate"
@@ -40,6 +41,9 @@ type commandInfo struct {
 var serveHelpCommon = strings.TrimSpace(`
 <target> can be a port number (e.g., 3000), a partial URL (e.g., localhost:3000), or a
 full URL including a path (e.g., http://localhost:3000/foo, https+insecure://localhost:3000/foo).
+It can also be redirect:[code:]URL (e.g., redirect:301:https://example.com) to redirect
+requests instead of proxying them, or text:TEXT or json:JSON to serve a fixed response
+(see --content-type and --status).
 
 EXAMPLES
   - Mount a local web server at 127.0.0.1:3000 in the foreground:
@@ -90,7 +94,10 @@ func buildShortUsage(subcmd string) string {
 	return strings.Join([]string{
 		subcmd + " [flags] <target> [off]",
 		subcmd + " status [--json]",
-		subcmd + " reset",
+		subcmd + " reset [--port N] [--path /mount] [--type TYPE] [--dry-run [--json]]",
+		subcmd + " rollback [--to N | --list]",
+		subcmd + " export > cfg.json",
+		subcmd + " import [--dry-run [--json]] <cfg.json | ->",
 	}, "\n  ")
 }
 
@@ -108,7 +115,10 @@ func newServeDevCommand(e *serveEnv, subcmd serveMode) *ffcli.Command {
 		ShortUsage: strings.Join([]string{
 			fmt.Sprintf("%s <target>", info.Name),
 			fmt.Sprintf("%s status [--json]", info.Name),
-			fmt.Sprintf("%s reset", info.Name),
+			fmt.Sprintf("%s reset [--port N] [--path /mount] [--type TYPE] [--dry-run [--json]]", info.Name),
+			fmt.Sprintf("%s rollback [--to N | --list]", info.Name),
+			fmt.Sprintf("%s export > cfg.json", info.Name),
+			fmt.Sprintf("%s import [--dry-run [--json]] <cfg.json | ->", info.Name),
 		}, "\n  "),
 		LongHelp: info.LongHelp + fmt.Sprintf(strings.TrimSpace(serveHelpCommon), info.Name, info.Name),
 		Exec:     e.runServeCombined(subcmd),
@@ -116,11 +126,21 @@ func newServeDevCommand(e *serveEnv, subcmd serveMode) *ffcli.Command {
 		FlagSet: e.newFlags("serve-set", func(fs *flag.FlagSet) {
 			fs.BoolVar(&e.bg, "bg", false, "run the command in the background")
 			fs.StringVar(&e.setPath, "set-path", "", "set a path for a specific target and run in the background")
-			fs.StringVar(&e.https, "https", "", "default; HTTPS listener")
+			fs.StringVar(&e.https, "https", "", `default; HTTPS listener, or "auto" for the first free port of 443, 8443 and 10000`)
 			fs.StringVar(&e.http, "http", "", "HTTP listener")
 			fs.StringVar(&e.tcp, "tcp", "", "TCP listener")
 			fs.StringVar(&e.tlsTerminatedTCP, "tls-terminated-tcp", "", "TLS terminated TCP listener")
-
+			fs.StringVar(&e.contentType, "content-type", "", "Content-Type of text: and json: targets (default text/plain or application/json)")
+			fs.IntVar(&e.statusCode, "status", 0, "HTTP status code of text: and json: targets (default 200)")
+			fs.StringVar(&e.backendProtocol, "backend-protocol", "", "protocol to use with a proxy target: http1 (default) or h2c (cleartext HTTP/2, for gRPC)")
+			fs.DurationVar(&e.expire, "expire", 0, "funnel only; turn off Funnel automatically after this duration, such as 2h (default: never)")
+			fs.StringVar(&e.basicAuth, "basic-auth", "", `require HTTP basic auth, as "user:hash" where hash is a bcrypt hash of the password, such as from "htpasswd -nbB user password"`)
+			fs.BoolFunc("funnel", "whether the mount is reachable over Funnel when its port is funneled; use --funnel=false to keep a --set-path mount tailnet-only (default true)", func(s string) error {
+				v, err := strconv.ParseBool(s)
+				e.tailnetOnly = !v
+				return err
+			})
+			addDryRunFlags(e)(fs)
 		}),
 		UsageFunc: usageFunc,
 		Subcommands: []*ffcli.Command{
@@ -133,13 +153,11 @@ func newServeDevCommand(e *serveEnv, subcmd serveMode) *ffcli.Command {
 				}),
 				UsageFunc: usageFunc,
 			},
-			{
-				Name:      "reset",
-				ShortHelp: "reset current serve/funnel config",
-				Exec:      e.runServeReset,
-				FlagSet:   e.newFlags("serve-reset", nil),
-				UsageFunc: usageFunc,
-			},
+			newServeResetCommand(e),
+			newServeRollbackCommand(e),
+			newServeExportCommand(e),
+			newServeImportCommand(e),
+			newServeWizardCommand(e),
 		},
 	}
 }
@@ -191,6 +209,12 @@ func (e *serveEnv) runServeCombined(subcmd serveMode) execFunc {
 			return fmt.Errorf("failed to clean the mount point: %w", err)
 		}
 
+		if e.dryRun {
+			// A dry run previews the persisted config; there's no
+			// foreground session to show.
+			e.bg = true
+		}
+
 		if e.setPath != "" {
 			// TODO(marwan-at-work): either
 			// 1. Warn the user that this is a side effect.
@@ -216,13 +240,29 @@ func (e *serveEnv) runServeCombined(subcmd serveMode) execFunc {
 		}
 		dnsName := strings.TrimSuffix(st.Self.DNSName, ".")
 
+		turnOff := "off" == args[len(args)-1]
+		if e.expire != 0 && (!funnel || turnOff || e.expire < 0) {
+			fmt.Fprintf(os.Stderr, "error: --expire must be a positive duration, and is only valid when turning on funnel\n\n")
+			return errHelp
+		}
+		autoPort := srvPort == 0
+		if autoPort {
+			if turnOff {
+				fmt.Fprintf(os.Stderr, "error: --https=auto can't be turned off; use the port it chose\n\n")
+				return errHelp
+			}
+			srvPort, err = autoServePort(sc)
+			if err != nil {
+				return err
+			}
+		}
+
 		// set parent serve config to always be persisted
 		// at the top level, but a nested config might be
 		// the one that gets manipulated depending on
 		// foreground or background.
 		parentSC := sc
 
-		turnOff := "off" == args[len(args)-1]
 		if !turnOff && srvType == serveTypeHTTPS {
 			// Running serve with https requires that the tailnet has enabled
 			// https cert provisioning. Send users through an interactive flow
@@ -275,13 +315,21 @@ func (e *serveEnv) runServeCombined(subcmd serveMode) execFunc {
 			return errHelp
 		}
 
-		if err := e.lc.SetServeConfig(ctx, parentSC); err != nil {
+		if err := e.setServeConfig(ctx, parentSC); err != nil {
 			if tailscale.IsPreconditionsFailedError(err) {
 				fmt.Fprintln(os.Stderr, "Another client is changing the serve config; please try again.")
 			}
 			return err
 		}
+		if e.dryRun {
+			return nil
+		}
 
+		if autoPort {
+			// Report the chosen port on stdout, so that scripts
+			// setting up several services can pick it up.
+			fmt.Fprintln(e.stdout(), serveURL("https", dnsName, srvPort))
+		}
 		if msg != "" {
 			fmt.Fprintln(os.Stderr, msg)
 		}
@@ -385,7 +433,11 @@ func (e *serveEnv) messageForPort(sc *ipn.ServeConfig, st *ipnstate.Status, dnsN
 	hp := ipn.HostPort(net.JoinHostPort(dnsName, strconv.Itoa(int(srvPort))))
 
 	if sc.AllowFunnel[hp] == true {
-		output.WriteString("Available on the internet:\n")
+		if exp, ok := sc.FunnelExpiry[hp]; ok {
+			fmt.Fprintf(&output, "Available on the internet until %s:\n", exp.Local().Format("2006-01-02 15:04 MST"))
+		} else {
+			output.WriteString("Available on the internet:\n")
+		}
 	} else {
 		output.WriteString("Available within your tailnet:\n")
 	}
@@ -395,13 +447,7 @@ func (e *serveEnv) messageForPort(sc *ipn.ServeConfig, st *ipnstate.Status, dnsN
 		scheme = "http"
 	}
 
-	portPart := ":" + fmt.Sprint(srvPort)
-	if scheme == "http" && srvPort == 80 ||
-		scheme == "https" && srvPort == 443 {
-		portPart = ""
-	}
-
-	output.WriteString(fmt.Sprintf("%s://%s%s\n\n", scheme, dnsName, portPart))
+	output.WriteString(serveURL(scheme, dnsName, srvPort) + "\n\n")
 
 	if !e.bg {
 		output.WriteString("Press Ctrl+C to exit.")
@@ -412,10 +458,14 @@ func (e *serveEnv) messageForPort(sc *ipn.ServeConfig, st *ipnstate.Status, dnsN
 		switch {
 		case h.Path != "":
 			return "path", h.Path
+		case h.Proxy != "" && h.BackendProtocol == ipn.BackendProtocolH2C:
+			return "proxy", h.Proxy + " (h2c)"
 		case h.Proxy != "":
 			return "proxy", h.Proxy
 		case h.Text != "":
 			return "text", "\"" + elipticallyTruncate(h.Text, 20) + "\""
+		case h.Redirect != "":
+			return "redirect", h.Redirect
 		}
 		return "", ""
 	}
@@ -434,6 +484,12 @@ func (e *serveEnv) messageForPort(sc *ipn.ServeConfig, st *ipnstate.Status, dnsN
 		for _, m := range mounts {
 			h := sc.Web[hp].Handlers[m]
 			t, d := srvTypeAndDesc(h)
+			if h.TailnetOnly {
+				d += " (tailnet only)"
+			}
+			if h.BasicAuth != "" {
+				d += " (basic auth)"
+			}
 			output.WriteString(fmt.Sprintf("%s %s%s %-5s %s\n", "|--", m, strings.Repeat(" ", maxLen-len(m)), t, d))
 		}
 	} else if sc.TCP[srvPort] != nil {
@@ -461,6 +517,12 @@ func (e *serveEnv) messageForPort(sc *ipn.ServeConfig, st *ipnstate.Status, dnsN
 func (e *serveEnv) applyWebServe(sc *ipn.ServeConfig, dnsName string, srvPort uint16, useTLS bool, mount, target string) error {
 	h := new(ipn.HTTPHandler)
 
+	switch e.backendProtocol {
+	case "", ipn.BackendProtocolHTTP1, ipn.BackendProtocolH2C:
+	default:
+		return fmt.Errorf("invalid --backend-protocol %q; must be %q or %q", e.backendProtocol, ipn.BackendProtocolHTTP1, ipn.BackendProtocolH2C)
+	}
+
 	switch {
 	case strings.HasPrefix(target, "text:"):
 		text := strings.TrimPrefix(target, "text:")
@@ -468,6 +530,20 @@ func (e *serveEnv) applyWebServe(sc *ipn.ServeConfig, dnsName string, srvPort ui
 			return errors.New("unable to serve; text cannot be an empty string")
 		}
 		h.Text = text
+	case strings.HasPrefix(target, "json:"):
+		j, err := parseJSONTarget(target)
+		if err != nil {
+			return err
+		}
+		h.Text = j
+		h.ContentType = "application/json"
+	case strings.HasPrefix(target, "redirect:"):
+		u, code, err := parseRedirectTarget(target)
+		if err != nil {
+			return err
+		}
+		h.Redirect = u
+		h.StatusCode = code
 	case filepath.IsAbs(target):
 		if version.IsSandboxedMacOS() {
 			// don't allow path serving for now on macOS (2022-11-15)
@@ -492,7 +568,40 @@ func (e *serveEnv) applyWebServe(sc *ipn.ServeConfig, dnsName string, srvPort ui
 		if err != nil {
 			return err
 		}
+		if e.backendProtocol == ipn.BackendProtocolH2C && !strings.HasPrefix(t, "http://") {
+			return errors.New("--backend-protocol=h2c requires an http:// target")
+		}
 		h.Proxy = t
+		h.BackendProtocol = e.backendProtocol
+	}
+	if e.backendProtocol != "" && h.Proxy == "" {
+		return errors.New("--backend-protocol is only valid with a proxy target")
+	}
+	if e.contentType != "" {
+		if h.Text == "" {
+			return errors.New("--content-type is only valid with a text: or json: target")
+		}
+		h.ContentType = e.contentType
+	}
+	h.TailnetOnly = e.tailnetOnly
+	if e.basicAuth != "" {
+		user, hash, ok := strings.Cut(e.basicAuth, ":")
+		if !ok || user == "" {
+			return errors.New(`invalid --basic-auth; must be "user:hash"`)
+		}
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return fmt.Errorf("invalid --basic-auth hash: %w", err)
+		}
+		h.BasicAuth = e.basicAuth
+	}
+	if e.statusCode != 0 {
+		if h.Text == "" {
+			return errors.New("--status is only valid with a text: or json: target")
+		}
+		if e.statusCode < 200 || e.statusCode > 599 {
+			return fmt.Errorf("invalid --status %d", e.statusCode)
+		}
+		h.StatusCode = e.statusCode
 	}
 
 	// TODO: validation needs to check nested foreground configs
@@ -528,6 +637,12 @@ func (e *serveEnv) applyWebServe(sc *ipn.ServeConfig, dnsName string, srvPort ui
 }
 
 func (e *serveEnv) applyTCPServe(sc *ipn.ServeConfig, dnsName string, srcType serveType, srcPort uint16, target string) error {
+	if e.tailnetOnly {
+		return errors.New("--funnel=false is only valid for web targets")
+	}
+	if e.basicAuth != "" {
+		return errors.New("--basic-auth is only valid for web targets")
+	}
 	var terminateTLS bool
 	switch srcType {
 	case serveTypeTCP:
@@ -587,6 +702,7 @@ func (e *serveEnv) applyFunnel(sc *ipn.ServeConfig, dnsName string, srvPort uint
 	// TODO: add error handling for if toggling for existing sc
 	if allowFunnel {
 		mak.Set(&sc.AllowFunnel, hp, true)
+		setFunnelExpiry(sc, hp, e.expire)
 	}
 }
 
@@ -612,6 +728,34 @@ func (e *serveEnv) unsetServe(sc *ipn.ServeConfig, dnsName string, srvType serve
 	return nil
 }
 
+// serveURL returns the URL of the root of the web server on srvPort of
+// dnsName, omitting the port if it's the default for scheme.
+func serveURL(scheme, dnsName string, srvPort uint16) string {
+	if scheme == "http" && srvPort == 80 ||
+		scheme == "https" && srvPort == 443 {
+		return fmt.Sprintf("%s://%s", scheme, dnsName)
+	}
+	return fmt.Sprintf("%s://%s:%d", scheme, dnsName, srvPort)
+}
+
+// autoServePorts are the HTTPS ports that --https=auto picks from, in order
+// of preference. They're the ports that Funnel allows, so that a service
+// served on any of them can later be funneled.
+var autoServePorts = []uint16{443, 8443, 10000}
+
+// autoServePort returns the first port in autoServePorts that isn't in use by
+// sc, in the background or any foreground session.
+func autoServePort(sc *ipn.ServeConfig) (uint16, error) {
+	for _, p := range autoServePorts {
+		if c, _ := findConfig(sc, p); c == nil {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("no free HTTPS port; ports %v are all in use", autoServePorts)
+}
+
+// srvTypeAndPortFromFlags returns the type and port of the listener set by
+// the flags of e. The port is zero if it's to be chosen by autoServePort.
 func srvTypeAndPortFromFlags(e *serveEnv) (srvType serveType, srvPort uint16, err error) {
 	sourceMap := map[serveType]string{
 		serveTypeHTTP:             e.http,
@@ -638,6 +782,12 @@ func srvTypeAndPortFromFlags(e *serveEnv) (srvType serveType, srvPort uint16, er
 		srcValue = "443"
 	}
 
+	if srcValue == "auto" {
+		if srvType != serveTypeHTTPS {
+			return 0, 0, errors.New(`port "auto" is only supported with --https`)
+		}
+		return srvType, 0, nil
+	}
 	srvPort, err = parseServePort(srcValue)
 	if err != nil {
 		return 0, 0, fmt.Errorf("invalid port %q: %w", srcValue, err)
@@ -693,6 +843,7 @@ func (e *serveEnv) removeWebServe(sc *ipn.ServeConfig, dnsName string, srvPort u
 	// disable funnel if no remaining mounts exist for the serve port
 	if sc.Web == nil && sc.TCP == nil {
 		delete(sc.AllowFunnel, hp)
+		setFunnelExpiry(sc, hp, 0)
 	}
 
 	return nil
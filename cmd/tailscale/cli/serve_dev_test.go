@@ -16,7 +16,9 @@
 
 	"github.com/peterbourgon/ff/v3/ffcli"
 	"tailscale.com/ipn"
+	"tailscale.com/portlist"
 	"tailscale.com/types/logger"
+	"tailscale.com/util/mak"
 )
 
 func TestServeDevConfigMutations(t *testing.T) {
@@ -716,6 +718,168 @@ type step struct {
 		wantErr: anyErr(),
 	})
 
+	// fixed responses
+	add(step{reset: true})
+	add(step{
+		command: cmd("serve --bg --set-path=/teapot --status=418 --content-type=text/html text:<b>short</b>"),
+		want: &ipn.ServeConfig{
+			TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+			Web: map[ipn.HostPort]*ipn.WebServerConfig{
+				"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+					"/teapot": {Text: "<b>short</b>", StatusCode: 418, ContentType: "text/html"},
+				}},
+			},
+		},
+	})
+	add(step{
+		command: cmd(`serve --bg --set-path=/status json:{"ok":true}`),
+		want: &ipn.ServeConfig{
+			TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+			Web: map[ipn.HostPort]*ipn.WebServerConfig{
+				"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+					"/teapot": {Text: "<b>short</b>", StatusCode: 418, ContentType: "text/html"},
+					"/status": {Text: `{"ok":true}`, ContentType: "application/json"},
+				}},
+			},
+		},
+	})
+	add(step{
+		command: cmd(`serve --bg --set-path=/bad json:{"ok":`),
+		wantErr: anyErr(),
+	})
+	add(step{
+		command: cmd("serve --bg --status=204 localhost:3000"),
+		wantErr: anyErr(),
+	})
+
+	// h2c backend protocol
+	add(step{reset: true})
+	add(step{
+		command: cmd("serve --bg --backend-protocol=h2c localhost:50051"),
+		want: &ipn.ServeConfig{
+			TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+			Web: map[ipn.HostPort]*ipn.WebServerConfig{
+				"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+					"/": {Proxy: "http://127.0.0.1:50051", BackendProtocol: "h2c"},
+				}},
+			},
+		},
+	})
+	add(step{ // h2c requires a cleartext backend
+		command: cmd("serve --bg --backend-protocol=h2c https://localhost:50051"),
+		wantErr: anyErr(),
+	})
+	add(step{ // backend protocol only applies to proxies
+		command: cmd("serve --bg --backend-protocol=h2c text:hello"),
+		wantErr: anyErr(),
+	})
+	add(step{
+		command: cmd("serve --bg --backend-protocol=spdy localhost:50051"),
+		wantErr: anyErr(),
+	})
+
+	// tailnet-only mount on a funneled port
+	add(step{reset: true})
+	add(step{
+		command: cmd("funnel --bg --set-path=/public localhost:3000"),
+		want: &ipn.ServeConfig{
+			TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+			Web: map[ipn.HostPort]*ipn.WebServerConfig{
+				"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+					"/public": {Proxy: "http://127.0.0.1:3000"},
+				}},
+			},
+			AllowFunnel: map[ipn.HostPort]bool{"foo.test.ts.net:443": true},
+		},
+	})
+	add(step{
+		command: cmd("serve --bg --set-path=/admin --funnel=false localhost:3001"),
+		want: &ipn.ServeConfig{
+			TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+			Web: map[ipn.HostPort]*ipn.WebServerConfig{
+				"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+					"/public": {Proxy: "http://127.0.0.1:3000"},
+					"/admin":  {Proxy: "http://127.0.0.1:3001", TailnetOnly: true},
+				}},
+			},
+			AllowFunnel: map[ipn.HostPort]bool{"foo.test.ts.net:443": true},
+		},
+	})
+	add(step{ // only web mounts can be tailnet-only
+		command: cmd("serve --bg --tcp=5432 --funnel=false localhost:5432"),
+		wantErr: anyErr(),
+	})
+
+	// basic auth
+	add(step{reset: true})
+	add(step{
+		command: cmd("funnel --bg --basic-auth=admin:$2a$04$KTMCTCZFUsGaTqUoHF0zD.jewUafOvq7fahg9c9jv/0LfBxIEZBka localhost:3000"),
+		want: &ipn.ServeConfig{
+			TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+			Web: map[ipn.HostPort]*ipn.WebServerConfig{
+				"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+					"/": {Proxy: "http://127.0.0.1:3000", BasicAuth: "admin:$2a$04$KTMCTCZFUsGaTqUoHF0zD.jewUafOvq7fahg9c9jv/0LfBxIEZBka"},
+				}},
+			},
+			AllowFunnel: map[ipn.HostPort]bool{"foo.test.ts.net:443": true},
+		},
+	})
+	add(step{ // the password must be hashed
+		command: cmd("serve --bg --basic-auth=admin:hunter2 localhost:3000"),
+		wantErr: anyErr(),
+	})
+	add(step{
+		command: cmd("serve --bg --basic-auth=admin localhost:3000"),
+		wantErr: anyErr(),
+	})
+
+	// automatic port selection
+	add(step{reset: true})
+	add(step{
+		command: cmd("serve --bg --https=auto localhost:3000"),
+		want: &ipn.ServeConfig{
+			TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+			Web: map[ipn.HostPort]*ipn.WebServerConfig{
+				"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+					"/": {Proxy: "http://127.0.0.1:3000"},
+				}},
+			},
+		},
+	})
+	add(step{
+		command: cmd("serve --bg --https=auto localhost:3001"),
+		want: &ipn.ServeConfig{
+			TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}, 8443: {HTTPS: true}},
+			Web: map[ipn.HostPort]*ipn.WebServerConfig{
+				"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+					"/": {Proxy: "http://127.0.0.1:3000"},
+				}},
+				"foo.test.ts.net:8443": {Handlers: map[string]*ipn.HTTPHandler{
+					"/": {Proxy: "http://127.0.0.1:3001"},
+				}},
+			},
+		},
+	})
+	add(step{
+		command: cmd("serve --https=auto off"),
+		wantErr: anyErr(),
+	})
+	add(step{
+		command: cmd("serve --bg --http=auto localhost:3002"),
+		wantErr: anyErr(),
+	})
+
+	// dry run
+	add(step{reset: true})
+	add(step{ // implies --bg, so doesn't start a foreground session
+		command: cmd("serve --dry-run localhost:3000"),
+		want:    nil, // nothing to save
+	})
+	add(step{
+		command: cmd("serve reset --dry-run"),
+		want:    nil, // nothing to save
+	})
+
 	lc := &fakeLocalServeClient{}
 	// And now run the steps above.
 	for i, st := range steps {
@@ -929,6 +1093,18 @@ func TestSrcTypeFromFlags(t *testing.T) {
 			expectedPort: 443,
 			expectedErr:  false,
 		},
+		{
+			name:         "https auto",
+			env:          &serveEnv{https: "auto"},
+			expectedType: serveTypeHTTPS,
+			expectedPort: 0,
+			expectedErr:  false,
+		},
+		{
+			name:        "tcp auto",
+			env:         &serveEnv{tcp: "auto"},
+			expectedErr: true,
+		},
 		{
 			name:         "multiple types set",
 			env:          &serveEnv{http: "80", https: "443"},
@@ -953,6 +1129,30 @@ func TestSrcTypeFromFlags(t *testing.T) {
 	}
 }
 
+func TestAutoServePort(t *testing.T) {
+	sc := &ipn.ServeConfig{}
+	for _, want := range []uint16{443, 8443, 10000} {
+		got, err := autoServePort(sc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("autoServePort = %d, want %d", got, want)
+		}
+		if want == 8443 {
+			// Ports used by foreground sessions aren't free either.
+			mak.Set(&sc.Foreground, "session", &ipn.ServeConfig{
+				TCP: map[uint16]*ipn.TCPPortHandler{got: {HTTPS: true}},
+			})
+			continue
+		}
+		mak.Set(&sc.TCP, got, &ipn.TCPPortHandler{HTTPS: true})
+	}
+	if got, err := autoServePort(sc); err == nil {
+		t.Errorf("autoServePort = %d with all ports in use, want error", got)
+	}
+}
+
 func TestExpandProxyTargetDev(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -1058,3 +1258,120 @@ func TestIsLegacyInvocation(t *testing.T) {
 		})
 	}
 }
+
+func TestParseWizardTarget(t *testing.T) {
+	ports := []portlist.Port{{Port: 3000}, {Port: 8080}}
+	tests := []struct {
+		in     string
+		want   uint16
+		wantOK bool
+	}{
+		{"1", 3000, true},
+		{"2", 8080, true},
+		{":2", 2, true},
+		{":8080", 8080, true},
+		{"3", 0, false},    // not listed, and not marked as a port
+		{"8080", 0, false}, // likewise
+		{"0", 0, false},
+		{":0", 0, false},
+		{":70000", 0, false},
+		{":", 0, false},
+		{"port", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseWizardTarget(tt.in, ports)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("parseWizardTarget(%q) = %v, %v; want %v, %v", tt.in, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestServeWizard(t *testing.T) {
+	defer func(old func() ([]portlist.Port, error)) { listeningPorts = old }(listeningPorts)
+	listeningPorts = func() ([]portlist.Port, error) {
+		return []portlist.Port{
+			{Proto: "tcp", Port: 3000, Process: "node"},
+			{Proto: "tcp", Port: 8080, Process: "python3"},
+		}, nil
+	}
+
+	tests := []struct {
+		name  string
+		input string
+		want  *ipn.ServeConfig // nil means no config is set
+	}{
+		{
+			name:  "defaults",
+			input: "\n\n\ny\n",
+			want: &ipn.ServeConfig{
+				TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+				Web: map[ipn.HostPort]*ipn.WebServerConfig{
+					"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+						"/": {Proxy: "http://127.0.0.1:3000"},
+					}},
+				},
+			},
+		},
+		{
+			name:  "unlisted-port-with-mount",
+			input: "bogus\n9000\n:9000\nwhat\ntailnet\n/app\nyes\n",
+			want: &ipn.ServeConfig{
+				TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+				Web: map[ipn.HostPort]*ipn.WebServerConfig{
+					"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+						"/app": {Proxy: "http://127.0.0.1:9000"},
+					}},
+				},
+			},
+		},
+		{
+			name:  "funnel",
+			input: "2\nfunnel\n\ny\n",
+			want: &ipn.ServeConfig{
+				TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+				Web: map[ipn.HostPort]*ipn.WebServerConfig{
+					"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+						"/": {Proxy: "http://127.0.0.1:8080"},
+					}},
+				},
+				AllowFunnel: map[ipn.HostPort]bool{"foo.test.ts.net:443": true},
+			},
+		},
+		{
+			// A colon marks a port, even one as small as a list number.
+			name:  "port-not-list-number",
+			input: ":2\ntailnet\n\ny\n",
+			want: &ipn.ServeConfig{
+				TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+				Web: map[ipn.HostPort]*ipn.WebServerConfig{
+					"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+						"/": {Proxy: "http://127.0.0.1:2"},
+					}},
+				},
+			},
+		},
+		{
+			name:  "declined",
+			input: "1\ntailnet\n/\nn\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lc := &fakeLocalServeClient{}
+			var stdout bytes.Buffer
+			e := &serveEnv{
+				lc:          lc,
+				testFlagOut: &stdout,
+				testStdout:  &stdout,
+				testStdin:   strings.NewReader(tt.input),
+			}
+			cmd := newServeWizardCommand(e)
+			if err := cmd.ParseAndRun(context.Background(), nil); err != nil {
+				t.Fatalf("wizard: %v\noutput:\n%s", err, stdout.Bytes())
+			}
+			if !reflect.DeepEqual(lc.config, tt.want) {
+				t.Errorf("got config:\n%v\nwant:\n%v", logger.AsJSON(lc.config), logger.AsJSON(tt.want))
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"tailscale.com/ipn"
+)
+
+// setServeConfig sets the serve config to sc. With --dry-run, it instead
+// prints how sc differs from the current config, without applying it.
+func (e *serveEnv) setServeConfig(ctx context.Context, sc *ipn.ServeConfig) error {
+	if !e.dryRun {
+		return e.lc.SetServeConfig(ctx, sc)
+	}
+	cur, err := e.lc.GetServeConfig(ctx)
+	if err != nil {
+		return err
+	}
+	return e.printServeConfigDiff(e.stdout(), cur, sc)
+}
+
+// printServeConfigDiff writes the change from the serve config cur to sc to
+// w, as a unified diff of their JSON, or as a JSON patch (RFC 6902) with
+// --json.
+func (e *serveEnv) printServeConfigDiff(w io.Writer, cur, sc *ipn.ServeConfig) error {
+	if cur == nil {
+		cur = new(ipn.ServeConfig)
+	}
+	if sc == nil {
+		sc = new(ipn.ServeConfig)
+	}
+	a, err := json.MarshalIndent(cur, "", "  ")
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(sc, "", "  ")
+	if err != nil {
+		return err
+	}
+	if e.json {
+		patch, err := jsonPatch(a, b)
+		if err != nil {
+			return err
+		}
+		j, err := json.MarshalIndent(patch, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\n", j)
+		return nil
+	}
+	diff := unifiedDiff("current", "proposed", strings.Split(string(a), "\n"), strings.Split(string(b), "\n"))
+	if diff == "" {
+		fmt.Fprintln(w, "No changes.")
+		return nil
+	}
+	io.WriteString(w, diff)
+	return nil
+}
+
+// diffLine is a line of a diff, prefixed by ' ' if it's in both inputs, '-'
+// if it's only in the first and '+' if it's only in the second.
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// diffLines returns the lines of a and b, in order, marked by whether
+// they're common to both. It finds the longest common subsequence, which is
+// fine for the small inputs it's used with.
+func diffLines(a, b []string) []diffLine {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:]
+	// and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var ret []diffLine
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ret = append(ret, diffLine{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ret = append(ret, diffLine{'-', a[i]})
+			i++
+		default:
+			ret = append(ret, diffLine{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ret = append(ret, diffLine{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ret = append(ret, diffLine{'+', b[j]})
+	}
+	return ret
+}
+
+// unifiedDiff returns the unified diff, with three lines of context, of the
+// lines a and b, named aName and bName. It returns the empty string if they
+// are equal.
+func unifiedDiff(aName, bName string, a, b []string) string {
+	const numContext = 3
+	lines := diffLines(a, b)
+
+	// aPos[k] and bPos[k] are the number of lines of a and b before
+	// lines[k].
+	aPos := make([]int, len(lines)+1)
+	bPos := make([]int, len(lines)+1)
+	for k, l := range lines {
+		aPos[k+1], bPos[k+1] = aPos[k], bPos[k]
+		if l.op != '+' {
+			aPos[k+1]++
+		}
+		if l.op != '-' {
+			bPos[k+1]++
+		}
+	}
+	hunkStart := func(pos, n int) int {
+		if n == 0 {
+			return pos
+		}
+		return pos + 1
+	}
+
+	var sb strings.Builder
+	for start := 0; start < len(lines); {
+		c := start
+		for c < len(lines) && lines[c].op == ' ' {
+			c++
+		}
+		if c == len(lines) {
+			break
+		}
+		// Extend the hunk over changes separated by no more than twice
+		// the context, so that hunks don't overlap.
+		end := c + 1
+		for k := c; k < len(lines) && k-end <= 2*numContext; k++ {
+			if lines[k].op != ' ' {
+				end = k + 1
+			}
+		}
+		hs := max(c-numContext, start)
+		he := min(end+numContext, len(lines))
+
+		if sb.Len() == 0 {
+			fmt.Fprintf(&sb, "--- %s\n+++ %s\n", aName, bName)
+		}
+		an, bn := aPos[he]-aPos[hs], bPos[he]-bPos[hs]
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", hunkStart(aPos[hs], an), an, hunkStart(bPos[hs], bn), bn)
+		for _, l := range lines[hs:he] {
+			sb.WriteByte(l.op)
+			sb.WriteString(l.text)
+			sb.WriteByte('\n')
+		}
+		start = he
+	}
+	return sb.String()
+}
+
+// jsonPatchOp is an operation of a JSON patch, as defined by RFC 6902.
+type jsonPatchOp struct {
+	Op    string          `json:"op"` // "add", "remove" or "replace"
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// jsonPatch returns the JSON patch that transforms the JSON document a into
+// b. Objects are compared member by member; any other differing values,
+// including arrays, are replaced whole.
+func jsonPatch(a, b []byte) ([]jsonPatchOp, error) {
+	var av, bv any
+	if err := json.Unmarshal(a, &av); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &bv); err != nil {
+		return nil, err
+	}
+	ops := []jsonPatchOp{}
+	if err := appendJSONPatch(&ops, "", av, bv); err != nil {
+		return nil, err
+	}
+	return ops, nil
+}
+
+var jsonPointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+func appendJSONPatch(ops *[]jsonPatchOp, path string, a, b any) error {
+	am, aok := a.(map[string]any)
+	bm, bok := b.(map[string]any)
+	if !aok || !bok {
+		if reflect.DeepEqual(a, b) {
+			return nil
+		}
+		v, err := json.Marshal(b)
+		if err != nil {
+			return err
+		}
+		*ops = append(*ops, jsonPatchOp{Op: "replace", Path: path, Value: v})
+		return nil
+	}
+
+	keys := make([]string, 0, len(am)+len(bm))
+	for k := range am {
+		keys = append(keys, k)
+	}
+	for k := range bm {
+		if _, ok := am[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		p := path + "/" + jsonPointerEscaper.Replace(k)
+		av, inA := am[k]
+		bv, inB := bm[k]
+		switch {
+		case !inB:
+			*ops = append(*ops, jsonPatchOp{Op: "remove", Path: p})
+		case !inA:
+			v, err := json.Marshal(bv)
+			if err != nil {
+				return err
+			}
+			*ops = append(*ops, jsonPatchOp{Op: "add", Path: p, Value: v})
+		default:
+			if err := appendJSONPatch(ops, p, av, bv); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
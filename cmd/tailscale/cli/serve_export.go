@@ -0,0 +1,307 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+	"tailscale.com/ipn"
+)
+
+// newServeExportCommand returns the "export" subcommand of serve and funnel,
+// using e as its environment.
+func newServeExportCommand(e *serveEnv) *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "export",
+		ShortUsage: "export > cfg.json",
+		ShortHelp:  "print the serve/funnel config as JSON",
+		LongHelp: strings.TrimSpace(`
+The 'export' subcommand prints the background serve/funnel config as JSON,
+to back it up or to copy it to another machine with 'import'. The configs
+of foreground serve sessions aren't included.
+`),
+		Exec:      e.runServeExport,
+		FlagSet:   e.newFlags("serve-export", nil),
+		UsageFunc: usageFunc,
+	}
+}
+
+// newServeImportCommand returns the "import" subcommand of serve and funnel,
+// using e as its environment.
+func newServeImportCommand(e *serveEnv) *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "import",
+		ShortUsage: "import [--dry-run [--json]] <cfg.json | ->",
+		ShortHelp:  "replace the serve/funnel config with an exported one",
+		LongHelp: strings.TrimSpace(`
+The 'import' subcommand replaces the background serve/funnel config with
+one written by 'export', read from the named file or, for "-", from
+standard input. The config is checked before it's applied, and the DNS
+name of the machine it was exported from is replaced by this machine's,
+so a config can be moved between machines. Foreground serve sessions
+are left running.
+`),
+		Exec:      e.runServeImport,
+		FlagSet:   e.newFlags("serve-import", addDryRunFlags(e)),
+		UsageFunc: usageFunc,
+	}
+}
+
+// runServeExport is the entry point for the "serve export" subcommand.
+func (e *serveEnv) runServeExport(ctx context.Context, args []string) error {
+	if len(args) != 0 {
+		return flag.ErrHelp
+	}
+	sc, err := e.lc.GetServeConfig(ctx)
+	if err != nil {
+		return err
+	}
+	if sc == nil {
+		sc = new(ipn.ServeConfig)
+	}
+	sc = sc.Clone()
+	sc.Foreground = nil
+	j, err := json.MarshalIndent(sc, "", "  ")
+	if err != nil {
+		return err
+	}
+	j = append(j, '\n')
+	_, err = e.stdout().Write(j)
+	return err
+}
+
+// runServeImport is the entry point for the "serve import" subcommand.
+//
+// Examples:
+//   - tailscale serve import cfg.json
+//   - tailscale serve import --dry-run cfg.json
+//   - ssh otherhost tailscale serve export | tailscale serve import -
+func (e *serveEnv) runServeImport(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return flag.ErrHelp
+	}
+	var j []byte
+	var err error
+	if args[0] == "-" {
+		j, err = io.ReadAll(e.stdin())
+	} else {
+		j, err = os.ReadFile(filepath.Clean(args[0]))
+	}
+	if err != nil {
+		return err
+	}
+	sc := new(ipn.ServeConfig)
+	dec := json.NewDecoder(bytes.NewReader(j))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(sc); err != nil {
+		return fmt.Errorf("parsing serve config: %w", err)
+	}
+	if len(sc.Foreground) > 0 {
+		return errors.New("serve config has foreground sessions, which can't be imported")
+	}
+	dnsName, err := e.getSelfDNSName(ctx)
+	if err != nil {
+		return err
+	}
+	if err := renameServeConfigHost(sc, dnsName); err != nil {
+		return err
+	}
+	if err := validateServeConfig(sc); err != nil {
+		return fmt.Errorf("invalid serve config: %w", err)
+	}
+
+	cur, err := e.lc.GetServeConfig(ctx)
+	if err != nil {
+		return err
+	}
+	if cur != nil {
+		// Keep running foreground sessions, and make the change
+		// conditional on the config not changing in the meantime.
+		sc.Foreground = cur.Clone().Foreground
+		sc.ETag = cur.ETag
+	}
+	return e.setServeConfig(ctx, sc)
+}
+
+// renameServeConfigHost changes the host of every HostPort in sc, and the
+// SNI name of TLS-terminated TCP forwarders, to dnsName. It returns an
+// error if sc serves more than one host, which a node never does.
+func renameServeConfigHost(sc *ipn.ServeConfig, dnsName string) error {
+	var oldName string
+	checkName := func(name string) error {
+		if oldName != "" && name != oldName {
+			return fmt.Errorf("serve config is for both %q and %q", oldName, name)
+		}
+		oldName = name
+		return nil
+	}
+	rename := func(hp ipn.HostPort) (ipn.HostPort, error) {
+		host, port, err := net.SplitHostPort(string(hp))
+		if err != nil {
+			return "", fmt.Errorf("invalid host:port %q: %w", hp, err)
+		}
+		if err := checkName(host); err != nil {
+			return "", err
+		}
+		return ipn.HostPort(net.JoinHostPort(dnsName, port)), nil
+	}
+
+	web := make(map[ipn.HostPort]*ipn.WebServerConfig, len(sc.Web))
+	for hp, c := range sc.Web {
+		nhp, err := rename(hp)
+		if err != nil {
+			return err
+		}
+		web[nhp] = c
+	}
+	allowFunnel := make(map[ipn.HostPort]bool, len(sc.AllowFunnel))
+	for hp, on := range sc.AllowFunnel {
+		nhp, err := rename(hp)
+		if err != nil {
+			return err
+		}
+		allowFunnel[nhp] = on
+	}
+	funnelExpiry := make(map[ipn.HostPort]time.Time, len(sc.FunnelExpiry))
+	for hp, t := range sc.FunnelExpiry {
+		nhp, err := rename(hp)
+		if err != nil {
+			return err
+		}
+		funnelExpiry[nhp] = t
+	}
+	for _, h := range sc.TCP {
+		if h != nil && h.TerminateTLS != "" {
+			if err := checkName(h.TerminateTLS); err != nil {
+				return err
+			}
+			h.TerminateTLS = dnsName
+		}
+	}
+	if sc.Web != nil {
+		sc.Web = web
+	}
+	if sc.AllowFunnel != nil {
+		sc.AllowFunnel = allowFunnel
+	}
+	if sc.FunnelExpiry != nil {
+		sc.FunnelExpiry = funnelExpiry
+	}
+	return nil
+}
+
+// validateServeConfig reports whether sc is a config that the serve commands
+// could have made, such that tailscaled can serve all of it.
+func validateServeConfig(sc *ipn.ServeConfig) error {
+	for port, h := range sc.TCP {
+		if port == 0 {
+			return errors.New("port 0 in TCP")
+		}
+		if h == nil {
+			return fmt.Errorf("port %d: no handler", port)
+		}
+		n := 0
+		for _, set := range []bool{h.HTTPS, h.HTTP, h.TCPForward != ""} {
+			if set {
+				n++
+			}
+		}
+		if n != 1 {
+			return fmt.Errorf("port %d: exactly one of HTTPS, HTTP and TCPForward must be set", port)
+		}
+		if h.TCPForward != "" {
+			if _, _, err := net.SplitHostPort(h.TCPForward); err != nil {
+				return fmt.Errorf("port %d: invalid TCPForward %q: %w", port, h.TCPForward, err)
+			}
+		} else if h.TerminateTLS != "" {
+			return fmt.Errorf("port %d: TerminateTLS is only used with TCPForward", port)
+		}
+	}
+	for hp, c := range sc.Web {
+		port, err := hp.Port()
+		if err != nil {
+			return fmt.Errorf("invalid web host:port %q: %w", hp, err)
+		}
+		if !sc.IsServingWeb(port) {
+			return fmt.Errorf("%s: port %d isn't set to HTTP or HTTPS in TCP", hp, port)
+		}
+		if c == nil || len(c.Handlers) == 0 {
+			return fmt.Errorf("%s: no handlers", hp)
+		}
+		for mount, h := range c.Handlers {
+			if err := validateWebHandler(mount, h); err != nil {
+				return fmt.Errorf("%s%s: %w", hp, mount, err)
+			}
+		}
+	}
+	for hp := range sc.AllowFunnel {
+		if _, ok := sc.Web[hp]; !ok {
+			return fmt.Errorf("funnel allowed for %s, which has no web handlers", hp)
+		}
+	}
+	for hp := range sc.FunnelExpiry {
+		if !sc.AllowFunnel[hp] {
+			return fmt.Errorf("funnel expiry for %s, which isn't funneled", hp)
+		}
+	}
+	return nil
+}
+
+// validateWebHandler reports whether h is a valid handler to mount at mount.
+func validateWebHandler(mount string, h *ipn.HTTPHandler) error {
+	if clean, err := cleanMountPoint(mount); err != nil || clean != mount {
+		return fmt.Errorf("invalid mount point %q", mount)
+	}
+	if h == nil {
+		return errors.New("no handler")
+	}
+	n := 0
+	for _, v := range []string{h.Path, h.Proxy, h.Text, h.Redirect} {
+		if v != "" {
+			n++
+		}
+	}
+	if n > 1 {
+		return errors.New("only one of Path, Proxy, Text and Redirect may be set")
+	}
+	switch {
+	case h.Path != "":
+		if !filepath.IsAbs(h.Path) {
+			return fmt.Errorf("path %q isn't absolute", h.Path)
+		}
+	case h.Proxy != "":
+		if !isProxyTarget(h.Proxy) {
+			return fmt.Errorf("invalid proxy target %q", h.Proxy)
+		}
+	case h.Redirect != "":
+		target := "redirect:" + h.Redirect
+		if h.StatusCode != 0 {
+			target = fmt.Sprintf("redirect:%d:%s", h.StatusCode, h.Redirect)
+		}
+		if _, _, err := parseRedirectTarget(target); err != nil {
+			return err
+		}
+	}
+	switch h.BackendProtocol {
+	case "", ipn.BackendProtocolHTTP1, ipn.BackendProtocolH2C:
+	default:
+		return fmt.Errorf("invalid BackendProtocol %q", h.BackendProtocol)
+	}
+	if h.BasicAuth != "" && !strings.Contains(h.BasicAuth, ":") {
+		return errors.New(`BasicAuth must be "user:hash"`)
+	}
+	return nil
+}
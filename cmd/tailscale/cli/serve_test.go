@@ -15,6 +15,7 @@
 	"runtime"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/peterbourgon/ff/v3/ffcli"
 	"tailscale.com/client/tailscale"
@@ -91,6 +92,14 @@ type step struct {
 		command: cmd("funnel"),
 		wantErr: exactErr(flag.ErrHelp, "flag.ErrHelp"),
 	})
+	add(step{
+		command: cmd("funnel --expire=2h 443 off"),
+		wantErr: anyErr(),
+	})
+	add(step{
+		command: cmd("funnel --expire=-1h 443 on"),
+		wantErr: anyErr(),
+	})
 
 	// https
 	add(step{reset: true})
@@ -284,6 +293,121 @@ type step struct {
 		command: cmd("reset"),
 		want:    &ipn.ServeConfig{},
 	})
+
+	// selective reset
+	add(step{reset: true})
+	add(step{
+		command: cmd("https:443 / http://127.0.0.1:3000"),
+		want: &ipn.ServeConfig{
+			TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+			Web: map[ipn.HostPort]*ipn.WebServerConfig{
+				"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+					"/": {Proxy: "http://127.0.0.1:3000"},
+				}},
+			},
+		},
+	})
+	add(step{
+		command: cmd("https:443 /api http://127.0.0.1:4000"),
+		want: &ipn.ServeConfig{
+			TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+			Web: map[ipn.HostPort]*ipn.WebServerConfig{
+				"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+					"/":    {Proxy: "http://127.0.0.1:3000"},
+					"/api": {Proxy: "http://127.0.0.1:4000"},
+				}},
+			},
+		},
+	})
+	add(step{
+		command: cmd("https:8443 / text:hi"),
+		want: &ipn.ServeConfig{
+			TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}, 8443: {HTTPS: true}},
+			Web: map[ipn.HostPort]*ipn.WebServerConfig{
+				"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+					"/":    {Proxy: "http://127.0.0.1:3000"},
+					"/api": {Proxy: "http://127.0.0.1:4000"},
+				}},
+				"foo.test.ts.net:8443": {Handlers: map[string]*ipn.HTTPHandler{
+					"/": {Text: "hi"},
+				}},
+			},
+		},
+	})
+	add(step{
+		command: cmd("tls-terminated-tcp:10000 tcp://localhost:5432"),
+		want: &ipn.ServeConfig{
+			TCP: map[uint16]*ipn.TCPPortHandler{
+				443:   {HTTPS: true},
+				8443:  {HTTPS: true},
+				10000: {TCPForward: "127.0.0.1:5432", TerminateTLS: "foo.test.ts.net"},
+			},
+			Web: map[ipn.HostPort]*ipn.WebServerConfig{
+				"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+					"/":    {Proxy: "http://127.0.0.1:3000"},
+					"/api": {Proxy: "http://127.0.0.1:4000"},
+				}},
+				"foo.test.ts.net:8443": {Handlers: map[string]*ipn.HTTPHandler{
+					"/": {Text: "hi"},
+				}},
+			},
+		},
+	})
+	add(step{ // bad type
+		command: cmd("reset --type=nope"),
+		wantErr: anyErr(),
+	})
+	add(step{ // nothing on that port
+		command: cmd("reset --port=9999"),
+		wantErr: anyErr(),
+	})
+	add(step{
+		command: cmd("reset --port=443 --path=/api"),
+		want: &ipn.ServeConfig{
+			TCP: map[uint16]*ipn.TCPPortHandler{
+				443:   {HTTPS: true},
+				8443:  {HTTPS: true},
+				10000: {TCPForward: "127.0.0.1:5432", TerminateTLS: "foo.test.ts.net"},
+			},
+			Web: map[ipn.HostPort]*ipn.WebServerConfig{
+				"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+					"/": {Proxy: "http://127.0.0.1:3000"},
+				}},
+				"foo.test.ts.net:8443": {Handlers: map[string]*ipn.HTTPHandler{
+					"/": {Text: "hi"},
+				}},
+			},
+		},
+	})
+	add(step{
+		command: cmd("reset --type=text"),
+		want: &ipn.ServeConfig{
+			TCP: map[uint16]*ipn.TCPPortHandler{
+				443:   {HTTPS: true},
+				10000: {TCPForward: "127.0.0.1:5432", TerminateTLS: "foo.test.ts.net"},
+			},
+			Web: map[ipn.HostPort]*ipn.WebServerConfig{
+				"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+					"/": {Proxy: "http://127.0.0.1:3000"},
+				}},
+			},
+		},
+	})
+	add(step{
+		command: cmd("reset --port=10000"),
+		want: &ipn.ServeConfig{
+			TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+			Web: map[ipn.HostPort]*ipn.WebServerConfig{
+				"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+					"/": {Proxy: "http://127.0.0.1:3000"},
+				}},
+			},
+		},
+	})
+	add(step{
+		command: cmd("reset --type=proxy"),
+		want:    &ipn.ServeConfig{},
+	})
 	add(step{
 		command: cmd("https:443 / https+insecure://127.0.0.1:3001"),
 		want: &ipn.ServeConfig{
@@ -684,6 +808,94 @@ type step struct {
 		wantErr: anyErr(),
 	})
 
+	// redirects
+	add(step{reset: true})
+	add(step{
+		command: cmd("https:443 /docs redirect:https://example.com/docs"),
+		want: &ipn.ServeConfig{
+			TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+			Web: map[ipn.HostPort]*ipn.WebServerConfig{
+				"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+					"/docs": {Redirect: "https://example.com/docs"},
+				}},
+			},
+		},
+	})
+	add(step{
+		command: cmd("https:443 /docs redirect:301:https://example.com/docs"),
+		want: &ipn.ServeConfig{
+			TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+			Web: map[ipn.HostPort]*ipn.WebServerConfig{
+				"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+					"/docs": {Redirect: "https://example.com/docs", StatusCode: 301},
+				}},
+			},
+		},
+	})
+	add(step{
+		command: cmd("https:443 /docs redirect:404:https://example.com/docs"),
+		wantErr: anyErr(),
+	})
+	add(step{
+		command: cmd("https:443 /docs redirect:/relative"),
+		wantErr: anyErr(),
+	})
+	add(step{reset: true})
+	add(step{
+		command: cmd("https:443 / localhost:3000"),
+		want: &ipn.ServeConfig{
+			TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+			Web: map[ipn.HostPort]*ipn.WebServerConfig{
+				"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+					"/": {Proxy: "http://127.0.0.1:3000"},
+				}},
+			},
+		},
+	})
+
+	// rollback
+	add(step{ // undo the reset
+		command: cmd("reset"),
+		want:    &ipn.ServeConfig{},
+	})
+	add(step{
+		command: cmd("rollback"),
+		want: &ipn.ServeConfig{
+			TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+			Web: map[ipn.HostPort]*ipn.WebServerConfig{
+				"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+					"/": {Proxy: "http://127.0.0.1:3000"},
+				}},
+			},
+		},
+	})
+	add(step{
+		command: cmd("rollback --to=0"),
+		wantErr: anyErr(),
+	})
+	add(step{
+		command: cmd("rollback --to=1000"),
+		wantErr: anyErr(),
+	})
+
+	// dry run
+	add(step{
+		command: cmd("--dry-run https / off"),
+		want:    nil, // nothing to save
+	})
+	add(step{
+		command: cmd("--dry-run --json tcp:2222 tcp://localhost:22"),
+		want:    nil, // nothing to save
+	})
+	add(step{
+		command: cmd("reset --dry-run"),
+		want:    nil, // nothing to save
+	})
+	add(step{
+		command: cmd("funnel --dry-run 443 on"),
+		want:    nil, // nothing to save
+	})
+
 	lc := &fakeLocalServeClient{}
 	// And now run the steps above.
 	for i, st := range steps {
@@ -748,6 +960,147 @@ type step struct {
 	}
 }
 
+func TestFunnelStatus(t *testing.T) {
+	const hp = ipn.HostPort("foo.test.ts.net:443")
+	exp := time.Date(2023, 10, 1, 12, 0, 0, 0, time.Local)
+	tests := []struct {
+		name string
+		sc   *ipn.ServeConfig
+		want string
+	}{
+		{"off", &ipn.ServeConfig{}, "tailnet only"},
+		{"on", &ipn.ServeConfig{AllowFunnel: map[ipn.HostPort]bool{hp: true}}, "Funnel on"},
+		{"on-expiring", &ipn.ServeConfig{
+			AllowFunnel:  map[ipn.HostPort]bool{hp: true},
+			FunnelExpiry: map[ipn.HostPort]time.Time{hp: exp},
+		}, "Funnel on until " + exp.Format("2006-01-02 15:04 MST")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := funnelStatus(tt.sc, hp); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFmtServeCertStatus(t *testing.T) {
+	const d = "foo.test.ts.net"
+	now := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+	notAfter := time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC)
+	renewAt := time.Date(2023, 11, 10, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		c    ipn.ServeCertStatus
+		want string
+	}{
+		{"fetching", ipn.ServeCertStatus{Domain: d}, d + ": fetching"},
+		{"valid", ipn.ServeCertStatus{Domain: d, NotAfter: notAfter, RenewAt: renewAt, LastAttempt: now},
+			d + ": valid until 2023-12-01, renews 2023-11-10"},
+		{"expired", ipn.ServeCertStatus{Domain: d, NotAfter: now.Add(-time.Hour), LastAttempt: now},
+			d + ": expired 2023-10-01"},
+		{"failed", ipn.ServeCertStatus{Domain: d, LastAttempt: now.Add(-time.Minute), LastError: "rate limited"},
+			d + ": not issued (last attempt 1m0s ago failed: rate limited)"},
+		{"renewal-failed", ipn.ServeCertStatus{Domain: d, NotAfter: notAfter, LastAttempt: now, LastError: "rate limited"},
+			d + ": valid until 2023-12-01 (last attempt 0s ago failed: rate limited)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fmtServeCertStatus(tt.c, now); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServeDryRun(t *testing.T) {
+	tests := []struct {
+		name string
+		json bool
+		want string
+	}{
+		{
+			name: "diff",
+			want: `--- current
++++ proposed
+@@ -1,1 +1,5 @@
+-{}
++{
++  "AllowFunnel": {
++    "foo.test.ts.net:443": true
++  }
++}
+`,
+		},
+		{
+			name: "json",
+			json: true,
+			want: `[
+  {
+    "op": "add",
+    "path": "/AllowFunnel",
+    "value": {
+      "foo.test.ts.net:443": true
+    }
+  }
+]
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lc := &fakeLocalServeClient{}
+			var stdout bytes.Buffer
+			e := &serveEnv{
+				lc:          lc,
+				testFlagOut: new(bytes.Buffer),
+				testStdout:  &stdout,
+			}
+			args := cmd("--dry-run 443 on")
+			if tt.json {
+				args = append([]string{"--json"}, args...)
+			}
+			if err := newFunnelCommand(e).ParseAndRun(context.Background(), args); err != nil {
+				t.Fatal(err)
+			}
+			if lc.setCount != 0 {
+				t.Errorf("dry run saved the serve config")
+			}
+			if got := stdout.String(); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	a := strings.Split("a b c d e f g h i j k l m n", " ")
+	b := strings.Split("a B c d e f g h i j k l M n", " ")
+	const want = `--- x
++++ y
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -10,5 +10,5 @@
+ j
+ k
+ l
+-m
++M
+ n
+`
+	if got := unifiedDiff("x", "y", a, b); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if got := unifiedDiff("x", "y", a, a); got != "" {
+		t.Errorf("diff of equal inputs = %q; want empty", got)
+	}
+}
+
 func TestVerifyFunnelEnabled(t *testing.T) {
 	lc := &fakeLocalServeClient{}
 	var stdout bytes.Buffer
@@ -838,6 +1191,98 @@ func TestVerifyFunnelEnabled(t *testing.T) {
 	}
 }
 
+func TestServeExportImport(t *testing.T) {
+	// A config exported from another machine.
+	exported := &ipn.ServeConfig{
+		TCP: map[uint16]*ipn.TCPPortHandler{
+			443:  {HTTPS: true},
+			5432: {TCPForward: "127.0.0.1:5432", TerminateTLS: "bar.test.ts.net"},
+		},
+		Web: map[ipn.HostPort]*ipn.WebServerConfig{
+			"bar.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+				"/": {Proxy: "http://127.0.0.1:3000"},
+			}},
+		},
+		AllowFunnel: map[ipn.HostPort]bool{"bar.test.ts.net:443": true},
+	}
+	var stdout bytes.Buffer
+	e := &serveEnv{
+		lc:          &fakeLocalServeClient{config: exported},
+		testFlagOut: new(bytes.Buffer),
+		testStdout:  &stdout,
+	}
+	if err := newServeCommand(e).ParseAndRun(context.Background(), cmd("export")); err != nil {
+		t.Fatal(err)
+	}
+	cfgFile := filepath.Join(t.TempDir(), "cfg.json")
+	if err := os.WriteFile(cfgFile, stdout.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	lc := &fakeLocalServeClient{config: &ipn.ServeConfig{
+		Foreground: map[string]*ipn.ServeConfig{"sess": {TCP: map[uint16]*ipn.TCPPortHandler{8443: {HTTPS: true}}}},
+	}}
+	e = &serveEnv{
+		lc:          lc,
+		testFlagOut: new(bytes.Buffer),
+		testStdout:  new(bytes.Buffer),
+	}
+	if err := newServeCommand(e).ParseAndRun(context.Background(), []string{"import", "--dry-run", cfgFile}); err != nil {
+		t.Fatal(err)
+	}
+	if lc.setCount != 0 {
+		t.Errorf("dry run saved the serve config")
+	}
+	if err := newServeCommand(e).ParseAndRun(context.Background(), []string{"import", cfgFile}); err != nil {
+		t.Fatal(err)
+	}
+	want := &ipn.ServeConfig{
+		TCP: map[uint16]*ipn.TCPPortHandler{
+			443:  {HTTPS: true},
+			5432: {TCPForward: "127.0.0.1:5432", TerminateTLS: "foo.test.ts.net"},
+		},
+		Web: map[ipn.HostPort]*ipn.WebServerConfig{
+			"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+				"/": {Proxy: "http://127.0.0.1:3000"},
+			}},
+		},
+		AllowFunnel: map[ipn.HostPort]bool{"foo.test.ts.net:443": true},
+		Foreground:  lc.config.Foreground,
+	}
+	if !reflect.DeepEqual(lc.config, want) {
+		t.Errorf("imported config:\n%s\nwant:\n%s", logger.AsJSON(lc.config), logger.AsJSON(want))
+	}
+
+	for name, j := range map[string]string{
+		"not-json":       "nope",
+		"unknown-field":  `{"Nope": 1}`,
+		"missing-tcp":    `{"Web": {"bar.test.ts.net:443": {"Handlers": {"/": {"Text": "hi"}}}}}`,
+		"two-hosts":      `{"TCP": {"443": {"HTTPS": true}}, "Web": {"a.ts.net:443": {"Handlers": {"/": {"Text": "hi"}}}, "b.ts.net:443": {"Handlers": {"/": {"Text": "hi"}}}}}`,
+		"bad-mount":      `{"TCP": {"443": {"HTTPS": true}}, "Web": {"bar.test.ts.net:443": {"Handlers": {"foo": {"Text": "hi"}}}}}`,
+		"two-targets":    `{"TCP": {"443": {"HTTPS": true}}, "Web": {"bar.test.ts.net:443": {"Handlers": {"/": {"Text": "hi", "Proxy": "http://127.0.0.1:3000"}}}}}`,
+		"https-and-tcp":  `{"TCP": {"443": {"HTTPS": true, "TCPForward": "127.0.0.1:22"}}}`,
+		"funnel-no-web":  `{"TCP": {"443": {"HTTPS": true}}, "AllowFunnel": {"bar.test.ts.net:443": true}}`,
+		"bad-forward":    `{"TCP": {"22": {"TCPForward": "nope"}}}`,
+		"bad-redirect":   `{"TCP": {"443": {"HTTPS": true}}, "Web": {"bar.test.ts.net:443": {"Handlers": {"/": {"Redirect": "/relative"}}}}}`,
+		"bad-proto":      `{"TCP": {"443": {"HTTPS": true}}, "Web": {"bar.test.ts.net:443": {"Handlers": {"/": {"Proxy": "http://127.0.0.1:3000", "BackendProtocol": "h3"}}}}}`,
+		"foreground-cfg": `{"Foreground": {"sess": {}}}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			if err := os.WriteFile(cfgFile, []byte(j), 0600); err != nil {
+				t.Fatal(err)
+			}
+			lc := &fakeLocalServeClient{}
+			e := &serveEnv{lc: lc, testFlagOut: new(bytes.Buffer), testStdout: new(bytes.Buffer)}
+			if err := newServeCommand(e).ParseAndRun(context.Background(), []string{"import", cfgFile}); err == nil {
+				t.Error("imported invalid config")
+			}
+			if lc.setCount != 0 {
+				t.Error("saved invalid config")
+			}
+		})
+	}
+}
+
 // fakeLocalServeClient is a fake tailscale.LocalClient for tests.
 // It's not a full implementation, just enough to test the serve command.
 //
@@ -845,6 +1290,8 @@ func TestVerifyFunnelEnabled(t *testing.T) {
 // ServeConfig state. This implementation cannot be used concurrently.
 type fakeLocalServeClient struct {
 	config               *ipn.ServeConfig
+	history              []ipn.ServeConfigRevision // previous configs, newest first
+	certs                []ipn.ServeCertStatus     // returned by ServeCertStatus
 	setCount             int                       // counts calls to SetServeConfig
 	queryFeatureResponse *mockQueryFeatureResponse // mock response to QueryFeature calls
 }
@@ -872,10 +1319,28 @@ func (lc *fakeLocalServeClient) GetServeConfig(ctx context.Context) (*ipn.ServeC
 
 func (lc *fakeLocalServeClient) SetServeConfig(ctx context.Context, config *ipn.ServeConfig) error {
 	lc.setCount += 1
+	if lc.config != nil {
+		lc.history = append([]ipn.ServeConfigRevision{{Config: lc.config}}, lc.history...)
+	}
 	lc.config = config.Clone()
 	return nil
 }
 
+func (lc *fakeLocalServeClient) GetServeConfigHistory(ctx context.Context) ([]ipn.ServeConfigRevision, error) {
+	return lc.history, nil
+}
+
+func (lc *fakeLocalServeClient) RollbackServeConfig(ctx context.Context, n int) error {
+	if n < 1 || n > len(lc.history) {
+		return fmt.Errorf("no serve config revision %d", n)
+	}
+	return lc.SetServeConfig(ctx, lc.history[n-1].Config)
+}
+
+func (lc *fakeLocalServeClient) ServeCertStatus(ctx context.Context) ([]ipn.ServeCertStatus, error) {
+	return lc.certs, nil
+}
+
 type mockQueryFeatureResponse struct {
 	resp *tailcfg.QueryFeatureResponse
 	err  error
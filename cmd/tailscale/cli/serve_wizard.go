@@ -0,0 +1,228 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+	"tailscale.com/ipn"
+	"tailscale.com/portlist"
+)
+
+// newServeWizardCommand returns the "wizard" subcommand of serve, using e as
+// its environment.
+func newServeWizardCommand(e *serveEnv) *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "wizard",
+		ShortUsage: "serve wizard",
+		ShortHelp:  "interactively share a local server",
+		LongHelp: strings.TrimSpace(`
+The 'tailscale serve wizard' command walks through sharing a local web
+server: it lists the ports that servers on this machine are listening on,
+asks whether to share the chosen one within your tailnet or publish it to
+the internet with Funnel, and where to mount it. It then shows the
+resulting serve config and asks before applying it.
+`),
+		Exec:      e.runServeWizard,
+		FlagSet:   e.newFlags("serve-wizard", nil),
+		UsageFunc: usageFunc,
+	}
+}
+
+// listeningPorts returns the TCP ports that local servers are listening on,
+// sorted and without duplicates. It's a variable for tests.
+var listeningPorts = func() ([]portlist.Port, error) {
+	p := &portlist.Poller{IncludeLocalhost: true}
+	defer p.Close()
+	ports, _, err := p.Poll()
+	if err != nil {
+		return nil, err
+	}
+	var ret []portlist.Port
+	seen := map[uint16]bool{}
+	for _, pt := range ports {
+		if pt.Proto != "tcp" || seen[pt.Port] {
+			continue
+		}
+		seen[pt.Port] = true
+		ret = append(ret, pt)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Port < ret[j].Port })
+	return ret, nil
+}
+
+func (e *serveEnv) stdin() io.Reader {
+	if e.testStdin != nil {
+		return e.testStdin
+	}
+	return os.Stdin
+}
+
+// prompt writes question to stdout and returns the trimmed line read from
+// r, or def if the line is empty.
+func (e *serveEnv) prompt(r *bufio.Reader, question, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(e.stdout(), "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(e.stdout(), "%s: ", question)
+	}
+	line, err := r.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		if err == io.EOF {
+			return "", errors.New("aborted")
+		}
+		return "", err
+	}
+	if line = strings.TrimSpace(line); line == "" {
+		return def, nil
+	}
+	return line, nil
+}
+
+// parseWizardTarget parses the answer to the wizard's question of which
+// local server to share: either the number of one of ports as listed, or a
+// port number prefixed with a colon, such as ":8080". A bare number is
+// only ever a list number, as a small port number could otherwise be
+// mistaken for one.
+func parseWizardTarget(ans string, ports []portlist.Port) (port uint16, ok bool) {
+	if p, isPort := strings.CutPrefix(ans, ":"); isPort {
+		n, err := strconv.ParseUint(p, 10, 16)
+		if err != nil || n == 0 {
+			return 0, false
+		}
+		return uint16(n), true
+	}
+	n, err := strconv.Atoi(ans)
+	if err != nil || n < 1 || n > len(ports) {
+		return 0, false
+	}
+	return ports[n-1].Port, true
+}
+
+// runServeWizard is the entry point for the "tailscale serve wizard"
+// subcommand.
+func (e *serveEnv) runServeWizard(ctx context.Context, args []string) error {
+	if len(args) != 0 {
+		return flag.ErrHelp
+	}
+	r := bufio.NewReader(e.stdin())
+	out := e.stdout()
+
+	st, err := e.getLocalClientStatusWithoutPeers(ctx)
+	if err != nil {
+		return err
+	}
+	dnsName := strings.TrimSuffix(st.Self.DNSName, ".")
+
+	// Step 1: pick a local server.
+	ports, err := listeningPorts()
+	if err != nil {
+		fmt.Fprintf(out, "Could not list local servers: %v\n", err)
+	}
+	var defPort string
+	if len(ports) > 0 {
+		fmt.Fprintln(out, "Local servers listening on this machine:")
+		for i, p := range ports {
+			fmt.Fprintf(out, "  %2d) port %-5d %s\n", i+1, p.Port, p.Process)
+		}
+		defPort = "1"
+	}
+	var target uint16
+	for target == 0 {
+		ans, err := e.prompt(r, "Which local server do you want to share? (list number, or :port for any port)", defPort)
+		if err != nil {
+			return err
+		}
+		var ok bool
+		target, ok = parseWizardTarget(ans, ports)
+		if !ok {
+			fmt.Fprintf(out, "%q is not a list number or :port.\n", ans)
+		}
+	}
+
+	// Step 2: tailnet or Funnel.
+	var useFunnel bool
+	for {
+		ans, err := e.prompt(r, "Share within your tailnet only, or publish to the internet with Funnel? (tailnet/funnel)", "tailnet")
+		if err != nil {
+			return err
+		}
+		switch strings.ToLower(ans) {
+		case "tailnet", "t":
+		case "funnel", "f":
+			useFunnel = true
+		default:
+			fmt.Fprintf(out, "Please answer %q or %q.\n", "tailnet", "funnel")
+			continue
+		}
+		break
+	}
+	const srvPort = 443
+	if useFunnel {
+		if err := e.verifyFunnelEnabled(ctx, st, srvPort); err != nil {
+			return err
+		}
+	}
+
+	// Step 3: mount point.
+	var mount string
+	for mount == "" {
+		ans, err := e.prompt(r, "Mount path", "/")
+		if err != nil {
+			return err
+		}
+		mount, err = cleanURLPath(ans)
+		if err != nil {
+			fmt.Fprintln(out, err)
+		}
+	}
+
+	// Step 4: preview and apply.
+	cursc, err := e.lc.GetServeConfig(ctx)
+	if err != nil {
+		return err
+	}
+	sc := cursc.Clone()
+	if sc == nil {
+		sc = new(ipn.ServeConfig)
+	}
+	e.bg = true // wizard configs outlive the CLI
+	if err := e.validateConfig(sc, srvPort, serveTypeHTTPS); err != nil {
+		return err
+	}
+	if err := e.applyWebServe(sc, dnsName, srvPort, true, mount, strconv.Itoa(int(target))); err != nil {
+		return err
+	}
+	e.applyFunnel(sc, dnsName, srvPort, useFunnel)
+
+	j, err := json.MarshalIndent(sc, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "\nThe resulting serve config will be:\n%s\n\n", j)
+	ans, err := e.prompt(r, "Apply it? (y/n)", "n")
+	if err != nil {
+		return err
+	}
+	if ans != "y" && ans != "yes" {
+		fmt.Fprintln(out, "Not applied.")
+		return nil
+	}
+	if err := e.lc.SetServeConfig(ctx, sc); err != nil {
+		return err
+	}
+	fmt.Fprintln(out, e.messageForPort(sc, st, dnsName, srvPort))
+	return nil
+}
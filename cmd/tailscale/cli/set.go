@@ -9,14 +9,20 @@
 	"flag"
 	"fmt"
 	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/peterbourgon/ff/v3/ffcli"
 	"tailscale.com/clientupdate"
 	"tailscale.com/ipn"
+	"tailscale.com/ipn/ipnstate"
 	"tailscale.com/net/netutil"
 	"tailscale.com/net/tsaddr"
 	"tailscale.com/safesocket"
+	"tailscale.com/tailcfg"
 	"tailscale.com/types/views"
+	"tailscale.com/util/dnsname"
 )
 
 var setCmd = &ffcli.Command{
@@ -38,6 +44,9 @@ type setArgsT struct {
 	acceptDNS              bool
 	exitNodeIP             string
 	exitNodeAllowLANAccess bool
+	exitNodeFailover       string
+	rateLimit              string
+	dnsMode                string
 	shieldsUp              bool
 	runSSH                 bool
 	hostname               string
@@ -49,6 +58,12 @@ type setArgsT struct {
 	forceDaemon            bool
 	updateCheck            bool
 	updateApply            bool
+	taildropDir            string
+	taildropConflict       string
+	taildropMaxBytes       int64
+	derpHomeRegion         int
+	derpExcludeRegions     string
+	postureChecking        bool
 }
 
 func newSetFlagSet(goos string, setArgs *setArgsT) *flag.FlagSet {
@@ -59,17 +74,27 @@ func newSetFlagSet(goos string, setArgs *setArgsT) *flag.FlagSet {
 	setf.BoolVar(&setArgs.acceptDNS, "accept-dns", false, "accept DNS configuration from the admin panel")
 	setf.StringVar(&setArgs.exitNodeIP, "exit-node", "", "Tailscale exit node (IP or base name) for internet traffic, or empty string to not use an exit node")
 	setf.BoolVar(&setArgs.exitNodeAllowLANAccess, "exit-node-allow-lan-access", false, "Allow direct access to the local network when routing traffic via an exit node")
+	setf.StringVar(&setArgs.exitNodeFailover, "exit-node-failover", "", "ordered list of exit nodes (IPs or base names, comma-separated) to fail over between when the current one goes offline, or empty string to not fail over")
 	setf.BoolVar(&setArgs.shieldsUp, "shields-up", false, "don't allow incoming connections")
 	setf.BoolVar(&setArgs.runSSH, "ssh", false, "run an SSH server, permitting access per tailnet admin's declared policy")
 	setf.StringVar(&setArgs.hostname, "hostname", "", "hostname to use instead of the one provided by the OS")
 	setf.StringVar(&setArgs.advertiseRoutes, "advertise-routes", "", "routes to advertise to other nodes (comma-separated, e.g. \"10.0.0.0/8,192.168.0.0/24\") or empty string to not advertise routes")
 	setf.BoolVar(&setArgs.advertiseDefaultRoute, "advertise-exit-node", false, "offer to be an exit node for internet traffic for the tailnet")
+	setf.StringVar(&setArgs.rateLimit, "rate-limit", "", "bandwidth limits on traffic to and from peers or subnet routes (comma-separated PREFIX=RATE, e.g. \"100.101.102.103=10Mbps,10.0.0.0/8=1Gbps\"; append \"/addr\" to a rate to limit each address in the prefix separately) or empty string to not limit")
 	setf.BoolVar(&setArgs.updateCheck, "update-check", true, "HIDDEN: notify about available Tailscale updates")
 	setf.BoolVar(&setArgs.updateApply, "auto-update", false, "HIDDEN: automatically update to the latest available version")
+	setf.StringVar(&setArgs.taildropDir, "taildrop-dir", "", "absolute path of a directory to automatically move received Taildrop files into, or empty string to leave them in the inbox for \"tailscale file get\"")
+	setf.StringVar(&setArgs.taildropConflict, "taildrop-conflict", "", "what to do when a received Taildrop file already exists in --taildrop-dir (\"skip\", \"overwrite\" or \"rename\"); empty string means \"skip\"")
+	setf.IntVar(&setArgs.derpHomeRegion, "derp-home-region", 0, "ID of the DERP region to use as this node's home instead of the one with the lowest latency, or 0 to pick by latency")
+	setf.StringVar(&setArgs.derpExcludeRegions, "derp-exclude-regions", "", "IDs of DERP regions (comma-separated) never to use as this node's home, or empty string to allow all")
+	setf.BoolVar(&setArgs.postureChecking, "posture-checking", false, "collect device posture attributes (OS version, disk encryption, firewall and serial number) and send them to the control server for use in access rules")
+	setf.Int64Var(&setArgs.taildropMaxBytes, "taildrop-max-bytes", 0, "maximum total size in bytes of --taildrop-dir; files that would exceed it stay in the inbox (0 for no limit)")
 	if safesocket.GOOSUsesPeerCreds(goos) {
 		setf.StringVar(&setArgs.opUser, "operator", "", "Unix username to allow to operate on tailscaled without sudo")
 	}
 	switch goos {
+	case "linux":
+		setf.StringVar(&setArgs.dnsMode, "dns-mode", "", "DNS manager to use instead of detecting one (\"direct\", \"resolved\", \"nm\" or \"resolvconf\"), or empty string to detect one; takes effect when tailscaled restarts (Linux-only)")
 	case "windows":
 		setf.BoolVar(&setArgs.forceDaemon, "unattended", false, "run in \"Unattended Mode\" where Tailscale keeps running even after the current GUI user logs out (Windows-only)")
 	}
@@ -102,8 +127,11 @@ func runSet(ctx context.Context, args []string) (retErr error) {
 			ShieldsUp:              setArgs.shieldsUp,
 			RunSSH:                 setArgs.runSSH,
 			Hostname:               setArgs.hostname,
+			DNSMode:                setArgs.dnsMode,
+			DERPHomeRegion:         setArgs.derpHomeRegion,
 			OperatorUser:           setArgs.opUser,
 			ForceDaemon:            setArgs.forceDaemon,
+			PostureChecking:        setArgs.postureChecking,
 			AutoUpdate: ipn.AutoUpdatePrefs{
 				Check: setArgs.updateCheck,
 				Apply: setArgs.updateApply,
@@ -121,7 +149,29 @@ func runSet(ctx context.Context, args []string) (retErr error) {
 		}
 	}
 
+	if setArgs.exitNodeFailover != "" {
+		maskedPrefs.ExitNodeFailover, err = exitNodeFailoverOfArg(setArgs.exitNodeFailover, st)
+		if err != nil {
+			return err
+		}
+	}
+
+	if setArgs.derpExcludeRegions != "" {
+		maskedPrefs.DERPExcludeRegions, err = derpRegionsOfArg(setArgs.derpExcludeRegions)
+		if err != nil {
+			return err
+		}
+	}
+
+	if setArgs.rateLimit != "" {
+		maskedPrefs.RateLimits, err = rateLimitsOfArg(setArgs.rateLimit)
+		if err != nil {
+			return err
+		}
+	}
+
 	var advertiseExitNodeSet, advertiseRoutesSet bool
+	taildropFlagsSet := map[string]bool{}
 	setFlagSet.Visit(func(f *flag.Flag) {
 		updateMaskedPrefsFromUpOrSetFlag(maskedPrefs, f.Name)
 		switch f.Name {
@@ -129,6 +179,8 @@ func runSet(ctx context.Context, args []string) (retErr error) {
 			advertiseExitNodeSet = true
 		case "advertise-routes":
 			advertiseRoutesSet = true
+		case "taildrop-dir", "taildrop-conflict", "taildrop-max-bytes":
+			taildropFlagsSet[f.Name] = true
 		}
 	})
 	if maskedPrefs.IsEmpty() {
@@ -146,6 +198,10 @@ func runSet(ctx context.Context, args []string) (retErr error) {
 		}
 	}
 
+	if maskedPrefs.TaildropAutoAcceptSet {
+		maskedPrefs.TaildropAutoAccept = calcTaildropAutoAcceptForSet(curPrefs.TaildropAutoAccept, taildropFlagsSet, setArgs)
+	}
+
 	if maskedPrefs.RunSSHSet {
 		wantSSH, haveSSH := maskedPrefs.RunSSH, curPrefs.RunSSH
 		if err := presentSSHToggleRisk(wantSSH, haveSSH, setArgs.acceptedRisks); err != nil {
@@ -168,6 +224,126 @@ func runSet(ctx context.Context, args []string) (retErr error) {
 	return err
 }
 
+// derpRegionsOfArg returns the DERP region IDs in the comma-separated list s.
+func derpRegionsOfArg(s string) ([]int, error) {
+	var ret []int
+	for _, arg := range strings.Split(s, ",") {
+		arg = strings.TrimSpace(arg)
+		if arg == "" {
+			continue
+		}
+		id, err := strconv.Atoi(arg)
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("invalid DERP region ID %q", arg)
+		}
+		ret = append(ret, id)
+	}
+	return ret, nil
+}
+
+// exitNodeFailoverOfArg returns the stable node IDs of the comma-separated
+// exit nodes in s, given as Tailscale IPs or base names of peers in st.
+func exitNodeFailoverOfArg(s string, st *ipnstate.Status) ([]tailcfg.StableNodeID, error) {
+	var ret []tailcfg.StableNodeID
+	for _, arg := range strings.Split(s, ",") {
+		arg = strings.TrimSpace(arg)
+		if arg == "" {
+			continue
+		}
+		ip, ipErr := netip.ParseAddr(arg)
+		var found *ipnstate.PeerStatus
+		for _, ps := range st.Peer {
+			var match bool
+			if ipErr == nil {
+				match = slices.Contains(ps.TailscaleIPs, ip)
+			} else {
+				match = strings.EqualFold(arg, dnsname.TrimSuffix(ps.DNSName, st.MagicDNSSuffix))
+			}
+			if !match {
+				continue
+			}
+			if found != nil {
+				return nil, fmt.Errorf("ambiguous exit node name %q", arg)
+			}
+			found = ps
+		}
+		if found == nil {
+			return nil, fmt.Errorf("invalid value %q for --exit-node-failover; must be IP or unique node name", arg)
+		}
+		if !found.ExitNodeOption {
+			return nil, fmt.Errorf("node %q is not advertising an exit node", arg)
+		}
+		if slices.Contains(ret, found.ID) {
+			return nil, fmt.Errorf("exit node %q is listed more than once", arg)
+		}
+		ret = append(ret, found.ID)
+	}
+	return ret, nil
+}
+
+// rateUnits are the units of the rates accepted by --rate-limit, in bits per
+// second.
+var rateUnits = []struct {
+	suffix string
+	bits   float64
+}{
+	// Longest suffixes first, so "bps" doesn't match "Mbps".
+	{"Gbps", 1e9},
+	{"Mbps", 1e6},
+	{"Kbps", 1e3},
+	{"bps", 1},
+}
+
+// rateLimitsOfArg parses the value of --rate-limit: comma-separated
+// PREFIX=RATE, where PREFIX is an IP address or CIDR prefix and RATE is a
+// number of bits per second with a unit of bps, Kbps, Mbps or Gbps,
+// optionally followed by "/addr".
+func rateLimitsOfArg(s string) ([]ipn.RateLimit, error) {
+	var ret []ipn.RateLimit
+	for _, arg := range strings.Split(s, ",") {
+		arg = strings.TrimSpace(arg)
+		if arg == "" {
+			continue
+		}
+		prefixStr, rateStr, ok := strings.Cut(arg, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid rate limit %q; want PREFIX=RATE", arg)
+		}
+		var rl ipn.RateLimit
+		if strings.Contains(prefixStr, "/") {
+			p, err := netip.ParsePrefix(prefixStr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid rate limit %q: %w", arg, err)
+			}
+			if p != p.Masked() {
+				return nil, fmt.Errorf("invalid rate limit %q: %s has non-address bits set; expected %s", arg, p, p.Masked())
+			}
+			rl.Prefix = p
+		} else {
+			ip, err := netip.ParseAddr(prefixStr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid rate limit %q: %w", arg, err)
+			}
+			rl.Prefix = netip.PrefixFrom(ip, ip.BitLen())
+		}
+		rateStr, rl.PerAddr = strings.CutSuffix(rateStr, "/addr")
+		bits := -1.0
+		for _, u := range rateUnits {
+			if num, ok := strings.CutSuffix(rateStr, u.suffix); ok {
+				if f, err := strconv.ParseFloat(num, 64); err == nil {
+					bits = f * u.bits
+				}
+				break
+			}
+		}
+		if rl.BytesPerSecond = int64(bits / 8); rl.BytesPerSecond <= 0 {
+			return nil, fmt.Errorf("invalid rate %q in rate limit %q; want a positive rate like 10Mbps", rateStr, arg)
+		}
+		ret = append(ret, rl)
+	}
+	return ret, nil
+}
+
 // calcAdvertiseRoutesForSet returns the new value for Prefs.AdvertiseRoutes based on the
 // current value, the flags passed to "tailscale set".
 // advertiseExitNodeSet is whether the --advertise-exit-node flag was set.
@@ -197,3 +373,20 @@ func calcAdvertiseRoutesForSet(advertiseExitNodeSet, advertiseRoutesSet bool, cu
 	}
 	return nil, nil
 }
+
+// calcTaildropAutoAcceptForSet returns the Taildrop auto-accept prefs that
+// result from applying the --taildrop-* flags named in flagsSet on top of
+// cur. Fields whose flags weren't set keep their current values.
+func calcTaildropAutoAcceptForSet(cur ipn.TaildropAutoAcceptPrefs, flagsSet map[string]bool, setArgs setArgsT) ipn.TaildropAutoAcceptPrefs {
+	aa := cur
+	if flagsSet["taildrop-dir"] {
+		aa.Dir = setArgs.taildropDir
+	}
+	if flagsSet["taildrop-conflict"] {
+		aa.Conflict = setArgs.taildropConflict
+	}
+	if flagsSet["taildrop-max-bytes"] {
+		aa.MaxBytes = setArgs.taildropMaxBytes
+	}
+	return aa
+}
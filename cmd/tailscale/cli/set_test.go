@@ -129,3 +129,101 @@ func TestCalcAdvertiseRoutesForSet(t *testing.T) {
 		})
 	}
 }
+
+func TestCalcTaildropAutoAcceptForSet(t *testing.T) {
+	cur := ipn.TaildropAutoAcceptPrefs{Dir: "/srv/incoming", Conflict: "rename", MaxBytes: 1 << 30}
+	sa := setArgsT{taildropDir: "/tmp/drop", taildropConflict: "overwrite"}
+	tests := []struct {
+		name     string
+		flagsSet map[string]bool
+		want     ipn.TaildropAutoAcceptPrefs
+	}{
+		{
+			name: "none",
+			want: cur,
+		},
+		{
+			name:     "dir",
+			flagsSet: map[string]bool{"taildrop-dir": true},
+			want:     ipn.TaildropAutoAcceptPrefs{Dir: "/tmp/drop", Conflict: "rename", MaxBytes: 1 << 30},
+		},
+		{
+			name:     "conflict-and-clear-quota",
+			flagsSet: map[string]bool{"taildrop-conflict": true, "taildrop-max-bytes": true},
+			want:     ipn.TaildropAutoAcceptPrefs{Dir: "/srv/incoming", Conflict: "overwrite"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := calcTaildropAutoAcceptForSet(cur, tc.flagsSet, sa); got != tc.want {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDERPRegionsOfArg(t *testing.T) {
+	tests := []struct {
+		arg     string
+		want    []int
+		wantErr bool
+	}{
+		{arg: ""},
+		{arg: "1", want: []int{1}},
+		{arg: "1, 10,", want: []int{1, 10}},
+		{arg: "nyc", wantErr: true},
+		{arg: "0", wantErr: true},
+		{arg: "-3", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := derpRegionsOfArg(tt.arg)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("derpRegionsOfArg(%q) error = %v; wantErr %v", tt.arg, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("derpRegionsOfArg(%q) = %v; want %v", tt.arg, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimitsOfArg(t *testing.T) {
+	tests := []struct {
+		arg     string
+		want    []ipn.RateLimit
+		wantErr bool
+	}{
+		{arg: ""},
+		{
+			arg: "100.101.102.103=10Mbps",
+			want: []ipn.RateLimit{
+				{Prefix: netip.MustParsePrefix("100.101.102.103/32"), BytesPerSecond: 1_250_000},
+			},
+		},
+		{
+			arg: "100.64.0.0/10=1.5Mbps/addr, 10.0.0.0/8=1Gbps,fd7a:115c:a1e0::1=8000bps",
+			want: []ipn.RateLimit{
+				{Prefix: netip.MustParsePrefix("100.64.0.0/10"), BytesPerSecond: 187_500, PerAddr: true},
+				{Prefix: netip.MustParsePrefix("10.0.0.0/8"), BytesPerSecond: 125_000_000},
+				{Prefix: netip.MustParsePrefix("fd7a:115c:a1e0::1/128"), BytesPerSecond: 1000},
+			},
+		},
+		{arg: "100.101.102.103", wantErr: true},
+		{arg: "100.101.102.103=10", wantErr: true},
+		{arg: "100.101.102.103=0Mbps", wantErr: true},
+		{arg: "100.101.102.103=-1Mbps", wantErr: true},
+		{arg: "100.101.102.103=tenMbps", wantErr: true},
+		{arg: "10.0.0.1/8=1Mbps", wantErr: true},
+		{arg: "foo=1Mbps", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := rateLimitsOfArg(tt.arg)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("rateLimitsOfArg(%q) error = %v, wantErr %v", tt.arg, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("rateLimitsOfArg(%q) = %v, want %v", tt.arg, got, tt.want)
+		}
+	}
+}
@@ -5,6 +5,7 @@
 
 import (
 	"bytes"
+	"cmp"
 	"context"
 	"encoding/json"
 	"errors"
@@ -14,8 +15,10 @@
 	"net/http"
 	"net/netip"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
+	"text/tabwriter"
 
 	"github.com/peterbourgon/ff/v3/ffcli"
 	"github.com/toqueteos/webbrowser"
@@ -23,13 +26,14 @@
 	"tailscale.com/ipn"
 	"tailscale.com/ipn/ipnstate"
 	"tailscale.com/net/interfaces"
+	"tailscale.com/types/views"
 	"tailscale.com/util/cmpx"
 	"tailscale.com/util/dnsname"
 )
 
 var statusCmd = &ffcli.Command{
 	Name:       "status",
-	ShortUsage: "status [--active] [--web] [--json]",
+	ShortUsage: "status [--active] [--online-only] [--filter=tag:prod] [--sort=name] [--web] [--json]",
 	ShortHelp:  "Show state of tailscaled and its connections",
 	LongHelp: strings.TrimSpace(`
 
@@ -56,6 +60,10 @@
 		fs.BoolVar(&statusArgs.peers, "peers", true, "show status of peers")
 		fs.StringVar(&statusArgs.listen, "listen", "127.0.0.1:8384", "listen address for web mode; use port 0 for automatic")
 		fs.BoolVar(&statusArgs.browser, "browser", true, "Open a browser in web mode")
+		fs.BoolVar(&statusArgs.onlineOnly, "online-only", false, "filter output to only peers that are online (not applicable to web mode)")
+		fs.StringVar(&statusArgs.filter, "filter", "", `filter output to only peers with the given ACL tag (e.g. "tag:prod"), or whose name contains the given string (not applicable to web mode)`)
+		fs.StringVar(&statusArgs.sort, "sort", "", `sort peers by "name", "ip" or "last-seen" (most recent first); ignored in JSON and web mode`)
+		fs.BoolVar(&statusArgs.health, "health", false, "show only the health problems of the local machine, most severe first (not applicable to web mode)")
 		return fs
 	})(),
 }
@@ -68,12 +76,25 @@
 	active  bool   // in CLI mode, filter output to only peers with active sessions
 	self    bool   // in CLI mode, show status of local machine
 	peers   bool   // in CLI mode, show status of peer machines
+
+	onlineOnly bool   // filter output to only online peers
+	filter     string // filter output to peers with this tag, or whose name contains it
+	sort       string // in CLI mode, peer sort order; empty means by DNS name
+	health     bool   // show only health warnings
 }
 
 func runStatus(ctx context.Context, args []string) error {
 	if len(args) > 0 {
 		return errors.New("unexpected non-flag arguments to 'tailscale status'")
 	}
+	switch statusArgs.sort {
+	case "", "name", "ip", "last-seen":
+	default:
+		return fmt.Errorf("invalid --sort %q; want name, ip or last-seen", statusArgs.sort)
+	}
+	if statusArgs.health {
+		return runStatusHealth(ctx)
+	}
 	getStatus := localClient.Status
 	if !statusArgs.peers {
 		getStatus = localClient.StatusWithoutPeers
@@ -83,11 +104,9 @@ func runStatus(ctx context.Context, args []string) error {
 		return fixTailscaledConnectError(err)
 	}
 	if statusArgs.json {
-		if statusArgs.active {
-			for peer, ps := range st.Peer {
-				if !ps.Active {
-					delete(st.Peer, peer)
-				}
+		for peer, ps := range st.Peer {
+			if !statusPeerMatches(ps) {
+				delete(st.Peer, peer)
 			}
 		}
 		j, err := json.MarshalIndent(st, "", "  ")
@@ -218,9 +237,9 @@ func runStatus(ctx context.Context, args []string) error {
 			}
 			peers = append(peers, ps)
 		}
-		ipnstate.SortPeers(peers)
+		sortStatusPeers(peers, statusArgs.sort)
 		for _, ps := range peers {
-			if statusArgs.active && !ps.Active {
+			if !statusPeerMatches(ps) {
 				continue
 			}
 			printPS(ps)
@@ -242,6 +261,79 @@ func runStatus(ctx context.Context, args []string) error {
 	return nil
 }
 
+// runStatusHealth prints the local machine's health warnings, for
+// "tailscale status --health".
+func runStatusHealth(ctx context.Context) error {
+	ws, err := localClient.Health(ctx)
+	if err != nil {
+		return fixTailscaledConnectError(err)
+	}
+	if statusArgs.json {
+		j, err := json.MarshalIndent(ws, "", "  ")
+		if err != nil {
+			return err
+		}
+		printf("%s\n", j)
+		return nil
+	}
+	if len(ws) == 0 {
+		outln("# Health check: no problems")
+		return nil
+	}
+	w := tabwriter.NewWriter(Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "SEVERITY\tNAME\tPROBLEM\n")
+	for _, h := range ws {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", h.Severity, h.Name, h.Text)
+	}
+	return w.Flush()
+}
+
+// statusPeerMatches reports whether ps passes the --active, --online-only
+// and --filter flags. It's used for both the JSON and the text output.
+func statusPeerMatches(ps *ipnstate.PeerStatus) bool {
+	if statusArgs.active && !ps.Active {
+		return false
+	}
+	if statusArgs.onlineOnly && !ps.Online {
+		return false
+	}
+	if f := statusArgs.filter; f != "" {
+		if strings.HasPrefix(f, "tag:") {
+			return ps.Tags != nil && views.SliceContains(*ps.Tags, f)
+		}
+		f = strings.ToLower(f)
+		return strings.Contains(strings.ToLower(ps.HostName), f) ||
+			strings.Contains(strings.ToLower(ps.DNSName), f)
+	}
+	return true
+}
+
+// sortStatusPeers sorts peers by the --sort order: "name" (the default),
+// "ip", or "last-seen", which puts online peers first and then the most
+// recently seen ones.
+func sortStatusPeers(peers []*ipnstate.PeerStatus, order string) {
+	ipnstate.SortPeers(peers)
+	switch order {
+	case "ip":
+		slices.SortStableFunc(peers, func(a, b *ipnstate.PeerStatus) int {
+			if len(a.TailscaleIPs) == 0 || len(b.TailscaleIPs) == 0 {
+				return cmp.Compare(len(b.TailscaleIPs), len(a.TailscaleIPs))
+			}
+			return a.TailscaleIPs[0].Compare(b.TailscaleIPs[0])
+		})
+	case "last-seen":
+		slices.SortStableFunc(peers, func(a, b *ipnstate.PeerStatus) int {
+			if a.Online != b.Online {
+				if a.Online {
+					return -1
+				}
+				return 1
+			}
+			return b.LastSeen.Compare(a.LastSeen)
+		})
+	}
+}
+
 // printFunnelStatus prints the status of the funnel, if it's running.
 // It prints nothing if the funnel is not running.
 func printFunnelStatus(ctx context.Context) {
@@ -0,0 +1,72 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+
+	"tailscale.com/ipn/ipnstate"
+	"tailscale.com/types/views"
+)
+
+func TestStatusPeerFilterAndSort(t *testing.T) {
+	tags := func(tt ...string) *views.Slice[string] {
+		v := views.SliceOf(tt)
+		return &v
+	}
+	now := time.Now()
+	peers := []*ipnstate.PeerStatus{
+		{HostName: "web", DNSName: "web.example.ts.net.", Online: true, Active: true, Tags: tags("tag:prod"),
+			TailscaleIPs: []netip.Addr{netip.MustParseAddr("100.64.0.3")}},
+		{HostName: "db", DNSName: "db.example.ts.net.", LastSeen: now.Add(-time.Hour), Tags: tags("tag:prod", "tag:db"),
+			TailscaleIPs: []netip.Addr{netip.MustParseAddr("100.64.0.1")}},
+		{HostName: "laptop", DNSName: "laptop.example.ts.net.", LastSeen: now.Add(-time.Minute),
+			TailscaleIPs: []netip.Addr{netip.MustParseAddr("100.64.0.2")}},
+	}
+	names := func(sortOrder string) []string {
+		ps := append([]*ipnstate.PeerStatus(nil), peers...)
+		sortStatusPeers(ps, sortOrder)
+		var ret []string
+		for _, p := range ps {
+			if statusPeerMatches(p) {
+				ret = append(ret, p.HostName)
+			}
+		}
+		return ret
+	}
+
+	old := statusArgs
+	t.Cleanup(func() { statusArgs = old })
+	tests := []struct {
+		name       string
+		active     bool
+		onlineOnly bool
+		filter     string
+		sort       string
+		want       []string
+	}{
+		{name: "default", want: []string{"db", "laptop", "web"}},
+		{name: "sort-ip", sort: "ip", want: []string{"db", "laptop", "web"}},
+		{name: "sort-last-seen", sort: "last-seen", want: []string{"web", "laptop", "db"}},
+		{name: "filter-tag", filter: "tag:prod", want: []string{"db", "web"}},
+		{name: "filter-other-tag", filter: "tag:db", want: []string{"db"}},
+		{name: "filter-name", filter: "LAP", want: []string{"laptop"}},
+		{name: "online-only", onlineOnly: true, want: []string{"web"}},
+		{name: "active", active: true, want: []string{"web"}},
+		{name: "combined", filter: "tag:prod", onlineOnly: true, want: []string{"web"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statusArgs.active = tt.active
+			statusArgs.onlineOnly = tt.onlineOnly
+			statusArgs.filter = tt.filter
+			if got := names(tt.sort); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
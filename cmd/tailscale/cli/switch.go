@@ -5,9 +5,12 @@
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/peterbourgon/ff/v3/ffcli"
@@ -20,21 +23,51 @@
 	FlagSet: func() *flag.FlagSet {
 		fs := flag.NewFlagSet("switch", flag.ExitOnError)
 		fs.BoolVar(&switchArgs.list, "list", false, "list available accounts")
+		fs.BoolVar(&switchArgs.json, "json", false, "with --list, output in JSON format")
 		return fs
 	}(),
 	Exec: switchProfile,
 	UsageFunc: func(*ffcli.Command) string {
 		return `USAGE
-  switch <name>
-  switch --list
+  switch <account>
+  switch --list [--json]
 
 "tailscale switch" switches between logged in accounts.
-This command is currently in alpha and may change in the future.`
+This command is currently in alpha and may change in the future.
+
+The account is matched against the ID, name, login name and tailnet of
+each account: first exactly, then ignoring case, then as a substring.
+
+Exit status:
+  0  switched to the account, or it was already current
+  1  an error occurred
+  2  no account matches
+  3  more than one account matches; they are listed`
 	},
 }
 
 var switchArgs struct {
 	list bool
+	json bool
+}
+
+// Exit codes of "tailscale switch", for scripts that build account pickers.
+const (
+	switchExitError     = 1
+	switchExitNoMatch   = 2
+	switchExitAmbiguous = 3
+)
+
+// switchProfileJSON is an account in the output of
+// "tailscale switch --list --json".
+type switchProfileJSON struct {
+	ID         ipn.ProfileID
+	Name       string
+	LoginName  string
+	Tailnet    string     `json:",omitempty"` // MagicDNS suffix, if known
+	ControlURL string     `json:",omitempty"`
+	Current    bool       // whether it's the current account
+	LastUsed   *time.Time `json:",omitempty"` // or nil if unknown
 }
 
 func listProfiles(ctx context.Context) error {
@@ -42,6 +75,29 @@ func listProfiles(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
+	if switchArgs.json {
+		out := make([]switchProfileJSON, 0, len(all))
+		for _, prof := range all {
+			p := switchProfileJSON{
+				ID:         prof.ID,
+				Name:       prof.Name,
+				LoginName:  prof.UserProfile.LoginName,
+				Tailnet:    prof.TailnetMagicDNSName,
+				ControlURL: prof.ControlURL,
+				Current:    prof.ID == curP.ID,
+			}
+			if !prof.LastUsed.IsZero() {
+				p.LastUsed = &prof.LastUsed
+			}
+			out = append(out, p)
+		}
+		j, err := json.MarshalIndent(out, "", "  ")
+		if err != nil {
+			return err
+		}
+		printf("%s\n", j)
+		return nil
+	}
 	for _, prof := range all {
 		if prof.ID == curP.ID {
 			fmt.Printf("%s *\n", prof.Name)
@@ -52,50 +108,94 @@ func listProfiles(ctx context.Context) error {
 	return nil
 }
 
+// matchProfiles returns the profiles in all that match q: the one with the
+// ID or name q, or else those that have q as their name, login name or
+// tailnet ignoring case, or else those that have it as a substring of one
+// of them, ignoring case.
+func matchProfiles(all []ipn.LoginProfile, q string) []ipn.LoginProfile {
+	for _, p := range all {
+		if string(p.ID) == q || p.Name == q {
+			return []ipn.LoginProfile{p}
+		}
+	}
+	fields := func(p ipn.LoginProfile) []string {
+		return []string{p.Name, p.UserProfile.LoginName, p.TailnetMagicDNSName}
+	}
+	var equal, sub []ipn.LoginProfile
+	lq := strings.ToLower(q)
+	for _, p := range all {
+		isEqual, isSub := false, false
+		for _, f := range fields(p) {
+			if f == "" {
+				continue
+			}
+			lf := strings.ToLower(f)
+			isEqual = isEqual || lf == lq
+			isSub = isSub || strings.Contains(lf, lq)
+		}
+		if isEqual {
+			equal = append(equal, p)
+		}
+		if isSub {
+			sub = append(sub, p)
+		}
+	}
+	if len(equal) > 0 {
+		return equal
+	}
+	return sub
+}
+
 func switchProfile(ctx context.Context, args []string) error {
+	if switchArgs.json && !switchArgs.list {
+		return errors.New("--json requires --list")
+	}
 	if switchArgs.list {
 		return listProfiles(ctx)
 	}
 	if len(args) != 1 {
 		outln("usage: tailscale switch NAME")
-		os.Exit(1)
+		os.Exit(switchExitError)
 	}
 	cp, all, err := localClient.ProfileStatus(ctx)
 	if err != nil {
 		errf("Failed to switch to account: %v\n", err)
-		os.Exit(1)
+		os.Exit(switchExitError)
 	}
-	var profID ipn.ProfileID
-	for _, p := range all {
-		if p.Name == args[0] {
-			profID = p.ID
-			break
+	matches := matchProfiles(all, args[0])
+	switch len(matches) {
+	case 0:
+		errf("No account matches %q\n", args[0])
+		os.Exit(switchExitNoMatch)
+	case 1:
+	default:
+		errf("More than one account matches %q:\n", args[0])
+		for _, p := range matches {
+			errf("  %s (%s)\n", p.Name, p.ID)
 		}
+		os.Exit(switchExitAmbiguous)
 	}
-	if profID == "" {
-		errf("No profile named %q\n", args[0])
-		os.Exit(1)
-	}
-	if profID == cp.ID {
-		printf("Already on account %q\n", args[0])
+	prof := matches[0]
+	if prof.ID == cp.ID {
+		printf("Already on account %q\n", prof.Name)
 		os.Exit(0)
 	}
-	if err := localClient.SwitchProfile(ctx, profID); err != nil {
+	if err := localClient.SwitchProfile(ctx, prof.ID); err != nil {
 		errf("Failed to switch to account: %v\n", err)
-		os.Exit(1)
+		os.Exit(switchExitError)
 	}
-	printf("Switching to account %q\n", args[0])
+	printf("Switching to account %q\n", prof.Name)
 	for {
 		select {
 		case <-ctx.Done():
 			errf("Timed out waiting for switch to complete.")
-			os.Exit(1)
+			os.Exit(switchExitError)
 		default:
 		}
 		st, err := localClient.StatusWithoutPeers(ctx)
 		if err != nil {
 			errf("Error getting status: %v", err)
-			os.Exit(1)
+			os.Exit(switchExitError)
 		}
 		switch st.BackendState {
 		case "NoState", "Starting":
@@ -115,7 +215,7 @@ func switchProfile(ctx context.Context, args []string) error {
 		// For all other states, use the default error message.
 		if msg, ok := isRunningOrStarting(st); !ok {
 			outln(msg)
-			os.Exit(1)
+			os.Exit(switchExitError)
 		}
 	}
 }
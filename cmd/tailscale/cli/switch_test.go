@@ -0,0 +1,52 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"slices"
+	"testing"
+
+	"tailscale.com/ipn"
+	"tailscale.com/tailcfg"
+)
+
+func TestMatchProfiles(t *testing.T) {
+	prof := func(id, name, tailnet string) ipn.LoginProfile {
+		return ipn.LoginProfile{
+			ID:                  ipn.ProfileID(id),
+			Name:                name,
+			TailnetMagicDNSName: tailnet,
+			UserProfile:         tailcfg.UserProfile{LoginName: name},
+		}
+	}
+	all := []ipn.LoginProfile{
+		prof("a1", "alice@example.com", "tail1234.ts.net"),
+		prof("b2", "alice@work.example", "work.ts.net"),
+		prof("c3", "Work", "tail5678.ts.net"),
+	}
+
+	tests := []struct {
+		q    string
+		want []ipn.ProfileID
+	}{
+		{"b2", []ipn.ProfileID{"b2"}},
+		{"alice@example.com", []ipn.ProfileID{"a1"}},
+		{"Work", []ipn.ProfileID{"c3"}},               // exact name beats substrings
+		{"work", []ipn.ProfileID{"c3"}},               // case-insensitive name beats substrings
+		{"work.ts.net", []ipn.ProfileID{"b2"}},        // tailnet
+		{"TAIL1234", []ipn.ProfileID{"a1"}},           // tailnet substring
+		{"alice", []ipn.ProfileID{"a1", "b2"}},        // ambiguous
+		{"ts.net", []ipn.ProfileID{"a1", "b2", "c3"}}, // ambiguous
+		{"bob", nil},
+	}
+	for _, tt := range tests {
+		var got []ipn.ProfileID
+		for _, p := range matchProfiles(all, tt.q) {
+			got = append(got, p.ID)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("matchProfiles(%q) = %q; want %q", tt.q, got, tt.want)
+		}
+	}
+}
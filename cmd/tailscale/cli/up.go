@@ -17,6 +17,7 @@
 	"os/signal"
 	"reflect"
 	"runtime"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -61,6 +62,10 @@
 is also used. (The flags --auth-key, --force-reauth, and --qr are not
 considered settings that need to be re-specified when modifying
 settings.)
+
+To see which settings a "tailscale up" command would change, including
+those it would reset to their defaults, add --dry-run. Nothing is
+changed.
 `),
 	FlagSet: upFlagSet,
 	Exec: func(ctx context.Context, args []string) error {
@@ -135,6 +140,7 @@ func newUpFlagSet(goos string, upArgs *upArgsT, cmd string) *flag.FlagSet {
 		upf.BoolVar(&upArgs.json, "json", false, "output in JSON format (WARNING: format subject to change)")
 		upf.BoolVar(&upArgs.reset, "reset", false, "reset unspecified settings to their default values")
 		upf.BoolVar(&upArgs.forceReauth, "force-reauth", false, "force reauthentication")
+		upf.BoolVar(&upArgs.dryRun, "dry-run", false, "print the settings that would change, including those reset to their defaults, without changing them")
 		registerAcceptRiskFlag(upf, &upArgs.acceptedRisks)
 	}
 
@@ -173,6 +179,7 @@ type upArgsT struct {
 	timeout                time.Duration
 	acceptedRisks          string
 	profileName            string
+	dryRun                 bool
 }
 
 func (a upArgsT) getAuthKey() (string, error) {
@@ -382,6 +389,157 @@ func presentSSHToggleRisk(wantSSH, haveSSH bool, acceptedRisks string) error {
 	return presentRiskToUser(riskLoseSSH, `You are connected using Tailscale SSH; this action will result in your session disconnecting.`, acceptedRisks)
 }
 
+// upDryRun is what 'tailscale up --dry-run' reports.
+type upDryRun struct {
+	// Changes are the settings that would change, sorted by flag name.
+	Changes []upPrefChange `json:",omitempty"`
+
+	// Checks describe what the changes are subject to beyond this
+	// node, such as the tailnet policy file or admin approval.
+	Checks []string `json:",omitempty"`
+
+	// Error, if non-empty, is why 'tailscale up' would fail as run.
+	Error string `json:",omitempty"`
+}
+
+// upPrefChange is a setting that 'tailscale up' would change.
+type upPrefChange struct {
+	Flag     string
+	Current  any
+	Proposed any
+
+	// Implicit is whether the flag wasn't given, so the setting would be
+	// reset to the flag's default value.
+	Implicit bool `json:",omitempty"`
+}
+
+// computeUpDryRun returns what running 'tailscale up' with the
+// flag-provided prefs would change from curPrefs, without changing
+// anything. Like updatePrefs, it may mutate prefs to add implicit
+// preferences.
+func computeUpDryRun(prefs, curPrefs *ipn.Prefs, env upCheckEnv) *upDryRun {
+	d := new(upDryRun)
+	if env.flagSet.NFlag() == 1 && // just --dry-run, the same as a simpleUp
+		curPrefs.Persist != nil &&
+		curPrefs.Persist.UserProfile.LoginName != "" &&
+		env.backendState != ipn.NeedsLogin.String() {
+		// A bare "tailscale up" only brings the network up.
+		return d
+	}
+	if !env.upArgs.reset {
+		applyImplicitPrefs(prefs, curPrefs, env)
+		if err := checkForAccidentalSettingReverts(prefs, curPrefs, env); err != nil {
+			d.Error = err.Error()
+		}
+	}
+
+	flagIsSet := map[string]bool{}
+	env.flagSet.Visit(func(f *flag.Flag) {
+		flagIsSet[f.Name] = true
+	})
+	flagsCur := prefsToFlags(env, curPrefs)
+	flagsNew := prefsToFlags(env, prefs)
+	var names []string
+	for flagName := range flagsCur {
+		names = append(names, flagName)
+	}
+	sort.Strings(names)
+	for _, flagName := range names {
+		valCur, valNew := flagsCur[flagName], flagsNew[flagName]
+		if reflect.DeepEqual(valCur, valNew) {
+			continue
+		}
+		if flagName == "login-server" && ipn.IsLoginServerSynonym(valCur) && ipn.IsLoginServerSynonym(valNew) {
+			continue
+		}
+		d.Changes = append(d.Changes, upPrefChange{
+			Flag:     flagName,
+			Current:  valCur,
+			Proposed: valNew,
+			Implicit: !flagIsSet[flagName],
+		})
+	}
+
+	controlURLChanged := curPrefs.ControlURL != prefs.ControlURL &&
+		!(ipn.IsLoginServerSynonym(curPrefs.ControlURL) && ipn.IsLoginServerSynonym(prefs.ControlURL))
+	if controlURLChanged {
+		if env.backendState == ipn.Running.String() && !env.upArgs.forceReauth && d.Error == "" {
+			d.Error = "can't change --login-server without --force-reauth"
+		}
+		d.Checks = append(d.Checks, "changing --login-server requires logging in to "+prefs.ControlURL)
+	} else if env.upArgs.forceReauth {
+		d.Checks = append(d.Checks, "--force-reauth requires logging in again")
+	}
+	if !reflect.DeepEqual(curPrefs.AdvertiseTags, prefs.AdvertiseTags) {
+		if len(prefs.AdvertiseTags) > 0 {
+			d.Checks = append(d.Checks, fmt.Sprintf("the tagOwners in the tailnet policy file must permit you to apply %s", strings.Join(prefs.AdvertiseTags, ",")))
+		}
+		d.Checks = append(d.Checks, "changing --advertise-tags requires logging in again")
+	}
+	var newRoutes []string
+	for _, r := range withoutExitNodes(prefs.AdvertiseRoutes) {
+		if !slices.Contains(curPrefs.AdvertiseRoutes, r) {
+			newRoutes = append(newRoutes, r.String())
+		}
+	}
+	if len(newRoutes) > 0 {
+		d.Checks = append(d.Checks, fmt.Sprintf("routes %s must be approved in the admin console, unless autoApprovers in the tailnet policy file cover them", strings.Join(newRoutes, ",")))
+	}
+	if hasExitNodeRoutes(prefs.AdvertiseRoutes) && !hasExitNodeRoutes(curPrefs.AdvertiseRoutes) {
+		d.Checks = append(d.Checks, "being an exit node must be approved in the admin console, unless autoApprovers in the tailnet policy file cover it")
+	}
+	if (prefs.ExitNodeIP.IsValid() || !prefs.ExitNodeID.IsZero()) &&
+		(prefs.ExitNodeIP != curPrefs.ExitNodeIP || prefs.ExitNodeID != curPrefs.ExitNodeID) {
+		d.Checks = append(d.Checks, "using an exit node requires the tailnet policy file to permit access to autogroup:internet")
+	}
+	if prefs.RunSSH && !curPrefs.RunSSH {
+		d.Checks = append(d.Checks, "Tailscale SSH connections to this node are permitted only by the ssh rules in the tailnet policy file")
+	}
+	if prefs.RunSSH != curPrefs.RunSSH && isSSHOverTailscale() {
+		d.Checks = append(d.Checks, "changing --ssh will disconnect your current SSH session")
+	}
+	return d
+}
+
+// printUpDryRun prints d for 'tailscale up --dry-run'. The Error is left to
+// the caller.
+func printUpDryRun(d *upDryRun, asJSON bool) {
+	if asJSON {
+		j, err := json.MarshalIndent(d, "", "\t")
+		if err != nil {
+			log.Fatalf("JSON marshalling error: %v", err)
+		}
+		outln(string(j))
+		return
+	}
+	if len(d.Changes) == 0 {
+		outln("No settings would change.")
+	} else {
+		outln("Settings that would change:")
+		for _, c := range d.Changes {
+			printf("\t--%s: %s -> %s", c.Flag, fmtDryRunValue(c.Current), fmtDryRunValue(c.Proposed))
+			if c.Implicit {
+				printf(" (not mentioned; reset to default)")
+			}
+			outln()
+		}
+	}
+	if len(d.Checks) > 0 {
+		outln()
+		outln("Subject to:")
+		for _, c := range d.Checks {
+			printf("\t- %s\n", c)
+		}
+	}
+}
+
+func fmtDryRunValue(v any) string {
+	if s, ok := v.(string); ok {
+		return strconv.Quote(s)
+	}
+	return fmt.Sprint(v)
+}
+
 func runUp(ctx context.Context, cmd string, args []string, upArgs upArgsT) (retErr error) {
 	var egg bool
 	if len(args) > 0 {
@@ -457,6 +615,20 @@ func runUp(ctx context.Context, cmd string, args []string, upArgs upArgsT) (retE
 		curExitNodeIP: exitNodeIP(curPrefs, st),
 	}
 
+	if upArgs.dryRun {
+		d := computeUpDryRun(prefs, curPrefs, env)
+		if d.Error == "" && len(d.Changes) > 0 {
+			if err := localClient.CheckPrefs(ctx, prefs); err != nil {
+				d.Error = err.Error()
+			}
+		}
+		printUpDryRun(d, upArgs.json)
+		if d.Error != "" {
+			fatalf("%s", d.Error)
+		}
+		return nil
+	}
+
 	defer func() {
 		if retErr == nil {
 			checkUpWarnings(ctx)
@@ -710,12 +882,21 @@ func init() {
 	addPrefFlagMapping("shields-up", "ShieldsUp")
 	addPrefFlagMapping("snat-subnet-routes", "NoSNAT")
 	addPrefFlagMapping("exit-node-allow-lan-access", "ExitNodeAllowLANAccess")
+	addPrefFlagMapping("exit-node-failover", "ExitNodeFailover")
+	addPrefFlagMapping("rate-limit", "RateLimits")
+	addPrefFlagMapping("dns-mode", "DNSMode")
+	addPrefFlagMapping("derp-home-region", "DERPHomeRegion")
+	addPrefFlagMapping("derp-exclude-regions", "DERPExcludeRegions")
+	addPrefFlagMapping("posture-checking", "PostureChecking")
 	addPrefFlagMapping("unattended", "ForceDaemon")
 	addPrefFlagMapping("operator", "OperatorUser")
 	addPrefFlagMapping("ssh", "RunSSH")
 	addPrefFlagMapping("nickname", "ProfileName")
 	addPrefFlagMapping("update-check", "AutoUpdate")
 	addPrefFlagMapping("auto-update", "AutoUpdate")
+	addPrefFlagMapping("taildrop-dir", "TaildropAutoAccept")
+	addPrefFlagMapping("taildrop-conflict", "TaildropAutoAccept")
+	addPrefFlagMapping("taildrop-max-bytes", "TaildropAutoAccept")
 }
 
 func addPrefFlagMapping(flagName string, prefNames ...string) {
@@ -733,7 +914,7 @@ func addPrefFlagMapping(flagName string, prefNames ...string) {
 // correspond to an ipn.Pref.
 func preflessFlag(flagName string) bool {
 	switch flagName {
-	case "auth-key", "force-reauth", "reset", "qr", "json", "timeout", "accept-risk":
+	case "auth-key", "force-reauth", "reset", "qr", "json", "timeout", "accept-risk", "dry-run":
 		return true
 	}
 	return false
@@ -792,7 +973,9 @@ func checkForAccidentalSettingReverts(newPrefs, curPrefs *ipn.Prefs, env upCheck
 
 	flagIsSet := map[string]bool{}
 	env.flagSet.Visit(func(f *flag.Flag) {
-		flagIsSet[f.Name] = true
+		if f.Name != "dry-run" {
+			flagIsSet[f.Name] = true
+		}
 	})
 
 	if len(flagIsSet) == 0 {
@@ -837,6 +1020,9 @@ func checkForAccidentalSettingReverts(newPrefs, curPrefs *ipn.Prefs, env upCheck
 	// to prepend to the command to run.
 	var explicit []string
 	env.flagSet.Visit(func(f *flag.Flag) {
+		if f.Name == "dry-run" {
+			return
+		}
 		type isBool interface {
 			IsBoolFlag() bool
 		}
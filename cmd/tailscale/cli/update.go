@@ -27,18 +27,45 @@
 		fs.BoolVar(&updateArgs.yes, "yes", false, "update without interactive prompts")
 		fs.BoolVar(&updateArgs.dryRun, "dry-run", false, "print what update would do without doing it, or prompts")
 		fs.BoolVar(&updateArgs.appStore, "app-store", false, "HIDDEN: check the App Store for updates, even if this is not an App Store install (for testing only)")
-		// These flags are not supported on several systems that only provide
-		// the latest version of Tailscale:
-		//
-		//  - Arch (and other pacman-based distros)
-		//  - Alpine (and other apk-based distros)
-		//  - FreeBSD (and other pkg-based distros)
-		if distro.Get() != distro.Arch && distro.Get() != distro.Alpine && runtime.GOOS != "freebsd" {
+		// These flags are not supported on systems that only provide the
+		// latest version of Tailscale.
+		if canUpdateToVersion() {
 			fs.StringVar(&updateArgs.track, "track", "", `which track to check for updates: "stable" or "unstable" (dev); empty means same as current`)
 			fs.StringVar(&updateArgs.version, "version", "", `explicit version to update/downgrade to`)
 		}
 		return fs
 	})(),
+	Subcommands: []*ffcli.Command{
+		{
+			Name:       "rollback",
+			ShortUsage: "update rollback",
+			ShortHelp:  "Reinstall the version of Tailscale that ran before the last update",
+			LongHelp: strings.TrimSpace(`
+The 'tailscale update rollback' command reinstalls the version of Tailscale
+that tailscaled ran before the current one.
+
+After an auto-update, tailscaled rolls back by itself if it doesn't connect
+to the tailnet within 10 minutes, by default.
+`),
+			Exec: runUpdateRollback,
+			FlagSet: (func() *flag.FlagSet {
+				fs := newFlagSet("rollback")
+				fs.BoolVar(&updateArgs.yes, "yes", false, "roll back without interactive prompts")
+				fs.BoolVar(&updateArgs.dryRun, "dry-run", false, "print what rollback would do without doing it, or prompts")
+				return fs
+			})(),
+		},
+	},
+}
+
+// canUpdateToVersion reports whether the update command can install a
+// specific version of Tailscale. Several systems only provide the latest:
+//
+//   - Arch (and other pacman-based distros)
+//   - Alpine (and other apk-based distros)
+//   - FreeBSD (and other pkg-based distros)
+func canUpdateToVersion() bool {
+	return distro.Get() != distro.Arch && distro.Get() != distro.Alpine && runtime.GOOS != "freebsd"
 }
 
 var updateArgs struct {
@@ -72,6 +99,31 @@ func runUpdate(ctx context.Context, args []string) error {
 	return err
 }
 
+func runUpdateRollback(ctx context.Context, args []string) error {
+	if len(args) > 0 {
+		return flag.ErrHelp
+	}
+	if !canUpdateToVersion() {
+		return errors.New("The 'update rollback' command is not supported on this platform, which only provides the latest version of Tailscale")
+	}
+	st, err := localClient.UpdateState(ctx)
+	if err != nil {
+		return err
+	}
+	if st.PreviousVersion == "" {
+		return errors.New("no previous version of Tailscale is known to roll back to")
+	}
+	err = clientupdate.Update(clientupdate.Arguments{
+		Version: st.PreviousVersion,
+		Logf:    func(format string, args ...any) { fmt.Printf(format+"\n", args...) },
+		Confirm: confirmUpdate,
+	})
+	if errors.Is(err, errors.ErrUnsupported) {
+		return errors.New("The 'update rollback' command is not supported on this platform; see https://tailscale.com/s/client-updates")
+	}
+	return err
+}
+
 func confirmUpdate(ver string) bool {
 	if updateArgs.yes {
 		fmt.Printf("Updating Tailscale from %v to %v; --yes given, continuing without prompts.\n", version.Short(), ver)
@@ -0,0 +1,113 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/netip"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+	"tailscale.com/client/tailscale/apitype"
+)
+
+var whoisCmd = &ffcli.Command{
+	Name:       "whois",
+	ShortUsage: "whois [--json] ip[:port]",
+	ShortHelp:  "Show the machine and user associated with a Tailscale IP (v4 or v6)",
+	LongHelp: strings.TrimSpace(`
+'tailscale whois' shows the machine and user associated with a Tailscale IP
+address, such as one in a server's access log. The port is only needed for
+connections that tailscaled proxied to this machine's loopback address.
+`),
+	Exec: runWhoIs,
+	FlagSet: (func() *flag.FlagSet {
+		fs := newFlagSet("whois")
+		fs.BoolVar(&whoIsArgs.json, "json", false, "output in JSON format")
+		return fs
+	})(),
+}
+
+var whoIsArgs struct {
+	json bool // output in JSON format
+}
+
+func runWhoIs(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: tailscale whois [--json] ip[:port]")
+	}
+	addr, err := parseWhoIsAddr(args[0])
+	if err != nil {
+		return err
+	}
+	who, err := localClient.WhoIs(ctx, addr.String())
+	if err != nil {
+		return fixTailscaledConnectError(err)
+	}
+	if whoIsArgs.json {
+		j, err := json.MarshalIndent(who, "", "  ")
+		if err != nil {
+			return err
+		}
+		printf("%s\n", j)
+		return nil
+	}
+	printWhoIs(Stdout, who)
+	return nil
+}
+
+// parseWhoIsAddr parses s as an IP address with an optional port. An IPv6
+// address with a port must be in brackets.
+func parseWhoIsAddr(s string) (netip.AddrPort, error) {
+	if ip, err := netip.ParseAddr(s); err == nil {
+		return netip.AddrPortFrom(ip, 0), nil
+	}
+	ap, err := netip.ParseAddrPort(s)
+	if err != nil {
+		return netip.AddrPort{}, fmt.Errorf("invalid address %q; want ip or ip:port", s)
+	}
+	return ap, nil
+}
+
+func printWhoIs(w io.Writer, who *apitype.WhoIsResponse) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	defer tw.Flush()
+
+	n := who.Node
+	fmt.Fprintf(tw, "Machine:\n")
+	fmt.Fprintf(tw, "  Name:\t%s\n", strings.TrimSuffix(n.Name, "."))
+	fmt.Fprintf(tw, "  ID:\t%s\n", n.StableID)
+	var addrs []string
+	for _, a := range n.Addresses {
+		addrs = append(addrs, a.Addr().String())
+	}
+	fmt.Fprintf(tw, "  Addresses:\t%s\n", strings.Join(addrs, ", "))
+	if len(n.Tags) > 0 {
+		fmt.Fprintf(tw, "  Tags:\t%s\n", strings.Join(n.Tags, ", "))
+	}
+	if len(who.CapMap) > 0 {
+		var caps []string
+		for c := range who.CapMap {
+			caps = append(caps, string(c))
+		}
+		sort.Strings(caps)
+		fmt.Fprintf(tw, "  Capabilities:\t%s\n", strings.Join(caps, ", "))
+	}
+	if len(n.Tags) == 0 && who.UserProfile != nil {
+		u := who.UserProfile
+		fmt.Fprintf(tw, "User:\n")
+		fmt.Fprintf(tw, "  Name:\t%s\n", u.LoginName)
+		if u.DisplayName != "" {
+			fmt.Fprintf(tw, "  Display name:\t%s\n", u.DisplayName)
+		}
+		fmt.Fprintf(tw, "  ID:\t%d\n", u.ID)
+	}
+}
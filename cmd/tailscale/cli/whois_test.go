@@ -0,0 +1,71 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+
+	"tailscale.com/client/tailscale/apitype"
+	"tailscale.com/tailcfg"
+)
+
+func TestParseWhoIsAddr(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "100.64.0.1", want: "100.64.0.1:0"},
+		{in: "100.64.0.1:443", want: "100.64.0.1:443"},
+		{in: "fd7a:115c:a1e0::1", want: "[fd7a:115c:a1e0::1]:0"},
+		{in: "[fd7a:115c:a1e0::1]:443", want: "[fd7a:115c:a1e0::1]:443"},
+		{in: "example.ts.net", wantErr: true},
+		{in: "100.64.0.1:http", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseWhoIsAddr(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseWhoIsAddr(%q) = %v; want error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got.String() != tt.want {
+			t.Errorf("parseWhoIsAddr(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestPrintWhoIs(t *testing.T) {
+	user := &tailcfg.UserProfile{ID: 1, LoginName: "alice@example.com", DisplayName: "Alice"}
+	node := &tailcfg.Node{
+		Name:      "laptop.example.ts.net.",
+		StableID:  "n123",
+		Addresses: []netip.Prefix{netip.MustParsePrefix("100.64.0.1/32")},
+	}
+	var buf strings.Builder
+	printWhoIs(&buf, &apitype.WhoIsResponse{Node: node, UserProfile: user})
+	want := `Machine:
+  Name:       laptop.example.ts.net
+  ID:         n123
+  Addresses:  100.64.0.1
+User:
+  Name:          alice@example.com
+  Display name:  Alice
+  ID:            1
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Tagged nodes don't belong to the user they were created by.
+	node.Tags = []string{"tag:prod"}
+	buf.Reset()
+	printWhoIs(&buf, &apitype.WhoIsResponse{Node: node, UserProfile: user})
+	if got := buf.String(); !strings.Contains(got, "Tags:       tag:prod\n") || strings.Contains(got, "User:") {
+		t.Errorf("tagged node: got:\n%s", got)
+	}
+}
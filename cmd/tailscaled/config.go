@@ -0,0 +1,144 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build go1.21
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+
+	"tailscale.com/ipn"
+	"tailscale.com/ipn/conffile"
+	"tailscale.com/ipn/ipnlocal"
+	"tailscale.com/types/logger"
+)
+
+var sigHUP os.Signal // set by sighup.go; nil if config reloading isn't supported
+
+// applyDaemonConfig sets the daemon options of c in args, for the options
+// whose flags weren't given on the command line. Flags take precedence over
+// the config file.
+func applyDaemonConfig(c *conffile.Config) {
+	flagIsSet := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		flagIsSet[f.Name] = true
+	})
+	d := c.Daemon
+	if d.Port != nil && !flagIsSet["port"] {
+		args.port = *d.Port
+	}
+	if d.State != nil && !flagIsSet["state"] {
+		args.statepath = *d.State
+	}
+	if d.StateDir != nil && !flagIsSet["statedir"] {
+		args.statedir = *d.StateDir
+	}
+	if d.Tun != nil && !flagIsSet["tun"] {
+		args.tunname = *d.Tun
+	}
+	if d.Socket != nil && !flagIsSet["socket"] {
+		args.socketpath = *d.Socket
+	}
+}
+
+// runConfigFile applies the preferences, auth key and serve config of the
+// config file c to lb, then reapplies them each time tailscaled gets a
+// SIGHUP until ctx is done. The daemon options of a reloaded config file
+// only take effect when tailscaled restarts.
+func runConfigFile(ctx context.Context, logf logger.Logf, lb *ipnlocal.LocalBackend, c *conffile.Config) {
+	logf = logger.WithPrefix(logf, "config: ")
+	// Each applied config gets its own context for setting its serve
+	// config, canceled when the next one is applied.
+	cancelServe := func() {}
+	defer func() { cancelServe() }()
+	apply := func(c *conffile.Config, initial bool) error {
+		cancelServe()
+		serveCtx, cancel := context.WithCancel(ctx)
+		cancelServe = cancel
+		return applyConfig(serveCtx, logf, lb, c, initial)
+	}
+	if err := apply(c, true); err != nil {
+		logf("applying %s: %v", c.Path, err)
+	}
+
+	var hup chan os.Signal // nil if sigHUP is nil, to wait for ctx alone
+	if sigHUP != nil {
+		hup = make(chan os.Signal, 1)
+		signal.Notify(hup, sigHUP)
+		defer signal.Stop(hup)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		}
+		nc, err := conffile.Load(c.Path)
+		if err != nil {
+			logf("not reloading: %v", err)
+			continue
+		}
+		if !reflect.DeepEqual(nc.Daemon, c.Daemon) {
+			logf("daemon options in %s changed; restart tailscaled to apply them", c.Path)
+		}
+		if err := apply(nc, false); err != nil {
+			logf("applying %s: %v", c.Path, err)
+			continue
+		}
+		logf("reloaded %s", c.Path)
+		c = nc
+	}
+}
+
+// applyConfig applies the preferences, auth key and serve config of c to lb.
+//
+// When tailscaled starts, or if lb needs to log in, it (re)starts lb with
+// the new prefs and the auth key. Otherwise, it only edits the prefs, so
+// that reloading a config file doesn't disconnect the node.
+//
+// The serve config is set once lb has a netmap, in a goroutine that stops
+// when ctx is done.
+func applyConfig(ctx context.Context, logf logger.Logf, lb *ipnlocal.LocalBackend, c *conffile.Config, initial bool) error {
+	mp, err := c.Parsed.ToPrefs()
+	if err != nil {
+		return err
+	}
+	if initial || lb.State() == ipn.NeedsLogin {
+		authKey, err := c.AuthKey()
+		if err != nil {
+			return err
+		}
+		prefs := ipn.NewPrefs()
+		if p := lb.Prefs(); p.Valid() {
+			prefs = p.AsStruct()
+		}
+		prefs.ApplyEdits(&mp)
+		if err := lb.Start(ipn.Options{
+			UpdatePrefs: prefs,
+			AuthKey:     authKey,
+		}); err != nil {
+			return fmt.Errorf("starting backend: %w", err)
+		}
+	} else if _, err := lb.EditPrefs(&mp); err != nil {
+		return fmt.Errorf("editing prefs: %w", err)
+	}
+
+	if sc := c.Parsed.ServeConfig; sc != nil {
+		go lb.WatchNotifications(ctx, ipn.NotifyInitialNetMap, nil, func(n *ipn.Notify) (keepGoing bool) {
+			if n.NetMap == nil {
+				return true
+			}
+			if err := lb.SetServeConfig(sc, ""); err != nil {
+				logf("setting serve config: %v", err)
+			}
+			return false
+		})
+	}
+	return nil
+}
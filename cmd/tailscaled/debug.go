@@ -82,14 +82,6 @@ func runMonitor(ctx context.Context, loop bool) error {
 	}
 	defer mon.Close()
 
-	mon.RegisterChangeCallback(func(delta *netmon.ChangeDelta) {
-		if !delta.Major {
-			log.Printf("Network monitor fired; not a major change")
-			return
-		}
-		log.Printf("Network monitor fired. New state:")
-		dump(delta.New)
-	})
 	if loop {
 		log.Printf("Starting link change monitor; initial state:")
 	}
@@ -97,9 +89,19 @@ func runMonitor(ctx context.Context, loop bool) error {
 	if !loop {
 		return nil
 	}
+	sub := mon.Subscribe(netmon.SubscribeOptions{})
+	defer sub.Close()
 	mon.Start()
 	log.Printf("Started link change monitor; waiting...")
-	select {}
+	for delta := range sub.C {
+		if !delta.Major {
+			log.Printf("Network monitor fired; not a major change")
+			continue
+		}
+		log.Printf("Network monitor fired. New state:")
+		dump(delta.New)
+	}
+	return nil
 }
 
 func getURL(ctx context.Context, urlStr string) error {
@@ -0,0 +1,12 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build go1.21 && !plan9 && !windows
+
+package main
+
+import "syscall"
+
+func init() {
+	sigHUP = syscall.SIGHUP
+}
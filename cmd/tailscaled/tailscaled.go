@@ -29,9 +29,14 @@
 	"syscall"
 	"time"
 
+	"tailscale.com/clientupdate/distsign"
 	"tailscale.com/cmd/tailscaled/childproc"
 	"tailscale.com/control/controlclient"
+	"tailscale.com/derp/derpembed"
+	"tailscale.com/derp/derpmap"
 	"tailscale.com/envknob"
+	"tailscale.com/ipn"
+	"tailscale.com/ipn/conffile"
 	"tailscale.com/ipn/ipnlocal"
 	"tailscale.com/ipn/ipnserver"
 	"tailscale.com/ipn/store"
@@ -49,6 +54,7 @@
 	"tailscale.com/paths"
 	"tailscale.com/safesocket"
 	"tailscale.com/syncs"
+	"tailscale.com/tailcfg"
 	"tailscale.com/tsd"
 	"tailscale.com/tsweb/varz"
 	"tailscale.com/types/flagtype"
@@ -57,6 +63,7 @@
 	"tailscale.com/util/clientmetric"
 	"tailscale.com/util/multierr"
 	"tailscale.com/util/osshare"
+	"tailscale.com/util/winutil/policy"
 	"tailscale.com/version"
 	"tailscale.com/version/distro"
 	"tailscale.com/wgengine"
@@ -131,12 +138,26 @@ func defaultPort() uint16 {
 	port           uint16
 	statepath      string
 	statedir       string
+	stateEncrypt   string // KeySealer spec of store.NewKeySealer; empty means none
 	socketpath     string
 	birdSocketPath string
 	verbose        int
 	socksAddr      string // listen address for SOCKS5 server
 	httpProxyAddr  string // listen address for HTTP proxy server
 	disableLogs    bool
+	localOnlyLogs  bool
+	confFile       string // path to config file; empty means none
+	keyExpiryHook  string // program to run ahead of node key expiry; empty means none
+
+	// Embedded DERP relay; see startDERP.
+	derpAddr        string
+	derpSTUNAddr    string
+	derpCertFile    string
+	derpKeyFile     string
+	derpMeshPSKFile string
+	derpMeshWith    string
+	derpMapFile     string
+	derpMapKeysFile string
 }
 
 var (
@@ -145,6 +166,10 @@ func defaultPort() uint16 {
 	createBIRDClient      func(string) (wgengine.BIRDClient, error) // non-nil on some platforms
 )
 
+// onLocalBackendReady, if non-nil, is called by startIPNServer once the
+// LocalBackend is created. The context is done when the server stops.
+var onLocalBackendReady func(context.Context, *ipnlocal.LocalBackend)
+
 var subCommands = map[string]*func([]string) error{
 	"install-system-daemon":   &installSystemDaemon,
 	"uninstall-system-daemon": &uninstallSystemDaemon,
@@ -154,6 +179,8 @@ func defaultPort() uint16 {
 
 var beCLI func() // non-nil if CLI is linked in
 
+var conf *conffile.Config // from --config; nil if none
+
 func main() {
 	envknob.PanicIfAnyEnvCheckedInInit()
 	envknob.ApplyDiskConfig()
@@ -165,13 +192,25 @@ func main() {
 	flag.StringVar(&args.socksAddr, "socks5-server", "", `optional [ip]:port to run a SOCK5 server (e.g. "localhost:1080")`)
 	flag.StringVar(&args.httpProxyAddr, "outbound-http-proxy-listen", "", `optional [ip]:port to run an outbound HTTP proxy (e.g. "localhost:8080")`)
 	flag.StringVar(&args.tunname, "tun", defaultTunName(), `tunnel interface name; use "userspace-networking" (beta) to not use TUN`)
-	flag.Var(flagtype.PortValue(&args.port, defaultPort()), "port", "UDP port to listen on for WireGuard and peer-to-peer traffic; 0 means automatically select")
-	flag.StringVar(&args.statepath, "state", "", "absolute path of state file; use 'kube:<secret-name>' to use Kubernetes secrets or 'arn:aws:ssm:...' to store in AWS SSM; use 'mem:' to not store state and register as an ephemeral node. If empty and --statedir is provided, the default is <statedir>/tailscaled.state. Default: "+paths.DefaultTailscaledStateFile())
+	flag.Var(flagtype.PortValue(&args.port, defaultPort()), "port", "UDP port to listen on for WireGuard and peer-to-peer traffic; 0 means automatically select, reusing the previously selected port if possible")
+	flag.StringVar(&args.statepath, "state", "", "absolute path of state file; use 'kube:<secret-name>' to use Kubernetes secrets, 'arn:aws:ssm:...' to store in AWS SSM, or 'gcpsecret:projects/<project>/secrets/<secret>' to store in GCP Secret Manager; use 'mem:' to not store state and register as an ephemeral node. If empty and --statedir is provided, the default is <statedir>/tailscaled.state. Default: "+paths.DefaultTailscaledStateFile())
 	flag.StringVar(&args.statedir, "statedir", "", "path to directory for storage of config state, TLS certs, temporary incoming Taildrop files, etc. If empty, it's derived from --state when possible.")
+	flag.StringVar(&args.stateEncrypt, "state-encryption", "", `encrypt the state at rest with a key sealed by "dpapi" (Windows), "keychain" (macOS), "passphrase-file:<path>" or "exec:<path>" (a KMS plugin run with "seal" or "unseal"); empty means no encryption`)
 	flag.StringVar(&args.socketpath, "socket", paths.DefaultTailscaledSocket(), "path of the service unix socket")
 	flag.StringVar(&args.birdSocketPath, "bird-socket", "", "path of the bird unix socket")
 	flag.BoolVar(&printVersion, "version", false, "print version information and exit")
 	flag.BoolVar(&args.disableLogs, "no-logs-no-support", false, "disable log uploads; this also disables any technical support")
+	flag.StringVar(&args.derpAddr, "derp-server", "", `optional [ip]:port to run an embedded DERP relay on (e.g. ":443"), for use in a custom DERP map`)
+	flag.StringVar(&args.derpSTUNAddr, "derp-stun-server", ":3478", "[ip]:port to run a STUN server on alongside the embedded DERP relay; empty to not run one")
+	flag.StringVar(&args.derpCertFile, "derp-cert-file", "", "path of the PEM-encoded TLS certificate of the embedded DERP relay; if empty, it serves plain HTTP")
+	flag.StringVar(&args.derpKeyFile, "derp-key-file", "", "path of the PEM-encoded TLS private key of the embedded DERP relay")
+	flag.StringVar(&args.derpMeshPSKFile, "derp-mesh-psk-file", "", "path of a file containing the mesh pre-shared key of the embedded DERP relay, as 64+ hex digits")
+	flag.StringVar(&args.derpMeshWith, "derp-mesh-with", "", "comma-separated hostnames of DERP servers of the same region for the embedded DERP relay to mesh with")
+	flag.StringVar(&args.derpMapFile, "derp-map-file", "", "path of a JSON DERP map, signed in a .sig file next to it, to merge over the DERP map from the control server")
+	flag.StringVar(&args.derpMapKeysFile, "derp-map-keys", "", "path of the PEM bundle of signing public keys that --derp-map-file must be signed by")
+	flag.StringVar(&args.confFile, "config", "", "path to a HuJSON or YAML config file of daemon options and preferences; flags override its daemon options, and SIGHUP reloads its preferences")
+	flag.StringVar(&args.keyExpiryHook, "key-expiry-hook", "", "path of a program to run ahead of node key expiry, per the KeyExpirationNotice system policy (default 24h), with the expiry time as its argument; if empty, an interactive login is started instead")
+	flag.BoolVar(&args.localOnlyLogs, "logs-local-only", false, "keep logs in a bounded local buffer, readable with 'tailscale debug logs', instead of uploading them; implies --no-logs-no-support")
 
 	if len(os.Args) > 0 && filepath.Base(os.Args[0]) == "tailscale" && beCLI != nil {
 		beCLI()
@@ -201,6 +240,16 @@ func main() {
 		}
 	}
 
+	if args.confFile != "" {
+		c, err := conffile.Load(args.confFile)
+		if err != nil {
+			log.SetFlags(0)
+			log.Fatalf("%v", err)
+		}
+		conf = c
+		applyDaemonConfig(c)
+	}
+
 	if fd, ok := envknob.LookupInt("TS_PARENT_DEATH_FD"); ok && fd > 2 {
 		go dieOnPipeReadErrorOfFD(fd)
 	}
@@ -234,6 +283,9 @@ func main() {
 	if args.disableLogs {
 		envknob.SetNoLogsNoSupport()
 	}
+	if args.localOnlyLogs {
+		envknob.SetLocalOnlyLogs()
+	}
 
 	if beWindowsSubprocess() {
 		return
@@ -380,7 +432,7 @@ func run() error {
 		if envknob.Bool("TS_PLEASE_PANIC") {
 			panic("TS_PLEASE_PANIC asked us to panic")
 		}
-		dns.Cleanup(logf, args.tunname)
+		dns.Cleanup(logf, args.tunname, dnsMode(logf, nil))
 		router.Cleanup(logf, args.tunname)
 		return nil
 	}
@@ -396,6 +448,14 @@ func run() error {
 		debugMux = newDebugMux()
 	}
 
+	if args.derpAddr != "" {
+		ds, err := startDERP(logf)
+		if err != nil {
+			return err
+		}
+		defer ds.Close()
+	}
+
 	return startIPNServer(context.Background(), logf, pol.PublicID, sys)
 }
 
@@ -406,6 +466,8 @@ func startIPNServer(ctx context.Context, logf logger.Logf, logID logid.PublicID,
 	if err != nil {
 		return fmt.Errorf("safesocket.Listen: %v", err)
 	}
+	// Let GUIs multiplex their LocalAPI requests over one connection.
+	ln = safesocket.MuxListener(ln)
 
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
@@ -451,6 +513,12 @@ func startIPNServer(ctx context.Context, logf logger.Logf, logID logid.PublicID,
 		if err == nil {
 			logf("got LocalBackend in %v", time.Since(t0).Round(time.Millisecond))
 			srv.SetLocalBackend(lb)
+			if onLocalBackendReady != nil {
+				onLocalBackendReady(ctx, lb)
+			}
+			if conf != nil {
+				go runConfigFile(ctx, logf, lb, conf)
+			}
 			return
 		}
 		lbErr.Store(err) // before the following cancel
@@ -481,10 +549,25 @@ func getLocalBackend(ctx context.Context, logf logger.Logf, logID logid.PublicID
 	dialer := &tsdial.Dialer{Logf: logf} // mutated below (before used)
 	sys.Set(dialer)
 
-	onlyNetstack, err := createEngine(logf, sys)
+	// The store is opened before the engine so that the DNS mode
+	// preference can pick the engine's DNS manager.
+	store, err := openStateStore(logf)
+	if err != nil {
+		return nil, err
+	}
+	sys.Set(store)
+
+	onlyNetstack, err := createEngine(logf, sys, dnsMode(logf, store), listenPort(logf, store))
 	if err != nil {
 		return nil, fmt.Errorf("createEngine: %w", err)
 	}
+	if persistListenPort() {
+		if ms, ok := sys.MagicSock.GetOK(); ok {
+			if err := ipnlocal.SaveListenPort(store, ms.LocalPort()); err != nil {
+				logf("saving listen port: %v", err)
+			}
+		}
+	}
 	if debugMux != nil {
 		if ms, ok := sys.MagicSock.GetOK(); ok {
 			debugMux.HandleFunc("/debug/magicsock", ms.ServeHTTPDebug)
@@ -534,17 +617,21 @@ func getLocalBackend(ctx context.Context, logf logger.Logf, logID logid.PublicID
 
 	opts := ipnServerOpts()
 
-	store, err := store.New(logf, statePathOrDefault())
-	if err != nil {
-		return nil, fmt.Errorf("store.New: %w", err)
-	}
-	sys.Set(store)
-
 	lb, err := ipnlocal.NewLocalBackend(logf, logID, sys, opts.LoginFlags)
 	if err != nil {
 		return nil, fmt.Errorf("ipnlocal.NewLocalBackend: %w", err)
 	}
 	lb.SetVarRoot(opts.VarRoot)
+	if args.derpMapFile != "" {
+		dm, err := loadDERPMap()
+		if err != nil {
+			return nil, err
+		}
+		lb.SetLocalDERPMap(dm)
+	}
+	if args.keyExpiryHook != "" {
+		lb.SetKeyExpiryHook(args.keyExpiryHook)
+	}
 	if logPol != nil {
 		lb.SetLogFlusher(logPol.Logtail.StartFlush)
 	}
@@ -563,14 +650,14 @@ func getLocalBackend(ctx context.Context, logf logger.Logf, logID logid.PublicID
 //
 // onlyNetstack is true if the user has explicitly requested that we use netstack
 // for all networking.
-func createEngine(logf logger.Logf, sys *tsd.System) (onlyNetstack bool, err error) {
+func createEngine(logf logger.Logf, sys *tsd.System, dnsMode string, listenPort uint16) (onlyNetstack bool, err error) {
 	if args.tunname == "" {
 		return false, errors.New("no --tun value specified")
 	}
 	var errs []error
 	for _, name := range strings.Split(args.tunname, ",") {
 		logf("wgengine.NewUserspaceEngine(tun %q) ...", name)
-		onlyNetstack, err = tryEngine(logf, sys, name)
+		onlyNetstack, err = tryEngine(logf, sys, name, dnsMode, listenPort)
 		if err == nil {
 			return onlyNetstack, nil
 		}
@@ -602,9 +689,57 @@ func handleSubnetsInNetstack() bool {
 
 var tstunNew = tstun.New
 
-func tryEngine(logf logger.Logf, sys *tsd.System, name string) (onlyNetstack bool, err error) {
+// persistListenPort reports whether tailscaled saves the UDP port that it
+// selects automatically, with --port=0, to bind it again after a restart.
+// Keeping the port keeps NAT mappings and firewall rules for it working.
+func persistListenPort() bool {
+	return args.port == 0 && !envknob.Bool("TS_NO_PERSIST_LISTEN_PORT")
+}
+
+// listenPort returns the UDP port for the engine to listen on: --port, or,
+// with --port=0, the port saved by the previous run, if any. If the saved
+// port can't be bound, magicsock selects another one.
+func listenPort(logf logger.Logf, store ipn.StateStore) uint16 {
+	if !persistListenPort() {
+		return args.port
+	}
+	port, err := ipnlocal.StartupListenPort(store)
+	if err != nil {
+		logf("reading saved listen port: %v", err)
+		return 0
+	}
+	if port != 0 {
+		logf("trying saved listen port %d", port)
+	}
+	return port
+}
+
+// dnsMode returns the kind of DNS manager to use on Linux, or the empty
+// string to detect one. The DNSMode system policy takes precedence over the
+// DNSMode preference of the profile tailscaled starts with (if store is
+// non-nil), which takes precedence over $TS_DNS_MODE.
+func dnsMode(logf logger.Logf, store ipn.StateStore) string {
+	if runtime.GOOS != "linux" {
+		return ""
+	}
+	if mode := policy.GetString(policy.DNSMode); mode != "" {
+		return mode
+	}
+	if store != nil {
+		mode, err := ipnlocal.StartupDNSMode(store)
+		if err != nil {
+			logf("reading DNS mode preference: %v", err)
+		}
+		if mode != "" {
+			return mode
+		}
+	}
+	return envknob.String("TS_DNS_MODE")
+}
+
+func tryEngine(logf logger.Logf, sys *tsd.System, name, dnsMode string, listenPort uint16) (onlyNetstack bool, err error) {
 	conf := wgengine.Config{
-		ListenPort:   args.port,
+		ListenPort:   listenPort,
 		NetMon:       sys.NetMon.Get(),
 		Dialer:       sys.Dialer.Get(),
 		SetSubsystem: sys.Set,
@@ -630,7 +765,7 @@ func tryEngine(logf logger.Logf, sys *tsd.System, name string) (onlyNetstack boo
 			// configuration being unavailable (from the noop
 			// manager). More in Issue 4017.
 			// TODO(bradfitz): add a Synology-specific DNS manager.
-			conf.DNS, err = dns.NewOSConfigurator(logf, "") // empty interface name
+			conf.DNS, err = dns.NewOSConfigurator(logf, "", dnsMode) // empty interface name
 			if err != nil {
 				return false, fmt.Errorf("dns.NewOSConfigurator: %w", err)
 			}
@@ -658,7 +793,7 @@ func tryEngine(logf logger.Logf, sys *tsd.System, name string) (onlyNetstack boo
 			return false, fmt.Errorf("creating router: %w", err)
 		}
 
-		d, err := dns.NewOSConfigurator(logf, devName)
+		d, err := dns.NewOSConfigurator(logf, devName, dnsMode)
 		if err != nil {
 			dev.Close()
 			r.Close()
@@ -721,6 +856,69 @@ func newNetstack(logf logger.Logf, sys *tsd.System) (*netstack.Impl, error) {
 	)
 }
 
+// startDERP starts the embedded DERP relay configured by the --derp-*
+// flags. The caller must close the returned server.
+func startDERP(logf logger.Logf) (*derpembed.Server, error) {
+	cfg := derpembed.Config{
+		Addr:     args.derpAddr,
+		STUNAddr: args.derpSTUNAddr,
+		CertFile: args.derpCertFile,
+		KeyFile:  args.derpKeyFile,
+		Logf:     logf,
+	}
+	if args.derpMeshPSKFile != "" {
+		b, err := os.ReadFile(args.derpMeshPSKFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading --derp-mesh-psk-file: %w", err)
+		}
+		cfg.MeshKey = strings.TrimSpace(string(b))
+	}
+	for _, h := range strings.Split(args.derpMeshWith, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			cfg.MeshWith = append(cfg.MeshWith, h)
+		}
+	}
+	return derpembed.Start(cfg)
+}
+
+// openStateStore opens the state store named by --state, encrypted per
+// --state-encryption.
+func openStateStore(logf logger.Logf) (ipn.StateStore, error) {
+	st, err := store.New(logf, statePathOrDefault())
+	if err != nil {
+		return nil, fmt.Errorf("store.New: %w", err)
+	}
+	if args.stateEncrypt == "" {
+		return st, nil
+	}
+	sealer, err := store.NewKeySealer(args.stateEncrypt)
+	if err != nil {
+		return nil, fmt.Errorf("--state-encryption: %w", err)
+	}
+	est, err := store.NewEncryptedStore(st, sealer)
+	if err != nil {
+		return nil, fmt.Errorf("--state-encryption: %w", err)
+	}
+	return est, nil
+}
+
+// loadDERPMap loads the signed DERP map named by --derp-map-file,
+// verifying it with the keys in --derp-map-keys.
+func loadDERPMap() (*tailcfg.DERPMap, error) {
+	if args.derpMapKeysFile == "" {
+		return nil, errors.New("--derp-map-file requires --derp-map-keys")
+	}
+	b, err := os.ReadFile(args.derpMapKeysFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading --derp-map-keys: %w", err)
+	}
+	keys, err := distsign.ParseSigningKeyBundle(b)
+	if err != nil {
+		return nil, fmt.Errorf("parsing --derp-map-keys: %w", err)
+	}
+	return derpmap.Load(args.derpMapFile, keys)
+}
+
 // mustStartProxyListeners creates listeners for local SOCKS and HTTP
 // proxies, if the respective addresses are not empty. socksAddr and
 // httpAddr can be the same, in which case socksListener will receive
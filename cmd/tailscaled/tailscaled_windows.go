@@ -52,6 +52,7 @@
 	"tailscale.com/types/logid"
 	"tailscale.com/util/osdiag"
 	"tailscale.com/util/winutil"
+	"tailscale.com/util/winutil/policy"
 	"tailscale.com/version"
 	"tailscale.com/wf"
 )
@@ -131,7 +132,7 @@ func runWindowsService(pol *logpolicy.Policy) error {
 		osdiag.LogSupportInfo(logger.WithPrefix(log.Printf, "Support Info: "), osdiag.LogSupportInfoReasonStartup)
 	}()
 
-	if logSCMInteractions, _ := winutil.GetPolicyInteger("LogSCMInteractions"); logSCMInteractions != 0 {
+	if policy.GetBoolean(policy.LogSCMInteractions) {
 		syslog, err := eventlog.Open(serviceName)
 		if err == nil {
 			syslogf = func(format string, args ...any) {
@@ -158,7 +159,7 @@ func (service *ipnService) Execute(args []string, r <-chan svc.ChangeRequest, ch
 	syslogf("Service start pending")
 
 	svcAccepts := svc.AcceptStop
-	if flushDNSOnSessionUnlock, _ := winutil.GetPolicyInteger("FlushDNSOnSessionUnlock"); flushDNSOnSessionUnlock != 0 {
+	if policy.GetBoolean(policy.FlushDNSOnSessionUnlock) {
 		svcAccepts |= svc.AcceptSessionChange
 	}
 
@@ -305,6 +306,9 @@ func beWindowsSubprocess() bool {
 	}
 	sys.Set(netMon)
 
+	// Restart the subprocess if it gets wedged; see startWatchdog.
+	onLocalBackendReady = startWatchdog
+
 	publicLogID, _ := logid.ParsePublicID(logID)
 	err = startIPNServer(ctx, log.Printf, publicLogID, sys)
 	if err != nil {
@@ -480,6 +484,7 @@ func babysitProc(ctx context.Context, args []string, logf logger.Logf) {
 
 			err = cmd.Wait()
 			log.Printf("subprocess exited: %v", err)
+			noteSubprocessExit(err)
 		}
 
 		// If the process finishes, clean up the write side of the
@@ -0,0 +1,219 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"tailscale.com/client/tailscale"
+	"tailscale.com/client/tailscale/apitype"
+	"tailscale.com/envknob"
+	"tailscale.com/ipn/ipnlocal"
+	"tailscale.com/util/clientmetric"
+	"tailscale.com/util/goroutines"
+)
+
+// The watchdog runs in the tailscaled subprocess of the Windows service. It
+// detects when the subprocess is wedged, writes a dump of its goroutines for
+// later diagnosis, and exits with one of the exit codes below so that
+// babysitProc in the service process restarts it.
+const (
+	// watchdogExitEventLoop is the exit code of a subprocess whose
+	// LocalBackend stopped making progress.
+	watchdogExitEventLoop = 0x7d1
+	// watchdogExitLocalAPI is the exit code of a subprocess whose LocalAPI
+	// stopped responding.
+	watchdogExitLocalAPI = 0x7d2
+)
+
+const (
+	// watchdogInterval is how often the subprocess checks whether it's
+	// wedged.
+	watchdogInterval = 30 * time.Second
+	// watchdogStallTimeout is how long a check may take before the
+	// subprocess is considered wedged.
+	watchdogStallTimeout = 2 * time.Minute
+	// watchdogMaxLocalAPIFailures is the number of consecutive failed
+	// LocalAPI checks after which the subprocess is considered wedged.
+	// Failures rather than timeouts are tolerated a few times, as the
+	// named pipe can be briefly unavailable.
+	watchdogMaxLocalAPIFailures = 3
+	// maxWatchdogDumps is the most goroutine dumps kept in the dump
+	// directory. The oldest are deleted first.
+	maxWatchdogDumps = 10
+)
+
+var (
+	metricWatchdogRestartEventLoop = clientmetric.NewCounter("windows_watchdog_restart_event_loop")
+	metricWatchdogRestartLocalAPI  = clientmetric.NewCounter("windows_watchdog_restart_localapi")
+)
+
+// noteSubprocessExit records in the service process's metrics whether the
+// subprocess exited as it was restarted by its watchdog.
+func noteSubprocessExit(err error) {
+	var ee *exec.ExitError
+	if !errors.As(err, &ee) {
+		return
+	}
+	switch ee.ExitCode() {
+	case watchdogExitEventLoop:
+		metricWatchdogRestartEventLoop.Add(1)
+	case watchdogExitLocalAPI:
+		metricWatchdogRestartLocalAPI.Add(1)
+	}
+}
+
+// startWatchdog starts the watchdog of the tailscaled subprocess, which runs
+// until ctx is done. It's an onLocalBackendReady func.
+func startWatchdog(ctx context.Context, lb *ipnlocal.LocalBackend) {
+	if envknob.Bool("TS_DEBUG_DISABLE_WATCHDOG") {
+		log.Printf("watchdog: disabled by TS_DEBUG_DISABLE_WATCHDOG")
+		return
+	}
+	go runWatchdog(ctx, lb)
+}
+
+func runWatchdog(ctx context.Context, lb *ipnlocal.LocalBackend) {
+	lc := &tailscale.LocalClient{Socket: args.socketpath}
+	ticker := time.NewTicker(watchdogInterval)
+	defer ticker.Stop()
+	localAPIFailures := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if !checkWithTimeout(ctx, func(context.Context) error {
+			lb.State() // blocks while LocalBackend's mutex is held
+			return nil
+		}) {
+			watchdogRestart(ctx, "event loop stalled", watchdogExitEventLoop)
+			return
+		}
+
+		if checkWithTimeout(ctx, func(ctx context.Context) error {
+			return checkLocalAPI(ctx, lc)
+		}) {
+			localAPIFailures = 0
+			continue
+		}
+		localAPIFailures++
+		if localAPIFailures >= watchdogMaxLocalAPIFailures {
+			watchdogRestart(ctx, "LocalAPI unresponsive", watchdogExitLocalAPI)
+			return
+		}
+	}
+}
+
+// checkWithTimeout runs check, and reports whether it succeeded within
+// watchdogStallTimeout. It also reports true if ctx is done meanwhile, as
+// the subprocess is then shutting down.
+func checkWithTimeout(ctx context.Context, check func(context.Context) error) bool {
+	ctx, cancel := context.WithTimeout(ctx, watchdogStallTimeout)
+	defer cancel()
+	errc := make(chan error, 1)
+	go func() { errc <- check(ctx) }()
+	select {
+	case err := <-errc:
+		if err != nil {
+			log.Printf("watchdog: check failed: %v", err)
+		}
+		return err == nil
+	case <-ctx.Done():
+		return !errors.Is(ctx.Err(), context.DeadlineExceeded)
+	}
+}
+
+// checkLocalAPI checks that the ipnserver serves LocalAPI requests, using
+// its server status endpoint, as it doesn't count as a client of the
+// server, unlike the LocalAPI proper.
+func checkLocalAPI(ctx context.Context, lc *tailscale.LocalClient) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", "http://"+apitype.LocalAPIHost+"/server-status", nil)
+	if err != nil {
+		return err
+	}
+	res, err := lc.DoLocalRequest(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("server status: %s", res.Status)
+	}
+	return nil
+}
+
+// watchdogRestart writes a goroutine dump of the wedged subprocess and exits
+// with exitCode, for the service process to restart it. It's a no-op if ctx
+// is done, as the subprocess is then shutting down anyway.
+func watchdogRestart(ctx context.Context, reason string, exitCode int) {
+	if ctx.Err() != nil {
+		return
+	}
+	log.Printf("watchdog: %s; restarting", reason)
+	if dir := watchdogDumpDir(); dir != "" {
+		if path, err := writeWatchdogDump(dir, reason, time.Now()); err != nil {
+			log.Printf("watchdog: writing goroutine dump: %v", err)
+		} else {
+			log.Printf("watchdog: wrote goroutine dump to %s", path)
+		}
+	}
+	os.Exit(exitCode)
+}
+
+// watchdogDumpDir returns the directory in which goroutine dumps are
+// written, or the empty string if there's no state directory.
+func watchdogDumpDir() string {
+	if dir := ipnServerOpts().VarRoot; dir != "" {
+		return filepath.Join(dir, "crash-dumps")
+	}
+	return ""
+}
+
+// writeWatchdogDump writes a dump of all goroutines, for the given reason,
+// to a new file in dir and returns its path. Older dumps are deleted so that
+// at most maxWatchdogDumps remain.
+func writeWatchdogDump(dir, reason string, now time.Time) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "tailscaled watchdog: %s at %s\n\n", reason, now.Format(time.RFC3339))
+	sb.Write(goroutines.ScrubbedGoroutineDump(true))
+	path := filepath.Join(dir, "goroutines-"+now.UTC().Format("20060102T150405Z")+".txt")
+	if err := os.WriteFile(path, []byte(sb.String()), 0600); err != nil {
+		return "", err
+	}
+	pruneWatchdogDumps(dir)
+	return path, nil
+}
+
+// pruneWatchdogDumps deletes the oldest goroutine dumps in dir, so that at
+// most maxWatchdogDumps remain.
+func pruneWatchdogDumps(dir string) {
+	dumps, err := filepath.Glob(filepath.Join(dir, "goroutines-*.txt"))
+	if err != nil || len(dumps) <= maxWatchdogDumps {
+		return
+	}
+	sort.Strings(dumps) // names sort by time
+	for _, path := range dumps[:len(dumps)-maxWatchdogDumps] {
+		if err := os.Remove(path); err != nil {
+			log.Printf("watchdog: removing old goroutine dump: %v", err)
+		}
+	}
+}
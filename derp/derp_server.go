@@ -35,6 +35,7 @@
 
 	"go4.org/mem"
 	"golang.org/x/sync/errgroup"
+	xrate "golang.org/x/time/rate"
 	"tailscale.com/client/tailscale"
 	"tailscale.com/disco"
 	"tailscale.com/envknob"
@@ -143,11 +144,24 @@ type Server struct {
 	removePktForwardOther        expvar.Int
 	avgQueueDuration             *uint64          // In milliseconds; accessed atomically
 	tcpRtt                       metrics.LabelMap // histogram
+	clientsRejected              metrics.LabelMap // by reason
+	clientsRejectedMax           *expvar.Int      // in clientsRejected
+	rateLimitedFrames            expvar.Int       // frames delayed by the per-client rate limit
 
 	// verifyClients only accepts client connections to the DERP server if the clientKey is a
 	// known peer in the network, as specified by a running tailscaled's client's LocalAPI.
 	verifyClients bool
 
+	// maxClients is the maximum number of concurrent client
+	// connections, or 0 for no limit. See SetMaxClients.
+	maxClients int64
+
+	// perClientRecvBytesPerSec and perClientRecvBurst limit the
+	// rate at which each non-mesh client can send packets, if
+	// perClientRecvBytesPerSec is non-zero. See SetPerClientRateLimit.
+	perClientRecvBytesPerSec int
+	perClientRecvBurst       int
+
 	mu       sync.Mutex
 	closed   bool
 	netConns map[Conn]chan struct{} // chan is closed when conn closes
@@ -321,6 +335,7 @@ func NewServer(privateKey key.NodePrivate, logf logger.Logf) *Server {
 		sentTo:               map[key.NodePublic]map[key.NodePublic]int64{},
 		avgQueueDuration:     new(uint64),
 		tcpRtt:               metrics.LabelMap{Label: "le"},
+		clientsRejected:      metrics.LabelMap{Label: "reason"},
 		keyOfAddr:            map[netip.AddrPort]key.NodePublic{},
 		clock:                tstime.StdClock{},
 	}
@@ -338,6 +353,7 @@ func NewServer(privateKey key.NodePrivate, logf logger.Logf) *Server {
 	}
 	s.packetsDroppedTypeDisco = s.packetsDroppedType.Get("disco")
 	s.packetsDroppedTypeOther = s.packetsDroppedType.Get("other")
+	s.clientsRejectedMax = s.clientsRejected.Get("max_clients")
 	return s
 }
 
@@ -356,6 +372,28 @@ func (s *Server) SetVerifyClient(v bool) {
 	s.verifyClients = v
 }
 
+// SetMaxClients sets the maximum number of concurrent client connections,
+// or 0 for no limit. Connections from mesh peers are always accepted, but
+// count towards the limit.
+//
+// It must be called before serving begins.
+func (s *Server) SetMaxClients(n int) {
+	s.maxClients = int64(n)
+}
+
+// SetPerClientRateLimit sets the rate, in bytes per second, at which each
+// client can send packets, with bursts of up to burst bytes. A rate of 0
+// means no limit. Clients that send faster than that are slowed down by no
+// longer reading from their connection. Mesh peers aren't limited.
+//
+// burst is raised to the size of the largest frame if it's smaller.
+//
+// It must be called before serving begins.
+func (s *Server) SetPerClientRateLimit(bytesPerSec, burst int) {
+	s.perClientRecvBytesPerSec = bytesPerSec
+	s.perClientRecvBurst = max(burst, keyLen+MaxPacketSize)
+}
+
 // HasMeshKey reports whether the server is configured with a mesh key.
 func (s *Server) HasMeshKey() bool { return s.meshKey != "" }
 
@@ -695,6 +733,12 @@ func (s *Server) accept(ctx context.Context, nc Conn, brw *bufio.ReadWriter, rem
 		return fmt.Errorf("client %x rejected: %v", clientKey, err)
 	}
 
+	canMesh := clientInfo.MeshKey != "" && clientInfo.MeshKey == s.meshKey
+	if !canMesh && s.maxClients > 0 && s.curClients.Value() >= s.maxClients {
+		s.clientsRejectedMax.Add(1)
+		return fmt.Errorf("client %x rejected: server is at its limit of %d clients", clientKey, s.maxClients)
+	}
+
 	// At this point we trust the client so we don't time out.
 	nc.SetDeadline(time.Time{})
 
@@ -719,7 +763,7 @@ func (s *Server) accept(ctx context.Context, nc Conn, brw *bufio.ReadWriter, rem
 		discoSendQueue: make(chan pkt, perClientSendQueueDepth),
 		sendPongCh:     make(chan [8]byte, 1),
 		peerGone:       make(chan peerGoneMsg),
-		canMesh:        clientInfo.MeshKey != "" && clientInfo.MeshKey == s.meshKey,
+		canMesh:        canMesh,
 		peerGoneLim:    rate.NewLimiter(rate.Every(time.Second), 3),
 	}
 
@@ -739,7 +783,7 @@ func (s *Server) accept(ctx context.Context, nc Conn, brw *bufio.ReadWriter, rem
 	s.registerClient(c)
 	defer s.unregisterClient(c)
 
-	err = s.sendServerInfo(c.bw, clientKey)
+	err = s.sendServerInfo(c.bw, clientKey, canMesh)
 	if err != nil {
 		return fmt.Errorf("send server info: %v", err)
 	}
@@ -778,6 +822,11 @@ func (c *sclient) run(ctx context.Context) error {
 		}
 	}()
 
+	var limiter *xrate.Limiter
+	if lim := c.s.perClientRecvBytesPerSec; lim > 0 && !c.canMesh {
+		limiter = xrate.NewLimiter(xrate.Limit(lim), c.s.perClientRecvBurst)
+	}
+
 	for {
 		ft, fl, err := readFrameHeader(c.br)
 		c.debugLogf("read frame type %d len %d err %v", ft, fl, err)
@@ -797,7 +846,9 @@ func (c *sclient) run(ctx context.Context) error {
 		case frameNotePreferred:
 			err = c.handleFrameNotePreferred(ft, fl)
 		case frameSendPacket:
-			err = c.handleFrameSendPacket(ft, fl)
+			if err = c.rateLimit(ctx, limiter, fl); err == nil {
+				err = c.handleFrameSendPacket(ft, fl)
+			}
 		case frameForwardPacket:
 			err = c.handleFrameForwardPacket(ft, fl)
 		case frameWatchConns:
@@ -815,6 +866,19 @@ func (c *sclient) run(ctx context.Context) error {
 	}
 }
 
+// rateLimit waits until limiter, if non-nil, allows c to send a frame of n
+// bytes.
+func (c *sclient) rateLimit(ctx context.Context, limiter *xrate.Limiter, n uint32) error {
+	if limiter == nil || limiter.AllowN(time.Now(), int(n)) {
+		return nil
+	}
+	c.s.rateLimitedFrames.Add(1)
+	if err := limiter.WaitN(ctx, int(n)); err != nil {
+		return fmt.Errorf("client %s: rate limit: %w", c.key.ShortString(), err)
+	}
+	return nil
+}
+
 func (c *sclient) handleUnknownFrame(ft frameType, fl uint32) error {
 	_, err := io.CopyN(io.Discard, c.br, int64(fl))
 	return err
@@ -1208,8 +1272,15 @@ type serverInfo struct {
 	TokenBucketBytesBurst     int `json:",omitempty"`
 }
 
-func (s *Server) sendServerInfo(bw *lazyBufioWriter, clientKey key.NodePublic) error {
-	msg, err := json.Marshal(serverInfo{Version: ProtocolVersion})
+// sendServerInfo sends the frameServerInfo frame to the client, including
+// the rate limit the server enforces on it, unless it's a mesh peer.
+func (s *Server) sendServerInfo(bw *lazyBufioWriter, clientKey key.NodePublic, canMesh bool) error {
+	info := serverInfo{Version: ProtocolVersion}
+	if !canMesh {
+		info.TokenBucketBytesPerSecond = s.perClientRecvBytesPerSec
+		info.TokenBucketBytesBurst = s.perClientRecvBurst
+	}
+	msg, err := json.Marshal(info)
 	if err != nil {
 		return err
 	}
@@ -1840,6 +1911,8 @@ func (s *Server) ExpVar() expvar.Var {
 		return math.Float64frombits(atomic.LoadUint64(s.avgQueueDuration))
 	}))
 	m.Set("counter_tcp_rtt", &s.tcpRtt)
+	m.Set("counter_clients_rejected", &s.clientsRejected)
+	m.Set("counter_rate_limited_frames", &s.rateLimitedFrames)
 	var expvarVersion expvar.String
 	expvarVersion.Set(version.Long())
 	m.Set("version", &expvarVersion)
@@ -509,10 +509,20 @@ func (ts *testServer) close(t *testing.T) error {
 }
 
 func newTestServer(t *testing.T, ctx context.Context) *testServer {
+	t.Helper()
+	return newTestServerWithConfig(t, ctx, nil)
+}
+
+// newTestServerWithConfig is like newTestServer, but calls config, if
+// non-nil, to configure the server before it starts serving.
+func newTestServerWithConfig(t *testing.T, ctx context.Context, config func(*Server)) *testServer {
 	t.Helper()
 	logf := logger.WithPrefix(t.Logf, "derp-server: ")
 	s := NewServer(key.NewNode(), logf)
 	s.SetMeshKey("mesh-key")
+	if config != nil {
+		config(s)
+	}
 	ln, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
 		t.Fatal(err)
@@ -1487,6 +1497,86 @@ func TestClientSendRateLimiting(t *testing.T) {
 	}
 }
 
+func TestServerMaxClients(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ts := newTestServerWithConfig(t, ctx, func(s *Server) { s.SetMaxClients(2) })
+	defer ts.close(t)
+
+	newRegularClient(t, ts, "c1")
+	newTestWatcher(t, ts, "w1")
+
+	// The server is now at its limit, so it rejects regular clients
+	// without sending them its server info, but still accepts mesh
+	// peers.
+	nc, err := net.Dial("tcp", ts.ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	c, err := NewClient(key.NewNode(), nc, bufio.NewReadWriter(bufio.NewReader(nc), bufio.NewWriter(nc)), t.Logf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m, err := c.recvTimeout(5 * time.Second); err == nil {
+		t.Fatalf("client over the limit got %T; want error", m)
+	}
+	if got := ts.s.clientsRejectedMax.Value(); got != 1 {
+		t.Errorf("clients rejected = %d; want 1", got)
+	}
+	newTestWatcher(t, ts, "w2")
+}
+
+func TestServerPerClientRateLimit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ts := newTestServerWithConfig(t, ctx, func(s *Server) { s.SetPerClientRateLimit(100<<10, 0) })
+	defer ts.close(t)
+
+	nc, err := net.Dial("tcp", ts.ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	c, err := NewClient(key.NewNode(), nc, bufio.NewReadWriter(bufio.NewReader(nc), bufio.NewWriter(nc)), t.Logf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := c.recvTimeout(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ServerInfoMessage{
+		TokenBucketBytesPerSecond: 100 << 10,
+		TokenBucketBytesBurst:     keyLen + MaxPacketSize,
+	}
+	if m != want {
+		t.Errorf("server info = %+v; want %+v", m, want)
+	}
+
+	sc := &sclient{s: ts.s}
+	lim := rate.NewLimiter(1, 10)
+	if err := sc.rateLimit(ctx, lim, 10); err != nil {
+		t.Fatalf("rateLimit within burst: %v", err)
+	}
+	if got := ts.s.rateLimitedFrames.Value(); got != 0 {
+		t.Errorf("rate limited frames = %d; want 0", got)
+	}
+	canceled, cancelLimit := context.WithCancel(ctx)
+	cancelLimit()
+	if err := sc.rateLimit(canceled, lim, 10); err == nil {
+		t.Error("rateLimit over the rate succeeded; want it to wait until the context is done")
+	}
+	if got := ts.s.rateLimitedFrames.Value(); got != 1 {
+		t.Errorf("rate limited frames = %d; want 1", got)
+	}
+	if err := sc.rateLimit(ctx, nil, 1<<20); err != nil {
+		t.Errorf("rateLimit without a limiter: %v", err)
+	}
+}
+
 func TestServerRepliesToPing(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
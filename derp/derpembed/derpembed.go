@@ -0,0 +1,310 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+// Package derpembed runs a DERP relay, and optionally a STUN server, inside
+// another program such as tailscaled or a tsnet app. It lets self-hosters add
+// private relays to their DERP map without deploying cmd/derper separately.
+package derpembed
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"sync"
+	"time"
+
+	"tailscale.com/derp"
+	"tailscale.com/derp/derphttp"
+	"tailscale.com/net/stun"
+	"tailscale.com/types/key"
+	"tailscale.com/types/logger"
+)
+
+// Config configures an embedded DERP server.
+type Config struct {
+	// Addr is the TCP address to serve DERP on, such as ":443".
+	Addr string
+
+	// CertFile and KeyFile are the paths of the PEM-encoded TLS
+	// certificate and private key to serve DERP over HTTPS with. If both
+	// are empty, DERP is served over plain HTTP, which Tailscale clients
+	// only accept for DERP nodes marked InsecureForTests in the DERP map.
+	CertFile string
+	KeyFile  string
+
+	// STUNAddr, if non-empty, is the UDP address to run a STUN server on,
+	// such as ":3478". Clients use it to measure their latency to the
+	// DERP region and to discover their public address.
+	STUNAddr string
+
+	// PrivateKey is the private key of the DERP server. If zero, a new
+	// one is generated. Clients don't pin DERP server keys, so it needn't
+	// be persisted.
+	PrivateKey key.NodePrivate
+
+	// MeshKey, if non-empty, is the pre-shared key that lets other DERP
+	// servers in the same region mesh with this one. It must be at least
+	// 64 hex digits.
+	MeshKey string
+
+	// MeshWith are the hostnames of other DERP servers of the region to
+	// mesh with, over HTTPS. It requires MeshKey.
+	MeshWith []string
+
+	// BandwidthProbe is whether to serve the bandwidth probes of netcheck
+	// clients. Each probe transfers several megabytes in each direction.
+	BandwidthProbe bool
+
+	// Logf, if non-nil, specifies the logger to use. By default,
+	// log.Printf is used.
+	Logf logger.Logf
+}
+
+// Server is a running embedded DERP server.
+type Server struct {
+	logf   logger.Logf
+	derp   *derp.Server
+	ln     net.Listener
+	hs     *http.Server
+	stun   net.PacketConn // or nil
+	cancel context.CancelFunc
+	mesh   []*derphttp.Client
+	wg     sync.WaitGroup
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// validMeshKey reports whether k is a valid mesh key: at least 64 hex
+// digits.
+func validMeshKey(k string) bool {
+	if len(k) < 64 {
+		return false
+	}
+	for _, c := range k {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+// Start starts a DERP server as configured by cfg. It returns once its
+// listeners are open; it's stopped with Close.
+func Start(cfg Config) (_ *Server, retErr error) {
+	logf := cfg.Logf
+	if logf == nil {
+		logf = log.Printf
+	}
+	logf = logger.WithPrefix(logf, "derp: ")
+	if cfg.Addr == "" {
+		return nil, errors.New("derpembed: no listen address")
+	}
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return nil, errors.New("derpembed: CertFile and KeyFile must be set together")
+	}
+	if cfg.MeshKey != "" && !validMeshKey(cfg.MeshKey) {
+		return nil, errors.New("derpembed: mesh key must contain 64+ hex digits")
+	}
+	if len(cfg.MeshWith) > 0 && cfg.MeshKey == "" {
+		return nil, errors.New("derpembed: meshing requires a mesh key")
+	}
+	priv := cfg.PrivateKey
+	if priv.IsZero() {
+		priv = key.NewNode()
+	}
+
+	ds := derp.NewServer(priv, logf)
+	if cfg.MeshKey != "" {
+		ds.SetMeshKey(cfg.MeshKey)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Server{
+		logf:   logf,
+		derp:   ds,
+		cancel: cancel,
+	}
+	defer func() {
+		if retErr != nil {
+			s.Close()
+		}
+	}()
+
+	mux := http.NewServeMux()
+	mux.Handle("/derp", derphttp.Handler(ds))
+	mux.HandleFunc("/derp/probe", probeHandler)
+	if cfg.BandwidthProbe {
+		mux.HandleFunc(derphttp.BandwidthProbePath, derphttp.BandwidthProbeHandler)
+	}
+	s.hs = &http.Server{
+		Handler:  mux,
+		ErrorLog: log.New(logger.FuncWriter(logger.WithPrefix(logf, "http: ")), "", 0),
+		// Read and write deadlines are cleared when the DERP server
+		// hijacks the connection; these only bound the TLS and HTTP
+		// handshakes, as in cmd/derper.
+		ReadTimeout:  30 * time.Second,
+		WriteTimeout: 30 * time.Second,
+	}
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("derpembed: loading TLS certificate: %w", err)
+		}
+		// Let clients learn the server key during the TLS handshake.
+		cert.Certificate = append(cert.Certificate, ds.MetaCert())
+		s.hs.TLSConfig = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}
+	}
+
+	var err error
+	s.ln, err = net.Listen("tcp", cfg.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("derpembed: %w", err)
+	}
+	if cfg.STUNAddr != "" {
+		s.stun, err = net.ListenPacket("udp", cfg.STUNAddr)
+		if err != nil {
+			return nil, fmt.Errorf("derpembed: STUN: %w", err)
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			serveSTUN(ctx, s.stun, logf)
+		}()
+		logf("serving STUN on %v", s.stun.LocalAddr())
+	}
+
+	for _, host := range cfg.MeshWith {
+		if err := s.startMesh(ctx, host); err != nil {
+			return nil, err
+		}
+	}
+
+	// Read TLSConfig before starting to serve, as http.Server.Serve
+	// modifies it.
+	useTLS := s.hs.TLSConfig != nil
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		var err error
+		if useTLS {
+			err = s.hs.ServeTLS(s.ln, "", "")
+		} else {
+			err = s.hs.Serve(s.ln)
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logf("serve: %v", err)
+		}
+	}()
+	logf("serving DERP on %v (TLS: %v)", s.ln.Addr(), useTLS)
+	return s, nil
+}
+
+// startMesh starts forwarding packets for clients of the DERP server at
+// host, and vice versa.
+func (s *Server) startMesh(ctx context.Context, host string) error {
+	logf := logger.WithPrefix(s.logf, fmt.Sprintf("mesh(%q): ", host))
+	c, err := derphttp.NewClient(s.derp.PrivateKey(), "https://"+host+"/derp", logf)
+	if err != nil {
+		return fmt.Errorf("derpembed: mesh with %q: %w", host, err)
+	}
+	c.MeshKey = s.derp.MeshKey()
+	s.mesh = append(s.mesh, c)
+
+	add := func(k key.NodePublic, _ netip.AddrPort) { s.derp.AddPacketForwarder(k, c) }
+	remove := func(k key.NodePublic) { s.derp.RemovePacketForwarder(k, c) }
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		c.RunWatchConnectionLoop(ctx, s.derp.PublicKey(), logf, add, remove)
+	}()
+	return nil
+}
+
+// Addr returns the address DERP is served on.
+func (s *Server) Addr() net.Addr { return s.ln.Addr() }
+
+// STUNAddr returns the address of the STUN server, or nil if it's not
+// running.
+func (s *Server) STUNAddr() net.Addr {
+	if s.stun == nil {
+		return nil
+	}
+	return s.stun.LocalAddr()
+}
+
+// PublicKey returns the public key of the DERP server.
+func (s *Server) PublicKey() key.NodePublic { return s.derp.PublicKey() }
+
+// Close stops the DERP server and waits for its goroutines to exit.
+// Calls after the first do nothing and return the same error.
+func (s *Server) Close() error {
+	s.closeOnce.Do(func() {
+		s.cancel()
+		if s.hs != nil {
+			s.hs.Close()
+		}
+		if s.ln != nil {
+			s.ln.Close()
+		}
+		if s.stun != nil {
+			s.stun.Close()
+		}
+		for _, c := range s.mesh {
+			c.Close()
+		}
+		s.closeErr = s.derp.Close()
+		s.wg.Wait()
+	})
+	return s.closeErr
+}
+
+// probeHandler is the endpoint that js/wasm clients hit to measure
+// DERP latency, since they can't do UDP STUN queries.
+func probeHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "HEAD", "GET":
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	default:
+		http.Error(w, "bogus probe method", http.StatusMethodNotAllowed)
+	}
+}
+
+// serveSTUN answers STUN binding requests received on pc until ctx is
+// done.
+func serveSTUN(ctx context.Context, pc net.PacketConn, logf logger.Logf) {
+	var buf [64 << 10]byte
+	for {
+		n, addr, err := pc.ReadFrom(buf[:])
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			logf("STUN ReadFrom: %v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		pkt := buf[:n]
+		if !stun.Is(pkt) {
+			continue
+		}
+		txid, err := stun.ParseBindingRequest(pkt)
+		if err != nil {
+			continue
+		}
+		ua, ok := addr.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+		ip, _ := netip.AddrFromSlice(ua.IP)
+		res := stun.Response(txid, netip.AddrPortFrom(ip.Unmap(), uint16(ua.Port)))
+		pc.WriteTo(res, addr)
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package derpembed
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"tailscale.com/derp/derphttp"
+	"tailscale.com/net/stun"
+	"tailscale.com/types/key"
+)
+
+func TestStartConfigErrors(t *testing.T) {
+	meshKey := strings.Repeat("ab", 32)
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{"no-addr", Config{}},
+		{"cert-without-key", Config{Addr: "127.0.0.1:0", CertFile: "cert.pem"}},
+		{"short-mesh-key", Config{Addr: "127.0.0.1:0", MeshKey: "abcd"}},
+		{"non-hex-mesh-key", Config{Addr: "127.0.0.1:0", MeshKey: strings.Repeat("xy", 32)}},
+		{"mesh-without-key", Config{Addr: "127.0.0.1:0", MeshWith: []string{"derp2.example.com"}}},
+		{"missing-cert", Config{Addr: "127.0.0.1:0", CertFile: "nonexistent.pem", KeyFile: "nonexistent.key", MeshKey: meshKey}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Logf = t.Logf
+			s, err := Start(tt.cfg)
+			if err == nil {
+				s.Close()
+				t.Fatal("Start succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestServer(t *testing.T) {
+	s, err := Start(Config{
+		Addr:     "127.0.0.1:0",
+		STUNAddr: "127.0.0.1:0",
+		Logf:     t.Logf,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// STUN.
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	txID := stun.NewTxID()
+	if _, err := pc.WriteTo(stun.Request(txID), s.STUNAddr()); err != nil {
+		t.Fatal(err)
+	}
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 1500)
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("reading STUN response: %v", err)
+	}
+	gotTxID, addr, err := stun.ParseResponse(buf[:n])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotTxID != txID {
+		t.Errorf("STUN response for transaction %x, want %x", gotTxID, txID)
+	}
+	if got, want := addr.String(), pc.LocalAddr().String(); got != want {
+		t.Errorf("STUN mapped address = %v, want %v", got, want)
+	}
+
+	// DERP.
+	c, err := derphttp.NewClient(key.NewNode(), "http://"+s.Addr().String()+"/derp", t.Logf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Connect(ctx); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	if got := c.ServerPublicKey(); got != s.PublicKey() {
+		t.Errorf("server key = %v, want %v", got, s.PublicKey())
+	}
+}
+
+func TestCloseTwice(t *testing.T) {
+	s, err := Start(Config{
+		Addr: "127.0.0.1:0",
+		Logf: t.Logf,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err1 := s.Close()
+	if err2 := s.Close(); err2 != err1 {
+		t.Errorf("second Close = %v, want %v", err2, err1)
+	}
+}
@@ -5,8 +5,10 @@
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"tailscale.com/derp"
@@ -58,3 +60,47 @@ func Handler(s *derp.Server) http.Handler {
 		s.Accept(r.Context(), netConn, conn, netConn.RemoteAddr().String())
 	})
 }
+
+// BandwidthProbePath is the path that BandwidthProbeHandler is served on by
+// DERP servers that allow bandwidth probes.
+const BandwidthProbePath = "/derp/bandwidth"
+
+// MaxBandwidthProbeBytes is the most data that BandwidthProbeHandler sends or
+// receives per request.
+const MaxBandwidthProbeBytes = 16 << 20
+
+// BandwidthProbeHandler serves the bandwidth probes of netcheck clients. A GET
+// request is answered with the number of bytes in its "bytes" query parameter,
+// and the body of a POST request is read and discarded, up to
+// MaxBandwidthProbeBytes either way.
+//
+// As probes cost the server as much bandwidth as they measure, DERP servers
+// only serve it when configured to.
+func BandwidthProbeHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	switch r.Method {
+	case "GET":
+		n, err := strconv.ParseInt(r.FormValue("bytes"), 10, 64)
+		if err != nil || n < 0 {
+			http.Error(w, "bad bytes parameter", http.StatusBadRequest)
+			return
+		}
+		n = min(n, MaxBandwidthProbeBytes)
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.FormatInt(n, 10))
+		io.CopyN(w, zeroReader{}, n)
+	case "POST":
+		io.Copy(io.Discard, io.LimitReader(r.Body, MaxBandwidthProbeBytes))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "bad bandwidth probe method", http.StatusMethodNotAllowed)
+	}
+}
+
+// zeroReader is an io.Reader of infinite zero bytes.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
@@ -0,0 +1,110 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+// Package derpmap loads DERP maps from signed local files, for networks,
+// such as air-gapped ones, that run their own DERP servers and distribute
+// their map without relying on the control server.
+package derpmap
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"tailscale.com/clientupdate/distsign"
+	"tailscale.com/tailcfg"
+)
+
+// maxFileSize is the largest DERP map file that Load reads.
+const maxFileSize = 1 << 20
+
+// Load reads the JSON-encoded DERP map at path and verifies it with its
+// signature at path+".sig", which must have been made by one of the distsign
+// signing keys whose public keys are keys.
+func Load(path string, keys []ed25519.PublicKey) (*tailcfg.DERPMap, error) {
+	raw, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := readFile(path + ".sig")
+	if err != nil {
+		return nil, err
+	}
+	if err := distsign.VerifyPackage(keys, bytes.NewReader(raw), sig); err != nil {
+		return nil, fmt.Errorf("DERP map %s: %w", path, err)
+	}
+	dm := new(tailcfg.DERPMap)
+	if err := json.Unmarshal(raw, dm); err != nil {
+		return nil, fmt.Errorf("DERP map %s: %w", path, err)
+	}
+	if err := check(dm); err != nil {
+		return nil, fmt.Errorf("DERP map %s: %w", path, err)
+	}
+	return dm, nil
+}
+
+func readFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	raw, err := io.ReadAll(io.LimitReader(f, maxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) > maxFileSize {
+		return nil, fmt.Errorf("%s is larger than %d bytes", path, maxFileSize)
+	}
+	return raw, nil
+}
+
+// check reports whether dm is a usable DERP map.
+func check(dm *tailcfg.DERPMap) error {
+	if len(dm.Regions) == 0 {
+		return errors.New("no regions")
+	}
+	for id, r := range dm.Regions {
+		if r == nil || r.RegionID != id {
+			return fmt.Errorf("region %d has mismatched RegionID", id)
+		}
+		if len(r.Nodes) == 0 {
+			return fmt.Errorf("region %d has no nodes", id)
+		}
+		for _, n := range r.Nodes {
+			if n == nil || n.RegionID != id {
+				return fmt.Errorf("region %d has a node of another region", id)
+			}
+		}
+	}
+	return nil
+}
+
+// Merge returns the DERP map to use, given the one from the control server
+// and a local one, either of which may be nil. If local.OmitDefaultRegions is
+// set, local replaces the control server's map entirely. Otherwise, the
+// regions of local replace the control server's regions with the same IDs
+// and are added to the rest. Neither map is modified.
+func Merge(control, local *tailcfg.DERPMap) *tailcfg.DERPMap {
+	if local == nil {
+		return control
+	}
+	if control == nil || local.OmitDefaultRegions {
+		return local.Clone()
+	}
+	dm := control.Clone()
+	if dm.Regions == nil {
+		dm.Regions = map[int]*tailcfg.DERPRegion{}
+	}
+	for id, r := range local.Regions {
+		dm.Regions[id] = r.Clone()
+	}
+	if local.HomeParams != nil {
+		dm.HomeParams = local.HomeParams.Clone()
+	}
+	return dm
+}
@@ -0,0 +1,154 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package derpmap
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"tailscale.com/clientupdate/distsign"
+	"tailscale.com/tailcfg"
+)
+
+func region(id int, host string) *tailcfg.DERPRegion {
+	return &tailcfg.DERPRegion{
+		RegionID:   id,
+		RegionCode: host,
+		Nodes: []*tailcfg.DERPNode{{
+			Name:     host,
+			RegionID: id,
+			HostName: host + ".example.com",
+		}},
+	}
+}
+
+func TestLoad(t *testing.T) {
+	newKey := func() (*distsign.SigningKey, []byte) {
+		priv, pub, err := distsign.GenerateSigningKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		k, err := distsign.ParseSigningKey(priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k, pub
+	}
+	signer, pub := newKey()
+	other, _ := newKey()
+	keys, err := distsign.ParseSigningKeyBundle(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(k *distsign.SigningKey, raw []byte) []byte {
+		h := distsign.NewPackageHash()
+		h.Write(raw)
+		sig, err := k.SignPackageHash(h.Sum(nil), h.Len())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sig
+	}
+
+	good := &tailcfg.DERPMap{
+		OmitDefaultRegions: true,
+		Regions:            map[int]*tailcfg.DERPRegion{900: region(900, "private")},
+	}
+	goodRaw, err := json.Marshal(good)
+	if err != nil {
+		t.Fatal(err)
+	}
+	noNodesRaw := []byte(`{"Regions":{"900":{"RegionID":900}}}`)
+
+	tests := []struct {
+		name    string
+		raw     []byte
+		sig     []byte // nil means no signature file
+		want    *tailcfg.DERPMap
+		wantErr string
+	}{
+		{name: "good", raw: goodRaw, sig: sign(signer, goodRaw), want: good},
+		{name: "no_sig", raw: goodRaw, wantErr: "no such file"},
+		{name: "wrong_key", raw: goodRaw, sig: sign(other, goodRaw), wantErr: "does not validate"},
+		{name: "tampered", raw: append(goodRaw, ' '), sig: sign(signer, goodRaw), wantErr: "does not validate"},
+		{name: "no_nodes", raw: noNodesRaw, sig: sign(signer, noNodesRaw), wantErr: "no nodes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "derpmap.json")
+			if err := os.WriteFile(path, tt.raw, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if tt.sig != nil {
+				if err := os.WriteFile(path+".sig", tt.sig, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := Load(path, keys)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v; want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v; want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	control := &tailcfg.DERPMap{
+		Regions: map[int]*tailcfg.DERPRegion{
+			1: region(1, "nyc"),
+			2: region(2, "sfo"),
+		},
+	}
+	tests := []struct {
+		name  string
+		local *tailcfg.DERPMap
+		want  []string // region codes, by ascending region ID
+	}{
+		{
+			name: "no_local",
+			want: []string{"nyc", "sfo"},
+		},
+		{
+			name:  "add_and_override",
+			local: &tailcfg.DERPMap{Regions: map[int]*tailcfg.DERPRegion{2: region(2, "private-sfo"), 900: region(900, "private")}},
+			want:  []string{"nyc", "private-sfo", "private"},
+		},
+		{
+			name: "replace",
+			local: &tailcfg.DERPMap{
+				OmitDefaultRegions: true,
+				Regions:            map[int]*tailcfg.DERPRegion{900: region(900, "private")},
+			},
+			want: []string{"private"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dm := Merge(control, tt.local)
+			var got []string
+			for _, id := range dm.RegionIDs() {
+				got = append(got, dm.Regions[id].RegionCode)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("regions = %q; want %q", got, tt.want)
+			}
+			if len(control.Regions) != 2 || control.Regions[2].RegionCode != "sfo" {
+				t.Errorf("control map was modified")
+			}
+		})
+	}
+}
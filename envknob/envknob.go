@@ -410,7 +410,7 @@ func CrashOnUnexpected() bool {
 // NoLogsNoSupport reports whether the client's opted out of log uploads and
 // technical support.
 func NoLogsNoSupport() bool {
-	return Bool("TS_NO_LOGS_NO_SUPPORT")
+	return Bool("TS_NO_LOGS_NO_SUPPORT") || LocalOnlyLogs()
 }
 
 var allowRemoteUpdate = RegisterBool("TS_ALLOW_ADMIN_CONSOLE_REMOTE_UPDATE")
@@ -425,6 +425,19 @@ func SetNoLogsNoSupport() {
 	Setenv("TS_NO_LOGS_NO_SUPPORT", "true")
 }
 
+// LocalOnlyLogs reports whether the client keeps its logs in a bounded local
+// buffer rather than uploading them. It implies NoLogsNoSupport.
+func LocalOnlyLogs() bool {
+	return Bool("TS_LOGS_LOCAL_ONLY")
+}
+
+// SetLocalOnlyLogs enables local-only logging mode, which also enables
+// no-logs-no-support mode.
+func SetLocalOnlyLogs() {
+	Setenv("TS_LOGS_LOCAL_ONLY", "true")
+	SetNoLogsNoSupport()
+}
+
 // notInInit is set true the first time we've seen a non-init stack trace.
 var notInInit atomic.Bool
 
@@ -11,6 +11,7 @@
 	"net/http"
 	"runtime"
 	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -102,6 +103,24 @@ func WithMapDebugFlag(name string) WarnableOpt {
 	})
 }
 
+// WithName returns a WarnableOpt for NewWarnable that names the returned
+// Warnable in Warnings. The name should be a short, stable, kebab-case
+// identifier, such as "dns-trample", that GUIs can match on.
+func WithName(name string) WarnableOpt {
+	return warnOptFunc(func(w *Warnable) {
+		w.name = name
+	})
+}
+
+// WithSeverity returns a WarnableOpt for NewWarnable that sets the
+// severity of the returned Warnable in Warnings. The default is
+// SeverityMedium.
+func WithSeverity(s Severity) WarnableOpt {
+	return warnOptFunc(func(w *Warnable) {
+		w.severity = s
+	})
+}
+
 type warnOptFunc func(*Warnable)
 
 func (f warnOptFunc) mod(w *Warnable) { f(w) }
@@ -109,7 +128,9 @@ func (f warnOptFunc) mod(w *Warnable) { f(w) }
 // Warnable is a health check item that may or may not be in a bad warning state.
 // The caller of NewWarnable is responsible for calling Set to update the state.
 type Warnable struct {
-	debugFlag string // optional MapRequest.DebugFlag to send when unhealthy
+	debugFlag string   // optional MapRequest.DebugFlag to send when unhealthy
+	name      string   // optional name in Warnings
+	severity  Severity // optional severity in Warnings
 
 	isSet atomic.Bool
 	mu    sync.Mutex
@@ -314,6 +335,15 @@ func GetInPollNetMap() bool {
 	return inMapPoll
 }
 
+// GetLastStreamedMapResponse returns the last time a streamed map response
+// (including keep-alives) was received from the control plane, or the zero
+// time if none has been.
+func GetLastStreamedMapResponse() time.Time {
+	mu.Lock()
+	defer mu.Unlock()
+	return lastStreamedMapResponse
+}
+
 // SetMagicSockDERPHome notes what magicsock's view of its home DERP is.
 func SetMagicSockDERPHome(region int) {
 	mu.Lock()
@@ -427,38 +457,59 @@ func OverallError() error {
 var fakeErrForTesting = envknob.RegisterString("TS_DEBUG_FAKE_HEALTH_ERROR")
 
 func overallErrorLocked() error {
+	if _, err := connectivityErrorLocked(); err != nil {
+		return err
+	}
+	var errs []error
+	for _, p := range problemsLocked() {
+		errs = append(errs, p.err)
+	}
+	if e := fakeErrForTesting(); len(errs) == 0 && e != "" {
+		return errors.New(e)
+	}
+	sort.Slice(errs, func(i, j int) bool {
+		// Not super efficient (stringifying these in a sort), but probably max 2 or 3 items.
+		return errs[i].Error() < errs[j].Error()
+	})
+	return multierr.New(errs...)
+}
+
+// connectivityErrorLocked returns the first reason, if any, that the node
+// isn't connected to the tailnet, and the name of that reason in Warnings.
+// OverallError reports only this error when there is one.
+func connectivityErrorLocked() (name string, err error) {
 	if !anyInterfaceUp {
-		return errors.New("network down")
+		return "network-down", errors.New("network down")
 	}
 	if localLogConfigErr != nil {
-		return localLogConfigErr
+		return "log-config", localLogConfigErr
 	}
 	if !ipnWantRunning {
-		return fmt.Errorf("state=%v, wantRunning=%v", ipnState, ipnWantRunning)
+		return "not-running", fmt.Errorf("state=%v, wantRunning=%v", ipnState, ipnWantRunning)
 	}
 	if lastLoginErr != nil {
-		return fmt.Errorf("not logged in, last login error=%v", lastLoginErr)
+		return "login", fmt.Errorf("not logged in, last login error=%v", lastLoginErr)
 	}
 	now := time.Now()
 	if !inMapPoll && (lastMapPollEndedAt.IsZero() || now.Sub(lastMapPollEndedAt) > 10*time.Second) {
-		return errors.New("not in map poll")
+		return "not-in-map-poll", errors.New("not in map poll")
 	}
 	const tooIdle = 2*time.Minute + 5*time.Second
 	if d := now.Sub(lastStreamedMapResponse).Round(time.Second); d > tooIdle {
-		return fmt.Errorf("no map response in %v", d)
+		return "no-map-response", fmt.Errorf("no map response in %v", d)
 	}
 	rid := derpHomeRegion
 	if rid == 0 {
-		return errors.New("no DERP home")
+		return "no-derp-home", errors.New("no DERP home")
 	}
 	if !derpRegionConnected[rid] {
-		return fmt.Errorf("not connected to home DERP region %v", rid)
+		return "derp-home-disconnected", fmt.Errorf("not connected to home DERP region %v", rid)
 	}
 	if d := now.Sub(derpRegionLastFrame[rid]).Round(time.Second); d > tooIdle {
-		return fmt.Errorf("haven't heard from home DERP region %v in %v", rid, d)
+		return "derp-home-idle", fmt.Errorf("haven't heard from home DERP region %v in %v", rid, d)
 	}
 	if udp4Unbound {
-		return errors.New("no udp4 bind")
+		return "udp4-unbound", errors.New("no udp4 bind")
 	}
 
 	// TODO: use
@@ -467,43 +518,144 @@ func overallErrorLocked() error {
 	_ = lastStreamedMapResponse
 	_ = lastMapRequestHeard
 
-	var errs []error
+	return "", nil
+}
+
+// problem is a health problem other than those of connectivityErrorLocked.
+type problem struct {
+	name     string
+	severity Severity
+	err      error
+}
+
+// subsystemSeverity is the severity of each Subsystem's error in Warnings.
+// Subsystems not listed are SeverityMedium.
+var subsystemSeverity = map[Subsystem]Severity{
+	SysRouter: SeverityHigh,
+	SysDNS:    SeverityHigh,
+}
+
+// problemsLocked returns the current health problems other than those of
+// connectivityErrorLocked, in no particular order.
+func problemsLocked() []problem {
+	var ps []problem
 	for _, recv := range receiveFuncs {
 		if recv.missing {
-			errs = append(errs, fmt.Errorf("%s is not running", recv.name))
+			name := "receive-" + strings.ToLower(strings.TrimPrefix(recv.name, "Receive"))
+			ps = append(ps, problem{name, SeverityHigh, fmt.Errorf("%s is not running", recv.name)})
 		}
 	}
 	for sys, err := range sysErr {
 		if err == nil || sys == SysOverall {
 			continue
 		}
-		errs = append(errs, fmt.Errorf("%v: %w", sys, err))
+		sev, ok := subsystemSeverity[sys]
+		if !ok {
+			sev = SeverityMedium
+		}
+		ps = append(ps, problem{string(sys), sev, fmt.Errorf("%v: %w", sys, err)})
 	}
 	for w := range warnables {
 		if err := w.get(); err != nil {
-			errs = append(errs, err)
+			name, sev := w.name, w.severity
+			if name == "" {
+				name = "warning"
+			}
+			if sev == "" {
+				sev = SeverityMedium
+			}
+			ps = append(ps, problem{name, sev, err})
 		}
 	}
-	for regionID, problem := range derpRegionHealthProblem {
-		errs = append(errs, fmt.Errorf("derp%d: %v", regionID, problem))
+	for regionID, p := range derpRegionHealthProblem {
+		ps = append(ps, problem{fmt.Sprintf("derp-region-%d", regionID), SeverityMedium, fmt.Errorf("derp%d: %v", regionID, p)})
 	}
 	for _, s := range controlHealth {
-		errs = append(errs, errors.New(s))
+		ps = append(ps, problem{"control", SeverityMedium, errors.New(s)})
 	}
 	if err := envknob.ApplyDiskConfigError(); err != nil {
-		errs = append(errs, err)
+		ps = append(ps, problem{"envknob-disk-config", SeverityLow, err})
 	}
 	for serverName, err := range tlsConnectionErrors {
-		errs = append(errs, fmt.Errorf("TLS connection error for %q: %w", serverName, err))
+		ps = append(ps, problem{"tls-" + serverName, SeverityHigh, fmt.Errorf("TLS connection error for %q: %w", serverName, err)})
 	}
-	if e := fakeErrForTesting(); len(errs) == 0 && e != "" {
-		return errors.New(e)
+	return ps
+}
+
+// Severity is how badly a health problem affects the node.
+type Severity string
+
+const (
+	// SeverityHigh is a problem that likely breaks connectivity to the
+	// tailnet or to some of its peers.
+	SeverityHigh = Severity("high")
+
+	// SeverityMedium is a problem that likely breaks some feature.
+	SeverityMedium = Severity("medium")
+
+	// SeverityLow is a problem that is unlikely to break anything but that
+	// the user may want to know about.
+	SeverityLow = Severity("low")
+)
+
+func (s Severity) rank() int {
+	switch s {
+	case SeverityHigh:
+		return 0
+	case SeverityMedium:
+		return 1
+	case SeverityLow:
+		return 2
 	}
-	sort.Slice(errs, func(i, j int) bool {
-		// Not super efficient (stringifying these in a sort), but probably max 2 or 3 items.
-		return errs[i].Error() < errs[j].Error()
+	return 3
+}
+
+// Warning is a health problem of the node, in a form that GUIs can render.
+type Warning struct {
+	// Name is a short, stable identifier of the problem, such as "router",
+	// "dns-trample" or "derp-region-1", that GUIs can match on to offer a
+	// fix. Unlike Text, it doesn't change between releases.
+	Name string
+
+	// Severity is how badly the problem affects the node.
+	Severity Severity
+
+	// Text is the human-readable description of the problem.
+	Text string
+}
+
+// Warnings returns the node's current health problems, most severe first.
+// Unlike OverallError, it reports every problem, even when the node isn't
+// connected at all.
+func Warnings() []Warning {
+	mu.Lock()
+	defer mu.Unlock()
+	var ws []Warning
+	if name, err := connectivityErrorLocked(); err != nil {
+		ws = append(ws, Warning{Name: name, Severity: SeverityHigh, Text: err.Error()})
+	}
+	for _, p := range problemsLocked() {
+		ws = append(ws, Warning{Name: p.name, Severity: p.severity, Text: p.err.Error()})
+	}
+	if e := fakeErrForTesting(); len(ws) == 0 && e != "" {
+		ws = append(ws, Warning{Name: "fake", Severity: SeverityLow, Text: e})
+	}
+	SortWarnings(ws)
+	return ws
+}
+
+// SortWarnings sorts ws by decreasing severity, then by name and text.
+func SortWarnings(ws []Warning) {
+	sort.Slice(ws, func(i, j int) bool {
+		a, b := ws[i], ws[j]
+		if a.Severity != b.Severity {
+			return a.Severity.rank() < b.Severity.rank()
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Text < b.Text
 	})
-	return multierr.New(errs...)
 }
 
 var (
@@ -34,6 +34,39 @@ func TestAppendWarnableDebugFlags(t *testing.T) {
 	}
 }
 
+func TestWarnings(t *testing.T) {
+	resetWarnables()
+	t.Cleanup(func() {
+		resetWarnables()
+		SetDNSHealth(nil)
+		SetDERPRegionHealth(7, "")
+	})
+
+	NewWarnable(WithName("low"), WithSeverity(SeverityLow)).Set(errors.New("low problem"))
+	NewWarnable().Set(errors.New("unnamed problem"))
+	NewWarnable(WithName("ok")).Set(nil)
+	SetDNSHealth(errors.New("boom"))
+	SetDERPRegionHealth(7, "slow")
+
+	// Drop the connectivity warnings, which depend on global state that
+	// other tests don't set up.
+	var got []Warning
+	for _, w := range Warnings() {
+		if w.Name == "dns" || w.Name == "derp-region-7" || w.Name == "warning" || w.Name == "low" {
+			got = append(got, w)
+		}
+	}
+	want := []Warning{
+		{Name: "dns", Severity: SeverityHigh, Text: "dns: boom"},
+		{Name: "derp-region-7", Severity: SeverityMedium, Text: "derp7: slow"},
+		{Name: "warning", Severity: SeverityMedium, Text: "unnamed problem"},
+		{Name: "low", Severity: SeverityLow, Text: "low problem"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Warnings = %+v; want %+v", got, want)
+	}
+}
+
 func resetWarnables() {
 	mu.Lock()
 	defer mu.Unlock()
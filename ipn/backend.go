@@ -5,6 +5,7 @@
 
 import (
 	"fmt"
+	"net/netip"
 	"strings"
 	"time"
 
@@ -14,6 +15,7 @@
 	"tailscale.com/types/key"
 	"tailscale.com/types/netmap"
 	"tailscale.com/types/structs"
+	"tailscale.com/wgengine/filter"
 )
 
 type State int
@@ -66,6 +68,10 @@ type EngineStatus struct {
 	NotifyInitialNetMap // if set, the first Notify message (sent immediately) will contain the current NetMap
 
 	NotifyNoPrivateKeys // if set, private keys that would normally be sent in updates are zeroed out
+
+	NotifyFilterDrops // if set, FilterDrop events are sent for flows dropped by the packet filter; see Notify.FilterDrop
+
+	NotifySSHSessions // if set, SSHSession events are sent when Tailscale SSH sessions start and end; see Notify.SSHSession
 )
 
 // Notify is a communication from a backend (e.g. tailscaled) to a frontend
@@ -121,6 +127,26 @@ type Notify struct {
 	// is available.
 	ClientVersion *tailcfg.ClientVersion `json:",omitempty"`
 
+	// ExitNodeFailover, if non-nil, describes an automatic change of
+	// exit node made per Prefs.ExitNodeFailover. It's sent along with
+	// the new Prefs.
+	ExitNodeFailover *ExitNodeFailover `json:",omitempty"`
+
+	// FilterDrop, if non-nil, describes a flow dropped by the packet
+	// filter. It's only sent, rate limited, to watchers that set
+	// NotifyFilterDrops.
+	FilterDrop *filter.DropEvent `json:",omitempty"`
+
+	// SSHSession, if non-nil, describes a Tailscale SSH session that
+	// started or ended. It's only sent to watchers that set
+	// NotifySSHSessions.
+	SSHSession *SSHSession `json:",omitempty"`
+
+	// KeyExpiring, if non-nil, is when the node key expires. It's sent
+	// once per expiry time, as per the KeyExpirationNotice system policy,
+	// ahead of it, so that UIs can warn the user to log in again.
+	KeyExpiring *time.Time `json:",omitempty"`
+
 	// type is mirrored in xcode/Shared/IPN.swift
 }
 
@@ -160,10 +186,72 @@ func (n Notify) String() string {
 	if n.LocalTCPPort != nil {
 		fmt.Fprintf(&sb, "tcpport=%v ", n.LocalTCPPort)
 	}
+	if n.ExitNodeFailover != nil {
+		fmt.Fprintf(&sb, "exitfailover=%v->%v ", n.ExitNodeFailover.From, n.ExitNodeFailover.To)
+	}
+	if n.FilterDrop != nil {
+		fmt.Fprintf(&sb, "filterdrop=%v ", n.FilterDrop)
+	}
+	if n.SSHSession != nil {
+		fmt.Fprintf(&sb, "sshsession=%v ", n.SSHSession)
+	}
+	if n.KeyExpiring != nil {
+		fmt.Fprintf(&sb, "keyexpiring=%v ", n.KeyExpiring.Format(time.RFC3339))
+	}
 	s := sb.String()
 	return s[0:len(s)-1] + "}"
 }
 
+// ExitNodeFailover describes an automatic change of exit node, made
+// because the exit node went offline or a more preferred one in
+// Prefs.ExitNodeFailover came back online.
+type ExitNodeFailover struct {
+	From tailcfg.StableNodeID // the previous exit node, if any
+	To   tailcfg.StableNodeID // the new exit node
+
+	// Restored is whether To is the most preferred exit node, the first
+	// in Prefs.ExitNodeFailover, after it recovered.
+	Restored bool `json:",omitempty"`
+}
+
+// SSHSession describes a session of the Tailscale SSH server, for auditing.
+type SSHSession struct {
+	// ID identifies the session. It's the same ID that the session's
+	// recordings and the control server use.
+	ID string
+
+	Src       netip.AddrPort       // the Tailscale IP and port the session came from
+	SrcNodeID tailcfg.StableNodeID // the node the session came from
+	SrcNode   string               // the FQDN of the node the session came from
+	SrcUser   string               // the login name of the Tailscale user the session came from
+	LocalUser string               // the local user the session runs as
+
+	// Command is the command the session runs, or empty for a login
+	// shell. Sessions of the SFTP subsystem have the command "sftp".
+	Command string `json:",omitempty"`
+
+	Start time.Time // when the session's process started
+
+	// End is when the session's process exited, or the zero time if it's
+	// still running.
+	End time.Time
+
+	// ExitCode is the exit code of the session's process. It's only
+	// meaningful once End is set.
+	ExitCode int
+}
+
+func (s *SSHSession) String() string {
+	str := fmt.Sprintf("%s %s@%s->%s", s.ID, s.SrcUser, s.SrcNode, s.LocalUser)
+	if s.Command != "" {
+		str += fmt.Sprintf(" %q", s.Command)
+	}
+	if s.End.IsZero() {
+		return str + " started"
+	}
+	return fmt.Sprintf("%s ended after %v with code %d", str, s.End.Sub(s.Start).Round(time.Second), s.ExitCode)
+}
+
 // PartialFile represents an in-progress file transfer.
 type PartialFile struct {
 	Name         string    // e.g. "foo.jpg"
@@ -0,0 +1,121 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipn
+
+import (
+	"fmt"
+	"net/netip"
+
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/opt"
+	"tailscale.com/types/preftype"
+)
+
+// ConfigVAlpha is the config file format for the "alpha0" version.
+//
+// It declares the preferences tailscaled should have, as an alternative
+// to setting them with "tailscale up" or "tailscale set". Fields that are
+// unset leave the corresponding preference alone.
+type ConfigVAlpha struct {
+	Version string // "alpha0" for now
+
+	ServerURL *string  `json:",omitempty"` // defaults to https://controlplane.tailscale.com
+	AuthKey   *string  `json:",omitempty"` // used if NeedsLogin; either a key or, if prefixed with "file:", the path of a file containing one
+	Enabled   opt.Bool `json:",omitempty"` // WantRunning; defaults to true
+
+	OperatorUser *string `json:",omitempty"` // local user name who is allowed to operate tailscaled without being root or using sudo
+	Hostname     *string `json:",omitempty"`
+
+	AcceptDNS    opt.Bool `json:",omitempty"` // --accept-dns
+	AcceptRoutes opt.Bool `json:",omitempty"` // --accept-routes
+
+	ExitNode                   *string  `json:",omitempty"` // IP or StableNodeID; empty string to not use one
+	AllowLANWhileUsingExitNode opt.Bool `json:",omitempty"`
+
+	AdvertiseRoutes []netip.Prefix `json:",omitempty"`
+	DisableSNAT     opt.Bool       `json:",omitempty"`
+
+	NetfilterMode *string `json:",omitempty"` // "on", "off", "nodivert"
+
+	RunSSHServer opt.Bool `json:",omitempty"` // Tailscale SSH
+	ShieldsUp    opt.Bool `json:",omitempty"`
+
+	// ServeConfig, if non-nil, replaces the serve config once the node
+	// is connected.
+	ServeConfig *ServeConfig `json:",omitempty"`
+}
+
+// ToPrefs returns the preferences that c sets.
+func (c *ConfigVAlpha) ToPrefs() (MaskedPrefs, error) {
+	var mp MaskedPrefs
+	if c == nil {
+		return mp, nil
+	}
+	mp.WantRunning = !c.Enabled.EqualBool(false)
+	mp.WantRunningSet = true
+
+	if c.ServerURL != nil {
+		mp.ControlURL = *c.ServerURL
+		mp.ControlURLSet = true
+	}
+	if c.OperatorUser != nil {
+		mp.OperatorUser = *c.OperatorUser
+		mp.OperatorUserSet = true
+	}
+	if c.Hostname != nil {
+		mp.Hostname = *c.Hostname
+		mp.HostnameSet = true
+	}
+	if v, ok := c.AcceptDNS.Get(); ok {
+		mp.CorpDNS = v
+		mp.CorpDNSSet = true
+	}
+	if v, ok := c.AcceptRoutes.Get(); ok {
+		mp.RouteAll = v
+		mp.RouteAllSet = true
+	}
+	if c.ExitNode != nil {
+		if ip, err := netip.ParseAddr(*c.ExitNode); err == nil {
+			mp.ExitNodeIP = ip
+		} else {
+			mp.ExitNodeID = tailcfg.StableNodeID(*c.ExitNode)
+		}
+		mp.ExitNodeIPSet = true
+		mp.ExitNodeIDSet = true
+	}
+	if v, ok := c.AllowLANWhileUsingExitNode.Get(); ok {
+		mp.ExitNodeAllowLANAccess = v
+		mp.ExitNodeAllowLANAccessSet = true
+	}
+	if c.AdvertiseRoutes != nil {
+		mp.AdvertiseRoutes = c.AdvertiseRoutes
+		mp.AdvertiseRoutesSet = true
+	}
+	if v, ok := c.DisableSNAT.Get(); ok {
+		mp.NoSNAT = v
+		mp.NoSNATSet = true
+	}
+	if c.NetfilterMode != nil {
+		switch *c.NetfilterMode {
+		case "on":
+			mp.NetfilterMode = preftype.NetfilterOn
+		case "nodivert":
+			mp.NetfilterMode = preftype.NetfilterNoDivert
+		case "off":
+			mp.NetfilterMode = preftype.NetfilterOff
+		default:
+			return MaskedPrefs{}, fmt.Errorf("invalid NetfilterMode %q", *c.NetfilterMode)
+		}
+		mp.NetfilterModeSet = true
+	}
+	if v, ok := c.RunSSHServer.Get(); ok {
+		mp.RunSSH = v
+		mp.RunSSHSet = true
+	}
+	if v, ok := c.ShieldsUp.Get(); ok {
+		mp.ShieldsUp = v
+		mp.ShieldsUpSet = true
+	}
+	return mp, nil
+}
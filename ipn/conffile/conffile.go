@@ -0,0 +1,118 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+// Package conffile contains code to load, manipulate, and access config file
+// settings for tailscaled.
+package conffile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tailscale/hujson"
+	"sigs.k8s.io/yaml"
+	"tailscale.com/ipn"
+)
+
+// Config describes a config file.
+type Config struct {
+	Path    string // disk path of HuJSON or YAML
+	Raw     []byte // raw bytes from disk
+	Std     []byte // standardized JSON form
+	Version string // "alpha0" for now
+
+	// Parsed is the parsed preferences and serve config.
+	Parsed ipn.ConfigVAlpha
+
+	// Daemon is the parsed daemon options.
+	Daemon DaemonConfig
+}
+
+// DaemonConfig is the part of a config file with tailscaled's own options,
+// which can otherwise only be set with flags. Unlike the preferences, they
+// only take effect when tailscaled starts.
+type DaemonConfig struct {
+	Port     *uint16 `json:",omitempty"` // --port
+	State    *string `json:",omitempty"` // --state
+	StateDir *string `json:",omitempty"` // --statedir
+	Tun      *string `json:",omitempty"` // --tun
+	Socket   *string `json:",omitempty"` // --socket
+}
+
+// AuthKey returns the auth key of c, reading it from disk if it's of the
+// form "file:/path/to/key". It returns the empty string if c has no auth
+// key.
+func (c *Config) AuthKey() (string, error) {
+	if c.Parsed.AuthKey == nil {
+		return "", nil
+	}
+	v := *c.Parsed.AuthKey
+	if file, ok := strings.CutPrefix(v, "file:"); ok {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("reading auth key: %w", err)
+		}
+		return strings.TrimSpace(string(b)), nil
+	}
+	return v, nil
+}
+
+// Load reads and parses the config file at the provided path on disk.
+//
+// Files ending in ".yaml" or ".yml" are YAML; all others are HuJSON
+// (JSON with comments and trailing commas).
+func Load(path string) (*Config, error) {
+	var c Config
+	c.Path = path
+
+	var err error
+	c.Raw, err = os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		c.Std, err = yaml.YAMLToJSON(c.Raw)
+	default:
+		c.Std, err = hujson.Standardize(c.Raw)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+	var ver struct {
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(c.Std, &ver); err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+	switch ver.Version {
+	case "":
+		return nil, fmt.Errorf("error parsing config file %s: no \"version\" field defined", path)
+	case "alpha0":
+	default:
+		return nil, fmt.Errorf("error parsing config file %s: unsupported \"version\" value %q; want \"alpha0\" for now", path, ver.Version)
+	}
+	c.Version = ver.Version
+
+	var file struct {
+		ipn.ConfigVAlpha
+		Daemon *DaemonConfig `json:",omitempty"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(c.Std))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&file); err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+	if _, err := file.ToPrefs(); err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+	c.Parsed = file.ConfigVAlpha
+	if file.Daemon != nil {
+		c.Daemon = *file.Daemon
+	}
+	return &c, nil
+}
@@ -0,0 +1,132 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package conffile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tailscale.com/types/preftype"
+)
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, contents string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	keyFile := write("authkey", "tskey-auth-xyz\n")
+
+	tests := []struct {
+		name, file, contents string
+		wantErr              string
+	}{
+		{
+			name: "hujson",
+			file: "tailscaled.conf",
+			contents: `{
+				// Comments and trailing commas are allowed.
+				"Version": "alpha0",
+				"AuthKey": "file:` + keyFile + `",
+				"Hostname": "web1",
+				"AcceptRoutes": true,
+				"NetfilterMode": "nodivert",
+				"Daemon": {"Port": 41641, "Tun": "userspace-networking"},
+			}`,
+		},
+		{
+			name: "yaml",
+			file: "tailscaled.yaml",
+			contents: `
+version: alpha0
+authKey: file:` + keyFile + `
+hostname: web1
+acceptRoutes: true
+netfilterMode: nodivert
+daemon:
+  port: 41641
+  tun: userspace-networking
+`,
+		},
+		{
+			name:     "no_version",
+			file:     "noversion.conf",
+			contents: `{"Hostname": "web1"}`,
+			wantErr:  `no "version" field`,
+		},
+		{
+			name:     "unknown_version",
+			file:     "future.conf",
+			contents: `{"Version": "beta9"}`,
+			wantErr:  `unsupported "version" value "beta9"`,
+		},
+		{
+			name:     "unknown_field",
+			file:     "typo.conf",
+			contents: `{"Version": "alpha0", "Hostnmae": "web1"}`,
+			wantErr:  `unknown field "Hostnmae"`,
+		},
+		{
+			name:     "bad_netfilter_mode",
+			file:     "netfilter.conf",
+			contents: `{"Version": "alpha0", "NetfilterMode": "sometimes"}`,
+			wantErr:  `invalid NetfilterMode "sometimes"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := Load(write(tt.file, tt.contents))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v; want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Version != "alpha0" {
+				t.Errorf("Version = %q; want alpha0", c.Version)
+			}
+			if key, err := c.AuthKey(); err != nil || key != "tskey-auth-xyz" {
+				t.Errorf("AuthKey = %q, %v; want tskey-auth-xyz", key, err)
+			}
+			if c.Daemon.Port == nil || *c.Daemon.Port != 41641 {
+				t.Errorf("Daemon.Port = %v; want 41641", c.Daemon.Port)
+			}
+			if c.Daemon.Tun == nil || *c.Daemon.Tun != "userspace-networking" {
+				t.Errorf("Daemon.Tun = %v; want userspace-networking", c.Daemon.Tun)
+			}
+			if c.Daemon.State != nil {
+				t.Errorf("Daemon.State = %q; want unset", *c.Daemon.State)
+			}
+
+			mp, err := c.Parsed.ToPrefs()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !mp.HostnameSet || mp.Hostname != "web1" {
+				t.Errorf("Hostname = %q (set=%v); want web1", mp.Hostname, mp.HostnameSet)
+			}
+			if !mp.RouteAllSet || !mp.RouteAll {
+				t.Errorf("RouteAll = %v (set=%v); want true", mp.RouteAll, mp.RouteAllSet)
+			}
+			if !mp.NetfilterModeSet || mp.NetfilterMode != preftype.NetfilterNoDivert {
+				t.Errorf("NetfilterMode = %v (set=%v); want nodivert", mp.NetfilterMode, mp.NetfilterModeSet)
+			}
+			if !mp.WantRunningSet || !mp.WantRunning {
+				t.Errorf("WantRunning = %v (set=%v); want true", mp.WantRunning, mp.WantRunningSet)
+			}
+			if mp.CorpDNSSet || mp.ShieldsUpSet || mp.ControlURLSet {
+				t.Errorf("unmentioned prefs are set: %+v", mp)
+			}
+		})
+	}
+}
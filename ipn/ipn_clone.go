@@ -8,6 +8,7 @@
 import (
 	"maps"
 	"net/netip"
+	"time"
 
 	"tailscale.com/tailcfg"
 	"tailscale.com/types/persist"
@@ -22,8 +23,17 @@ func (src *Prefs) Clone() *Prefs {
 	}
 	dst := new(Prefs)
 	*dst = *src
+	dst.ExitNodeFailover = append(src.ExitNodeFailover[:0:0], src.ExitNodeFailover...)
+	if dst.DNSRoutes != nil {
+		dst.DNSRoutes = map[string][]string{}
+		for k := range src.DNSRoutes {
+			dst.DNSRoutes[k] = append([]string{}, src.DNSRoutes[k]...)
+		}
+	}
 	dst.AdvertiseTags = append(src.AdvertiseTags[:0:0], src.AdvertiseTags...)
 	dst.AdvertiseRoutes = append(src.AdvertiseRoutes[:0:0], src.AdvertiseRoutes...)
+	dst.RateLimits = append(src.RateLimits[:0:0], src.RateLimits...)
+	dst.DERPExcludeRegions = append(src.DERPExcludeRegions[:0:0], src.DERPExcludeRegions...)
 	dst.Persist = src.Persist.Clone()
 	return dst
 }
@@ -36,7 +46,9 @@ func (src *Prefs) Clone() *Prefs {
 	ExitNodeID             tailcfg.StableNodeID
 	ExitNodeIP             netip.Addr
 	ExitNodeAllowLANAccess bool
+	ExitNodeFailover       []tailcfg.StableNodeID
 	CorpDNS                bool
+	DNSRoutes              map[string][]string
 	RunSSH                 bool
 	WantRunning            bool
 	LoggedOut              bool
@@ -48,10 +60,16 @@ func (src *Prefs) Clone() *Prefs {
 	Egg                    bool
 	AdvertiseRoutes        []netip.Prefix
 	NoSNAT                 bool
+	RateLimits             []RateLimit
+	DNSMode                string
+	DERPHomeRegion         int
+	DERPExcludeRegions     []int
 	NetfilterMode          preftype.NetfilterMode
 	OperatorUser           string
 	ProfileName            string
 	AutoUpdate             AutoUpdatePrefs
+	TaildropAutoAccept     TaildropAutoAcceptPrefs
+	PostureChecking        bool
 	Persist                *persist.Persist
 }{})
 
@@ -76,6 +94,7 @@ func (src *ServeConfig) Clone() *ServeConfig {
 		}
 	}
 	dst.AllowFunnel = maps.Clone(src.AllowFunnel)
+	dst.FunnelExpiry = maps.Clone(src.FunnelExpiry)
 	if dst.Foreground != nil {
 		dst.Foreground = map[string]*ServeConfig{}
 		for k, v := range src.Foreground {
@@ -87,11 +106,12 @@ func (src *ServeConfig) Clone() *ServeConfig {
 
 // A compilation failure here means this code must be regenerated, with the command at the top of this file.
 var _ServeConfigCloneNeedsRegeneration = ServeConfig(struct {
-	TCP         map[uint16]*TCPPortHandler
-	Web         map[HostPort]*WebServerConfig
-	AllowFunnel map[HostPort]bool
-	Foreground  map[string]*ServeConfig
-	ETag        string
+	TCP          map[uint16]*TCPPortHandler
+	Web          map[HostPort]*WebServerConfig
+	AllowFunnel  map[HostPort]bool
+	FunnelExpiry map[HostPort]time.Time
+	Foreground   map[string]*ServeConfig
+	ETag         string
 }{})
 
 // Clone makes a deep copy of TCPPortHandler.
@@ -126,9 +146,15 @@ func (src *HTTPHandler) Clone() *HTTPHandler {
 
 // A compilation failure here means this code must be regenerated, with the command at the top of this file.
 var _HTTPHandlerCloneNeedsRegeneration = HTTPHandler(struct {
-	Path  string
-	Proxy string
-	Text  string
+	Path            string
+	Proxy           string
+	Text            string
+	Redirect        string
+	StatusCode      int
+	ContentType     string
+	BackendProtocol string
+	TailnetOnly     bool
+	BasicAuth       string
 }{})
 
 // Clone makes a deep copy of WebServerConfig.
@@ -9,6 +9,7 @@
 	"encoding/json"
 	"errors"
 	"net/netip"
+	"time"
 
 	"tailscale.com/tailcfg"
 	"tailscale.com/types/persist"
@@ -63,13 +64,21 @@ func (v *PrefsView) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
-func (v PrefsView) ControlURL() string                 { return v.ж.ControlURL }
-func (v PrefsView) RouteAll() bool                     { return v.ж.RouteAll }
-func (v PrefsView) AllowSingleHosts() bool             { return v.ж.AllowSingleHosts }
-func (v PrefsView) ExitNodeID() tailcfg.StableNodeID   { return v.ж.ExitNodeID }
-func (v PrefsView) ExitNodeIP() netip.Addr             { return v.ж.ExitNodeIP }
-func (v PrefsView) ExitNodeAllowLANAccess() bool       { return v.ж.ExitNodeAllowLANAccess }
-func (v PrefsView) CorpDNS() bool                      { return v.ж.CorpDNS }
+func (v PrefsView) ControlURL() string               { return v.ж.ControlURL }
+func (v PrefsView) RouteAll() bool                   { return v.ж.RouteAll }
+func (v PrefsView) AllowSingleHosts() bool           { return v.ж.AllowSingleHosts }
+func (v PrefsView) ExitNodeID() tailcfg.StableNodeID { return v.ж.ExitNodeID }
+func (v PrefsView) ExitNodeIP() netip.Addr           { return v.ж.ExitNodeIP }
+func (v PrefsView) ExitNodeAllowLANAccess() bool     { return v.ж.ExitNodeAllowLANAccess }
+func (v PrefsView) ExitNodeFailover() views.Slice[tailcfg.StableNodeID] {
+	return views.SliceOf(v.ж.ExitNodeFailover)
+}
+func (v PrefsView) CorpDNS() bool { return v.ж.CorpDNS }
+func (v PrefsView) DNSRoutes() views.MapFn[string, []string, views.Slice[string]] {
+	return views.MapFnOf(v.ж.DNSRoutes, func(t []string) views.Slice[string] {
+		return views.SliceOf(t)
+	})
+}
 func (v PrefsView) RunSSH() bool                       { return v.ж.RunSSH }
 func (v PrefsView) WantRunning() bool                  { return v.ж.WantRunning }
 func (v PrefsView) LoggedOut() bool                    { return v.ж.LoggedOut }
@@ -82,12 +91,20 @@ func (v PrefsView) Egg() bool                          { return v.ж.Egg }
 func (v PrefsView) AdvertiseRoutes() views.Slice[netip.Prefix] {
 	return views.SliceOf(v.ж.AdvertiseRoutes)
 }
-func (v PrefsView) NoSNAT() bool                          { return v.ж.NoSNAT }
-func (v PrefsView) NetfilterMode() preftype.NetfilterMode { return v.ж.NetfilterMode }
-func (v PrefsView) OperatorUser() string                  { return v.ж.OperatorUser }
-func (v PrefsView) ProfileName() string                   { return v.ж.ProfileName }
-func (v PrefsView) AutoUpdate() AutoUpdatePrefs           { return v.ж.AutoUpdate }
-func (v PrefsView) Persist() persist.PersistView          { return v.ж.Persist.View() }
+func (v PrefsView) NoSNAT() bool                       { return v.ж.NoSNAT }
+func (v PrefsView) RateLimits() views.Slice[RateLimit] { return views.SliceOf(v.ж.RateLimits) }
+func (v PrefsView) DNSMode() string                    { return v.ж.DNSMode }
+func (v PrefsView) DERPHomeRegion() int                { return v.ж.DERPHomeRegion }
+func (v PrefsView) DERPExcludeRegions() views.Slice[int] {
+	return views.SliceOf(v.ж.DERPExcludeRegions)
+}
+func (v PrefsView) NetfilterMode() preftype.NetfilterMode       { return v.ж.NetfilterMode }
+func (v PrefsView) OperatorUser() string                        { return v.ж.OperatorUser }
+func (v PrefsView) ProfileName() string                         { return v.ж.ProfileName }
+func (v PrefsView) AutoUpdate() AutoUpdatePrefs                 { return v.ж.AutoUpdate }
+func (v PrefsView) TaildropAutoAccept() TaildropAutoAcceptPrefs { return v.ж.TaildropAutoAccept }
+func (v PrefsView) PostureChecking() bool                       { return v.ж.PostureChecking }
+func (v PrefsView) Persist() persist.PersistView                { return v.ж.Persist.View() }
 
 // A compilation failure here means this code must be regenerated, with the command at the top of this file.
 var _PrefsViewNeedsRegeneration = Prefs(struct {
@@ -97,7 +114,9 @@ func (v PrefsView) Persist() persist.PersistView          { return v.ж.Persist.
 	ExitNodeID             tailcfg.StableNodeID
 	ExitNodeIP             netip.Addr
 	ExitNodeAllowLANAccess bool
+	ExitNodeFailover       []tailcfg.StableNodeID
 	CorpDNS                bool
+	DNSRoutes              map[string][]string
 	RunSSH                 bool
 	WantRunning            bool
 	LoggedOut              bool
@@ -109,10 +128,16 @@ func (v PrefsView) Persist() persist.PersistView          { return v.ж.Persist.
 	Egg                    bool
 	AdvertiseRoutes        []netip.Prefix
 	NoSNAT                 bool
+	RateLimits             []RateLimit
+	DNSMode                string
+	DERPHomeRegion         int
+	DERPExcludeRegions     []int
 	NetfilterMode          preftype.NetfilterMode
 	OperatorUser           string
 	ProfileName            string
 	AutoUpdate             AutoUpdatePrefs
+	TaildropAutoAccept     TaildropAutoAcceptPrefs
+	PostureChecking        bool
 	Persist                *persist.Persist
 }{})
 
@@ -177,6 +202,10 @@ func (v ServeConfigView) AllowFunnel() views.Map[HostPort, bool] {
 	return views.MapOf(v.ж.AllowFunnel)
 }
 
+func (v ServeConfigView) FunnelExpiry() views.Map[HostPort, time.Time] {
+	return views.MapOf(v.ж.FunnelExpiry)
+}
+
 func (v ServeConfigView) Foreground() views.MapFn[string, *ServeConfig, ServeConfigView] {
 	return views.MapFnOf(v.ж.Foreground, func(t *ServeConfig) ServeConfigView {
 		return t.View()
@@ -186,11 +215,12 @@ func (v ServeConfigView) ETag() string { return v.ж.ETag }
 
 // A compilation failure here means this code must be regenerated, with the command at the top of this file.
 var _ServeConfigViewNeedsRegeneration = ServeConfig(struct {
-	TCP         map[uint16]*TCPPortHandler
-	Web         map[HostPort]*WebServerConfig
-	AllowFunnel map[HostPort]bool
-	Foreground  map[string]*ServeConfig
-	ETag        string
+	TCP          map[uint16]*TCPPortHandler
+	Web          map[HostPort]*WebServerConfig
+	AllowFunnel  map[HostPort]bool
+	FunnelExpiry map[HostPort]time.Time
+	Foreground   map[string]*ServeConfig
+	ETag         string
 }{})
 
 // View returns a readonly view of TCPPortHandler.
@@ -296,15 +326,27 @@ func (v *HTTPHandlerView) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
-func (v HTTPHandlerView) Path() string  { return v.ж.Path }
-func (v HTTPHandlerView) Proxy() string { return v.ж.Proxy }
-func (v HTTPHandlerView) Text() string  { return v.ж.Text }
+func (v HTTPHandlerView) Path() string            { return v.ж.Path }
+func (v HTTPHandlerView) Proxy() string           { return v.ж.Proxy }
+func (v HTTPHandlerView) Text() string            { return v.ж.Text }
+func (v HTTPHandlerView) Redirect() string        { return v.ж.Redirect }
+func (v HTTPHandlerView) StatusCode() int         { return v.ж.StatusCode }
+func (v HTTPHandlerView) ContentType() string     { return v.ж.ContentType }
+func (v HTTPHandlerView) BackendProtocol() string { return v.ж.BackendProtocol }
+func (v HTTPHandlerView) TailnetOnly() bool       { return v.ж.TailnetOnly }
+func (v HTTPHandlerView) BasicAuth() string       { return v.ж.BasicAuth }
 
 // A compilation failure here means this code must be regenerated, with the command at the top of this file.
 var _HTTPHandlerViewNeedsRegeneration = HTTPHandler(struct {
-	Path  string
-	Proxy string
-	Text  string
+	Path            string
+	Proxy           string
+	Text            string
+	Redirect        string
+	StatusCode      int
+	ContentType     string
+	BackendProtocol string
+	TailnetOnly     bool
+	BasicAuth       string
 }{})
 
 // View returns a readonly view of WebServerConfig.
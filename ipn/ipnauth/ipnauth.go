@@ -11,7 +11,9 @@
 	"os"
 	"os/user"
 	"runtime"
+	"slices"
 	"strconv"
+	"strings"
 
 	"inet.af/peercred"
 	"tailscale.com/envknob"
@@ -65,6 +67,34 @@ func (ci *ConnIdentity) WindowsUserID() ipn.WindowsUserID {
 	return ""
 }
 
+// String returns a description of the owner of the connection for logging,
+// such as "uid=1000 pid=1234" or, on Windows, "sid=S-1-5-21-... pid=1234".
+// Unknown parts are omitted; if nothing is known, it returns "unknown".
+func (ci *ConnIdentity) String() string {
+	var parts []string
+	if ci.notWindows {
+		if ci.creds != nil {
+			if uid, ok := ci.creds.UserID(); ok {
+				parts = append(parts, "uid="+uid)
+			}
+			if pid, ok := ci.creds.PID(); ok {
+				parts = append(parts, "pid="+strconv.Itoa(pid))
+			}
+		}
+	} else {
+		if ci.userID != "" {
+			parts = append(parts, "sid="+string(ci.userID))
+		}
+		if ci.pid != 0 {
+			parts = append(parts, "pid="+strconv.Itoa(ci.pid))
+		}
+	}
+	if len(parts) == 0 {
+		return "unknown"
+	}
+	return strings.Join(parts, " ")
+}
+
 func (ci *ConnIdentity) User() *user.User       { return ci.user }
 func (ci *ConnIdentity) Pid() int               { return ci.pid }
 func (ci *ConnIdentity) IsUnixSock() bool       { return ci.isUnixSock }
@@ -160,6 +190,30 @@ func (ci *ConnIdentity) IsReadonlyConn(operatorUID string, logf logger.Logf) boo
 	return ro
 }
 
+// IsLocalAdmin reports whether the user at the other end of the connection
+// is a member of the system's administrators group. On Windows, that's the
+// BUILTIN\Administrators group, whether or not the connecting process is
+// elevated.
+func (ci *ConnIdentity) IsLocalAdmin() (bool, error) {
+	if !ci.notWindows {
+		if ci.userID == "" {
+			return false, fmt.Errorf("connection from unknown user")
+		}
+		return isLocalAdmin(string(ci.userID))
+	}
+	if ci.creds == nil {
+		return false, fmt.Errorf("connection from unknown peer")
+	}
+	uid, ok := ci.creds.UserID()
+	if !ok {
+		return false, fmt.Errorf("connection from peer with unknown userid")
+	}
+	return isLocalAdmin(uid)
+}
+
+// windowsAdminsSID is the well-known SID of the BUILTIN\Administrators group.
+const windowsAdminsSID = "S-1-5-32-544"
+
 func isLocalAdmin(uid string) (bool, error) {
 	u, err := user.LookupId(uid)
 	if err != nil {
@@ -167,6 +221,12 @@ func isLocalAdmin(uid string) (bool, error) {
 	}
 	var adminGroup string
 	switch {
+	case runtime.GOOS == "windows":
+		gids, err := u.GroupIds()
+		if err != nil {
+			return false, err
+		}
+		return slices.Contains(gids, windowsAdminsSID), nil
 	case runtime.GOOS == "darwin":
 		adminGroup = "admin"
 	case distro.Get() == distro.QNAP:
@@ -9,6 +9,7 @@
 	"net"
 
 	"inet.af/peercred"
+	"tailscale.com/safesocket"
 	"tailscale.com/types/logger"
 )
 
@@ -17,7 +18,8 @@
 // and couldn't. The returned connIdentity has NotWindows set to true.
 func GetConnIdentity(_ logger.Logf, c net.Conn) (ci *ConnIdentity, err error) {
 	ci = &ConnIdentity{conn: c, notWindows: true}
-	_, ci.isUnixSock = c.(*net.UnixConn)
-	ci.creds, _ = peercred.Get(c)
+	uc := safesocket.UnderlyingConn(c)
+	_, ci.isUnixSock = uc.(*net.UnixConn)
+	ci.creds, _ = peercred.Get(uc)
 	return ci, nil
 }
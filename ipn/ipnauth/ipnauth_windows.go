@@ -11,6 +11,7 @@
 
 	"golang.org/x/sys/windows"
 	"tailscale.com/ipn"
+	"tailscale.com/safesocket"
 	"tailscale.com/types/logger"
 	"tailscale.com/util/pidowner"
 )
@@ -33,7 +34,7 @@ func getNamedPipeClientProcessId(h windows.Handle) (pid uint32, err error) {
 // If c is not backed by a named pipe, an error is returned.
 func GetConnIdentity(logf logger.Logf, c net.Conn) (ci *ConnIdentity, err error) {
 	ci = &ConnIdentity{conn: c}
-	h, ok := c.(interface {
+	h, ok := safesocket.UnderlyingConn(c).(interface {
 		Fd() uintptr
 	})
 	if !ok {
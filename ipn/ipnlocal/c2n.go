@@ -190,7 +190,11 @@ func (b *LocalBackend) handleC2NUpdatePost(w http.ResponseWriter, r *http.Reques
 	cmd.Stdout = buf
 	cmd.Stderr = buf
 	b.logf("c2n: running %q", strings.Join(cmd.Args, " "))
+	// Record the update before it starts, as it may restart tailscaled,
+	// for the updated one to confirm or roll back. See initUpdateState.
+	b.setAutoUpdateStarted(true)
 	if err := cmd.Start(); err != nil {
+		b.setAutoUpdateStarted(false)
 		res.Err = fmt.Sprintf("failed to start cmd/tailscale update: %v", err)
 		return
 	}
@@ -199,6 +203,7 @@ func (b *LocalBackend) handleC2NUpdatePost(w http.ResponseWriter, r *http.Reques
 	// Run update asynchronously and respond that it started.
 	go func() {
 		if err := cmd.Wait(); err != nil {
+			b.setAutoUpdateStarted(false)
 			b.logf("c2n: update command failed: %v, output: %s", err, buf)
 		} else {
 			b.logf("c2n: update complete")
@@ -0,0 +1,109 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"encoding/json"
+	"slices"
+	"sync"
+
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/netmap"
+	"tailscale.com/util/mak"
+)
+
+// CapFeatureFunc is called when the node capability that a local feature was
+// registered for with RegisterCapFeature is granted to, changed for, or
+// revoked from the self node of b.
+//
+// enabled reports whether the self node has the capability, and args are its
+// values from the node's CapMap, which are nil if it has none or enabled is
+// false. args must not be modified.
+//
+// It's called with b's mutex held, so it must not block or call methods of
+// b; like the built-in capability toggles, it should only flip the state of
+// the feature it controls.
+type CapFeatureFunc func(b *LocalBackend, enabled bool, args []tailcfg.RawMessage)
+
+var (
+	capFeaturesMu sync.Mutex
+	capFeatures   map[tailcfg.NodeCapability][]CapFeatureFunc
+)
+
+// RegisterCapFeature registers fn to be called whenever the capability cap of
+// the self node changes, so that a local feature (such as serving metrics,
+// permitting Funnel or accepting files) can be configured centrally by the
+// tailnet's ACLs rather than on each machine.
+//
+// It's meant to be called from init funcs of packages that provide such
+// features. Several funcs may be registered for the same capability; they're
+// called in registration order. Registering a func after a LocalBackend has
+// started is racy: it's only called once the capability next changes.
+func RegisterCapFeature(cap tailcfg.NodeCapability, fn CapFeatureFunc) {
+	if cap == "" || fn == nil {
+		panic("ipnlocal: invalid RegisterCapFeature call")
+	}
+	capFeaturesMu.Lock()
+	defer capFeaturesMu.Unlock()
+	mak.Set(&capFeatures, cap, append(capFeatures[cap], fn))
+}
+
+func init() {
+	RegisterCapFeature(tailcfg.NodeAttrServeMetrics, func(b *LocalBackend, enabled bool, _ []tailcfg.RawMessage) {
+		b.capServeMetrics = enabled
+	})
+	RegisterCapFeature(tailcfg.NodeAttrFunnelPaused, func(b *LocalBackend, enabled bool, _ []tailcfg.RawMessage) {
+		if enabled {
+			b.logf("Funnel paused by the tailnet's ACLs")
+		} else if b.funnelPaused {
+			b.logf("Funnel resumed by the tailnet's ACLs")
+		}
+		b.funnelPaused = enabled
+	})
+	RegisterCapFeature(tailcfg.NodeAttrTaildropAutoAccept, func(b *LocalBackend, enabled bool, args []tailcfg.RawMessage) {
+		b.taildropAutoAcceptTags = nil
+		for _, a := range args {
+			var v struct {
+				Tags []string `json:"tags"`
+			}
+			if err := json.Unmarshal([]byte(a), &v); err != nil {
+				b.logf("ignoring invalid %s value %s: %v", tailcfg.NodeAttrTaildropAutoAccept, a, err)
+				continue
+			}
+			b.taildropAutoAcceptTags = append(b.taildropAutoAcceptTags, v.Tags...)
+		}
+	})
+}
+
+// updateCapFeaturesLocked calls the funcs registered with RegisterCapFeature
+// whose capabilities changed in nm, compared to the previous netmap. A nil nm
+// revokes all capabilities.
+//
+// b.mu must be held.
+func (b *LocalBackend) updateCapFeaturesLocked(nm *netmap.NetworkMap) {
+	capFeaturesMu.Lock()
+	defer capFeaturesMu.Unlock()
+	for cap, fns := range capFeatures {
+		var args []tailcfg.RawMessage
+		var enabled bool
+		if nm != nil && nm.SelfNode.Valid() {
+			if vals, ok := nm.SelfNode.CapMap().GetOk(cap); ok {
+				enabled = true
+				args = vals.AsSlice()
+			}
+		}
+		old, wasEnabled := b.capFeatureArgs[cap]
+		if enabled == wasEnabled && slices.Equal(args, old) {
+			continue
+		}
+		if enabled {
+			mak.Set(&b.capFeatureArgs, cap, args)
+		} else {
+			delete(b.capFeatureArgs, cap)
+		}
+		for _, fn := range fns {
+			fn(b, enabled, args)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"reflect"
+	"testing"
+
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/netmap"
+)
+
+func TestCapFeatures(t *testing.T) {
+	const cap tailcfg.NodeCapability = "https://tailscale.com/cap/test-cap-feature"
+	var calls []string
+	RegisterCapFeature(cap, func(b *LocalBackend, enabled bool, args []tailcfg.RawMessage) {
+		calls = append(calls, fmt.Sprintf("%v %v", enabled, args))
+	})
+
+	nmWithCaps := func(cm tailcfg.NodeCapMap) *netmap.NetworkMap {
+		return &netmap.NetworkMap{
+			SelfNode: (&tailcfg.Node{CapMap: cm}).View(),
+		}
+	}
+	b := &LocalBackend{}
+	steps := []struct {
+		name string
+		nm   *netmap.NetworkMap
+		want []string
+	}{
+		{"no-netmap", nil, nil},
+		{"not-granted", nmWithCaps(tailcfg.NodeCapMap{"other": nil}), nil},
+		{"granted", nmWithCaps(tailcfg.NodeCapMap{cap: nil}), []string{"true []"}},
+		{"unchanged", nmWithCaps(tailcfg.NodeCapMap{cap: nil}), nil},
+		{"args", nmWithCaps(tailcfg.NodeCapMap{cap: {`{"port":9100}`}}), []string{`true [{"port":9100}]`}},
+		{"same-args", nmWithCaps(tailcfg.NodeCapMap{cap: {`{"port":9100}`}}), nil},
+		{"revoked", nmWithCaps(nil), []string{"false []"}},
+		{"regranted", nmWithCaps(tailcfg.NodeCapMap{cap: nil}), []string{"true []"}},
+		{"logged-out", nil, []string{"false []"}},
+	}
+	for _, s := range steps {
+		calls = nil
+		b.updateCapFeaturesLocked(s.nm)
+		if !reflect.DeepEqual(calls, s.want) {
+			t.Errorf("%s: calls = %q, want %q", s.name, calls, s.want)
+		}
+	}
+}
+
+func TestBuiltinCapFeatures(t *testing.T) {
+	b := &LocalBackend{logf: t.Logf}
+	b.updateCapFeaturesLocked(&netmap.NetworkMap{
+		SelfNode: (&tailcfg.Node{CapMap: tailcfg.NodeCapMap{
+			tailcfg.NodeAttrServeMetrics: nil,
+			tailcfg.NodeAttrFunnelPaused: nil,
+			tailcfg.NodeAttrTaildropAutoAccept: {
+				`{"tags":["tag:ci"]}`,
+				`not json`,
+				`{"tags":["tag:build"]}`,
+			},
+		}}).View(),
+	})
+	if !b.capServeMetrics {
+		t.Error("capServeMetrics = false; want true")
+	}
+	if !b.funnelPaused {
+		t.Error("funnelPaused = false; want true")
+	}
+	if got, want := b.taildropAutoAcceptTags, []string{"tag:ci", "tag:build"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("taildropAutoAcceptTags = %q; want %q", got, want)
+	}
+
+	var reset bool
+	b.HandleIngressTCPConn(tailcfg.NodeView{}, "foo.ts.net:443", netip.MustParseAddrPort("1.2.3.4:5678"), func() (net.Conn, bool) {
+		t.Fatal("paused Funnel connection accepted")
+		return nil, false
+	}, func() { reset = true })
+	if !reset {
+		t.Error("paused Funnel connection not reset")
+	}
+
+	b.updateCapFeaturesLocked(&netmap.NetworkMap{SelfNode: (&tailcfg.Node{}).View()})
+	if b.capServeMetrics || b.funnelPaused || b.taildropAutoAcceptTags != nil {
+		t.Errorf("revoked features still on: metrics=%v funnelPaused=%v tags=%q", b.capServeMetrics, b.funnelPaused, b.taildropAutoAcceptTags)
+	}
+}
@@ -6,6 +6,8 @@
 import (
 	"context"
 	"errors"
+
+	"tailscale.com/ipn"
 )
 
 type TLSCertKeyPair struct {
@@ -15,3 +17,11 @@ type TLSCertKeyPair struct {
 func (b *LocalBackend) GetCertPEM(ctx context.Context, domain string, syncRenewal bool) (*TLSCertKeyPair, error) {
 	return nil, errors.New("not implemented for js/wasm")
 }
+
+type certPrefetcher struct{}
+
+func (p *certPrefetcher) close() {}
+
+func (b *LocalBackend) updateServeCertsLocked() {}
+
+func (b *LocalBackend) ServeCertStatus() []ipn.ServeCertStatus { return nil }
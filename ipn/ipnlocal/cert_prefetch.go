@@ -0,0 +1,238 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !js
+
+package ipnlocal
+
+import (
+	"cmp"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"tailscale.com/envknob"
+	"tailscale.com/ipn"
+	"tailscale.com/tstime"
+	"tailscale.com/util/mak"
+	"tailscale.com/util/testenv"
+)
+
+var disableCertPrefetch = envknob.RegisterBool("TS_DEBUG_DISABLE_CERT_PREFETCH")
+
+const (
+	// certPrefetchRetry is how long certPrefetcher waits to try again
+	// after failing to get a certificate.
+	certPrefetchRetry = 5 * time.Minute
+
+	// certPrefetchCheck is the longest certPrefetcher waits between
+	// checks of whether a certificate needs renewal.
+	certPrefetchCheck = 12 * time.Hour
+)
+
+// certPrefetcher gets the TLS certificates of the hosts that serve and funnel
+// handle HTTPS or TLS for as soon as they're configured, and renews them
+// before they expire, so that connections don't wait for ACME.
+type certPrefetcher struct {
+	b *LocalBackend
+
+	// getCert gets the certificate of domain, renewing it if it's due.
+	getCert func(ctx context.Context, domain string) (*TLSCertKeyPair, error)
+
+	mu      sync.Mutex
+	closed  bool
+	domains map[string]*prefetchDomain
+}
+
+// prefetchDomain is a domain that certPrefetcher keeps a certificate for.
+type prefetchDomain struct {
+	status ipn.ServeCertStatus
+	timer  tstime.TimerController // to next get its certificate
+}
+
+func newCertPrefetcher(b *LocalBackend) *certPrefetcher {
+	return &certPrefetcher{
+		b: b,
+		getCert: func(ctx context.Context, domain string) (*TLSCertKeyPair, error) {
+			return b.GetCertPEM(ctx, domain, true)
+		},
+	}
+}
+
+// setDomains sets the domains that p keeps certificates for, getting those of
+// new domains right away.
+func (p *certPrefetcher) setDomains(domains []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	for d, pd := range p.domains {
+		if !slices.Contains(domains, d) {
+			pd.timer.Stop()
+			delete(p.domains, d)
+		}
+	}
+	for _, d := range domains {
+		if _, ok := p.domains[d]; ok {
+			continue
+		}
+		d := d
+		pd := &prefetchDomain{status: ipn.ServeCertStatus{Domain: d}}
+		pd.timer = p.b.clock.AfterFunc(0, func() { p.fetch(d, pd) })
+		mak.Set(&p.domains, d, pd)
+	}
+}
+
+// fetch gets the certificate of domain, records the outcome in pd, and
+// schedules the next fetch.
+func (p *certPrefetcher) fetch(domain string, pd *prefetchDomain) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	pair, err := p.getCert(ctx, domain)
+	now := p.b.clock.Now()
+
+	st := ipn.ServeCertStatus{Domain: domain, LastAttempt: now}
+	next := certPrefetchRetry
+	if err != nil {
+		p.b.logf("cert prefetch(%q): %v", domain, err)
+		st.LastError = err.Error()
+	} else if st.NotAfter, st.RenewAt, err = p.b.certRenewalTimes(domain, pair); err != nil {
+		p.b.logf("cert prefetch(%q): %v", domain, err)
+		st.LastError = err.Error()
+	} else {
+		next = min(certPrefetchCheck, max(st.RenewAt.Sub(now), time.Minute))
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed || p.domains[domain] != pd {
+		return
+	}
+	if st.LastError != "" {
+		// Keep reporting the certificate we already have, if any.
+		st.NotAfter, st.RenewAt = pd.status.NotAfter, pd.status.RenewAt
+	}
+	pd.status = st
+	pd.timer = p.b.clock.AfterFunc(next, func() { p.fetch(domain, pd) })
+}
+
+// status returns the status of the certificates of p, sorted by domain.
+func (p *certPrefetcher) status() []ipn.ServeCertStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ret := make([]ipn.ServeCertStatus, 0, len(p.domains))
+	for _, pd := range p.domains {
+		ret = append(ret, pd.status)
+	}
+	slices.SortFunc(ret, func(x, y ipn.ServeCertStatus) int {
+		return cmp.Compare(x.Domain, y.Domain)
+	})
+	return ret
+}
+
+// close stops p from getting certificates.
+func (p *certPrefetcher) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for _, pd := range p.domains {
+		pd.timer.Stop()
+	}
+}
+
+// certRenewalTimes returns when the certificate of pair for domain expires,
+// and when it's due to be renewed.
+func (b *LocalBackend) certRenewalTimes(domain string, pair *TLSCertKeyPair) (notAfter, renewAt time.Time, err error) {
+	block, _ := pem.Decode(pair.CertPEM)
+	if block == nil {
+		return time.Time{}, time.Time{}, errors.New("parsing certificate PEM")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	renewMu.Lock()
+	renewAt, ok := renewCertAt[domain]
+	renewMu.Unlock()
+	if !ok {
+		if renewAt, err = b.domainRenewalTimeByExpiry(pair); err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+	}
+	return cert.NotAfter, renewAt, nil
+}
+
+// serveCertDomainsLocked returns the domains that the serve config has HTTPS
+// or TLS-terminating handlers for, and that the node can get certificates
+// for.
+//
+// b.mu must be held.
+func (b *LocalBackend) serveCertDomainsLocked() []string {
+	if !b.serveConfig.Valid() || b.netMap == nil {
+		return nil
+	}
+	var domains []string
+	add := func(d string) {
+		if slices.Contains(b.netMap.DNS.CertDomains, d) && !slices.Contains(domains, d) {
+			domains = append(domains, d)
+		}
+	}
+	b.serveConfig.RangeOverWebs(func(hp ipn.HostPort, _ ipn.WebServerConfigView) bool {
+		host, portStr, err := net.SplitHostPort(string(hp))
+		if err != nil {
+			return true
+		}
+		port, err := strconv.ParseUint(portStr, 10, 16)
+		if err != nil {
+			return true
+		}
+		if tcp, ok := b.serveConfig.FindTCP(uint16(port)); ok && tcp.HTTPS() {
+			add(host)
+		}
+		return true
+	})
+	b.serveConfig.RangeOverTCPs(func(_ uint16, h ipn.TCPPortHandlerView) bool {
+		if sni := h.TerminateTLS(); sni != "" {
+			add(sni)
+		}
+		return true
+	})
+	return domains
+}
+
+// updateServeCertsLocked starts or stops getting the certificates of the
+// hosts of the current serve config in the background.
+//
+// b.mu must be held.
+func (b *LocalBackend) updateServeCertsLocked() {
+	domains := b.serveCertDomainsLocked()
+	if b.certPrefetcher == nil {
+		if len(domains) == 0 || disableCertPrefetch() || testenv.InTest() {
+			// Tests that want a certPrefetcher set their own, so that they
+			// don't do ACME.
+			return
+		}
+		b.certPrefetcher = newCertPrefetcher(b)
+	}
+	b.certPrefetcher.setDomains(domains)
+}
+
+// ServeCertStatus returns the status of the TLS certificates that b gets and
+// renews in the background for the hosts of the serve config, sorted by
+// domain.
+func (b *LocalBackend) ServeCertStatus() []ipn.ServeCertStatus {
+	b.mu.Lock()
+	p := b.certPrefetcher
+	b.mu.Unlock()
+	if p == nil {
+		return nil
+	}
+	return p.status()
+}
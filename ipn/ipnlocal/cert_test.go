@@ -6,6 +6,7 @@
 package ipnlocal
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
@@ -13,12 +14,18 @@
 	"crypto/x509/pkix"
 	"embed"
 	"encoding/pem"
+	"errors"
 	"math/big"
+	"slices"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"tailscale.com/ipn"
 	"tailscale.com/ipn/store/mem"
+	"tailscale.com/tailcfg"
+	"tailscale.com/tstime"
+	"tailscale.com/types/netmap"
 )
 
 func TestValidLookingCertDomain(t *testing.T) {
@@ -199,3 +206,92 @@ func TestShouldStartDomainRenewal(t *testing.T) {
 		})
 	}
 }
+
+func TestServeCertDomains(t *testing.T) {
+	b := &LocalBackend{
+		netMap: &netmap.NetworkMap{
+			DNS: tailcfg.DNSConfig{CertDomains: []string{"foo.test.ts.net", "tls.test.ts.net"}},
+		},
+		serveConfig: (&ipn.ServeConfig{
+			TCP: map[uint16]*ipn.TCPPortHandler{
+				443:  {HTTPS: true},
+				80:   {HTTP: true},
+				8443: {TCPForward: "localhost:8443", TerminateTLS: "tls.test.ts.net"},
+			},
+			Web: map[ipn.HostPort]*ipn.WebServerConfig{
+				"foo.test.ts.net:443":   {},
+				"foo.test.ts.net:80":    {},
+				"other.example.com:443": {}, // not a cert domain
+			},
+		}).View(),
+	}
+	got := b.serveCertDomainsLocked()
+	slices.Sort(got)
+	want := []string{"foo.test.ts.net", "tls.test.ts.net"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
+
+func TestCertPrefetcher(t *testing.T) {
+	const good, bad = "prefetch-good.test.ts.net", "prefetch-bad.test.ts.net"
+	now := time.Now()
+	notBefore := now.Add(-time.Hour)
+	notAfter := notBefore.Add(90 * 24 * time.Hour)
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     []string{good},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair := &TLSCertKeyPair{CertPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+
+	b := &LocalBackend{clock: tstime.StdClock{}, logf: t.Logf}
+	p := newCertPrefetcher(b)
+	defer p.close()
+	p.getCert = func(ctx context.Context, domain string) (*TLSCertKeyPair, error) {
+		if domain == good {
+			return pair, nil
+		}
+		return nil, errors.New("rate limited")
+	}
+
+	waitForAttempts := func() []ipn.ServeCertStatus {
+		t.Helper()
+		for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			st := p.status()
+			if !slices.ContainsFunc(st, func(s ipn.ServeCertStatus) bool { return s.LastAttempt.IsZero() }) {
+				return st
+			}
+		}
+		t.Fatal("timeout waiting for certificates")
+		return nil
+	}
+
+	p.setDomains([]string{good, bad})
+	st := waitForAttempts()
+	if len(st) != 2 || st[0].Domain != bad || st[1].Domain != good {
+		t.Fatalf("status = %+v; want %q and %q", st, bad, good)
+	}
+	if st[0].LastError != "rate limited" || !st[0].NotAfter.IsZero() {
+		t.Errorf("status of %q = %+v; want error and no certificate", bad, st[0])
+	}
+	wantRenewAt := notBefore.Add(notAfter.Sub(notBefore) * 2 / 3)
+	if st[1].LastError != "" || !st[1].NotAfter.Equal(notAfter.Truncate(time.Second)) || !st[1].RenewAt.Equal(wantRenewAt.Truncate(time.Second)) {
+		t.Errorf("status of %q = %+v; want NotAfter %v, RenewAt %v", good, st[1], notAfter, wantRenewAt)
+	}
+
+	p.setDomains([]string{good})
+	if st := p.status(); len(st) != 1 || st[0].Domain != good {
+		t.Errorf("after removing %q, status = %+v", bad, st)
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"tailscale.com/ipn"
+	"tailscale.com/types/logger"
+	"tailscale.com/util/winutil/policy"
+)
+
+// derpHomePrefs returns the DERP region to pin as home, or 0, and the
+// regions never to use as home, from prefs and the DERPHomeRegion and
+// DERPExcludeRegions system policies. Invalid policy values are logged and
+// ignored.
+func derpHomePrefs(prefs ipn.PrefsView, logf logger.Logf) (pin int, exclude []int) {
+	pin = prefs.DERPHomeRegion()
+	exclude = prefs.DERPExcludeRegions().AsSlice()
+	if v := policy.GetString(policy.DERPHomeRegion); v != "" {
+		if id, err := strconv.Atoi(v); err == nil && id > 0 {
+			pin = id
+		} else {
+			logf("policy %s: invalid region ID %q; ignoring", policy.DERPHomeRegion, v)
+		}
+	}
+	if v := policy.GetString(policy.DERPExcludeRegions); v != "" {
+		for _, s := range strings.Split(v, ",") {
+			s = strings.TrimSpace(s)
+			if s == "" {
+				continue
+			}
+			id, err := strconv.Atoi(s)
+			if err != nil || id <= 0 {
+				logf("policy %s: invalid region ID %q; ignoring", policy.DERPExcludeRegions, s)
+				continue
+			}
+			if !slices.Contains(exclude, id) {
+				exclude = append(exclude, id)
+			}
+		}
+	}
+	return pin, exclude
+}
+
+func checkDERPHomePrefs(p *ipn.Prefs) error {
+	if p.DERPHomeRegion < 0 {
+		return fmt.Errorf("invalid DERP home region %d", p.DERPHomeRegion)
+	}
+	for _, id := range p.DERPExcludeRegions {
+		if id <= 0 {
+			return fmt.Errorf("invalid DERP region %d", id)
+		}
+		if id == p.DERPHomeRegion {
+			return fmt.Errorf("DERP region %d can't be both the home region and excluded", id)
+		}
+	}
+	return nil
+}
@@ -289,6 +289,36 @@ func TestDNSConfigForNetmap(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "local_dns_routes",
+			nm: &netmap.NetworkMap{
+				DNS: tailcfg.DNSConfig{
+					Resolvers: []*dnstype.Resolver{
+						{Addr: "8.8.8.8"},
+					},
+					Routes: map[string][]*dnstype.Resolver{
+						"foo.com.": {{Addr: "1.2.3.4"}},
+					},
+				},
+			},
+			prefs: &ipn.Prefs{
+				CorpDNS: true,
+				DNSRoutes: map[string][]string{
+					"foo.com":      {"9.9.9.9"},
+					"corp.example": {"10.0.0.53", "https://dns.corp.example/dns-query"},
+				},
+			},
+			want: &dns.Config{
+				Hosts: map[dnsname.FQDN][]netip.Addr{},
+				DefaultResolvers: []*dnstype.Resolver{
+					{Addr: "8.8.8.8"},
+				},
+				Routes: map[dnsname.FQDN][]*dnstype.Resolver{
+					"foo.com.":      {{Addr: "1.2.3.4"}},
+					"corp.example.": {{Addr: "10.0.0.53"}, {Addr: "https://dns.corp.example/dns-query"}},
+				},
+			},
+		},
 		{
 			name: "exit_nodes_need_fallbacks",
 			nm: &netmap.NetworkMap{
@@ -0,0 +1,82 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"net/netip"
+
+	"tailscale.com/ipn"
+	"tailscale.com/net/tsaddr"
+	"tailscale.com/tailcfg"
+)
+
+// exitNodeFailoverTarget returns the exit node selected by the
+// ExitNodeFailover list of prefs: the first listed node that peer finds,
+// that offers exit node services and that isn't known to be offline.
+// Earlier nodes are preferred, so the original exit node is restored once
+// it's back online.
+//
+// It returns the empty string if prefs has no failover list or if none of
+// the listed nodes is usable, in which case the current exit node should be
+// kept.
+func exitNodeFailoverTarget(prefs ipn.PrefsView, peer func(tailcfg.StableNodeID) (tailcfg.NodeView, bool)) tailcfg.StableNodeID {
+	list := prefs.ExitNodeFailover()
+	for i := range list.LenIter() {
+		id := list.At(i)
+		p, ok := peer(id)
+		if !ok || !tsaddr.ContainsExitRoutes(p.AllowedIPs()) {
+			continue
+		}
+		if online := p.Online(); online != nil && !*online {
+			continue
+		}
+		return id
+	}
+	return ""
+}
+
+// applyExitNodeFailover sets the exit node of prefs to the one selected by
+// its ExitNodeFailover list, as described at exitNodeFailoverTarget. It
+// returns a description of the change, or nil if prefs wasn't modified.
+func applyExitNodeFailover(prefs *ipn.Prefs, peer func(tailcfg.StableNodeID) (tailcfg.NodeView, bool)) *ipn.ExitNodeFailover {
+	to := exitNodeFailoverTarget(prefs.View(), peer)
+	if to == "" || (to == prefs.ExitNodeID && !prefs.ExitNodeIP.IsValid()) {
+		return nil
+	}
+	ev := &ipn.ExitNodeFailover{
+		From:     prefs.ExitNodeID,
+		To:       to,
+		Restored: to == prefs.ExitNodeFailover[0] && prefs.ExitNodeID != "",
+	}
+	prefs.ExitNodeID = to
+	prefs.ExitNodeIP = netip.Addr{}
+	return ev
+}
+
+// exitNodeFailoverPendingLocked reports whether the ExitNodeFailover list
+// of the current prefs selects a different exit node than the current one,
+// given the online status of b.peers.
+//
+// b.mu must be held.
+func (b *LocalBackend) exitNodeFailoverPendingLocked() bool {
+	prefs := b.pm.CurrentPrefs()
+	if prefs.ExitNodeFailover().Len() == 0 {
+		return false
+	}
+	to := exitNodeFailoverTarget(prefs, b.peerWithStableIDLocked)
+	return to != "" && to != prefs.ExitNodeID()
+}
+
+// peerWithStableIDLocked returns the peer in b.peers with the provided
+// StableNodeID, if any.
+//
+// b.mu must be held.
+func (b *LocalBackend) peerWithStableIDLocked(id tailcfg.StableNodeID) (tailcfg.NodeView, bool) {
+	for _, p := range b.peers {
+		if p.StableID() == id {
+			return p, true
+		}
+	}
+	return tailcfg.NodeView{}, false
+}
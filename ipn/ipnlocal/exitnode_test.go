@@ -0,0 +1,95 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+
+	"tailscale.com/ipn"
+	"tailscale.com/net/tsaddr"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/ptr"
+)
+
+func TestApplyExitNodeFailover(t *testing.T) {
+	peers := map[tailcfg.StableNodeID]tailcfg.NodeView{}
+	setPeer := func(id tailcfg.StableNodeID, exit, online bool) {
+		n := &tailcfg.Node{StableID: id, Online: ptr.To(online)}
+		if exit {
+			n.AllowedIPs = tsaddr.ExitRoutes()
+		}
+		peers[id] = n.View()
+	}
+	peer := func(id tailcfg.StableNodeID) (tailcfg.NodeView, bool) {
+		p, ok := peers[id]
+		return p, ok
+	}
+	setPeer("a", true, true)
+	setPeer("b", true, true)
+	setPeer("c", false, true)
+
+	prefs := &ipn.Prefs{
+		ExitNodeIP:       netip.MustParseAddr("100.64.0.1"),
+		ExitNodeFailover: []tailcfg.StableNodeID{"a", "c", "b"},
+	}
+
+	steps := []struct {
+		desc   string
+		change func()
+		want   *ipn.ExitNodeFailover
+		wantID tailcfg.StableNodeID
+	}{
+		{
+			desc:   "initial",
+			want:   &ipn.ExitNodeFailover{To: "a"},
+			wantID: "a",
+		},
+		{
+			desc:   "unchanged",
+			wantID: "a",
+		},
+		{
+			desc:   "first offline",
+			change: func() { setPeer("a", true, false) },
+			want:   &ipn.ExitNodeFailover{From: "a", To: "b"},
+			wantID: "b",
+		},
+		{
+			desc:   "all offline",
+			change: func() { setPeer("b", true, false) },
+			wantID: "b",
+		},
+		{
+			desc:   "first back",
+			change: func() { setPeer("a", true, true) },
+			want:   &ipn.ExitNodeFailover{From: "b", To: "a", Restored: true},
+			wantID: "a",
+		},
+		{
+			desc:   "first removed",
+			change: func() { delete(peers, "a"); setPeer("b", true, true) },
+			want:   &ipn.ExitNodeFailover{From: "a", To: "b"},
+			wantID: "b",
+		},
+	}
+	for _, st := range steps {
+		if st.change != nil {
+			st.change()
+		}
+		got := applyExitNodeFailover(prefs, peer)
+		if !reflect.DeepEqual(got, st.want) {
+			t.Errorf("%s: applyExitNodeFailover = %+v, want %+v", st.desc, got, st.want)
+		}
+		if prefs.ExitNodeID != st.wantID || prefs.ExitNodeIP.IsValid() {
+			t.Errorf("%s: exit node = %q/%v, want %q", st.desc, prefs.ExitNodeID, prefs.ExitNodeIP, st.wantID)
+		}
+	}
+
+	prefs = &ipn.Prefs{ExitNodeID: "x"}
+	if got := applyExitNodeFailover(prefs, peer); got != nil || prefs.ExitNodeID != "x" {
+		t.Errorf("no failover list: got %+v, exit node %q", got, prefs.ExitNodeID)
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"time"
+
+	"tailscale.com/ipn"
+	"tailscale.com/util/winutil/policy"
+)
+
+// keyExpiryHookTimeout is how long the key expiry hook may run.
+const keyExpiryHookTimeout = time.Minute
+
+// keyExpiryNoticeTime returns how long before the node key expires to act
+// on it, per the KeyExpirationNotice system policy, or 0 not to.
+func keyExpiryNoticeTime() time.Duration {
+	// GetString validates the duration, falling back to the default.
+	d, _ := time.ParseDuration(policy.GetString(policy.KeyExpirationNoticeTime))
+	return d
+}
+
+// SetKeyExpiryHook sets the path of a program to run ahead of node key
+// expiry, instead of starting an interactive login. It's run with the
+// expiry time in RFC 3339 format as its argument and in the
+// TS_KEY_EXPIRY environment variable.
+//
+// It should only be called before the LocalBackend is used.
+func (b *LocalBackend) SetKeyExpiryHook(path string) {
+	b.keyExpiryHook = path
+}
+
+// scheduleKeyExpiryNoticeLocked arranges for onKeyExpiryNotice to run
+// ahead of expiry, the node key's expiry time from the latest netmap,
+// unless it already ran for that expiry time. It replaces any previously
+// scheduled notice.
+//
+// b.mu must be held.
+func (b *LocalBackend) scheduleKeyExpiryNoticeLocked(expiry time.Time) {
+	if b.keyExpiryNoticeTimer != nil {
+		b.keyExpiryNoticeTimer.Stop()
+		b.keyExpiryNoticeTimer = nil
+	}
+	if expiry.IsZero() || expiry.Equal(b.keyExpiryNoticed) {
+		return
+	}
+	noticeTime := keyExpiryNoticeTime()
+	if noticeTime <= 0 {
+		return
+	}
+	now := b.clock.Now()
+	if !expiry.After(now) {
+		// Too late; the node is logged out by now.
+		return
+	}
+	// If the key is already within the notice time, still wait a moment,
+	// for the netmap with its expiry to be applied first.
+	d := max(expiry.Sub(now)-noticeTime, time.Second)
+	b.keyExpiryNoticeTimer = b.clock.AfterFunc(d, func() {
+		b.onKeyExpiryNotice(expiry)
+	})
+}
+
+// onKeyExpiryNotice warns watchers of the IPN bus that the node key
+// expires at expiry, then runs the key expiry hook if there's one, or
+// starts an interactive login otherwise, so that the node can be
+// re-authenticated before it drops off the tailnet.
+func (b *LocalBackend) onKeyExpiryNotice(expiry time.Time) {
+	b.mu.Lock()
+	if b.cc == nil || expiry.Equal(b.keyExpiryNoticed) {
+		b.mu.Unlock()
+		return
+	}
+	b.keyExpiryNoticed = expiry
+	hook := b.keyExpiryHook
+	b.mu.Unlock()
+
+	b.logf("node key expires at %v", expiry.Format(time.RFC3339))
+	b.send(ipn.Notify{KeyExpiring: &expiry})
+	if hook == "" {
+		b.logf("key expiry: starting interactive login")
+		b.StartLoginInteractive()
+		return
+	}
+	go b.runKeyExpiryHook(hook, expiry)
+}
+
+// runKeyExpiryHook runs the program at path, the key expiry hook, for a
+// node key that expires at expiry.
+func (b *LocalBackend) runKeyExpiryHook(path string, expiry time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), keyExpiryHookTimeout)
+	defer cancel()
+	ts := expiry.Format(time.RFC3339)
+	cmd := exec.CommandContext(ctx, path, ts)
+	cmd.Env = append(os.Environ(), "TS_KEY_EXPIRY="+ts)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		b.logf("key expiry hook %s: %v; output: %q", path, err, out)
+		return
+	}
+	b.logf("key expiry hook %s: ran", path)
+}
@@ -0,0 +1,136 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"tailscale.com/control/controlclient"
+	"tailscale.com/ipn"
+	"tailscale.com/tstest"
+	"tailscale.com/types/key"
+)
+
+func TestKeyExpiryNotice(t *testing.T) {
+	now := time.Now()
+	clock := tstest.NewClock(tstest.ClockOpts{Start: now})
+	b := newTestLocalBackend(t)
+	b.clock = clock
+	cc := newClient(t, controlclient.Options{
+		Logf:                 t.Logf,
+		GetMachinePrivateKey: func() (key.MachinePrivate, error) { return key.NewMachine(), nil },
+	})
+	b.cc = cc
+
+	var mu sync.Mutex
+	var notified []time.Time
+	b.SetNotifyCallback(func(n ipn.Notify) {
+		if n.KeyExpiring != nil {
+			mu.Lock()
+			notified = append(notified, *n.KeyExpiring)
+			mu.Unlock()
+		}
+	})
+	assertNotified := func(want ...time.Time) {
+		t.Helper()
+		mu.Lock()
+		defer mu.Unlock()
+		if len(notified) != len(want) {
+			t.Fatalf("notified of expiry %d times; want %d", len(notified), len(want))
+		}
+		for i := range want {
+			if !notified[i].Equal(want[i]) {
+				t.Errorf("notified of expiry at %v; want %v", notified[i], want[i])
+			}
+		}
+		notified = nil
+	}
+
+	// The default KeyExpirationNotice policy is 24h.
+	expiry := now.Add(48 * time.Hour)
+	b.mu.Lock()
+	b.scheduleKeyExpiryNoticeLocked(expiry)
+	b.mu.Unlock()
+	clock.Advance(23 * time.Hour)
+	assertNotified()
+	cc.assertCalls()
+
+	clock.Advance(2 * time.Hour)
+	assertNotified(expiry)
+	cc.assertCalls("Login")
+
+	// A new netmap with the same expiry doesn't warn again.
+	b.mu.Lock()
+	b.scheduleKeyExpiryNoticeLocked(expiry)
+	b.mu.Unlock()
+	clock.Advance(24 * time.Hour)
+	assertNotified()
+	cc.assertCalls()
+
+	// An extended key that's already within the notice time warns right
+	// away.
+	expiry = clock.Now().Add(time.Hour)
+	b.mu.Lock()
+	b.scheduleKeyExpiryNoticeLocked(expiry)
+	b.mu.Unlock()
+	clock.Advance(time.Second)
+	assertNotified(expiry)
+	cc.assertCalls("Login")
+
+	// An expired key doesn't.
+	b.mu.Lock()
+	b.scheduleKeyExpiryNoticeLocked(clock.Now().Add(-time.Hour))
+	b.mu.Unlock()
+	clock.Advance(time.Second)
+	assertNotified()
+	cc.assertCalls()
+}
+
+func TestKeyExpiryHook(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test uses a shell script")
+	}
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+	hook := filepath.Join(dir, "hook.sh")
+	script := "#!/bin/sh\necho \"$1 $TS_KEY_EXPIRY\" > " + out + "\n"
+	if err := os.WriteFile(hook, []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	clock := tstest.NewClock(tstest.ClockOpts{Start: now})
+	b := newTestLocalBackend(t)
+	b.clock = clock
+	b.SetKeyExpiryHook(hook)
+	cc := newClient(t, controlclient.Options{Logf: t.Logf})
+	b.cc = cc
+
+	expiry := now.Add(time.Hour).Truncate(time.Second)
+	b.mu.Lock()
+	b.scheduleKeyExpiryNoticeLocked(expiry)
+	b.mu.Unlock()
+	clock.Advance(time.Second)
+
+	ts := expiry.Format(time.RFC3339)
+	want := ts + " " + ts + "\n"
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		got, err := os.ReadFile(out)
+		if err == nil && string(got) == want {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("hook wrote %q, %v; want %q", got, err, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// The hook replaces the interactive login.
+	cc.assertCalls()
+}
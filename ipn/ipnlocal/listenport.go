@@ -0,0 +1,44 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"fmt"
+	"strconv"
+
+	"tailscale.com/ipn"
+)
+
+// StartupListenPort returns the UDP port saved by SaveListenPort, or 0 if
+// there's none. tailscaled asks to bind it again when it selects its port
+// automatically, so that NAT mappings and firewall rules for the port keep
+// working across restarts.
+func StartupListenPort(store ipn.StateStore) (uint16, error) {
+	bs, err := store.ReadState(ipn.ListenPortStateKey)
+	if err == ipn.ErrStateNotExist || len(bs) == 0 {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	port, err := strconv.ParseUint(string(bs), 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", ipn.ListenPortStateKey, bs, err)
+	}
+	return uint16(port), nil
+}
+
+// SaveListenPort saves port for StartupListenPort, unless it's saved already.
+func SaveListenPort(store ipn.StateStore, port uint16) error {
+	if old, err := StartupListenPort(store); err == nil && old == port {
+		return nil
+	}
+	return store.WriteState(ipn.ListenPortStateKey, []byte(strconv.Itoa(int(port))))
+}
+
+// ListenPort returns the UDP port that b listens on for WireGuard and
+// peer-to-peer traffic.
+func (b *LocalBackend) ListenPort() uint16 {
+	return b.magicConn().LocalPort()
+}
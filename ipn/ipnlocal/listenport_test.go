@@ -0,0 +1,28 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"testing"
+
+	"tailscale.com/ipn"
+	"tailscale.com/ipn/store/mem"
+)
+
+func TestListenPortState(t *testing.T) {
+	store := new(mem.Store)
+	if port, err := StartupListenPort(store); port != 0 || err != nil {
+		t.Fatalf("empty store: got %d, %v; want 0, nil", port, err)
+	}
+	if err := SaveListenPort(store, 41642); err != nil {
+		t.Fatal(err)
+	}
+	if port, err := StartupListenPort(store); port != 41642 || err != nil {
+		t.Fatalf("got %d, %v; want 41642, nil", port, err)
+	}
+	store.WriteState(ipn.ListenPortStateKey, []byte("70000"))
+	if _, err := StartupListenPort(store); err == nil {
+		t.Fatal("out-of-range port: got no error")
+	}
+}
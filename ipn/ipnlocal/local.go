@@ -36,6 +36,7 @@
 	"tailscale.com/client/tailscale/apitype"
 	"tailscale.com/control/controlclient"
 	"tailscale.com/control/controlknobs"
+	"tailscale.com/derp/derpmap"
 	"tailscale.com/doctor"
 	"tailscale.com/doctor/permissions"
 	"tailscale.com/doctor/routetable"
@@ -93,6 +94,7 @@
 	"tailscale.com/wgengine/filter"
 	"tailscale.com/wgengine/magicsock"
 	"tailscale.com/wgengine/router"
+	"tailscale.com/wgengine/shaper"
 	"tailscale.com/wgengine/wgcfg"
 	"tailscale.com/wgengine/wgcfg/nmcfg"
 )
@@ -164,6 +166,8 @@ type LocalBackend struct {
 	gotPortPollRes        chan struct{}    // closed upon first readPoller result
 	varRoot               string           // or empty if SetVarRoot never called
 	logFlushFunc          func()           // or nil if SetLogFlusher wasn't called
+	localDERPMap          *tailcfg.DERPMap // or nil if SetLocalDERPMap wasn't called
+	keyExpiryHook         string           // or empty if SetKeyExpiryHook wasn't called
 	em                    *expiryManager   // non-nil
 	sshAtomicBool         atomic.Bool
 	shutdownCalled        bool // if Shutdown has been called
@@ -199,9 +203,10 @@ type LocalBackend struct {
 	mu             sync.Mutex
 	pm             *profileManager // mu guards access
 	filterHash     deephash.Sum
-	httpTestClient *http.Client // for controlclient. nil by default, used by tests.
-	ccGen          clientGen    // function for producing controlclient; lazily populated
-	sshServer      SSHServer    // or nil, initialized lazily.
+	rateLimits     []ipn.RateLimit // as last passed to the engine's shaper
+	httpTestClient *http.Client    // for controlclient. nil by default, used by tests.
+	ccGen          clientGen       // function for producing controlclient; lazily populated
+	sshServer      SSHServer       // or nil, initialized lazily.
 	notify         func(ipn.Notify)
 	cc             controlclient.Client
 	ccAuto         *controlclient.Auto // if cc is of type *controlclient.Auto
@@ -210,6 +215,27 @@ type LocalBackend struct {
 	state          ipn.State
 	capFileSharing bool // whether netMap contains the file sharing capability
 	capTailnetLock bool // whether netMap contains the tailnet lock capability
+	// capFeatureArgs are the values of the capabilities registered with
+	// RegisterCapFeature that the self node had when they were last applied.
+	capFeatureArgs map[tailcfg.NodeCapability][]tailcfg.RawMessage
+	// capServeMetrics, funnelPaused and taildropAutoAcceptTags are set by
+	// the built-in cap features; see capfeature.go.
+	capServeMetrics        bool
+	funnelPaused           bool
+	taildropAutoAcceptTags []string
+	// filterDropWatchers is the number of IPN bus watchers that set
+	// ipn.NotifyFilterDrops. While it's non-zero, the packet filter
+	// sends DropEvents to sendFilterDropEvent.
+	filterDropWatchers int
+	// filterDrops queues the DropEvents for sendFilterDrops to send, in
+	// the order the filter reported them.
+	filterDrops chan filter.DropEvent
+	// filterDropLogf logs DropEvents without flooding the log when a
+	// peer keeps sending denied packets.
+	filterDropLogf logger.Logf
+	// sshSessions are the running Tailscale SSH sessions, by ID, as
+	// reported to NoteSSHSession.
+	sshSessions map[string]ipn.SSHSession
 	// hostinfo is mutated in-place while mu is held.
 	hostinfo *tailcfg.Hostinfo
 	// netMap is the most recently set full netmap from the controlclient.
@@ -266,7 +292,35 @@ type LocalBackend struct {
 	activeWatchSessions set.Set[string]     // of WatchIPN SessionID
 
 	serveListeners     map[netip.AddrPort]*serveListener // addrPort => serveListener
-	serveProxyHandlers sync.Map                          // string (HTTPHandler.Proxy) => *httputil.ReverseProxy
+	serveProxyHandlers sync.Map                          // string (serveProxyKey) => *httputil.ReverseProxy
+	serveBasicAuthOK   syncs.Map[string, [32]byte]       // BasicAuth => SHA-256 of the password that last matched
+
+	// funnelExpiryTimer is the timer to remove expired funnel access
+	// from serveConfig, or nil if funnel access doesn't expire.
+	funnelExpiryTimer tstime.TimerController
+
+	// certPrefetcher gets the certificates of the serve config's HTTPS
+	// hosts in the background, or is nil if it hasn't had any.
+	certPrefetcher *certPrefetcher
+
+	// keyExpiryNoticeTimer runs onKeyExpiryNotice ahead of the node key's
+	// expiry, or is nil if none is scheduled. keyExpiryNoticed is the
+	// expiry time that onKeyExpiryNotice last ran for.
+	keyExpiryNoticeTimer tstime.TimerController
+	keyExpiryNoticed     time.Time
+
+	// postureTimer collects posture attributes into postureAttrs, or is
+	// nil if posture checking is off. postureGen counts the times posture
+	// checking was turned on or off, so that collections started before
+	// the latest change are ignored. See setPostureCheckingLocked.
+	postureTimer tstime.TimerController
+	postureGen   int
+	postureAttrs map[string]string
+
+	// updateRollbackTimer rolls back an auto-update unless tailscaled
+	// reaches the Running state first, or is nil if there's no
+	// auto-update to confirm. See initUpdateState.
+	updateRollbackTimer tstime.TimerController
 
 	// statusLock must be held before calling statusChanged.Wait() or
 	// statusChanged.Broadcast().
@@ -286,6 +340,11 @@ type LocalBackend struct {
 	tkaSyncLock sync.Mutex
 	clock       tstime.Clock
 
+	// updateStateMu guards the read-modify-write cycles of the
+	// ipn.UpdateState in the state store. It must not be held while
+	// taking mu.
+	updateStateMu sync.Mutex
+
 	// Last ClientVersion received in MapResponse, guarded by mu.
 	lastClientVersion *tailcfg.ClientVersion
 }
@@ -348,6 +407,8 @@ func NewLocalBackend(logf logger.Logf, logID logid.PublicID, sys *tsd.System, lo
 		loginFlags:          loginFlags,
 		clock:               clock,
 		activeWatchSessions: make(set.Set[string]),
+		filterDrops:         make(chan filter.DropEvent, 64),
+		filterDropLogf:      logger.RateLimitedFn(logf, 1*time.Minute, 10, 10),
 	}
 
 	netMon := sys.NetMon.Get()
@@ -360,6 +421,8 @@ func NewLocalBackend(logf logger.Logf, logID logid.PublicID, sys *tsd.System, lo
 		b.sockstatLogger.SetLoggingEnabled(true)
 	}
 
+	go b.sendFilterDrops()
+
 	// Default filter blocks everything and logs nothing, until Start() is called.
 	b.setFilter(filter.NewAllowNone(logf, &netipx.IPSet{}))
 
@@ -382,6 +445,8 @@ func NewLocalBackend(logf logger.Logf, logID logid.PublicID, sys *tsd.System, lo
 		b.logf("[unexpected] failed to wire up PeerAPI port for engine %T", e)
 	}
 
+	b.initUpdateState()
+
 	for _, component := range debuggableComponents {
 		key := componentStateKey(component)
 		if ut, err := ipn.ReadStoreInt(pm.Store(), key); err == nil {
@@ -605,6 +670,16 @@ func (b *LocalBackend) Shutdown() {
 		b.sshServer = nil
 	}
 	b.closePeerAPIListenersLocked()
+	if b.certPrefetcher != nil {
+		b.certPrefetcher.close()
+	}
+	if b.updateRollbackTimer != nil {
+		// Leave any auto-update pending, for the next tailscaled to
+		// confirm or roll back.
+		b.updateRollbackTimer.Stop()
+		b.updateRollbackTimer = nil
+	}
+	b.setPostureCheckingLocked(false)
 	if b.debugSink != nil {
 		b.e.InstallCaptureHook(nil)
 		b.debugSink.Close()
@@ -666,6 +741,42 @@ func (b *LocalBackend) StatusWithoutPeers() *ipnstate.Status {
 	return sb.Status()
 }
 
+// HealthWarnings returns the node's current health problems, most severe
+// first: those of the health package and those that only b knows about.
+func (b *LocalBackend) HealthWarnings() []health.Warning {
+	ws := health.Warnings()
+	b.mu.Lock()
+	ws = append(ws, b.backendWarningsLocked()...)
+	prefs := b.pm.CurrentPrefs()
+	advertisesRoutes := prefs.Valid() && prefs.AdvertiseRoutes().Len() > 0
+	b.mu.Unlock()
+	if advertisesRoutes {
+		if err := b.CheckIPForwarding(); err != nil {
+			ws = append(ws, health.Warning{Name: "ip-forwarding", Severity: health.SeverityMedium, Text: err.Error()})
+		}
+	}
+	health.SortWarnings(ws)
+	return ws
+}
+
+// backendWarningsLocked returns the health problems that b knows about
+// and the health package doesn't.
+//
+// b.mu must be held.
+func (b *LocalBackend) backendWarningsLocked() []health.Warning {
+	var ws []health.Warning
+	if m := b.sshOnButUnusableHealthCheckMessageLocked(); m != "" {
+		ws = append(ws, health.Warning{Name: "ssh-unusable", Severity: health.SeverityMedium, Text: m})
+	}
+	if version.IsUnstableBuild() {
+		ws = append(ws, health.Warning{Name: "unstable-version", Severity: health.SeverityLow, Text: "This is an unstable (development) version of Tailscale; frequent updates and bugs are likely"})
+	}
+	if prefs := b.pm.CurrentPrefs(); b.netMap != nil && prefs.Valid() && !prefs.RouteAll() && b.netMap.AnyPeersAdvertiseRoutes() {
+		ws = append(ws, health.Warning{Name: "accept-routes-off", Severity: health.SeverityLow, Text: healthmsg.WarnAcceptRoutesOff})
+	}
+	return ws
+}
+
 // UpdateStatus implements ipnstate.StatusUpdater.
 func (b *LocalBackend) UpdateStatus(sb *ipnstate.StatusBuilder) {
 	b.e.UpdateStatus(sb) // does wireguard + magicsock status
@@ -691,11 +802,8 @@ func (b *LocalBackend) UpdateStatus(sb *ipnstate.StatusBuilder) {
 				s.Health = append(s.Health, err.Error())
 			}
 		}
-		if m := b.sshOnButUnusableHealthCheckMessageLocked(); m != "" {
-			s.Health = append(s.Health, m)
-		}
-		if version.IsUnstableBuild() {
-			s.Health = append(s.Health, "This is an unstable (development) version of Tailscale; frequent updates and bugs are likely")
+		for _, w := range b.backendWarningsLocked() {
+			s.Health = append(s.Health, w.Text)
 		}
 		if b.netMap != nil {
 			s.CertDomains = append([]string(nil), b.netMap.DNS.CertDomains...)
@@ -707,9 +815,6 @@ func (b *LocalBackend) UpdateStatus(sb *ipnstate.StatusBuilder) {
 			s.CurrentTailnet.MagicDNSEnabled = b.netMap.DNS.Proxied
 			s.CurrentTailnet.Name = b.netMap.Domain
 			if prefs := b.pm.CurrentPrefs(); prefs.Valid() {
-				if !prefs.RouteAll() && b.netMap.AnyPeersAdvertiseRoutes() {
-					s.Health = append(s.Health, healthmsg.WarnAcceptRoutesOff)
-				}
 				if !prefs.ExitNodeID().IsZero() {
 					if exitPeer, ok := b.netMap.PeerWithStableID(prefs.ExitNodeID()); ok {
 						var online = false
@@ -953,6 +1058,8 @@ func (b *LocalBackend) SetControlClientStatus(c controlclient.Client, st control
 
 	// Handle node expiry in the netmap
 	if st.NetMap != nil {
+		st.NetMap.DERPMap = derpmap.Merge(st.NetMap.DERPMap, b.localDERPMap)
+
 		now := b.clock.Now()
 		b.em.flagExpiredPeers(st.NetMap, now)
 
@@ -1000,6 +1107,7 @@ func (b *LocalBackend) SetControlClientStatus(c controlclient.Client, st control
 			keyExpiryExtended = true
 		}
 		b.keyExpired = isExpired
+		b.scheduleKeyExpiryNoticeLocked(st.NetMap.Expiry)
 	}
 	b.mu.Unlock()
 
@@ -1055,6 +1163,14 @@ func (b *LocalBackend) SetControlClientStatus(c controlclient.Client, st control
 	if setExitNodeID(prefs, st.NetMap) {
 		prefsChanged = true
 	}
+	var exitNodeFailover *ipn.ExitNodeFailover
+	if st.NetMap != nil {
+		exitNodeFailover = applyExitNodeFailover(prefs, st.NetMap.PeerWithStableID)
+		if exitNodeFailover != nil {
+			b.logf("exit node failover: switching from %q to %q", exitNodeFailover.From, exitNodeFailover.To)
+			prefsChanged = true
+		}
+	}
 
 	// Perform all mutations of prefs based on the netmap here.
 	if prefsChanged {
@@ -1099,7 +1215,7 @@ func (b *LocalBackend) SetControlClientStatus(c controlclient.Client, st control
 
 	// Now complete the lock-free parts of what we started while locked.
 	if prefsChanged {
-		b.send(ipn.Notify{Prefs: ptr.To(prefs.View())})
+		b.send(ipn.Notify{Prefs: ptr.To(prefs.View()), ExitNodeFailover: exitNodeFailover})
 	}
 
 	if st.NetMap != nil {
@@ -1166,6 +1282,12 @@ func (b *LocalBackend) UpdateNetmapDelta(muts []netmap.NodeMutation) (handled bo
 	if !b.updateNetmapDeltaLocked(muts) {
 		return false
 	}
+	if b.exitNodeFailoverPendingLocked() {
+		// An exit node went offline or came back. Decline the delta so
+		// the full netmap is processed, which switches exit nodes and
+		// reconfigures.
+		return false
+	}
 
 	if b.netMap != nil && mutationsAreWorthyOfTellingIPNBus(muts) {
 		nm := ptr.To(*b.netMap) // shallow clone
@@ -1651,7 +1773,7 @@ func (b *LocalBackend) Start(opts ipn.Options) error {
 	return nil
 }
 
-var warnInvalidUnsignedNodes = health.NewWarnable()
+var warnInvalidUnsignedNodes = health.NewWarnable(health.WithName("invalid-unsigned-nodes"), health.WithSeverity(health.SeverityLow))
 
 // updateFilterLocked updates the packet filter in wgengine based on the
 // given netMap and user preferences.
@@ -1728,6 +1850,10 @@ func (b *LocalBackend) updateFilterLocked(netMap *netmap.NetworkMap, prefs ipn.P
 		sshPol = *netMap.SSHPolicy
 	}
 
+	// The rate limits only depend on prefs and do their own change
+	// detection.
+	b.updateShaperLocked(prefs)
+
 	changed := deephash.Update(&b.filterHash, &struct {
 		HaveNetmap  bool
 		Addrs       views.Slice[netip.Prefix]
@@ -1736,7 +1862,8 @@ func (b *LocalBackend) updateFilterLocked(netMap *netmap.NetworkMap, prefs ipn.P
 		LogNets     []netipx.IPRange
 		ShieldsUp   bool
 		SSHPolicy   tailcfg.SSHPolicy
-	}{haveNetmap, addrs, packetFilter, localNets.Ranges(), logNets.Ranges(), shieldsUp, sshPol})
+		DropEvents  bool
+	}{haveNetmap, addrs, packetFilter, localNets.Ranges(), logNets.Ranges(), shieldsUp, sshPol, b.filterDropWatchers > 0})
 	if !changed {
 		return
 	}
@@ -1761,6 +1888,36 @@ func (b *LocalBackend) updateFilterLocked(netMap *netmap.NetworkMap, prefs ipn.P
 	}
 }
 
+// updateShaperLocked configures the engine to enforce the rate limits in
+// prefs, if they changed since the last call.
+//
+// b.mu must be held.
+func (b *LocalBackend) updateShaperLocked(prefs ipn.PrefsView) {
+	var limits []ipn.RateLimit
+	if prefs.Valid() {
+		limits = prefs.RateLimits().AsSlice()
+	}
+	if slices.Equal(limits, b.rateLimits) {
+		return
+	}
+	b.rateLimits = limits
+	if len(limits) == 0 {
+		b.logf("rate limits: none")
+		b.e.SetShaper(nil)
+		return
+	}
+	rules := make([]shaper.Rule, len(limits))
+	for i, rl := range limits {
+		rules[i] = shaper.Rule{
+			Prefix:         rl.Prefix,
+			BytesPerSecond: rl.BytesPerSecond,
+			PerAddr:        rl.PerAddr,
+		}
+	}
+	b.logf("rate limits: %v", rules)
+	b.e.SetShaper(shaper.New(rules))
+}
+
 // packetFilterPermitsUnlockedNodes reports any peer in peers with the
 // UnsignedPeerAPIOnly bool set true has any of its allowed IPs in the packet
 // filter.
@@ -1801,6 +1958,9 @@ func packetFilterPermitsUnlockedNodes(peers map[tailcfg.NodeID]tailcfg.NodeView,
 }
 
 func (b *LocalBackend) setFilter(f *filter.Filter) {
+	if b.filterDropWatchers > 0 {
+		f.SetDropEventFunc(b.sendFilterDropEvent)
+	}
 	b.filterAtomic.Store(f)
 	b.e.SetFilter(f)
 }
@@ -1998,6 +2158,7 @@ func (b *LocalBackend) ResendHostinfoIfNeeded() {
 	if b.hostinfo != nil {
 		hi.Services = b.hostinfo.Services
 	}
+	hi.PostureAttributes = b.postureAttrs
 	b.hostinfo = hi
 	b.mu.Unlock()
 
@@ -2042,10 +2203,35 @@ func (b *LocalBackend) WatchNotifications(ctx context.Context, mask ipn.NotifyWa
 		}
 	}
 
+	if mask&ipn.NotifyFilterDrops == 0 {
+		fn2 := fn
+		fn = func(n *ipn.Notify) bool {
+			if n.FilterDrop != nil {
+				return true
+			}
+			return fn2(n)
+		}
+	}
+	if mask&ipn.NotifySSHSessions == 0 {
+		fn2 := fn
+		fn = func(n *ipn.Notify) bool {
+			if n.SSHSession != nil {
+				return true
+			}
+			return fn2(n)
+		}
+	}
+
 	var ini *ipn.Notify
 
 	b.mu.Lock()
 	b.activeWatchSessions.Add(sessionID)
+	if mask&ipn.NotifyFilterDrops != 0 {
+		b.filterDropWatchers++
+		if b.filterDropWatchers == 1 {
+			b.updateFilterLocked(b.netMap, b.pm.CurrentPrefs())
+		}
+	}
 
 	const initialBits = ipn.NotifyInitialState | ipn.NotifyInitialPrefs | ipn.NotifyInitialNetMap
 	if mask&initialBits != 0 {
@@ -2072,6 +2258,12 @@ func (b *LocalBackend) WatchNotifications(ctx context.Context, mask ipn.NotifyWa
 		b.mu.Lock()
 		delete(b.notifyWatchers, handle)
 		delete(b.activeWatchSessions, sessionID)
+		if mask&ipn.NotifyFilterDrops != 0 {
+			b.filterDropWatchers--
+			if b.filterDropWatchers == 0 {
+				b.updateFilterLocked(b.netMap, b.pm.CurrentPrefs())
+			}
+		}
 		b.mu.Unlock()
 	}()
 
@@ -2196,6 +2388,31 @@ func (b *LocalBackend) send(n ipn.Notify) {
 	}
 }
 
+// sendFilterDropEvent logs ev and queues it for the IPN bus watchers that
+// set ipn.NotifyFilterDrops. It's called by the packet filter for every
+// dropped packet, possibly with b.mu held, so it must not block: if the
+// queue is full, ev is dropped, as send does for slow watchers.
+func (b *LocalBackend) sendFilterDropEvent(ev filter.DropEvent) {
+	b.filterDropLogf("filter: dropped %v", ev)
+	select {
+	case b.filterDrops <- ev:
+	default:
+	}
+}
+
+// sendFilterDrops sends the DropEvents queued by sendFilterDropEvent to
+// the IPN bus watchers until b shuts down.
+func (b *LocalBackend) sendFilterDrops() {
+	for {
+		select {
+		case <-b.ctx.Done():
+			return
+		case ev := <-b.filterDrops:
+			b.send(ipn.Notify{FilterDrop: &ev})
+		}
+	}
+}
+
 func (b *LocalBackend) sendFileNotify() {
 	var n ipn.Notify
 
@@ -2725,9 +2942,31 @@ func (b *LocalBackend) checkPrefsLocked(p *ipn.Prefs) error {
 	if err := b.checkFunnelEnabledLocked(p); err != nil {
 		errs = append(errs, err)
 	}
+	if err := checkDNSModePref(p); err != nil {
+		errs = append(errs, err)
+	}
+	if err := checkTaildropAutoAcceptPref(p); err != nil {
+		errs = append(errs, err)
+	}
+	if err := checkDERPHomePrefs(p); err != nil {
+		errs = append(errs, err)
+	}
 	return multierr.New(errs...)
 }
 
+func checkDNSModePref(p *ipn.Prefs) error {
+	if p.DNSMode == "" {
+		return nil
+	}
+	if runtime.GOOS != "linux" {
+		return errors.New("DNS mode can only be set on Linux")
+	}
+	if !dns.IsValidMode(p.DNSMode) {
+		return fmt.Errorf("unknown DNS mode %q; want one of direct, resolved, nm, resolvconf", p.DNSMode)
+	}
+	return nil
+}
+
 func (b *LocalBackend) checkSSHPrefsLocked(p *ipn.Prefs) error {
 	if !p.RunSSH {
 		return nil
@@ -2907,6 +3146,9 @@ func (b *LocalBackend) setPrefsLockedOnEntry(caller string, newp *ipn.Prefs) ipn
 	// everything in this function treats b.prefs as completely new
 	// anyway. No-op if no exit node resolution is needed.
 	setExitNodeID(newp, netMap)
+	if netMap != nil {
+		applyExitNodeFailover(newp, b.peerWithStableIDLocked)
+	}
 	// We do this to avoid holding the lock while doing everything else.
 
 	oldHi := b.hostinfo
@@ -2922,6 +3164,9 @@ func (b *LocalBackend) setPrefsLockedOnEntry(caller string, newp *ipn.Prefs) ipn
 	}
 	b.updateFilterLocked(netMap, newp.View())
 
+	if oldp.Valid() && oldp.DNSMode() != newp.DNSMode {
+		b.logf("DNS mode preference changed to %q; takes effect when tailscaled restarts", newp.DNSMode)
+	}
 	if oldp.ShouldSSHBeRunning() && !newp.ShouldSSHBeRunning() {
 		if b.sshServer != nil {
 			go b.sshServer.Shutdown()
@@ -3043,7 +3288,7 @@ func (b *LocalBackend) TCPHandlerForDst(src, dst netip.AddrPort) (handler func(c
 			return nil
 		}, opts
 	}
-	if handler := b.tcpHandlerForServe(dst.Port(), src); handler != nil {
+	if handler := b.tcpHandlerForServe(dst.Port(), src, nil); handler != nil {
 		return handler, opts
 	}
 	return nil, nil
@@ -3116,6 +3361,16 @@ func (b *LocalBackend) NetMap() *netmap.NetworkMap {
 	return b.netMap
 }
 
+// NetstackConns returns the TCP and UDP flows that netstack forwards to
+// backends, or ok false if netstack isn't in use.
+func (b *LocalBackend) NetstackConns() (_ []ipnstate.NetstackConn, ok bool) {
+	ns, ok := b.sys.Netstack.GetOK()
+	if !ok {
+		return nil, false
+	}
+	return ns.Conns(), true
+}
+
 func (b *LocalBackend) isEngineBlocked() bool {
 	b.mu.Lock()
 	defer b.mu.Unlock()
@@ -3160,6 +3415,8 @@ func (b *LocalBackend) authReconfig() {
 		return
 	}
 
+	b.magicConn().SetDERPHomePrefs(derpHomePrefs(prefs, b.logf))
+
 	var flags netmap.WGConfigFlags
 	if prefs.RouteAll() {
 		flags |= netmap.AllowSubnetRoutes
@@ -3380,6 +3637,25 @@ func dnsConfigForNetmap(nm *netmap.NetworkMap, peers map[tailcfg.NodeID]tailcfg.
 		dcfg.Routes[fqdn] = append(dcfg.Routes[fqdn], resolvers...)
 	}
 
+	// Add the split DNS routes configured locally with "tailscale dns
+	// add-route", for suffixes the control plane doesn't route.
+	prefs.DNSRoutes().Range(func(suffix string, addrs views.Slice[string]) bool {
+		fqdn, err := dnsname.ToFQDN(suffix)
+		if err != nil {
+			logf("ignoring invalid local DNS route suffix %q: %v", suffix, err)
+			return true
+		}
+		if _, ok := dcfg.Routes[fqdn]; ok {
+			return true
+		}
+		resolvers := make([]*dnstype.Resolver, 0, addrs.Len())
+		for i := range addrs.LenIter() {
+			resolvers = append(resolvers, &dnstype.Resolver{Addr: addrs.At(i)})
+		}
+		dcfg.Routes[fqdn] = resolvers
+		return true
+	})
+
 	// Set FallbackResolvers as the default resolvers in the
 	// scenarios that can't handle a purely split-DNS config. See
 	// https://github.com/tailscale/tailscale/issues/1743 for
@@ -3423,6 +3699,14 @@ func (b *LocalBackend) SetVarRoot(dir string) {
 	b.varRoot = dir
 }
 
+// SetLocalDERPMap sets a DERP map, such as one loaded with derpmap.Load, to
+// merge into the DERP maps from the control server. See derpmap.Merge.
+//
+// It should only be called before the LocalBackend is used.
+func (b *LocalBackend) SetLocalDERPMap(dm *tailcfg.DERPMap) {
+	b.localDERPMap = dm
+}
+
 // SetLogFlusher sets a func to be called to flush log uploads.
 //
 // It should only be called before the LocalBackend is used.
@@ -3442,6 +3726,16 @@ func (b *LocalBackend) TryFlushLogs() bool {
 	return true
 }
 
+// DNSOSConfiguratorMode reports how the DNS manager chose the way it
+// configures the OS's DNS settings. It returns the zero value if there's no
+// DNS manager.
+func (b *LocalBackend) DNSOSConfiguratorMode() dns.ModeInfo {
+	if dm, ok := b.sys.DNSManager.GetOK(); ok {
+		return dm.OSConfiguratorMode()
+	}
+	return dns.ModeInfo{}
+}
+
 // TailscaleVarRoot returns the root directory of Tailscale's writable
 // storage area. (e.g. "/var/lib/tailscale")
 //
@@ -3674,6 +3968,13 @@ func peerRoutes(logf logger.Logf, peers []wgcfg.Peer, cgnatThreshold int) (route
 	return routes
 }
 
+// clampMSSToPMTU reports whether the MSS of TCP connections forwarded
+// through the node, such as to and from advertised subnets, is clamped to
+// the path MTU. It's needed if the node's uplink has a smaller MTU than its
+// LAN, such as with PPPoE, and ICMP "packet too big" messages are dropped
+// somewhere on the path. It's only supported on Linux.
+var clampMSSToPMTU = envknob.RegisterBool("TS_CLAMP_MSS")
+
 // routerConfig produces a router.Config from a wireguard config and IPN prefs.
 func (b *LocalBackend) routerConfig(cfg *wgcfg.Config, prefs ipn.PrefsView, oneCGNATRoute bool) *router.Config {
 	singleRouteThreshold := 10_000
@@ -3685,6 +3986,7 @@ func (b *LocalBackend) routerConfig(cfg *wgcfg.Config, prefs ipn.PrefsView, oneC
 		LocalAddrs:       unmapIPPrefixes(cfg.Addresses),
 		SubnetRoutes:     unmapIPPrefixes(prefs.AdvertiseRoutes().AsSlice()),
 		SNATSubnetRoutes: !prefs.NoSNAT(),
+		ClampMSSToPMTU:   clampMSSToPMTU(),
 		NetfilterMode:    prefs.NetfilterMode(),
 		Routes:           peerRoutes(b.logf, cfg.Peers, singleRouteThreshold),
 	}
@@ -3736,6 +4038,14 @@ func (b *LocalBackend) routerConfig(cfg *wgcfg.Config, prefs ipn.PrefsView, oneC
 		}
 	}
 
+	if runtime.GOOS == "windows" {
+		var excluded []netip.Prefix
+		rs.RouteMetric, excluded = windowsRoutePolicy(b.logf)
+		if len(excluded) > 0 {
+			rs.Routes = excludeRoutes(rs.Routes, excluded)
+		}
+	}
+
 	if slices.ContainsFunc(rs.LocalAddrs, tsaddr.PrefixIs4) {
 		rs.Routes = append(rs.Routes, netip.PrefixFrom(tsaddr.TailscaleServiceIP(), 32))
 	}
@@ -3781,6 +4091,11 @@ func (b *LocalBackend) applyPrefsToHostinfoLocked(hi *tailcfg.Hostinfo, prefs ip
 	// properly. This exists as an optimization to control to program fewer DNS
 	// records that have ingress enabled but are not actually being used.
 	hi.WireIngress = b.wantIngressLocked()
+
+	// Posture attributes are collected in the background, and sent in a
+	// Hostinfo update once they're in.
+	b.setPostureCheckingLocked(postureCheckingEnabled(prefs))
+	hi.PostureAttributes = b.postureAttrs
 }
 
 // enterState transitions the backend into newState, updating internal
@@ -3849,6 +4164,7 @@ func (b *LocalBackend) enterStateLockedOnEntry(newState ipn.State) {
 			addrStrs = append(addrStrs, addrs.At(i).Addr().String())
 		}
 		systemd.Status("Connected; %s; %s", activeLogin, strings.Join(addrStrs, " "))
+		b.confirmAutoUpdate()
 	case ipn.NoState:
 		// Do nothing.
 	default:
@@ -4016,6 +4332,10 @@ func (b *LocalBackend) resetControlClientLocked() controlclient.Client {
 		// will abort.
 		b.numClientStatusCalls.Add(1)
 	}
+	if b.keyExpiryNoticeTimer != nil {
+		b.keyExpiryNoticeTimer.Stop()
+		b.keyExpiryNoticeTimer = nil
+	}
 	prev := b.cc
 	b.cc = nil
 	b.ccAuto = nil
@@ -4050,6 +4370,34 @@ func (b *LocalBackend) ResetForClientDisconnect() {
 
 func (b *LocalBackend) ShouldRunSSH() bool { return b.sshAtomicBool.Load() && envknob.CanSSHD() }
 
+// NoteSSHSession records that the Tailscale SSH session s started or, if
+// s.End is set, ended, and sends it to the IPN bus watchers that set
+// ipn.NotifySSHSessions.
+func (b *LocalBackend) NoteSSHSession(s ipn.SSHSession) {
+	b.mu.Lock()
+	if s.End.IsZero() {
+		mak.Set(&b.sshSessions, s.ID, s)
+	} else {
+		delete(b.sshSessions, s.ID)
+	}
+	b.mu.Unlock()
+	b.send(ipn.Notify{SSHSession: &s})
+}
+
+// SSHSessions returns the running Tailscale SSH sessions, oldest first.
+func (b *LocalBackend) SSHSessions() []ipn.SSHSession {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ret := make([]ipn.SSHSession, 0, len(b.sshSessions))
+	for _, s := range b.sshSessions {
+		ret = append(ret, s)
+	}
+	slices.SortFunc(ret, func(x, y ipn.SSHSession) int {
+		return x.Start.Compare(y.Start)
+	})
+	return ret
+}
+
 // ShouldHandleViaIP reports whether ip is an IPv6 address in the
 // Tailscale ULA's v6 "via" range embedding an IPv4 address to be forwarded to
 // by Tailscale.
@@ -4173,6 +4521,7 @@ func (b *LocalBackend) setNetMapLocked(nm *netmap.NetworkMap) {
 	b.capFileSharing = fs
 
 	b.setDebugLogsByCapabilityLocked(nm)
+	b.updateCapFeaturesLocked(nm)
 
 	// See the netns package for documentation on what this capability does.
 	netns.SetBindToInterfaceByRoute(hasCapability(nm, tailcfg.CapabilityBindToInterfaceByRoute))
@@ -4299,6 +4648,8 @@ func (b *LocalBackend) setTCPPortsInterceptedFromNetmapAndPrefsLocked(prefs ipn.
 	}
 
 	b.reloadServeConfigLocked(prefs)
+	b.updateFunnelExpiryTimerLocked()
+	b.updateServeCertsLocked()
 	if b.serveConfig.Valid() {
 		servePorts := make([]uint16, 0, 3)
 		b.serveConfig.RangeOverTCPs(func(port uint16, _ ipn.TCPPortHandlerView) bool {
@@ -4341,20 +4692,21 @@ func (b *LocalBackend) setServeProxyHandlersLocked() {
 				// Only create proxy handlers for servers with a proxy backend.
 				return true
 			}
-			mak.Set(&backends, backend, true)
-			if _, ok := b.serveProxyHandlers.Load(backend); ok {
+			key := serveProxyKey(h)
+			mak.Set(&backends, key, true)
+			if _, ok := b.serveProxyHandlers.Load(key); ok {
 				return true
 			}
 
-			b.logf("serve: creating a new proxy handler for %s", backend)
-			p, err := b.proxyHandlerForBackend(backend)
+			b.logf("serve: creating a new proxy handler for %s", key)
+			p, err := b.proxyHandlerForBackend(backend, h.BackendProtocol())
 			if err != nil {
 				// The backend endpoint (h.Proxy) should have been validated by expandProxyTarget
 				// in the CLI, so just log the error here.
-				b.logf("[unexpected] could not create proxy for %v: %s", backend, err)
+				b.logf("[unexpected] could not create proxy for %v: %s", key, err)
 				return true
 			}
-			b.serveProxyHandlers.Store(backend, p)
+			b.serveProxyHandlers.Store(key, p)
 			return true
 		})
 		return true
@@ -4366,7 +4718,7 @@ func (b *LocalBackend) setServeProxyHandlersLocked() {
 		backend := key.(string)
 		if !backends[backend] {
 			b.logf("serve: closing idle connections to %s", backend)
-			value.(*httputil.ReverseProxy).Transport.(*http.Transport).CloseIdleConnections()
+			value.(*httputil.ReverseProxy).Transport.(proxyTransport).CloseIdleConnections()
 			b.serveProxyHandlers.Delete(backend)
 		}
 		return true
@@ -4931,7 +5283,7 @@ func (b *LocalBackend) sshServerOrInit() (_ SSHServer, err error) {
 	return b.sshServer, nil
 }
 
-var warnSSHSELinux = health.NewWarnable()
+var warnSSHSELinux = health.NewWarnable(health.WithName("ssh-selinux"))
 
 func (b *LocalBackend) updateSELinuxHealthWarning() {
 	if hostinfo.IsSELinuxEnforcing() {
@@ -5228,8 +5580,9 @@ func (b *LocalBackend) ResetAuth() error {
 }
 
 // StreamDebugCapture writes a pcap stream of packets traversing
-// tailscaled to the provided response writer.
-func (b *LocalBackend) StreamDebugCapture(ctx context.Context, w io.Writer) error {
+// tailscaled, or only of those selected by f if it's non-nil, to the
+// provided response writer.
+func (b *LocalBackend) StreamDebugCapture(ctx context.Context, w io.Writer, f *capture.Filter) error {
 	var s *capture.Sink
 
 	b.mu.Lock()
@@ -5242,7 +5595,7 @@ func (b *LocalBackend) StreamDebugCapture(ctx context.Context, w io.Writer) erro
 	}
 	b.mu.Unlock()
 
-	unregister := s.RegisterOutput(w)
+	unregister := s.RegisterFilteredOutput(w, f)
 
 	select {
 	case <-ctx.Done():
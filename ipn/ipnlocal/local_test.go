@@ -1157,3 +1157,33 @@ func routesEqual(t *testing.T, a, b map[dnsname.FQDN][]*dnstype.Resolver) bool {
 	}
 	return true
 }
+
+func TestSendFilterDropEventOrder(t *testing.T) {
+	b := newTestLocalBackend(t)
+	t.Cleanup(b.Shutdown)
+
+	const n = 20
+	got := make(chan uint16, n)
+	b.SetNotifyCallback(func(n ipn.Notify) {
+		if n.FilterDrop != nil {
+			got <- n.FilterDrop.Dst.Port()
+		}
+	})
+	for i := 0; i < n; i++ {
+		b.sendFilterDropEvent(filter.DropEvent{
+			Dir: "in",
+			Src: netip.MustParseAddrPort("100.64.0.1:1234"),
+			Dst: netip.AddrPortFrom(netip.MustParseAddr("100.64.0.2"), uint16(i)),
+		})
+	}
+	for i := 0; i < n; i++ {
+		select {
+		case port := <-got:
+			if port != uint16(i) {
+				t.Fatalf("event %d has port %d; want events in the order they were dropped", i, port)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("timed out waiting for event %d", i)
+		}
+	}
+}
@@ -40,6 +40,10 @@
 	errMissingNetmap        = errors.New("missing netmap: verify that you are logged in")
 	errNetworkLockNotActive = errors.New("network-lock is not active")
 
+	// ErrNetworkLockNotTrusted is returned when signing with the tailnet
+	// lock key of a node that isn't trusted by the tailnet lock.
+	ErrNetworkLockNotTrusted = errors.New("this node is not trusted by network lock")
+
 	tkaCompactionDefaults = tka.CompactionOptions{
 		MinChain: 24,                  // Keep at minimum 24 AUMs since head.
 		MinAge:   14 * 24 * time.Hour, // Keep 2 weeks of AUMs.
@@ -99,6 +103,9 @@ func (b *LocalBackend) tkaFilterNetmapLocked(nm *netmap.NetworkMap) {
 					StableID:     p.StableID(),
 					TailscaleIPs: make([]netip.Addr, p.Addresses().Len()),
 					NodeKey:      p.Key(),
+					Tags:         p.Tags().AsSlice(),
+					Owner:        nm.UserProfiles[p.User()].LoginName,
+					Created:      p.Created(),
 				}
 				for i := range p.Addresses().LenIter() {
 					addr := p.Addresses().At(i)
@@ -608,7 +615,7 @@ func (b *LocalBackend) NetworkLockSign(nodeKey key.NodePublic, rotationPublic []
 			return key.NodePublic{}, tka.NodeKeySignature{}, errNetworkLockNotActive
 		}
 		if !b.tka.authority.KeyTrusted(nlPriv.KeyID()) {
-			return key.NodePublic{}, tka.NodeKeySignature{}, errors.New("this node is not trusted by network lock")
+			return key.NodePublic{}, tka.NodeKeySignature{}, ErrNetworkLockNotTrusted
 		}
 
 		p, err := nodeKey.MarshalBinary()
@@ -719,6 +726,106 @@ func (b *LocalBackend) NetworkLockModify(addKeys, removeKeys []tka.Key) (err err
 	return nil
 }
 
+// NetworkLockRotateKey replaces this node's network-lock key with a newly
+// generated one, returning its public key.
+//
+// If the current key is trusted by the key authority, the new key is first
+// added with the same votes and metadata, in an AUM signed by the current
+// key and applied to the local authority, so that this node remains able to
+// sign. The key is only replaced once the authority trusts the new key. The
+// old key stays trusted
+// until it's removed with NetworkLockModify, after the signatures it made
+// have been re-signed with the new key.
+func (b *LocalBackend) NetworkLockRotateKey() (_ key.NLPublic, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("rotate network-lock key: %w", err)
+		}
+	}()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var (
+		ourNodeKey key.NodePublic
+		nlPriv     key.NLPrivate
+	)
+	profile := b.pm.CurrentProfile().ID
+	if p := b.pm.CurrentPrefs(); p.Valid() && p.Persist().Valid() && !p.Persist().PrivateNodeKey().IsZero() {
+		ourNodeKey = p.Persist().PublicNodeKey()
+		nlPriv = p.Persist().NetworkLockKey()
+	}
+	if ourNodeKey.IsZero() {
+		return key.NLPublic{}, errors.New("no node-key: is tailscale logged in?")
+	}
+	if nlPriv.IsZero() {
+		return key.NLPublic{}, errMissingNetmap
+	}
+	if b.tka == nil {
+		return key.NLPublic{}, errNetworkLockNotActive
+	}
+	newPriv := key.NewNLPrivate()
+
+	if b.tka.authority.KeyTrusted(nlPriv.KeyID()) {
+		var newKey tka.Key
+		for _, k := range b.tka.authority.Keys() {
+			if id, err := k.ID(); err == nil && bytes.Equal(id, nlPriv.KeyID()) {
+				newKey = k.Clone()
+				newKey.Public = newPriv.Public().Verifier()
+			}
+		}
+		updater := b.tka.authority.NewUpdater(nlPriv)
+		if err := updater.AddKey(newKey); err != nil {
+			return key.NLPublic{}, err
+		}
+		aums, err := updater.Finalize(b.tka.storage)
+		if err != nil {
+			return key.NLPublic{}, err
+		}
+
+		head := b.tka.authority.Head()
+		b.mu.Unlock()
+		resp, err := b.tkaDoSyncSend(ourNodeKey, head, aums, true)
+		b.mu.Lock()
+		if err != nil {
+			return key.NLPublic{}, err
+		}
+		var controlHead tka.AUMHash
+		if err := controlHead.UnmarshalText([]byte(resp.Head)); err != nil {
+			return key.NLPublic{}, err
+		}
+		if controlHead != aums[len(aums)-1].Hash() {
+			return key.NLPublic{}, errors.New("central tka head differs from submitted AUM, try again")
+		}
+		if b.pm.CurrentProfile().ID != profile || b.tka == nil {
+			return key.NLPublic{}, errors.New("profile changed during key rotation, try again")
+		}
+
+		// Apply the AUM locally too, rather than waiting for the next
+		// sync, so that this node can sign with the new key as soon as
+		// it's saved. Until then, the old key is kept: it's still
+		// trusted, and is the only key this node can sign with.
+		if err := b.tka.authority.Inform(b.tka.storage, aums); err != nil {
+			return key.NLPublic{}, fmt.Errorf("applying AUM: %w", err)
+		}
+		if !b.tka.authority.KeyTrusted(newPriv.KeyID()) {
+			return key.NLPublic{}, errors.New("new key is not trusted after applying AUM")
+		}
+	}
+
+	newPrefs := b.pm.CurrentPrefs().AsStruct().Clone() // .Persist should always be initialized here.
+	newPrefs.Persist.NetworkLockKey = newPriv
+	var magicDNSSuffix string
+	if b.netMap != nil {
+		magicDNSSuffix = b.netMap.MagicDNSSuffix()
+	}
+	if err := b.pm.SetPrefs(newPrefs.View(), magicDNSSuffix); err != nil {
+		return key.NLPublic{}, fmt.Errorf("saving prefs: %w", err)
+	}
+	b.logf("rotated network-lock key from %s to %s", nlPriv.Public().CLIString(), newPriv.Public().CLIString())
+	return newPriv.Public(), nil
+}
+
 // NetworkLockDisable disables network-lock using the provided disablement secret.
 func (b *LocalBackend) NetworkLockDisable(secret []byte) error {
 	var (
@@ -760,29 +867,31 @@ func (b *LocalBackend) NetworkLockLog(maxEntries int) ([]ipnstate.NetworkLockUpd
 		return nil, errNetworkLockNotActive
 	}
 
+	chain, err := tka.VerifyChainSignatures(b.tka.storage, b.tka.authority.Head(), maxEntries)
+	if err != nil {
+		return nil, fmt.Errorf("reading AUM: %w", err)
+	}
 	var out []ipnstate.NetworkLockUpdate
-	cursor := b.tka.authority.Head()
-	for i := 0; i < maxEntries; i++ {
-		aum, err := b.tka.storage.AUM(cursor)
-		if err != nil {
-			if err == os.ErrNotExist {
-				break
-			}
-			return out, fmt.Errorf("reading AUM: %w", err)
-		}
-
+	for _, v := range chain {
 		update := ipnstate.NetworkLockUpdate{
-			Hash:   cursor,
-			Change: aum.MessageKind.String(),
-			Raw:    aum.Serialize(),
+			Hash:   v.AUM.Hash(),
+			Change: v.AUM.MessageKind.String(),
+			Raw:    v.AUM.Serialize(),
 		}
-		out = append(out, update)
-
-		parent, hasParent := aum.Parent()
-		if !hasParent {
-			break
+		if v.Err != nil {
+			update.VerificationError = v.Err.Error()
 		}
-		cursor = parent
+		for _, sig := range v.Signatures {
+			st := ipnstate.NetworkLockSignatureStatus{
+				KeyID: sig.KeyID,
+				Valid: sig.Err == nil,
+			}
+			if sig.Err != nil {
+				st.Error = sig.Err.Error()
+			}
+			update.Signatures = append(update.Signatures, st)
+		}
+		out = append(out, update)
 	}
 
 	return out, nil
@@ -771,6 +771,137 @@ func TestTKASign(t *testing.T) {
 	}
 }
 
+func TestTKARotateKey(t *testing.T) {
+	nodePriv := key.NewNode()
+	nlPriv := key.NewNLPrivate()
+	toSign := key.NewNode()
+
+	pm := must.Get(newProfileManager(new(mem.Store), t.Logf))
+	must.Do(pm.SetPrefs((&ipn.Prefs{
+		Persist: &persist.Persist{
+			PrivateNodeKey: nodePriv,
+			NetworkLockKey: nlPriv,
+		},
+	}).View(), ""))
+
+	// Make a fake TKA authority, to seed local state.
+	disablementSecret := bytes.Repeat([]byte{0xa5}, 32)
+	key := tka.Key{Kind: tka.Key25519, Public: nlPriv.Public().Verifier(), Votes: 2}
+
+	temp := t.TempDir()
+	tkaPath := filepath.Join(temp, "tka-profile", string(pm.CurrentProfile().ID))
+	os.Mkdir(tkaPath, 0755)
+	chonk, err := tka.ChonkDir(tkaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authority, _, err := tka.Create(chonk, tka.State{
+		Keys:               []tka.Key{key},
+		DisablementSecrets: [][]byte{tka.DisablementKDF(disablementSecret)},
+	}, nlPriv)
+	if err != nil {
+		t.Fatalf("tka.Create() failed: %v", err)
+	}
+
+	var (
+		added  *tka.Key
+		signed bool
+	)
+	ts, client := fakeNoiseServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		switch r.URL.Path {
+		case "/machine/tka/sync/send":
+			body := new(tailcfg.TKASyncSendRequest)
+			if err := json.NewDecoder(r.Body).Decode(body); err != nil {
+				t.Fatal(err)
+			}
+			if len(body.MissingAUMs) != 1 {
+				t.Fatalf("got %d AUMs, want 1", len(body.MissingAUMs))
+			}
+			var aum tka.AUM
+			if err := aum.Unserialize(body.MissingAUMs[0]); err != nil {
+				t.Fatalf("decoding AUM: %v", err)
+			}
+			if aum.MessageKind != tka.AUMAddKey {
+				t.Errorf("AUM kind = %v, want %v", aum.MessageKind, tka.AUMAddKey)
+			}
+			added = aum.Key
+
+			head, err := aum.Hash().MarshalText()
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.WriteHeader(200)
+			if err := json.NewEncoder(w).Encode(tailcfg.TKASyncSendResponse{
+				Head: string(head),
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+		case "/machine/tka/sign":
+			body := new(tailcfg.TKASubmitSignatureRequest)
+			if err := json.NewDecoder(r.Body).Decode(body); err != nil {
+				t.Fatal(err)
+			}
+			if err := authority.NodeKeyAuthorized(toSign.Public(), body.Signature); err != nil {
+				t.Errorf("signature does not verify: %v", err)
+			}
+			signed = true
+			w.WriteHeader(200)
+			if err := json.NewEncoder(w).Encode(tailcfg.TKASubmitSignatureResponse{}); err != nil {
+				t.Fatal(err)
+			}
+
+		default:
+			t.Errorf("unhandled endpoint path: %v", r.URL.Path)
+			w.WriteHeader(404)
+		}
+	}))
+	defer ts.Close()
+	cc := fakeControlClient(t, client)
+	b := LocalBackend{
+		varRoot: temp,
+		cc:      cc,
+		ccAuto:  cc,
+		logf:    t.Logf,
+		tka: &tkaState{
+			authority: authority,
+			storage:   chonk,
+		},
+		pm:    pm,
+		store: pm.Store(),
+	}
+
+	newPub, err := b.NetworkLockRotateKey()
+	if err != nil {
+		t.Fatalf("NetworkLockRotateKey() failed: %v", err)
+	}
+	if newPub == nlPriv.Public() {
+		t.Error("key was not rotated")
+	}
+	if got := pm.CurrentPrefs().Persist().NetworkLockKey().Public(); got != newPub {
+		t.Errorf("persisted key = %v, want %v", got.CLIString(), newPub.CLIString())
+	}
+	if added == nil {
+		t.Fatal("new key was not added to the authority")
+	}
+	if !bytes.Equal(added.Public, newPub.Verifier()) || added.Votes != key.Votes {
+		t.Errorf("added key = %+v, want %x with %d votes", added, []byte(newPub.Verifier()), key.Votes)
+	}
+
+	// The local authority trusts the new key right away, so this node can
+	// sign with it, such as to re-sign what the old key signed.
+	if !authority.KeyTrusted(newPub.KeyID()) {
+		t.Fatal("new key is not trusted by the local authority")
+	}
+	if err := b.NetworkLockSign(toSign.Public(), nil); err != nil {
+		t.Fatalf("NetworkLockSign() after rotation failed: %v", err)
+	}
+	if !signed {
+		t.Error("signature was not submitted")
+	}
+}
+
 func TestTKAForceDisable(t *testing.T) {
 	nodePriv := key.NewNode()
 
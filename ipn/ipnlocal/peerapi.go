@@ -5,7 +5,9 @@
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -94,6 +96,10 @@ type peerAPIServer struct {
 	// permitted to be uploaded directly on any platform, like
 	// partial files.
 	deletedSuffix = ".deleted"
+
+	// partialMaxAge is how long the partial file of an interrupted
+	// transfer is kept for the sender to resume it.
+	partialMaxAge = 48 * time.Hour
 )
 
 func validFilenameRune(r rune) bool {
@@ -225,6 +231,11 @@ func (s *peerAPIServer) WaitingFiles() (ret []apitype.WaitingFile, err error) {
 		for _, de := range des {
 			name := de.Name()
 			if strings.HasSuffix(name, partialSuffix) {
+				// Lazily clean up the partial files of interrupted
+				// transfers that were never resumed.
+				if fi, err := de.Info(); err == nil && s.b.clock.Since(fi.ModTime()) > partialMaxAge {
+					os.Remove(filepath.Join(s.rootDir, name))
+				}
 				continue
 			}
 			if name, ok := strings.CutSuffix(name, deletedSuffix); ok { // for Windows + tests
@@ -1035,7 +1046,37 @@ func (h *peerAPIHandler) canPutFile() bool {
 		// Unsigned peers can't send files.
 		return false
 	}
-	return h.isSelf || h.peerHasCap(tailcfg.PeerCapabilityFileSharingSend)
+	return h.isSelf || h.peerHasCap(tailcfg.PeerCapabilityFileSharingSend) || h.peerHasAutoAcceptTag()
+}
+
+// peerHasAutoAcceptTag reports whether the peer has one of the tags that
+// this node accepts files from, per tailcfg.NodeAttrTaildropAutoAccept.
+func (h *peerAPIHandler) peerHasAutoAcceptTag() bool {
+	b := h.ps.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, t := range b.taildropAutoAcceptTags {
+		if views.SliceContains(h.peerNode.Tags(), t) {
+			return true
+		}
+	}
+	return false
+}
+
+// canReadMetrics reports whether h can read this node's client metrics,
+// either as a debugger or per tailcfg.NodeAttrServeMetrics.
+func (h *peerAPIHandler) canReadMetrics() bool {
+	if h.canDebug() {
+		return true
+	}
+	b := h.ps.b
+	b.mu.Lock()
+	serve := b.capServeMetrics
+	b.mu.Unlock()
+	if !serve || h.peerNode.UnsignedPeerAPIOnly() {
+		return false
+	}
+	return h.isSelf || h.peerHasCap(tailcfg.PeerCapabilityDebugPeer)
 }
 
 // canDebug reports whether h can debug this node (goroutines, metrics,
@@ -1084,8 +1125,8 @@ func (h *peerAPIHandler) handlePeerPut(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "file sharing not enabled by Tailscale admin", http.StatusForbidden)
 		return
 	}
-	if r.Method != "PUT" {
-		http.Error(w, "expected method PUT", http.StatusMethodNotAllowed)
+	if r.Method != "PUT" && r.Method != "GET" {
+		http.Error(w, "expected method PUT or GET", http.StatusMethodNotAllowed)
 		return
 	}
 	if h.ps.rootDir == "" {
@@ -1120,6 +1161,19 @@ func (h *peerAPIHandler) handlePeerPut(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "bad filename", 400)
 		return
 	}
+	partialFile := dstFile + partialSuffix
+	if r.Method == "GET" {
+		h.servePartialFileInfo(w, partialFile)
+		return
+	}
+	var offset int64
+	if v := r.URL.Query().Get("offset"); v != "" {
+		offset, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || offset < 0 {
+			http.Error(w, "bad offset", 400)
+			return
+		}
+	}
 	t0 := h.ps.b.clock.Now()
 	// TODO(bradfitz): prevent same filename being sent by two peers at once
 
@@ -1129,28 +1183,38 @@ func (h *peerAPIHandler) handlePeerPut(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	partialFile := dstFile + partialSuffix
-	f, err := os.Create(partialFile)
+	f, err := openPartialFile(partialFile, offset)
 	if err != nil {
+		if errors.Is(err, errBadResumeOffset) {
+			http.Error(w, err.Error(), http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
 		h.logf("put Create error: %v", redactErr(err))
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	var success bool
+	// success is whether the file was received; keepPartial is whether
+	// the partial file should be kept anyway, for the sender to resume.
+	var success, keepPartial bool
 	defer func() {
-		if !success {
+		if !success && !keepPartial {
 			os.Remove(partialFile)
 		}
 	}()
 	var finalSize int64
 	var inFile *incomingFile
 	if r.ContentLength != 0 {
+		size := r.ContentLength
+		if size > 0 {
+			size += offset
+		}
 		inFile = &incomingFile{
 			name:    baseName,
 			started: h.ps.b.clock.Now(),
-			size:    r.ContentLength,
+			size:    size,
 			w:       f,
 			ph:      h,
+			copied:  offset,
 		}
 		if h.ps.directFileMode {
 			inFile.partialPath = partialFile
@@ -1162,10 +1226,17 @@ func (h *peerAPIHandler) handlePeerPut(w http.ResponseWriter, r *http.Request) {
 			err = redactErr(err)
 			f.Close()
 			h.logf("put Copy error: %v", err)
+			// The transfer was interrupted. Keep what arrived, so
+			// that the sender can resume rather than start over.
+			// In direct mode, the partial file is in the user's
+			// download directory, so don't leave it lying around.
+			keepPartial = !h.ps.directFileMode
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		finalSize = n
+		finalSize = offset + n
+	} else {
+		finalSize = offset
 	}
 	if err := redactErr(f.Close()); err != nil {
 		h.logf("put Close error: %v", err)
@@ -1193,9 +1264,70 @@ func (h *peerAPIHandler) handlePeerPut(w http.ResponseWriter, r *http.Request) {
 	success = true
 	io.WriteString(w, "{}\n")
 	h.ps.knownEmpty.Store(false)
+	h.ps.b.autoAcceptFile(h.ps, baseName)
 	h.ps.b.sendFileNotify()
 }
 
+// errBadResumeOffset is returned by openPartialFile when asked to resume
+// a transfer at an offset past the end of what was received.
+var errBadResumeOffset = errors.New("resume offset beyond partial file")
+
+// openPartialFile opens the partial file path to write at offset. An offset
+// of zero starts over with a new file; otherwise offset must not be past
+// the end of the existing partial file, which is truncated to offset so
+// that a sender can also resume at an earlier point.
+func openPartialFile(path string, offset int64) (*os.File, error) {
+	if offset == 0 {
+		return os.Create(path)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if os.IsNotExist(err) {
+		return nil, errBadResumeOffset
+	}
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err == nil && fi.Size() < offset {
+		err = errBadResumeOffset
+	}
+	if err == nil {
+		err = f.Truncate(offset)
+	}
+	if err == nil {
+		_, err = f.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// servePartialFileInfo replies with what was received of the interrupted
+// transfer whose partial file is path, as an apitype.PartialFileInfo.
+func (h *peerAPIHandler) servePartialFileInfo(w http.ResponseWriter, path string) {
+	var res apitype.PartialFileInfo
+	f, err := os.Open(path)
+	if err == nil {
+		defer f.Close()
+		hash := sha256.New()
+		res.Size, err = io.Copy(hash, f)
+		res.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	}
+	if err != nil && !os.IsNotExist(err) {
+		err = redactErr(err)
+		h.logf("put partial info: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err != nil || res.Size == 0 {
+		res = apitype.PartialFileInfo{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
 func approxSize(n int64) string {
 	if n <= 1<<10 {
 		return "<=1KB"
@@ -1251,8 +1383,8 @@ func (h *peerAPIHandler) handleServeMagicsock(w http.ResponseWriter, r *http.Req
 }
 
 func (h *peerAPIHandler) handleServeMetrics(w http.ResponseWriter, r *http.Request) {
-	if !h.canDebug() {
-		http.Error(w, "denied; no debug access", http.StatusForbidden)
+	if !h.canReadMetrics() {
+		http.Error(w, "denied; no metrics access", http.StatusForbidden)
 		return
 	}
 	w.Header().Set("Content-Type", "text/plain")
@@ -5,6 +5,8 @@
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -18,6 +20,7 @@
 	"runtime"
 	"strings"
 	"testing"
+	"testing/iotest"
 
 	"go4.org/netipx"
 	"tailscale.com/ipn"
@@ -108,14 +111,30 @@ func hexAll(v string) string {
 	return sb.String()
 }
 
+// interruptedPut returns a PUT request to path whose body fails after
+// sending contents, as if the connection were lost.
+func interruptedPut(path, contents string) *http.Request {
+	return httptest.NewRequest("PUT", path, io.MultiReader(
+		strings.NewReader(contents),
+		iotest.ErrReader(errors.New("connection lost")),
+	))
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
 func TestHandlePeerAPI(t *testing.T) {
 	const nodeFQDN = "self-node.tail-scale.ts.net."
 	tests := []struct {
 		name       string
-		isSelf     bool // the peer sending the request is owned by us
-		capSharing bool // self node has file sharing capability
-		debugCap   bool // self node has debug capability
-		omitRoot   bool // don't configure
+		isSelf     bool               // the peer sending the request is owned by us
+		capSharing bool               // self node has file sharing capability
+		debugCap   bool               // self node has debug capability
+		capMap     tailcfg.NodeCapMap // cap features of the self node
+		peerTags   []string           // tags of the peer sending the request
+		omitRoot   bool               // don't configure
 		reqs       []*http.Request
 		checks     []check
 	}{
@@ -165,6 +184,50 @@ func TestHandlePeerAPI(t *testing.T) {
 				bodyContains("ServeHTTP"),
 			),
 		},
+		{
+			name:   "metrics/deny-self-no-cap",
+			isSelf: true,
+			reqs:   []*http.Request{httptest.NewRequest("GET", "/v0/metrics", nil)},
+			checks: checks(httpStatus(403)),
+		},
+		{
+			name:   "metrics/accept-self-serve-metrics",
+			isSelf: true,
+			capMap: tailcfg.NodeCapMap{tailcfg.NodeAttrServeMetrics: nil},
+			reqs:   []*http.Request{httptest.NewRequest("GET", "/v0/metrics", nil)},
+			checks: checks(httpStatus(200)),
+		},
+		{
+			name:   "metrics/deny-nonself-serve-metrics",
+			isSelf: false,
+			capMap: tailcfg.NodeCapMap{tailcfg.NodeAttrServeMetrics: nil},
+			reqs:   []*http.Request{httptest.NewRequest("GET", "/v0/metrics", nil)},
+			checks: checks(httpStatus(403)),
+		},
+		{
+			name:       "put/accept-auto-accept-tag",
+			isSelf:     false,
+			capSharing: true,
+			capMap:     tailcfg.NodeCapMap{tailcfg.NodeAttrTaildropAutoAccept: {`{"tags":["tag:ci"]}`}},
+			peerTags:   []string{"tag:ci"},
+			reqs:       []*http.Request{httptest.NewRequest("PUT", "/v0/put/foo", strings.NewReader("contents"))},
+			checks: checks(
+				httpStatus(200),
+				fileHasContents("foo", "contents"),
+			),
+		},
+		{
+			name:       "put/reject-other-tag",
+			isSelf:     false,
+			capSharing: true,
+			capMap:     tailcfg.NodeCapMap{tailcfg.NodeAttrTaildropAutoAccept: {`{"tags":["tag:ci"]}`}},
+			peerTags:   []string{"tag:other"},
+			reqs:       []*http.Request{httptest.NewRequest("PUT", "/v0/put/foo", strings.NewReader("contents"))},
+			checks: checks(
+				httpStatus(http.StatusForbidden),
+				bodyContains("Taildrop access denied"),
+			),
+		},
 		{
 			name:       "reject_non_owner_put",
 			isSelf:     false,
@@ -364,6 +427,98 @@ func TestHandlePeerAPI(t *testing.T) {
 				fileHasContents("Томас и его друзья.mp3", "главный озорник"),
 			),
 		},
+		{
+			name:       "put_interrupted_keeps_partial",
+			isSelf:     true,
+			capSharing: true,
+			reqs:       []*http.Request{interruptedPut("/v0/put/foo", "cont")},
+			checks: checks(
+				httpStatus(500),
+				fileHasContents("foo.partial", "cont"),
+			),
+		},
+		{
+			name:       "put_partial_info",
+			isSelf:     true,
+			capSharing: true,
+			reqs: []*http.Request{
+				interruptedPut("/v0/put/foo", "cont"),
+				httptest.NewRequest("GET", "/v0/put/foo", nil),
+			},
+			checks: checks(
+				httpStatus(200),
+				bodyContains(`"Size":4`),
+				bodyContains(sha256Hex("cont")),
+			),
+		},
+		{
+			name:       "put_partial_info_none",
+			isSelf:     true,
+			capSharing: true,
+			reqs:       []*http.Request{httptest.NewRequest("GET", "/v0/put/foo", nil)},
+			checks: checks(
+				httpStatus(200),
+				bodyContains(`{"Size":0}`),
+			),
+		},
+		{
+			name:       "put_resume",
+			isSelf:     true,
+			capSharing: true,
+			reqs: []*http.Request{
+				interruptedPut("/v0/put/foo", "cont"),
+				httptest.NewRequest("PUT", "/v0/put/foo?offset=4", strings.NewReader("ents")),
+			},
+			checks: checks(
+				httpStatus(200),
+				fileHasContents("foo", "contents"),
+			),
+		},
+		{
+			name:       "put_resume_earlier_offset",
+			isSelf:     true,
+			capSharing: true,
+			reqs: []*http.Request{
+				interruptedPut("/v0/put/foo", "cont"),
+				httptest.NewRequest("PUT", "/v0/put/foo?offset=2", strings.NewReader("ntents")),
+			},
+			checks: checks(
+				httpStatus(200),
+				fileHasContents("foo", "contents"),
+			),
+		},
+		{
+			name:       "put_resume_past_partial",
+			isSelf:     true,
+			capSharing: true,
+			reqs: []*http.Request{
+				interruptedPut("/v0/put/foo", "cont"),
+				httptest.NewRequest("PUT", "/v0/put/foo?offset=5", strings.NewReader("nts")),
+			},
+			checks: checks(
+				httpStatus(http.StatusRequestedRangeNotSatisfiable),
+				fileHasContents("foo.partial", "cont"),
+			),
+		},
+		{
+			name:       "put_resume_no_partial",
+			isSelf:     true,
+			capSharing: true,
+			reqs:       []*http.Request{httptest.NewRequest("PUT", "/v0/put/foo?offset=4", strings.NewReader("ents"))},
+			checks: checks(
+				httpStatus(http.StatusRequestedRangeNotSatisfiable),
+			),
+		},
+		{
+			name:       "put_bad_offset",
+			isSelf:     true,
+			capSharing: true,
+			reqs:       []*http.Request{httptest.NewRequest("PUT", "/v0/put/foo?offset=-1", strings.NewReader("x"))},
+			checks: checks(
+				httpStatus(400),
+				bodyContains("bad offset"),
+			),
+		},
 		{
 			name:       "put_invalid_utf8",
 			isSelf:     true,
@@ -472,18 +627,22 @@ func TestHandlePeerAPI(t *testing.T) {
 			if tt.debugCap {
 				selfNode.Capabilities = append(selfNode.Capabilities, tailcfg.CapabilityDebug)
 			}
+			selfNode.CapMap = tt.capMap
 			var e peerAPITestEnv
 			lb := &LocalBackend{
 				logf:           e.logBuf.Logf,
 				capFileSharing: tt.capSharing,
 				netMap:         &netmap.NetworkMap{SelfNode: selfNode.View()},
 				clock:          &tstest.Clock{},
+				pm:             must.Get(newProfileManager(new(mem.Store), logger.Discard)),
 			}
+			lb.updateCapFeaturesLocked(lb.netMap)
 			e.ph = &peerAPIHandler{
 				isSelf:   tt.isSelf,
 				selfNode: selfNode.View(),
 				peerNode: (&tailcfg.Node{
 					ComputedName: "some-peer-name",
+					Tags:         tt.peerTags,
 				}).View(),
 				ps: &peerAPIServer{
 					b: lb,
@@ -530,6 +689,7 @@ func TestFileDeleteRace(t *testing.T) {
 			logf:           t.Logf,
 			capFileSharing: true,
 			clock:          &tstest.Clock{},
+			pm:             must.Get(newProfileManager(new(mem.Store), t.Logf)),
 		},
 		rootDir: dir,
 	}
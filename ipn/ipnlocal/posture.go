@@ -0,0 +1,80 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"context"
+	"maps"
+	"time"
+
+	"tailscale.com/ipn"
+	"tailscale.com/posture"
+	"tailscale.com/util/winutil/policy"
+)
+
+const (
+	// postureRefreshInterval is how often posture attributes are
+	// collected again while posture checking is on.
+	postureRefreshInterval = time.Hour
+	// postureCollectTimeout is how long collecting them may take.
+	postureCollectTimeout = time.Minute
+)
+
+// postureCheckingEnabled reports whether posture attributes may be collected
+// and sent to control: the PostureChecking system policy decides if it's set
+// to "always" or "never", and the PostureChecking pref otherwise.
+func postureCheckingEnabled(prefs ipn.PrefsView) bool {
+	switch policy.GetString(policy.PostureChecking) {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	return prefs.PostureChecking()
+}
+
+// setPostureCheckingLocked starts or stops collecting posture attributes.
+// When it's started, they're collected right away and then every
+// postureRefreshInterval; when it's stopped, the collected ones are
+// dropped.
+//
+// b.mu must be held.
+func (b *LocalBackend) setPostureCheckingLocked(on bool) {
+	if on == (b.postureTimer != nil) {
+		return
+	}
+	b.postureGen++
+	if !on {
+		b.postureTimer.Stop()
+		b.postureTimer = nil
+		b.postureAttrs = nil
+		return
+	}
+	gen := b.postureGen
+	b.postureTimer = b.clock.AfterFunc(0, func() { b.collectPosture(gen) })
+}
+
+// collectPosture collects the posture attributes and sends them to control
+// if they changed, unless posture checking was stopped, or stopped and
+// started again, since generation gen of it started.
+func (b *LocalBackend) collectPosture(gen int) {
+	ctx, cancel := context.WithTimeout(b.ctx, postureCollectTimeout)
+	attrs := posture.Collect(ctx, b.logf)
+	cancel()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if gen != b.postureGen {
+		return
+	}
+	b.postureTimer = b.clock.AfterFunc(postureRefreshInterval, func() { b.collectPosture(gen) })
+	if maps.Equal(attrs, b.postureAttrs) {
+		return
+	}
+	b.postureAttrs = attrs
+	if b.hostinfo != nil {
+		b.hostinfo.PostureAttributes = attrs
+		go b.doSetHostinfoFilterServices(b.hostinfo.Clone())
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tailscale.com/ipn"
+	"tailscale.com/posture"
+	"tailscale.com/tailcfg"
+	"tailscale.com/tstest"
+)
+
+func TestPostureChecking(t *testing.T) {
+	const attr = "custom:ipnlocalTest"
+	var value atomic.Value
+	value.Store("1")
+	posture.Register(attr, func(context.Context) (string, error) {
+		return value.Load().(string), nil
+	})
+
+	b := newTestLocalBackend(t)
+	t.Cleanup(b.Shutdown)
+	b.mu.Lock()
+	b.hostinfo = new(tailcfg.Hostinfo)
+	b.mu.Unlock()
+
+	applyPrefs := func(on bool) *tailcfg.Hostinfo {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		hi := b.hostinfo.Clone()
+		b.applyPrefsToHostinfoLocked(hi, (&ipn.Prefs{PostureChecking: on}).View())
+		b.hostinfo = hi
+		return hi.Clone()
+	}
+	waitForAttr := func(want string) {
+		t.Helper()
+		err := tstest.WaitFor(5*time.Second, func() error {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if got := b.hostinfo.PostureAttributes[attr]; got != want {
+				return errors.New("posture attribute " + attr + " is " + got + ", want " + want)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Without consent, nothing is collected.
+	if hi := applyPrefs(false); hi.PostureAttributes != nil {
+		t.Fatalf("PostureAttributes = %v with posture checking off", hi.PostureAttributes)
+	}
+
+	// With it, the attributes are collected in the background.
+	applyPrefs(true)
+	waitForAttr("1")
+	if hi := applyPrefs(true); hi.PostureAttributes[attr] != "1" {
+		t.Errorf("PostureAttributes = %v after prefs change; want %s kept", hi.PostureAttributes, attr)
+	}
+
+	// Turning it off drops them.
+	if hi := applyPrefs(false); hi.PostureAttributes != nil {
+		t.Fatalf("PostureAttributes = %v after turning posture checking off", hi.PostureAttributes)
+	}
+
+	// Turning it back on collects them again.
+	value.Store("2")
+	applyPrefs(true)
+	waitForAttr("2")
+}
@@ -0,0 +1,104 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"tailscale.com/ipn"
+)
+
+// errPresetNotFound is returned for a PrefsPreset name that doesn't exist.
+var errPresetNotFound = errors.New("preset not found")
+
+func (b *LocalBackend) prefsPresetsLocked() ([]ipn.PrefsPreset, error) {
+	j, err := b.store.ReadState(ipn.PrefsPresetsKey(b.pm.CurrentProfile().ID))
+	if errors.Is(err, ipn.ErrStateNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var presets []ipn.PrefsPreset
+	if err := json.Unmarshal(j, &presets); err != nil {
+		return nil, err
+	}
+	return presets, nil
+}
+
+func (b *LocalBackend) setPrefsPresetsLocked(presets []ipn.PrefsPreset) error {
+	j, err := json.Marshal(presets)
+	if err != nil {
+		return err
+	}
+	return b.store.WriteState(ipn.PrefsPresetsKey(b.pm.CurrentProfile().ID), j)
+}
+
+// PrefsPresets returns the prefs presets of the current profile, sorted by
+// name.
+func (b *LocalBackend) PrefsPresets() ([]ipn.PrefsPreset, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.prefsPresetsLocked()
+}
+
+// SavePrefsPreset saves the current prefs as the preset name of the current
+// profile, replacing any existing preset of that name.
+func (b *LocalBackend) SavePrefsPreset(name string) (ipn.PrefsPreset, error) {
+	if err := ipn.CheckPrefsPresetName(name); err != nil {
+		return ipn.PrefsPreset{}, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	presets, err := b.prefsPresetsLocked()
+	if err != nil {
+		return ipn.PrefsPreset{}, fmt.Errorf("reading presets: %w", err)
+	}
+	preset := ipn.NewPrefsPreset(name, b.pm.CurrentPrefs())
+	presets = slices.DeleteFunc(presets, func(p ipn.PrefsPreset) bool { return p.Name == name })
+	presets = append(presets, preset)
+	slices.SortFunc(presets, func(x, y ipn.PrefsPreset) int {
+		return cmp.Compare(x.Name, y.Name)
+	})
+	if err := b.setPrefsPresetsLocked(presets); err != nil {
+		return ipn.PrefsPreset{}, err
+	}
+	return preset, nil
+}
+
+// DeletePrefsPreset deletes the preset name of the current profile.
+func (b *LocalBackend) DeletePrefsPreset(name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	presets, err := b.prefsPresetsLocked()
+	if err != nil {
+		return fmt.Errorf("reading presets: %w", err)
+	}
+	n := len(presets)
+	presets = slices.DeleteFunc(presets, func(p ipn.PrefsPreset) bool { return p.Name == name })
+	if len(presets) == n {
+		return errPresetNotFound
+	}
+	return b.setPrefsPresetsLocked(presets)
+}
+
+// UsePrefsPreset applies the preset name of the current profile to the
+// current prefs, and returns the new prefs.
+func (b *LocalBackend) UsePrefsPreset(name string) (ipn.PrefsView, error) {
+	b.mu.Lock()
+	presets, err := b.prefsPresetsLocked()
+	b.mu.Unlock()
+	if err != nil {
+		return ipn.PrefsView{}, fmt.Errorf("reading presets: %w", err)
+	}
+	i := slices.IndexFunc(presets, func(p ipn.PrefsPreset) bool { return p.Name == name })
+	if i < 0 {
+		return ipn.PrefsView{}, errPresetNotFound
+	}
+	return b.EditPrefs(presets[i].MaskedPrefs())
+}
@@ -0,0 +1,84 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"errors"
+	"testing"
+
+	"tailscale.com/ipn"
+	"tailscale.com/tailcfg"
+)
+
+func TestPrefsPresets(t *testing.T) {
+	b := newTestLocalBackend(t)
+	// EditPrefs applies prefs to the Hostinfo, which Start would create.
+	b.hostinfo = &tailcfg.Hostinfo{OS: "testos"}
+
+	edit := func(mp *ipn.MaskedPrefs) {
+		t.Helper()
+		if _, err := b.EditPrefs(mp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	edit(&ipn.MaskedPrefs{
+		Prefs:         ipn.Prefs{ExitNodeID: "work-exit", RouteAll: true, ShieldsUp: true},
+		ExitNodeIDSet: true,
+		RouteAllSet:   true,
+		ShieldsUpSet:  true,
+	})
+	if _, err := b.SavePrefsPreset("work"); err != nil {
+		t.Fatal(err)
+	}
+	edit(&ipn.MaskedPrefs{
+		Prefs:         ipn.Prefs{Hostname: "laptop"},
+		ExitNodeIDSet: true,
+		RouteAllSet:   true,
+		ShieldsUpSet:  true,
+		HostnameSet:   true,
+	})
+	if _, err := b.SavePrefsPreset("home"); err != nil {
+		t.Fatal(err)
+	}
+
+	presets, err := b.PrefsPresets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(presets) != 2 || presets[0].Name != "home" || presets[1].Name != "work" {
+		t.Fatalf("presets = %+v; want home and work", presets)
+	}
+
+	p, err := b.UsePrefsPreset("work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ExitNodeID() != "work-exit" || !p.RouteAll() || !p.ShieldsUp() {
+		t.Errorf("after using work: %v", p.Pretty())
+	}
+	if p.Hostname() != "laptop" {
+		t.Errorf("using a preset changed the hostname to %q", p.Hostname())
+	}
+
+	p, err = b.UsePrefsPreset("home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ExitNodeID() != "" || p.RouteAll() || p.ShieldsUp() {
+		t.Errorf("after using home: %v", p.Pretty())
+	}
+
+	if err := b.DeletePrefsPreset("work"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.UsePrefsPreset("work"); !errors.Is(err, errPresetNotFound) {
+		t.Errorf("using deleted preset: %v; want %v", err, errPresetNotFound)
+	}
+	if err := b.DeletePrefsPreset("work"); !errors.Is(err, errPresetNotFound) {
+		t.Errorf("deleting deleted preset: %v; want %v", err, errPresetNotFound)
+	}
+	if _, err := b.SavePrefsPreset("has space"); err == nil {
+		t.Error("saving preset with invalid name succeeded")
+	}
+}
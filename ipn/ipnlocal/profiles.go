@@ -16,10 +16,11 @@
 
 	"tailscale.com/envknob"
 	"tailscale.com/ipn"
+	"tailscale.com/tailcfg"
 	"tailscale.com/types/logger"
 	"tailscale.com/util/clientmetric"
 	"tailscale.com/util/cmpx"
-	"tailscale.com/util/winutil"
+	"tailscale.com/util/winutil/policy"
 )
 
 var errAlreadyMigrated = errors.New("profile migration already completed")
@@ -258,6 +259,9 @@ func (pm *profileManager) SetPrefs(prefsIn ipn.PrefsView, tailnetMagicDNSName st
 	if tailnetMagicDNSName != "" {
 		cp.TailnetMagicDNSName = tailnetMagicDNSName
 	}
+	if cp != pm.currentProfile || cp.LastUsed.IsZero() {
+		cp.LastUsed = time.Now()
+	}
 	pm.knownProfiles[cp.ID] = cp
 	pm.currentProfile = cp
 	if err := pm.writeKnownProfiles(); err != nil {
@@ -341,6 +345,10 @@ func (pm *profileManager) SwitchProfile(id ipn.ProfileID) error {
 	}
 	pm.prefs = prefs
 	pm.currentProfile = kp
+	kp.LastUsed = time.Now()
+	if err := pm.writeKnownProfiles(); err != nil {
+		pm.logf("writing profiles: %v", err)
+	}
 	return pm.setAsUserSelectedProfileLocked()
 }
 
@@ -452,26 +460,39 @@ func (pm *profileManager) NewProfile() {
 	prefs.LoggedOut = true
 	prefs.WantRunning = false
 
-	controlURL, _ := winutil.GetPolicyString("LoginURL")
-	prefs.ControlURL = controlURL
+	prefs.ControlURL = policy.GetString(policy.ControlURL)
 
 	prefs.ExitNodeIP = resolveExitNodeIP(netip.Addr{})
+	prefs.ExitNodeFailover = resolveExitNodeFailover(nil)
 
 	// Allow Incoming (used by the UI) is the negation of ShieldsUp (used by the
 	// backend), so this has to convert between the two conventions.
-	shieldsUp, _ := winutil.GetPolicyString("AllowIncomingConnections")
-	prefs.ShieldsUp = shieldsUp == "never"
-	forceDaemon, _ := winutil.GetPolicyString("UnattendedMode")
-	prefs.ForceDaemon = forceDaemon == "always"
+	prefs.ShieldsUp = policy.GetString(policy.EnableIncomingConnections) == "never"
+	prefs.ForceDaemon = policy.GetString(policy.UnattendedMode) == "always"
 
 	return prefs.View()
 }()
 
 func resolveExitNodeIP(defIP netip.Addr) (ret netip.Addr) {
 	ret = defIP
-	if exitNode, _ := winutil.GetPolicyString("ExitNodeIP"); exitNode != "" {
-		if ip, err := netip.ParseAddr(exitNode); err == nil {
-			ret = ip
+	if exitNode := policy.GetString(policy.ExitNodeIP); exitNode != "" {
+		ret = netip.MustParseAddr(exitNode) // validated by GetString
+	}
+	return ret
+}
+
+// resolveExitNodeFailover returns the exit node failover list set by the
+// ExitNodeFailover system policy, a comma-separated list of stable node
+// IDs, or def if the policy isn't set.
+func resolveExitNodeFailover(def []tailcfg.StableNodeID) []tailcfg.StableNodeID {
+	pol := policy.GetString(policy.ExitNodeFailover)
+	if pol == "" {
+		return def
+	}
+	var ret []tailcfg.StableNodeID
+	for _, id := range strings.Split(pol, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ret = append(ret, tailcfg.StableNodeID(id))
 		}
 	}
 	return ret
@@ -497,6 +518,28 @@ func ReadStartupPrefsForTest(logf logger.Logf, store ipn.StateStore) (ipn.PrefsV
 	return pm.CurrentPrefs(), nil
 }
 
+// StartupDNSMode returns the DNSMode preference of the profile that
+// tailscaled starts with, or the empty string if there's none. Unlike
+// creating a LocalBackend, it doesn't write to store.
+func StartupDNSMode(store ipn.StateStore) (string, error) {
+	key, err := readAutoStartKey(store, envknob.GOOS())
+	if err != nil || key == "" {
+		return "", err
+	}
+	bs, err := store.ReadState(key)
+	if err == ipn.ErrStateNotExist || len(bs) == 0 {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	prefs, err := ipn.PrefsFromBytes(bs)
+	if err != nil {
+		return "", fmt.Errorf("PrefsFromBytes: %v", err)
+	}
+	return prefs.DNSMode, nil
+}
+
 // newProfileManager creates a new ProfileManager using the provided StateStore.
 // It also loads the list of known profiles from the StateStore.
 func newProfileManager(store ipn.StateStore, logf logger.Logf) (*profileManager, error) {
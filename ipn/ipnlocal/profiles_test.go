@@ -8,6 +8,7 @@
 	"os/user"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
@@ -75,6 +76,34 @@ func TestProfileCurrentUserSwitch(t *testing.T) {
 	}
 }
 
+func TestStartupDNSMode(t *testing.T) {
+	store := new(mem.Store)
+	if got, err := StartupDNSMode(store); err != nil || got != "" {
+		t.Fatalf("StartupDNSMode(empty store) = %q, %v; want empty", got, err)
+	}
+
+	pm, err := newProfileManagerWithGOOS(store, logger.Discard, "linux")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := pm.CurrentPrefs().AsStruct()
+	p.DNSMode = "direct"
+	p.Persist = &persist.Persist{
+		NodeID:         "1",
+		PrivateNodeKey: key.NewNode(),
+		UserProfile: tailcfg.UserProfile{
+			ID:        1,
+			LoginName: "user1",
+		},
+	}
+	if err := pm.SetPrefs(p.View(), ""); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := StartupDNSMode(store); err != nil || got != "direct" {
+		t.Fatalf("StartupDNSMode = %q, %v; want %q", got, err, "direct")
+	}
+}
+
 func TestProfileList(t *testing.T) {
 	store := new(mem.Store)
 
@@ -138,6 +167,54 @@ func TestProfileList(t *testing.T) {
 	checkProfiles(t, "carol")
 }
 
+func TestProfileLastUsed(t *testing.T) {
+	store := new(mem.Store)
+	pm, err := newProfileManagerWithGOOS(store, logger.Discard, "linux")
+	if err != nil {
+		t.Fatal(err)
+	}
+	login := func(id int, loginName string) *ipn.LoginProfile {
+		pm.NewProfile()
+		p := pm.CurrentPrefs().AsStruct()
+		p.Persist = &persist.Persist{
+			NodeID: tailcfg.StableNodeID(fmt.Sprint(id)),
+			UserProfile: tailcfg.UserProfile{
+				ID:        tailcfg.UserID(id),
+				LoginName: loginName,
+			},
+		}
+		if err := pm.SetPrefs(p.View(), ""); err != nil {
+			t.Fatal(err)
+		}
+		return pm.currentProfile
+	}
+	alice := login(1, "alice")
+	aliceLogin := alice.LastUsed
+	bob := login(2, "bob")
+	if aliceLogin.IsZero() || bob.LastUsed.Before(aliceLogin) {
+		t.Fatalf("LastUsed after login: alice %v, bob %v", aliceLogin, bob.LastUsed)
+	}
+
+	if err := pm.SwitchProfile(alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	if alice.LastUsed.Before(bob.LastUsed) {
+		t.Errorf("alice LastUsed = %v after switching; want at least bob's %v", alice.LastUsed, bob.LastUsed)
+	}
+
+	// LastUsed is persisted.
+	pm, err = newProfileManagerWithGOOS(store, logger.Discard, "linux")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range pm.Profiles() {
+		want := map[string]time.Time{"alice": alice.LastUsed, "bob": bob.LastUsed}[p.Name]
+		if !p.LastUsed.Equal(want) {
+			t.Errorf("%s LastUsed = %v after reload; want %v", p.Name, p.LastUsed, want)
+		}
+	}
+}
+
 func TestProfileDupe(t *testing.T) {
 	newPersist := func(user, node int) *persist.Persist {
 		return &persist.Persist{
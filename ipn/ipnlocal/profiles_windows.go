@@ -68,6 +68,7 @@ func (pm *profileManager) loadLegacyPrefs() (string, ipn.PrefsView, error) {
 
 	prefs.ControlURL = policy.SelectControlURL(defaultPrefs.ControlURL(), prefs.ControlURL)
 	prefs.ExitNodeIP = resolveExitNodeIP(prefs.ExitNodeIP)
+	prefs.ExitNodeFailover = resolveExitNodeFailover(prefs.ExitNodeFailover)
 	prefs.ShieldsUp = resolveShieldsUp(prefs.ShieldsUp)
 	prefs.ForceDaemon = resolveForceDaemon(prefs.ForceDaemon)
 
@@ -80,11 +81,11 @@ func (pm *profileManager) completeMigration(migrationSentinel string) {
 }
 
 func resolveShieldsUp(defval bool) bool {
-	pol := policy.GetPreferenceOptionPolicy("AllowIncomingConnections")
+	pol := policy.GetPreferenceOptionPolicy(policy.EnableIncomingConnections)
 	return !pol.ShouldEnable(!defval)
 }
 
 func resolveForceDaemon(defval bool) bool {
-	pol := policy.GetPreferenceOptionPolicy("UnattendedMode")
+	pol := policy.GetPreferenceOptionPolicy(policy.UnattendedMode)
 	return pol.ShouldEnable(defval)
 }
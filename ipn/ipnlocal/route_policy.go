@@ -0,0 +1,59 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"go4.org/netipx"
+	"tailscale.com/types/logger"
+	"tailscale.com/util/winutil/policy"
+)
+
+// windowsRoutePolicy returns the route metric and the excluded routes set
+// by the RouteMetric and ExcludedRoutes system policies. Invalid values are
+// logged and ignored.
+func windowsRoutePolicy(logf logger.Logf) (metric uint32, excluded []netip.Prefix) {
+	if v := policy.GetString(policy.RouteMetric); v != "" {
+		if n, err := strconv.ParseUint(v, 10, 32); err == nil {
+			metric = uint32(n)
+		} else {
+			logf("policy %s: invalid metric %q; ignoring", policy.RouteMetric, v)
+		}
+	}
+	if v := policy.GetString(policy.ExcludedRoutes); v != "" {
+		for _, s := range strings.Split(v, ",") {
+			s = strings.TrimSpace(s)
+			if s == "" {
+				continue
+			}
+			p, err := netip.ParsePrefix(s)
+			if err != nil {
+				logf("policy %s: invalid prefix %q; ignoring", policy.ExcludedRoutes, s)
+				continue
+			}
+			excluded = append(excluded, p.Masked())
+		}
+	}
+	return metric, excluded
+}
+
+// excludeRoutes returns routes with the addresses in excluded removed.
+// Routes that partially overlap an excluded prefix are split into the
+// prefixes that cover what's left of them, so that the OS routing table
+// can't send traffic for excluded addresses to Tailscale via a shorter
+// route.
+func excludeRoutes(routes, excluded []netip.Prefix) []netip.Prefix {
+	var b netipx.IPSetBuilder
+	for _, r := range routes {
+		b.AddPrefix(r)
+	}
+	for _, r := range excluded {
+		b.RemovePrefix(r)
+	}
+	s, _ := b.IPSet()
+	return s.Prefixes()
+}
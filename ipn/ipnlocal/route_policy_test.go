@@ -0,0 +1,53 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestExcludeRoutes(t *testing.T) {
+	pp := netip.MustParsePrefix
+	tests := []struct {
+		name     string
+		routes   []netip.Prefix
+		excluded []netip.Prefix
+		want     []netip.Prefix
+	}{
+		{
+			name:     "disjoint",
+			routes:   []netip.Prefix{pp("100.101.102.103/32"), pp("10.0.0.0/24")},
+			excluded: []netip.Prefix{pp("192.168.0.0/16")},
+			want:     []netip.Prefix{pp("10.0.0.0/24"), pp("100.101.102.103/32")},
+		},
+		{
+			name:     "whole_route",
+			routes:   []netip.Prefix{pp("100.101.102.103/32"), pp("10.1.0.0/16")},
+			excluded: []netip.Prefix{pp("10.0.0.0/8")},
+			want:     []netip.Prefix{pp("100.101.102.103/32")},
+		},
+		{
+			name:     "split",
+			routes:   []netip.Prefix{pp("10.0.0.0/22")},
+			excluded: []netip.Prefix{pp("10.0.1.0/24")},
+			want:     []netip.Prefix{pp("10.0.0.0/24"), pp("10.0.2.0/23")},
+		},
+		{
+			name:     "default_route",
+			routes:   []netip.Prefix{pp("0.0.0.0/0"), pp("::/0")},
+			excluded: []netip.Prefix{pp("128.0.0.0/1"), pp("::/1")},
+			want:     []netip.Prefix{pp("0.0.0.0/1"), pp("8000::/1")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := excludeRoutes(tt.routes, tt.excluded)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -4,8 +4,10 @@
 package ipnlocal
 
 import (
+	"bytes"
 	"context"
 	"crypto/sha256"
+	"crypto/subtle"
 	"crypto/tls"
 	"encoding/hex"
 	"encoding/json"
@@ -25,12 +27,15 @@
 	"sync"
 	"time"
 
+	"golang.org/x/crypto/bcrypt"
 	"tailscale.com/ipn"
 	"tailscale.com/logtail/backoff"
 	"tailscale.com/net/netutil"
 	"tailscale.com/syncs"
 	"tailscale.com/tailcfg"
 	"tailscale.com/types/logger"
+	"tailscale.com/types/netmap"
+	"tailscale.com/util/clientmetric"
 	"tailscale.com/util/mak"
 	"tailscale.com/version"
 )
@@ -46,6 +51,16 @@ type serveHTTPContextKey struct{
 type serveHTTPContext struct {
 	SrcAddr  netip.AddrPort
 	DestPort uint16
+
+	// Funnel, if non-nil, is the Funnel flow the request arrived over.
+	// It's nil for requests from the tailnet.
+	Funnel *funnelFlow
+}
+
+// funnelFlow represents a connection from the internet, proxied to us over
+// Funnel by IngressPeer.
+type funnelFlow struct {
+	IngressPeer tailcfg.NodeView
 }
 
 // serveListener is the state of host-level net.Listen for a specific (Tailscale IP, serve port)
@@ -169,7 +184,7 @@ func (s *serveListener) handleServeListenersAccept(ln net.Listener) error {
 			return err
 		}
 		srcAddr := conn.RemoteAddr().(*net.TCPAddr).AddrPort()
-		handler := s.b.tcpHandlerForServe(s.ap.Port(), srcAddr)
+		handler := s.b.tcpHandlerForServe(s.ap.Port(), srcAddr, nil)
 		if handler == nil {
 			s.b.logf("serve RST for %v", srcAddr)
 			conn.Close()
@@ -231,7 +246,56 @@ func (b *LocalBackend) SetServeConfig(config *ipn.ServeConfig, etag string) erro
 	return b.setServeConfigLocked(config, etag)
 }
 
+// checkNewFunnelAccess checks that the node may use Funnel on the ports that
+// config turns it on for, returning an error wrapping ipn.ErrFunnelNotEnabled
+// if not. Ports that Funnel is already on for in prev aren't checked, so that
+// other changes aren't blocked by a capability that went away later.
+func checkNewFunnelAccess(nm *netmap.NetworkMap, prev, config *ipn.ServeConfig) error {
+	caps := nm.SelfCapabilities().AsSlice()
+	prevHPs := funnelHostPorts(prev)
+	for hp := range funnelHostPorts(config) {
+		if prevHPs[hp] {
+			continue
+		}
+		port, err := hp.Port()
+		if err != nil {
+			return err
+		}
+		if err := ipn.CheckFunnelAccess(port, caps); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// funnelHostPorts returns the HostPorts that sc, including its foreground
+// configs, allows Funnel traffic to.
+func funnelHostPorts(sc *ipn.ServeConfig) map[ipn.HostPort]bool {
+	hps := make(map[ipn.HostPort]bool)
+	if sc == nil {
+		return hps
+	}
+	for hp, on := range sc.AllowFunnel {
+		if on {
+			hps[hp] = true
+		}
+	}
+	for _, fg := range sc.Foreground {
+		for hp := range funnelHostPorts(fg) {
+			hps[hp] = true
+		}
+	}
+	return hps
+}
+
 func (b *LocalBackend) setServeConfigLocked(config *ipn.ServeConfig, etag string) error {
+	return b.replaceServeConfigLocked(config, etag, false)
+}
+
+// replaceServeConfigLocked implements setServeConfigLocked. If recordEmpty
+// is set, replacing an empty config is recorded in the serve config
+// history too, so that it can be rolled back to.
+func (b *LocalBackend) replaceServeConfigLocked(config *ipn.ServeConfig, etag string, recordEmpty bool) error {
 	prefs := b.pm.CurrentPrefs()
 	if config.IsFunnelOn() && prefs.ShieldsUp() {
 		return errors.New("Unable to turn on Funnel while shields-up is enabled")
@@ -263,6 +327,12 @@ func (b *LocalBackend) setServeConfigLocked(config *ipn.ServeConfig, etag string
 			return ErrETagMismatch
 		}
 	}
+	if err := checkNewFunnelAccess(nm, prevConfig.AsStruct(), config); err != nil {
+		return err
+	}
+	if err := getServeTargetPolicy(b.logf).check(config); err != nil {
+		return err
+	}
 
 	var bs []byte
 	if config != nil {
@@ -278,6 +348,12 @@ func (b *LocalBackend) setServeConfigLocked(config *ipn.ServeConfig, etag string
 	if err := b.store.WriteState(confKey, bs); err != nil {
 		return fmt.Errorf("writing ServeConfig to StateStore: %w", err)
 	}
+	// Only record prevConfig once it has actually been replaced, so that a
+	// failed write doesn't leave the current config in the history.
+	if err := b.addServeConfigRevisionLocked(profileID, prevConfig, config, recordEmpty); err != nil {
+		// Not fatal; the history is only a convenience for rollbacks.
+		b.logf("serve: failed to save ServeConfig history: %v", err)
+	}
 
 	b.setTCPPortsInterceptedFromNetmapAndPrefsLocked(b.pm.CurrentPrefs())
 
@@ -303,6 +379,118 @@ func (b *LocalBackend) setServeConfigLocked(config *ipn.ServeConfig, etag string
 	return nil
 }
 
+// maxServeConfigHistory is the maximum number of previous ServeConfigs
+// kept per profile for RollbackServeConfig.
+const maxServeConfigHistory = 10
+
+// withoutForeground returns a copy of sc with its Foreground sessions
+// removed, or nil if sc has no background config.
+func withoutForeground(sc *ipn.ServeConfig) *ipn.ServeConfig {
+	if sc == nil {
+		return nil
+	}
+	sc = sc.Clone()
+	sc.Foreground = nil
+	sc.ETag = ""
+	if len(sc.TCP) == 0 && len(sc.Web) == 0 && len(sc.AllowFunnel) == 0 {
+		return nil
+	}
+	return sc
+}
+
+// addServeConfigRevisionLocked records prev in the serve config history of
+// profileID if it was replaced by a different next config. Changes that
+// only touch foreground sessions aren't recorded, nor is an empty prev
+// unless recordEmpty is set.
+func (b *LocalBackend) addServeConfigRevisionLocked(profileID ipn.ProfileID, prev ipn.ServeConfigView, next *ipn.ServeConfig, recordEmpty bool) error {
+	old, nextBG := withoutForeground(prev.AsStruct()), withoutForeground(next)
+	if old == nil {
+		if !recordEmpty || nextBG == nil {
+			return nil
+		}
+		old = new(ipn.ServeConfig)
+	}
+	oldJSON, err := json.Marshal(old)
+	if err != nil {
+		return err
+	}
+	newJSON, err := json.Marshal(nextBG)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(oldJSON, newJSON) {
+		return nil
+	}
+	hist, err := b.serveConfigHistoryLocked(profileID)
+	if err != nil {
+		// Start over rather than never recording history again.
+		b.logf("serve: discarding unreadable ServeConfig history: %v", err)
+		hist = nil
+	}
+	hist = append([]ipn.ServeConfigRevision{{Config: old, Replaced: b.clock.Now()}}, hist...)
+	if len(hist) > maxServeConfigHistory {
+		hist = hist[:maxServeConfigHistory]
+	}
+	j, err := json.Marshal(hist)
+	if err != nil {
+		return err
+	}
+	return b.store.WriteState(ipn.ServeConfigHistoryKey(profileID), j)
+}
+
+func (b *LocalBackend) serveConfigHistoryLocked(profileID ipn.ProfileID) ([]ipn.ServeConfigRevision, error) {
+	j, err := b.store.ReadState(ipn.ServeConfigHistoryKey(profileID))
+	if errors.Is(err, ipn.ErrStateNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var hist []ipn.ServeConfigRevision
+	if err := json.Unmarshal(j, &hist); err != nil {
+		return nil, err
+	}
+	return hist, nil
+}
+
+// ServeConfigHistory returns the previous serve configs of the current
+// profile, newest first.
+func (b *LocalBackend) ServeConfigHistory() ([]ipn.ServeConfigRevision, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.serveConfigHistoryLocked(b.pm.CurrentProfile().ID)
+}
+
+// RollbackServeConfig replaces the current serve config with the n-th most
+// recent previous one (1 being the config replaced by the current one), as
+// returned by ServeConfigHistory. Foreground sessions are kept as is.
+//
+// The config replaced by the rollback, even an empty one, is itself
+// recorded in the history, so a rollback can be undone with another
+// rollback.
+func (b *LocalBackend) RollbackServeConfig(n int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	hist, err := b.serveConfigHistoryLocked(b.pm.CurrentProfile().ID)
+	if err != nil {
+		return fmt.Errorf("reading ServeConfig history: %w", err)
+	}
+	if n < 1 || n > len(hist) {
+		return fmt.Errorf("no serve config revision %d; have %d", n, len(hist))
+	}
+	config := hist[n-1].Config.Clone()
+	if config == nil {
+		config = new(ipn.ServeConfig)
+	}
+	if b.serveConfig.Valid() {
+		b.serveConfig.Foreground().Range(func(k string, v ipn.ServeConfigView) (cont bool) {
+			mak.Set(&config.Foreground, k, v.AsStruct())
+			return true
+		})
+	}
+	return b.replaceServeConfigLocked(config, "", true)
+}
+
 // ServeConfig provides a view of the current serve mappings.
 // If serving is not configured, the returned view is not Valid.
 func (b *LocalBackend) ServeConfig() ipn.ServeConfigView {
@@ -325,11 +513,69 @@ func (b *LocalBackend) DeleteForegroundSession(sessionID string) error {
 	return b.setServeConfigLocked(sc, "")
 }
 
+var metricFunnelExpired = clientmetric.NewCounter("serve_funnel_expired")
+
+// updateFunnelExpiryTimerLocked (re)starts the timer that removes funnel
+// access from the serve config when its FunnelExpiry passes, or stops it if
+// funnel access doesn't expire.
+//
+// b.mu must be held.
+func (b *LocalBackend) updateFunnelExpiryTimerLocked() {
+	if b.funnelExpiryTimer != nil {
+		b.funnelExpiryTimer.Stop()
+		b.funnelExpiryTimer = nil
+	}
+	if !b.serveConfig.Valid() {
+		return
+	}
+	next := b.serveConfig.NextFunnelExpiry()
+	if next.IsZero() {
+		return
+	}
+	b.funnelExpiryTimer = b.clock.AfterFunc(max(next.Sub(b.clock.Now()), 0), b.expireFunnels)
+}
+
+// expireFunnels removes the funnel access whose FunnelExpiry has passed
+// from the serve config. The handlers stay served to the tailnet.
+func (b *LocalBackend) expireFunnels() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.serveConfig.Valid() {
+		return
+	}
+	sc := b.serveConfig.AsStruct()
+	expired := sc.ExpireFunnels(b.clock.Now())
+	if len(expired) == 0 {
+		return
+	}
+	b.logf("serve: funnel access expired for %v", expired)
+	metricFunnelExpired.Add(int64(len(expired)))
+	if err := b.setServeConfigLocked(sc, ""); err != nil {
+		b.logf("serve: failed to remove expired funnel access: %v", err)
+	}
+}
+
 func (b *LocalBackend) HandleIngressTCPConn(ingressPeer tailcfg.NodeView, target ipn.HostPort, srcAddr netip.AddrPort, getConnOrReset func() (net.Conn, bool), sendRST func()) {
 	b.mu.Lock()
 	sc := b.serveConfig
+	paused := b.funnelPaused
 	b.mu.Unlock()
 
+	if paused {
+		b.logf("localbackend: got ingress conn while Funnel is paused; rejecting")
+		sendRST()
+		return
+	}
+
+	if sc.Valid() {
+		if exp := sc.NextFunnelExpiry(); !exp.IsZero() && !b.clock.Now().Before(exp) {
+			// The expiry timer hasn't fired yet, such as when the
+			// machine just woke from sleep.
+			b.expireFunnels()
+			sc = b.ServeConfig()
+		}
+	}
+
 	if !sc.Valid() {
 		b.logf("localbackend: got ingress conn w/o serveConfig; rejecting")
 		sendRST()
@@ -367,9 +613,7 @@ func (b *LocalBackend) HandleIngressTCPConn(ingressPeer tailcfg.NodeView, target
 			return
 		}
 	}
-	// TODO(bradfitz): pass ingressPeer etc in context to tcpHandlerForServe,
-	// extend serveHTTPContext or similar.
-	handler := b.tcpHandlerForServe(dport, srcAddr)
+	handler := b.tcpHandlerForServe(dport, srcAddr, &funnelFlow{IngressPeer: ingressPeer})
 	if handler == nil {
 		sendRST()
 		return
@@ -383,8 +627,9 @@ func (b *LocalBackend) HandleIngressTCPConn(ingressPeer tailcfg.NodeView, target
 }
 
 // tcpHandlerForServe returns a handler for a TCP connection to be served via
-// the ipn.ServeConfig.
-func (b *LocalBackend) tcpHandlerForServe(dport uint16, srcAddr netip.AddrPort) (handler func(net.Conn) error) {
+// the ipn.ServeConfig. The funnelFlow f is non-nil if the connection arrived
+// over Funnel.
+func (b *LocalBackend) tcpHandlerForServe(dport uint16, srcAddr netip.AddrPort, f *funnelFlow) (handler func(net.Conn) error) {
 	b.mu.Lock()
 	sc := b.serveConfig
 	b.mu.Unlock()
@@ -407,6 +652,7 @@ func (b *LocalBackend) tcpHandlerForServe(dport uint16, srcAddr netip.AddrPort)
 				return context.WithValue(context.Background(), serveHTTPContextKey{}, &serveHTTPContext{
 					SrcAddr:  srcAddr,
 					DestPort: dport,
+					Funnel:   f,
 				})
 			},
 		}
@@ -419,6 +665,11 @@ func (b *LocalBackend) tcpHandlerForServe(dport uint16, srcAddr netip.AddrPort)
 			}
 		}
 
+		if addH2C != nil {
+			// Accept cleartext HTTP/2 from clients too, so gRPC
+			// clients can reach h2c backends over plain HTTP.
+			addH2C(hs)
+		}
 		return func(c net.Conn) error {
 			return hs.Serve(netutil.NewOneConnListener(c, nil))
 		}
@@ -522,9 +773,59 @@ func (b *LocalBackend) getServeHandler(r *http.Request) (_ ipn.HTTPHandlerView,
 	}
 }
 
+// checkServeBasicAuth reports whether r carries the HTTP basic auth
+// credentials required by basicAuth, an ipn.HTTPHandler.BasicAuth value.
+func (b *LocalBackend) checkServeBasicAuth(r *http.Request, basicAuth string) bool {
+	wantUser, hash, ok := strings.Cut(basicAuth, ":")
+	if !ok {
+		return false
+	}
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+	userOK := subtle.ConstantTimeCompare([]byte(user), []byte(wantUser)) == 1
+	// bcrypt is deliberately slow and browsers send the credentials with
+	// every request, so remember the password that last matched.
+	sum := sha256.Sum256([]byte(pass))
+	if last, ok := b.serveBasicAuthOK.Load(basicAuth); ok && subtle.ConstantTimeCompare(sum[:], last[:]) == 1 {
+		return userOK
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(pass)) != nil {
+		return false
+	}
+	b.serveBasicAuthOK.Store(basicAuth, sum)
+	return userOK
+}
+
+// proxyTransport is the subset of the http.RoundTripper implementations
+// used by serve proxy handlers.
+type proxyTransport interface {
+	http.RoundTripper
+	CloseIdleConnections()
+}
+
+// newH2CTransport is non-nil on platforms where we support proxying to
+// backends over cleartext HTTP/2 (BackendProtocolH2C). It returns a
+// transport that dials using dial.
+var newH2CTransport func(dial func(ctx context.Context, network, addr string) (net.Conn, error)) proxyTransport
+
+// serveProxyKey returns the key in LocalBackend.serveProxyHandlers for the
+// proxy handler of h. Handlers for the same backend that use different
+// protocols need distinct transports, so the protocol is part of the key.
+func serveProxyKey(h ipn.HTTPHandlerView) string {
+	switch p := h.BackendProtocol(); p {
+	case "", ipn.BackendProtocolHTTP1:
+		return h.Proxy()
+	default:
+		return p + " " + h.Proxy()
+	}
+}
+
 // proxyHandlerForBackend creates a new HTTP reverse proxy for a particular backend that
-// we serve requests for. `backend` is a HTTPHandler.Proxy string (url, hostport or just port).
-func (b *LocalBackend) proxyHandlerForBackend(backend string) (*httputil.ReverseProxy, error) {
+// we serve requests for. `backend` is a HTTPHandler.Proxy string (url, hostport or just port)
+// and protocol is its HTTPHandler.BackendProtocol.
+func (b *LocalBackend) proxyHandlerForBackend(backend, protocol string) (*httputil.ReverseProxy, error) {
 	targetURL, insecure := expandProxyArg(backend)
 	u, err := url.Parse(targetURL)
 	if err != nil {
@@ -537,7 +838,10 @@ func (b *LocalBackend) proxyHandlerForBackend(backend string) (*httputil.Reverse
 			addProxyForwardedHeaders(r)
 			b.addTailscaleIdentityHeaders(r)
 		},
-		Transport: &http.Transport{
+	}
+	switch protocol {
+	case "", ipn.BackendProtocolHTTP1:
+		rp.Transport = &http.Transport{
 			DialContext: b.dialer.SystemDial,
 			TLSClientConfig: &tls.Config{
 				InsecureSkipVerify: insecure,
@@ -548,7 +852,21 @@ func (b *LocalBackend) proxyHandlerForBackend(backend string) (*httputil.Reverse
 			IdleConnTimeout:       90 * time.Second,
 			TLSHandshakeTimeout:   10 * time.Second,
 			ExpectContinueTimeout: 1 * time.Second,
-		},
+		}
+	case ipn.BackendProtocolH2C:
+		if newH2CTransport == nil {
+			return nil, errors.New("h2c backends are not supported on this platform")
+		}
+		if u.Scheme != "http" {
+			return nil, fmt.Errorf("h2c backend %q must be an http:// URL", backend)
+		}
+		rp.Transport = newH2CTransport(b.dialer.SystemDial)
+		// Flush immediately so streaming RPCs (such as gRPC) aren't
+		// held up in the proxy's buffers. Trailers are passed through
+		// by ReverseProxy.
+		rp.FlushInterval = -1
+	default:
+		return nil, fmt.Errorf("unknown backend protocol %q", protocol)
 	}
 	return rp, nil
 }
@@ -597,17 +915,50 @@ func (b *LocalBackend) serveWebHandler(w http.ResponseWriter, r *http.Request) {
 		http.NotFound(w, r)
 		return
 	}
+	if h.TailnetOnly() {
+		// Requests over Funnel get a 404 as if the mount didn't exist,
+		// rather than falling through to a funneled parent mount.
+		if c, ok := getServeHTTPContext(r); !ok || c.Funnel != nil {
+			http.NotFound(w, r)
+			return
+		}
+	}
+	if ba := h.BasicAuth(); ba != "" {
+		if !b.checkServeBasicAuth(r, ba) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="Tailscale Serve", charset="UTF-8"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		// The credentials are for serve, not the backend; don't
+		// leak them to it.
+		r.Header.Del("Authorization")
+	}
 	if s := h.Text(); s != "" {
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		ct := h.ContentType()
+		if ct == "" {
+			ct = "text/plain; charset=utf-8"
+		}
+		w.Header().Set("Content-Type", ct)
+		if code := h.StatusCode(); code != 0 {
+			w.WriteHeader(code)
+		}
 		io.WriteString(w, s)
 		return
 	}
+	if v := h.Redirect(); v != "" {
+		code := h.StatusCode()
+		if code == 0 {
+			code = http.StatusFound
+		}
+		http.Redirect(w, r, v, code)
+		return
+	}
 	if v := h.Path(); v != "" {
 		b.serveFileOrDirectory(w, r, v, mountPoint)
 		return
 	}
 	if v := h.Proxy(); v != "" {
-		p, ok := b.serveProxyHandlers.Load(v)
+		p, ok := b.serveProxyHandlers.Load(serveProxyKey(h))
 		if !ok {
 			http.Error(w, "unknown proxy destination", http.StatusInternalServerError)
 			return
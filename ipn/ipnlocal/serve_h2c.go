@@ -0,0 +1,27 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !ios && !android && !js
+
+package ipnlocal
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+
+	"golang.org/x/net/http2"
+)
+
+func init() {
+	newH2CTransport = func(dial func(ctx context.Context, network, addr string) (net.Conn, error)) proxyTransport {
+		return &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				// AllowHTTP permits http:// URLs, but the transport still
+				// calls DialTLSContext for them; dial plaintext instead.
+				return dial(ctx, network, addr)
+			},
+		}
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"tailscale.com/ipn"
+	"tailscale.com/types/logger"
+	"tailscale.com/util/winutil/policy"
+)
+
+// serveTargetPolicy restricts the backends that serve handlers may target,
+// as set by the ServeDeniedTargets and ServeAllowedPaths system policies.
+// Its zero value allows everything.
+type serveTargetPolicy struct {
+	deniedPrefixes []netip.Prefix
+	deniedHosts    []string // lowercase host names
+	allowedPaths   []string // cleaned absolute directories; nil means any
+}
+
+// getServeTargetPolicy returns the serve target policy set by the system
+// policies. Invalid values are logged and ignored.
+func getServeTargetPolicy(logf logger.Logf) serveTargetPolicy {
+	return parseServeTargetPolicy(logf, policy.GetString(policy.ServeDeniedTargets), policy.GetString(policy.ServeAllowedPaths))
+}
+
+// parseServeTargetPolicy returns the serve target policy for the values of
+// the ServeDeniedTargets and ServeAllowedPaths system policies.
+func parseServeTargetPolicy(logf logger.Logf, denied, allowedPaths string) serveTargetPolicy {
+	var p serveTargetPolicy
+	for _, s := range strings.Split(denied, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if pfx, err := netip.ParsePrefix(s); err == nil {
+			p.deniedPrefixes = append(p.deniedPrefixes, pfx.Masked())
+		} else if ip, err := netip.ParseAddr(s); err == nil {
+			p.deniedPrefixes = append(p.deniedPrefixes, netip.PrefixFrom(ip, ip.BitLen()))
+		} else {
+			p.deniedHosts = append(p.deniedHosts, strings.ToLower(strings.TrimSuffix(s, ".")))
+		}
+	}
+	for _, s := range strings.Split(allowedPaths, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !filepath.IsAbs(s) {
+			logf("policy %s: path %q isn't absolute; ignoring", policy.ServeAllowedPaths, s)
+			continue
+		}
+		p.allowedPaths = append(p.allowedPaths, filepath.Clean(s))
+	}
+	if allowedPaths != "" && p.allowedPaths == nil {
+		// Don't let a policy with only invalid paths allow everything.
+		p.allowedPaths = []string{}
+	}
+	return p
+}
+
+// check returns an error if a handler of sc, or of its foreground configs,
+// targets a backend that p doesn't allow.
+func (p serveTargetPolicy) check(sc *ipn.ServeConfig) error {
+	if sc == nil {
+		return nil
+	}
+	for port, h := range sc.TCP {
+		if h == nil || h.TCPForward == "" {
+			continue
+		}
+		host, _, err := net.SplitHostPort(h.TCPForward)
+		if err != nil {
+			// It can't be dialed either.
+			continue
+		}
+		if err := p.checkHost(host); err != nil {
+			return fmt.Errorf("port %d: %w", port, err)
+		}
+	}
+	for hp, web := range sc.Web {
+		if web == nil {
+			continue
+		}
+		for mount, h := range web.Handlers {
+			if err := p.checkHandler(h); err != nil {
+				return fmt.Errorf("%s%s: %w", hp, mount, err)
+			}
+		}
+	}
+	for _, fg := range sc.Foreground {
+		if err := p.check(fg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p serveTargetPolicy) checkHandler(h *ipn.HTTPHandler) error {
+	switch {
+	case h == nil:
+		return nil
+	case h.Proxy != "":
+		target, _ := expandProxyArg(h.Proxy)
+		u, err := url.Parse(target)
+		if err != nil {
+			return fmt.Errorf("invalid proxy target %q: %w", h.Proxy, err)
+		}
+		return p.checkHost(u.Hostname())
+	case h.Path != "" && p.allowedPaths != nil:
+		path := filepath.Clean(h.Path)
+		for _, dir := range p.allowedPaths {
+			if rel, err := filepath.Rel(dir, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				return nil
+			}
+		}
+		return fmt.Errorf("serving %q is not allowed by system policy %s", h.Path, policy.ServeAllowedPaths)
+	}
+	return nil
+}
+
+// checkHost returns an error if host, an IP address or a host name, is
+// denied by p. Host names are matched as written, not resolved; "localhost"
+// also matches the loopback addresses.
+func (p serveTargetPolicy) checkHost(host string) error {
+	var ips []netip.Addr
+	if ip, err := netip.ParseAddr(host); err == nil {
+		ips = append(ips, ip.Unmap())
+	} else {
+		name := strings.ToLower(strings.TrimSuffix(host, "."))
+		for _, denied := range p.deniedHosts {
+			if name == denied {
+				return fmt.Errorf("target %q is denied by system policy %s", host, policy.ServeDeniedTargets)
+			}
+		}
+		if name == "localhost" {
+			ips = append(ips, netip.MustParseAddr("127.0.0.1"), netip.IPv6Loopback())
+		}
+	}
+	for _, ip := range ips {
+		for _, pfx := range p.deniedPrefixes {
+			if pfx.Contains(ip) {
+				return fmt.Errorf("target %q is denied by system policy %s", host, policy.ServeDeniedTargets)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"path/filepath"
+	"testing"
+
+	"tailscale.com/ipn"
+)
+
+func TestServeTargetPolicy(t *testing.T) {
+	root := t.TempDir()
+	srv := filepath.Join(root, "srv")
+	p := parseServeTargetPolicy(t.Logf, "169.254.0.0/16, 10.1.2.3,metadata.internal., fd00::/8", srv+", relative")
+
+	web := func(h *ipn.HTTPHandler) *ipn.ServeConfig {
+		return &ipn.ServeConfig{
+			TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+			Web: map[ipn.HostPort]*ipn.WebServerConfig{
+				"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{"/": h}},
+			},
+		}
+	}
+	forward := func(dst string) *ipn.ServeConfig {
+		return &ipn.ServeConfig{TCP: map[uint16]*ipn.TCPPortHandler{2222: {TCPForward: dst}}}
+	}
+	tests := []struct {
+		name    string
+		sc      *ipn.ServeConfig
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"proxy_localhost", web(&ipn.HTTPHandler{Proxy: "http://127.0.0.1:3000"}), false},
+		{"proxy_port", web(&ipn.HTTPHandler{Proxy: "3000"}), false},
+		{"proxy_denied_prefix", web(&ipn.HTTPHandler{Proxy: "http://169.254.169.254/latest"}), true},
+		{"proxy_denied_ip", web(&ipn.HTTPHandler{Proxy: "10.1.2.3:80"}), true},
+		{"proxy_other_ip", web(&ipn.HTTPHandler{Proxy: "10.1.2.4:80"}), false},
+		{"proxy_denied_host", web(&ipn.HTTPHandler{Proxy: "https+insecure://Metadata.Internal:443"}), true},
+		{"proxy_denied_v6", web(&ipn.HTTPHandler{Proxy: "http://[fd00::1]:80"}), true},
+		{"forward_ok", forward("127.0.0.1:22"), false},
+		{"forward_denied", forward("169.254.169.254:80"), true},
+		{"path_allowed", web(&ipn.HTTPHandler{Path: filepath.Join(srv, "site")}), false},
+		{"path_allowed_dir", web(&ipn.HTTPHandler{Path: srv}), false},
+		{"path_outside", web(&ipn.HTTPHandler{Path: filepath.Join(root, "etc")}), true},
+		{"path_escape", web(&ipn.HTTPHandler{Path: filepath.Join(srv, "..", "etc")}), true},
+		{"path_sibling", web(&ipn.HTTPHandler{Path: srv + "2"}), true},
+		{"text", web(&ipn.HTTPHandler{Text: "hi"}), false},
+		{"foreground_denied", &ipn.ServeConfig{
+			Foreground: map[string]*ipn.ServeConfig{"sess": forward("169.254.169.254:80")},
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.check(tt.sc)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("check = %v; wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// The zero policy allows everything.
+	if err := (serveTargetPolicy{}).check(forward("169.254.169.254:80")); err != nil {
+		t.Errorf("zero policy: %v", err)
+	}
+	// Only invalid allowed paths allow none.
+	if err := parseServeTargetPolicy(t.Logf, "", "relative").check(web(&ipn.HTTPHandler{Path: srv})); err == nil {
+		t.Error("policy with only invalid paths allowed a path")
+	}
+}
@@ -12,6 +12,7 @@
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/netip"
@@ -22,6 +23,7 @@
 	"testing"
 	"time"
 
+	"golang.org/x/crypto/bcrypt"
 	"tailscale.com/ipn"
 	"tailscale.com/ipn/store/mem"
 	"tailscale.com/tailcfg"
@@ -60,6 +62,48 @@ type res struct {
 	}
 }
 
+func TestServeProxyKey(t *testing.T) {
+	tests := []struct {
+		h    *ipn.HTTPHandler
+		want string
+	}{
+		{&ipn.HTTPHandler{Proxy: "http://127.0.0.1:3000"}, "http://127.0.0.1:3000"},
+		{&ipn.HTTPHandler{Proxy: "http://127.0.0.1:3000", BackendProtocol: ipn.BackendProtocolHTTP1}, "http://127.0.0.1:3000"},
+		{&ipn.HTTPHandler{Proxy: "http://127.0.0.1:3000", BackendProtocol: ipn.BackendProtocolH2C}, "h2c http://127.0.0.1:3000"},
+	}
+	for _, tt := range tests {
+		if got := serveProxyKey(tt.h.View()); got != tt.want {
+			t.Errorf("serveProxyKey(%+v) = %q, want %q", tt.h, got, tt.want)
+		}
+	}
+}
+
+func TestProxyHandlerForBackendProtocol(t *testing.T) {
+	b := newTestBackend(t)
+	tests := []struct {
+		backend  string
+		protocol string
+		wantErr  bool
+	}{
+		{"http://127.0.0.1:3000", "", false},
+		{"http://127.0.0.1:3000", ipn.BackendProtocolHTTP1, false},
+		{"http://127.0.0.1:3000", ipn.BackendProtocolH2C, false},
+		{"3000", ipn.BackendProtocolH2C, false},
+		{"https://127.0.0.1:3000", ipn.BackendProtocolH2C, true},
+		{"http://127.0.0.1:3000", "spdy", true},
+	}
+	for _, tt := range tests {
+		rp, err := b.proxyHandlerForBackend(tt.backend, tt.protocol)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("proxyHandlerForBackend(%q, %q) error = %v, wantErr %v", tt.backend, tt.protocol, err, tt.wantErr)
+			continue
+		}
+		if err == nil && tt.protocol == ipn.BackendProtocolH2C && rp.FlushInterval != -1 {
+			t.Errorf("proxyHandlerForBackend(%q, %q) FlushInterval = %v, want -1", tt.backend, tt.protocol, rp.FlushInterval)
+		}
+	}
+}
+
 func TestGetServeHandler(t *testing.T) {
 	const serverName = "example.ts.net"
 	conf1 := &ipn.ServeConfig{
@@ -347,6 +391,191 @@ func TestServeConfigETag(t *testing.T) {
 	}
 }
 
+func TestServeConfigRollback(t *testing.T) {
+	b := newTestBackend(t)
+
+	conf := func(port string) *ipn.ServeConfig {
+		return &ipn.ServeConfig{
+			Web: map[ipn.HostPort]*ipn.WebServerConfig{
+				"example.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+					"/": {Proxy: "http://127.0.0.1:" + port},
+				}},
+			},
+		}
+	}
+	proxyOf := func(sc ipn.ServeConfigView) string {
+		if !sc.Valid() {
+			return ""
+		}
+		w, ok := sc.FindWeb("example.ts.net:443")
+		if !ok {
+			return ""
+		}
+		return w.Handlers().Get("/").Proxy()
+	}
+
+	if err := b.RollbackServeConfig(1); err == nil {
+		t.Fatal("rollback with empty history succeeded")
+	}
+	for _, c := range []*ipn.ServeConfig{conf("3000"), conf("3001"), conf("3001"), nil} {
+		if err := b.SetServeConfig(c, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hist, err := b.ServeConfigHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Setting the same config twice is only recorded once.
+	if len(hist) != 2 {
+		t.Fatalf("got %d revisions; want 2", len(hist))
+	}
+	if got := proxyOf(hist[0].Config.View()); got != "http://127.0.0.1:3001" {
+		t.Errorf("newest revision proxies to %q", got)
+	}
+
+	if err := b.RollbackServeConfig(1); err != nil {
+		t.Fatal(err)
+	}
+	if got := proxyOf(b.ServeConfig()); got != "http://127.0.0.1:3001" {
+		t.Errorf("after rollback, proxy = %q; want 3001", got)
+	}
+	if err := b.RollbackServeConfig(3); err != nil {
+		t.Fatal(err)
+	}
+	if got := proxyOf(b.ServeConfig()); got != "http://127.0.0.1:3000" {
+		t.Errorf("after rollback --to 3, proxy = %q; want 3000", got)
+	}
+
+	for i := 0; i < maxServeConfigHistory+5; i++ {
+		if err := b.SetServeConfig(conf(fmt.Sprint(4000+i)), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hist, err = b.ServeConfigHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hist) != maxServeConfigHistory {
+		t.Errorf("got %d revisions; want %d", len(hist), maxServeConfigHistory)
+	}
+}
+
+// failServeWritesStore is a StateStore that fails to write serve configs.
+type failServeWritesStore struct {
+	ipn.StateStore
+}
+
+func (s failServeWritesStore) WriteState(id ipn.StateKey, bs []byte) error {
+	if strings.HasPrefix(string(id), "_serve/") {
+		return errors.New("disk full")
+	}
+	return s.StateStore.WriteState(id, bs)
+}
+
+func TestServeConfigHistoryFailedWrite(t *testing.T) {
+	b := newTestBackend(t)
+	conf := &ipn.ServeConfig{TCP: map[uint16]*ipn.TCPPortHandler{80: {TCPForward: "localhost:8080"}}}
+	if err := b.SetServeConfig(conf, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	b.store = failServeWritesStore{b.store}
+	if err := b.SetServeConfig(nil, ""); err == nil {
+		t.Fatal("SetServeConfig succeeded with a failing store")
+	}
+	hist, err := b.ServeConfigHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hist) != 0 {
+		t.Errorf("failed write recorded %d revisions; want none", len(hist))
+	}
+}
+
+func TestServeConfigFunnelAccess(t *testing.T) {
+	b := newTestBackend(t)
+
+	conf := &ipn.ServeConfig{
+		AllowFunnel: map[ipn.HostPort]bool{"example.ts.net:443": true},
+	}
+	if err := b.SetServeConfig(conf, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// Port 10000 isn't in the funnel-ports capability.
+	conf.AllowFunnel["example.ts.net:10000"] = true
+	if err := b.SetServeConfig(conf, ""); !errors.Is(err, ipn.ErrFunnelNotEnabled) {
+		t.Fatalf("SetServeConfig on port 10000: got %v, want ErrFunnelNotEnabled", err)
+	}
+	delete(conf.AllowFunnel, "example.ts.net:10000")
+
+	// Losing the capability doesn't block changes to ports that Funnel
+	// is already on for, but does block new ones.
+	b.netMap.SelfNode = (&tailcfg.Node{Name: "example.ts.net"}).View()
+	conf.TCP = map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}}
+	if err := b.SetServeConfig(conf, ""); err != nil {
+		t.Fatalf("changing a funneled port after losing the capability: %v", err)
+	}
+	conf.AllowFunnel["example.ts.net:8443"] = true
+	if err := b.SetServeConfig(conf, ""); !errors.Is(err, ipn.ErrFunnelNotEnabled) {
+		t.Fatalf("SetServeConfig without capability: got %v, want ErrFunnelNotEnabled", err)
+	}
+}
+
+func TestServeConfigFunnelExpiry(t *testing.T) {
+	b := newTestBackend(t)
+
+	const (
+		expiring  ipn.HostPort = "example.ts.net:443"
+		permanent ipn.HostPort = "example.ts.net:8443"
+	)
+	conf := &ipn.ServeConfig{
+		TCP: map[uint16]*ipn.TCPPortHandler{
+			443:  {HTTPS: true},
+			8443: {HTTPS: true},
+		},
+		AllowFunnel: map[ipn.HostPort]bool{
+			expiring:  true,
+			permanent: true,
+		},
+		FunnelExpiry: map[ipn.HostPort]time.Time{
+			expiring: time.Now().Add(-time.Second),
+		},
+	}
+	if err := b.SetServeConfig(conf, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		if !b.ServeConfig().AllowFunnel().Get(expiring) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("funnel access for %v didn't expire", expiring)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	sc := b.ServeConfig()
+	if !sc.AllowFunnel().Get(permanent) {
+		t.Errorf("funnel access for %v was removed", permanent)
+	}
+	if sc.FunnelExpiry().Len() != 0 {
+		t.Errorf("FunnelExpiry = %v, want empty", sc.FunnelExpiry())
+	}
+	if _, ok := sc.TCP().GetOk(443); !ok {
+		t.Errorf("handler for port 443 was removed with its funnel access")
+	}
+
+	hist, err := b.ServeConfigHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hist) != 1 || !hist[0].Config.AllowFunnel[expiring] {
+		t.Errorf("expiry not recorded in the serve config history: %+v", hist)
+	}
+}
+
 func TestServeHTTPProxy(t *testing.T) {
 	b := newTestBackend(t)
 
@@ -469,6 +698,11 @@ func newTestBackend(t *testing.T) *LocalBackend {
 	b.netMap = &netmap.NetworkMap{
 		SelfNode: (&tailcfg.Node{
 			Name: "example.ts.net",
+			Capabilities: []tailcfg.NodeCapability{
+				tailcfg.CapabilityHTTPS,
+				tailcfg.NodeAttrFunnel,
+				"https://tailscale.com/cap/funnel-ports?ports=443,8443",
+			},
 		}).View(),
 		UserProfiles: map[tailcfg.UserID]tailcfg.UserProfile{
 			tailcfg.UserID(1): {
@@ -498,6 +732,212 @@ func newTestBackend(t *testing.T) *LocalBackend {
 	return b
 }
 
+func TestServeRedirect(t *testing.T) {
+	b := newTestBackend(t)
+	conf := &ipn.ServeConfig{
+		Web: map[ipn.HostPort]*ipn.WebServerConfig{
+			"example.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+				"/temp": {Redirect: "https://example.com/a"},
+				"/perm": {Redirect: "https://example.com/b", StatusCode: http.StatusMovedPermanently},
+			}},
+		},
+	}
+	if err := b.SetServeConfig(conf, ""); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path         string
+		wantCode     int
+		wantLocation string
+	}{
+		{"/temp", http.StatusFound, "https://example.com/a"},
+		{"/perm", http.StatusMovedPermanently, "https://example.com/b"},
+	}
+	for _, tt := range tests {
+		req := &http.Request{
+			URL: &url.URL{Path: tt.path},
+			TLS: &tls.ConnectionState{ServerName: "example.ts.net"},
+		}
+		req = req.WithContext(context.WithValue(req.Context(), serveHTTPContextKey{},
+			&serveHTTPContext{
+				DestPort: 443,
+				SrcAddr:  netip.MustParseAddrPort("1.2.3.4:1234"),
+			}))
+		w := httptest.NewRecorder()
+		b.serveWebHandler(w, req)
+		if w.Code != tt.wantCode {
+			t.Errorf("%s: got status %d; want %d", tt.path, w.Code, tt.wantCode)
+		}
+		if got := w.Header().Get("Location"); got != tt.wantLocation {
+			t.Errorf("%s: got Location %q; want %q", tt.path, got, tt.wantLocation)
+		}
+	}
+}
+
+func TestServeText(t *testing.T) {
+	b := newTestBackend(t)
+	conf := &ipn.ServeConfig{
+		Web: map[ipn.HostPort]*ipn.WebServerConfig{
+			"example.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+				"/":     {Text: "hello"},
+				"/json": {Text: `{"ok":true}`, ContentType: "application/json", StatusCode: http.StatusAccepted},
+			}},
+		},
+	}
+	if err := b.SetServeConfig(conf, ""); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path     string
+		wantCode int
+		wantType string
+		wantBody string
+	}{
+		{"/", http.StatusOK, "text/plain; charset=utf-8", "hello"},
+		{"/json", http.StatusAccepted, "application/json", `{"ok":true}`},
+	}
+	for _, tt := range tests {
+		req := &http.Request{
+			URL: &url.URL{Path: tt.path},
+			TLS: &tls.ConnectionState{ServerName: "example.ts.net"},
+		}
+		req = req.WithContext(context.WithValue(req.Context(), serveHTTPContextKey{},
+			&serveHTTPContext{
+				DestPort: 443,
+				SrcAddr:  netip.MustParseAddrPort("1.2.3.4:1234"),
+			}))
+		w := httptest.NewRecorder()
+		b.serveWebHandler(w, req)
+		if w.Code != tt.wantCode {
+			t.Errorf("%s: got status %d; want %d", tt.path, w.Code, tt.wantCode)
+		}
+		if got := w.Header().Get("Content-Type"); got != tt.wantType {
+			t.Errorf("%s: got Content-Type %q; want %q", tt.path, got, tt.wantType)
+		}
+		if got := w.Body.String(); got != tt.wantBody {
+			t.Errorf("%s: got body %q; want %q", tt.path, got, tt.wantBody)
+		}
+	}
+}
+
+func TestServeTailnetOnly(t *testing.T) {
+	b := newTestBackend(t)
+	conf := &ipn.ServeConfig{
+		Web: map[ipn.HostPort]*ipn.WebServerConfig{
+			"example.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+				"/":       {Text: "public"},
+				"/admin/": {Text: "admin", TailnetOnly: true},
+			}},
+		},
+		AllowFunnel: map[ipn.HostPort]bool{"example.ts.net:443": true},
+	}
+	if err := b.SetServeConfig(conf, ""); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path     string
+		funnel   bool
+		wantCode int
+		wantBody string
+	}{
+		{"/", false, http.StatusOK, "public"},
+		{"/", true, http.StatusOK, "public"},
+		{"/admin/", false, http.StatusOK, "admin"},
+		{"/admin/", true, http.StatusNotFound, ""},
+		{"/admin/users", true, http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		req := &http.Request{
+			URL: &url.URL{Path: tt.path},
+			TLS: &tls.ConnectionState{ServerName: "example.ts.net"},
+		}
+		sctx := &serveHTTPContext{
+			DestPort: 443,
+			SrcAddr:  netip.MustParseAddrPort("1.2.3.4:1234"),
+		}
+		if tt.funnel {
+			sctx.Funnel = new(funnelFlow)
+		}
+		req = req.WithContext(context.WithValue(req.Context(), serveHTTPContextKey{}, sctx))
+		w := httptest.NewRecorder()
+		b.serveWebHandler(w, req)
+		if w.Code != tt.wantCode {
+			t.Errorf("%s (funnel=%v): got status %d; want %d", tt.path, tt.funnel, w.Code, tt.wantCode)
+		}
+		if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+			t.Errorf("%s (funnel=%v): got body %q; want %q", tt.path, tt.funnel, w.Body.String(), tt.wantBody)
+		}
+	}
+}
+
+func TestServeBasicAuth(t *testing.T) {
+	b := newTestBackend(t)
+	hash, err := bcrypt.GenerateFromPassword([]byte("hunter2"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The backend echoes the Authorization header it was sent, if any.
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Header.Get("Authorization"))
+	}))
+	defer backend.Close()
+	conf := &ipn.ServeConfig{
+		Web: map[ipn.HostPort]*ipn.WebServerConfig{
+			"example.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+				"/":        {Text: "public"},
+				"/secret/": {Text: "secret", BasicAuth: "admin:" + string(hash)},
+				"/proxy/":  {Proxy: backend.URL, BasicAuth: "admin:" + string(hash)},
+			}},
+		},
+	}
+	if err := b.SetServeConfig(conf, ""); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		path       string
+		user, pass string // empty user means no credentials
+		wantCode   int
+	}{
+		{"no-auth-needed", "/", "", "", http.StatusOK},
+		{"no-credentials", "/secret/", "", "", http.StatusUnauthorized},
+		{"wrong-password", "/secret/", "admin", "hunter3", http.StatusUnauthorized},
+		{"wrong-user", "/secret/", "root", "hunter2", http.StatusUnauthorized},
+		{"ok", "/secret/", "admin", "hunter2", http.StatusOK},
+		{"ok-cached", "/secret/x", "admin", "hunter2", http.StatusOK},
+		{"wrong-user-cached", "/secret/", "root", "hunter2", http.StatusUnauthorized},
+		{"proxy", "/proxy/", "admin", "hunter2", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &http.Request{
+				URL:    &url.URL{Path: tt.path},
+				Header: make(http.Header),
+				TLS:    &tls.ConnectionState{ServerName: "example.ts.net"},
+			}
+			if tt.user != "" {
+				req.SetBasicAuth(tt.user, tt.pass)
+			}
+			req = req.WithContext(context.WithValue(req.Context(), serveHTTPContextKey{},
+				&serveHTTPContext{
+					DestPort: 443,
+					SrcAddr:  netip.MustParseAddrPort("1.2.3.4:1234"),
+				}))
+			w := httptest.NewRecorder()
+			b.serveWebHandler(w, req)
+			if w.Code != tt.wantCode {
+				t.Errorf("got status %d; want %d", w.Code, tt.wantCode)
+			}
+			if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("missing WWW-Authenticate header")
+			}
+			if tt.name == "proxy" && w.Body.Len() != 0 {
+				t.Errorf("backend got Authorization header %q; want none", w.Body.String())
+			}
+		})
+	}
+}
+
 func TestServeFileOrDirectory(t *testing.T) {
 	td := t.TempDir()
 	writeFile := func(suffix, contents string) {
@@ -0,0 +1,194 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"tailscale.com/ipn"
+	"tailscale.com/types/logger"
+	"tailscale.com/util/winutil/policy"
+)
+
+// taildropAutoAccept returns the effective settings for accepting received
+// Taildrop files automatically: those of the TaildropAutoAccept pref, with
+// any that the TaildropAutoAccept system policies set taking precedence.
+func (b *LocalBackend) taildropAutoAccept() ipn.TaildropAutoAcceptPrefs {
+	b.mu.Lock()
+	aa := b.pm.CurrentPrefs().TaildropAutoAccept()
+	b.mu.Unlock()
+	return applyTaildropAutoAcceptPolicy(aa, b.logf)
+}
+
+// applyTaildropAutoAcceptPolicy returns aa with the settings that the
+// TaildropAutoAccept system policies set replaced.
+func applyTaildropAutoAcceptPolicy(aa ipn.TaildropAutoAcceptPrefs, logf logger.Logf) ipn.TaildropAutoAcceptPrefs {
+	if dir := policy.GetString(policy.TaildropAutoAcceptDir); dir != "" {
+		aa.Dir = dir
+	}
+	if c := policy.GetString(policy.TaildropAutoAcceptConflict); c != "" {
+		aa.Conflict = c
+	}
+	if v := policy.GetString(policy.TaildropAutoAcceptMaxBytes); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n >= 0 {
+			aa.MaxBytes = n
+		} else {
+			logf("policy %s: invalid size %q; ignoring", policy.TaildropAutoAcceptMaxBytes, v)
+		}
+	}
+	return aa
+}
+
+func checkTaildropAutoAcceptPref(p *ipn.Prefs) error {
+	aa := p.TaildropAutoAccept
+	switch aa.Conflict {
+	case "", "skip", "overwrite", "rename":
+	default:
+		return fmt.Errorf("unknown Taildrop conflict behavior %q; want one of skip, overwrite, rename", aa.Conflict)
+	}
+	if aa.MaxBytes < 0 {
+		return errors.New("Taildrop auto-accept quota can't be negative")
+	}
+	if aa.Dir == "" {
+		return nil
+	}
+	if !filepath.IsAbs(aa.Dir) {
+		return fmt.Errorf("Taildrop auto-accept directory %q is not an absolute path", aa.Dir)
+	}
+	if fi, err := os.Stat(aa.Dir); err != nil {
+		return fmt.Errorf("Taildrop auto-accept directory: %w", err)
+	} else if !fi.IsDir() {
+		return fmt.Errorf("Taildrop auto-accept directory %q is not a directory", aa.Dir)
+	}
+	return nil
+}
+
+// autoAcceptFile moves the received file baseName out of the Taildrop
+// inbox of ps into the auto-accept directory, if one is configured. Files
+// that can't be moved, such as because of a name conflict or the
+// directory's quota, stay in the inbox to be picked up as usual.
+func (b *LocalBackend) autoAcceptFile(ps *peerAPIServer, baseName string) {
+	if ps.directFileMode {
+		return
+	}
+	aa := b.taildropAutoAccept()
+	if aa.Dir == "" {
+		return
+	}
+	if err := moveToAutoAcceptDir(ps, baseName, aa); err != nil {
+		b.logf("taildrop: leaving received file in inbox: %v", redactErr(err))
+		return
+	}
+	b.logf("taildrop: auto-accepted received file")
+}
+
+// moveToAutoAcceptDir moves the file baseName from the inbox of ps to
+// aa.Dir, resolving name conflicts per aa.Conflict and staying under
+// aa.MaxBytes.
+func moveToAutoAcceptDir(ps *peerAPIServer, baseName string, aa ipn.TaildropAutoAcceptPrefs) error {
+	src, ok := ps.diskPath(baseName)
+	if !ok {
+		return errors.New("bad filename")
+	}
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if aa.MaxBytes > 0 {
+		used, err := dirSize(aa.Dir)
+		if err != nil {
+			return err
+		}
+		if used+fi.Size() > aa.MaxBytes {
+			return fmt.Errorf("auto-accept directory would exceed its quota of %d bytes", aa.MaxBytes)
+		}
+	}
+	dst, err := createAutoAcceptFile(aa.Dir, baseName, aa.Conflict)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	// Renaming over the newly created file is cheapest, but fails across
+	// filesystems (and on Windows, over an open file), so fall back to
+	// copying into it.
+	if err := os.Rename(src, dst.Name()); err == nil {
+		return nil
+	}
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, f)
+	f.Close()
+	if err == nil {
+		err = dst.Close()
+	}
+	if err != nil {
+		os.Remove(dst.Name())
+		return err
+	}
+	return ps.DeleteFile(baseName)
+}
+
+// createAutoAcceptFile creates the file name in dir to move a received file
+// to. If dir already has a file of that name, conflict says what to do:
+// "overwrite" replaces it, "rename" picks a name such as "foo (1).jpg"
+// instead, and "skip" or empty fails.
+func createAutoAcceptFile(dir, name, conflict string) (*os.File, error) {
+	create := func(path string) (*os.File, error) {
+		return os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	}
+	path := filepath.Join(dir, name)
+	f, err := create(path)
+	if err == nil || !os.IsExist(err) {
+		return f, err
+	}
+	switch conflict {
+	case "overwrite":
+		// Remove the file and create it anew, rather than truncating
+		// it, so as not to write through a symlink planted there.
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+		return create(path)
+	case "rename":
+		ext := filepath.Ext(name)
+		base := strings.TrimSuffix(name, ext)
+		for i := 1; i < 100; i++ {
+			f, err := create(filepath.Join(dir, fmt.Sprintf("%s (%d)%s", base, i, ext)))
+			if err == nil || !os.IsExist(err) {
+				return f, err
+			}
+		}
+		return nil, errors.New("no free numbered name in auto-accept directory")
+	}
+	return nil, errors.New("auto-accept directory has a file of the same name")
+}
+
+// dirSize returns the total size of the regular files in dir and its
+// subdirectories.
+func dirSize(dir string) (int64, error) {
+	var n int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			fi, err := d.Info()
+			if err != nil {
+				return err
+			}
+			n += fi.Size()
+		}
+		return nil
+	})
+	return n, err
+}
@@ -0,0 +1,157 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tailscale.com/ipn"
+	"tailscale.com/ipn/store/mem"
+	"tailscale.com/tailcfg"
+	"tailscale.com/tstest"
+	"tailscale.com/util/must"
+)
+
+func TestTaildropAutoAccept(t *testing.T) {
+	tests := []struct {
+		name      string
+		conflict  string
+		maxBytes  int64
+		existing  map[string]string // files already in the accept dir
+		want      map[string]string // files in the accept dir afterwards
+		wantInbox bool              // whether the file stays in the inbox
+	}{
+		{
+			name: "accept",
+			want: map[string]string{"foo.txt": "new"},
+		},
+		{
+			name:      "skip",
+			existing:  map[string]string{"foo.txt": "old"},
+			want:      map[string]string{"foo.txt": "old"},
+			wantInbox: true,
+		},
+		{
+			name:     "overwrite",
+			conflict: "overwrite",
+			existing: map[string]string{"foo.txt": "old"},
+			want:     map[string]string{"foo.txt": "new"},
+		},
+		{
+			name:     "rename",
+			conflict: "rename",
+			existing: map[string]string{"foo.txt": "old", "foo (1).txt": "older"},
+			want:     map[string]string{"foo.txt": "old", "foo (1).txt": "older", "foo (2).txt": "new"},
+		},
+		{
+			name:     "under_quota",
+			maxBytes: 6,
+			existing: map[string]string{"bar.txt": "old"},
+			want:     map[string]string{"bar.txt": "old", "foo.txt": "new"},
+		},
+		{
+			name:      "over_quota",
+			maxBytes:  5,
+			existing:  map[string]string{"bar.txt": "old"},
+			want:      map[string]string{"bar.txt": "old"},
+			wantInbox: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inbox, acceptDir := t.TempDir(), t.TempDir()
+			for name, contents := range tt.existing {
+				must.Do(os.WriteFile(filepath.Join(acceptDir, name), []byte(contents), 0644))
+			}
+			pm := must.Get(newProfileManager(new(mem.Store), t.Logf))
+			must.Do(pm.SetPrefs((&ipn.Prefs{
+				TaildropAutoAccept: ipn.TaildropAutoAcceptPrefs{
+					Dir:      acceptDir,
+					Conflict: tt.conflict,
+					MaxBytes: tt.maxBytes,
+				},
+			}).View(), ""))
+			ps := &peerAPIServer{
+				b: &LocalBackend{
+					logf:           t.Logf,
+					capFileSharing: true,
+					clock:          &tstest.Clock{},
+					pm:             pm,
+				},
+				rootDir: inbox,
+			}
+			ph := &peerAPIHandler{
+				isSelf:   true,
+				peerNode: (&tailcfg.Node{ComputedName: "some-peer-name"}).View(),
+				selfNode: (&tailcfg.Node{
+					Addresses: []netip.Prefix{netip.MustParsePrefix("100.100.100.101/32")},
+				}).View(),
+				ps: ps,
+			}
+			rr := httptest.NewRecorder()
+			ph.ServeHTTP(rr, httptest.NewRequest("PUT", "http://100.100.100.101:123/v0/put/foo.txt", strings.NewReader("new")))
+			if rr.Code != http.StatusOK {
+				t.Fatalf("put: %v: %s", rr.Code, rr.Body)
+			}
+
+			got := map[string]string{}
+			des := must.Get(os.ReadDir(acceptDir))
+			for _, de := range des {
+				got[de.Name()] = string(must.Get(os.ReadFile(filepath.Join(acceptDir, de.Name()))))
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("accept dir = %q; want %q", got, tt.want)
+			}
+			for name, want := range tt.want {
+				if got[name] != want {
+					t.Errorf("accept dir = %q; want %q", got, tt.want)
+					break
+				}
+			}
+			wfs := must.Get(ps.WaitingFiles())
+			if inInbox := len(wfs) > 0; inInbox != tt.wantInbox {
+				t.Errorf("file in inbox = %v; want %v", inInbox, tt.wantInbox)
+			}
+		})
+	}
+}
+
+func TestCheckTaildropAutoAcceptPref(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	must.Do(os.WriteFile(file, nil, 0644))
+	tests := []struct {
+		name    string
+		aa      ipn.TaildropAutoAcceptPrefs
+		wantErr string
+	}{
+		{"empty", ipn.TaildropAutoAcceptPrefs{}, ""},
+		{"dir", ipn.TaildropAutoAcceptPrefs{Dir: dir, Conflict: "rename", MaxBytes: 1 << 30}, ""},
+		{"relative", ipn.TaildropAutoAcceptPrefs{Dir: "incoming"}, "not an absolute path"},
+		{"missing", ipn.TaildropAutoAcceptPrefs{Dir: filepath.Join(dir, "missing")}, "no such file"},
+		{"not_dir", ipn.TaildropAutoAcceptPrefs{Dir: file}, "not a directory"},
+		{"bad_conflict", ipn.TaildropAutoAcceptPrefs{Conflict: "merge"}, "unknown Taildrop conflict behavior"},
+		{"negative_quota", ipn.TaildropAutoAcceptPrefs{MaxBytes: -1}, "can't be negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkTaildropAutoAcceptPref(&ipn.Prefs{TaildropAutoAccept: tt.aa})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v; want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"tailscale.com/envknob"
+	"tailscale.com/ipn"
+	"tailscale.com/version"
+)
+
+// updateRollbackTimeout, if set, overrides defaultUpdateRollbackTimeout.
+var updateRollbackTimeout = envknob.RegisterDuration("TS_UPDATE_ROLLBACK_TIMEOUT")
+
+// defaultUpdateRollbackTimeout is how long tailscaled waits after an
+// auto-update to reach the Running state before rolling the update back.
+const defaultUpdateRollbackTimeout = 10 * time.Minute
+
+// rollbackCommand returns the command that reinstalls version ver of
+// Tailscale. It's a variable for tests.
+var rollbackCommand = func(ver string) (*exec.Cmd, error) {
+	cmdTS, err := findCmdTailscale()
+	if err != nil {
+		return nil, err
+	}
+	return exec.Command(cmdTS, "update", "--yes", "--version="+ver), nil
+}
+
+// UpdateState returns the versions of tailscaled that ran on this node.
+func (b *LocalBackend) UpdateState() (ipn.UpdateState, error) {
+	b.updateStateMu.Lock()
+	defer b.updateStateMu.Unlock()
+	return b.readUpdateStateLocked()
+}
+
+// readUpdateStateLocked returns the update state from the state store, or
+// the zero value if there's none.
+//
+// b.updateStateMu must be held.
+func (b *LocalBackend) readUpdateStateLocked() (ipn.UpdateState, error) {
+	var st ipn.UpdateState
+	bs, err := b.store.ReadState(ipn.UpdateStateKey)
+	if errors.Is(err, ipn.ErrStateNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return st, err
+	}
+	if err := json.Unmarshal(bs, &st); err != nil {
+		return st, fmt.Errorf("invalid update state: %w", err)
+	}
+	return st, nil
+}
+
+// updateUpdateState applies f to the update state in the state store.
+func (b *LocalBackend) updateUpdateState(f func(*ipn.UpdateState)) (ipn.UpdateState, error) {
+	b.updateStateMu.Lock()
+	defer b.updateStateMu.Unlock()
+	st, err := b.readUpdateStateLocked()
+	if err != nil {
+		b.logf("update state: %v; starting over", err)
+	}
+	f(&st)
+	bs, err := json.Marshal(st)
+	if err != nil {
+		return st, err
+	}
+	return st, ipn.WriteState(b.store, ipn.UpdateStateKey, bs)
+}
+
+// initUpdateState records the running version of tailscaled in the update
+// state. If it's the result of an auto-update, it arranges for the update
+// to be rolled back unless tailscaled reaches the Running state in time.
+func (b *LocalBackend) initUpdateState() {
+	cur := version.Short()
+	st, err := b.updateUpdateState(func(st *ipn.UpdateState) {
+		if st.Version != cur {
+			if st.Version != "" {
+				st.PreviousVersion = st.Version
+			}
+			st.Version = cur
+		}
+		if st.AutoUpdateFrom == cur {
+			// The auto-update didn't install a new version.
+			st.AutoUpdateFrom = ""
+		}
+	})
+	if err != nil {
+		b.logf("update state: %v", err)
+		return
+	}
+	if st.AutoUpdateFrom == "" {
+		return
+	}
+	d := updateRollbackTimeout()
+	if d <= 0 {
+		d = defaultUpdateRollbackTimeout
+	}
+	b.logf("auto-updated from %v to %v; rolling back unless Running within %v", st.AutoUpdateFrom, cur, d)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.updateRollbackTimer = b.clock.AfterFunc(d, func() {
+		b.rollbackAutoUpdate(d)
+	})
+}
+
+// setAutoUpdateStarted records that an auto-update from the running
+// version started, if started, or that it failed otherwise.
+func (b *LocalBackend) setAutoUpdateStarted(started bool) {
+	_, err := b.updateUpdateState(func(st *ipn.UpdateState) {
+		if started {
+			st.AutoUpdateFrom = version.Short()
+		} else {
+			st.AutoUpdateFrom = ""
+		}
+	})
+	if err != nil {
+		b.logf("update state: %v", err)
+	}
+}
+
+// confirmAutoUpdate marks an auto-update as successful, now that tailscaled
+// reached the Running state, if there's one waiting for that.
+func (b *LocalBackend) confirmAutoUpdate() {
+	b.mu.Lock()
+	t := b.updateRollbackTimer
+	b.updateRollbackTimer = nil
+	b.mu.Unlock()
+	if t == nil {
+		return
+	}
+	t.Stop()
+	b.setAutoUpdateStarted(false)
+	b.logf("auto-update to %v confirmed", version.Short())
+}
+
+// rollbackAutoUpdate reinstalls the version of Tailscale that an
+// auto-update replaced, as tailscaled didn't reach the Running state within
+// d of starting.
+func (b *LocalBackend) rollbackAutoUpdate(d time.Duration) {
+	b.mu.Lock()
+	pending := b.updateRollbackTimer != nil
+	b.updateRollbackTimer = nil
+	b.mu.Unlock()
+	if !pending {
+		// Confirmed meanwhile.
+		return
+	}
+
+	var from string
+	_, err := b.updateUpdateState(func(st *ipn.UpdateState) {
+		from = st.AutoUpdateFrom
+		st.AutoUpdateFrom = ""
+		if from != "" {
+			st.RolledBackFrom = version.Short()
+		}
+	})
+	if err != nil {
+		b.logf("update state: %v", err)
+	}
+	if from == "" {
+		return
+	}
+	b.logf("auto-update: not Running within %v of updating from %v to %v; rolling back", d, from, version.Short())
+	cmd, err := rollbackCommand(from)
+	if err != nil {
+		b.logf("auto-update: rollback failed: %v", err)
+		return
+	}
+	buf := new(bytes.Buffer)
+	cmd.Stdout = buf
+	cmd.Stderr = buf
+	if err := cmd.Run(); err != nil {
+		b.logf("auto-update: rollback failed: %v, output: %s", err, buf)
+		return
+	}
+	b.logf("auto-update: rolled back to %v", from)
+}
@@ -0,0 +1,140 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"encoding/json"
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+
+	"tailscale.com/ipn"
+	"tailscale.com/ipn/store/mem"
+	"tailscale.com/tsd"
+	"tailscale.com/tstest"
+	"tailscale.com/types/logger"
+	"tailscale.com/types/logid"
+	"tailscale.com/version"
+	"tailscale.com/wgengine"
+)
+
+// newTestLocalBackendWithUpdateState returns a LocalBackend whose state
+// store starts with st.
+func newTestLocalBackendWithUpdateState(t *testing.T, st ipn.UpdateState) *LocalBackend {
+	t.Helper()
+	store := new(mem.Store)
+	bs, err := json.Marshal(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.WriteState(ipn.UpdateStateKey, bs); err != nil {
+		t.Fatal(err)
+	}
+	sys := new(tsd.System)
+	sys.Set(store)
+	eng, err := wgengine.NewFakeUserspaceEngine(logger.Discard, sys.Set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(eng.Close)
+	sys.Set(eng)
+	b, err := NewLocalBackend(t.Logf, logid.PublicID{}, sys, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(b.Shutdown)
+	return b
+}
+
+func TestUpdateState(t *testing.T) {
+	cur := version.Short()
+	var rolledBackTo []string
+	tstest.Replace(t, &rollbackCommand, func(ver string) (*exec.Cmd, error) {
+		rolledBackTo = append(rolledBackTo, ver)
+		return nil, errors.New("not in tests")
+	})
+
+	tests := []struct {
+		name         string
+		start        ipn.UpdateState
+		confirm      bool
+		rollback     bool
+		want         ipn.UpdateState
+		wantRollback []string
+	}{
+		{
+			name:  "first_run",
+			start: ipn.UpdateState{},
+			want:  ipn.UpdateState{Version: cur},
+		},
+		{
+			name:  "manual_update",
+			start: ipn.UpdateState{Version: "1.0.0"},
+			want:  ipn.UpdateState{Version: cur, PreviousVersion: "1.0.0"},
+		},
+		{
+			name:  "restart",
+			start: ipn.UpdateState{Version: cur, PreviousVersion: "1.0.0"},
+			want:  ipn.UpdateState{Version: cur, PreviousVersion: "1.0.0"},
+		},
+		{
+			name:  "auto_update_installed_nothing",
+			start: ipn.UpdateState{Version: cur, AutoUpdateFrom: cur},
+			want:  ipn.UpdateState{Version: cur},
+		},
+		{
+			name:    "auto_update_confirmed",
+			start:   ipn.UpdateState{Version: "1.0.0", AutoUpdateFrom: "1.0.0"},
+			confirm: true,
+			want:    ipn.UpdateState{Version: cur, PreviousVersion: "1.0.0"},
+		},
+		{
+			name:         "auto_update_rolled_back",
+			start:        ipn.UpdateState{Version: "1.0.0", AutoUpdateFrom: "1.0.0"},
+			rollback:     true,
+			want:         ipn.UpdateState{Version: cur, PreviousVersion: "1.0.0", RolledBackFrom: cur},
+			wantRollback: []string{"1.0.0"},
+		},
+		{
+			name:     "confirmed_then_timed_out",
+			start:    ipn.UpdateState{Version: "1.0.0", AutoUpdateFrom: "1.0.0"},
+			confirm:  true,
+			rollback: true,
+			want:     ipn.UpdateState{Version: cur, PreviousVersion: "1.0.0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rolledBackTo = nil
+			b := newTestLocalBackendWithUpdateState(t, tt.start)
+			b.mu.Lock()
+			armed := b.updateRollbackTimer != nil
+			b.mu.Unlock()
+			if wantArmed := tt.start.AutoUpdateFrom != "" && tt.start.AutoUpdateFrom != cur; armed != wantArmed {
+				t.Errorf("rollback timer armed = %v; want %v", armed, wantArmed)
+			}
+
+			if tt.confirm {
+				b.confirmAutoUpdate()
+			}
+			if tt.rollback {
+				b.rollbackAutoUpdate(time.Minute)
+			}
+			got, err := b.UpdateState()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !armed || tt.confirm || tt.rollback {
+				// Otherwise, the auto-update is still pending.
+				if got != tt.want {
+					t.Errorf("update state = %+v; want %+v", got, tt.want)
+				}
+			}
+			if len(rolledBackTo) != len(tt.wantRollback) || (len(rolledBackTo) > 0 && rolledBackTo[0] != tt.wantRollback[0]) {
+				t.Errorf("rolled back to %q; want %q", rolledBackTo, tt.wantRollback)
+			}
+		})
+	}
+}
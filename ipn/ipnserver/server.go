@@ -30,6 +30,7 @@
 	"tailscale.com/util/mak"
 	"tailscale.com/util/set"
 	"tailscale.com/util/systemd"
+	"tailscale.com/util/winutil/policy"
 )
 
 // Server is an IPN backend and its set of 0 or more active localhost
@@ -202,6 +203,7 @@ func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
 		lah := localapi.NewHandler(lb, s.logf, s.netMon, s.backendLogID)
 		lah.PermitRead, lah.PermitWrite = s.localAPIPermissions(ci)
 		lah.PermitCert = s.connCanFetchCerts(ci)
+		lah.CallerIdentity = ci.String()
 		lah.ServeHTTP(w, r)
 		return
 	}
@@ -286,7 +288,7 @@ func (s *Server) localAPIPermissions(ci *ipnauth.ConnIdentity) (read, write bool
 		s.mu.Lock()
 		defer s.mu.Unlock()
 		if s.checkConnIdentityLocked(ci) == nil {
-			return true, true
+			return true, s.windowsConnCanWrite(ci)
 		}
 		return false, false
 	case "js":
@@ -298,6 +300,22 @@ func (s *Server) localAPIPermissions(ci *ipnauth.ConnIdentity) (read, write bool
 	return false, false
 }
 
+// windowsConnCanWrite reports whether ci, which is allowed to connect, may
+// also change the node's state. Unless the AdminOnlySettings system policy
+// is set, everyone who can connect can; otherwise only local administrators
+// can, and other users get read-only access.
+func (s *Server) windowsConnCanWrite(ci *ipnauth.ConnIdentity) bool {
+	if !policy.GetBoolean(policy.AdminOnlySettings) {
+		return true
+	}
+	isAdmin, err := ci.IsLocalAdmin()
+	if err != nil {
+		s.logf("localapi: read-only access for %v: %v", ci, err)
+		return false
+	}
+	return isAdmin
+}
+
 // userIDFromString maps from either a numeric user id in string form
 // ("998") or username ("caddy") to its string userid ("998").
 // It returns the empty string on error.
@@ -98,6 +98,9 @@ type TKAFilteredPeer struct {
 	StableID     tailcfg.StableNodeID
 	TailscaleIPs []netip.Addr // Tailscale IP(s) assigned to this node
 	NodeKey      key.NodePublic
+	Tags         []string  // ACL tags of the node, if any
+	Owner        string    // login name of the user that owns the node
+	Created      time.Time // when the node was first registered, if known
 }
 
 // NetworkLockStatus represents whether network-lock is enabled,
@@ -145,6 +148,23 @@ type NetworkLockUpdate struct {
 	// Raw contains the serialized AUM. The AUM is sent in serialized
 	// form to avoid transitive dependences bloating this package.
 	Raw []byte
+
+	// Signatures is the result of verifying each of the AUM's signatures
+	// against the keys trusted before it, in order.
+	Signatures []NetworkLockSignatureStatus `json:",omitempty"`
+
+	// VerificationError, if non-empty, is why the AUM's signatures couldn't
+	// be verified, such as because the updates before it were compacted
+	// away.
+	VerificationError string `json:",omitempty"`
+}
+
+// NetworkLockSignatureStatus describes whether a signature of a
+// network-lock update is valid.
+type NetworkLockSignatureStatus struct {
+	KeyID []byte // the ID of the signing key
+	Valid bool
+	Error string `json:",omitempty"` // why the signature isn't valid, if not
 }
 
 // TailnetStatus is information about a Tailscale network ("tailnet").
@@ -292,6 +312,42 @@ type PeerStatus struct {
 	KeyExpiry *time.Time `json:",omitempty"`
 
 	Location *tailcfg.Location `json:",omitempty"`
+
+	// LinkStats, if non-nil, are statistics of the quality of the link to
+	// the peer.
+	LinkStats *PeerLinkStats `json:",omitempty"`
+}
+
+// PeerLinkStats are statistics of the quality of the link to a peer, as
+// measured by magicsock.
+type PeerLinkStats struct {
+	// TxBytes and RxBytes are the number of bytes sent to and received
+	// from the peer on the wire, over both direct paths and DERP. Unlike
+	// PeerStatus.TxBytes and RxBytes, they include WireGuard overhead.
+	TxBytes int64
+	RxBytes int64
+
+	// PingsSent is the number of disco pings sent to the peer, and
+	// PingsLost how many of those went unanswered. Their ratio estimates
+	// the packet loss on the link.
+	PingsSent int64
+	PingsLost int64
+
+	// Latency is the round-trip time of the last answered ping.
+	Latency time.Duration `json:",omitempty"`
+
+	// Jitter is the smoothed mean deviation of ping round-trip times, as
+	// in RFC 3550.
+	Jitter time.Duration `json:",omitempty"`
+}
+
+// Loss returns the fraction of pings to the peer that were lost, from 0
+// to 1.
+func (s *PeerLinkStats) Loss() float64 {
+	if s.PingsSent == 0 {
+		return 0
+	}
+	return float64(s.PingsLost) / float64(s.PingsSent)
 }
 
 // HasCap reports whether ps has the given capability.
@@ -465,6 +521,9 @@ func (sb *StatusBuilder) AddPeer(peer key.NodePublic, st *PeerStatus) {
 	if st.Active {
 		e.Active = true
 	}
+	if v := st.LinkStats; v != nil {
+		e.LinkStats = v
+	}
 	if st.PeerAPIURL != nil {
 		e.PeerAPIURL = st.PeerAPIURL
 	}
@@ -705,3 +764,26 @@ type DebugDERPRegionReport struct {
 	Warnings []string
 	Errors   []string
 }
+
+// NetstackConn is a TCP or UDP flow that netstack forwards to a backend, as
+// returned by the "tailscale debug netstack-conns" command, to debug
+// forwarded connections that linger.
+type NetstackConn struct {
+	Proto string         // "tcp" or "udp"
+	Src   netip.AddrPort // the peer that opened the flow
+	Dst   netip.AddrPort // the address the peer sent it to
+
+	// Backend is the address that netstack dialed or sends to on the
+	// peer's behalf.
+	Backend string
+
+	// State is the state of the flow: for TCP, "dialing" until the
+	// backend accepted the connection, "established", then "closing"
+	// once either side has closed it; for UDP, always "active".
+	State string
+
+	Started time.Time
+
+	RxBytes int64 // bytes from the peer to the backend
+	TxBytes int64 // bytes from the backend to the peer
+}
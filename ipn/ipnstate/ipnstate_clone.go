@@ -7,6 +7,7 @@
 
 import (
 	"net/netip"
+	"time"
 
 	"tailscale.com/tailcfg"
 	"tailscale.com/types/key"
@@ -21,6 +22,7 @@ func (src *TKAFilteredPeer) Clone() *TKAFilteredPeer {
 	dst := new(TKAFilteredPeer)
 	*dst = *src
 	dst.TailscaleIPs = append(src.TailscaleIPs[:0:0], src.TailscaleIPs...)
+	dst.Tags = append(src.Tags[:0:0], src.Tags...)
 	return dst
 }
 
@@ -31,4 +33,7 @@ func (src *TKAFilteredPeer) Clone() *TKAFilteredPeer {
 	StableID     tailcfg.StableNodeID
 	TailscaleIPs []netip.Addr
 	NodeKey      key.NodePublic
+	Tags         []string
+	Owner        string
+	Created      time.Time
 }{})
@@ -0,0 +1,141 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package localapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+
+	"tailscale.com/client/tailscale/apitype"
+)
+
+// maxAuditEntries is the number of most recent audit entries kept in memory
+// for the /localapi-audit handler. All entries are also logged.
+const maxAuditEntries = 1000
+
+var (
+	auditMu      sync.Mutex
+	auditEntries []apitype.LocalAPIAuditEntry // oldest first; at most maxAuditEntries
+)
+
+// unauditedEndpoints are the LocalAPI endpoints, as keyed in handler, that
+// take non-GET requests but don't change state, so aren't audited.
+var unauditedEndpoints = map[string]bool{
+	"check-prefs":           true,
+	"debug-log":             true,
+	"dial":                  true,
+	"ping":                  true,
+	"tka/affected-sigs":     true,
+	"tka/verify-deeplink":   true,
+	"upload-client-metrics": true,
+}
+
+// isAuditedRequest reports whether r may change state and is thus recorded
+// in the audit log.
+func isAuditedRequest(r *http.Request) bool {
+	switch r.Method {
+	case "GET", "HEAD", "OPTIONS":
+		return false
+	}
+	return !unauditedEndpoints[strings.TrimPrefix(r.URL.Path, "/localapi/v0/")]
+}
+
+type auditSummaryContextKey struct{}
+
+// setAuditSummary sets the summary of the change requested by r that's
+// recorded in the audit log, in place of its query parameters. It's a no-op
+// if r isn't audited.
+func setAuditSummary(r *http.Request, summary string) {
+	if p, ok := r.Context().Value(auditSummaryContextKey{}).(*string); ok {
+		*p = summary
+	}
+}
+
+// serveAudited runs fn for the state-changing request r, then records it in
+// the audit log along with the caller and the response status.
+func (h *Handler) serveAudited(fn localAPIHandler, w http.ResponseWriter, r *http.Request) {
+	summary := r.URL.RawQuery
+	r = r.WithContext(context.WithValue(r.Context(), auditSummaryContextKey{}, &summary))
+	aw := &auditResponseWriter{ResponseWriter: w}
+	defer func() {
+		caller := h.CallerIdentity
+		if caller == "" {
+			caller = "unknown"
+		}
+		e := apitype.LocalAPIAuditEntry{
+			Time:     h.clock.Now(),
+			Method:   r.Method,
+			Endpoint: r.URL.Path,
+			Caller:   caller,
+			Summary:  summary,
+			Status:   aw.status(),
+		}
+		h.logf("localapi-audit: %s %s caller=[%s] status=%d summary=%q", e.Method, e.Endpoint, e.Caller, e.Status, e.Summary)
+		auditMu.Lock()
+		defer auditMu.Unlock()
+		if len(auditEntries) >= maxAuditEntries {
+			auditEntries = append(auditEntries[:0], auditEntries[1:]...)
+		}
+		auditEntries = append(auditEntries, e)
+	}()
+	fn(h, aw, r)
+}
+
+// serveLocalAPIAudit returns the recent state-changing LocalAPI requests,
+// oldest first.
+func (h *Handler) serveLocalAPIAudit(w http.ResponseWriter, r *http.Request) {
+	if !h.PermitRead {
+		http.Error(w, "audit log access denied", http.StatusForbidden)
+		return
+	}
+	if r.Method != "GET" {
+		http.Error(w, "unsupported method", http.StatusMethodNotAllowed)
+		return
+	}
+	auditMu.Lock()
+	entries := append([]apitype.LocalAPIAuditEntry{}, auditEntries...)
+	auditMu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// auditResponseWriter is an http.ResponseWriter that records the status code
+// of the response. It passes flushes through to the underlying ResponseWriter,
+// as some audited handlers stream their responses.
+type auditResponseWriter struct {
+	http.ResponseWriter
+	code int // or zero if no header was written
+}
+
+func (w *auditResponseWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *auditResponseWriter) Write(p []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *auditResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// status returns the status code of the response, which is 200 if the
+// handler returned without writing anything.
+func (w *auditResponseWriter) status() int {
+	if w.code == 0 {
+		return http.StatusOK
+	}
+	return w.code
+}
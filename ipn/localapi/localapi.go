@@ -50,6 +50,7 @@
 	"tailscale.com/util/osdiag"
 	"tailscale.com/util/rands"
 	"tailscale.com/version"
+	"tailscale.com/wgengine/capture"
 	"tailscale.com/wgengine/magicsock"
 )
 
@@ -60,10 +61,11 @@
 // then it's a prefix match.
 var handler = map[string]localAPIHandler{
 	// The prefix match handlers end with a slash:
-	"cert/":     (*Handler).serveCert,
-	"file-put/": (*Handler).serveFilePut,
-	"files/":    (*Handler).serveFiles,
-	"profiles/": (*Handler).serveProfiles,
+	"cert/":          (*Handler).serveCert,
+	"file-put/":      (*Handler).serveFilePut,
+	"files/":         (*Handler).serveFiles,
+	"prefs-presets/": (*Handler).servePrefsPresets,
+	"profiles/":      (*Handler).serveProfiles,
 
 	// The other /localapi/v0/NAME handlers are exact matches and contain only NAME
 	// without a trailing slash:
@@ -79,29 +81,40 @@
 	"debug-peer-endpoint-changes": (*Handler).serveDebugPeerEndpointChanges,
 	"debug-capture":               (*Handler).serveDebugCapture,
 	"debug-log":                   (*Handler).serveDebugLog,
+	"debug-netstack-conns":        (*Handler).serveDebugNetstackConns,
 	"derpmap":                     (*Handler).serveDERPMap,
+	"dns-osconfig":                (*Handler).serveDNSOSConfig,
 	"dev-set-state-store":         (*Handler).serveDevSetStateStore,
 	"set-push-device-token":       (*Handler).serveSetPushDeviceToken,
 	"dial":                        (*Handler).serveDial,
 	"file-targets":                (*Handler).serveFileTargets,
 	"goroutines":                  (*Handler).serveGoroutines,
+	"health":                      (*Handler).serveHealth,
 	"id-token":                    (*Handler).serveIDToken,
+	"listen-port":                 (*Handler).serveListenPort,
 	"login-interactive":           (*Handler).serveLoginInteractive,
 	"logout":                      (*Handler).serveLogout,
+	"local-logs":                  (*Handler).serveLocalLogs,
+	"localapi-audit":              (*Handler).serveLocalAPIAudit,
 	"logtap":                      (*Handler).serveLogTap,
 	"metrics":                     (*Handler).serveMetrics,
 	"ping":                        (*Handler).servePing,
 	"prefs":                       (*Handler).servePrefs,
 	"pprof":                       (*Handler).servePprof,
 	"reset-auth":                  (*Handler).serveResetAuth,
+	"serve-certs":                 (*Handler).serveServeCerts,
 	"serve-config":                (*Handler).serveServeConfig,
+	"serve-config-history":        (*Handler).serveServeConfigHistory,
+	"serve-config-rollback":       (*Handler).serveServeConfigRollback,
 	"set-dns":                     (*Handler).serveSetDNS,
 	"set-expiry-sooner":           (*Handler).serveSetExpirySooner,
+	"ssh-sessions":                (*Handler).serveSSHSessions,
 	"start":                       (*Handler).serveStart,
 	"status":                      (*Handler).serveStatus,
 	"tka/init":                    (*Handler).serveTKAInit,
 	"tka/log":                     (*Handler).serveTKALog,
 	"tka/modify":                  (*Handler).serveTKAModify,
+	"tka/rotate-key":              (*Handler).serveTKARotateKey,
 	"tka/sign":                    (*Handler).serveTKASign,
 	"tka/status":                  (*Handler).serveTKAStatus,
 	"tka/disable":                 (*Handler).serveTKADisable,
@@ -112,6 +125,7 @@
 	"tka/generate-recovery-aum":   (*Handler).serveTKAGenerateRecoveryAUM,
 	"tka/cosign-recovery-aum":     (*Handler).serveTKACosignRecoveryAUM,
 	"tka/submit-recovery-aum":     (*Handler).serveTKASubmitRecoveryAUM,
+	"update/state":                (*Handler).serveUpdateState,
 	"upload-client-metrics":       (*Handler).serveUploadClientMetrics,
 	"watch-ipn-bus":               (*Handler).serveWatchIPNBus,
 	"whois":                       (*Handler).serveWhoIs,
@@ -153,6 +167,11 @@ type Handler struct {
 	// cert fetching access.
 	PermitCert bool
 
+	// CallerIdentity describes the local user and process making the
+	// request, for the audit log of state-changing requests. It's
+	// optional.
+	CallerIdentity string
+
 	b            *ipnlocal.LocalBackend
 	logf         logger.Logf
 	netMon       *netmon.Monitor // optional; nil means interfaces will be looked up on-demand
@@ -189,7 +208,11 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	if fn, ok := handlerForPath(r.URL.Path); ok {
-		fn(h, w, r)
+		if isAuditedRequest(r) {
+			h.serveAudited(fn, w, r)
+		} else {
+			fn(h, w, r)
+		}
 	} else {
 		http.NotFound(w, r)
 	}
@@ -496,6 +519,58 @@ func (h *Handler) serveLogTap(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// serveLocalLogs writes the logs retained in local-only logging mode, as a
+// stream of JSON objects. With "follow=true", it then streams new logs as
+// they're written, like serveLogTap.
+func (h *Handler) serveLocalLogs(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Require write access (~root) as the logs could contain something
+	// sensitive.
+	if !h.PermitWrite {
+		http.Error(w, "local logs access denied", http.StatusForbidden)
+		return
+	}
+	if r.Method != "GET" {
+		http.Error(w, "GET required", http.StatusMethodNotAllowed)
+		return
+	}
+	ll := logtail.GetLocalLog()
+	if ll == nil {
+		http.Error(w, "local-only logging is not enabled; run tailscaled with --logs-local-only", http.StatusNotFound)
+		return
+	}
+	follow, _ := strconv.ParseBool(r.FormValue("follow"))
+
+	// Register for new logs before writing the retained ones, so that
+	// none are missed in between.
+	var msgc chan string
+	if follow {
+		msgc = make(chan string, 16)
+		unreg := logtail.RegisterLogTap(msgc)
+		defer unreg()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := ll.WriteTo(w); err != nil || !follow {
+		return
+	}
+	f, ok := w.(http.Flusher)
+	if !ok {
+		return
+	}
+	f.Flush()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-msgc:
+			io.WriteString(w, msg)
+			f.Flush()
+		}
+	}
+}
+
 func (h *Handler) serveMetrics(w http.ResponseWriter, r *http.Request) {
 	// Require write access out of paranoia that the metrics
 	// might contain something sensitive.
@@ -503,7 +578,7 @@ func (h *Handler) serveMetrics(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "metric access denied", http.StatusForbidden)
 		return
 	}
-	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
 	clientmetric.WritePrometheusExpositionFormat(w)
 }
 
@@ -630,6 +705,26 @@ func (h *Handler) serveDebugPacketFilterMatches(w http.ResponseWriter, r *http.R
 	enc.Encode(nm.PacketFilter)
 }
 
+func (h *Handler) serveDebugNetstackConns(w http.ResponseWriter, r *http.Request) {
+	if !h.PermitWrite {
+		http.Error(w, "debug access denied", http.StatusForbidden)
+		return
+	}
+	if r.Method != "GET" {
+		http.Error(w, "use GET", http.StatusMethodNotAllowed)
+		return
+	}
+	conns, ok := h.b.NetstackConns()
+	if !ok {
+		http.Error(w, "netstack not in use", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	enc.Encode(conns)
+}
+
 func (h *Handler) serveDebugPortmap(w http.ResponseWriter, r *http.Request) {
 	if !h.PermitWrite {
 		http.Error(w, "debug access denied", http.StatusForbidden)
@@ -637,10 +732,17 @@ func (h *Handler) serveDebugPortmap(w http.ResponseWriter, r *http.Request) {
 	}
 	w.Header().Set("Content-Type", "text/plain")
 
-	dur, err := time.ParseDuration(r.FormValue("duration"))
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+	// In watch mode, the mapping is kept and renewed, and lease events are
+	// logged, until the client goes away. The duration is ignored.
+	watch := defBool(r.FormValue("watch"), false)
+	var dur time.Duration
+	if !watch {
+		var err error
+		dur, err = time.ParseDuration(r.FormValue("duration"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 	}
 
 	gwSelf := r.FormValue("gateway_and_self")
@@ -699,7 +801,15 @@ func (h *Handler) serveDebugPortmap(w http.ResponseWriter, r *http.Request) {
 		logLock.Unlock()
 	}()
 
-	ctx, cancel := context.WithTimeout(r.Context(), dur)
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+	if watch {
+		ctx, cancel = context.WithCancel(r.Context())
+	} else {
+		ctx, cancel = context.WithTimeout(r.Context(), dur)
+	}
 	defer cancel()
 
 	done := make(chan bool, 1)
@@ -720,6 +830,11 @@ func (h *Handler) serveDebugPortmap(w http.ResponseWriter, r *http.Request) {
 		logf("cb: no mapping")
 	})
 	defer c.Close()
+	if watch {
+		c.SetLeaseEventFunc(func(ev portmapper.LeaseEvent) {
+			logf("lease: %v", ev)
+		})
+	}
 
 	netMon, err := netmon.New(logger.WithPrefix(logf, "monitor: "))
 	if err != nil {
@@ -770,6 +885,22 @@ func (h *Handler) serveDebugPortmap(w http.ResponseWriter, r *http.Request) {
 		logf("no mapping")
 	}
 
+	if watch {
+		// Poll the mapping, as the portmapper only renews it when asked
+		// for it after it's due for renewal.
+		t := time.NewTicker(time.Second)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				c.GetCachedMappingOrStartCreatingOne()
+			case <-ctx.Done():
+				h.logf("serveDebugPortmap: watch done: %v", ctx.Err())
+				return
+			}
+		}
+	}
+
 	select {
 	case <-done:
 	case <-ctx.Done():
@@ -864,10 +995,6 @@ func (h *Handler) serveServeConfig(w http.ResponseWriter, r *http.Request) {
 		}
 		etag := r.Header.Get("If-Match")
 		if err := h.b.SetServeConfig(configIn, etag); err != nil {
-			if errors.Is(err, ipnlocal.ErrETagMismatch) {
-				http.Error(w, err.Error(), http.StatusPreconditionFailed)
-				return
-			}
 			writeErrorJSON(w, fmt.Errorf("updating config: %w", err))
 			return
 		}
@@ -877,6 +1004,80 @@ func (h *Handler) serveServeConfig(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (h *Handler) serveServeConfigHistory(w http.ResponseWriter, r *http.Request) {
+	if !h.PermitRead {
+		http.Error(w, "serve config denied", http.StatusForbidden)
+		return
+	}
+	if r.Method != "GET" {
+		http.Error(w, "use GET", http.StatusMethodNotAllowed)
+		return
+	}
+	hist, err := h.b.ServeConfigHistory()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hist)
+}
+
+func (h *Handler) serveUpdateState(w http.ResponseWriter, r *http.Request) {
+	if !h.PermitRead {
+		http.Error(w, "update state access denied", http.StatusForbidden)
+		return
+	}
+	if r.Method != "GET" {
+		http.Error(w, "use GET", http.StatusMethodNotAllowed)
+		return
+	}
+	st, err := h.b.UpdateState()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(st)
+}
+
+func (h *Handler) serveServeCerts(w http.ResponseWriter, r *http.Request) {
+	if !h.PermitRead {
+		http.Error(w, "serve certs access denied", http.StatusForbidden)
+		return
+	}
+	if r.Method != "GET" {
+		http.Error(w, "use GET", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.b.ServeCertStatus())
+}
+
+func (h *Handler) serveServeConfigRollback(w http.ResponseWriter, r *http.Request) {
+	if !h.PermitWrite {
+		http.Error(w, "serve config denied", http.StatusForbidden)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	n := 1
+	if v := r.FormValue("to"); v != "" {
+		var err error
+		n, err = strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "invalid 'to' parameter", http.StatusBadRequest)
+			return
+		}
+	}
+	if err := h.b.RollbackServeConfig(n); err != nil {
+		writeErrorJSON(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
 func (h *Handler) serveCheckIPForwarding(w http.ResponseWriter, r *http.Request) {
 	if !h.PermitRead {
 		http.Error(w, "IP forwarding check access denied", http.StatusForbidden)
@@ -894,6 +1095,44 @@ func (h *Handler) serveCheckIPForwarding(w http.ResponseWriter, r *http.Request)
 	})
 }
 
+// serveListenPort returns the UDP port that tailscaled listens on for
+// WireGuard and peer-to-peer traffic, for firewall automation.
+func (h *Handler) serveListenPort(w http.ResponseWriter, r *http.Request) {
+	if !h.PermitRead {
+		http.Error(w, "listen-port access denied", http.StatusForbidden)
+		return
+	}
+	if r.Method != "GET" {
+		http.Error(w, "use GET", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Port uint16
+	}{
+		Port: h.b.ListenPort(),
+	})
+}
+
+// serveHealth returns the node's current health problems as a JSON
+// array of health.Warning, most severe first.
+func (h *Handler) serveHealth(w http.ResponseWriter, r *http.Request) {
+	if !h.PermitRead {
+		http.Error(w, "health access denied", http.StatusForbidden)
+		return
+	}
+	if r.Method != "GET" {
+		http.Error(w, "use GET", http.StatusMethodNotAllowed)
+		return
+	}
+	ws := h.b.HealthWarnings()
+	if ws == nil {
+		ws = []health.Warning{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ws)
+}
+
 func (h *Handler) serveStatus(w http.ResponseWriter, r *http.Request) {
 	if !h.PermitRead {
 		http.Error(w, "status access denied", http.StatusForbidden)
@@ -1072,6 +1311,7 @@ func (h *Handler) servePrefs(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, err.Error(), 400)
 			return
 		}
+		setAuditSummary(r, mp.Pretty())
 		var err error
 		prefs, err = h.b.EditPrefs(mp)
 		if err != nil {
@@ -1179,16 +1419,35 @@ func (h *Handler) serveFiles(w http.ResponseWriter, r *http.Request) {
 	io.Copy(w, rc)
 }
 
+// writeErrorJSON writes err as an apitype.ErrorResponse. The response has
+// status 500, unless err is of a kind with an error code of its own; see
+// errorCodeAndStatus.
 func writeErrorJSON(w http.ResponseWriter, err error) {
 	if err == nil {
 		err = errors.New("unexpected nil error")
 	}
+	code, status := errorCodeAndStatus(err)
+	writeErrorResponse(w, status, apitype.ErrorResponse{Error: err.Error(), Code: code})
+}
+
+func writeErrorResponse(w http.ResponseWriter, status int, res apitype.ErrorResponse) {
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(500)
-	type E struct {
-		Error string `json:"error"`
-	}
-	json.NewEncoder(w).Encode(E{err.Error()})
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(res)
+}
+
+// errorCodeAndStatus returns the error code and HTTP status of the response
+// for err, which are empty and 500 for errors without a code.
+func errorCodeAndStatus(err error) (apitype.ErrorCode, int) {
+	switch {
+	case errors.Is(err, ipnlocal.ErrETagMismatch):
+		return apitype.ErrCodePreconditionFailed, http.StatusPreconditionFailed
+	case errors.Is(err, ipn.ErrFunnelNotEnabled):
+		return apitype.ErrCodeFunnelNotEnabled, http.StatusForbidden
+	case errors.Is(err, ipnlocal.ErrNetworkLockNotTrusted):
+		return apitype.ErrCodeNetworkLockNotTrusted, http.StatusForbidden
+	}
+	return "", http.StatusInternalServerError
 }
 
 func (h *Handler) serveFileTargets(w http.ResponseWriter, r *http.Request) {
@@ -1229,6 +1488,10 @@ func (h *Handler) serveFileTargets(w http.ResponseWriter, r *http.Request) {
 // URL format:
 //
 //   - PUT /localapi/v0/file-put/:stableID/:escaped-filename
+//   - PUT /localapi/v0/file-put/:stableID/:escaped-filename?offset=N
+//     resumes an interrupted transfer, sending the file from byte N on
+//   - GET /localapi/v0/file-put/:stableID/:escaped-filename returns the
+//     peer's apitype.PartialFileInfo of an interrupted transfer
 func (h *Handler) serveFilePut(w http.ResponseWriter, r *http.Request) {
 	metricFilePutCalls.Add(1)
 
@@ -1236,7 +1499,7 @@ func (h *Handler) serveFilePut(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "file access denied", http.StatusForbidden)
 		return
 	}
-	if r.Method != "PUT" {
+	if r.Method != "PUT" && r.Method != "GET" {
 		http.Error(w, "want PUT to put file", 400)
 		return
 	}
@@ -1274,12 +1537,22 @@ func (h *Handler) serveFilePut(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "bogus peer URL", 500)
 		return
 	}
-	outReq, err := http.NewRequestWithContext(r.Context(), "PUT", "http://peer/v0/put/"+filenameEscaped, r.Body)
+	outURL := "http://peer/v0/put/" + filenameEscaped
+	if offset := r.URL.Query().Get("offset"); offset != "" {
+		outURL += "?offset=" + url.QueryEscape(offset)
+	}
+	var body io.Reader
+	if r.Method == "PUT" {
+		body = r.Body
+	}
+	outReq, err := http.NewRequestWithContext(r.Context(), r.Method, outURL, body)
 	if err != nil {
 		http.Error(w, "bogus outreq", 500)
 		return
 	}
-	outReq.ContentLength = r.ContentLength
+	if r.Method == "PUT" {
+		outReq.ContentLength = r.ContentLength
+	}
 
 	rp := httputil.NewSingleHostReverseProxy(dstURL)
 	rp.Transport = h.b.Dialer().PeerAPITransport()
@@ -1316,6 +1589,36 @@ func (h *Handler) serveDERPMap(w http.ResponseWriter, r *http.Request) {
 	e.Encode(h.b.DERPMap())
 }
 
+// serveSSHSessions returns the running Tailscale SSH sessions.
+func (h *Handler) serveSSHSessions(w http.ResponseWriter, r *http.Request) {
+	if !h.PermitRead {
+		http.Error(w, "ssh-sessions access denied", http.StatusForbidden)
+		return
+	}
+	if r.Method != "GET" {
+		http.Error(w, "want GET", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.b.SSHSessions())
+}
+
+func (h *Handler) serveDNSOSConfig(w http.ResponseWriter, r *http.Request) {
+	if !h.PermitRead {
+		http.Error(w, "dns-osconfig access denied", http.StatusForbidden)
+		return
+	}
+	if r.Method != "GET" {
+		http.Error(w, "want GET", http.StatusMethodNotAllowed)
+		return
+	}
+	var res apitype.DNSOSConfigResponse
+	info := h.b.DNSOSConfiguratorMode()
+	res.Mode, res.Forced, res.Notes = info.Mode, info.Forced, info.Notes
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
 // serveSetExpirySooner sets the expiry date on the current machine, specified
 // by an `expiry` unix timestamp as POST or query param.
 func (h *Handler) serveSetExpirySooner(w http.ResponseWriter, r *http.Request) {
@@ -1559,7 +1862,7 @@ type signRequest struct {
 	}
 
 	if err := h.b.NetworkLockSign(req.NodeKey, req.RotationPublic); err != nil {
-		http.Error(w, "signing failed: "+err.Error(), http.StatusInternalServerError)
+		writeErrorJSON(w, fmt.Errorf("signing failed: %w", err))
 		return
 	}
 
@@ -1628,6 +1931,27 @@ type modifyRequest struct {
 	w.WriteHeader(204)
 }
 
+func (h *Handler) serveTKARotateKey(w http.ResponseWriter, r *http.Request) {
+	if !h.PermitWrite {
+		http.Error(w, "network-lock modify access denied", http.StatusForbidden)
+		return
+	}
+	if r.Method != httpm.POST {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	newKey, err := h.b.NetworkLockRotateKey()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		NewKey key.NLPublic
+	}{newKey})
+}
+
 func (h *Handler) serveTKAWrapPreauthKey(w http.ResponseWriter, r *http.Request) {
 	if !h.PermitWrite {
 		http.Error(w, "network-lock modify access denied", http.StatusForbidden)
@@ -1977,6 +2301,69 @@ func (h *Handler) serveProfiles(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// servePrefsPresets serves the prefs presets of the current profile.
+//
+// GET /localapi/v0/prefs-presets/ lists them, and for the preset NAME,
+// PUT /localapi/v0/prefs-presets/NAME saves the current prefs as it,
+// POST /localapi/v0/prefs-presets/NAME applies it and returns the new
+// prefs, and DELETE /localapi/v0/prefs-presets/NAME deletes it.
+func (h *Handler) servePrefsPresets(w http.ResponseWriter, r *http.Request) {
+	if !h.PermitWrite {
+		http.Error(w, "prefs-presets access denied", http.StatusForbidden)
+		return
+	}
+	suffix, ok := strings.CutPrefix(r.URL.EscapedPath(), "/localapi/v0/prefs-presets/")
+	if !ok {
+		http.Error(w, "misconfigured", http.StatusInternalServerError)
+		return
+	}
+	if suffix == "" {
+		if r.Method != httpm.GET {
+			http.Error(w, "use GET", http.StatusMethodNotAllowed)
+			return
+		}
+		presets, err := h.b.PrefsPresets()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(presets)
+		return
+	}
+	name, err := url.PathUnescape(suffix)
+	if err != nil {
+		http.Error(w, "bad preset name", http.StatusBadRequest)
+		return
+	}
+	switch r.Method {
+	case httpm.PUT:
+		preset, err := h.b.SavePrefsPreset(name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(preset)
+	case httpm.POST:
+		prefs, err := h.b.UsePrefsPreset(name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(prefs)
+	case httpm.DELETE:
+		if err := h.b.DeletePrefsPreset(name); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "use PUT, POST or DELETE", http.StatusMethodNotAllowed)
+	}
+}
+
 // serveQueryFeature makes a request to the "/machine/feature/query"
 // Noise endpoint to get instructions on how to enable a feature, such as
 // Funnel, for the node's tailnet.
@@ -2058,9 +2445,40 @@ func (h *Handler) serveDebugCapture(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	f, err := parseCaptureFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	w.WriteHeader(200)
 	w.(http.Flusher).Flush()
-	h.b.StreamDebugCapture(r.Context(), w)
+	h.b.StreamDebugCapture(r.Context(), w, f)
+}
+
+// parseCaptureFilter returns the packet filter of a debug-capture request,
+// given by its "host" (IP address) and "port" parameters, or nil if it has
+// neither.
+func parseCaptureFilter(q url.Values) (*capture.Filter, error) {
+	if !q.Has("host") && !q.Has("port") {
+		return nil, nil
+	}
+	f := new(capture.Filter)
+	for _, v := range q["host"] {
+		ip, err := netip.ParseAddr(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid host %q: %w", v, err)
+		}
+		f.Hosts = append(f.Hosts, ip)
+	}
+	for _, v := range q["port"] {
+		port, err := strconv.ParseUint(v, 10, 16)
+		if err != nil || port == 0 {
+			return nil, fmt.Errorf("invalid port %q", v)
+		}
+		f.Ports = append(f.Ports, uint16(port))
+	}
+	return f, nil
 }
 
 func (h *Handler) serveDebugLog(w http.ResponseWriter, r *http.Request) {
@@ -9,12 +9,15 @@
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"testing"
+	"time"
 
 	"tailscale.com/client/tailscale/apitype"
 	"tailscale.com/hostinfo"
 	"tailscale.com/ipn/ipnlocal"
 	"tailscale.com/tstest"
+	"tailscale.com/tstime"
 )
 
 func TestValidHost(t *testing.T) {
@@ -48,6 +51,8 @@ func TestSetPushDeviceToken(t *testing.T) {
 	h := &Handler{
 		PermitWrite: true,
 		b:           &ipnlocal.LocalBackend{},
+		logf:        t.Logf,
+		clock:       tstime.StdClock{},
 	}
 	s := httptest.NewServer(h)
 	defer s.Close()
@@ -77,3 +82,65 @@ func TestSetPushDeviceToken(t *testing.T) {
 		t.Errorf("hostinfo.PushDeviceToken=%q, want %q", got, want)
 	}
 }
+
+func TestLocalAPIAudit(t *testing.T) {
+	tstest.Replace(t, &validLocalHostForTesting, true)
+	tstest.Replace(t, &auditEntries, nil)
+
+	h := &Handler{
+		PermitRead:     true,
+		CallerIdentity: "uid=1000 pid=42",
+		b:              &ipnlocal.LocalBackend{},
+		logf:           t.Logf,
+		clock:          tstime.StdClock{},
+	}
+	s := httptest.NewServer(h)
+	defer s.Close()
+	c := s.Client()
+
+	do := func(method, path string, body io.Reader) []byte {
+		t.Helper()
+		req, err := http.NewRequest(method, s.URL+path, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		b, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	// Denied: not permitted to write.
+	do("POST", "/localapi/v0/set-push-device-token?x=1", bytes.NewReader([]byte("{}")))
+	// Not audited: non-mutating endpoint.
+	do("POST", "/localapi/v0/upload-client-metrics", bytes.NewReader([]byte("[]")))
+	// Not audited: GET.
+	do("GET", "/localapi/v0/localapi-audit", nil)
+
+	h.PermitWrite = true
+	do("POST", "/localapi/v0/set-push-device-token", bytes.NewReader([]byte("{}")))
+
+	var got []apitype.LocalAPIAuditEntry
+	if err := json.Unmarshal(do("GET", "/localapi/v0/localapi-audit", nil), &got); err != nil {
+		t.Fatal(err)
+	}
+	for i := range got {
+		if got[i].Time.IsZero() {
+			t.Errorf("entry %d has zero time", i)
+		}
+		got[i].Time = time.Time{}
+	}
+	want := []apitype.LocalAPIAuditEntry{
+		{Method: "POST", Endpoint: "/localapi/v0/set-push-device-token", Caller: "uid=1000 pid=42", Summary: "x=1", Status: http.StatusForbidden},
+		{Method: "POST", Endpoint: "/localapi/v0/set-push-device-token", Caller: "uid=1000 pid=42", Status: http.StatusOK},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("audit entries:\n got %+v\nwant %+v", got, want)
+	}
+}
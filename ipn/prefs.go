@@ -9,12 +9,15 @@
 	"errors"
 	"fmt"
 	"log"
+	"maps"
 	"net/netip"
 	"os"
 	"path/filepath"
 	"reflect"
 	"runtime"
+	"slices"
 	"strings"
+	"time"
 
 	"tailscale.com/atomicfile"
 	"tailscale.com/ipn/ipnstate"
@@ -103,10 +106,26 @@ type Prefs struct {
 	// routed directly or via the exit node.
 	ExitNodeAllowLANAccess bool
 
+	// ExitNodeFailover, if non-empty, is an ordered list of exit nodes
+	// to fail over between. ipnlocal.LocalBackend sets ExitNodeID to
+	// the first node in the list that's online and offers exit node
+	// services, switching to the next one when it goes offline and back
+	// when it recovers. If none of them is usable, the current exit node
+	// is kept.
+	ExitNodeFailover []tailcfg.StableNodeID `json:",omitempty"`
+
 	// CorpDNS specifies whether to install the Tailscale network's
 	// DNS configuration, if it exists.
 	CorpDNS bool
 
+	// DNSRoutes are split DNS routes configured locally, in addition to
+	// those provided by the control plane. It maps DNS suffixes to the
+	// resolvers to query for names under them, in the format of
+	// dnstype.Resolver.Addr (an IP, IP:port or DoH URL). They're only
+	// used when CorpDNS is true, and routes from the control plane take
+	// precedence for the same suffix.
+	DNSRoutes map[string][]string `json:",omitempty"`
+
 	// RunSSH bool is whether this node should run an SSH
 	// server, permitting access to peers according to the
 	// policies as configured by the Tailnet's admin(s).
@@ -183,6 +202,34 @@ type Prefs struct {
 	// Linux-only.
 	NoSNAT bool
 
+	// RateLimits are bandwidth limits on the traffic this node carries to
+	// and from peers or subnet routes, such as to cap the usage of each
+	// client of an exit node. When several apply to a packet, the one with
+	// the longest prefix wins.
+	RateLimits []RateLimit `json:",omitempty"`
+
+	// DNSMode, if non-empty, is the kind of DNS manager to use on Linux,
+	// such as "systemd-resolved" or "direct", instead of detecting one.
+	// It only takes effect when tailscaled starts, as the DNS manager is
+	// chosen before prefs are applied. The DNSMode system policy and the
+	// TS_DNS_MODE environment variable take precedence.
+	//
+	// Linux-only.
+	DNSMode string `json:",omitempty"`
+
+	// DERPHomeRegion, if non-zero, is the ID of the DERP region to use as
+	// the node's home, instead of the one with the lowest latency. It's
+	// ignored if the DERP map has no such region. The DERPHomeRegion
+	// system policy takes precedence.
+	DERPHomeRegion int `json:",omitempty"`
+
+	// DERPExcludeRegions are the IDs of DERP regions never to pick as the
+	// node's home, such as regions that are blocked on the local network
+	// or out of scope for legal reasons. Peers whose home is in one of them
+	// are still reached through it. The DERPExcludeRegions system policy
+	// adds to them.
+	DERPExcludeRegions []int `json:",omitempty"`
+
 	// NetfilterMode specifies how much to manage netfilter rules for
 	// Tailscale, if at all.
 	NetfilterMode preftype.NetfilterMode
@@ -200,6 +247,16 @@ type Prefs struct {
 	// AutoUpdatePrefs docs for more details.
 	AutoUpdate AutoUpdatePrefs
 
+	// TaildropAutoAccept configures accepting received Taildrop files
+	// into a directory automatically. See TaildropAutoAcceptPrefs.
+	TaildropAutoAccept TaildropAutoAcceptPrefs
+
+	// PostureChecking is whether the user consents to the node collecting
+	// device posture attributes, such as whether its disk is encrypted,
+	// and sending them to the control server in Hostinfo for use in
+	// access rules. The PostureChecking system policy takes precedence.
+	PostureChecking bool `json:",omitempty"`
+
 	// The Persist field is named 'Config' in the file for backward
 	// compatibility with earlier versions.
 	// TODO(apenwarr): We should move this out of here, it's not a pref.
@@ -220,6 +277,42 @@ type AutoUpdatePrefs struct {
 	Apply bool
 }
 
+// TaildropAutoAcceptPrefs are the settings for automatically moving
+// received Taildrop files out of tailscaled's inbox into a directory, for
+// headless machines with no one to run 'tailscale file get'. The
+// TaildropAutoAccept system policies take precedence.
+type TaildropAutoAcceptPrefs struct {
+	// Dir is the absolute path of the directory to move received files
+	// to. If empty, files stay in the inbox until they're picked up.
+	Dir string `json:",omitempty"`
+
+	// Conflict is what to do with a received file when Dir already has
+	// one of the same name: "skip" leaves it in the inbox, "overwrite"
+	// replaces the existing file, and "rename" gives it a number-suffixed
+	// name. Empty means "skip".
+	Conflict string `json:",omitempty"`
+
+	// MaxBytes, if non-zero, is the most that the files in Dir may add
+	// up to. Received files that would take Dir over it stay in the inbox.
+	MaxBytes int64 `json:",omitempty"`
+}
+
+// RateLimit is a bandwidth limit on traffic to and from a range of
+// addresses. See Prefs.RateLimits.
+type RateLimit struct {
+	// Prefix is the range of addresses the limit applies to, such as a
+	// peer's Tailscale IP or an advertised subnet route. Traffic matches if
+	// its source or destination is in Prefix.
+	Prefix netip.Prefix
+
+	// BytesPerSecond is the limit, applied separately to each direction.
+	BytesPerSecond int64
+
+	// PerAddr is whether each address in Prefix gets its own limit, rather
+	// than all of them sharing one.
+	PerAddr bool `json:",omitempty"`
+}
+
 // MaskedPrefs is a Prefs with an associated bitmask of which fields are set.
 type MaskedPrefs struct {
 	Prefs
@@ -230,7 +323,9 @@ type MaskedPrefs struct {
 	ExitNodeIDSet             bool `json:",omitempty"`
 	ExitNodeIPSet             bool `json:",omitempty"`
 	ExitNodeAllowLANAccessSet bool `json:",omitempty"`
+	ExitNodeFailoverSet       bool `json:",omitempty"`
 	CorpDNSSet                bool `json:",omitempty"`
+	DNSRoutesSet              bool `json:",omitempty"`
 	RunSSHSet                 bool `json:",omitempty"`
 	WantRunningSet            bool `json:",omitempty"`
 	LoggedOutSet              bool `json:",omitempty"`
@@ -242,10 +337,16 @@ type MaskedPrefs struct {
 	EggSet                    bool `json:",omitempty"`
 	AdvertiseRoutesSet        bool `json:",omitempty"`
 	NoSNATSet                 bool `json:",omitempty"`
+	RateLimitsSet             bool `json:",omitempty"`
+	DNSModeSet                bool `json:",omitempty"`
+	DERPHomeRegionSet         bool `json:",omitempty"`
+	DERPExcludeRegionsSet     bool `json:",omitempty"`
 	NetfilterModeSet          bool `json:",omitempty"`
 	OperatorUserSet           bool `json:",omitempty"`
 	ProfileNameSet            bool `json:",omitempty"`
 	AutoUpdateSet             bool `json:",omitempty"`
+	TaildropAutoAcceptSet     bool `json:",omitempty"`
+	PostureCheckingSet        bool `json:",omitempty"`
 }
 
 // ApplyEdits mutates p, assigning fields from m.Prefs for each MaskedPrefs
@@ -342,6 +443,9 @@ func (p *Prefs) pretty(goos string) string {
 		sb.WriteString("mesh=false ")
 	}
 	fmt.Fprintf(&sb, "dns=%v want=%v ", p.CorpDNS, p.WantRunning)
+	if len(p.DNSRoutes) > 0 {
+		fmt.Fprintf(&sb, "dnsroutes=%v ", p.DNSRoutes)
+	}
 	if p.RunSSH {
 		sb.WriteString("ssh=true ")
 	}
@@ -362,12 +466,27 @@ func (p *Prefs) pretty(goos string) string {
 	} else if !p.ExitNodeID.IsZero() {
 		fmt.Fprintf(&sb, "exit=%v lan=%t ", p.ExitNodeID, p.ExitNodeAllowLANAccess)
 	}
+	if len(p.ExitNodeFailover) > 0 {
+		fmt.Fprintf(&sb, "exitfailover=%v ", p.ExitNodeFailover)
+	}
 	if len(p.AdvertiseRoutes) > 0 || goos == "linux" {
 		fmt.Fprintf(&sb, "routes=%v ", p.AdvertiseRoutes)
 	}
 	if len(p.AdvertiseRoutes) > 0 || p.NoSNAT {
 		fmt.Fprintf(&sb, "snat=%v ", !p.NoSNAT)
 	}
+	if len(p.RateLimits) > 0 {
+		fmt.Fprintf(&sb, "ratelimits=%v ", p.RateLimits)
+	}
+	if p.DNSMode != "" {
+		fmt.Fprintf(&sb, "dnsmode=%s ", p.DNSMode)
+	}
+	if p.DERPHomeRegion != 0 {
+		fmt.Fprintf(&sb, "derphome=%d ", p.DERPHomeRegion)
+	}
+	if len(p.DERPExcludeRegions) > 0 {
+		fmt.Fprintf(&sb, "derpexclude=%v ", p.DERPExcludeRegions)
+	}
 	if len(p.AdvertiseTags) > 0 {
 		fmt.Fprintf(&sb, "tags=%s ", strings.Join(p.AdvertiseTags, ","))
 	}
@@ -384,6 +503,12 @@ func (p *Prefs) pretty(goos string) string {
 		fmt.Fprintf(&sb, "op=%q ", p.OperatorUser)
 	}
 	sb.WriteString(p.AutoUpdate.Pretty())
+	if p.TaildropAutoAccept.Dir != "" {
+		fmt.Fprintf(&sb, "taildrop=%q ", p.TaildropAutoAccept.Dir)
+	}
+	if p.PostureChecking {
+		sb.WriteString("posture=true ")
+	}
 	if p.Persist != nil {
 		sb.WriteString(p.Persist.Pretty())
 	} else {
@@ -424,13 +549,19 @@ func (p *Prefs) Equals(p2 *Prefs) bool {
 		p.ExitNodeID == p2.ExitNodeID &&
 		p.ExitNodeIP == p2.ExitNodeIP &&
 		p.ExitNodeAllowLANAccess == p2.ExitNodeAllowLANAccess &&
+		slices.Equal(p.ExitNodeFailover, p2.ExitNodeFailover) &&
 		p.CorpDNS == p2.CorpDNS &&
+		maps.EqualFunc(p.DNSRoutes, p2.DNSRoutes, slices.Equal[[]string]) &&
 		p.RunSSH == p2.RunSSH &&
 		p.WantRunning == p2.WantRunning &&
 		p.LoggedOut == p2.LoggedOut &&
 		p.NotepadURLs == p2.NotepadURLs &&
 		p.ShieldsUp == p2.ShieldsUp &&
 		p.NoSNAT == p2.NoSNAT &&
+		slices.Equal(p.RateLimits, p2.RateLimits) &&
+		p.DNSMode == p2.DNSMode &&
+		p.DERPHomeRegion == p2.DERPHomeRegion &&
+		slices.Equal(p.DERPExcludeRegions, p2.DERPExcludeRegions) &&
 		p.NetfilterMode == p2.NetfilterMode &&
 		p.OperatorUser == p2.OperatorUser &&
 		p.Hostname == p2.Hostname &&
@@ -439,7 +570,9 @@ func (p *Prefs) Equals(p2 *Prefs) bool {
 		compareStrings(p.AdvertiseTags, p2.AdvertiseTags) &&
 		p.Persist.Equals(p2.Persist) &&
 		p.ProfileName == p2.ProfileName &&
-		p.AutoUpdate == p2.AutoUpdate
+		p.AutoUpdate == p2.AutoUpdate &&
+		p.TaildropAutoAccept == p2.TaildropAutoAccept &&
+		p.PostureChecking == p2.PostureChecking
 }
 
 func (au AutoUpdatePrefs) Pretty() string {
@@ -786,4 +919,9 @@ type LoginProfile struct {
 	// ControlURL is the URL of the control server that this profile is logged
 	// into.
 	ControlURL string
+
+	// LastUsed is when the profile last became the current profile, by
+	// logging in to it or switching to it. It's zero for profiles last
+	// used by older versions of Tailscale.
+	LastUsed time.Time `json:",omitempty"`
 }
@@ -41,7 +41,9 @@ func TestPrefsEqual(t *testing.T) {
 		"ExitNodeID",
 		"ExitNodeIP",
 		"ExitNodeAllowLANAccess",
+		"ExitNodeFailover",
 		"CorpDNS",
+		"DNSRoutes",
 		"RunSSH",
 		"WantRunning",
 		"LoggedOut",
@@ -53,10 +55,16 @@ func TestPrefsEqual(t *testing.T) {
 		"Egg",
 		"AdvertiseRoutes",
 		"NoSNAT",
+		"RateLimits",
+		"DNSMode",
+		"DERPHomeRegion",
+		"DERPExcludeRegions",
 		"NetfilterMode",
 		"OperatorUser",
 		"ProfileName",
 		"AutoUpdate",
+		"TaildropAutoAccept",
+		"PostureChecking",
 		"Persist",
 	}
 	if have := fieldsOf(reflect.TypeOf(Prefs{})); !reflect.DeepEqual(have, prefsHandles) {
@@ -159,6 +167,16 @@ func TestPrefsEqual(t *testing.T) {
 			&Prefs{ExitNodeAllowLANAccess: true},
 			true,
 		},
+		{
+			&Prefs{ExitNodeFailover: []tailcfg.StableNodeID{"n1", "n2"}},
+			&Prefs{ExitNodeFailover: []tailcfg.StableNodeID{"n2", "n1"}},
+			false,
+		},
+		{
+			&Prefs{ExitNodeFailover: []tailcfg.StableNodeID{"n1", "n2"}},
+			&Prefs{ExitNodeFailover: []tailcfg.StableNodeID{"n1", "n2"}},
+			true,
+		},
 
 		{
 			&Prefs{CorpDNS: true},
@@ -170,6 +188,16 @@ func TestPrefsEqual(t *testing.T) {
 			&Prefs{CorpDNS: true},
 			true,
 		},
+		{
+			&Prefs{DNSRoutes: map[string][]string{"corp.example": {"10.0.0.53"}}},
+			&Prefs{DNSRoutes: map[string][]string{"corp.example": {"10.0.0.54"}}},
+			false,
+		},
+		{
+			&Prefs{DNSRoutes: map[string][]string{"corp.example": {"10.0.0.53"}}},
+			&Prefs{DNSRoutes: map[string][]string{"corp.example": {"10.0.0.53"}}},
+			true,
+		},
 
 		{
 			&Prefs{WantRunning: true},
@@ -193,6 +221,60 @@ func TestPrefsEqual(t *testing.T) {
 			true,
 		},
 
+		{
+			&Prefs{RateLimits: []RateLimit{{Prefix: netip.MustParsePrefix("100.64.0.0/10"), BytesPerSecond: 1e6, PerAddr: true}}},
+			&Prefs{RateLimits: []RateLimit{{Prefix: netip.MustParsePrefix("100.64.0.0/10"), BytesPerSecond: 1e6}}},
+			false,
+		},
+		{
+			&Prefs{RateLimits: []RateLimit{{Prefix: netip.MustParsePrefix("100.64.0.0/10"), BytesPerSecond: 1e6}}},
+			&Prefs{RateLimits: []RateLimit{{Prefix: netip.MustParsePrefix("100.64.0.0/10"), BytesPerSecond: 1e6}}},
+			true,
+		},
+
+		{
+			&Prefs{DNSMode: "direct"},
+			&Prefs{DNSMode: "systemd-resolved"},
+			false,
+		},
+		{
+			&Prefs{DNSMode: "direct"},
+			&Prefs{DNSMode: "direct"},
+			true,
+		},
+
+		{
+			&Prefs{DERPHomeRegion: 1},
+			&Prefs{DERPHomeRegion: 2},
+			false,
+		},
+		{
+			&Prefs{DERPExcludeRegions: []int{1, 2}},
+			&Prefs{DERPExcludeRegions: []int{1}},
+			false,
+		},
+		{
+			&Prefs{DERPHomeRegion: 1, DERPExcludeRegions: []int{2}},
+			&Prefs{DERPHomeRegion: 1, DERPExcludeRegions: []int{2}},
+			true,
+		},
+
+		{
+			&Prefs{TaildropAutoAccept: TaildropAutoAcceptPrefs{Dir: "/srv/in"}},
+			&Prefs{TaildropAutoAccept: TaildropAutoAcceptPrefs{Dir: "/srv/in", Conflict: "rename"}},
+			false,
+		},
+		{
+			&Prefs{TaildropAutoAccept: TaildropAutoAcceptPrefs{Dir: "/srv/in", MaxBytes: 1 << 30}},
+			&Prefs{TaildropAutoAccept: TaildropAutoAcceptPrefs{Dir: "/srv/in", MaxBytes: 1 << 30}},
+			true,
+		},
+		{
+			&Prefs{PostureChecking: true},
+			&Prefs{PostureChecking: false},
+			false,
+		},
+
 		{
 			&Prefs{Hostname: "android-host01"},
 			&Prefs{Hostname: "android-host02"},
@@ -0,0 +1,81 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipn
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"tailscale.com/tailcfg"
+)
+
+// PrefsPresetsKey returns a StateKey that stores the JSON-encoded
+// []PrefsPreset of a config profile.
+func PrefsPresetsKey(profileID ProfileID) StateKey {
+	return StateKey("_presets/" + profileID)
+}
+
+// PrefsPreset is a named set of values of the preferences that control how
+// a node routes its traffic, such as "work" and "home", saved so that users
+// can switch between them without repeating all the flags.
+type PrefsPreset struct {
+	Name string
+
+	ExitNodeID             tailcfg.StableNodeID `json:",omitempty"`
+	ExitNodeIP             netip.Addr           `json:",omitempty"`
+	ExitNodeAllowLANAccess bool
+	RouteAll               bool
+	CorpDNS                bool
+	ShieldsUp              bool
+}
+
+// NewPrefsPreset returns a preset named name with the current values in p.
+func NewPrefsPreset(name string, p PrefsView) PrefsPreset {
+	return PrefsPreset{
+		Name:                   name,
+		ExitNodeID:             p.ExitNodeID(),
+		ExitNodeIP:             p.ExitNodeIP(),
+		ExitNodeAllowLANAccess: p.ExitNodeAllowLANAccess(),
+		RouteAll:               p.RouteAll(),
+		CorpDNS:                p.CorpDNS(),
+		ShieldsUp:              p.ShieldsUp(),
+	}
+}
+
+// MaskedPrefs returns the edits that apply p.
+func (p *PrefsPreset) MaskedPrefs() *MaskedPrefs {
+	return &MaskedPrefs{
+		Prefs: Prefs{
+			ExitNodeID:             p.ExitNodeID,
+			ExitNodeIP:             p.ExitNodeIP,
+			ExitNodeAllowLANAccess: p.ExitNodeAllowLANAccess,
+			RouteAll:               p.RouteAll,
+			CorpDNS:                p.CorpDNS,
+			ShieldsUp:              p.ShieldsUp,
+		},
+		ExitNodeIDSet:             true,
+		ExitNodeIPSet:             true,
+		ExitNodeAllowLANAccessSet: true,
+		RouteAllSet:               true,
+		CorpDNSSet:                true,
+		ShieldsUpSet:              true,
+	}
+}
+
+// CheckPrefsPresetName reports whether name is a valid name for a
+// PrefsPreset.
+func CheckPrefsPresetName(name string) error {
+	if name == "" {
+		return errors.New("empty preset name")
+	}
+	if len(name) > 64 {
+		return fmt.Errorf("preset name %q is longer than 64 bytes", name)
+	}
+	if strings.ContainsAny(name, "/ \t\r\n") {
+		return fmt.Errorf("preset name %q contains a slash or whitespace", name)
+	}
+	return nil
+}
@@ -12,6 +12,7 @@
 	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"tailscale.com/tailcfg"
 )
@@ -22,8 +23,52 @@ func ServeConfigKey(profileID ProfileID) StateKey {
 	return StateKey("_serve/" + profileID)
 }
 
+// ServeConfigHistoryKey returns a StateKey that stores the
+// JSON-encoded []ServeConfigRevision for a config profile.
+func ServeConfigHistoryKey(profileID ProfileID) StateKey {
+	return StateKey("_serve-history/" + profileID)
+}
+
+// ServeConfigRevision is a previous ServeConfig of a profile, as stored
+// (newest first) in the StateStore for the StateKey returned by
+// ServeConfigHistoryKey.
+type ServeConfigRevision struct {
+	// Config is the background serve config that was in effect. It never
+	// contains Foreground sessions, as those don't outlive their session.
+	Config *ServeConfig
+
+	// Replaced is when Config was replaced by a newer config.
+	Replaced time.Time
+}
+
+// ServeCertStatus is the state of the TLS certificate of a host that serve
+// or funnel handles HTTPS or TLS for, which tailscaled fetches and renews in
+// the background.
+type ServeCertStatus struct {
+	Domain string
+
+	// NotAfter is when the current certificate expires. It's zero if
+	// there's no certificate yet.
+	NotAfter time.Time `json:",omitempty"`
+
+	// RenewAt is when the certificate is due to be renewed, if known.
+	RenewAt time.Time `json:",omitempty"`
+
+	// LastAttempt is when the certificate was last fetched or checked
+	// for renewal.
+	LastAttempt time.Time `json:",omitempty"`
+
+	// LastError is the error of the last attempt, if it failed.
+	LastError string `json:",omitempty"`
+}
+
 // ServeConfig is the JSON type stored in the StateStore for
 // StateKey "_serve/$PROFILE_ID" as returned by ServeConfigKey.
+//
+// It's also what the LocalAPI's serve-config endpoint sends and accepts.
+// Its JSON form only grows by new, omitempty fields, so configs written by
+// older clients keep their meaning and newer fields are dropped by older
+// tailscaleds rather than rejected.
 type ServeConfig struct {
 	// TCP are the list of TCP port numbers that tailscaled should handle for
 	// the Tailscale IP addresses. (not subnet routers, etc)
@@ -37,6 +82,12 @@ type ServeConfig struct {
 	// traffic is allowed, from trusted ingress peers.
 	AllowFunnel map[HostPort]bool `json:",omitempty"`
 
+	// FunnelExpiry is when funnel traffic stops being allowed for the
+	// AllowFunnel entries with the same key. After it, LocalBackend removes
+	// the entries from AllowFunnel, leaving the handlers served to the
+	// tailnet. AllowFunnel entries without an expiry don't expire.
+	FunnelExpiry map[HostPort]time.Time `json:",omitempty"`
+
 	// Foreground is a map of an IPN Bus session ID to an alternate foreground
 	// serve config that's valid for the life of that WatchIPNBus session ID.
 	// This. This allows the config to specify ephemeral configs that are
@@ -134,10 +185,51 @@ type HTTPHandler struct {
 
 	Text string `json:",omitempty"` // plaintext to serve (primarily for testing)
 
+	Redirect string `json:",omitempty"` // absolute URL to redirect requests to
+
+	// StatusCode is the HTTP status code to use for Redirect and Text
+	// handlers. For Redirect, it must be one of 301, 302, 303, 307 or 308
+	// and zero means 302. For Text, zero means 200.
+	StatusCode int `json:",omitempty"`
+
+	// ContentType is the Content-Type of Text responses. If empty,
+	// "text/plain; charset=utf-8" is used.
+	ContentType string `json:",omitempty"`
+
+	// BackendProtocol optionally specifies the protocol to use when
+	// talking to the Proxy backend. It must be empty, BackendProtocolHTTP1,
+	// or BackendProtocolH2C. The empty string means the same as
+	// BackendProtocolHTTP1. It is only used if Proxy is set.
+	BackendProtocol string `json:",omitempty"`
+
+	// TailnetOnly, if true, restricts the handler to requests from the
+	// tailnet, even if its HostPort is in ServeConfig.AllowFunnel.
+	// Requests that arrive over Funnel get a 404 instead. This lets a
+	// port funnel some mounts while keeping others private.
+	TailnetOnly bool `json:",omitempty"`
+
+	// BasicAuth, if non-empty, is "user:hash", where hash is a bcrypt hash
+	// of the password. Requests must then carry matching HTTP basic auth
+	// credentials, which are checked before the handler runs. It's meant
+	// for quickly protecting funneled backends that have no auth of their
+	// own.
+	BasicAuth string `json:",omitempty"`
+
 	// TODO(bradfitz): bool to not enumerate directories? TTL on mapping for
-	// temporary ones? Error codes? Redirects?
+	// temporary ones? Error codes?
 }
 
+// Valid values for HTTPHandler.BackendProtocol.
+const (
+	// BackendProtocolHTTP1 speaks HTTP/1.1 to the backend, or HTTP/2 if
+	// the backend is HTTPS and negotiates it via ALPN.
+	BackendProtocolHTTP1 = "http1"
+
+	// BackendProtocolH2C speaks cleartext HTTP/2 (h2c) to the backend,
+	// with prior knowledge. This is what most gRPC servers expect.
+	BackendProtocolH2C = "h2c"
+)
+
 // WebHandlerExists reports whether if the ServeConfig Web handler exists for
 // the given host:port and mount point.
 func (sc *ServeConfig) WebHandlerExists(hp HostPort, mount string) bool {
@@ -230,6 +322,57 @@ func (sc *ServeConfig) IsFunnelOn() bool {
 	return false
 }
 
+// NextFunnelExpiry returns the earliest FunnelExpiry of the background or
+// foreground configs, or the zero time if funnel access doesn't expire.
+func (v ServeConfigView) NextFunnelExpiry() time.Time {
+	var next time.Time
+	note := func(_ HostPort, t time.Time) bool {
+		if next.IsZero() || t.Before(next) {
+			next = t
+		}
+		return true
+	}
+	v.FunnelExpiry().Range(note)
+	v.Foreground().Range(func(_ string, v ServeConfigView) bool {
+		v.FunnelExpiry().Range(note)
+		return true
+	})
+	return next
+}
+
+// ExpireFunnels removes the AllowFunnel entries whose FunnelExpiry is at or
+// before now, in both the background and foreground configs, and returns
+// their keys.
+func (sc *ServeConfig) ExpireFunnels(now time.Time) (expired []HostPort) {
+	if sc == nil {
+		return nil
+	}
+	for hp, t := range sc.FunnelExpiry {
+		if now.Before(t) {
+			continue
+		}
+		delete(sc.FunnelExpiry, hp)
+		if sc.AllowFunnel[hp] {
+			expired = append(expired, hp)
+		}
+		delete(sc.AllowFunnel, hp)
+	}
+	if len(sc.FunnelExpiry) == 0 {
+		sc.FunnelExpiry = nil
+	}
+	if len(sc.AllowFunnel) == 0 {
+		sc.AllowFunnel = nil
+	}
+	for _, fg := range sc.Foreground {
+		expired = append(expired, fg.ExpireFunnels(now)...)
+	}
+	return expired
+}
+
+// ErrFunnelNotEnabled is wrapped by the errors of CheckFunnelAccess and
+// CheckFunnelPort when Funnel isn't available to a node or port.
+var ErrFunnelNotEnabled = errors.New("Funnel not available")
+
 // CheckFunnelAccess checks whether Funnel access is allowed for the given node
 // and port.
 // It checks:
@@ -242,10 +385,10 @@ func (sc *ServeConfig) IsFunnelOn() bool {
 // Funnel.
 func CheckFunnelAccess(port uint16, nodeAttrs []tailcfg.NodeCapability) error {
 	if !slices.Contains(nodeAttrs, tailcfg.CapabilityHTTPS) {
-		return errors.New("Funnel not available; HTTPS must be enabled. See https://tailscale.com/s/https.")
+		return fmt.Errorf("%w; HTTPS must be enabled. See https://tailscale.com/s/https.", ErrFunnelNotEnabled)
 	}
 	if !slices.Contains(nodeAttrs, tailcfg.NodeAttrFunnel) {
-		return errors.New("Funnel not available; \"funnel\" node attribute not set. See https://tailscale.com/s/no-funnel.")
+		return fmt.Errorf("%w; \"funnel\" node attribute not set. See https://tailscale.com/s/no-funnel.", ErrFunnelNotEnabled)
 	}
 	return CheckFunnelPort(port, nodeAttrs)
 }
@@ -256,9 +399,9 @@ func CheckFunnelAccess(port uint16, nodeAttrs []tailcfg.NodeCapability) error {
 func CheckFunnelPort(wantedPort uint16, nodeAttrs []tailcfg.NodeCapability) error {
 	deny := func(allowedPorts string) error {
 		if allowedPorts == "" {
-			return fmt.Errorf("port %d is not allowed for funnel", wantedPort)
+			return fmt.Errorf("%w on port %d", ErrFunnelNotEnabled, wantedPort)
 		}
-		return fmt.Errorf("port %d is not allowed for funnel; allowed ports are: %v", wantedPort, allowedPorts)
+		return fmt.Errorf("%w on port %d; allowed ports are: %v", ErrFunnelNotEnabled, wantedPort, allowedPorts)
 	}
 	var portsStr string
 	for _, attr := range nodeAttrs {
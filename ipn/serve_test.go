@@ -3,7 +3,11 @@
 package ipn
 
 import (
+	"errors"
+	"reflect"
+	"slices"
 	"testing"
+	"time"
 
 	"tailscale.com/tailcfg"
 )
@@ -28,8 +32,11 @@ func TestCheckFunnelAccess(t *testing.T) {
 	for _, tt := range tests {
 		err := CheckFunnelAccess(tt.port, tt.caps)
 		switch {
-		case err != nil && tt.wantErr,
-			err == nil && !tt.wantErr:
+		case err != nil && tt.wantErr:
+			if !errors.Is(err, ErrFunnelNotEnabled) {
+				t.Fatalf("got error %v, want ErrFunnelNotEnabled", err)
+			}
+		case err == nil && !tt.wantErr:
 			continue
 		case tt.wantErr:
 			t.Fatalf("got no error, want error")
@@ -38,3 +45,53 @@ func TestCheckFunnelAccess(t *testing.T) {
 		}
 	}
 }
+
+func TestExpireFunnels(t *testing.T) {
+	now := time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+	const (
+		hp443  HostPort = "foo.test.ts.net:443"
+		hp8443 HostPort = "foo.test.ts.net:8443"
+	)
+	sc := &ServeConfig{
+		AllowFunnel: map[HostPort]bool{hp443: true, hp8443: true},
+		FunnelExpiry: map[HostPort]time.Time{
+			hp443:  now.Add(-time.Minute),
+			hp8443: now.Add(time.Hour),
+		},
+		Foreground: map[string]*ServeConfig{
+			"sess": {
+				AllowFunnel:  map[HostPort]bool{hp443: true},
+				FunnelExpiry: map[HostPort]time.Time{hp443: now.Add(30 * time.Minute)},
+			},
+		},
+	}
+
+	if got, want := sc.View().NextFunnelExpiry(), now.Add(-time.Minute); !got.Equal(want) {
+		t.Errorf("NextFunnelExpiry = %v, want %v", got, want)
+	}
+
+	if got, want := sc.ExpireFunnels(now), []HostPort{hp443}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ExpireFunnels = %v, want %v", got, want)
+	}
+	if want := map[HostPort]bool{hp8443: true}; !reflect.DeepEqual(sc.AllowFunnel, want) {
+		t.Errorf("AllowFunnel = %v, want %v", sc.AllowFunnel, want)
+	}
+	if _, ok := sc.FunnelExpiry[hp443]; ok {
+		t.Errorf("FunnelExpiry of %v not removed", hp443)
+	}
+	if got, want := sc.View().NextFunnelExpiry(), now.Add(30*time.Minute); !got.Equal(want) {
+		t.Errorf("NextFunnelExpiry after expiry = %v, want %v", got, want)
+	}
+
+	got := sc.ExpireFunnels(now.Add(2 * time.Hour))
+	slices.Sort(got)
+	if want := []HostPort{hp443, hp8443}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ExpireFunnels = %v, want %v", got, want)
+	}
+	if sc.IsFunnelOn() || sc.Foreground["sess"].IsFunnelOn() {
+		t.Errorf("funnel still on after expiry: %+v", sc)
+	}
+	if !sc.View().NextFunnelExpiry().IsZero() {
+		t.Errorf("NextFunnelExpiry = %v, want zero", sc.View().NextFunnelExpiry())
+	}
+}
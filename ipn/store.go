@@ -53,8 +53,36 @@
 	// CurrentProfileStateKey is the key under which we store the current
 	// profile.
 	CurrentProfileStateKey = StateKey("_current-profile")
+
+	// UpdateStateKey is the key under which we store the versions of
+	// Tailscale that ran, for rolling back client updates. The value is
+	// a JSON-encoded UpdateState.
+	UpdateStateKey = StateKey("_update")
+
+	// ListenPortStateKey is the key under which tailscaled stores the UDP
+	// port it chose when run with --port=0, so that it can bind the same
+	// port again after a restart. The value is the port in decimal.
+	ListenPortStateKey = StateKey("_listen-port")
 )
 
+// UpdateState records the versions of tailscaled that ran on a node, so
+// that a client update can be rolled back.
+type UpdateState struct {
+	// Version is the version of tailscaled that started last.
+	Version string
+	// PreviousVersion is the version that ran before Version, which a
+	// rollback reinstalls, or empty if none is known.
+	PreviousVersion string `json:",omitempty"`
+	// AutoUpdateFrom, if non-empty, is the version that started an
+	// auto-update that isn't confirmed yet. An auto-update is confirmed
+	// when the updated tailscaled reaches the Running state, and rolled
+	// back to AutoUpdateFrom if it doesn't in time.
+	AutoUpdateFrom string `json:",omitempty"`
+	// RolledBackFrom, if non-empty, is the version that tailscaled last
+	// rolled back from automatically.
+	RolledBackFrom string `json:",omitempty"`
+}
+
 // CurrentProfileID returns the StateKey that stores the
 // current profile ID. The value is a JSON-encoded LoginProfile.
 // If the userID is empty, the key returned is CurrentProfileStateKey,
@@ -0,0 +1,303 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package store
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+	"tailscale.com/ipn"
+	"tailscale.com/util/mak"
+)
+
+// encryptedPrefix starts the values that an EncryptedStore writes, to tell
+// them apart from the plaintext ones written before encryption was turned
+// on.
+var encryptedPrefix = []byte("tsenc1:")
+
+// DataKeyStateKey is the key under which an EncryptedStore keeps its data
+// key, as sealed by its KeySealer.
+const DataKeyStateKey = ipn.StateKey("_encryption-key")
+
+// KeySealer protects the data key of an EncryptedStore at rest, such as
+// with a key held by the OS.
+type KeySealer interface {
+	// Seal returns key in a form that only Unseal can recover it from.
+	Seal(key []byte) ([]byte, error)
+	// Unseal returns the key that Seal returned sealed for.
+	Unseal(sealed []byte) ([]byte, error)
+}
+
+// sealers are the KeySealer constructors of NewKeySealer, by the prefix of
+// its argument. Platforms register their own in init.
+var sealers map[string]func(arg string) (KeySealer, error)
+
+func init() {
+	mak.Set(&sealers, "passphrase-file", newPassphraseSealer)
+	mak.Set(&sealers, "exec", newExecSealer)
+}
+
+// NewKeySealer returns the KeySealer that spec names, as "name" or
+// "name:arg". These are available:
+//
+//   - "dpapi" (Windows) seals with the Data Protection API, for the local
+//     machine.
+//   - "keychain" (macOS) keeps the key in the System keychain.
+//   - "passphrase-file:<path>" seals with a key derived from the
+//     passphrase in the file at path, such as a systemd credential.
+//   - "exec:<path>" runs the program at path with the argument "seal" or
+//     "unseal" to seal or unseal its stdin to its stdout, such as with a
+//     cloud KMS.
+func NewKeySealer(spec string) (KeySealer, error) {
+	name, arg, _ := strings.Cut(spec, ":")
+	f, ok := sealers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown or unsupported state encryption %q", name)
+	}
+	return f(arg)
+}
+
+// EncryptedStore is a StateStore that encrypts the values of another
+// StateStore with a data key, itself sealed by a KeySealer.
+//
+// Values written before encryption was turned on are read as is. They're
+// encrypted when the store is opened, for a FileStore, or else when they're
+// next written.
+type EncryptedStore struct {
+	store ipn.StateStore
+	aead  cipher.AEAD
+}
+
+// NewEncryptedStore returns an EncryptedStore over s. It unseals the data
+// key of s with sealer, or creates and seals one if s has none.
+func NewEncryptedStore(s ipn.StateStore, sealer KeySealer) (*EncryptedStore, error) {
+	var key []byte
+	sealed, err := s.ReadState(DataKeyStateKey)
+	switch {
+	case errors.Is(err, ipn.ErrStateNotExist) || (err == nil && len(sealed) == 0):
+		key = make([]byte, chacha20poly1305.KeySize)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		sealed, err := sealer.Seal(key)
+		if err != nil {
+			return nil, fmt.Errorf("sealing state encryption key: %w", err)
+		}
+		if err := s.WriteState(DataKeyStateKey, sealed); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	default:
+		key, err = sealer.Unseal(sealed)
+		if err != nil {
+			return nil, fmt.Errorf("unsealing state encryption key: %w", err)
+		}
+	}
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid state encryption key: %w", err)
+	}
+	es := &EncryptedStore{store: s, aead: aead}
+	if fs, ok := s.(*FileStore); ok {
+		if err := es.encryptAll(fs.stateKeys()); err != nil {
+			return nil, err
+		}
+	}
+	return es, nil
+}
+
+// encryptAll encrypts the values of ids that were written before
+// encryption was turned on.
+func (s *EncryptedStore) encryptAll(ids []ipn.StateKey) error {
+	for _, id := range ids {
+		if id == DataKeyStateKey {
+			continue
+		}
+		bs, err := s.store.ReadState(id)
+		if err != nil || len(bs) == 0 || bytes.HasPrefix(bs, encryptedPrefix) {
+			continue
+		}
+		if err := s.write(id, bs); err != nil {
+			return fmt.Errorf("encrypting %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+func (s *EncryptedStore) String() string { return fmt.Sprintf("EncryptedStore(%v)", s.store) }
+
+// ReadState implements the StateStore interface.
+func (s *EncryptedStore) ReadState(id ipn.StateKey) ([]byte, error) {
+	bs, err := s.store.ReadState(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.open(id, bs)
+}
+
+// WriteState implements the StateStore interface.
+func (s *EncryptedStore) WriteState(id ipn.StateKey, bs []byte) error {
+	if id == DataKeyStateKey {
+		return fmt.Errorf("%s is reserved", id)
+	}
+	if len(bs) == 0 {
+		return s.store.WriteState(id, bs)
+	}
+	// Don't rewrite unchanged values, which encrypt differently each
+	// time, as stores skip writing those.
+	if old, err := s.ReadState(id); err == nil && bytes.Equal(old, bs) {
+		return nil
+	}
+	return s.write(id, bs)
+}
+
+// write encrypts bs and writes it as the value of id.
+func (s *EncryptedStore) write(id ipn.StateKey, bs []byte) error {
+	n := len(encryptedPrefix) + s.aead.NonceSize()
+	out := make([]byte, n, n+len(bs)+s.aead.Overhead())
+	copy(out, encryptedPrefix)
+	nonce := out[len(encryptedPrefix):]
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	return s.store.WriteState(id, s.aead.Seal(out, nonce, bs, []byte(id)))
+}
+
+// SetDialer implements ipn.StateStoreDialerSetter, if the underlying store
+// does.
+func (s *EncryptedStore) SetDialer(d func(ctx context.Context, network, address string) (net.Conn, error)) {
+	if sds, ok := s.store.(ipn.StateStoreDialerSetter); ok {
+		sds.SetDialer(d)
+	}
+}
+
+// open returns the plaintext of bs, the value of id.
+func (s *EncryptedStore) open(id ipn.StateKey, bs []byte) ([]byte, error) {
+	rest, ok := bytes.CutPrefix(bs, encryptedPrefix)
+	if !ok {
+		// Written before encryption was turned on.
+		return bs, nil
+	}
+	if len(rest) < s.aead.NonceSize() {
+		return nil, fmt.Errorf("decrypting %s: value too short", id)
+	}
+	nonce, ct := rest[:s.aead.NonceSize()], rest[s.aead.NonceSize():]
+	pt, err := s.aead.Open(nil, nonce, ct, []byte(id))
+	if err != nil {
+		return nil, fmt.Errorf("decrypting %s: %w", id, err)
+	}
+	return pt, nil
+}
+
+// passphraseSealer is a KeySealer that seals with a key derived from a
+// passphrase with Argon2id.
+type passphraseSealer struct {
+	passphrase []byte
+}
+
+const passphraseSaltSize = 16
+
+func newPassphraseSealer(path string) (KeySealer, error) {
+	if path == "" {
+		return nil, errors.New("passphrase-file: missing path")
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b = bytes.TrimRight(b, "\r\n")
+	if len(b) == 0 {
+		return nil, fmt.Errorf("passphrase-file: %s is empty", path)
+	}
+	return &passphraseSealer{passphrase: b}, nil
+}
+
+func (p *passphraseSealer) aead(salt []byte) (cipher.AEAD, error) {
+	key := argon2.IDKey(p.passphrase, salt, 1, 64*1024, 4, chacha20poly1305.KeySize)
+	return chacha20poly1305.NewX(key)
+}
+
+// Seal implements KeySealer. The sealed key is the salt, the nonce and the
+// encrypted key.
+func (p *passphraseSealer) Seal(key []byte) ([]byte, error) {
+	out := make([]byte, passphraseSaltSize+chacha20poly1305.NonceSizeX)
+	if _, err := rand.Read(out); err != nil {
+		return nil, err
+	}
+	salt, nonce := out[:passphraseSaltSize], out[passphraseSaltSize:]
+	aead, err := p.aead(salt)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(out, nonce, key, nil), nil
+}
+
+// Unseal implements KeySealer.
+func (p *passphraseSealer) Unseal(sealed []byte) ([]byte, error) {
+	if len(sealed) < passphraseSaltSize+chacha20poly1305.NonceSizeX {
+		return nil, errors.New("sealed key too short")
+	}
+	salt := sealed[:passphraseSaltSize]
+	nonce := sealed[passphraseSaltSize : passphraseSaltSize+chacha20poly1305.NonceSizeX]
+	aead, err := p.aead(salt)
+	if err != nil {
+		return nil, err
+	}
+	key, err := aead.Open(nil, nonce, sealed[len(salt)+len(nonce):], nil)
+	if err != nil {
+		return nil, errors.New("wrong passphrase")
+	}
+	return key, nil
+}
+
+// execSealer is a KeySealer that runs a program to seal and unseal, such
+// as one that calls a KMS.
+type execSealer struct {
+	path string
+}
+
+// execSealerTimeout is how long an execSealer's program may run.
+const execSealerTimeout = 30 * time.Second
+
+func newExecSealer(path string) (KeySealer, error) {
+	if path == "" {
+		return nil, errors.New("exec: missing program path")
+	}
+	return &execSealer{path: path}, nil
+}
+
+func (e *execSealer) run(op string, in []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), execSealerTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, e.path, op)
+	cmd.Stdin = bytes.NewReader(in)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w; stderr: %q", e.path, op, err, stderr.Bytes())
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("%s %s: no output", e.path, op)
+	}
+	return out, nil
+}
+
+// Seal implements KeySealer.
+func (e *execSealer) Seal(key []byte) ([]byte, error) { return e.run("seal", key) }
+
+// Unseal implements KeySealer.
+func (e *execSealer) Unseal(sealed []byte) ([]byte, error) { return e.run("unseal", sealed) }
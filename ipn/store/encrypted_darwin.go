@@ -0,0 +1,68 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package store
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"tailscale.com/util/mak"
+)
+
+func init() {
+	mak.Set(&sealers, "keychain", func(arg string) (KeySealer, error) {
+		if arg != "" {
+			return nil, errors.New("keychain takes no argument")
+		}
+		return keychainSealer{}, nil
+	})
+}
+
+const (
+	// keychainService is the service of the keychain items that hold
+	// state encryption keys.
+	keychainService = "com.tailscale.tailscaled.state-key"
+	// systemKeychain is the keychain of the items, as tailscaled runs as
+	// root.
+	systemKeychain = "/Library/Keychains/System.keychain"
+)
+
+// keychainSealer is a KeySealer that keeps the key in the System keychain,
+// in an item of its own. The sealed key is the account name of the item.
+//
+// It uses the security command, which would have to be cgo otherwise.
+type keychainSealer struct{}
+
+// Seal implements KeySealer.
+func (keychainSealer) Seal(key []byte) ([]byte, error) {
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	}
+	account := hex.EncodeToString(id[:])
+	// Pass the key on stdin, in interactive mode, rather than as an
+	// argument that other processes can see.
+	cmd := exec.Command("security", "-i")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -a %s -s %s -w %s %s\n",
+		account, keychainService, hex.EncodeToString(key), systemKeychain))
+	out, err := cmd.CombinedOutput()
+	if err != nil || bytes.Contains(out, []byte("error")) {
+		return nil, fmt.Errorf("adding keychain item: %v; output: %q", err, out)
+	}
+	return []byte(account), nil
+}
+
+// Unseal implements KeySealer.
+func (keychainSealer) Unseal(sealed []byte) ([]byte, error) {
+	out, err := exec.Command("security", "find-generic-password", "-a", string(sealed), "-s", keychainService, "-w", systemKeychain).Output()
+	if err != nil {
+		return nil, fmt.Errorf("finding keychain item %s: %w", sealed, err)
+	}
+	return hex.DecodeString(strings.TrimSpace(string(out)))
+}
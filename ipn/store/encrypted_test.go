@@ -0,0 +1,168 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package store
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"tailscale.com/ipn"
+	"tailscale.com/ipn/store/mem"
+)
+
+func TestEncryptedStore(t *testing.T) {
+	passFile := filepath.Join(t.TempDir(), "passphrase")
+	if err := os.WriteFile(passFile, []byte("correct horse\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	sealer, err := NewKeySealer("passphrase-file:" + passFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	under := new(mem.Store)
+	// A value written before encryption was turned on.
+	if err := under.WriteState("old", []byte("plain")); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewEncryptedStore(under, sealer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.ReadState("old"); err != nil || string(got) != "plain" {
+		t.Errorf("ReadState(old) = %q, %v; want plaintext", got, err)
+	}
+	secret := []byte("privkey:0123456789")
+	if err := s.WriteState("profile-1234", secret); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := under.ReadState("profile-1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, secret) || !bytes.HasPrefix(raw, encryptedPrefix) {
+		t.Errorf("underlying store has %q; want it encrypted", raw)
+	}
+	// Rewriting the same value leaves it alone.
+	if err := s.WriteState("profile-1234", secret); err != nil {
+		t.Fatal(err)
+	}
+	if raw2, _ := under.ReadState("profile-1234"); !bytes.Equal(raw, raw2) {
+		t.Error("rewriting an unchanged value re-encrypted it")
+	}
+	if err := s.WriteState(DataKeyStateKey, nil); err == nil {
+		t.Error("writing the data key succeeded")
+	}
+
+	// Reopening unseals the same key.
+	s, err = NewEncryptedStore(under, sealer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.ReadState("profile-1234"); err != nil || !bytes.Equal(got, secret) {
+		t.Errorf("ReadState after reopening = %q, %v; want %q", got, err, secret)
+	}
+	if _, err := s.ReadState("missing"); !errors.Is(err, ipn.ErrStateNotExist) {
+		t.Errorf("ReadState(missing) error = %v; want ErrStateNotExist", err)
+	}
+
+	// Values are bound to their keys.
+	under.WriteState("profile-5678", raw)
+	if _, err := s.ReadState("profile-5678"); err == nil {
+		t.Error("read a value moved to another key")
+	}
+
+	// A wrong passphrase doesn't unseal the key.
+	if err := os.WriteFile(passFile, []byte("battery staple"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	wrong, err := NewKeySealer("passphrase-file:" + passFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewEncryptedStore(under, wrong); err == nil {
+		t.Error("opened the store with the wrong passphrase")
+	}
+}
+
+func TestEncryptedStoreEncryptsFileStore(t *testing.T) {
+	passFile := filepath.Join(t.TempDir(), "passphrase")
+	if err := os.WriteFile(passFile, []byte("correct horse"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	sealer, err := NewKeySealer("passphrase-file:" + passFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "tailscaled.state")
+	fs, err := NewFileStore(t.Logf, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := []byte("privkey:0123456789")
+	if err := fs.WriteState(ipn.MachineKeyStateKey, secret); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewEncryptedStore(fs, sealer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, secret) {
+		t.Error("state file still has the plaintext value")
+	}
+	if got, err := s.ReadState(ipn.MachineKeyStateKey); err != nil || !bytes.Equal(got, secret) {
+		t.Errorf("ReadState = %q, %v; want %q", got, err, secret)
+	}
+}
+
+func TestExecSealer(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test uses a shell script")
+	}
+	if _, err := exec.LookPath("base64"); err != nil {
+		t.Skip("no base64 command")
+	}
+	// A toy KMS that "seals" with base64.
+	prog := filepath.Join(t.TempDir(), "kms.sh")
+	script := "#!/bin/sh\ncase \"$1\" in\nseal) base64 ;;\nunseal) base64 -d ;;\n*) exit 1 ;;\nesac\n"
+	if err := os.WriteFile(prog, []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+	sealer, err := NewKeySealer("exec:" + prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := []byte{1, 2, 3, 0xfe}
+	sealed, err := sealer.Seal(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "AQID/g==\n"; string(sealed) != want {
+		t.Errorf("sealed = %q; want %q", sealed, want)
+	}
+	got, err := sealer.Unseal(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, key) {
+		t.Errorf("unsealed = %x; want %x", got, key)
+	}
+
+	for _, spec := range []string{"", "exec", "passphrase-file", "nope:x"} {
+		if _, err := NewKeySealer(spec); err == nil {
+			t.Errorf("NewKeySealer(%q) succeeded; want error", spec)
+		}
+	}
+}
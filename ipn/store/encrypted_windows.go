@@ -0,0 +1,63 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package store
+
+import (
+	"errors"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+	"tailscale.com/util/mak"
+)
+
+func init() {
+	mak.Set(&sealers, "dpapi", func(arg string) (KeySealer, error) {
+		if arg != "" {
+			return nil, errors.New("dpapi takes no argument")
+		}
+		return dpapiSealer{}, nil
+	})
+}
+
+// dpapiSealer is a KeySealer that seals with the Windows Data Protection
+// API, such that only the local machine can unseal.
+type dpapiSealer struct{}
+
+// dpapiEntropy is mixed into the sealing by DPAPI, so that other programs
+// using it on the machine don't unseal tailscaled's key by accident.
+var dpapiEntropy = []byte("Tailscale state encryption key")
+
+func dpapiBlob(b []byte) *windows.DataBlob {
+	if len(b) == 0 {
+		return &windows.DataBlob{}
+	}
+	return &windows.DataBlob{Size: uint32(len(b)), Data: &b[0]}
+}
+
+// dpapiOutput returns a copy of the data of out, which DPAPI allocated,
+// and frees it.
+func dpapiOutput(out *windows.DataBlob) []byte {
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(out.Data)))
+	return append([]byte(nil), unsafe.Slice(out.Data, out.Size)...)
+}
+
+// Seal implements KeySealer.
+func (dpapiSealer) Seal(key []byte) ([]byte, error) {
+	var out windows.DataBlob
+	const flags = windows.CRYPTPROTECT_UI_FORBIDDEN | windows.CRYPTPROTECT_LOCAL_MACHINE
+	if err := windows.CryptProtectData(dpapiBlob(key), nil, dpapiBlob(dpapiEntropy), 0, nil, flags, &out); err != nil {
+		return nil, err
+	}
+	return dpapiOutput(&out), nil
+}
+
+// Unseal implements KeySealer.
+func (dpapiSealer) Unseal(sealed []byte) ([]byte, error) {
+	var out windows.DataBlob
+	const flags = windows.CRYPTPROTECT_UI_FORBIDDEN
+	if err := windows.CryptUnprotectData(dpapiBlob(sealed), nil, dpapiBlob(dpapiEntropy), 0, nil, flags, &out); err != nil {
+		return nil, err
+	}
+	return dpapiOutput(&out), nil
+}
@@ -0,0 +1,266 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build linux && !ts_omit_gcp
+
+// Package gcpstore contains an ipn.StateStore implementation using Google
+// Cloud Secret Manager.
+package gcpstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"tailscale.com/ipn"
+	"tailscale.com/ipn/store/mem"
+	"tailscale.com/types/logger"
+)
+
+// Prefix is the prefix of the --state values that name a secret.
+const Prefix = "gcpsecret:"
+
+const (
+	secretManagerURL = "https://secretmanager.googleapis.com/v1/"
+	// metadataTokenURL returns an access token for the service account of
+	// the VM.
+	metadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+)
+
+// requestTimeout is how long a request to Secret Manager may take.
+const requestTimeout = 30 * time.Second
+
+var secretNameRx = regexp.MustCompile(`^projects/([^/]+)/secrets/([^/]+)$`)
+
+// gcpStore is a store which keeps the state in the latest version of a
+// Secret Manager secret.
+type gcpStore struct {
+	logf     logger.Logf
+	secret   string // projects/<project>/secrets/<secret>
+	apiURL   string
+	tokenURL string
+	hc       *http.Client
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+	version     string // name of the latest secret version, if any
+
+	memory mem.Store
+}
+
+// New returns a new ipn.StateStore using the Secret Manager secret given
+// by path, of the form "gcpsecret:projects/<project>/secrets/<secret>".
+// The secret is created if it doesn't exist. Requests are authenticated as
+// the service account of the VM, which needs the Secret Manager Secret
+// Version Manager role on the secret, or the Admin role to create it.
+//
+// Each write adds a version of the secret and destroys the previous one.
+func New(logf logger.Logf, path string) (ipn.StateStore, error) {
+	return newStore(logf, path, secretManagerURL, metadataTokenURL)
+}
+
+// newStore is New, but for tests.
+func newStore(logf logger.Logf, path, apiURL, tokenURL string) (ipn.StateStore, error) {
+	secret := strings.TrimPrefix(path, Prefix)
+	if !secretNameRx.MatchString(secret) {
+		return nil, fmt.Errorf("invalid secret %q, expected projects/<project>/secrets/<secret>", secret)
+	}
+	s := &gcpStore{
+		logf:     logf,
+		secret:   secret,
+		apiURL:   apiURL,
+		tokenURL: tokenURL,
+		hc:       &http.Client{Timeout: requestTimeout},
+	}
+	// Hydrate cache with the potentially current state
+	if err := s.loadState(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *gcpStore) String() string { return fmt.Sprintf("gcpStore(%q)", s.secret) }
+
+// ReadState implements the Store interface.
+func (s *gcpStore) ReadState(id ipn.StateKey) ([]byte, error) {
+	return s.memory.ReadState(id)
+}
+
+// WriteState implements the Store interface.
+func (s *gcpStore) WriteState(id ipn.StateKey, bs []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.memory.WriteState(id, bs); err != nil {
+		return err
+	}
+	return s.persistStateLocked()
+}
+
+type secretPayload struct {
+	Data []byte `json:"data"` // base64-encoded in JSON, as the API expects
+}
+
+// loadState reads the state from the latest version of the secret,
+// creating the secret if it doesn't exist.
+func (s *gcpStore) loadState() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var resp struct {
+		Name    string        `json:"name"`
+		Payload secretPayload `json:"payload"`
+	}
+	err := s.doLocked("GET", s.secret+"/versions/latest:access", nil, &resp)
+	if isStatus(err, http.StatusNotFound) {
+		// Either the secret or its first version doesn't exist yet.
+		m := secretNameRx.FindStringSubmatch(s.secret)
+		create := map[string]any{"replication": map[string]any{"automatic": struct{}{}}}
+		err := s.doLocked("POST", "projects/"+m[1]+"/secrets?secretId="+m[2], create, nil)
+		if err != nil && !isStatus(err, http.StatusConflict) {
+			return fmt.Errorf("creating secret: %w", err)
+		}
+		return s.persistStateLocked()
+	}
+	if err != nil {
+		return err
+	}
+	s.version = resp.Name
+	return s.memory.LoadFromJSON(resp.Payload.Data)
+}
+
+// persistStateLocked adds a version of the secret with the in-memory
+// state, and destroys the previous one.
+//
+// s.mu must be held.
+func (s *gcpStore) persistStateLocked() error {
+	bs, err := s.memory.ExportToJSON()
+	if err != nil {
+		return err
+	}
+	var resp struct {
+		Name string `json:"name"`
+	}
+	req := map[string]any{"payload": secretPayload{Data: bs}}
+	if err := s.doLocked("POST", s.secret+":addVersion", req, &resp); err != nil {
+		return err
+	}
+	prev := s.version
+	s.version = resp.Name
+	if prev != "" && prev != resp.Name {
+		// Old versions would otherwise pile up, with the old node keys in
+		// them.
+		if err := s.doLocked("POST", prev+":destroy", struct{}{}, nil); err != nil {
+			s.logf("gcpstore: destroying %s: %v", prev, err)
+		}
+	}
+	return nil
+}
+
+// apiError is an error response from a Google API.
+type apiError struct {
+	status int
+	body   string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("HTTP %d: %s", e.status, strings.TrimSpace(e.body))
+}
+
+func isStatus(err error, status int) bool {
+	var ae *apiError
+	return errors.As(err, &ae) && ae.status == status
+}
+
+// doLocked sends a request with the JSON of in, if non-nil, to the Secret
+// Manager API at path, relative to its base URL, and decodes the response
+// into out, if non-nil.
+//
+// s.mu must be held.
+func (s *gcpStore) doLocked(method, path string, in, out any) error {
+	token, err := s.accessTokenLocked()
+	if err != nil {
+		return err
+	}
+	var body io.Reader
+	if in != nil {
+		bs, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(bs)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, s.apiURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	res, err := s.hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	bs, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if res.StatusCode/100 != 2 {
+		return &apiError{status: res.StatusCode, body: string(bs)}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(bs, out)
+}
+
+// accessTokenLocked returns an OAuth2 access token for the service account
+// of the VM, from the metadata server.
+//
+// s.mu must be held.
+func (s *gcpStore) accessTokenLocked() (string, error) {
+	if s.token != "" && time.Now().Before(s.tokenExpiry) {
+		return s.token, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", s.tokenURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	res, err := s.hc.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("fetching access token: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		bs, _ := io.ReadAll(io.LimitReader(res.Body, 1<<10))
+		return "", fmt.Errorf("fetching access token: HTTP %d: %s", res.StatusCode, bytes.TrimSpace(bs))
+	}
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&tok); err != nil {
+		return "", fmt.Errorf("fetching access token: %w", err)
+	}
+	if tok.AccessToken == "" {
+		return "", errors.New("fetching access token: empty token")
+	}
+	s.token = tok.AccessToken
+	// Refresh a minute early, so the token doesn't expire mid-request.
+	s.tokenExpiry = time.Now().Add(time.Duration(tok.ExpiresIn)*time.Second - time.Minute)
+	return s.token, nil
+}
@@ -0,0 +1,146 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build linux
+
+package gcpstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"tailscale.com/ipn"
+)
+
+// fakeSecretManager is a Secret Manager with a single secret, and a
+// metadata server.
+type fakeSecretManager struct {
+	mu        sync.Mutex
+	created   bool
+	versions  map[string][]byte // by name; destroyed ones are removed
+	latest    string
+	nextVer   int
+	tokens    int
+	lastToken string
+}
+
+const testSecret = "projects/p/secrets/ts-state"
+
+func (f *fakeSecretManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.URL.Path == "/token" {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			http.Error(w, "missing Metadata-Flavor", http.StatusForbidden)
+			return
+		}
+		f.tokens++
+		f.lastToken = fmt.Sprintf("tok%d", f.tokens)
+		json.NewEncoder(w).Encode(map[string]any{"access_token": f.lastToken, "expires_in": 3600})
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer "+f.lastToken {
+		http.Error(w, "bad token", http.StatusUnauthorized)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+	switch {
+	case r.Method == "POST" && path == "projects/p/secrets" && r.URL.Query().Get("secretId") == "ts-state":
+		if f.created {
+			http.Error(w, "exists", http.StatusConflict)
+			return
+		}
+		f.created = true
+		w.Write([]byte("{}"))
+	case !f.created:
+		http.NotFound(w, r)
+	case r.Method == "GET" && path == testSecret+"/versions/latest:access":
+		if f.latest == "" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"name":    f.latest,
+			"payload": secretPayload{Data: f.versions[f.latest]},
+		})
+	case r.Method == "POST" && path == testSecret+":addVersion":
+		var req struct {
+			Payload secretPayload `json:"payload"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.nextVer++
+		// The API names versions by project number.
+		f.latest = fmt.Sprintf("projects/123/secrets/ts-state/versions/%d", f.nextVer)
+		if f.versions == nil {
+			f.versions = make(map[string][]byte)
+		}
+		f.versions[f.latest] = req.Payload.Data
+		json.NewEncoder(w).Encode(map[string]any{"name": f.latest})
+	case r.Method == "POST" && strings.HasSuffix(path, ":destroy"):
+		name := strings.TrimSuffix(path, ":destroy")
+		if _, ok := f.versions[name]; !ok {
+			http.NotFound(w, r)
+			return
+		}
+		delete(f.versions, name)
+		w.Write([]byte("{}"))
+	default:
+		http.Error(w, "unexpected request "+r.Method+" "+path, http.StatusBadRequest)
+	}
+}
+
+func TestGCPStore(t *testing.T) {
+	f := new(fakeSecretManager)
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+	open := func() ipn.StateStore {
+		t.Helper()
+		s, err := newStore(t.Logf, Prefix+testSecret, srv.URL+"/v1/", srv.URL+"/token")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	s := open()
+	if !f.created {
+		t.Error("secret wasn't created")
+	}
+	if _, err := s.ReadState("foo"); err != ipn.ErrStateNotExist {
+		t.Errorf("ReadState(foo) error = %v; want ErrStateNotExist", err)
+	}
+	if err := s.WriteState("foo", []byte("bar")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.WriteState("baz", []byte("quux")); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.versions) != 1 {
+		t.Errorf("%d secret versions left; want only the latest", len(f.versions))
+	}
+	if f.tokens != 1 {
+		t.Errorf("fetched %d access tokens; want 1", f.tokens)
+	}
+
+	// A new store, as after a restart, reads the same state.
+	s2 := open()
+	for id, want := range map[ipn.StateKey]string{"foo": "bar", "baz": "quux"} {
+		if got, err := s2.ReadState(id); err != nil || string(got) != want {
+			t.Errorf("ReadState(%q) = %q, %v; want %q", id, got, err, want)
+		}
+	}
+
+	for _, path := range []string{Prefix, Prefix + "projects/p", Prefix + "projects/p/secrets/s/versions/1"} {
+		if _, err := newStore(t.Logf, path, srv.URL+"/v1/", srv.URL+"/token"); err == nil {
+			t.Errorf("newStore(%q) succeeded; want error", path)
+		}
+	}
+}
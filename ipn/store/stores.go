@@ -14,6 +14,7 @@
 	"strings"
 	"sync"
 
+	"golang.org/x/exp/maps"
 	"tailscale.com/atomicfile"
 	"tailscale.com/ipn"
 	"tailscale.com/ipn/store/mem"
@@ -51,6 +52,9 @@ func registerDefaultStores() {
 //     is ignored and an in-memory store is used.
 //   - (Linux-only) if the string begins with "arn:",
 //     the suffix an AWS ARN for an SSM.
+//   - (Linux-only) if the string begins with "gcpsecret:",
+//     the suffix is a GCP Secret Manager secret name, of the form
+//     "projects/<project>/secrets/<secret>".
 //   - (Linux-only) if the string begins with "kube:",
 //     the suffix is a Kubernetes secret name
 //   - In all other cases, the path is treated as a filepath.
@@ -161,6 +165,13 @@ func NewFileStore(logf logger.Logf, path string) (ipn.StateStore, error) {
 	return ret, nil
 }
 
+// stateKeys returns the keys of all the values in s.
+func (s *FileStore) stateKeys() []ipn.StateKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return maps.Keys(s.cache)
+}
+
 // ReadState implements the StateStore interface.
 func (s *FileStore) ReadState(id ipn.StateKey) ([]byte, error) {
 	s.mu.RLock()
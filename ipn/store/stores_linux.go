@@ -8,6 +8,7 @@
 
 	"tailscale.com/ipn"
 	"tailscale.com/ipn/store/awsstore"
+	"tailscale.com/ipn/store/gcpstore"
 	"tailscale.com/ipn/store/kubestore"
 	"tailscale.com/types/logger"
 )
@@ -22,4 +23,5 @@ func registerExternalStores() {
 		return kubestore.New(logf, secretName)
 	})
 	Register("arn:", awsstore.New)
+	Register(gcpstore.Prefix, gcpstore.New)
 }
@@ -185,3 +185,142 @@ type Status struct {
 func (s *Status) Error() string {
 	return s.Message
 }
+
+// Service is a named abstraction of software service (for example, mysql)
+// consisting of local port (for example 3306) that the proxy listens on, and
+// the selector that determines which pods will answer requests sent through
+// the proxy.
+//
+// Only the fields used by Tailscale are included.
+type Service struct {
+	TypeMeta   `json:",inline"`
+	ObjectMeta `json:"metadata"`
+
+	// Spec defines the behavior of a service.
+	// +optional
+	Spec ServiceSpec `json:"spec,omitempty"`
+}
+
+// ServiceSpec describes the attributes that a user creates on a service.
+type ServiceSpec struct {
+	// Type determines how the Service is exposed. Defaults to ClusterIP.
+	// +optional
+	Type string `json:"type,omitempty"`
+
+	// ClusterIP is the IP address of the service and is usually assigned
+	// randomly. "None" means that the service is headless.
+	// +optional
+	ClusterIP string `json:"clusterIP,omitempty"`
+
+	// ClusterIPs is a list of IP addresses assigned to this service, one
+	// per IP family. If ClusterIP is set, ClusterIPs[0] is the same value.
+	// +optional
+	ClusterIPs []string `json:"clusterIPs,omitempty"`
+
+	// Route service traffic to pods with label keys and values matching
+	// this selector.
+	// +optional
+	Selector map[string]string `json:"selector,omitempty"`
+}
+
+// ServiceList holds a list of services.
+type ServiceList struct {
+	TypeMeta `json:",inline"`
+
+	// List of services
+	Items []Service `json:"items"`
+}
+
+// Endpoints is a collection of endpoints that implement the actual service.
+type Endpoints struct {
+	TypeMeta   `json:",inline"`
+	ObjectMeta `json:"metadata"`
+
+	// The set of all endpoints is the union of all subsets.
+	// +optional
+	Subsets []EndpointSubset `json:"subsets,omitempty"`
+}
+
+// EndpointSubset is a group of addresses with a common set of ports.
+//
+// Only the fields used by Tailscale are included.
+type EndpointSubset struct {
+	// IP addresses which offer the related ports that are marked as ready.
+	// +optional
+	Addresses []EndpointAddress `json:"addresses,omitempty"`
+
+	// IP addresses which offer the related ports but are not currently
+	// marked as ready because they have not yet finished starting, have
+	// recently failed a readiness check, or have recently failed a liveness
+	// check.
+	// +optional
+	NotReadyAddresses []EndpointAddress `json:"notReadyAddresses,omitempty"`
+}
+
+// EndpointAddress is a tuple that describes single IP address.
+type EndpointAddress struct {
+	// The IP of this endpoint.
+	IP string `json:"ip"`
+
+	// The Hostname of this endpoint
+	// +optional
+	Hostname string `json:"hostname,omitempty"`
+
+	// Optional: Node hosting this endpoint. This can be used to determine
+	// endpoints local to a node.
+	// +optional
+	NodeName *string `json:"nodeName,omitempty"`
+}
+
+// EndpointsList is a list of endpoints.
+type EndpointsList struct {
+	TypeMeta `json:",inline"`
+
+	// List of endpoints.
+	Items []Endpoints `json:"items"`
+}
+
+// Pod is a collection of containers that can run on a host.
+//
+// Only the fields used by Tailscale are included.
+type Pod struct {
+	TypeMeta   `json:",inline"`
+	ObjectMeta `json:"metadata"`
+
+	// Most recently observed status of the pod.
+	// +optional
+	Status PodStatus `json:"status,omitempty"`
+}
+
+// PodStatus represents information about the status of a pod.
+//
+// Only the fields used by Tailscale are included.
+type PodStatus struct {
+	// Current service state of pod.
+	// +optional
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	Conditions []PodCondition `json:"conditions,omitempty"`
+}
+
+// PodCondition contains details for the current condition of this pod.
+type PodCondition struct {
+	// Type is the type of the condition, such as "Ready" or the condition
+	// type of one of the pod's readiness gates.
+	Type string `json:"type"`
+
+	// Status is the status of the condition: "True", "False" or "Unknown".
+	Status string `json:"status"`
+
+	// Last time the condition transitioned from one status to another.
+	// +optional
+	LastTransitionTime time.Time `json:"lastTransitionTime,omitempty"`
+
+	// Unique, one-word, CamelCase reason for the condition's last transition.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Human-readable message indicating details about last transition.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
@@ -228,6 +228,55 @@ func (c *Client) UpdateSecret(ctx context.Context, s *Secret) error {
 	return c.doRequest(ctx, "PUT", c.secretURL(s.Name), s, nil)
 }
 
+// listURL returns the URL to list the resources of the provided kind, such
+// as "services", in the client's namespace that match sel.
+func (c *Client) listURL(resource string, sel LabelSelector) string {
+	u := fmt.Sprintf("%s/api/v1/namespaces/%s/%s", c.url, c.ns, resource)
+	if len(sel) > 0 {
+		u += "?" + url.Values{"labelSelector": {sel.String()}}.Encode()
+	}
+	return u
+}
+
+// GetService fetches the service with the given name from the Kubernetes API.
+func (c *Client) GetService(ctx context.Context, name string) (*Service, error) {
+	s := &Service{}
+	if err := c.doRequest(ctx, "GET", fmt.Sprintf("%s/api/v1/namespaces/%s/services/%s", c.url, c.ns, name), nil, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// GetEndpoints fetches the endpoints of the service with the given name from
+// the Kubernetes API.
+func (c *Client) GetEndpoints(ctx context.Context, name string) (*Endpoints, error) {
+	e := &Endpoints{}
+	if err := c.doRequest(ctx, "GET", fmt.Sprintf("%s/api/v1/namespaces/%s/endpoints/%s", c.url, c.ns, name), nil, e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// ListServices fetches the services matching sel from the Kubernetes API.
+// An empty selector matches all services in the namespace.
+func (c *Client) ListServices(ctx context.Context, sel LabelSelector) (*ServiceList, error) {
+	l := &ServiceList{}
+	if err := c.doRequest(ctx, "GET", c.listURL("services", sel), nil, l); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// ListEndpoints fetches the endpoints matching sel from the Kubernetes API.
+// An empty selector matches all endpoints in the namespace.
+func (c *Client) ListEndpoints(ctx context.Context, sel LabelSelector) (*EndpointsList, error) {
+	l := &EndpointsList{}
+	if err := c.doRequest(ctx, "GET", c.listURL("endpoints", sel), nil, l); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
 // JSONPatch is a JSON patch operation.
 // It currently (2023-03-02) only supports the "remove" operation.
 //
@@ -265,6 +314,34 @@ func (c *Client) StrategicMergePatchSecret(ctx context.Context, name string, s *
 	return c.doRequest(ctx, "PATCH", surl, s, nil, setHeader("Content-Type", "application/strategic-merge-patch+json"))
 }
 
+// StrategicMergePatchPod updates the metadata, such as the annotations, of
+// the pod name in the Kubernetes API using a strategic merge patch.
+// If a fieldManager is provided, it will be used to track the patch.
+func (c *Client) StrategicMergePatchPod(ctx context.Context, name string, p *Pod, fieldManager string) error {
+	return c.strategicMergePatchPod(ctx, name, "", p, fieldManager)
+}
+
+// StrategicMergePatchPodStatus updates the status, such as the conditions,
+// of the pod name in the Kubernetes API using a strategic merge patch. As
+// conditions are merged by type, it only replaces the conditions in p.
+// If a fieldManager is provided, it will be used to track the patch.
+func (c *Client) StrategicMergePatchPodStatus(ctx context.Context, name string, p *Pod, fieldManager string) error {
+	return c.strategicMergePatchPod(ctx, name, "/status", p, fieldManager)
+}
+
+func (c *Client) strategicMergePatchPod(ctx context.Context, name, subresource string, p *Pod, fieldManager string) error {
+	purl := fmt.Sprintf("%s/api/v1/namespaces/%s/pods/%s%s", c.url, c.ns, name, subresource)
+	if fieldManager != "" {
+		uv := url.Values{
+			"fieldManager": {fieldManager},
+		}
+		purl += "?" + uv.Encode()
+	}
+	p.Namespace = c.ns
+	p.Name = name
+	return c.doRequest(ctx, "PATCH", purl, p, nil, setHeader("Content-Type", "application/strategic-merge-patch+json"))
+}
+
 // CheckSecretPermissions checks the secret access permissions of the current
 // pod. It returns an error if the basic permissions tailscale needs are
 // missing, and reports whether the patch permission is additionally present.
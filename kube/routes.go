@@ -0,0 +1,267 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package kube
+
+import (
+	"context"
+	"net/netip"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"go4.org/netipx"
+)
+
+// LabelSelector selects the objects that have all of its labels, with the
+// same values, like the matchLabels of a Kubernetes label selector. An empty
+// LabelSelector matches all objects.
+type LabelSelector map[string]string
+
+// Matches reports whether an object with the provided labels is selected by
+// s.
+func (s LabelSelector) Matches(labels map[string]string) bool {
+	for k, v := range s {
+		if lv, ok := labels[k]; !ok || lv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns s in the format of the labelSelector parameter of the
+// Kubernetes API, such as "app=web,tier=frontend".
+func (s LabelSelector) String() string {
+	kv := make([]string, 0, len(s))
+	for k, v := range s {
+		kv = append(kv, k+"="+v)
+	}
+	sort.Strings(kv)
+	return strings.Join(kv, ",")
+}
+
+// RouteTarget is where a RouteMapper advertises its routes, such as the
+// advertised routes in the prefs of a proxy.
+type RouteTarget interface {
+	// SetRoutes replaces the routes advertised by the target.
+	SetRoutes(ctx context.Context, routes []netip.Prefix) error
+}
+
+// RouteTargetFunc is an adapter to use a function as a RouteTarget.
+type RouteTargetFunc func(ctx context.Context, routes []netip.Prefix) error
+
+// SetRoutes calls f(ctx, routes).
+func (f RouteTargetFunc) SetRoutes(ctx context.Context, routes []netip.Prefix) error {
+	return f(ctx, routes)
+}
+
+// RouteMapper maps the Services and Endpoints that match a set of label
+// selectors to the minimal set of routes covering their IP addresses, and
+// keeps a RouteTarget up to date as they churn.
+//
+// Objects are fed to it one at a time by UpdateService, UpdateEndpoints and
+// the Delete methods, such as from a reconciler or a watch, or all at once
+// by Resync. Sync then advertises the resulting routes to the target, if
+// they changed.
+//
+// As Kubernetes copies the labels of a Service to its Endpoints, a selector
+// of a Service matches both its cluster IPs and the IPs of its pods.
+type RouteMapper struct {
+	// Selectors are the label selectors of the objects whose addresses
+	// are advertised. An object is included if it matches any of them.
+	Selectors []LabelSelector
+
+	// Target is where the routes are advertised.
+	Target RouteTarget
+
+	// IncludeNotReady specifies whether to also advertise the addresses
+	// of endpoints that aren't ready.
+	IncludeNotReady bool
+
+	mu     sync.Mutex
+	addrs  map[objectKey][]netip.Addr
+	synced bool           // whether last was advertised to Target
+	last   []netip.Prefix // routes last advertised to Target
+}
+
+// objectKey identifies a Kubernetes object in a RouteMapper.
+type objectKey struct {
+	kind, namespace, name string
+}
+
+func (m *RouteMapper) matches(meta ObjectMeta) bool {
+	for _, sel := range m.Selectors {
+		if sel.Matches(meta.Labels) {
+			return true
+		}
+	}
+	return false
+}
+
+// setLocked records the addresses of the object k, or removes it if addrs
+// is empty.
+//
+// m.mu must be held.
+func (m *RouteMapper) setLocked(k objectKey, addrs []netip.Addr) {
+	if len(addrs) == 0 {
+		delete(m.addrs, k)
+		return
+	}
+	if m.addrs == nil {
+		m.addrs = make(map[objectKey][]netip.Addr)
+	}
+	m.addrs[k] = addrs
+}
+
+// serviceAddrs returns the cluster IPs of svc.
+func serviceAddrs(svc *Service) []netip.Addr {
+	var ret []netip.Addr
+	for _, s := range append([]string{svc.Spec.ClusterIP}, svc.Spec.ClusterIPs...) {
+		if ip, err := netip.ParseAddr(s); err == nil && !slices.Contains(ret, ip) {
+			ret = append(ret, ip)
+		}
+	}
+	return ret
+}
+
+// endpointsAddrs returns the IPs of the endpoints in ep, including those that
+// aren't ready if includeNotReady is set.
+func endpointsAddrs(ep *Endpoints, includeNotReady bool) []netip.Addr {
+	var ret []netip.Addr
+	add := func(eas []EndpointAddress) {
+		for _, ea := range eas {
+			if ip, err := netip.ParseAddr(ea.IP); err == nil {
+				ret = append(ret, ip)
+			}
+		}
+	}
+	for _, ss := range ep.Subsets {
+		add(ss.Addresses)
+		if includeNotReady {
+			add(ss.NotReadyAddresses)
+		}
+	}
+	return ret
+}
+
+// UpdateService records the current state of svc, which is dropped if it
+// no longer matches m.Selectors.
+func (m *RouteMapper) UpdateService(svc *Service) {
+	var addrs []netip.Addr
+	if m.matches(svc.ObjectMeta) {
+		addrs = serviceAddrs(svc)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.setLocked(objectKey{"Service", svc.Namespace, svc.Name}, addrs)
+}
+
+// UpdateEndpoints records the current state of ep, which is dropped if it
+// no longer matches m.Selectors.
+func (m *RouteMapper) UpdateEndpoints(ep *Endpoints) {
+	var addrs []netip.Addr
+	if m.matches(ep.ObjectMeta) {
+		addrs = endpointsAddrs(ep, m.IncludeNotReady)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.setLocked(objectKey{"Endpoints", ep.Namespace, ep.Name}, addrs)
+}
+
+// DeleteService forgets the Service with the provided namespace and name.
+func (m *RouteMapper) DeleteService(namespace, name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.setLocked(objectKey{"Service", namespace, name}, nil)
+}
+
+// DeleteEndpoints forgets the Endpoints with the provided namespace and
+// name.
+func (m *RouteMapper) DeleteEndpoints(namespace, name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.setLocked(objectKey{"Endpoints", namespace, name}, nil)
+}
+
+// Routes returns the minimal set of routes covering the addresses of all
+// the objects currently known to m.
+func (m *RouteMapper) Routes() []netip.Prefix {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.routesLocked()
+}
+
+func (m *RouteMapper) routesLocked() []netip.Prefix {
+	var all []netip.Addr
+	for _, addrs := range m.addrs {
+		all = append(all, addrs...)
+	}
+	return MinimalRoutes(all)
+}
+
+// Sync advertises the current routes of m to m.Target, unless they're the
+// routes it last advertised successfully.
+func (m *RouteMapper) Sync(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	routes := m.routesLocked()
+	if m.synced && slices.Equal(routes, m.last) {
+		return nil
+	}
+	if err := m.Target.SetRoutes(ctx, routes); err != nil {
+		return err
+	}
+	m.synced = true
+	m.last = routes
+	return nil
+}
+
+// Resync replaces the objects known to m with the Services and Endpoints
+// listed by c that match m.Selectors, and then calls Sync. It's meant to be
+// called on startup and periodically, to recover from missed updates.
+func (m *RouteMapper) Resync(ctx context.Context, c *Client) error {
+	addrs := make(map[objectKey][]netip.Addr)
+	for _, sel := range m.Selectors {
+		svcs, err := c.ListServices(ctx, sel)
+		if err != nil {
+			return err
+		}
+		for i := range svcs.Items {
+			svc := &svcs.Items[i]
+			if a := serviceAddrs(svc); len(a) > 0 {
+				addrs[objectKey{"Service", svc.Namespace, svc.Name}] = a
+			}
+		}
+		eps, err := c.ListEndpoints(ctx, sel)
+		if err != nil {
+			return err
+		}
+		for i := range eps.Items {
+			ep := &eps.Items[i]
+			if a := endpointsAddrs(ep, m.IncludeNotReady); len(a) > 0 {
+				addrs[objectKey{"Endpoints", ep.Namespace, ep.Name}] = a
+			}
+		}
+	}
+	m.mu.Lock()
+	m.addrs = addrs
+	m.mu.Unlock()
+	return m.Sync(ctx)
+}
+
+// MinimalRoutes returns the smallest sorted set of prefixes that covers
+// exactly addrs. Adjacent addresses are merged into wider prefixes, so a
+// fully used block is advertised as a single route.
+func MinimalRoutes(addrs []netip.Addr) []netip.Prefix {
+	var b netipx.IPSetBuilder
+	for _, a := range addrs {
+		b.Add(a.Unmap())
+	}
+	s, err := b.IPSet()
+	if err != nil {
+		// Only possible for invalid addresses, which are never added.
+		return nil
+	}
+	return s.Prefixes()
+}
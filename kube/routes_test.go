@@ -0,0 +1,115 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package kube
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestLabelSelector(t *testing.T) {
+	sel := LabelSelector{"tier": "frontend", "app": "web"}
+	if got, want := sel.String(), "app=web,tier=frontend"; got != want {
+		t.Errorf("String = %q, want %q", got, want)
+	}
+	if !sel.Matches(map[string]string{"app": "web", "tier": "frontend", "x": "y"}) {
+		t.Error("superset of labels didn't match")
+	}
+	if sel.Matches(map[string]string{"app": "web"}) {
+		t.Error("subset of labels matched")
+	}
+	if sel.Matches(map[string]string{"app": "web", "tier": "backend"}) {
+		t.Error("different value matched")
+	}
+	if !(LabelSelector{}).Matches(nil) {
+		t.Error("empty selector didn't match")
+	}
+}
+
+func TestMinimalRoutes(t *testing.T) {
+	var addrs []netip.Addr
+	for i := 0; i < 4; i++ {
+		addrs = append(addrs, netip.MustParseAddr(fmt.Sprintf("10.0.0.%d", i)))
+	}
+	addrs = append(addrs,
+		netip.MustParseAddr("10.0.0.5"),
+		netip.MustParseAddr("10.0.0.5"),
+		netip.MustParseAddr("::ffff:10.1.0.1"),
+		netip.MustParseAddr("fd7a::1"),
+	)
+	want := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/30"),
+		netip.MustParsePrefix("10.0.0.5/32"),
+		netip.MustParsePrefix("10.1.0.1/32"),
+		netip.MustParsePrefix("fd7a::1/128"),
+	}
+	if got := MinimalRoutes(addrs); !reflect.DeepEqual(got, want) {
+		t.Errorf("MinimalRoutes = %v, want %v", got, want)
+	}
+	if got := MinimalRoutes(nil); len(got) != 0 {
+		t.Errorf("MinimalRoutes(nil) = %v, want none", got)
+	}
+}
+
+func TestRouteMapper(t *testing.T) {
+	var got []netip.Prefix
+	calls := 0
+	m := &RouteMapper{
+		Selectors: []LabelSelector{{"app": "web"}},
+		Target: RouteTargetFunc(func(ctx context.Context, routes []netip.Prefix) error {
+			calls++
+			got = routes
+			return nil
+		}),
+	}
+	sync := func(desc string, wantCalls int, want ...string) {
+		t.Helper()
+		if err := m.Sync(context.Background()); err != nil {
+			t.Fatalf("%s: %v", desc, err)
+		}
+		if calls != wantCalls {
+			t.Errorf("%s: %d calls to SetRoutes, want %d", desc, calls, wantCalls)
+		}
+		var wantRoutes []netip.Prefix
+		for _, w := range want {
+			wantRoutes = append(wantRoutes, netip.MustParsePrefix(w))
+		}
+		if !slices.Equal(got, wantRoutes) {
+			t.Errorf("%s: routes = %v, want %v", desc, got, wantRoutes)
+		}
+	}
+	sync("initial", 1)
+
+	meta := ObjectMeta{Name: "web", Namespace: "default", Labels: map[string]string{"app": "web"}}
+	m.UpdateService(&Service{
+		ObjectMeta: meta,
+		Spec:       ServiceSpec{ClusterIP: "10.96.0.10", ClusterIPs: []string{"10.96.0.10", "fd00::10"}},
+	})
+	ep := &Endpoints{
+		ObjectMeta: meta,
+		Subsets: []EndpointSubset{{
+			Addresses:         []EndpointAddress{{IP: "10.244.0.4"}, {IP: "10.244.0.5"}},
+			NotReadyAddresses: []EndpointAddress{{IP: "10.244.0.6"}},
+		}},
+	}
+	m.UpdateEndpoints(ep)
+	m.UpdateService(&Service{
+		ObjectMeta: ObjectMeta{Name: "db", Namespace: "default", Labels: map[string]string{"app": "db"}},
+		Spec:       ServiceSpec{ClusterIP: "10.96.0.20"},
+	})
+	sync("added", 2, "10.96.0.10/32", "10.244.0.4/31", "fd00::10/128")
+	sync("unchanged", 2, "10.96.0.10/32", "10.244.0.4/31", "fd00::10/128")
+
+	ep.Subsets[0].Addresses = ep.Subsets[0].Addresses[:1]
+	m.UpdateEndpoints(ep)
+	sync("churn", 3, "10.96.0.10/32", "10.244.0.4/32", "fd00::10/128")
+
+	m.DeleteService("default", "web")
+	m.DeleteEndpoints("default", "web")
+	sync("deleted", 4)
+}
@@ -578,6 +578,9 @@ func NewWithConfigPath(collection, dir, cmdName string, netMon *netmon.Monitor,
 	if envknob.NoLogsNoSupport() || testenv.InTest() {
 		logf("You have disabled logging. Tailscale will not be able to provide support.")
 		conf.HTTPC = &http.Client{Transport: noopPretendSuccessTransport{}}
+		if envknob.LocalOnlyLogs() && collection == logtail.CollectionNode {
+			startLocalLog(filepath.Join(dir, cmdName+".local"), logf)
+		}
 	} else if val := getLogTarget(); val != "" {
 		logf("You have enabled a non-default log target. Doing without being told to by Tailscale staff or your network administrator will make getting support difficult.")
 		conf.BaseURL = val
@@ -803,6 +806,18 @@ func goVersion() string {
 	return v
 }
 
+// startLocalLog starts retaining this process's logs locally, spilling
+// older ones to files starting with spillPrefix, for "tailscale debug logs".
+func startLocalLog(spillPrefix string, logf logger.Logf) {
+	ll, err := logtail.NewLocalLog(logtail.LocalLogOptions{SpillPrefix: spillPrefix})
+	if err != nil {
+		logf("logpolicy: keeping local logs in memory only: %v", err)
+		ll, _ = logtail.NewLocalLog(logtail.LocalLogOptions{})
+	}
+	logtail.SetLocalLog(ll)
+	logf("Logs are kept locally only; see 'tailscale debug logs'.")
+}
+
 type noopPretendSuccessTransport struct{}
 
 func (noopPretendSuccessTransport) RoundTrip(req *http.Request) (*http.Response, error) {
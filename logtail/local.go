@@ -0,0 +1,204 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logtail
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// LocalLogOptions are the options for NewLocalLog.
+type LocalLogOptions struct {
+	// MaxMemory is the maximum number of bytes of log entries kept in
+	// memory. If zero, 1 MiB is used.
+	MaxMemory int
+
+	// SpillPrefix, if non-empty, is the path prefix of the files that
+	// entries are moved to when they no longer fit in memory. Two files
+	// are used, SpillPrefix+".log" and SpillPrefix+".old.log", so up to
+	// twice MaxSpillFileSize bytes are kept on disk. Spilled entries
+	// survive restarts.
+	SpillPrefix string
+
+	// MaxSpillFileSize is the maximum size of each spill file. If zero,
+	// 4 MiB is used.
+	MaxSpillFileSize int
+}
+
+// LocalLog retains the most recent log entries, as written to a Logger, in
+// a bounded ring buffer in memory, moving older entries to bounded files on
+// disk. It's used instead of uploading logs when logs must stay on the
+// machine.
+//
+// It's safe for concurrent use.
+type LocalLog struct {
+	maxMem      int
+	spillPrefix string
+	maxSpill    int
+
+	mu        sync.Mutex
+	entries   [][]byte // oldest first
+	memSize   int      // total size of entries
+	spill     *os.File // nil if not spilling
+	spillSize int
+	spillErr  error // first error writing to disk; stops spilling
+}
+
+// NewLocalLog returns a new LocalLog with the provided options.
+func NewLocalLog(opts LocalLogOptions) (*LocalLog, error) {
+	l := &LocalLog{
+		maxMem:      opts.MaxMemory,
+		spillPrefix: opts.SpillPrefix,
+		maxSpill:    opts.MaxSpillFileSize,
+	}
+	if l.maxMem <= 0 {
+		l.maxMem = 1 << 20
+	}
+	if l.maxSpill <= 0 {
+		l.maxSpill = 4 << 20
+	}
+	if l.spillPrefix != "" {
+		f, err := os.OpenFile(l.spillPrefix+".log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, err
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		l.spill = f
+		l.spillSize = int(fi.Size())
+	}
+	return l, nil
+}
+
+// Append adds the log entry jsonBlob to l, evicting the oldest entries from
+// memory as needed. It retains a copy of jsonBlob.
+func (l *LocalLog) Append(jsonBlob []byte) {
+	e := bytes.Clone(jsonBlob)
+	if len(e) == 0 || e[len(e)-1] != '\n' {
+		e = append(e, '\n')
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, e)
+	l.memSize += len(e)
+	for l.memSize > l.maxMem && len(l.entries) > 1 {
+		old := l.entries[0]
+		l.entries[0] = nil
+		l.entries = l.entries[1:]
+		l.memSize -= len(old)
+		l.spillLocked(old)
+	}
+}
+
+// spillLocked appends e to the current spill file, rotating it first if it
+// would grow too large.
+func (l *LocalLog) spillLocked(e []byte) {
+	if l.spill == nil || l.spillErr != nil {
+		return
+	}
+	if l.spillSize > 0 && l.spillSize+len(e) > l.maxSpill {
+		l.spill.Close()
+		cur := l.spillPrefix + ".log"
+		if err := os.Rename(cur, l.spillPrefix+".old.log"); err != nil {
+			l.spillErr = err
+			return
+		}
+		f, err := os.OpenFile(cur, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			l.spillErr = err
+			return
+		}
+		l.spill = f
+		l.spillSize = 0
+	}
+	n, err := l.spill.Write(e)
+	l.spillSize += n
+	if err != nil {
+		l.spillErr = err
+	}
+}
+
+// WriteTo writes all retained log entries to w, oldest first, as a stream
+// of JSON objects separated by newlines.
+func (l *LocalLog) WriteTo(w io.Writer) (int64, error) {
+	l.mu.Lock()
+	entries := append([][]byte(nil), l.entries...)
+	l.mu.Unlock()
+
+	// The spill files may gain entries evicted after the snapshot above,
+	// which are then written twice. That's fine for a debugging aid, and
+	// better than holding the lock while writing to w.
+	var total int64
+	if l.spillPrefix != "" {
+		for _, suffix := range []string{".old.log", ".log"} {
+			n, err := copyFile(w, l.spillPrefix+suffix)
+			total += n
+			if err != nil {
+				return total, err
+			}
+		}
+	}
+	for _, e := range entries {
+		n, err := w.Write(e)
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// copyFile copies the contents of the file at path to w. It's not an
+// error for the file not to exist.
+func copyFile(w io.Writer, path string) (int64, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return io.Copy(w, f)
+}
+
+// Close closes l's spill file. Entries appended afterwards are only kept
+// in memory.
+func (l *LocalLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.spill == nil {
+		return nil
+	}
+	err := l.spill.Close()
+	l.spill = nil
+	return err
+}
+
+// localLog is the process-wide LocalLog that Loggers copy their entries
+// to, if any.
+var localLog atomic.Pointer[LocalLog]
+
+// SetLocalLog sets the LocalLog that all Loggers in the process copy their
+// log entries to, replacing any previous one. A nil l stops copying.
+//
+// Like RegisterLogTap, this is process-wide because there's basically only
+// one Logger within the program.
+func SetLocalLog(l *LocalLog) {
+	localLog.Store(l)
+}
+
+// GetLocalLog returns the LocalLog set by SetLocalLog, or nil if there's
+// none.
+func GetLocalLog() *LocalLog {
+	return localLog.Load()
+}
@@ -0,0 +1,78 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logtail
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalLog(t *testing.T) {
+	entry := func(i int) string { return fmt.Sprintf(`{"text":"line %02d"}`, i) }
+	dump := func(l *LocalLog) []string {
+		t.Helper()
+		var buf bytes.Buffer
+		if _, err := l.WriteTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+		return strings.Fields(buf.String())
+	}
+
+	t.Run("memory", func(t *testing.T) {
+		l, err := NewLocalLog(LocalLogOptions{MaxMemory: 3 * len(entry(0)+"\n")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 5; i++ {
+			l.Append([]byte(entry(i)))
+		}
+		got := dump(l)
+		want := []string{entry(2), entry(3), entry(4)}
+		if strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("got %q; want %q", got, want)
+		}
+	})
+
+	t.Run("spill", func(t *testing.T) {
+		prefix := filepath.Join(t.TempDir(), "tailscaled.local")
+		size := len(entry(0) + "\n")
+		opts := LocalLogOptions{
+			MaxMemory:        2 * size,
+			SpillPrefix:      prefix,
+			MaxSpillFileSize: 3 * size,
+		}
+		l, err := NewLocalLog(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 10; i++ {
+			l.Append([]byte(entry(i) + "\n"))
+		}
+		// Two entries in memory, and the five before them in the two
+		// spill files; the first three were rotated away.
+		var want []string
+		for i := 3; i < 10; i++ {
+			want = append(want, entry(i))
+		}
+		if got := dump(l); strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("got %q; want %q", got, want)
+		}
+		if err := l.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		// Spilled entries survive a restart.
+		l, err = NewLocalLog(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		if got := dump(l); strings.Join(got, " ") != strings.Join(want[:5], " ") {
+			t.Errorf("after restart, got %q; want %q", got, want[:5])
+		}
+	})
+}
@@ -531,6 +531,9 @@ func (l *Logger) tryDrainWake() {
 
 func (l *Logger) sendLocked(jsonBlob []byte) (int, error) {
 	tapSend(jsonBlob)
+	if ll := localLog.Load(); ll != nil {
+		ll.Append(jsonBlob)
+	}
 	if logtailDisabled.Load() {
 		return len(jsonBlob), nil
 	}
@@ -288,7 +288,7 @@ func (m *directManager) setWant(want []byte) {
 	m.wantResolvConf = want
 }
 
-var warnTrample = health.NewWarnable()
+var warnTrample = health.NewWarnable(health.WithName("dns-trample"))
 
 // checkForFileTrample checks whether /etc/resolv.conf has been trampled
 // by another program on the system. (e.g. a DHCP client)
@@ -334,6 +334,24 @@ func (m *directManager) checkForFileTrample() {
 	warnTrample.Set(errors.New("Linux DNS config not ideal. /etc/resolv.conf overwritten. See https://tailscale.com/s/dns-fight"))
 }
 
+// osConfigIntact implements osConfigChecker.
+func (m *directManager) osConfigIntact() (bool, error) {
+	m.mu.Lock()
+	want := m.wantResolvConf
+	m.mu.Unlock()
+	if want == nil {
+		return true, nil
+	}
+	cur, err := m.fs.ReadFile(resolvConf)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(cur, want), nil
+}
+
 func (m *directManager) SetDNS(config OSConfig) (err error) {
 	defer func() {
 		if err != nil && errors.Is(err, fs.ErrPermission) && runtime.GOOS == "linux" &&
@@ -100,12 +100,34 @@ func testDirect(t *testing.T, fs wholeFileFS) {
 	if got := readFile(t, backupPath); got != orig {
 		t.Fatalf("resolv.conf backup:\n%s, want:\n%s", got, orig)
 	}
+	assertIntact := func(t *testing.T, want bool) {
+		t.Helper()
+		got, err := m.osConfigIntact()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("osConfigIntact = %v, want %v", got, want)
+		}
+	}
+	assertIntact(t, true)
+
+	// Test that a resolv.conf replaced by another program is noticed.
+	if err := fs.WriteFile(resolvPath, []byte("nameserver 192.168.1.1 # dhcp"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	assertIntact(t, false)
+	if err := fs.WriteFile(resolvPath, []byte(want), 0644); err != nil {
+		t.Fatal(err)
+	}
+	assertIntact(t, true)
 
 	// Test that a nil OSConfig cleans up resolv.conf.
 	if err := m.SetDNS(OSConfig{}); err != nil {
 		t.Fatal(err)
 	}
 	assertBaseState(t)
+	assertIntact(t, true)
 
 	// Test that Close cleans up resolv.conf.
 	if err := m.SetDNS(OSConfig{Nameservers: []netip.Addr{netip.MustParseAddr("8.8.8.8")}}); err != nil {
@@ -14,6 +14,7 @@
 	"runtime"
 	"slices"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -63,6 +64,13 @@ type Manager struct {
 
 	resolver *resolver.Resolver
 	os       OSConfigurator
+
+	// mu serializes calls to os.SetDNS and guards the fields below.
+	mu             sync.Mutex
+	osConfig       OSConfig    // last config successfully passed to os.SetDNS
+	osConfigSet    bool        // whether osConfig is valid
+	osRepairs      []time.Time // when checkOSConfig reinstalled osConfig, recently
+	osRepairGaveUp bool        // whether checkOSConfig stopped reinstalling osConfig
 }
 
 // NewManagers created a new manager from the given config.
@@ -79,12 +87,27 @@ func NewManager(logf logger.Logf, oscfg OSConfigurator, netMon *netmon.Monitor,
 	}
 	m.ctx, m.ctxCancel = context.WithCancel(context.Background())
 	m.logf("using %T", m.os)
+	if c, ok := m.os.(osConfigChecker); ok {
+		go m.runOSConfigMonitor(c)
+	}
 	return m
 }
 
 // Resolver returns the Manager's DNS Resolver.
 func (m *Manager) Resolver() *resolver.Resolver { return m.resolver }
 
+// OSConfiguratorMode reports how the Manager's OSConfigurator was chosen. It
+// returns the zero ModeInfo if the OSConfigurator wasn't created by
+// NewOSConfigurator or the platform only has one kind.
+func (m *Manager) OSConfiguratorMode() ModeInfo {
+	if r, ok := m.os.(modeReporter); ok {
+		info := r.modeInfo()
+		info.Notes = slices.Clone(info.Notes)
+		return info
+	}
+	return ModeInfo{}
+}
+
 func (m *Manager) Set(cfg Config) error {
 	m.logf("Set: %v", logger.ArgWriter(func(w *bufio.Writer) {
 		cfg.WriteToBufioWriter(w)
@@ -105,10 +128,16 @@ func (m *Manager) Set(cfg Config) error {
 	if err := m.resolver.SetConfig(rcfg); err != nil {
 		return err
 	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.osConfigSet = false
+	m.osRepairs = nil
+	m.osRepairGaveUp = false
 	if err := m.os.SetDNS(ocfg); err != nil {
 		health.SetDNSOSHealth(err)
 		return err
 	}
+	m.osConfig, m.osConfigSet = ocfg, true
 	health.SetDNSOSHealth(nil)
 
 	return nil
@@ -463,9 +492,10 @@ func (m *Manager) FlushCaches() error {
 
 // Cleanup restores the system DNS configuration to its original state
 // in case the Tailscale daemon terminated without closing the router.
-// No other state needs to be instantiated before this runs.
-func Cleanup(logf logger.Logf, interfaceName string) {
-	oscfg, err := NewOSConfigurator(logf, interfaceName)
+// No other state needs to be instantiated before this runs. The mode is
+// passed to NewOSConfigurator.
+func Cleanup(logf logger.Logf, interfaceName, mode string) {
+	oscfg, err := NewOSConfigurator(logf, interfaceName, mode)
 	if err != nil {
 		logf("creating dns cleanup: %v", err)
 		return
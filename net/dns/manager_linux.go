@@ -31,7 +31,12 @@ func (kv kv) String() string {
 
 var publishOnce sync.Once
 
-func NewOSConfigurator(logf logger.Logf, interfaceName string) (ret OSConfigurator, err error) {
+// NewOSConfigurator returns an OSConfigurator for the tunnel interface
+// interfaceName. The mode, if non-empty, is the kind of DNS manager to use
+// instead of detecting one, for systems where detection picks the wrong
+// one. See canonicalDNSMode for the accepted values.
+func NewOSConfigurator(logf logger.Logf, interfaceName, mode string) (ret OSConfigurator, err error) {
+	info := new(ModeInfo)
 	env := newOSConfigEnv{
 		fs:                directFS{},
 		dbusPing:          dbusPing,
@@ -39,8 +44,10 @@ func NewOSConfigurator(logf logger.Logf, interfaceName string) (ret OSConfigurat
 		nmIsUsingResolved: nmIsUsingResolved,
 		nmVersionBetween:  nmVersionBetween,
 		resolvconfStyle:   resolvconfStyle,
+		forceMode:         mode,
+		info:              info,
 	}
-	mode, err := dnsMode(logf, env)
+	mode, err = dnsMode(logf, env)
 	if err != nil {
 		return nil, err
 	}
@@ -52,19 +59,41 @@ func NewOSConfigurator(logf logger.Logf, interfaceName string) (ret OSConfigurat
 	logf("dns: using %q mode", mode)
 	switch mode {
 	case "direct":
-		return newDirectManagerOnFS(logf, env.fs), nil
+		ret = newDirectManagerOnFS(logf, env.fs)
 	case "systemd-resolved":
-		return newResolvedManager(logf, interfaceName)
+		ret, err = newResolvedManager(logf, interfaceName)
 	case "network-manager":
-		return newNMManager(interfaceName)
+		ret, err = newNMManager(interfaceName)
 	case "debian-resolvconf":
-		return newDebianResolvconfManager(logf)
+		ret, err = newDebianResolvconfManager(logf)
 	case "openresolv":
-		return newOpenresolvManager()
+		ret, err = newOpenresolvManager()
 	default:
 		logf("[unexpected] detected unknown DNS mode %q, using direct manager as last resort", mode)
-		return newDirectManagerOnFS(logf, env.fs), nil
+		ret = newDirectManagerOnFS(logf, env.fs)
 	}
+	if err != nil {
+		return nil, err
+	}
+	return modeConfigurator{ret, *info}, nil
+}
+
+// modeConfigurator is an OSConfigurator that remembers how NewOSConfigurator
+// chose it.
+type modeConfigurator struct {
+	OSConfigurator
+	info ModeInfo
+}
+
+func (c modeConfigurator) modeInfo() ModeInfo { return c.info }
+
+// osConfigIntact implements osConfigChecker by deferring to the wrapped
+// OSConfigurator, if it can check.
+func (c modeConfigurator) osConfigIntact() (bool, error) {
+	if oc, ok := c.OSConfigurator.(osConfigChecker); ok {
+		return oc.osConfigIntact()
+	}
+	return true, nil
 }
 
 // newOSConfigEnv are the funcs newOSConfigurator needs, pulled out for testing.
@@ -76,6 +105,37 @@ type newOSConfigEnv struct {
 	nmVersionBetween          func(v1, v2 string) (safe bool, err error)
 	resolvconfStyle           func() string
 	isResolvconfDebianVersion func() bool
+	forceMode                 string // if non-empty, the mode to use instead of detecting one
+
+	// info, if non-nil, is filled in by dnsMode with how it chose the mode.
+	info *ModeInfo
+}
+
+// canonicalDNSMode returns the DNS manager mode for a user-provided mode
+// name, which can be one of the modes returned by dnsMode or one of the
+// shorter aliases "resolved", "nm" and "resolvconf". The latter picks the
+// installed flavor of resolvconf.
+func canonicalDNSMode(name string, env newOSConfigEnv) (string, error) {
+	switch name {
+	case "direct", "systemd-resolved", "network-manager", "debian-resolvconf", "openresolv":
+		return name, nil
+	case "resolved":
+		return "systemd-resolved", nil
+	case "nm":
+		return "network-manager", nil
+	case "resolvconf":
+		switch style := env.resolvconfStyle(); style {
+		case "debian":
+			return "debian-resolvconf", nil
+		case "openresolv":
+			return "openresolv", nil
+		case "":
+			return "", errors.New("resolvconf DNS mode requested, but resolvconf is not installed")
+		default:
+			return "", fmt.Errorf("resolvconf DNS mode requested, but resolvconf flavor %q is unsupported", style)
+		}
+	}
+	return "", fmt.Errorf("unknown DNS mode %q; want one of direct, resolved, nm, resolvconf", name)
 }
 
 func dnsMode(logf logger.Logf, env newOSConfigEnv) (ret string, err error) {
@@ -88,8 +148,25 @@ func dnsMode(logf logger.Logf, env newOSConfigEnv) (ret string, err error) {
 			dbg("ret", ret)
 		}
 		logf("dns: %v", debug)
+
+		if env.info != nil {
+			notes := make([]string, len(debug))
+			for i, kv := range debug {
+				notes[i] = kv.String()
+			}
+			*env.info = ModeInfo{
+				Mode:   ret,
+				Forced: env.forceMode != "",
+				Notes:  notes,
+			}
+		}
 	}()
 
+	if env.forceMode != "" {
+		dbg("forced", env.forceMode)
+		return canonicalDNSMode(env.forceMode, env)
+	}
+
 	// In all cases that we detect systemd-resolved, try asking it what it
 	// thinks the current resolv.conf mode is so we can add it to our logs.
 	defer func() {
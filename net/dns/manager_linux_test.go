@@ -7,6 +7,7 @@
 	"errors"
 	"io/fs"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -270,6 +271,24 @@ func TestLinuxDNSMode(t *testing.T) {
 			wantLog: "dns: [resolved-ping=yes rc=resolved resolved=file nm=no resolv-conf-mode=fortests ret=systemd-resolved]",
 			want:    "systemd-resolved",
 		},
+		{
+			name: "forced_direct_over_resolved",
+			env: env(
+				resolvDotConf("# Managed by systemd-resolved", "nameserver 127.0.0.53"),
+				resolvedRunning(),
+				forceMode("direct")),
+			wantLog: "dns: [forced=direct ret=direct]",
+			want:    "direct",
+		},
+		{
+			name: "forced_resolvconf_alias",
+			env: env(
+				resolvDotConf("nameserver 10.0.0.1"),
+				resolvconf("openresolv"),
+				forceMode("resolvconf")),
+			wantLog: "dns: [forced=resolvconf ret=openresolv]",
+			want:    "openresolv",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -288,6 +307,44 @@ func TestLinuxDNSMode(t *testing.T) {
 	}
 }
 
+func TestLinuxDNSModeForcedInvalid(t *testing.T) {
+	for _, mode := range []string{"bogus", "resolvconf"} {
+		var logBuf tstest.MemLogger
+		var info ModeInfo
+		e := env(forceMode(mode))
+		e.info = &info
+		got, err := dnsMode(logBuf.Logf, e)
+		if err == nil {
+			t.Errorf("dnsMode with forced mode %q = %q; want error", mode, got)
+		}
+		if info.Mode != "" || !info.Forced || len(info.Notes) != 1 || info.Notes[0] != "forced="+mode {
+			t.Errorf("ModeInfo for forced mode %q = %+v", mode, info)
+		}
+	}
+}
+
+func TestLinuxDNSModeInfo(t *testing.T) {
+	var logBuf tstest.MemLogger
+	var info ModeInfo
+	e := env(forceMode("direct"))
+	e.info = &info
+	if _, err := dnsMode(logBuf.Logf, e); err != nil {
+		t.Fatal(err)
+	}
+	want := ModeInfo{Mode: "direct", Forced: true, Notes: []string{"forced=direct", "ret=direct"}}
+	if !reflect.DeepEqual(info, want) {
+		t.Errorf("ModeInfo = %+v, want %+v", info, want)
+	}
+
+	m := &Manager{os: modeConfigurator{newDirectManagerOnFS(t.Logf, memFS{}), info}}
+	if got := m.OSConfiguratorMode(); !reflect.DeepEqual(got, want) {
+		t.Errorf("OSConfiguratorMode = %+v, want %+v", got, want)
+	}
+	if got := (&Manager{os: newDirectManagerOnFS(t.Logf, memFS{})}).OSConfiguratorMode(); !reflect.DeepEqual(got, ModeInfo{}) {
+		t.Errorf("OSConfiguratorMode of undetected configurator = %+v, want zero", got)
+	}
+}
+
 type memFS map[string]any // full path => string for regular files
 
 func (m memFS) Stat(name string) (isRegular bool, err error) {
@@ -349,6 +406,7 @@ type envBuilder struct {
 	nmUsingResolved bool
 	nmVersion       string
 	resolvconfStyle string
+	forceMode       string
 }
 
 type envOption interface {
@@ -401,9 +459,16 @@ func env(opts ...envOption) newOSConfigEnv {
 			return !outside, nil
 		},
 		resolvconfStyle: func() string { return b.resolvconfStyle },
+		forceMode:       b.forceMode,
 	}
 }
 
+func forceMode(mode string) envOption {
+	return envOpt(func(b *envBuilder) {
+		b.forceMode = mode
+	})
+}
+
 func resolvDotConf(ss ...string) envOption {
 	return envOpt(func(b *envBuilder) {
 		b.fs["/etc/resolv.conf"] = strings.Join(ss, "\n")
@@ -19,7 +19,7 @@ func (kv kv) String() string {
 	return fmt.Sprintf("%s=%s", kv.k, kv.v)
 }
 
-func NewOSConfigurator(logf logger.Logf, interfaceName string) (OSConfigurator, error) {
+func NewOSConfigurator(logf logger.Logf, interfaceName, _ string) (OSConfigurator, error) {
 	return newOSConfigurator(logf, interfaceName,
 		newOSConfigEnv{
 			rcIsResolvd: rcIsResolvd,
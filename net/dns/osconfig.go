@@ -14,6 +14,40 @@
 	"tailscale.com/util/dnsname"
 )
 
+// ModeInfo describes how NewOSConfigurator chose the kind of OSConfigurator
+// it returned.
+type ModeInfo struct {
+	// Mode is the kind of OSConfigurator, such as "systemd-resolved" or
+	// "direct". It's empty on platforms with only one kind.
+	Mode string
+
+	// Forced is whether Mode was passed to NewOSConfigurator rather than
+	// detected.
+	Forced bool
+
+	// Notes are the "key=value" observations made while choosing Mode, in
+	// the order they were made.
+	Notes []string
+}
+
+// IsValidMode reports whether mode is a DNS mode that NewOSConfigurator
+// accepts on Linux: a kind of OSConfigurator, or one of the "resolved",
+// "nm" and "resolvconf" shorthands.
+func IsValidMode(mode string) bool {
+	switch mode {
+	case "direct", "systemd-resolved", "network-manager", "debian-resolvconf", "openresolv",
+		"resolved", "nm", "resolvconf":
+		return true
+	}
+	return false
+}
+
+// modeReporter is implemented by the OSConfigurators returned by
+// NewOSConfigurator on platforms with more than one kind.
+type modeReporter interface {
+	modeInfo() ModeInfo
+}
+
 // An OSConfigurator applies DNS settings to the operating system.
 type OSConfigurator interface {
 	// SetDNS updates the OS's DNS configuration to match cfg.
@@ -0,0 +1,103 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package dns
+
+import (
+	"errors"
+	"time"
+
+	"tailscale.com/health"
+	"tailscale.com/util/clientmetric"
+)
+
+// osConfigChecker is implemented by OSConfigurators that can tell whether
+// the configuration they last set is still in effect.
+type osConfigChecker interface {
+	// osConfigIntact reports whether the OS DNS configuration still
+	// matches what was last passed to SetDNS. It reports true if no
+	// particular configuration is expected.
+	osConfigIntact() (bool, error)
+}
+
+const (
+	// osConfigCheckInterval is how often the Manager checks that the OS
+	// DNS configuration it installed hasn't been replaced by another
+	// program, such as a DHCP client or another VPN.
+	osConfigCheckInterval = 30 * time.Second
+
+	// osConfigRepairWindow and maxOSConfigRepairs bound how often the
+	// Manager reinstalls its configuration. If another program keeps
+	// replacing it, fighting over it just makes DNS flap, so the Manager
+	// gives up until the next Set.
+	osConfigRepairWindow = 10 * time.Minute
+	maxOSConfigRepairs   = 3
+)
+
+// runOSConfigMonitor periodically checks that the OS DNS configuration is
+// still the one m installed, and reinstalls it if not. It runs until m is
+// shut down.
+func (m *Manager) runOSConfigMonitor(checker osConfigChecker) {
+	t := time.NewTicker(osConfigCheckInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-t.C:
+			m.checkOSConfig(checker, time.Now())
+		}
+	}
+}
+
+// checkOSConfig checks once whether the OS DNS configuration is still the
+// one m installed, and reinstalls it if another program replaced it.
+func (m *Manager) checkOSConfig(checker osConfigChecker, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.osConfigSet || m.osRepairGaveUp {
+		return
+	}
+	ok, err := checker.osConfigIntact()
+	if err != nil {
+		m.logf("checking OS DNS config: %v", err)
+		return
+	}
+	if ok {
+		return
+	}
+	metricOSConfigClobbered.Add(1)
+
+	recent := m.osRepairs[:0]
+	for _, t := range m.osRepairs {
+		if now.Sub(t) < osConfigRepairWindow {
+			recent = append(recent, t)
+		}
+	}
+	m.osRepairs = recent
+	if len(m.osRepairs) >= maxOSConfigRepairs {
+		m.osRepairGaveUp = true
+		metricOSConfigRepairGaveUp.Add(1)
+		m.logf("OS DNS config was replaced by another program %d times in %v; no longer restoring it", len(m.osRepairs)+1, osConfigRepairWindow)
+		health.SetDNSOSHealth(errors.New("another program keeps replacing the DNS configuration that Tailscale installed"))
+		return
+	}
+
+	m.logf("OS DNS config was replaced by another program; restoring it")
+	m.osRepairs = append(m.osRepairs, now)
+	if err := m.os.SetDNS(m.osConfig); err != nil {
+		metricOSConfigRepairError.Add(1)
+		m.logf("restoring OS DNS config: %v", err)
+		health.SetDNSOSHealth(err)
+		return
+	}
+	metricOSConfigRepaired.Add(1)
+	health.SetDNSOSHealth(nil)
+}
+
+var (
+	metricOSConfigClobbered    = clientmetric.NewCounter("dns_os_config_clobbered")
+	metricOSConfigRepaired     = clientmetric.NewCounter("dns_os_config_repaired")
+	metricOSConfigRepairError  = clientmetric.NewCounter("dns_os_config_repair_error")
+	metricOSConfigRepairGaveUp = clientmetric.NewCounter("dns_os_config_repair_gave_up")
+)
@@ -0,0 +1,93 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package dns
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"tailscale.com/net/tsdial"
+)
+
+// clobberedOSConfigurator is a fakeOSConfigurator whose installed config
+// can be replaced behind its back.
+type clobberedOSConfigurator struct {
+	fakeOSConfigurator
+	clobbered bool
+	sets      int
+}
+
+func (c *clobberedOSConfigurator) SetDNS(cfg OSConfig) error {
+	c.sets++
+	c.clobbered = false
+	return c.fakeOSConfigurator.SetDNS(cfg)
+}
+
+func (c *clobberedOSConfigurator) osConfigIntact() (bool, error) {
+	return !c.clobbered, nil
+}
+
+func TestCheckOSConfig(t *testing.T) {
+	f := &clobberedOSConfigurator{}
+	m := NewManager(t.Logf, f, nil, new(tsdial.Dialer), nil, nil)
+	defer m.Down()
+
+	now := time.Now()
+	check := func() {
+		t.Helper()
+		now = now.Add(time.Minute)
+		m.checkOSConfig(f, now)
+	}
+
+	check()
+	if f.sets != 0 {
+		t.Fatalf("restored config before any was set")
+	}
+
+	cfg := Config{DefaultResolvers: mustRes("1.1.1.1")}
+	if err := m.Set(cfg); err != nil {
+		t.Fatal(err)
+	}
+	want := f.OSConfig
+	if len(want.Nameservers) == 0 || want.Nameservers[0] != netip.MustParseAddr("1.1.1.1") {
+		t.Fatalf("unexpected OS config %v", want)
+	}
+
+	check()
+	if f.sets != 1 {
+		t.Fatalf("sets = %d after check of intact config; want 1", f.sets)
+	}
+
+	f.clobbered = true
+	f.OSConfig = OSConfig{}
+	check()
+	if f.sets != 2 || f.clobbered || !f.OSConfig.Equal(want) {
+		t.Fatalf("clobbered config not restored: sets=%d, clobbered=%v, config=%v", f.sets, f.clobbered, f.OSConfig)
+	}
+
+	// After enough fights within osConfigRepairWindow, the Manager gives up.
+	for i := 1; i < maxOSConfigRepairs; i++ {
+		f.clobbered = true
+		check()
+	}
+	if f.sets != 1+maxOSConfigRepairs {
+		t.Fatalf("sets = %d; want %d", f.sets, 1+maxOSConfigRepairs)
+	}
+	f.clobbered = true
+	check()
+	if f.sets != 1+maxOSConfigRepairs || !f.clobbered {
+		t.Fatalf("config restored after giving up")
+	}
+
+	// A new Set starts over.
+	if err := m.Set(cfg); err != nil {
+		t.Fatal(err)
+	}
+	f.clobbered = true
+	check()
+	if f.clobbered {
+		t.Fatalf("clobbered config not restored after Set")
+	}
+}
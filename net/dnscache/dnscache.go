@@ -13,6 +13,7 @@
 	"errors"
 	"fmt"
 	"log"
+	"math/rand"
 	"net"
 	"net/netip"
 	"runtime"
@@ -74,10 +75,20 @@ type Resolver struct {
 	// If zero, a default (currently 10 minutes) is used.
 	TTL time.Duration
 
+	// TTLJitter, if non-zero, is the maximum random duration by which
+	// each entry's TTL is shortened, so that many clients that resolved a
+	// name at the same time, such as after a fleet-wide restart, don't all
+	// refresh it at once. It's capped to TTL.
+	TTLJitter time.Duration
+
 	// UseLastGood controls whether a cached entry older than TTL is used
 	// if a refresh fails.
 	UseLastGood bool
 
+	// MaxStaleness, if non-zero, is how long after expiring a cached entry
+	// may still be used with UseLastGood. Zero means no limit.
+	MaxStaleness time.Duration
+
 	// SingleHostStaticResult, if non-nil, is the static result of IPs that is returned
 	// by Resolver.LookupIP for any hostname. When non-nil, SingleHost must also be
 	// set with the expected name.
@@ -164,6 +175,16 @@ func (r *Resolver) ttl() time.Duration {
 	return 10 * time.Minute
 }
 
+// entryTTL returns the TTL of a new cache entry, which is ttl shortened by a
+// random duration of up to TTLJitter.
+func (r *Resolver) entryTTL() time.Duration {
+	ttl := r.ttl()
+	if jitter := min(r.TTLJitter, ttl); jitter > 0 {
+		ttl -= time.Duration(rand.Int63n(int64(jitter) + 1))
+	}
+	return ttl
+}
+
 var debug = envknob.RegisterBool("TS_DEBUG_DNS_CACHE")
 
 // debugLogging allows enabling debug logging at runtime, via
@@ -257,10 +278,15 @@ func (r *Resolver) lookupIPCache(host string) (ip, ip6 netip.Addr, allIPs []neti
 	return zaddr, zaddr, nil, false
 }
 
+// lookupIPCacheExpired is like lookupIPCache, but also returns expired
+// entries, unless they expired more than MaxStaleness ago.
 func (r *Resolver) lookupIPCacheExpired(host string) (ip, ip6 netip.Addr, allIPs []netip.Addr, ok bool) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	if ent, ok := r.ipCache[host]; ok {
+		if r.MaxStaleness > 0 && time.Since(ent.expires) > r.MaxStaleness {
+			return zaddr, zaddr, nil, false
+		}
 		return ent.ip, ent.ip6, ent.allIPs, true
 	}
 	return zaddr, zaddr, nil, false
@@ -336,7 +362,7 @@ func (r *Resolver) lookupIP(host string) (ip, ip6 netip.Addr, allIPs []netip.Add
 			}
 		}
 	}
-	r.addIPCache(host, ip, ip6, ips, r.ttl())
+	r.addIPCache(host, ip, ip6, ips, r.entryTTL())
 	return ip, ip6, ips, nil
 }
 
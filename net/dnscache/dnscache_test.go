@@ -143,6 +143,61 @@ func TestResolverAllHostStaticResult(t *testing.T) {
 	}
 }
 
+func TestEntryTTLJitter(t *testing.T) {
+	tests := []struct {
+		name     string
+		ttl      time.Duration
+		jitter   time.Duration
+		min, max time.Duration
+	}{
+		{"none", time.Hour, 0, time.Hour, time.Hour},
+		{"jitter", time.Hour, 10 * time.Minute, 50 * time.Minute, time.Hour},
+		{"capped", time.Minute, time.Hour, 0, time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Resolver{TTL: tt.ttl, TTLJitter: tt.jitter}
+			seen := map[time.Duration]bool{}
+			for i := 0; i < 100; i++ {
+				got := r.entryTTL()
+				if got < tt.min || got > tt.max {
+					t.Fatalf("entryTTL = %v, want in [%v, %v]", got, tt.min, tt.max)
+				}
+				seen[got] = true
+			}
+			if tt.jitter > 0 && len(seen) < 2 {
+				t.Errorf("entryTTL returned the same TTL 100 times")
+			}
+		})
+	}
+}
+
+func TestMaxStaleness(t *testing.T) {
+	ip := netip.MustParseAddr("8.8.8.8")
+	tests := []struct {
+		name         string
+		expiredAgo   time.Duration
+		maxStaleness time.Duration
+		want         bool
+	}{
+		{"unlimited", 24 * time.Hour, 0, true},
+		{"within-bound", time.Minute, time.Hour, true},
+		{"beyond-bound", 2 * time.Hour, time.Hour, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Resolver{UseLastGood: true, MaxStaleness: tt.maxStaleness}
+			r.addIPCache("foo.bar", ip, netip.Addr{}, []netip.Addr{ip}, -tt.expiredAgo)
+			if _, _, _, ok := r.lookupIPCache("foo.bar"); ok {
+				t.Fatal("expired entry returned as fresh")
+			}
+			if _, _, _, ok := r.lookupIPCacheExpired("foo.bar"); ok != tt.want {
+				t.Errorf("lookupIPCacheExpired ok = %v, want %v", ok, tt.want)
+			}
+		})
+	}
+}
+
 func TestShouldTryBootstrap(t *testing.T) {
 	tstest.Replace(t, &debug, func() bool { return true })
 
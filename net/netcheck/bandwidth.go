@@ -0,0 +1,178 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package netcheck
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"tailscale.com/derp/derphttp"
+	"tailscale.com/tailcfg"
+)
+
+const (
+	// bandwidthProbeBytes is the most data that a bandwidth probe
+	// transfers in each direction.
+	bandwidthProbeBytes = 8 << 20
+	// bandwidthProbeTimeout is the maximum amount of time a bandwidth
+	// probe spends in each direction. On slow links, the estimate is
+	// based on what was transferred by then.
+	bandwidthProbeTimeout = 3 * time.Second
+	// minBandwidthProbeBytes is the least data that must be transferred
+	// for a bandwidth estimate to be meaningful.
+	minBandwidthProbeBytes = 64 << 10
+)
+
+// measureBandwidth estimates the throughput to and from the preferred DERP
+// region of r, and records it in r. Failures are only logged, as DERP
+// servers don't serve bandwidth probes by default.
+func (c *Client) measureBandwidth(ctx context.Context, r *Report, dm *tailcfg.DERPMap) {
+	reg := dm.Regions[r.PreferredDERP]
+	if reg == nil {
+		return
+	}
+	down, err := c.measureRegionBandwidth(ctx, reg, measureDownload)
+	if err != nil {
+		c.logf("[v1] measuring download bandwidth from %v: %v", reg.RegionCode, err)
+		return
+	}
+	up, err := c.measureRegionBandwidth(ctx, reg, measureUpload)
+	if err != nil {
+		c.logf("[v1] measuring upload bandwidth to %v: %v", reg.RegionCode, err)
+		return
+	}
+	c.logf("[v1] bandwidth of %v: down=%d B/s up=%d B/s", reg.RegionCode, down, up)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r.BandwidthRegion = reg.RegionID
+	r.DownloadBandwidth = down
+	r.UploadBandwidth = up
+}
+
+// measureRegionBandwidth runs measure over a new TLS connection to a node of
+// reg, so that each direction is measured on a fresh connection.
+func (c *Client) measureRegionBandwidth(ctx context.Context, reg *tailcfg.DERPRegion, measure func(context.Context, *http.Client, string) (int64, error)) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, overallProbeTimeout)
+	defer cancel()
+
+	dc := derphttp.NewNetcheckClient(c.logf)
+	defer dc.Close()
+
+	tlsConn, tcpConn, node, err := dc.DialRegionTLS(ctx, reg)
+	if err != nil {
+		return 0, err
+	}
+	defer tcpConn.Close()
+
+	connc := make(chan *tls.Conn, 1)
+	connc <- tlsConn
+	hc := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return nil, errors.New("unexpected DialContext dial")
+		},
+		DialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			select {
+			case nc := <-connc:
+				return nc, nil
+			default:
+				return nil, errors.New("only one conn expected")
+			}
+		},
+	}}
+	return measure(ctx, hc, "https://"+node.HostName)
+}
+
+// measureDownload estimates the download throughput, in bytes per second,
+// from the DERP server at baseURL by fetching its bandwidth probe endpoint.
+func measureDownload(ctx context.Context, hc *http.Client, baseURL string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, bandwidthProbeTimeout)
+	defer cancel()
+	u := baseURL + derphttp.BandwidthProbePath + "?bytes=" + strconv.Itoa(bandwidthProbeBytes)
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return 0, err
+	}
+	res, err := hc.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected status %s", res.Status)
+	}
+	// Time the body alone, so that the round trip of the request
+	// doesn't count against the throughput.
+	t0 := time.Now()
+	n, err := io.Copy(io.Discard, res.Body)
+	return bandwidthEstimate(n, time.Since(t0), err)
+}
+
+// measureUpload estimates the upload throughput, in bytes per second, to the
+// DERP server at baseURL by posting to its bandwidth probe endpoint.
+func measureUpload(ctx context.Context, hc *http.Client, baseURL string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, bandwidthProbeTimeout)
+	defer cancel()
+	body := &countingReader{r: io.LimitReader(zeroReader{}, bandwidthProbeBytes)}
+	req, err := http.NewRequestWithContext(ctx, "POST", baseURL+derphttp.BandwidthProbePath, body)
+	if err != nil {
+		return 0, err
+	}
+	req.ContentLength = bandwidthProbeBytes
+	t0 := time.Now()
+	res, err := hc.Do(req)
+	d := time.Since(t0)
+	if err == nil {
+		res.Body.Close()
+		if res.StatusCode != http.StatusNoContent {
+			return 0, fmt.Errorf("unexpected status %s", res.Status)
+		}
+	}
+	return bandwidthEstimate(body.n.Load(), d, err)
+}
+
+// bandwidthEstimate returns the throughput, in bytes per second, of
+// transferring n bytes in d. The transfer may have been cut short by err, as
+// long as enough data was transferred for the estimate to be meaningful.
+func bandwidthEstimate(n int64, d time.Duration, err error) (int64, error) {
+	if n < minBandwidthProbeBytes {
+		if err == nil {
+			err = errors.New("probe too short")
+		}
+		return 0, fmt.Errorf("only %d bytes transferred: %w", n, err)
+	}
+	if d <= 0 {
+		d = time.Millisecond
+	}
+	return int64(float64(n) / d.Seconds()), nil
+}
+
+// countingReader is an io.Reader that counts the bytes read from r. The count
+// is atomic, as the HTTP transport may still be reading from it when a
+// request fails.
+type countingReader struct {
+	r io.Reader
+	n atomic.Int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n.Add(int64(n))
+	return n, err
+}
+
+// zeroReader is an io.Reader of infinite zero bytes.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
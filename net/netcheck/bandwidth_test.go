@@ -0,0 +1,74 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package netcheck
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tailscale.com/derp/derphttp"
+)
+
+func TestMeasureBandwidth(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(derphttp.BandwidthProbeHandler))
+	defer ts.Close()
+	ctx := context.Background()
+
+	down, err := measureDownload(ctx, ts.Client(), ts.URL)
+	if err != nil {
+		t.Fatalf("measureDownload: %v", err)
+	}
+	if down <= 0 {
+		t.Errorf("download bandwidth = %d, want > 0", down)
+	}
+	up, err := measureUpload(ctx, ts.Client(), ts.URL)
+	if err != nil {
+		t.Fatalf("measureUpload: %v", err)
+	}
+	if up <= 0 {
+		t.Errorf("upload bandwidth = %d, want > 0", up)
+	}
+
+	// DERP servers that don't serve bandwidth probes.
+	ts404 := httptest.NewServer(http.NotFoundHandler())
+	defer ts404.Close()
+	if _, err := measureDownload(ctx, ts404.Client(), ts404.URL); err == nil {
+		t.Error("measureDownload succeeded against server without probe handler")
+	}
+	if _, err := measureUpload(ctx, ts404.Client(), ts404.URL); err == nil {
+		t.Error("measureUpload succeeded against server without probe handler")
+	}
+}
+
+func TestBandwidthEstimate(t *testing.T) {
+	errCut := errors.New("cut short")
+	tests := []struct {
+		name    string
+		n       int64
+		d       time.Duration
+		err     error
+		want    int64
+		wantErr bool
+	}{
+		{"full", 8 << 20, 2 * time.Second, nil, 4 << 20, false},
+		{"cut-short", 1 << 20, 3 * time.Second, errCut, 1 << 20 / 3, false},
+		{"too-short", 1 << 10, time.Millisecond, nil, 0, true},
+		{"too-short-err", 1 << 10, time.Second, errCut, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := bandwidthEstimate(tt.n, tt.d, tt.err)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error: %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
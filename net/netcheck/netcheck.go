@@ -122,6 +122,15 @@ type Report struct {
 	// intercepting HTTP traffic.
 	CaptivePortal opt.Bool
 
+	// BandwidthRegion is the DERP region that DownloadBandwidth and
+	// UploadBandwidth were measured against, or 0 if bandwidth wasn't
+	// measured. See Client.ProbeBandwidth.
+	BandwidthRegion int
+	// DownloadBandwidth and UploadBandwidth are the estimated
+	// throughput, in bytes per second, from and to BandwidthRegion.
+	DownloadBandwidth int64
+	UploadBandwidth   int64
+
 	// TODO: update Clone when adding new fields
 }
 
@@ -198,6 +207,13 @@ type Client struct {
 	// If false, the default net.Resolver will be used, with no caching.
 	UseDNSCache bool
 
+	// ProbeBandwidth controls whether GetReport also estimates the upload
+	// and download bandwidth to the preferred DERP region, which transfers
+	// several megabytes in each direction. It only succeeds against DERP
+	// servers that serve bandwidth probes (see
+	// derphttp.BandwidthProbeHandler).
+	ProbeBandwidth bool
+
 	// For tests
 	testEnoughRegions      int
 	testCaptivePortalDelay time.Duration
@@ -653,6 +669,7 @@ func (rs *reportState) addNodeLatency(node *tailcfg.DERPNode, ipp netip.AddrPort
 
 	ret.UDP = true
 	updateLatency(ret.RegionLatency, node.RegionID, d)
+	metricDERPLatency.ObserveDuration(d)
 
 	// Once we've heard from enough regions (3), start a timer to
 	// give up on the other ones. The timer's duration is a
@@ -740,12 +757,16 @@ func newReport() *Report {
 //
 // It may not be called concurrently with itself.
 func (c *Client) GetReport(ctx context.Context, dm *tailcfg.DERPMap) (_ *Report, reterr error) {
+	start := time.Now()
 	defer func() {
 		if reterr != nil {
 			metricNumGetReportError.Add(1)
+		} else {
+			metricGetReportDuration.ObserveDuration(time.Since(start))
 		}
 	}()
 	metricNumGetReport.Add(1)
+	bwCtx := ctx // bandwidth probes aren't bound by overallProbeTimeout
 	// Mask user context with ours that we guarantee to cancel so
 	// we can depend on it being closed in goroutines later.
 	// (User ctx might be context.Background, etc)
@@ -1014,7 +1035,11 @@ func (c *Client) GetReport(ctx context.Context, dm *tailcfg.DERPMap) (_ *Report,
 	// Wait for captive portal check before finishing the report.
 	<-captivePortalDone
 
-	return c.finishAndStoreReport(rs, dm), nil
+	report := c.finishAndStoreReport(rs, dm)
+	if c.ProbeBandwidth {
+		c.measureBandwidth(bwCtx, report, dm)
+	}
+	return report, nil
 }
 
 func (c *Client) finishAndStoreReport(rs *reportState, dm *tailcfg.DERPMap) *Report {
@@ -1679,6 +1704,9 @@ func conciseOptBool(b opt.Bool, trueVal string) string {
 	metricNumGetReportFull  = clientmetric.NewCounter("netcheck_report_full")
 	metricNumGetReportError = clientmetric.NewCounter("netcheck_report_error")
 
+	metricGetReportDuration = clientmetric.NewHistogram("netcheck_report_duration_seconds", clientmetric.DurationBuckets)
+	metricDERPLatency       = clientmetric.NewHistogram("netcheck_derp_latency_seconds", clientmetric.DurationBuckets)
+
 	metricSTUNSend4 = clientmetric.NewCounter("netcheck_stun_send_ipv4")
 	metricSTUNSend6 = clientmetric.NewCounter("netcheck_stun_send_ipv6")
 	metricSTUNRecv4 = clientmetric.NewCounter("netcheck_stun_recv_ipv4")
@@ -111,6 +111,15 @@ type ChangeDelta struct {
 	// on *ChangeDelta to let callers ask specific questions
 }
 
+// DefaultRouteChanged reports whether the interface of the default route
+// changed.
+func (d *ChangeDelta) DefaultRouteChanged() bool {
+	if d.Old == nil {
+		return true
+	}
+	return d.Old.DefaultRouteInterface != d.New.DefaultRouteInterface
+}
+
 // New instantiates and starts a monitoring instance.
 // The returned monitor is inactive until it's started by the Start method.
 // Use RegisterChangeCallback to get notified of network changes.
@@ -0,0 +1,164 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package netmon
+
+import (
+	"sync"
+	"time"
+)
+
+// SubscribeOptions configures a Subscription.
+type SubscribeOptions struct {
+	// MajorOnly, if true, delivers only major changes (see
+	// ChangeDelta.Major), such as a change of default route.
+	MajorOnly bool
+
+	// Debounce, if positive, is how long the network must be quiet after a
+	// change before the change is delivered. Changes during that time are
+	// coalesced into one.
+	Debounce time.Duration
+
+	// MaxDelay, if positive, bounds how long Debounce can delay the
+	// delivery of a change while the network keeps changing.
+	MaxDelay time.Duration
+}
+
+// Subscription is a channel-based subscription to network changes,
+// returned by Monitor.Subscribe.
+//
+// Changes that arrive while the subscriber hasn't yet received the previous
+// one are coalesced into it, so a slow subscriber never blocks the Monitor
+// and always sees the latest state.
+type Subscription struct {
+	// C receives the network changes. It's closed by Close.
+	C <-chan *ChangeDelta
+
+	opts       SubscribeOptions
+	c          chan *ChangeDelta
+	wake       chan struct{} // buffered 1; there's a pending change
+	done       chan struct{} // closed on Close
+	unregister func()
+	closeOnce  sync.Once
+	exited     chan struct{} // closed when run returns
+
+	mu      sync.Mutex
+	pending *ChangeDelta // not yet delivered, or nil
+}
+
+// Subscribe returns a subscription to the network changes that m detects.
+// The caller must call Close on it when done.
+func (m *Monitor) Subscribe(opts SubscribeOptions) *Subscription {
+	c := make(chan *ChangeDelta, 1)
+	s := &Subscription{
+		C:      c,
+		opts:   opts,
+		c:      c,
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		exited: make(chan struct{}),
+	}
+	s.unregister = m.RegisterChangeCallback(s.add)
+	go s.run()
+	return s
+}
+
+// Close unsubscribes s and closes s.C.
+func (s *Subscription) Close() {
+	s.closeOnce.Do(func() {
+		s.unregister()
+		close(s.done)
+		<-s.exited
+	})
+}
+
+func (s *Subscription) add(d *ChangeDelta) {
+	if s.opts.MajorOnly && !d.Major {
+		return
+	}
+	s.mu.Lock()
+	s.pending = coalesceDeltas(s.pending, d)
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Subscription) run() {
+	defer close(s.exited)
+	defer close(s.c)
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.wake:
+		}
+		if !s.debounce() {
+			return
+		}
+
+		s.mu.Lock()
+		d := s.pending
+		s.pending = nil
+		s.mu.Unlock()
+		if d == nil {
+			continue
+		}
+		// Replace any change the subscriber hasn't received yet. This
+		// is the only sender, so after draining the send can't block.
+		select {
+		case old := <-s.c:
+			d = coalesceDeltas(old, d)
+		default:
+		}
+		s.c <- d
+	}
+}
+
+// debounce waits until there have been no new changes for
+// s.opts.Debounce, or until s.opts.MaxDelay passes. It reports false if s
+// was closed meanwhile.
+func (s *Subscription) debounce() bool {
+	if s.opts.Debounce <= 0 {
+		return true
+	}
+	var deadline <-chan time.Time
+	if s.opts.MaxDelay > 0 {
+		t := time.NewTimer(s.opts.MaxDelay)
+		defer t.Stop()
+		deadline = t.C
+	}
+	quiet := time.NewTimer(s.opts.Debounce)
+	defer quiet.Stop()
+	for {
+		select {
+		case <-s.done:
+			return false
+		case <-deadline:
+			return true
+		case <-quiet.C:
+			return true
+		case <-s.wake:
+			quiet.Reset(s.opts.Debounce)
+		}
+	}
+}
+
+// coalesceDeltas returns a ChangeDelta equivalent to the change a followed
+// by the change b. Either may be nil.
+func coalesceDeltas(a, b *ChangeDelta) *ChangeDelta {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	return &ChangeDelta{
+		Monitor:    b.Monitor,
+		Old:        a.Old,
+		New:        b.New,
+		Major:      a.Major || b.Major,
+		TimeJumped: a.TimeJumped || b.TimeJumped,
+	}
+}
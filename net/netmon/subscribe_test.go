@@ -0,0 +1,72 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package netmon
+
+import (
+	"testing"
+	"time"
+
+	"tailscale.com/net/interfaces"
+)
+
+func TestSubscribeInjectEvent(t *testing.T) {
+	mon, err := New(t.Logf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mon.Close()
+	sub := mon.Subscribe(SubscribeOptions{})
+	defer sub.Close()
+	mon.Start()
+	mon.InjectEvent()
+	select {
+	case d := <-sub.C:
+		if d.New == nil {
+			t.Error("delta without new state")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for change")
+	}
+}
+
+func TestSubscribeCoalesce(t *testing.T) {
+	mon, err := New(t.Logf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mon.Close()
+
+	st := func(defaultIf string) *interfaces.State {
+		return &interfaces.State{DefaultRouteInterface: defaultIf}
+	}
+	sub := mon.Subscribe(SubscribeOptions{MajorOnly: true, Debounce: 50 * time.Millisecond})
+	sub.add(&ChangeDelta{Old: st("eth0"), New: st("wlan0"), Major: true})
+	sub.add(&ChangeDelta{Old: st("wlan0"), New: st("wlan0")})
+	sub.add(&ChangeDelta{Old: st("wlan0"), New: st("eth1"), Major: true, TimeJumped: true})
+
+	select {
+	case d := <-sub.C:
+		if got, want := d.Old.DefaultRouteInterface, "eth0"; got != want {
+			t.Errorf("old default route = %q; want %q", got, want)
+		}
+		if got, want := d.New.DefaultRouteInterface, "eth1"; got != want {
+			t.Errorf("new default route = %q; want %q", got, want)
+		}
+		if !d.Major || !d.TimeJumped || !d.DefaultRouteChanged() {
+			t.Errorf("coalesced delta = %+v; want major, time jumped and default route changed", d)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for change")
+	}
+	select {
+	case d := <-sub.C:
+		t.Fatalf("unexpected second change: %+v", d)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	sub.Close()
+	if _, ok := <-sub.C; ok {
+		t.Error("C not closed after Close")
+	}
+}
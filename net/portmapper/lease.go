@@ -0,0 +1,131 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package portmapper
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	"tailscale.com/util/clientmetric"
+)
+
+// LeaseEventType is the type of a LeaseEvent.
+type LeaseEventType string
+
+const (
+	// LeaseAcquired is when a new mapping was created, with no valid one
+	// before it.
+	LeaseAcquired LeaseEventType = "acquired"
+	// LeaseRenewed is when a still valid mapping was renewed or replaced.
+	LeaseRenewed LeaseEventType = "renewed"
+	// LeaseAcquireFailed is when no mapping could be created.
+	LeaseAcquireFailed LeaseEventType = "acquire-failed"
+	// LeaseRenewFailed is when a mapping due for renewal couldn't be
+	// renewed. It remains in use until it expires.
+	LeaseRenewFailed LeaseEventType = "renew-failed"
+)
+
+// LeaseEvent describes an attempt by a Client to create or renew a port
+// mapping. See Client.SetLeaseEventFunc.
+type LeaseEvent struct {
+	Time time.Time
+	Type LeaseEventType
+
+	// Protocol is the protocol of the mapping: "pmp", "pcp" or "upnp".
+	// For LeaseRenewFailed, it's the protocol of the mapping that wasn't
+	// renewed; it's empty for LeaseAcquireFailed.
+	Protocol string
+
+	// External and GoodUntil are the external address and the expiry of
+	// the mapping, which for LeaseRenewFailed is the old mapping. They're
+	// zero for LeaseAcquireFailed.
+	External  netip.AddrPort
+	GoodUntil time.Time
+
+	// Err is the error of a failed attempt.
+	Err error
+}
+
+func (e LeaseEvent) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %s", e.Time.Format(time.TimeOnly), e.Type)
+	if e.Protocol != "" {
+		fmt.Fprintf(&sb, " proto=%s", e.Protocol)
+	}
+	if e.External.IsValid() {
+		fmt.Fprintf(&sb, " external=%v expires-in=%v", e.External, e.GoodUntil.Sub(e.Time).Round(time.Second))
+	}
+	if e.Err != nil {
+		fmt.Fprintf(&sb, " err=%v", e.Err)
+	}
+	return sb.String()
+}
+
+// SetLeaseEventFunc sets the func that's called after each attempt to create
+// or renew a port mapping that succeeded with a new mapping or failed. It
+// must be called before the client is used.
+func (c *Client) SetLeaseEventFunc(f func(LeaseEvent)) {
+	c.onLeaseEvent = f
+}
+
+// mappingProtocol returns the name of the protocol of m.
+func mappingProtocol(m mapping) string {
+	switch m.(type) {
+	case *pmpMapping:
+		return "pmp"
+	case *pcpMapping:
+		return "pcp"
+	case *upnpMapping:
+		return "upnp"
+	}
+	return "unknown"
+}
+
+// noteLeaseAttempt records the result of an attempt to create or renew a
+// mapping, given the mapping before (which may be nil) and after it, and the
+// attempt's error. An attempt that returned the existing mapping, as it
+// wasn't due for renewal, isn't recorded.
+func (c *Client) noteLeaseAttempt(prev, cur mapping, err error) {
+	now := time.Now()
+	if prev != nil && !now.Before(prev.GoodUntil()) {
+		prev = nil // expired; a new mapping is acquired, not renewed
+	}
+	var ev LeaseEvent
+	switch {
+	case err != nil && prev != nil:
+		ev = LeaseEvent{Type: LeaseRenewFailed, Protocol: mappingProtocol(prev), External: prev.External(), GoodUntil: prev.GoodUntil(), Err: err}
+	case err != nil:
+		ev = LeaseEvent{Type: LeaseAcquireFailed, Err: err}
+	case cur == nil || cur == prev:
+		return
+	case prev != nil:
+		ev = LeaseEvent{Type: LeaseRenewed, Protocol: mappingProtocol(cur), External: cur.External(), GoodUntil: cur.GoodUntil()}
+	default:
+		ev = LeaseEvent{Type: LeaseAcquired, Protocol: mappingProtocol(cur), External: cur.External(), GoodUntil: cur.GoodUntil()}
+	}
+	ev.Time = now
+	if m := leaseMetrics[[2]string{string(ev.Type), ev.Protocol}]; m != nil {
+		m.Add(1)
+	}
+	if c.onLeaseEvent != nil {
+		c.onLeaseEvent(ev)
+	}
+}
+
+// leaseMetrics are the metrics of lease events, keyed by event type and
+// protocol. Comparing the acquired and renewed counts of a protocol to its
+// renew-failed count gives its lease success rate.
+var leaseMetrics = map[[2]string]*clientmetric.Metric{}
+
+func init() {
+	for _, proto := range []string{"pmp", "pcp", "upnp"} {
+		for _, typ := range []LeaseEventType{LeaseAcquired, LeaseRenewed, LeaseRenewFailed} {
+			name := fmt.Sprintf("portmap_lease_%s_%s", proto, strings.ReplaceAll(string(typ), "-", "_"))
+			leaseMetrics[[2]string{string(typ), proto}] = clientmetric.NewCounter(name)
+		}
+	}
+	leaseMetrics[[2]string{string(LeaseAcquireFailed), ""}] = clientmetric.NewCounter("portmap_lease_acquire_failed")
+}
@@ -0,0 +1,83 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package portmapper
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestNoteLeaseAttempt(t *testing.T) {
+	var got []LeaseEvent
+	c := &Client{}
+	c.SetLeaseEventFunc(func(ev LeaseEvent) { got = append(got, ev) })
+
+	now := time.Now()
+	newPMP := func(port uint16, goodUntil time.Time) mapping {
+		return &pmpMapping{
+			external:  netip.AddrPortFrom(netip.MustParseAddr("203.0.113.1"), port),
+			goodUntil: goodUntil,
+		}
+	}
+	pmp1 := newPMP(1234, now.Add(time.Hour))
+	pmp2 := newPMP(1235, now.Add(2*time.Hour))
+	expired := newPMP(1233, now.Add(-time.Minute))
+	upnp := &upnpMapping{
+		external:  netip.AddrPortFrom(netip.MustParseAddr("203.0.113.1"), 4321),
+		goodUntil: now.Add(time.Hour),
+	}
+	errFail := errors.New("fail")
+
+	tests := []struct {
+		name      string
+		prev, cur mapping
+		err       error
+		wantType  LeaseEventType // or empty for no event
+		wantProto string
+	}{
+		{"acquired", nil, pmp1, nil, LeaseAcquired, "pmp"},
+		{"cached", pmp1, pmp1, nil, "", ""},
+		{"renewed", pmp1, pmp2, nil, LeaseRenewed, "pmp"},
+		{"renewed-other-proto", pmp1, upnp, nil, LeaseRenewed, "upnp"},
+		{"reacquired-after-expiry", expired, pmp1, nil, LeaseAcquired, "pmp"},
+		{"acquire-failed", nil, nil, errFail, LeaseAcquireFailed, ""},
+		{"acquire-failed-after-expiry", expired, expired, errFail, LeaseAcquireFailed, ""},
+		{"renew-failed", upnp, upnp, errFail, LeaseRenewFailed, "upnp"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = nil
+			m := leaseMetrics[[2]string{string(tt.wantType), tt.wantProto}]
+			var before int64
+			if m != nil {
+				before = m.Value()
+			}
+			c.noteLeaseAttempt(tt.prev, tt.cur, tt.err)
+			if tt.wantType == "" {
+				if len(got) != 0 {
+					t.Fatalf("got events %v, want none", got)
+				}
+				return
+			}
+			if len(got) != 1 {
+				t.Fatalf("got %d events, want 1", len(got))
+			}
+			ev := got[0]
+			if ev.Type != tt.wantType || ev.Protocol != tt.wantProto {
+				t.Errorf("got event %v, want type %q, protocol %q", ev, tt.wantType, tt.wantProto)
+			}
+			if !errors.Is(ev.Err, tt.err) {
+				t.Errorf("event error = %v, want %v", ev.Err, tt.err)
+			}
+			if m == nil {
+				t.Fatalf("no metric for %v", ev)
+			}
+			if d := m.Value() - before; d != 1 {
+				t.Errorf("metric %s increased by %d, want 1", m.Name(), d)
+			}
+		})
+	}
+}
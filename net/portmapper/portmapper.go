@@ -70,7 +70,8 @@ type Client struct {
 	netMon       *netmon.Monitor // optional; nil means interfaces will be looked up on-demand
 	controlKnobs *controlknobs.Knobs
 	ipAndGateway func() (gw, ip netip.Addr, ok bool)
-	onChange     func() // or nil
+	onChange     func()           // or nil
+	onLeaseEvent func(LeaseEvent) // or nil
 	debug        DebugKnobs
 	testPxPPort  uint16 // if non-zero, pxpPort to use for tests
 	testUPnPPort uint16 // if non-zero, uPnPPort to use for tests
@@ -419,7 +420,16 @@ func (c *Client) createMapping() {
 		c.runningCreate = false
 	}()
 
-	if _, err := c.createOrGetMapping(ctx); err == nil && c.onChange != nil {
+	c.mu.Lock()
+	prev := c.mapping
+	c.mu.Unlock()
+	_, err := c.createOrGetMapping(ctx)
+	c.mu.Lock()
+	cur := c.mapping
+	c.mu.Unlock()
+	c.noteLeaseAttempt(prev, cur, err)
+
+	if err == nil && c.onChange != nil {
 		go c.onChange()
 	} else if err != nil && !IsNoMappingError(err) {
 		c.logf("createOrGetMapping: %v", err)
@@ -314,3 +314,18 @@ func MapVia(siteID uint32, v4 netip.Prefix) (via netip.Prefix, err error) {
 	copy(a[12:], ip4a[:])
 	return netip.PrefixFrom(netip.AddrFrom16(a), v4.Bits()+64+32), nil
 }
+
+// ParseVia returns the site ID and IPv4 CIDR of a Tailscale "via" route, as
+// passed to MapVia. It returns an error if via isn't in the via range or is
+// shorter than a /96, which has no IPv4 part.
+func ParseVia(via netip.Prefix) (siteID uint32, v4 netip.Prefix, err error) {
+	if !IsViaPrefix(via) {
+		return 0, v4, errors.New("not a via route")
+	}
+	if via.Bits() < 96 {
+		return 0, v4, errors.New("short length, want /96 or more")
+	}
+	a := via.Addr().As16()
+	siteID = binary.BigEndian.Uint32(a[8:12])
+	return siteID, netip.PrefixFrom(netip.AddrFrom4([4]byte(a[12:16])), via.Bits()-96), nil
+}
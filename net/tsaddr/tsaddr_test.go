@@ -104,6 +104,43 @@ func BenchmarkTailscaleServiceAddr(b *testing.B) {
 	}
 }
 
+func TestMapVia(t *testing.T) {
+	tests := []struct {
+		siteID uint32
+		v4     string
+		want   string
+	}{
+		{0, "10.1.0.0/16", "fd7a:115c:a1e0:b1a::a01:0/112"},
+		{7, "10.1.0.0/16", "fd7a:115c:a1e0:b1a:0:7:a01:0/112"},
+		{0xff, "192.168.1.5/32", "fd7a:115c:a1e0:b1a:0:ff:c0a8:105/128"},
+		{1, "0.0.0.0/0", "fd7a:115c:a1e0:b1a:0:1::/96"},
+	}
+	for _, tt := range tests {
+		via, err := MapVia(tt.siteID, netip.MustParsePrefix(tt.v4))
+		if err != nil {
+			t.Fatalf("MapVia(%v, %v): %v", tt.siteID, tt.v4, err)
+		}
+		if via.String() != tt.want {
+			t.Errorf("MapVia(%v, %v) = %v; want %v", tt.siteID, tt.v4, via, tt.want)
+		}
+		siteID, v4, err := ParseVia(via)
+		if err != nil {
+			t.Fatalf("ParseVia(%v): %v", via, err)
+		}
+		if siteID != tt.siteID || v4.String() != tt.v4 {
+			t.Errorf("ParseVia(%v) = %v, %v; want %v, %v", via, siteID, v4, tt.siteID, tt.v4)
+		}
+	}
+	if _, err := MapVia(1, netip.MustParsePrefix("fd00::/8")); err == nil {
+		t.Error("MapVia of an IPv6 CIDR succeeded")
+	}
+	for _, s := range []string{"10.0.0.0/8", "fd00::/120", "fd7a:115c:a1e0:b1a::/64"} {
+		if _, _, err := ParseVia(netip.MustParsePrefix(s)); err == nil {
+			t.Errorf("ParseVia(%v) succeeded; want error", s)
+		}
+	}
+}
+
 func TestUnmapVia(t *testing.T) {
 	tests := []struct {
 		ip   string
@@ -38,6 +38,7 @@
 	"tailscale.com/util/set"
 	"tailscale.com/wgengine/capture"
 	"tailscale.com/wgengine/filter"
+	"tailscale.com/wgengine/shaper"
 	"tailscale.com/wgengine/wgcfg"
 )
 
@@ -148,6 +149,9 @@ type Wrapper struct {
 	filter atomic.Pointer[filter.Filter]
 	// filterFlags control the verbosity of logging packet drops/accepts.
 	filterFlags filter.RunFlags
+	// shaper atomically stores the bandwidth limits to enforce, or nil
+	// for none.
+	shaper atomic.Pointer[shaper.Shaper]
 
 	// PreFilterPacketInboundFromWireGuard is the inbound filter function that runs before the main filter
 	// and therefore sees the packets that may be later dropped by it.
@@ -736,6 +740,11 @@ func (t *Wrapper) filterPacketOutboundToWireGuard(p *packet.Parsed) filter.Respo
 		return filter.Drop
 	}
 
+	if sh := t.shaper.Load(); sh != nil && !sh.AllowOut(p) {
+		metricPacketOutDropRateLimit.Add(1)
+		return filter.DropSilently
+	}
+
 	if t.PostFilterPacketOutboundToWireGuard != nil {
 		if res := t.PostFilterPacketOutboundToWireGuard(p, t); res.IsDrop() {
 			return res
@@ -946,6 +955,11 @@ func (t *Wrapper) filterPacketInboundFromWireGuard(p *packet.Parsed, captHook ca
 		return filter.Drop
 	}
 
+	if sh := t.shaper.Load(); sh != nil && !sh.AllowIn(p) {
+		metricPacketInDropRateLimit.Add(1)
+		return filter.DropSilently
+	}
+
 	if t.PostFilterPacketInboundFromWireGaurd != nil {
 		if res := t.PostFilterPacketInboundFromWireGaurd(p, t); res.IsDrop() {
 			return res
@@ -1005,6 +1019,12 @@ func (t *Wrapper) SetFilter(filt *filter.Filter) {
 	t.filter.Store(filt)
 }
 
+// SetShaper sets the bandwidth limits to enforce on packets that pass the
+// filter. Nil means no limits.
+func (t *Wrapper) SetShaper(s *shaper.Shaper) {
+	t.shaper.Store(s)
+}
+
 // InjectInboundPacketBuffer makes the Wrapper device behave as if a packet
 // with the given contents was received from the network.
 // It takes ownership of one reference count on the packet. The injected
@@ -1159,11 +1179,13 @@ func (t *Wrapper) SetStatistics(stats *connstats.Statistics) {
 	metricPacketInDrop          = clientmetric.NewCounter("tstun_in_from_wg_drop")
 	metricPacketInDropFilter    = clientmetric.NewCounter("tstun_in_from_wg_drop_filter")
 	metricPacketInDropSelfDisco = clientmetric.NewCounter("tstun_in_from_wg_drop_self_disco")
+	metricPacketInDropRateLimit = clientmetric.NewCounter("tstun_in_from_wg_drop_rate_limit")
 
 	metricPacketOut              = clientmetric.NewCounter("tstun_out_to_wg")
 	metricPacketOutDrop          = clientmetric.NewCounter("tstun_out_to_wg_drop")
 	metricPacketOutDropFilter    = clientmetric.NewCounter("tstun_out_to_wg_drop_filter")
 	metricPacketOutDropSelfDisco = clientmetric.NewCounter("tstun_out_to_wg_drop_self_disco")
+	metricPacketOutDropRateLimit = clientmetric.NewCounter("tstun_out_to_wg_drop_rate_limit")
 )
 
 func (t *Wrapper) InstallCaptureHook(cb capture.Callback) {
@@ -0,0 +1,110 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+// Package posture collects device posture attributes, such as whether the
+// disk is encrypted, for the control server to use in access rules. They're
+// sent in Hostinfo.PostureAttributes.
+package posture
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	xmaps "golang.org/x/exp/maps"
+	"tailscale.com/hostinfo"
+	"tailscale.com/types/logger"
+)
+
+// Names of the posture attributes collected by this package. Attributes
+// registered by other programs should be named "custom:<name>".
+const (
+	// AttrOSVersion is the version of the operating system, as in
+	// Hostinfo.OSVersion.
+	AttrOSVersion = "node:osVersion"
+	// AttrDiskEncryption is "true" if the disk holding the operating
+	// system is encrypted, and "false" if not.
+	AttrDiskEncryption = "node:diskEncryption"
+	// AttrFirewall is "true" if the operating system's firewall is
+	// turned on, and "false" if not.
+	AttrFirewall = "node:firewall"
+	// AttrSerialNumber is the serial number of the device, as set by its
+	// manufacturer.
+	AttrSerialNumber = "node:serialNumber"
+)
+
+// A Collector returns the value of a posture attribute, or "" if it can't be
+// determined on this device.
+type Collector func(context.Context) (string, error)
+
+var (
+	mu         sync.Mutex
+	collectors = map[string]Collector{}
+)
+
+func init() {
+	Register(AttrOSVersion, func(context.Context) (string, error) {
+		return hostinfo.GetOSVersion(), nil
+	})
+}
+
+// Register registers c as the collector of the posture attribute attr,
+// replacing any previous one. It's meant to be called from init functions.
+func Register(attr string, c Collector) {
+	mu.Lock()
+	defer mu.Unlock()
+	collectors[attr] = c
+}
+
+// Collect runs the registered collectors and returns the attributes they
+// determined, or nil if there are none. Collectors that fail are logged
+// and their attributes left out.
+func Collect(ctx context.Context, logf logger.Logf) map[string]string {
+	mu.Lock()
+	cs := maps.Clone(collectors)
+	mu.Unlock()
+
+	attrs := xmaps.Keys(cs)
+	slices.Sort(attrs)
+	var ret map[string]string
+	for _, attr := range attrs {
+		v, err := cs[attr](ctx)
+		if err != nil {
+			logf("posture: collecting %s: %v", attr, err)
+			continue
+		}
+		if v == "" {
+			continue
+		}
+		if ret == nil {
+			ret = make(map[string]string)
+		}
+		ret[attr] = v
+	}
+	return ret
+}
+
+// placeholderSerials are the serial numbers, in lower case, that firmware
+// reports when the manufacturer didn't set one.
+var placeholderSerials = []string{
+	"0",
+	"0123456789",
+	"default string",
+	"none",
+	"not applicable",
+	"not specified",
+	"system serial number",
+	"to be filled by o.e.m.",
+}
+
+// cleanSerial returns the serial number s, as read from the firmware,
+// without surrounding white space and NULs, or "" if it's a placeholder.
+func cleanSerial(s string) string {
+	s = strings.Trim(s, " \t\r\n\x00")
+	if slices.Contains(placeholderSerials, strings.ToLower(s)) {
+		return ""
+	}
+	return s
+}
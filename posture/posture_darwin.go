@@ -0,0 +1,68 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !ios
+
+package posture
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+func init() {
+	Register(AttrDiskEncryption, fileVaultEnabled)
+	Register(AttrFirewall, appFirewallEnabled)
+	Register(AttrSerialNumber, darwinSerialNumber)
+}
+
+// fileVaultEnabled reports whether FileVault encrypts the startup disk.
+func fileVaultEnabled(ctx context.Context) (string, error) {
+	out, err := exec.CommandContext(ctx, "/usr/bin/fdesetup", "status").Output()
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case bytes.Contains(out, []byte("FileVault is On")):
+		return "true", nil
+	case bytes.Contains(out, []byte("FileVault is Off")):
+		return "false", nil
+	}
+	return "", fmt.Errorf("unexpected fdesetup output %q", out)
+}
+
+// appFirewallEnabled reports whether the macOS application firewall is on.
+func appFirewallEnabled(ctx context.Context) (string, error) {
+	out, err := exec.CommandContext(ctx, "/usr/libexec/ApplicationFirewall/socketfilterfw", "--getglobalstate").Output()
+	if err != nil {
+		return "", err
+	}
+	// "Firewall is enabled. (State = 1)", or 2 if it blocks everything.
+	switch {
+	case bytes.Contains(out, []byte("disabled")):
+		return "false", nil
+	case bytes.Contains(out, []byte("enabled")):
+		return "true", nil
+	}
+	return "", fmt.Errorf("unexpected socketfilterfw output %q", out)
+}
+
+// darwinSerialNumber returns the serial number of the Mac.
+func darwinSerialNumber(ctx context.Context) (string, error) {
+	out, err := exec.CommandContext(ctx, "/usr/sbin/ioreg", "-rd1", "-c", "IOPlatformExpertDevice").Output()
+	if err != nil {
+		return "", err
+	}
+	// The line looks like:
+	//     "IOPlatformSerialNumber" = "C02XXXXXXXXX"
+	for _, line := range strings.Split(string(out), "\n") {
+		_, v, ok := strings.Cut(line, `"IOPlatformSerialNumber" = `)
+		if ok {
+			return cleanSerial(strings.Trim(v, `"`)), nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,131 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package posture
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+	"tailscale.com/util/lineread"
+)
+
+func init() {
+	Register(AttrDiskEncryption, rootDiskEncrypted)
+	Register(AttrFirewall, ufwEnabled)
+	Register(AttrSerialNumber, linuxSerialNumber)
+}
+
+// rootDiskEncrypted reports whether the root file system is on a dm-crypt
+// device, such as a LUKS volume, or on a device built on one.
+func rootDiskEncrypted(context.Context) (string, error) {
+	var st unix.Stat_t
+	if err := unix.Stat("/", &st); err != nil {
+		return "", err
+	}
+	if unix.Major(st.Dev) == 0 {
+		// Not a block device, such as the overlay root of a container.
+		return "", nil
+	}
+	enc, err := blockDevEncrypted("/sys", fmt.Sprintf("%d:%d", unix.Major(st.Dev), unix.Minor(st.Dev)))
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatBool(enc), nil
+}
+
+// blockDevEncrypted reports whether the block device dev, as
+// "major:minor", is a dm-crypt device or is built on one, according to the
+// sysfs mounted at sysRoot.
+func blockDevEncrypted(sysRoot, dev string) (bool, error) {
+	dir, err := filepath.EvalSymlinks(filepath.Join(sysRoot, "dev", "block", dev))
+	if err != nil {
+		return false, err
+	}
+	return sysBlockDirEncrypted(dir, 0)
+}
+
+// sysBlockDirEncrypted is blockDevEncrypted for the sysfs directory dir of
+// a block device, which is depth devices above the one asked about.
+func sysBlockDirEncrypted(dir string, depth int) (bool, error) {
+	if depth > 8 {
+		return false, errors.New("block devices nested too deeply")
+	}
+	uuid, err := os.ReadFile(filepath.Join(dir, "dm", "uuid"))
+	if err == nil && bytes.HasPrefix(uuid, []byte("CRYPT-")) {
+		return true, nil
+	}
+	// Device mapper and md devices list the devices they're built on.
+	slaves, err := os.ReadDir(filepath.Join(dir, "slaves"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if len(slaves) == 0 {
+		return false, nil
+	}
+	for _, s := range slaves {
+		sdir, err := filepath.EvalSymlinks(filepath.Join(dir, "slaves", s.Name()))
+		if err != nil {
+			return false, err
+		}
+		enc, err := sysBlockDirEncrypted(sdir, depth+1)
+		if err != nil || !enc {
+			// Only count it as encrypted if all of it is.
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// ufwEnabled reports whether ufw, the firewall of Ubuntu and its
+// derivatives, is enabled. It returns "" if ufw isn't installed, as there's
+// no telling whether another firewall is in use.
+func ufwEnabled(context.Context) (string, error) {
+	return ufwConfEnabled("/etc/ufw/ufw.conf")
+}
+
+func ufwConfEnabled(path string) (string, error) {
+	enabled := ""
+	err := lineread.File(path, func(line []byte) error {
+		if v, ok := bytes.CutPrefix(bytes.TrimSpace(line), []byte("ENABLED=")); ok {
+			enabled = strconv.FormatBool(string(bytes.Trim(v, `"'`)) == "yes")
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return enabled, nil
+}
+
+// linuxSerialNumber returns the serial number that the firmware reports,
+// from DMI on PCs or the Devicetree on boards such as the Raspberry Pi.
+// The DMI serial number is only readable by root.
+func linuxSerialNumber(context.Context) (string, error) {
+	for _, path := range []string{
+		"/sys/class/dmi/id/product_serial",
+		"/sys/firmware/devicetree/base/serial-number",
+	} {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if s := cleanSerial(string(b)); s != "" {
+			return s, nil
+		}
+	}
+	return "", nil
+}
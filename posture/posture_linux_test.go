@@ -0,0 +1,102 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package posture
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBlockDevEncrypted(t *testing.T) {
+	sys := t.TempDir()
+	devs := filepath.Join(sys, "devices", "virtual", "block")
+	mkdev := func(name, dmUUID string, slaves ...string) {
+		t.Helper()
+		dir := filepath.Join(devs, name)
+		if err := os.MkdirAll(filepath.Join(dir, "slaves"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if dmUUID != "" {
+			if err := os.MkdirAll(filepath.Join(dir, "dm"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(dir, "dm", "uuid"), []byte(dmUUID+"\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, s := range slaves {
+			if err := os.Symlink(filepath.Join("..", "..", s), filepath.Join(dir, "slaves", s)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(sys, "dev", "block"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	link := func(dev, name string) {
+		t.Helper()
+		if err := os.Symlink(filepath.Join("..", "..", "devices", "virtual", "block", name), filepath.Join(sys, "dev", "block", dev)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// LVM on LUKS on sda2.
+	mkdev("sda2", "")
+	mkdev("dm-0", "CRYPT-LUKS2-0123-luks", "sda2")
+	mkdev("dm-1", "LVM-abcd", "dm-0")
+	link("253:1", "dm-1")
+	// LVM on a plain partition.
+	mkdev("sdb1", "")
+	mkdev("dm-2", "LVM-efgh", "sdb1")
+	link("253:2", "dm-2")
+	// RAID of an encrypted and a plain device.
+	mkdev("md0", "", "dm-0", "sdb1")
+	link("9:0", "md0")
+	link("8:17", "sdb1")
+
+	tests := []struct {
+		dev     string
+		want    bool
+		wantErr bool
+	}{
+		{"253:1", true, false},
+		{"253:2", false, false},
+		{"9:0", false, false},
+		{"8:17", false, false},
+		{"1:1", false, true},
+	}
+	for _, tt := range tests {
+		got, err := blockDevEncrypted(sys, tt.dev)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("blockDevEncrypted(%q) = %v, %v; want %v, err %v", tt.dev, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestUFWConfEnabled(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		conf string
+		want string
+	}{
+		{"# comment\nENABLED=yes\nLOGLEVEL=low\n", "true"},
+		{"ENABLED=no\n", "false"},
+		{"ENABLED=\"yes\"\n", "true"},
+		{"LOGLEVEL=low\n", ""},
+	}
+	for i, tt := range tests {
+		path := filepath.Join(dir, "ufw.conf")
+		if err := os.WriteFile(path, []byte(tt.conf), 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ufwConfEnabled(path)
+		if err != nil || got != tt.want {
+			t.Errorf("%d: ufwConfEnabled = %q, %v; want %q", i, got, err, tt.want)
+		}
+	}
+	if got, err := ufwConfEnabled(filepath.Join(dir, "missing")); got != "" || err != nil {
+		t.Errorf("ufwConfEnabled(missing) = %q, %v; want \"\", nil", got, err)
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package posture
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"testing"
+)
+
+func TestCollect(t *testing.T) {
+	old := collectors
+	t.Cleanup(func() { collectors = old })
+	collectors = map[string]Collector{}
+
+	if got := Collect(context.Background(), t.Logf); got != nil {
+		t.Errorf("Collect with no collectors = %v; want nil", got)
+	}
+
+	Register("custom:a", func(context.Context) (string, error) { return "1", nil })
+	Register("custom:b", func(context.Context) (string, error) { return "", nil })
+	Register("custom:c", func(context.Context) (string, error) { return "x", errors.New("boom") })
+	Register("custom:d", func(context.Context) (string, error) { return "2", nil })
+	Register("custom:d", func(context.Context) (string, error) { return "3", nil })
+	got := Collect(context.Background(), t.Logf)
+	want := map[string]string{"custom:a": "1", "custom:d": "3"}
+	if !maps.Equal(got, want) {
+		t.Errorf("Collect = %v; want %v", got, want)
+	}
+}
+
+func TestCleanSerial(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"C02XL0GHJGH5\n", "C02XL0GHJGH5"},
+		{"10000000a1b2c3d4\x00", "10000000a1b2c3d4"},
+		{"To Be Filled By O.E.M.\n", ""},
+		{"Default string", ""},
+		{" 0 ", ""},
+	}
+	for _, tt := range tests {
+		if got := cleanSerial(tt.in); got != tt.want {
+			t.Errorf("cleanSerial(%q) = %q; want %q", tt.in, got, tt.want)
+		}
+	}
+}
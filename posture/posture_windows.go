@@ -0,0 +1,53 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package posture
+
+import (
+	"context"
+	"errors"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+func init() {
+	Register(AttrFirewall, windowsFirewallEnabled)
+}
+
+// windowsFirewallProfiles are the network profiles of Windows Defender
+// Firewall, as named in the registry.
+var windowsFirewallProfiles = []string{"DomainProfile", "StandardProfile", "PublicProfile"}
+
+// windowsFirewallEnabled reports whether Windows Defender Firewall is on
+// for all network profiles. Group Policy settings take precedence over the
+// local ones, as they do for the firewall itself.
+func windowsFirewallEnabled(context.Context) (string, error) {
+	for _, profile := range windowsFirewallProfiles {
+		on, err := firewallProfileEnabled(`SOFTWARE\Policies\Microsoft\WindowsFirewall\` + profile)
+		if errors.Is(err, registry.ErrNotExist) {
+			on, err = firewallProfileEnabled(`SYSTEM\CurrentControlSet\Services\SharedAccess\Parameters\FirewallPolicy\` + profile)
+		}
+		if err != nil {
+			return "", err
+		}
+		if !on {
+			return "false", nil
+		}
+	}
+	return "true", nil
+}
+
+// firewallProfileEnabled returns the EnableFirewall value of the firewall
+// profile key path under HKLM.
+func firewallProfileEnabled(path string) (bool, error) {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, path, registry.QUERY_VALUE)
+	if err != nil {
+		return false, err
+	}
+	defer k.Close()
+	v, _, err := k.GetIntegerValue("EnableFirewall")
+	if err != nil {
+		return false, err
+	}
+	return v != 0, nil
+}
@@ -0,0 +1,619 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package safesocket
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// muxMagic is sent by clients at the start of a connection to multiplex
+// streams over it. It can't be mistaken for the start of an HTTP request.
+const muxMagic = "TSMUX/1\n"
+
+// Mux frame types. Each frame has a header of a 1 byte type, a 4 byte
+// stream ID and a 4 byte length, all big-endian.
+const (
+	muxFrameOpen   = 1 // opens a stream; no payload
+	muxFrameData   = 2 // length bytes of payload for the stream
+	muxFrameWindow = 3 // the peer may send length more bytes; no payload
+	muxFrameClose  = 4 // the sender closed the stream; no payload
+)
+
+const (
+	muxHeaderLen = 9
+	muxMaxFrame  = 32 << 10 // max payload of a data frame
+
+	// muxWindow is how many bytes of a stream may be in flight or buffered
+	// unread at a time, so that a stream whose reader is slow doesn't block
+	// the others.
+	muxWindow = 256 << 10
+)
+
+// muxPeekTimeout is how long MuxListener waits for the first bytes of a new
+// connection to tell whether it's multiplexed.
+const muxPeekTimeout = 10 * time.Second
+
+var errMuxProtocol = errors.New("safesocket: mux protocol error")
+
+// MuxSession multiplexes many logical streams, each a net.Conn, over a
+// single connection to tailscaled. This lets a GUI hold one connection for
+// all its LocalAPI requests, such as watching the IPN bus or streaming logs,
+// instead of opening one for each.
+//
+// Streams are opened by the client with Open and accepted by the server with
+// Accept, so a server-side MuxSession can be used as a net.Listener.
+type MuxSession struct {
+	conn   net.Conn
+	r      io.Reader
+	closed chan struct{} // closed by close
+
+	wmu sync.Mutex // serializes frame writes to conn
+
+	mu      sync.Mutex
+	streams map[uint32]*muxStream
+	nextID  uint32
+	err     error // why the session closed
+	acceptc chan *muxStream
+}
+
+// ConnectMux connects to tailscaled using s, like Connect, and returns a
+// session to open multiplexed streams over the connection. The listener
+// must have been wrapped by MuxListener.
+func ConnectMux(s *ConnectionStrategy) (*MuxSession, error) {
+	c, err := Connect(s)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(c, muxMagic); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return newMuxSession(c, c, true), nil
+}
+
+// newMuxSession starts a session over conn, reading from r, which is conn
+// or a reader of conn's unread data. Streams opened by clients have odd IDs,
+// those opened by servers even IDs.
+func newMuxSession(conn net.Conn, r io.Reader, client bool) *MuxSession {
+	s := &MuxSession{
+		conn:    conn,
+		r:       r,
+		closed:  make(chan struct{}),
+		streams: make(map[uint32]*muxStream),
+		nextID:  2,
+		acceptc: make(chan *muxStream, 16),
+	}
+	if client {
+		s.nextID = 1
+	}
+	go s.readLoop()
+	return s
+}
+
+// Open opens a new stream.
+func (s *MuxSession) Open() (net.Conn, error) {
+	s.mu.Lock()
+	if s.err != nil {
+		s.mu.Unlock()
+		return nil, s.err
+	}
+	st := s.newStreamLocked(s.nextID)
+	s.nextID += 2
+	s.mu.Unlock()
+	if err := s.writeFrame(muxFrameOpen, st.id, 0, nil); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// Accept waits for and returns the next stream opened by the peer.
+func (s *MuxSession) Accept() (net.Conn, error) {
+	select {
+	case st := <-s.acceptc:
+		return st, nil
+	case <-s.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close closes the session, its underlying connection and all its streams.
+func (s *MuxSession) Close() error {
+	s.close(net.ErrClosed)
+	return nil
+}
+
+// Addr returns the local address of the underlying connection.
+func (s *MuxSession) Addr() net.Addr { return s.conn.LocalAddr() }
+
+// Done returns a channel that's closed when the session is closed, such as
+// when the underlying connection fails.
+func (s *MuxSession) Done() <-chan struct{} { return s.closed }
+
+func (s *MuxSession) close(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return
+	}
+	s.err = err
+	close(s.closed)
+	s.conn.Close()
+	for _, st := range s.streams {
+		st.wake()
+	}
+	s.streams = nil
+}
+
+func (s *MuxSession) newStreamLocked(id uint32) *muxStream {
+	st := &muxStream{
+		s:          s,
+		id:         id,
+		sendWindow: muxWindow,
+		readc:      make(chan struct{}, 1),
+		writec:     make(chan struct{}, 1),
+	}
+	s.streams[id] = st
+	return st
+}
+
+func (s *MuxSession) writeFrame(typ byte, id, length uint32, payload []byte) error {
+	var hdr [muxHeaderLen]byte
+	hdr[0] = typ
+	binary.BigEndian.PutUint32(hdr[1:], id)
+	binary.BigEndian.PutUint32(hdr[5:], length)
+
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	select {
+	case <-s.closed:
+		return net.ErrClosed
+	default:
+	}
+	_, err := s.conn.Write(hdr[:])
+	if err == nil && len(payload) > 0 {
+		_, err = s.conn.Write(payload)
+	}
+	if err != nil {
+		s.close(err)
+	}
+	return err
+}
+
+func (s *MuxSession) readLoop() {
+	var hdr [muxHeaderLen]byte
+	for {
+		if _, err := io.ReadFull(s.r, hdr[:]); err != nil {
+			s.close(err)
+			return
+		}
+		typ := hdr[0]
+		id := binary.BigEndian.Uint32(hdr[1:])
+		length := binary.BigEndian.Uint32(hdr[5:])
+		if err := s.handleFrame(typ, id, length); err != nil {
+			s.close(err)
+			return
+		}
+	}
+}
+
+func (s *MuxSession) handleFrame(typ byte, id, length uint32) error {
+	s.mu.Lock()
+	st := s.streams[id]
+	s.mu.Unlock()
+
+	switch typ {
+	case muxFrameOpen:
+		s.mu.Lock()
+		if st != nil || s.err != nil {
+			s.mu.Unlock()
+			return errMuxProtocol
+		}
+		st = s.newStreamLocked(id)
+		s.mu.Unlock()
+		select {
+		case s.acceptc <- st:
+		case <-s.closed:
+		}
+		return nil
+	case muxFrameData:
+		if length > muxMaxFrame {
+			return errMuxProtocol
+		}
+		buf := make([]byte, length)
+		if _, err := io.ReadFull(s.r, buf); err != nil {
+			return err
+		}
+		if st == nil {
+			// Closed locally; drop.
+			return nil
+		}
+		return st.received(buf)
+	case muxFrameWindow:
+		if st != nil {
+			st.mu.Lock()
+			st.sendWindow += int(length)
+			st.mu.Unlock()
+			st.wake()
+		}
+		return nil
+	case muxFrameClose:
+		if st != nil {
+			st.mu.Lock()
+			st.remoteClosed = true
+			forget := st.localClosed
+			st.mu.Unlock()
+			st.wake()
+			if forget {
+				s.forget(id)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: unknown frame type %d", errMuxProtocol, typ)
+}
+
+func (s *MuxSession) forget(id uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.streams, id)
+}
+
+// muxStream is a stream of a MuxSession.
+type muxStream struct {
+	s  *MuxSession
+	id uint32
+
+	// readc and writec are signaled when a blocked Read or Write may be
+	// able to make progress.
+	readc, writec chan struct{}
+
+	mu            sync.Mutex
+	buf           []byte // received, unread data
+	unacked       int    // bytes read but not yet returned to the peer's window
+	sendWindow    int    // bytes we may still send
+	localClosed   bool
+	remoteClosed  bool
+	readDeadline  time.Time
+	writeDeadline time.Time
+}
+
+func (st *muxStream) wake() {
+	for _, c := range []chan struct{}{st.readc, st.writec} {
+		select {
+		case c <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (st *muxStream) received(b []byte) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.localClosed {
+		return nil
+	}
+	if len(st.buf)+st.unacked+len(b) > muxWindow {
+		return fmt.Errorf("%w: stream %d exceeded its window", errMuxProtocol, st.id)
+	}
+	st.buf = append(st.buf, b...)
+	st.wake()
+	return nil
+}
+
+// wait waits until c is signaled, the deadline passes or the session
+// closes.
+func (st *muxStream) wait(c chan struct{}, deadline time.Time) error {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		d := time.Until(deadline)
+		if d <= 0 {
+			return os.ErrDeadlineExceeded
+		}
+		t := time.NewTimer(d)
+		defer t.Stop()
+		timeout = t.C
+	}
+	select {
+	case <-c:
+		return nil
+	case <-timeout:
+		return os.ErrDeadlineExceeded
+	case <-st.s.closed:
+		return nil
+	}
+}
+
+func (st *muxStream) sessionErr() error {
+	st.s.mu.Lock()
+	defer st.s.mu.Unlock()
+	return st.s.err
+}
+
+func (st *muxStream) Read(b []byte) (int, error) {
+	for {
+		st.mu.Lock()
+		if st.localClosed {
+			st.mu.Unlock()
+			return 0, net.ErrClosed
+		}
+		if len(st.buf) > 0 {
+			n := copy(b, st.buf)
+			st.buf = st.buf[n:]
+			st.unacked += n
+			var ack int
+			if st.unacked >= muxWindow/2 || len(st.buf) == 0 {
+				ack, st.unacked = st.unacked, 0
+			}
+			st.mu.Unlock()
+			if ack > 0 && !st.remoteDone() {
+				st.s.writeFrame(muxFrameWindow, st.id, uint32(ack), nil)
+			}
+			return n, nil
+		}
+		if st.remoteClosed {
+			st.mu.Unlock()
+			return 0, io.EOF
+		}
+		deadline := st.readDeadline
+		st.mu.Unlock()
+		if err := st.sessionErr(); err != nil {
+			return 0, io.ErrUnexpectedEOF
+		}
+		if err := st.wait(st.readc, deadline); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (st *muxStream) remoteDone() bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.remoteClosed
+}
+
+func (st *muxStream) Write(b []byte) (n int, err error) {
+	for len(b) > 0 {
+		st.mu.Lock()
+		if st.localClosed {
+			st.mu.Unlock()
+			return n, net.ErrClosed
+		}
+		if st.remoteClosed {
+			st.mu.Unlock()
+			return n, io.ErrClosedPipe
+		}
+		chunk := min(len(b), st.sendWindow, muxMaxFrame)
+		st.sendWindow -= chunk
+		deadline := st.writeDeadline
+		st.mu.Unlock()
+		if err := st.sessionErr(); err != nil {
+			return n, err
+		}
+		if chunk == 0 {
+			if err := st.wait(st.writec, deadline); err != nil {
+				return n, err
+			}
+			continue
+		}
+		if err := st.s.writeFrame(muxFrameData, st.id, uint32(chunk), b[:chunk]); err != nil {
+			return n, err
+		}
+		n += chunk
+		b = b[chunk:]
+	}
+	return n, nil
+}
+
+// Close closes the stream. Data already written is still delivered to the
+// peer, which reads EOF after it.
+func (st *muxStream) Close() error {
+	st.mu.Lock()
+	if st.localClosed {
+		st.mu.Unlock()
+		return net.ErrClosed
+	}
+	st.localClosed = true
+	st.buf = nil
+	forget := st.remoteClosed
+	st.mu.Unlock()
+	st.wake()
+	if forget {
+		st.s.forget(st.id)
+	}
+	if err := st.s.writeFrame(muxFrameClose, st.id, 0, nil); err != nil && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+	return nil
+}
+
+func (st *muxStream) LocalAddr() net.Addr  { return st.s.conn.LocalAddr() }
+func (st *muxStream) RemoteAddr() net.Addr { return st.s.conn.RemoteAddr() }
+
+func (st *muxStream) SetDeadline(t time.Time) error {
+	st.mu.Lock()
+	st.readDeadline, st.writeDeadline = t, t
+	st.mu.Unlock()
+	st.wake()
+	return nil
+}
+
+func (st *muxStream) SetReadDeadline(t time.Time) error {
+	st.mu.Lock()
+	st.readDeadline = t
+	st.mu.Unlock()
+	st.wake()
+	return nil
+}
+
+func (st *muxStream) SetWriteDeadline(t time.Time) error {
+	st.mu.Lock()
+	st.writeDeadline = t
+	st.mu.Unlock()
+	st.wake()
+	return nil
+}
+
+// UnderlyingConn returns the connection that carries the stream.
+func (st *muxStream) UnderlyingConn() net.Conn { return st.s.conn }
+
+// UnderlyingConn returns the connection accepted from a Listen listener that
+// c is carried over, if c was accepted from a MuxListener. Otherwise it
+// returns c. Use it to get the peer credentials of c.
+func UnderlyingConn(c net.Conn) net.Conn {
+	if u, ok := c.(interface{ UnderlyingConn() net.Conn }); ok {
+		return u.UnderlyingConn()
+	}
+	return c
+}
+
+// MuxListener wraps ln so that its clients can multiplex many streams over
+// a single connection with ConnectMux. Connections from clients that don't
+// are accepted as before.
+//
+// Connections accepted from the returned listener may not be of the type
+// accepted from ln; use UnderlyingConn to get those.
+func MuxListener(ln net.Listener) net.Listener {
+	ml := &muxListener{
+		Listener: ln,
+		connc:    make(chan net.Conn),
+		errc:     make(chan error),
+		closed:   make(chan struct{}),
+	}
+	go ml.acceptLoop()
+	return ml
+}
+
+type muxListener struct {
+	net.Listener
+	connc     chan net.Conn
+	errc      chan error // temporary errors from the underlying Accept
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	mu       sync.Mutex
+	err      error         // returned by Accept once closed
+	sessions []*MuxSession // open sessions, closed with the listener
+}
+
+func (ml *muxListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-ml.connc:
+		return c, nil
+	case err := <-ml.errc:
+		return nil, err
+	case <-ml.closed:
+		ml.mu.Lock()
+		defer ml.mu.Unlock()
+		return nil, ml.err
+	}
+}
+
+func (ml *muxListener) Close() error {
+	err := ml.Listener.Close()
+	ml.shutdown(net.ErrClosed)
+	return err
+}
+
+func (ml *muxListener) shutdown(err error) {
+	ml.closeOnce.Do(func() {
+		ml.mu.Lock()
+		ml.err = err
+		sessions := ml.sessions
+		ml.sessions = nil
+		ml.mu.Unlock()
+		close(ml.closed)
+		for _, s := range sessions {
+			s.Close()
+		}
+	})
+}
+
+func (ml *muxListener) acceptLoop() {
+	for {
+		c, err := ml.Listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			ml.shutdown(err)
+			return
+		}
+		if err != nil {
+			select {
+			case ml.errc <- err:
+				continue
+			case <-ml.closed:
+				return
+			}
+		}
+		go ml.handle(c)
+	}
+}
+
+func (ml *muxListener) deliver(c net.Conn) {
+	select {
+	case ml.connc <- c:
+	case <-ml.closed:
+		c.Close()
+	}
+}
+
+// handle peeks at the start of c to tell whether it's multiplexed, and
+// delivers c or its streams to Accept.
+func (ml *muxListener) handle(c net.Conn) {
+	br := bufio.NewReader(c)
+	c.SetReadDeadline(time.Now().Add(muxPeekTimeout))
+	magic, err := br.Peek(len(muxMagic))
+	c.SetReadDeadline(time.Time{})
+	if err != nil && br.Buffered() == 0 {
+		c.Close()
+		return
+	}
+	if string(magic) != muxMagic {
+		ml.deliver(&peekedConn{Conn: c, r: br})
+		return
+	}
+	br.Discard(len(muxMagic))
+	s := newMuxSession(c, br, false)
+	ml.mu.Lock()
+	if ml.err != nil {
+		ml.mu.Unlock()
+		s.Close()
+		return
+	}
+	ml.sessions = append(ml.sessions, s)
+	ml.mu.Unlock()
+	defer func() {
+		ml.mu.Lock()
+		defer ml.mu.Unlock()
+		for i, s2 := range ml.sessions {
+			if s2 == s {
+				ml.sessions = append(ml.sessions[:i], ml.sessions[i+1:]...)
+				break
+			}
+		}
+	}()
+	for {
+		st, err := s.Accept()
+		if err != nil {
+			return
+		}
+		ml.deliver(st)
+	}
+}
+
+// peekedConn is a net.Conn whose first bytes were read into r.
+type peekedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *peekedConn) Read(b []byte) (int, error) { return c.r.Read(b) }
+
+func (c *peekedConn) UnderlyingConn() net.Conn { return c.Conn }
@@ -0,0 +1,210 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package safesocket
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMuxListener(t *testing.T) {
+	dir := t.TempDir()
+	var sock string
+	if runtime.GOOS != "windows" {
+		sock = filepath.Join(dir, "test")
+	} else {
+		sock = fmt.Sprintf(`\\.\pipe\tailscale-test-mux`)
+		t.Cleanup(downgradeSDDL())
+	}
+	ln, err := Listen(sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ml := MuxListener(ln)
+
+	var (
+		mu          sync.Mutex
+		underlyings = map[string]bool{} // types of UnderlyingConn
+	)
+	big := bytes.Repeat([]byte("x"), 3*muxWindow)
+	hs := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/big" {
+				w.Write(big)
+				return
+			}
+			body, _ := io.ReadAll(r.Body)
+			fmt.Fprintf(w, "%s %d", r.URL.Path, len(body))
+		}),
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			u := UnderlyingConn(c)
+			mu.Lock()
+			defer mu.Unlock()
+			underlyings[fmt.Sprintf("%T", u)] = true
+			return ctx
+		},
+	}
+	go hs.Serve(ml)
+	t.Cleanup(func() { hs.Close() })
+
+	s, err := ConnectMux(DefaultConnectionStrategy(sock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	muxClient := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return s.Open()
+		},
+		DisableKeepAlives: true,
+	}}
+	plainClient := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return Connect(DefaultConnectionStrategy(sock))
+		},
+		DisableKeepAlives: true,
+	}}
+
+	var wg sync.WaitGroup
+	errc := make(chan error, 20)
+	for i := 0; i < 10; i++ {
+		for _, hc := range []*http.Client{muxClient, plainClient} {
+			wg.Add(1)
+			go func(i int, hc *http.Client) {
+				defer wg.Done()
+				body := bytes.Repeat([]byte("y"), i*muxMaxFrame)
+				res, err := hc.Post(fmt.Sprintf("http://local/%d", i), "", bytes.NewReader(body))
+				if err != nil {
+					errc <- err
+					return
+				}
+				defer res.Body.Close()
+				got, err := io.ReadAll(res.Body)
+				if err != nil {
+					errc <- err
+					return
+				}
+				if want := fmt.Sprintf("/%d %d", i, len(body)); string(got) != want {
+					errc <- fmt.Errorf("got %q, want %q", got, want)
+				}
+			}(i, hc)
+		}
+	}
+	wg.Wait()
+	close(errc)
+	for err := range errc {
+		t.Error(err)
+	}
+
+	res, err := muxClient.Get("http://local/big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, big) {
+		t.Errorf("got %d bytes, want %d", len(got), len(big))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for typ := range underlyings {
+		if typ == "*safesocket.muxStream" || typ == "*safesocket.peekedConn" {
+			t.Errorf("UnderlyingConn returned a wrapper: %v", typ)
+		}
+	}
+}
+
+func TestMuxSlowStream(t *testing.T) {
+	c1, c2 := net.Pipe()
+	client := newMuxSession(c1, c1, true)
+	server := newMuxSession(c2, c2, false)
+	defer client.Close()
+	defer server.Close()
+
+	slow, err := client.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fast, err := client.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	slowSrv, err := server.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fastSrv, err := server.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Writes to the slow stream block once its window is used up, while
+	// nothing reads it.
+	slowDone := make(chan error, 1)
+	go func() {
+		_, err := slowSrv.Write(make([]byte, 2*muxWindow))
+		slowDone <- err
+	}()
+
+	// The fast stream isn't blocked by it.
+	go fastSrv.Write([]byte("hello"))
+	fast.SetReadDeadline(time.Now().Add(5 * time.Second))
+	b := make([]byte, 5)
+	if _, err := io.ReadFull(fast, b); err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "hello" {
+		t.Errorf("got %q, want hello", b)
+	}
+	select {
+	case err := <-slowDone:
+		t.Fatalf("write to slow stream finished early: %v", err)
+	default:
+	}
+
+	// Reading the slow stream lets the write finish.
+	if n, err := io.ReadFull(slow, make([]byte, 2*muxWindow)); err != nil {
+		t.Fatalf("read %d: %v", n, err)
+	}
+	if err := <-slowDone; err != nil {
+		t.Fatal(err)
+	}
+
+	// Closing a stream delivers EOF after the data written before it.
+	go func() {
+		fastSrv.Write([]byte("bye"))
+		fastSrv.Close()
+	}()
+	got, err := io.ReadAll(fast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "bye" {
+		t.Errorf("got %q, want bye", got)
+	}
+
+	// Deadlines apply to blocked reads.
+	slow.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	if _, err := slow.Read(b); !isTimeout(err) {
+		t.Errorf("read past deadline: %v, want timeout", err)
+	}
+}
+
+func isTimeout(err error) bool {
+	ne, ok := err.(net.Error)
+	return ok && ne.Timeout()
+}
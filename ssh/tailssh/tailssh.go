@@ -33,6 +33,7 @@
 
 	gossh "github.com/tailscale/golang-x-crypto/ssh"
 	"tailscale.com/envknob"
+	"tailscale.com/ipn"
 	"tailscale.com/ipn/ipnlocal"
 	"tailscale.com/logtail/backoff"
 	"tailscale.com/net/tsaddr"
@@ -69,6 +70,7 @@ type ipnLocalBackend interface {
 	Dialer() *tsdial.Dialer
 	TailscaleVarRoot() string
 	NodeKey() key.NodePublic
+	NoteSSHSession(ipn.SSHSession)
 }
 
 type server struct {
@@ -1110,6 +1112,9 @@ func (ss *sshSession) run() {
 	}
 	go ss.killProcessOnContextDone()
 
+	audit := ss.auditSession()
+	ss.conn.srv.lb.NoteSSHSession(audit)
+
 	var processDone atomic.Bool
 	go func() {
 		defer ss.wrStdin.Close()
@@ -1172,21 +1177,40 @@ func (ss *sshSession) run() {
 	case <-ss.ctx.Done():
 	}
 
+	var code int
 	if err == nil {
 		ss.logf("Session complete")
-		ss.Exit(0)
-		return
-	}
-	if ee, ok := err.(*exec.ExitError); ok {
-		code := ee.ProcessState.ExitCode()
+	} else if ee, ok := err.(*exec.ExitError); ok {
+		code = ee.ProcessState.ExitCode()
 		ss.logf("Wait: code=%v", code)
-		ss.Exit(code)
-		return
+	} else {
+		ss.logf("Wait: %v", err)
+		code = 1
+	}
+	audit.End = ss.conn.srv.now()
+	audit.ExitCode = code
+	ss.conn.srv.lb.NoteSSHSession(audit)
+	ss.Exit(code)
+}
+
+// auditSession returns the description of ss for the IPN bus, as of the
+// start of its process.
+func (ss *sshSession) auditSession() ipn.SSHSession {
+	ci := ss.conn.info
+	cmd := ss.RawCommand()
+	if ss.Subsystem() == "sftp" {
+		cmd = "sftp"
+	}
+	return ipn.SSHSession{
+		ID:        ss.sharedID,
+		Src:       ci.src,
+		SrcNodeID: ci.node.StableID(),
+		SrcNode:   ci.node.Name(),
+		SrcUser:   ci.uprof.LoginName,
+		LocalUser: ss.conn.localUser.Username,
+		Command:   cmd,
+		Start:     ss.conn.srv.now(),
 	}
-
-	ss.logf("Wait: %v", err)
-	ss.Exit(1)
-	return
 }
 
 // recordSSHToLocalDisk is a deprecated dev knob to allow recording SSH sessions
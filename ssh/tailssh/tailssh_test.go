@@ -32,6 +32,7 @@
 	"time"
 
 	gossh "github.com/tailscale/golang-x-crypto/ssh"
+	"tailscale.com/ipn"
 	"tailscale.com/ipn/ipnlocal"
 	"tailscale.com/ipn/store/mem"
 	"tailscale.com/net/memnet"
@@ -233,6 +234,9 @@ type localState struct {
 	// It is served for paths like https://unused/ssh-action/<action-name>.
 	// The action name is the last part of the action URL.
 	serverActions map[string]*tailcfg.SSHAction
+
+	mu          sync.Mutex
+	sshSessions []ipn.SSHSession // as passed to NoteSSHSession
 }
 
 var (
@@ -318,6 +322,12 @@ func (ts *localState) NodeKey() key.NodePublic {
 	return key.NewNode().Public()
 }
 
+func (ts *localState) NoteSSHSession(s ipn.SSHSession) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.sshSessions = append(ts.sshSessions, s)
+}
+
 func newSSHRule(action *tailcfg.SSHAction) *tailcfg.SSHRule {
 	return &tailcfg.SSHRule{
 		SSHUsers: map[string]string{
@@ -569,23 +579,24 @@ func TestSSHRecordingNonInteractive(t *testing.T) {
 	}))
 	defer recordingServer.Close()
 
+	lb := &localState{
+		sshEnabled: true,
+		matchingRule: newSSHRule(
+			&tailcfg.SSHAction{
+				Accept: true,
+				Recorders: []netip.AddrPort{
+					must.Get(netip.ParseAddrPort(recordingServer.Listener.Addr().String())),
+				},
+				OnRecordingFailure: &tailcfg.SSHRecorderFailureAction{
+					RejectSessionWithMessage:    "session rejected",
+					TerminateSessionWithMessage: "session terminated",
+				},
+			},
+		),
+	}
 	s := &server{
 		logf: logger.Discard,
-		lb: &localState{
-			sshEnabled: true,
-			matchingRule: newSSHRule(
-				&tailcfg.SSHAction{
-					Accept: true,
-					Recorders: []netip.AddrPort{
-						must.Get(netip.ParseAddrPort(recordingServer.Listener.Addr().String())),
-					},
-					OnRecordingFailure: &tailcfg.SSHRecorderFailureAction{
-						RejectSessionWithMessage:    "session rejected",
-						TerminateSessionWithMessage: "session terminated",
-					},
-				},
-			),
-		},
+		lb:   lb,
 	}
 	defer s.Shutdown()
 
@@ -637,6 +648,22 @@ func TestSSHRecordingNonInteractive(t *testing.T) {
 	if ch.Command != "echo Ran echo!" {
 		t.Errorf("Command = %q; want %q", ch.Command, "echo Ran echo!")
 	}
+
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	if len(lb.sshSessions) != 2 {
+		t.Fatalf("got %d session events, want 2 (start and end): %v", len(lb.sshSessions), lb.sshSessions)
+	}
+	start, end := lb.sshSessions[0], lb.sshSessions[1]
+	if !start.End.IsZero() {
+		t.Errorf("start event has End set: %v", start)
+	}
+	if end.End.IsZero() || end.ID != start.ID || end.ExitCode != 0 {
+		t.Errorf("end event = %v; want end of %v with code 0", end, start)
+	}
+	if start.Command != "echo Ran echo!" || start.SrcUser != "peer" || start.Src != src {
+		t.Errorf("start event = %+v", start)
+	}
 }
 
 func TestSSHAuthFlow(t *testing.T) {
@@ -745,6 +745,13 @@ type Hostinfo struct {
 	// explicitly declared by a node.
 	Location *Location `json:",omitempty"`
 
+	// PostureAttributes are device posture attributes, such as whether
+	// the disk is encrypted, for the control server to use in access
+	// rules. They're only sent with the user's consent or if a system
+	// policy requires it. See package tailscale.com/posture for the
+	// attribute names.
+	PostureAttributes map[string]string `json:",omitempty"`
+
 	// NOTE: any new fields containing pointers in this type
 	//       require changes to Hostinfo.Equal.
 }
@@ -2143,6 +2150,23 @@ type Oauth2Token struct {
 	// NodeAttrDNSForwarderDisableTCPRetries disables retrying truncated
 	// DNS queries over TCP if the response is truncated.
 	NodeAttrDNSForwarderDisableTCPRetries NodeCapability = "dns-forwarder-disable-tcp-retries"
+
+	// NodeAttrServeMetrics makes the node serve its client metrics over the
+	// PeerAPI to its own user's devices and to peers granted
+	// PeerCapabilityDebugPeer, without the rest of the debug handlers that
+	// CapabilityDebug enables.
+	NodeAttrServeMetrics NodeCapability = "https://tailscale.com/cap/serve-metrics"
+
+	// NodeAttrFunnelPaused makes the node refuse incoming Funnel
+	// connections, without changing its serve config, so that Funnel can
+	// be paused and resumed centrally.
+	NodeAttrFunnelPaused NodeCapability = "https://tailscale.com/cap/funnel-paused"
+
+	// NodeAttrTaildropAutoAccept makes the node accept files sent with
+	// Taildrop from peers with any of the tags listed in its values, which
+	// are JSON objects of the form {"tags":["tag:ci"]}, even if they aren't
+	// granted PeerCapabilityFileSharingSend.
+	NodeAttrTaildropAutoAccept NodeCapability = "https://tailscale.com/cap/taildrop-auto-accept"
 )
 
 // SetDNSRequest is a request to add a DNS record.
@@ -137,45 +137,47 @@ func (src *Hostinfo) Clone() *Hostinfo {
 	if dst.Location != nil {
 		dst.Location = ptr.To(*src.Location)
 	}
+	dst.PostureAttributes = maps.Clone(src.PostureAttributes)
 	return dst
 }
 
 // A compilation failure here means this code must be regenerated, with the command at the top of this file.
 var _HostinfoCloneNeedsRegeneration = Hostinfo(struct {
-	IPNVersion      string
-	FrontendLogID   string
-	BackendLogID    string
-	OS              string
-	OSVersion       string
-	Container       opt.Bool
-	Env             string
-	Distro          string
-	DistroVersion   string
-	DistroCodeName  string
-	App             string
-	Desktop         opt.Bool
-	Package         string
-	DeviceModel     string
-	PushDeviceToken string
-	Hostname        string
-	ShieldsUp       bool
-	ShareeNode      bool
-	NoLogsNoSupport bool
-	WireIngress     bool
-	AllowsUpdate    bool
-	Machine         string
-	GoArch          string
-	GoArchVar       string
-	GoVersion       string
-	RoutableIPs     []netip.Prefix
-	RequestTags     []string
-	Services        []Service
-	NetInfo         *NetInfo
-	SSH_HostKeys    []string
-	Cloud           string
-	Userspace       opt.Bool
-	UserspaceRouter opt.Bool
-	Location        *Location
+	IPNVersion        string
+	FrontendLogID     string
+	BackendLogID      string
+	OS                string
+	OSVersion         string
+	Container         opt.Bool
+	Env               string
+	Distro            string
+	DistroVersion     string
+	DistroCodeName    string
+	App               string
+	Desktop           opt.Bool
+	Package           string
+	DeviceModel       string
+	PushDeviceToken   string
+	Hostname          string
+	ShieldsUp         bool
+	ShareeNode        bool
+	NoLogsNoSupport   bool
+	WireIngress       bool
+	AllowsUpdate      bool
+	Machine           string
+	GoArch            string
+	GoArchVar         string
+	GoVersion         string
+	RoutableIPs       []netip.Prefix
+	RequestTags       []string
+	Services          []Service
+	NetInfo           *NetInfo
+	SSH_HostKeys      []string
+	Cloud             string
+	Userspace         opt.Bool
+	UserspaceRouter   opt.Bool
+	Location          *Location
+	PostureAttributes map[string]string
 }{})
 
 // Clone makes a deep copy of NetInfo.
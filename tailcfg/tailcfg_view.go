@@ -324,44 +324,49 @@ func (v HostinfoView) Location() *Location {
 	return &x
 }
 
+func (v HostinfoView) PostureAttributes() views.Map[string, string] {
+	return views.MapOf(v.ж.PostureAttributes)
+}
+
 func (v HostinfoView) Equal(v2 HostinfoView) bool { return v.ж.Equal(v2.ж) }
 
 // A compilation failure here means this code must be regenerated, with the command at the top of this file.
 var _HostinfoViewNeedsRegeneration = Hostinfo(struct {
-	IPNVersion      string
-	FrontendLogID   string
-	BackendLogID    string
-	OS              string
-	OSVersion       string
-	Container       opt.Bool
-	Env             string
-	Distro          string
-	DistroVersion   string
-	DistroCodeName  string
-	App             string
-	Desktop         opt.Bool
-	Package         string
-	DeviceModel     string
-	PushDeviceToken string
-	Hostname        string
-	ShieldsUp       bool
-	ShareeNode      bool
-	NoLogsNoSupport bool
-	WireIngress     bool
-	AllowsUpdate    bool
-	Machine         string
-	GoArch          string
-	GoArchVar       string
-	GoVersion       string
-	RoutableIPs     []netip.Prefix
-	RequestTags     []string
-	Services        []Service
-	NetInfo         *NetInfo
-	SSH_HostKeys    []string
-	Cloud           string
-	Userspace       opt.Bool
-	UserspaceRouter opt.Bool
-	Location        *Location
+	IPNVersion        string
+	FrontendLogID     string
+	BackendLogID      string
+	OS                string
+	OSVersion         string
+	Container         opt.Bool
+	Env               string
+	Distro            string
+	DistroVersion     string
+	DistroCodeName    string
+	App               string
+	Desktop           opt.Bool
+	Package           string
+	DeviceModel       string
+	PushDeviceToken   string
+	Hostname          string
+	ShieldsUp         bool
+	ShareeNode        bool
+	NoLogsNoSupport   bool
+	WireIngress       bool
+	AllowsUpdate      bool
+	Machine           string
+	GoArch            string
+	GoArchVar         string
+	GoVersion         string
+	RoutableIPs       []netip.Prefix
+	RequestTags       []string
+	Services          []Service
+	NetInfo           *NetInfo
+	SSH_HostKeys      []string
+	Cloud             string
+	Userspace         opt.Bool
+	UserspaceRouter   opt.Bool
+	Location          *Location
+	PostureAttributes map[string]string
 }{})
 
 // View returns a readonly view of NetInfo.
@@ -0,0 +1,165 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package escrow
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+// This file implements encryption (only) in the age v1 format, as
+// specified at https://age-encryption.org/v1, so that bundles can be
+// decrypted with the age tool.
+
+const (
+	ageIntro     = "age-encryption.org/v1\n"
+	ageChunkSize = 64 << 10
+)
+
+var b64 = base64.RawStdEncoding
+
+// A stanza is an age header stanza, which wraps the file key for one
+// recipient.
+type stanza struct {
+	typ  string
+	args []string
+	body []byte
+}
+
+func (s *stanza) marshal(w *bytes.Buffer) {
+	w.WriteString("-> " + s.typ)
+	for _, a := range s.args {
+		w.WriteString(" " + a)
+	}
+	w.WriteString("\n")
+	// The body is wrapped at 64 columns, and its last line is always
+	// shorter than that, even if it has to be empty.
+	body := b64.EncodeToString(s.body)
+	for len(body) >= 64 {
+		w.WriteString(body[:64] + "\n")
+		body = body[64:]
+	}
+	w.WriteString(body + "\n")
+}
+
+// hkdfKey derives a 32-byte key with HKDF-SHA-256.
+func hkdfKey(secret, salt []byte, info string) []byte {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, []byte(info)), key); err != nil {
+		panic(err) // can't happen; HKDF can produce far more than 32 bytes
+	}
+	return key
+}
+
+// aeadSeal encrypts the file key to key with ChaCha20-Poly1305 and a zero
+// nonce, which is safe as each key is only ever used once.
+func aeadSeal(key, plaintext []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nil, make([]byte, chacha20poly1305.NonceSize), plaintext, nil), nil
+}
+
+// wrapX25519 wraps fileKey for the X25519 public key to. tweak, if non-nil,
+// is applied to the shared secret, as the ssh-ed25519 recipient type does.
+// It returns the ephemeral share and the wrapped key.
+func wrapX25519(fileKey, to, tweak []byte, label string) (share, wrapped []byte, err error) {
+	eph, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	pub, err := ecdh.X25519().NewPublicKey(to)
+	if err != nil {
+		return nil, nil, err
+	}
+	shared, err := eph.ECDH(pub)
+	if err != nil {
+		return nil, nil, err // low order point
+	}
+	if tweak != nil {
+		t, err := ecdh.X25519().NewPrivateKey(tweak)
+		if err != nil {
+			return nil, nil, err
+		}
+		sharedPub, err := ecdh.X25519().NewPublicKey(shared)
+		if err != nil {
+			return nil, nil, err
+		}
+		if shared, err = t.ECDH(sharedPub); err != nil {
+			return nil, nil, err
+		}
+	}
+	share = eph.PublicKey().Bytes()
+	salt := append(append([]byte{}, share...), to...)
+	wrapped, err = aeadSeal(hkdfKey(shared, salt, label), fileKey)
+	return share, wrapped, err
+}
+
+// encrypt writes plaintext to w, encrypted to all of recipients, any one
+// of which can decrypt it.
+func encrypt(w io.Writer, plaintext []byte, recipients []Recipient) error {
+	if len(recipients) == 0 {
+		return errors.New("no recipients")
+	}
+	fileKey := make([]byte, 16)
+	if _, err := rand.Read(fileKey); err != nil {
+		return err
+	}
+
+	var hdr bytes.Buffer
+	hdr.WriteString(ageIntro)
+	for _, r := range recipients {
+		s, err := r.wrap(fileKey)
+		if err != nil {
+			return err
+		}
+		s.marshal(&hdr)
+	}
+	hdr.WriteString("---")
+	mac := hmac.New(sha256.New, hkdfKey(fileKey, nil, "header"))
+	mac.Write(hdr.Bytes())
+	hdr.WriteString(" " + b64.EncodeToString(mac.Sum(nil)) + "\n")
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	hdr.Write(nonce)
+	aead, err := chacha20poly1305.New(hkdfKey(fileKey, nonce, "payload"))
+	if err != nil {
+		return err
+	}
+	out := hdr.Bytes()
+	// The payload is sealed in chunks with a nonce of an 11-byte big-endian
+	// counter and a byte that is set for the last chunk, which is only
+	// empty if the whole payload is.
+	chunkNonce := make([]byte, chacha20poly1305.NonceSize)
+	for i := uint64(0); ; i++ {
+		n := min(len(plaintext), ageChunkSize)
+		chunk := plaintext[:n]
+		plaintext = plaintext[n:]
+		binary.BigEndian.PutUint64(chunkNonce[3:11], i)
+		last := len(plaintext) == 0
+		if last {
+			chunkNonce[11] = 1
+		}
+		out = aead.Seal(out, chunkNonce, chunk, nil)
+		if last {
+			break
+		}
+	}
+	_, err = w.Write(out)
+	return err
+}
@@ -0,0 +1,246 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+// Package escrow writes tailnet lock disablement secrets to recovery
+// bundles encrypted with age (https://age-encryption.org) to a set of
+// public keys, so that they can be kept in shared storage rather than
+// copied by hand into password managers.
+//
+// A bundle can be decrypted by any one of its recipients with the
+// standard age tool, such as with "age -d -i ~/.ssh/id_ed25519".
+package escrow
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"filippo.io/edwards25519"
+)
+
+// A Recipient is a public key that a bundle can be encrypted to.
+type Recipient interface {
+	// String returns the recipient as it was parsed.
+	String() string
+
+	wrap(fileKey []byte) (*stanza, error)
+}
+
+// ParseRecipient parses an age X25519 recipient ("age1...") or an SSH
+// Ed25519 public key in authorized_keys format ("ssh-ed25519 AAAA...").
+func ParseRecipient(s string) (Recipient, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case strings.HasPrefix(s, "age1"):
+		hrp, key, err := bech32Decode(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid age recipient %q: %w", s, err)
+		}
+		if hrp != "age" || len(key) != 32 {
+			return nil, fmt.Errorf("invalid age recipient %q", s)
+		}
+		return &x25519Recipient{s: s, key: key}, nil
+	case strings.HasPrefix(s, "ssh-ed25519 "):
+		return parseSSHEd25519(s)
+	case strings.HasPrefix(s, "ssh-"), strings.HasPrefix(s, "ecdsa-"), strings.HasPrefix(s, "sk-"):
+		typ, _, _ := strings.Cut(s, " ")
+		return nil, fmt.Errorf("unsupported SSH key type %q; only ssh-ed25519 keys can be escrow recipients", typ)
+	}
+	return nil, fmt.Errorf("unknown recipient %q; want an age1... or ssh-ed25519 public key", s)
+}
+
+// ParseRecipients parses a recipients file with one recipient per line,
+// as used with "age -R": blank lines and lines starting with "#" are
+// ignored.
+func ParseRecipients(r io.Reader) ([]Recipient, error) {
+	var ret []Recipient
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rcpt, err := ParseRecipient(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		ret = append(ret, rcpt)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(ret) == 0 {
+		return nil, errors.New("no recipients found")
+	}
+	return ret, nil
+}
+
+// WriteBundle writes secrets, the disablement secrets of a tailnet lock, to
+// w as a recovery bundle that any one of recipients can decrypt. The
+// decrypted bundle is text with one "disablement-secret:" line per secret,
+// each of which can be passed to "tailscale lock disable".
+func WriteBundle(w io.Writer, secrets [][]byte, recipients []Recipient, now time.Time) error {
+	if len(secrets) == 0 {
+		return errors.New("no disablement secrets to escrow")
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# Tailnet lock disablement secrets, escrowed %s.\n", now.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&b, "# Any one of them disables tailnet lock with:\n")
+	fmt.Fprintf(&b, "#   tailscale lock disable disablement-secret:...\n")
+	for _, s := range secrets {
+		fmt.Fprintf(&b, "disablement-secret:%X\n", s)
+	}
+	return encrypt(w, b.Bytes(), recipients)
+}
+
+type x25519Recipient struct {
+	s   string
+	key []byte
+}
+
+func (r *x25519Recipient) String() string { return r.s }
+
+func (r *x25519Recipient) wrap(fileKey []byte) (*stanza, error) {
+	share, wrapped, err := wrapX25519(fileKey, r.key, nil, "age-encryption.org/v1/X25519")
+	if err != nil {
+		return nil, err
+	}
+	return &stanza{typ: "X25519", args: []string{b64.EncodeToString(share)}, body: wrapped}, nil
+}
+
+type sshEd25519Recipient struct {
+	s    string
+	wire []byte // public key in SSH wire format
+	mont []byte // public key converted to X25519
+}
+
+func (r *sshEd25519Recipient) String() string { return r.s }
+
+func (r *sshEd25519Recipient) wrap(fileKey []byte) (*stanza, error) {
+	const label = "age-encryption.org/v1/ssh-ed25519"
+	tweak := hkdfKey(nil, r.wire, label)
+	share, wrapped, err := wrapX25519(fileKey, r.mont, tweak, label)
+	if err != nil {
+		return nil, err
+	}
+	tag := sha256.Sum256(r.wire)
+	return &stanza{
+		typ:  "ssh-ed25519",
+		args: []string{b64.EncodeToString(tag[:4]), b64.EncodeToString(share)},
+		body: wrapped,
+	}, nil
+}
+
+// parseSSHEd25519 parses an ssh-ed25519 authorized_keys line.
+func parseSSHEd25519(s string) (*sshEd25519Recipient, error) {
+	f := strings.Fields(s)
+	if len(f) < 2 {
+		return nil, fmt.Errorf("invalid SSH public key %q", s)
+	}
+	wire, err := base64.StdEncoding.DecodeString(f[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid SSH public key %q: %w", s, err)
+	}
+	// The wire format is two length-prefixed strings: the key type and
+	// the 32-byte public key.
+	rest := wire
+	var fields [][]byte
+	for len(rest) > 0 && len(fields) < 2 {
+		if len(rest) < 4 {
+			break
+		}
+		n := binary.BigEndian.Uint32(rest)
+		rest = rest[4:]
+		if uint32(len(rest)) < n {
+			break
+		}
+		fields = append(fields, rest[:n])
+		rest = rest[n:]
+	}
+	if len(fields) != 2 || string(fields[0]) != "ssh-ed25519" || len(fields[1]) != 32 || len(rest) != 0 {
+		return nil, fmt.Errorf("invalid ssh-ed25519 public key %q", s)
+	}
+	p, err := new(edwards25519.Point).SetBytes(fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid ssh-ed25519 public key %q: %w", s, err)
+	}
+	return &sshEd25519Recipient{s: s, wire: wire, mont: p.BytesMontgomery()}, nil
+}
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+func bech32Polymod(values []byte) uint32 {
+	gen := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		b := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (b>>i)&1 == 1 {
+				chk ^= gen[i]
+			}
+		}
+	}
+	return chk
+}
+
+func bech32HRPExpand(hrp string) []byte {
+	ret := make([]byte, 0, len(hrp)*2+1)
+	for _, c := range []byte(hrp) {
+		ret = append(ret, c>>5)
+	}
+	ret = append(ret, 0)
+	for _, c := range []byte(hrp) {
+		ret = append(ret, c&31)
+	}
+	return ret
+}
+
+// bech32Decode decodes a lowercase Bech32 string, as used for age keys,
+// into its human-readable part and data. Unlike BIP 173, there is no
+// limit on its length.
+func bech32Decode(s string) (hrp string, data []byte, err error) {
+	if strings.ToLower(s) != s {
+		return "", nil, errors.New("not lowercase")
+	}
+	i := strings.LastIndexByte(s, '1')
+	if i < 1 || i+7 > len(s) {
+		return "", nil, errors.New("invalid separator position")
+	}
+	hrp = s[:i]
+	var values []byte
+	for _, c := range []byte(s[i+1:]) {
+		v := strings.IndexByte(bech32Charset, c)
+		if v < 0 {
+			return "", nil, fmt.Errorf("invalid character %q", c)
+		}
+		values = append(values, byte(v))
+	}
+	if bech32Polymod(append(bech32HRPExpand(hrp), values...)) != 1 {
+		return "", nil, errors.New("invalid checksum")
+	}
+	values = values[:len(values)-6]
+
+	// Convert the 5-bit groups to bytes, rejecting non-zero padding.
+	var acc uint32
+	var bits uint
+	for _, v := range values {
+		acc = acc<<5 | uint32(v)
+		bits += 5
+		for bits >= 8 {
+			bits -= 8
+			data = append(data, byte(acc>>bits))
+		}
+	}
+	if bits >= 5 || acc&(1<<bits-1) != 0 {
+		return "", nil, errors.New("invalid padding")
+	}
+	return hrp, data, nil
+}
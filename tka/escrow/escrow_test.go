@@ -0,0 +1,296 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package escrow
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+func TestBech32Decode(t *testing.T) {
+	// Test vectors from BIP 173.
+	hrp, data, err := bech32Decode("a12uel5l")
+	if err != nil || hrp != "a" || len(data) != 0 {
+		t.Errorf("a12uel5l: got %q, %x, %v", hrp, data, err)
+	}
+	hrp, data, err = bech32Decode("abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw")
+	want := []byte{0x00, 0x44, 0x32, 0x14, 0xc7, 0x42, 0x54, 0xb6, 0x35, 0xcf, 0x84, 0x65, 0x3a, 0x56, 0xd7, 0xc6, 0x75, 0xbe, 0x77, 0xdf}
+	if err != nil || hrp != "abcdef" || !bytes.Equal(data, want) {
+		t.Errorf("abcdef1...: got %q, %x, %v", hrp, data, err)
+	}
+	for _, bad := range []string{"a12uel5m", "A12UEL5L", "pzry9x0s0muk", "a1b2uel5l"} {
+		if _, _, err := bech32Decode(bad); err == nil {
+			t.Errorf("bech32Decode(%q) succeeded", bad)
+		}
+	}
+}
+
+// bech32Encode is the inverse of bech32Decode, for making test keys.
+func bech32Encode(hrp string, data []byte) string {
+	var values []byte
+	var acc uint32
+	var bits uint
+	for _, b := range data {
+		acc = acc<<8 | uint32(b)
+		bits += 8
+		for bits >= 5 {
+			bits -= 5
+			values = append(values, byte(acc>>bits)&31)
+		}
+	}
+	if bits > 0 {
+		values = append(values, byte(acc<<(5-bits))&31)
+	}
+	mod := bech32Polymod(append(append(bech32HRPExpand(hrp), values...), 0, 0, 0, 0, 0, 0)) ^ 1
+	for i := 0; i < 6; i++ {
+		values = append(values, byte(mod>>(5*(5-i)))&31)
+	}
+	var sb strings.Builder
+	sb.WriteString(hrp + "1")
+	for _, v := range values {
+		sb.WriteByte(bech32Charset[v])
+	}
+	return sb.String()
+}
+
+// identity is the private half of a test recipient. It unwraps the file
+// key from the stanza it matches, or returns nil.
+type identity func(s *stanza) []byte
+
+func newX25519Identity(t *testing.T) (string, identity) {
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := priv.PublicKey().Bytes()
+	return bech32Encode("age", pub), func(s *stanza) []byte {
+		if s.typ != "X25519" {
+			return nil
+		}
+		share, _ := b64.DecodeString(s.args[0])
+		return unwrap(t, priv, share, pub, nil, "age-encryption.org/v1/X25519", s.body)
+	}
+}
+
+func newSSHIdentity(t *testing.T) (string, identity) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wire []byte
+	for _, f := range [][]byte{[]byte("ssh-ed25519"), pub} {
+		wire = binary.BigEndian.AppendUint32(wire, uint32(len(f)))
+		wire = append(wire, f...)
+	}
+	line := "ssh-ed25519 " + base64.StdEncoding.EncodeToString(wire) + " alice@example"
+	r, err := parseSSHEd25519(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := sha512.Sum512(priv.Seed())
+	xpriv, err := ecdh.X25519().NewPrivateKey(h[:32])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The recipient's X25519 key must be the public half of the X25519
+	// key derived from the Ed25519 private key.
+	if !bytes.Equal(xpriv.PublicKey().Bytes(), r.mont) {
+		t.Fatal("Montgomery conversion of the public key doesn't match the private key")
+	}
+	const label = "age-encryption.org/v1/ssh-ed25519"
+	return line, func(s *stanza) []byte {
+		tag := sha256.Sum256(wire)
+		if s.typ != "ssh-ed25519" || s.args[0] != b64.EncodeToString(tag[:4]) {
+			return nil
+		}
+		share, _ := b64.DecodeString(s.args[1])
+		return unwrap(t, xpriv, share, r.mont, hkdfKey(nil, wire, label), label, s.body)
+	}
+}
+
+func unwrap(t *testing.T, priv *ecdh.PrivateKey, share, pub, tweak []byte, label string, body []byte) []byte {
+	sharePub, err := ecdh.X25519().NewPublicKey(share)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared, err := priv.ECDH(sharePub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tweak != nil {
+		tk, _ := ecdh.X25519().NewPrivateKey(tweak)
+		sp, _ := ecdh.X25519().NewPublicKey(shared)
+		if shared, err = tk.ECDH(sp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	aead, _ := chacha20poly1305.New(hkdfKey(shared, append(append([]byte{}, share...), pub...), label))
+	fileKey, err := aead.Open(nil, make([]byte, chacha20poly1305.NonceSize), body, nil)
+	if err != nil {
+		t.Fatalf("unwrapping file key: %v", err)
+	}
+	return fileKey
+}
+
+// decrypt decrypts an age file with id, checking its format strictly.
+func decrypt(t *testing.T, file []byte, id identity) []byte {
+	t.Helper()
+	br := bufio.NewReader(bytes.NewReader(file))
+	line := func() string {
+		l, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading header: %v", err)
+		}
+		return l
+	}
+	var hdr bytes.Buffer
+	if l := line(); l != ageIntro {
+		t.Fatalf("intro = %q", l)
+	} else {
+		hdr.WriteString(l)
+	}
+	var fileKey []byte
+	var macLine string
+	for {
+		l := line()
+		if strings.HasPrefix(l, "--- ") {
+			hdr.WriteString("---")
+			macLine = strings.TrimSuffix(l[4:], "\n")
+			break
+		}
+		hdr.WriteString(l)
+		f := strings.Fields(strings.TrimPrefix(l, "-> "))
+		s := &stanza{typ: f[0], args: f[1:]}
+		var body string
+		for {
+			bl := line()
+			hdr.WriteString(bl)
+			bl = strings.TrimSuffix(bl, "\n")
+			if len(bl) > 64 {
+				t.Fatalf("body line longer than 64 columns: %q", bl)
+			}
+			body += bl
+			if len(bl) < 64 {
+				break
+			}
+		}
+		var err error
+		if s.body, err = b64.DecodeString(body); err != nil {
+			t.Fatal(err)
+		}
+		if k := id(s); k != nil {
+			fileKey = k
+		}
+	}
+	if fileKey == nil {
+		t.Fatal("no stanza for identity")
+	}
+	mac := hmac.New(sha256.New, hkdfKey(fileKey, nil, "header"))
+	mac.Write(hdr.Bytes())
+	if got, _ := b64.DecodeString(macLine); !hmac.Equal(got, mac.Sum(nil)) {
+		t.Fatal("header MAC mismatch")
+	}
+	rest, _ := io.ReadAll(br)
+	nonce, payload := rest[:16], rest[16:]
+	aead, _ := chacha20poly1305.New(hkdfKey(fileKey, nonce, "payload"))
+	var out []byte
+	chunkNonce := make([]byte, chacha20poly1305.NonceSize)
+	for i := uint64(0); ; i++ {
+		n := min(len(payload), ageChunkSize+aead.Overhead())
+		binary.BigEndian.PutUint64(chunkNonce[3:11], i)
+		if n == len(payload) {
+			chunkNonce[11] = 1
+		}
+		var err error
+		if out, err = aead.Open(out, chunkNonce, payload[:n], nil); err != nil {
+			t.Fatalf("chunk %d: %v", i, err)
+		}
+		payload = payload[n:]
+		if len(payload) == 0 {
+			return out
+		}
+	}
+}
+
+func TestWriteBundle(t *testing.T) {
+	ageRcpt, ageID := newX25519Identity(t)
+	sshRcpt, sshID := newSSHIdentity(t)
+	recipients, err := ParseRecipients(strings.NewReader(fmt.Sprintf("# escrow keys\n%s\n\n%s\n", ageRcpt, sshRcpt)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recipients) != 2 {
+		t.Fatalf("got %d recipients; want 2", len(recipients))
+	}
+
+	secrets := [][]byte{bytes.Repeat([]byte{0xab}, 32), bytes.Repeat([]byte{0x01}, 32)}
+	var buf bytes.Buffer
+	if err := WriteBundle(&buf, secrets, recipients, time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	for name, id := range map[string]identity{"age": ageID, "ssh": sshID} {
+		got := string(decrypt(t, buf.Bytes(), id))
+		for _, want := range []string{
+			"escrowed 2023-09-01T00:00:00Z",
+			"\ndisablement-secret:" + strings.Repeat("AB", 32) + "\n",
+			"\ndisablement-secret:" + strings.Repeat("01", 32) + "\n",
+		} {
+			if !strings.Contains(got, want) {
+				t.Errorf("%s: bundle %q doesn't contain %q", name, got, want)
+			}
+		}
+	}
+}
+
+func TestEncryptChunks(t *testing.T) {
+	rcpt, id := newX25519Identity(t)
+	r, err := ParseRecipient(rcpt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []int{0, 1, ageChunkSize, ageChunkSize + 1, 2 * ageChunkSize} {
+		plaintext := make([]byte, n)
+		rand.Read(plaintext)
+		var buf bytes.Buffer
+		if err := encrypt(&buf, plaintext, []Recipient{r}); err != nil {
+			t.Fatal(err)
+		}
+		if got := decrypt(t, buf.Bytes(), id); !bytes.Equal(got, plaintext) {
+			t.Errorf("%d bytes: round trip mismatch", n)
+		}
+	}
+}
+
+func TestParseRecipientErrors(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"age1qqqqqqqq",
+		"ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQ alice@example",
+		"ssh-ed25519 not-base64",
+		"ssh-ed25519 " + base64.StdEncoding.EncodeToString([]byte("short")),
+		"tlpub:0123",
+	} {
+		if _, err := ParseRecipient(s); err == nil {
+			t.Errorf("ParseRecipient(%q) succeeded", s)
+		}
+	}
+	if _, err := ParseRecipients(strings.NewReader("# only comments\n")); err == nil {
+		t.Error("ParseRecipients with no recipients succeeded")
+	}
+}
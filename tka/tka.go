@@ -457,6 +457,124 @@ func checkParent(aum AUM, state State) error {
 	return nil
 }
 
+// SignatureVerification is the result of verifying one of the signatures
+// of an AUM.
+type SignatureVerification struct {
+	KeyID tkatype.KeyID
+	Err   error // or nil if the signature is valid
+}
+
+// AUMVerification is the result of verifying the signatures of one AUM
+// in a chain.
+type AUMVerification struct {
+	AUM        AUM
+	Signatures []SignatureVerification
+	// Err is non-nil if the state to verify the AUM against couldn't be
+	// computed, in which case Signatures is empty.
+	Err error
+}
+
+// VerifyAUMSignatures verifies each signature of the AUM with hash h in
+// storage against the keys trusted in the state at its parent. A genesis
+// AUM is verified against the keys it introduces, as Bootstrap does.
+//
+// It returns an error if the AUM or the state at its parent can't be
+// computed from storage, such as when compaction removed the AUMs that
+// state depends on.
+func VerifyAUMSignatures(storage Chonk, h AUMHash) ([]SignatureVerification, error) {
+	vs, err := VerifyChainSignatures(storage, h, 1)
+	if err != nil {
+		return nil, err
+	}
+	return vs[0].Signatures, vs[0].Err
+}
+
+// VerifyChainSignatures verifies the signatures of up to maxEntries AUMs
+// in storage, walking back from head, as VerifyAUMSignatures does for each.
+// The results are ordered newest first.
+//
+// The state at the parent of the oldest AUM is computed once, and then
+// the AUMs are applied to it in order, so that the cost is linear in the
+// length of the chain rather than quadratic.
+func VerifyChainSignatures(storage Chonk, head AUMHash, maxEntries int) ([]AUMVerification, error) {
+	var chain []AUM // newest first
+	cursor := head
+	for len(chain) < maxEntries {
+		aum, err := storage.AUM(cursor)
+		if err != nil {
+			if err == os.ErrNotExist && len(chain) > 0 {
+				break // compacted away
+			}
+			return nil, err
+		}
+		chain = append(chain, aum)
+		parent, hasParent := aum.Parent()
+		if !hasParent {
+			break
+		}
+		cursor = parent
+	}
+	if len(chain) == 0 {
+		return nil, nil
+	}
+
+	// state is the state at the parent of the next AUM to verify, unless
+	// stateErr is non-nil.
+	var (
+		state    State
+		stateErr error
+	)
+	if parent, hasParent := chain[len(chain)-1].Parent(); hasParent {
+		if state, stateErr = computeStateAt(storage, maxScanIterations, parent); stateErr != nil {
+			stateErr = fmt.Errorf("computing state at parent: %v", stateErr)
+		}
+	}
+
+	ret := make([]AUMVerification, len(chain))
+	for i := len(chain) - 1; i >= 0; i-- {
+		aum := chain[i]
+		v := &ret[i]
+		v.AUM = aum
+
+		next, nextErr := state, stateErr
+		if _, hasParent := aum.Parent(); !hasParent {
+			if aum.MessageKind == AUMCheckpoint && aum.State != nil {
+				next, nextErr = aum.State.cloneForUpdate(&aum), nil
+			} else if next, nextErr = (State{}).applyVerifiedAUM(aum); nextErr != nil {
+				nextErr = fmt.Errorf("applying genesis: %v", nextErr)
+			}
+			// A genesis AUM is signed by the keys it introduces.
+			state, stateErr = next, nextErr
+		} else if stateErr == nil {
+			if next, nextErr = state.applyVerifiedAUM(aum); nextErr != nil {
+				nextErr = fmt.Errorf("applying %v: %v", aum.Hash(), nextErr)
+			}
+		} else if aum.MessageKind == AUMCheckpoint && aum.State != nil {
+			// A checkpoint carries the whole state, so the AUMs after
+			// it can be verified even if those before it can't.
+			next, nextErr = aum.State.cloneForUpdate(&aum), nil
+		}
+
+		if stateErr != nil {
+			v.Err = stateErr
+		} else {
+			sigHash := aum.SigHash()
+			v.Signatures = make([]SignatureVerification, len(aum.Signatures))
+			for j, sig := range aum.Signatures {
+				v.Signatures[j].KeyID = sig.KeyID
+				key, err := state.GetKey(sig.KeyID)
+				if err != nil {
+					v.Signatures[j].Err = fmt.Errorf("untrusted key: %v", err)
+					continue
+				}
+				v.Signatures[j].Err = signatureVerify(&sig, sigHash, key)
+			}
+		}
+		state, stateErr = next, nextErr
+	}
+	return ret, nil
+}
+
 // Head returns the AUM digest of the latest update applied to the state
 // machine.
 func (a *Authority) Head() AUMHash {
@@ -652,3 +652,140 @@ func TestMakeRetroactiveRevocation(t *testing.T) {
 		t.Fatalf("MakeRetroactiveRevocation({k1, k2, k3}) returned %v, expected %q", err, wantErr)
 	}
 }
+
+func TestVerifyAUMSignatures(t *testing.T) {
+	pub, priv := testingKey25519(t, 1)
+	key := Key{Kind: Key25519, Public: pub, Votes: 2}
+	untrustedPub, untrustedPriv := testingKey25519(t, 2)
+	untrustedKey := Key{Kind: Key25519, Public: untrustedPub, Votes: 2}
+
+	c := newTestchain(t, `
+        G1 -> L1 -> L2
+
+        G1.template = genesis
+    `,
+		optTemplate("genesis", AUM{MessageKind: AUMCheckpoint, State: &State{
+			Keys:               []Key{key},
+			DisablementSecrets: [][]byte{DisablementKDF([]byte{1, 2, 3})},
+		}}),
+		optKey("key", key, priv),
+		optSignAllUsing("key"))
+
+	storage := &Mem{}
+	a, err := Bootstrap(storage, c.AUMs["G1"])
+	if err != nil {
+		t.Fatalf("Bootstrap() failed: %v", err)
+	}
+	if err := a.Inform(storage, []AUM{c.AUMs["L1"], c.AUMs["L2"]}); err != nil {
+		t.Fatalf("Inform() failed: %v", err)
+	}
+
+	// Store an update signed by a key that isn't trusted, bypassing the
+	// verification Inform would do.
+	parent := c.AUMHashes["L2"]
+	forged := AUM{MessageKind: AUMNoOp, PrevAUMHash: parent[:]}
+	if err := forged.sign25519(untrustedPriv); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.CommitVerifiedAUMs([]AUM{forged}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"G1", "L1", "L2"} {
+		sigs, err := VerifyAUMSignatures(storage, c.AUMHashes[name])
+		if err != nil {
+			t.Fatalf("VerifyAUMSignatures(%s) failed: %v", name, err)
+		}
+		if len(sigs) != 1 {
+			t.Fatalf("%s: got %d signatures, want 1", name, len(sigs))
+		}
+		if !bytes.Equal(sigs[0].KeyID, key.MustID()) || sigs[0].Err != nil {
+			t.Errorf("%s: got %x, %v; want valid signature by %x", name, sigs[0].KeyID, sigs[0].Err, key.MustID())
+		}
+	}
+
+	sigs, err := VerifyAUMSignatures(storage, forged.Hash())
+	if err != nil {
+		t.Fatalf("VerifyAUMSignatures(forged) failed: %v", err)
+	}
+	if len(sigs) != 1 || !bytes.Equal(sigs[0].KeyID, untrustedKey.MustID()) || sigs[0].Err == nil {
+		t.Errorf("forged: got %+v; want invalid signature by %x", sigs, untrustedKey.MustID())
+	}
+}
+
+// countingChonk is a Chonk that counts the AUMs read from it.
+type countingChonk struct {
+	*Mem
+	reads int
+}
+
+func (c *countingChonk) AUM(hash AUMHash) (AUM, error) {
+	c.reads++
+	return c.Mem.AUM(hash)
+}
+
+func TestVerifyChainSignatures(t *testing.T) {
+	pub, priv := testingKey25519(t, 1)
+	key := Key{Kind: Key25519, Public: pub, Votes: 2}
+	genesis := AUM{MessageKind: AUMCheckpoint, State: &State{
+		Keys:               []Key{key},
+		DisablementSecrets: [][]byte{DisablementKDF([]byte{1, 2, 3})},
+	}}
+	if err := genesis.sign25519(priv); err != nil {
+		t.Fatal(err)
+	}
+	storage := &countingChonk{Mem: &Mem{}}
+	if _, err := Bootstrap(storage, genesis); err != nil {
+		t.Fatalf("Bootstrap() failed: %v", err)
+	}
+
+	const n = 50
+	aums := []AUM{genesis}
+	for i := 1; i < n; i++ {
+		parent := aums[i-1].Hash()
+		aum := AUM{MessageKind: AUMNoOp, PrevAUMHash: parent[:]}
+		if err := aum.sign25519(priv); err != nil {
+			t.Fatal(err)
+		}
+		aums = append(aums, aum)
+	}
+	if err := storage.CommitVerifiedAUMs(aums[1:]); err != nil {
+		t.Fatal(err)
+	}
+
+	storage.reads = 0
+	vs, err := VerifyChainSignatures(storage, aums[n-1].Hash(), n+10)
+	if err != nil {
+		t.Fatalf("VerifyChainSignatures() failed: %v", err)
+	}
+	if len(vs) != n {
+		t.Fatalf("got %d AUMs, want %d", len(vs), n)
+	}
+	for i, v := range vs {
+		if want := aums[n-1-i].Hash(); v.AUM.Hash() != want {
+			t.Errorf("vs[%d] is %v, want %v", i, v.AUM.Hash(), want)
+		}
+		if v.Err != nil || len(v.Signatures) != 1 || v.Signatures[0].Err != nil {
+			t.Errorf("vs[%d]: got %+v; want one valid signature", i, v)
+		}
+	}
+	// Each AUM is read once walking back; verifying must not recompute
+	// the state from genesis for every one of them.
+	if storage.reads > 2*n {
+		t.Errorf("read %d AUMs verifying a chain of %d", storage.reads, n)
+	}
+
+	// A limited walk starts part way along the chain.
+	vs, err = VerifyChainSignatures(storage, aums[n-1].Hash(), 5)
+	if err != nil {
+		t.Fatalf("VerifyChainSignatures(5) failed: %v", err)
+	}
+	if len(vs) != 5 {
+		t.Fatalf("got %d AUMs, want 5", len(vs))
+	}
+	for i, v := range vs {
+		if v.Err != nil || len(v.Signatures) != 1 || v.Signatures[0].Err != nil {
+			t.Errorf("vs[%d]: got %+v; want one valid signature", i, v)
+		}
+	}
+}
@@ -23,6 +23,7 @@
 
 	"tailscale.com/control/controlknobs"
 	"tailscale.com/ipn"
+	"tailscale.com/ipn/ipnstate"
 	"tailscale.com/net/dns"
 	"tailscale.com/net/netmon"
 	"tailscale.com/net/tsdial"
@@ -56,6 +57,9 @@ type System struct {
 // references LocalBackend, and LocalBackend has a tsd.System.
 type NetstackImpl interface {
 	UpdateNetstackIPs(*netmap.NetworkMap)
+
+	// Conns returns the flows that netstack currently forwards.
+	Conns() []ipnstate.NetstackConn
 }
 
 // Set is a convenience method to set a subsystem value.
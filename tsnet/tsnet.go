@@ -11,6 +11,7 @@
 	crand "crypto/rand"
 	"crypto/tls"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -30,7 +31,9 @@
 
 	"tailscale.com/client/tailscale"
 	"tailscale.com/control/controlclient"
+	"tailscale.com/derp/derpembed"
 	"tailscale.com/envknob"
+	"tailscale.com/health"
 	"tailscale.com/hostinfo"
 	"tailscale.com/ipn"
 	"tailscale.com/ipn/ipnlocal"
@@ -45,6 +48,7 @@
 	"tailscale.com/net/netmon"
 	"tailscale.com/net/proxymux"
 	"tailscale.com/net/socks5"
+	"tailscale.com/net/tsaddr"
 	"tailscale.com/net/tsdial"
 	"tailscale.com/smallzstd"
 	"tailscale.com/tsd"
@@ -61,6 +65,13 @@
 // Server is an embedded Tailscale server.
 //
 // Its exported fields may be changed until the first method call.
+//
+// Several Servers can run in one process, each with its own node identity,
+// state, network stack and listeners, as long as they have distinct Dirs
+// (or Stores) and Ports. Setting Namespace tells their local logs apart.
+// What remains process-wide: health warnings, which all Servers report
+// (see HealthHandler), and client metrics, which only one Server at a time
+// uploads with its logs.
 type Server struct {
 	// Dir specifies the name of the directory to use for
 	// state. If empty, a directory is selected automatically
@@ -92,6 +103,13 @@ type Server struct {
 	// log.Printf is used.
 	Logf logger.Logf
 
+	// Namespace, if non-empty, names this Server among others running
+	// in the same process. The lines it logs to Logf, or log.Printf,
+	// are prefixed with "Namespace: ". The logs uploaded to
+	// log.tailscale.io are already separate per Server and aren't
+	// prefixed.
+	Namespace string
+
 	// Ephemeral, if true, specifies that the instance should register
 	// as an Ephemeral node (https://tailscale.com/s/ephemeral-nodes).
 	Ephemeral bool
@@ -112,6 +130,40 @@ type Server struct {
 	// field at zero unless you know what you are doing.
 	Port uint16
 
+	// DERP, if non-nil, configures a DERP relay, and optionally a STUN
+	// server, to run alongside the server, for use in a custom DERP map.
+	// They listen on the host's network, not on the tailnet. If its Logf
+	// is nil, Logf is used.
+	DERP *derpembed.Config
+
+	// GetCertificate, if non-nil, provides the TLS certificates of the
+	// listeners returned by ListenTLS and ListenFunnel, instead of the
+	// Let's Encrypt certificates that Tailscale provisions for the
+	// tailnet's HTTPS domain. It's for deployments whose clients trust a
+	// private CA. Clients of ListenFunnel listeners are on the internet,
+	// so they must also trust its certificates.
+	GetCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+
+	// CertDir, if non-empty and GetCertificate is nil, is a directory
+	// that provides the TLS certificates of ListenTLS and ListenFunnel
+	// listeners, as with GetCertificate. For a TLS server name NAME, it
+	// must contain the PEM-encoded certificate chain NAME.crt and private
+	// key NAME.key. Files are reloaded when they change, so they can be
+	// renewed without restarting. Connections without a server name use
+	// the node's MagicDNS name.
+	CertDir string
+
+	// AdvertiseRoutes, if non-empty, are subnet routes to advertise to
+	// the tailnet. Once the routes are approved in the admin panel, the
+	// server acts as a subnet router: connections from peers to addresses
+	// in the routes that no Listen call claims are forwarded through the
+	// host's network stack, on behalf of the process embedding tsnet.
+	AdvertiseRoutes []netip.Prefix
+
+	// AdvertiseExitNode, if true, offers the server as an exit node for
+	// internet traffic, forwarded the same way as AdvertiseRoutes.
+	AdvertiseExitNode bool
+
 	getCertForTesting func(*tls.ClientHelloInfo) (*tls.Certificate, error)
 
 	initOnce         sync.Once
@@ -129,6 +181,7 @@ type Server struct {
 	localAPIListener net.Listener           // in-memory, used by localClient
 	localClient      *tailscale.LocalClient // in-memory
 	localAPIServer   *http.Server
+	derpServer       *derpembed.Server // or nil
 	logbuffer        *filch.Filch
 	logtail          *logtail.Logger
 	logid            logid.PublicID
@@ -137,6 +190,7 @@ type Server struct {
 	listeners map[listenKey]*listener
 	dialer    *tsdial.Dialer
 	closed    bool
+	dirCerts  map[string]*dirCert // from CertDir, keyed by server name
 }
 
 // Dial connects to the address on the tailnet.
@@ -371,12 +425,16 @@ func (s *Server) Close() error {
 	if s.loopbackListener != nil {
 		s.loopbackListener.Close()
 	}
+	if s.derpServer != nil {
+		s.derpServer.Close()
+	}
 
 	for _, ln := range s.listeners {
 		ln.closeLocked()
 	}
 
 	wg.Wait()
+	s.releaseMetricsUpload() // after the final log flush
 	s.closed = true
 	return nil
 }
@@ -423,6 +481,107 @@ func (s *Server) TailscaleIPs() (ip4, ip6 netip.Addr) {
 	return ip4, ip6
 }
 
+// HealthStatus is the JSON body written by the handler returned by
+// Server.HealthHandler.
+type HealthStatus struct {
+	// Healthy is whether the server is running, connected to the control
+	// plane, has a recent netmap and an unexpired node key. It's true iff
+	// the handler responded with 200 OK.
+	Healthy bool
+
+	// BackendState is the ipn.State of the server, such as "Running" or
+	// "NeedsLogin".
+	BackendState string
+
+	// ControlConnected is whether the server has an open long poll to the
+	// control plane.
+	ControlConnected bool
+
+	// NetMapAge is how long ago the control plane last sent a map
+	// response (including keep-alives), confirming the netmap is current.
+	// It's empty if no map response has been received.
+	NetMapAge string `json:",omitempty"`
+
+	// KeyExpiry is when the node key expires. It's the zero time if the
+	// key doesn't expire or the server has no netmap.
+	KeyExpiry time.Time `json:",omitempty"`
+
+	// Problems lists why the server isn't healthy, as well as any other
+	// health warnings.
+	Problems []string `json:",omitempty"`
+}
+
+// maxNetMapAge is how long after the last map response from control the
+// netmap is considered stale by HealthHandler. Control sends keep-alives
+// more frequently than this.
+const maxNetMapAge = 5 * time.Minute
+
+// HealthHandler returns an HTTP handler that reports the health of s as a
+// JSON-encoded HealthStatus, with status 200 OK if it's healthy and 503
+// Service Unavailable otherwise. It's meant to be mounted on a service's
+// existing liveness or readiness endpoint.
+//
+// The handler starts the server if it has not been started yet.
+//
+// Control connectivity and health warnings are tracked per process, so
+// they're shared by all Servers in a binary.
+func (s *Server) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		st := s.healthStatus(time.Now())
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if st.Healthy {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		e.Encode(st)
+	})
+}
+
+func (s *Server) healthStatus(now time.Time) *HealthStatus {
+	st := &HealthStatus{BackendState: ipn.NoState.String()}
+	if err := s.Start(); err != nil {
+		st.Problems = append(st.Problems, fmt.Sprintf("server failed to start: %v", err))
+		return st
+	}
+	state := s.lb.State()
+	st.BackendState = state.String()
+	if state != ipn.Running {
+		st.Problems = append(st.Problems, fmt.Sprintf("backend state is %v", state))
+	}
+
+	st.ControlConnected = health.GetInPollNetMap()
+	if !st.ControlConnected {
+		st.Problems = append(st.Problems, "not connected to control")
+	}
+
+	if t := health.GetLastStreamedMapResponse(); !t.IsZero() {
+		age := now.Sub(t)
+		st.NetMapAge = age.Round(time.Second).String()
+		if age > maxNetMapAge {
+			st.Problems = append(st.Problems, fmt.Sprintf("netmap is stale, last map response %v ago", st.NetMapAge))
+		}
+	}
+
+	if nm := s.lb.NetMap(); nm == nil {
+		st.Problems = append(st.Problems, "no netmap")
+	} else if nm.SelfNode.Valid() {
+		st.KeyExpiry = nm.SelfNode.KeyExpiry()
+		if !st.KeyExpiry.IsZero() && !now.Before(st.KeyExpiry) {
+			st.Problems = append(st.Problems, "node key expired")
+		}
+	}
+
+	st.Healthy = len(st.Problems) == 0
+	if err := health.OverallError(); err != nil {
+		st.Problems = append(st.Problems, err.Error())
+	}
+	return st
+}
+
 func (s *Server) getAuthKey() string {
 	if v := s.AuthKey; v != "" {
 		return v
@@ -496,6 +655,18 @@ func (s *Server) start() (reterr error) {
 	}
 	closePool.add(s.netMon)
 
+	if s.DERP != nil {
+		cfg := *s.DERP
+		if cfg.Logf == nil {
+			cfg.Logf = logf
+		}
+		s.derpServer, err = derpembed.Start(cfg)
+		if err != nil {
+			return err
+		}
+		closePool.add(s.derpServer)
+	}
+
 	sys := new(tsd.System)
 	s.dialer = &tsdial.Dialer{Logf: logf} // mutated below (before used)
 	eng, err := wgengine.NewUserspaceEngine(logf, wgengine.Config{
@@ -517,6 +688,7 @@ func (s *Server) start() (reterr error) {
 	}
 	sys.Set(ns)
 	ns.ProcessLocalIPs = true
+	ns.ProcessSubnets = s.routesAdvertised()
 	ns.GetTCPHandlerForFlow = s.getTCPHandlerForFlow
 	ns.GetUDPHandlerForFlow = s.getUDPHandlerForFlow
 	s.netstack = ns
@@ -558,6 +730,7 @@ func (s *Server) start() (reterr error) {
 	prefs.Hostname = s.hostname
 	prefs.WantRunning = true
 	prefs.ControlURL = s.ControlURL
+	prefs.AdvertiseRoutes = s.advertisedRoutes()
 	authKey := s.getAuthKey()
 	err = lb.Start(ipn.Options{
 		UpdatePrefs: prefs,
@@ -632,8 +805,11 @@ func (s *Server) startLogger(closePool *closeOnErrorPool) error {
 			}
 			return w
 		},
-		HTTPC:        &http.Client{Transport: logpolicy.NewLogtailTransport(logtail.DefaultHost, s.netMon, s.logf)},
-		MetricsDelta: clientmetric.EncodeLogTailMetricsDelta,
+		HTTPC: &http.Client{Transport: logpolicy.NewLogtailTransport(logtail.DefaultHost, s.netMon, s.logf)},
+	}
+	if s.claimMetricsUpload() {
+		c.MetricsDelta = clientmetric.EncodeLogTailMetricsDelta
+		closePool.addFunc(s.releaseMetricsUpload)
 	}
 	s.logtail = logtail.NewLogger(c, s.logf)
 	closePool.addFunc(func() { s.logtail.Shutdown(context.Background()) })
@@ -652,10 +828,45 @@ func (p closeOnErrorPool) closeAllIfError(errp *error) {
 	}
 }
 
+// metricsUploader is the Server, if any, whose logs carry the process's
+// client metrics. The metrics are process-wide, and each upload is the
+// delta since the previous one, so two Servers uploading them would each
+// get only part of the changes.
+var metricsUploader struct {
+	mu sync.Mutex
+	s  *Server // or nil
+}
+
+// claimMetricsUpload reports whether s is to upload the process's client
+// metrics, which it is if no other running Server does.
+func (s *Server) claimMetricsUpload() bool {
+	metricsUploader.mu.Lock()
+	defer metricsUploader.mu.Unlock()
+	if metricsUploader.s != nil && metricsUploader.s != s {
+		return false
+	}
+	metricsUploader.s = s
+	return true
+}
+
+// releaseMetricsUpload lets the next Server to start upload the process's
+// client metrics, if s was uploading them.
+func (s *Server) releaseMetricsUpload() {
+	metricsUploader.mu.Lock()
+	defer metricsUploader.mu.Unlock()
+	if metricsUploader.s == s {
+		metricsUploader.s = nil
+	}
+}
+
 func (s *Server) logf(format string, a ...any) {
 	if s.logtail != nil {
 		s.logtail.Logf(format, a...)
 	}
+	if s.Namespace != "" {
+		format = "%s: " + format
+		a = append([]any{s.Namespace}, a...)
+	}
 	if s.Logf != nil {
 		s.Logf(format, a...)
 		return
@@ -753,6 +964,9 @@ func (s *Server) getTCPHandlerForFunnelFlow(src netip.AddrPort, dstPort uint16)
 }
 
 func (s *Server) getTCPHandlerForFlow(src, dst netip.AddrPort) (handler func(net.Conn), intercept bool) {
+	if s.isSubnetFlow(dst) {
+		return nil, false // let netstack forward it
+	}
 	ln, ok := s.listenerForDstAddr("tcp", dst, false)
 	if !ok {
 		return nil, true // don't handle, don't forward to localhost
@@ -761,6 +975,9 @@ func (s *Server) getTCPHandlerForFlow(src, dst netip.AddrPort) (handler func(net
 }
 
 func (s *Server) getUDPHandlerForFlow(src, dst netip.AddrPort) (handler func(nettype.ConnPacketConn), intercept bool) {
+	if s.isSubnetFlow(dst) {
+		return nil, false // let netstack forward it
+	}
 	ln, ok := s.listenerForDstAddr("udp", dst, false)
 	if !ok {
 		return nil, true // don't handle, don't forward to localhost
@@ -768,6 +985,37 @@ func (s *Server) getUDPHandlerForFlow(src, dst netip.AddrPort) (handler func(net
 	return func(c nettype.ConnPacketConn) { ln.handle(c) }, true
 }
 
+// routesAdvertised reports whether s is configured to act as a subnet
+// router or exit node.
+func (s *Server) routesAdvertised() bool {
+	return len(s.AdvertiseRoutes) > 0 || s.AdvertiseExitNode
+}
+
+// advertisedRoutes returns the routes s advertises to the tailnet,
+// including the exit node routes if s.AdvertiseExitNode is set.
+func (s *Server) advertisedRoutes() []netip.Prefix {
+	routes := slices.Clone(s.AdvertiseRoutes)
+	if s.AdvertiseExitNode {
+		for _, r := range tsaddr.ExitRoutes() {
+			if !slices.Contains(routes, r) {
+				routes = append(routes, r)
+			}
+		}
+	}
+	return routes
+}
+
+// isSubnetFlow reports whether a flow to dst is subnet router or exit node
+// traffic that netstack should forward, rather than traffic to one of the
+// server's own Tailscale IPs that listeners handle.
+func (s *Server) isSubnetFlow(dst netip.AddrPort) bool {
+	if !s.routesAdvertised() {
+		return false
+	}
+	ip4, ip6 := s.TailscaleIPs()
+	return dst.Addr() != ip4 && dst.Addr() != ip6
+}
+
 // getTSNetDir usually just returns filepath.Join(confDir, "tsnet-"+prog)
 // with no error.
 //
@@ -829,10 +1077,40 @@ func (s *Server) APIClient() (*tailscale.Client, error) {
 
 // Listen announces only on the Tailscale network.
 // It will start the server if it has not been started yet.
+//
+// If the host part of addr is empty, the listener accepts connections to
+// all of the node's Tailscale IPs. To accept connections to only one of
+// them, see ListenAddr.
 func (s *Server) Listen(network, addr string) (net.Listener, error) {
 	return s.listen(network, addr, listenOnTailnet)
 }
 
+// ListenAddr is like Listen, but announces only on addr, which must be one
+// of the node's Tailscale IPs, such as only its IPv4 or IPv6 address.
+//
+// A listener on a specific address takes precedence over a listener on the
+// same port from Listen with an empty host, so the port of each address of
+// a node with several addresses can be used for a different service.
+// It will start the server if it has not been started yet.
+func (s *Server) ListenAddr(network string, addr netip.AddrPort) (net.Listener, error) {
+	if err := checkListenAddr(addr); err != nil {
+		return nil, err
+	}
+	return s.listen(network, addr.String(), listenOnTailnet)
+}
+
+// checkListenAddr reports an error if addr can't be one of the node's
+// Tailscale IP and ports to listen on.
+func checkListenAddr(addr netip.AddrPort) error {
+	if !tsaddr.IsTailscaleIP(addr.Addr()) {
+		return fmt.Errorf("tsnet: %v is not a Tailscale IP", addr.Addr())
+	}
+	if addr.Port() == 0 {
+		return fmt.Errorf("tsnet: port of %v must be non-zero", addr)
+	}
+	return nil
+}
+
 // ListenTLS announces only on the Tailscale network.
 // It returns a TLS listener wrapping the tsnet listener.
 // It will start the server if it has not been started yet.
@@ -840,13 +1118,29 @@ func (s *Server) ListenTLS(network, addr string) (net.Listener, error) {
 	if network != "tcp" {
 		return nil, fmt.Errorf("ListenTLS(%q, %q): only tcp is supported", network, addr)
 	}
+	return s.listenTLS(network, addr)
+}
+
+// ListenTLSAddr is like ListenTLS, but announces only on addr, which must be
+// one of the node's Tailscale IPs. See ListenAddr.
+func (s *Server) ListenTLSAddr(network string, addr netip.AddrPort) (net.Listener, error) {
+	if network != "tcp" {
+		return nil, fmt.Errorf("ListenTLSAddr(%q, %v): only tcp is supported", network, addr)
+	}
+	if err := checkListenAddr(addr); err != nil {
+		return nil, err
+	}
+	return s.listenTLS(network, addr.String())
+}
+
+func (s *Server) listenTLS(network, addr string) (net.Listener, error) {
 	ctx := context.Background()
 	st, err := s.Up(ctx)
 	if err != nil {
 		return nil, err
 	}
-	if len(st.CertDomains) == 0 {
-		return nil, errors.New("tsnet: you must enable HTTPS in the admin panel to proceed. See https://tailscale.com/s/https")
+	if len(st.CertDomains) == 0 && !s.hasCustomCerts() {
+		return nil, errors.New("tsnet: you must enable HTTPS in the admin panel to proceed, or set Server.GetCertificate or Server.CertDir. See https://tailscale.com/s/https")
 	}
 
 	ln, err := s.listen(network, addr, listenOnTailnet)
@@ -858,14 +1152,28 @@ func (s *Server) ListenTLS(network, addr string) (net.Listener, error) {
 	}), nil
 }
 
+// hasCustomCerts reports whether s has TLS certificates other than those
+// from Tailscale.
+func (s *Server) hasCustomCerts() bool {
+	return s.GetCertificate != nil || s.CertDir != ""
+}
+
 // getCert is the GetCertificate function used by ListenTLS.
 //
-// It calls GetCertificate on the localClient, passing in the ClientHelloInfo.
-// For testing, if s.getCertForTesting is set, it will call that instead.
+// It calls s.GetCertificate if set, or else loads the certificate from
+// s.CertDir if set, or else calls GetCertificate on the localClient, passing
+// in the ClientHelloInfo. For testing, if s.getCertForTesting is set, it will
+// call that instead.
 func (s *Server) getCert(hi *tls.ClientHelloInfo) (*tls.Certificate, error) {
 	if s.getCertForTesting != nil {
 		return s.getCertForTesting(hi)
 	}
+	if s.GetCertificate != nil {
+		return s.GetCertificate(hi)
+	}
+	if s.CertDir != "" {
+		return s.getCertFromDir(hi)
+	}
 	lc, err := s.LocalClient()
 	if err != nil {
 		return nil, err
@@ -873,6 +1181,55 @@ func (s *Server) getCert(hi *tls.ClientHelloInfo) (*tls.Certificate, error) {
 	return lc.GetCertificate(hi)
 }
 
+// dirCert is a certificate loaded from Server.CertDir.
+type dirCert struct {
+	cert           *tls.Certificate
+	crtMod, keyMod time.Time // modification times of the files it was loaded from
+}
+
+// getCertFromDir returns the certificate in s.CertDir for the server name of
+// hi, loading it if it's not yet loaded or changed on disk.
+func (s *Server) getCertFromDir(hi *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := strings.ToLower(hi.ServerName)
+	if name == "" {
+		if nm := s.lb.NetMap(); nm != nil && nm.SelfNode.Valid() {
+			name = strings.TrimSuffix(nm.SelfNode.Name(), ".")
+		}
+		if name == "" {
+			return nil, errors.New("tsnet: no TLS server name")
+		}
+	}
+	if strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return nil, fmt.Errorf("tsnet: invalid TLS server name %q", name)
+	}
+	crtFile := filepath.Join(s.CertDir, name+".crt")
+	keyFile := filepath.Join(s.CertDir, name+".key")
+	crtStat, err := os.Stat(crtFile)
+	if err != nil {
+		return nil, fmt.Errorf("tsnet: no certificate for %q: %w", name, err)
+	}
+	keyStat, err := os.Stat(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("tsnet: no private key for %q: %w", name, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if dc, ok := s.dirCerts[name]; ok && dc.crtMod.Equal(crtStat.ModTime()) && dc.keyMod.Equal(keyStat.ModTime()) {
+		return dc.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(crtFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("tsnet: loading certificate for %q: %w", name, err)
+	}
+	mak.Set(&s.dirCerts, name, &dirCert{
+		cert:   &cert,
+		crtMod: crtStat.ModTime(),
+		keyMod: keyStat.ModTime(),
+	})
+	return &cert, nil
+}
+
 // FunnelOption is an option passed to ListenFunnel to configure the listener.
 type FunnelOption interface {
 	funnelOption()
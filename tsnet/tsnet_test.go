@@ -12,6 +12,8 @@
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"flag"
 	"fmt"
@@ -23,6 +25,7 @@
 	"net/netip"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"sync"
 	"testing"
@@ -33,6 +36,7 @@
 	"tailscale.com/ipn"
 	"tailscale.com/ipn/store/mem"
 	"tailscale.com/net/netns"
+	"tailscale.com/net/tsaddr"
 	"tailscale.com/tailcfg"
 	"tailscale.com/tstest"
 	"tailscale.com/tstest/integration"
@@ -90,6 +94,47 @@ func TestListenerPort(t *testing.T) {
 	}
 }
 
+func TestListenAddr(t *testing.T) {
+	s := &Server{}
+	s.initOnce.Do(func() {}) // don't start
+
+	for _, addr := range []string{"1.2.3.4:80", "100.64.0.1:0"} {
+		if _, err := s.ListenAddr("tcp", netip.MustParseAddrPort(addr)); err == nil {
+			t.Errorf("ListenAddr(%q) succeeded, want error", addr)
+		}
+	}
+
+	v4 := netip.MustParseAddrPort("100.64.0.1:80")
+	v6 := netip.MustParseAddrPort("[fd7a:115c:a1e0::1]:80")
+	lnAll := must.Get(s.Listen("tcp", ":80"))
+	defer lnAll.Close()
+	ln4 := must.Get(s.ListenAddr("tcp", v4))
+	defer ln4.Close()
+	if _, err := s.ListenAddr("tcp", v4); err == nil {
+		t.Errorf("second ListenAddr(%v) succeeded, want error", v4)
+	}
+
+	for _, tt := range []struct {
+		dst  netip.AddrPort
+		want net.Listener
+	}{
+		{v4, ln4},
+		{v6, lnAll},
+		{netip.MustParseAddrPort("100.64.0.1:81"), nil},
+	} {
+		ln, ok := s.listenerForDstAddr("tcp", tt.dst, false)
+		if tt.want == nil {
+			if ok {
+				t.Errorf("listenerForDstAddr(%v) = %v, want none", tt.dst, ln.addr)
+			}
+			continue
+		}
+		if !ok || net.Listener(ln) != tt.want {
+			t.Errorf("listenerForDstAddr(%v) = %v, want %v", tt.dst, ln, tt.want.Addr())
+		}
+	}
+}
+
 var verboseDERP = flag.Bool("verbose-derp", false, "if set, print DERP and STUN logs")
 var verboseNodes = flag.Bool("verbose-nodes", false, "if set, print tsnet.Server logs")
 
@@ -198,6 +243,59 @@ func (tci *testCertIssuer) Pool() *x509.CertPool {
 
 var testCertRoot = newCertIssuer()
 
+func TestCertDir(t *testing.T) {
+	dir := t.TempDir()
+	s := &Server{CertDir: dir}
+	const name = "web.tail-scale.ts.net"
+
+	writeCert := func() *x509.Certificate {
+		t.Helper()
+		issuer := newCertIssuer()
+		cert, err := issuer.getCert(&tls.ClientHelloInfo{ServerName: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var crt []byte
+		for _, der := range cert.Certificate {
+			crt = append(crt, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+		}
+		keyDER, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+		must.Do(os.WriteFile(filepath.Join(dir, name+".crt"), crt, 0644))
+		must.Do(os.WriteFile(filepath.Join(dir, name+".key"), key, 0600))
+		return issuer.root
+	}
+	checkIssuer := func(root *x509.Certificate) {
+		t.Helper()
+		cert, err := s.getCert(&tls.ClientHelloInfo{ServerName: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := leaf.CheckSignatureFrom(root); err != nil {
+			t.Errorf("certificate not from expected issuer: %v", err)
+		}
+	}
+
+	checkIssuer(writeCert())
+
+	// Renewing the certificate on disk is picked up.
+	time.Sleep(10 * time.Millisecond) // for a different mtime
+	checkIssuer(writeCert())
+
+	for _, bad := range []string{"other.tail-scale.ts.net", "../" + name, ".hidden"} {
+		if _, err := s.getCert(&tls.ClientHelloInfo{ServerName: bad}); err == nil {
+			t.Errorf("getCert(%q) succeeded; want error", bad)
+		}
+	}
+}
+
 func startServer(t *testing.T, ctx context.Context, controlURL, hostname string) (*Server, netip.Addr) {
 	t.Helper()
 
@@ -447,6 +545,107 @@ func TestTailscaleIPs(t *testing.T) {
 	}
 }
 
+func TestAdvertiseRoutes(t *testing.T) {
+	controlURL := startControl(t)
+
+	tmp := filepath.Join(t.TempDir(), "s1")
+	os.MkdirAll(tmp, 0755)
+	route := netip.MustParsePrefix("192.168.77.0/24")
+	s1 := &Server{
+		Dir:               tmp,
+		ControlURL:        controlURL,
+		Hostname:          "s1",
+		Store:             new(mem.Store),
+		Ephemeral:         true,
+		AdvertiseRoutes:   []netip.Prefix{route},
+		AdvertiseExitNode: true,
+	}
+	if !*verboseNodes {
+		s1.Logf = logger.Discard
+	}
+	defer s1.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := s1.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	lc, err := s1.LocalClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefs, err := lc.GetPrefs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append([]netip.Prefix{route}, tsaddr.ExitRoutes()...)
+	if !reflect.DeepEqual(prefs.AdvertiseRoutes, want) {
+		t.Errorf("AdvertiseRoutes = %v; want %v", prefs.AdvertiseRoutes, want)
+	}
+	if !s1.netstack.ProcessSubnets {
+		t.Error("netstack isn't processing subnet traffic")
+	}
+
+	ip4, ip6 := s1.TailscaleIPs()
+	for _, tt := range []struct {
+		dst  netip.Addr
+		want bool
+	}{
+		{ip4, false},
+		{ip6, false},
+		{netip.MustParseAddr("192.168.77.10"), true},
+		{netip.MustParseAddr("8.8.8.8"), true},
+	} {
+		if got := s1.isSubnetFlow(netip.AddrPortFrom(tt.dst, 80)); got != tt.want {
+			t.Errorf("isSubnetFlow(%v) = %v; want %v", tt.dst, got, tt.want)
+		}
+	}
+}
+
+func TestHealthHandler(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	controlURL := startControl(t)
+	s1, _ := startServer(t, ctx, controlURL, "s1")
+
+	h := s1.HealthHandler()
+	var st HealthStatus
+	for {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+		if got := rec.Header().Get("Content-Type"); got != "application/json" {
+			t.Fatalf("Content-Type = %q; want application/json", got)
+		}
+		st = HealthStatus{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &st); err != nil {
+			t.Fatal(err)
+		}
+		if st.Healthy != (rec.Code == http.StatusOK) {
+			t.Fatalf("Healthy = %v with status %d", st.Healthy, rec.Code)
+		}
+		if st.Healthy {
+			break
+		}
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Fatalf("status = %d; want %d", rec.Code, http.StatusServiceUnavailable)
+		}
+		if ctx.Err() != nil {
+			t.Fatalf("never became healthy; last status: %+v", st)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if st.BackendState != ipn.Running.String() {
+		t.Errorf("BackendState = %q; want %q", st.BackendState, ipn.Running)
+	}
+	if !st.ControlConnected {
+		t.Error("ControlConnected = false; want true")
+	}
+	if st.NetMapAge == "" {
+		t.Error("NetMapAge is empty")
+	}
+}
+
 // TestListenerCleanup is a regression test to verify that s.Close doesn't
 // deadlock if a listener is still open.
 func TestListenerCleanup(t *testing.T) {
@@ -578,3 +777,44 @@ type bufferedConn struct {
 func (c *bufferedConn) Read(b []byte) (int, error) {
 	return c.reader.Read(b)
 }
+
+func TestMetricsUpload(t *testing.T) {
+	uploader := func() *Server {
+		metricsUploader.mu.Lock()
+		defer metricsUploader.mu.Unlock()
+		return metricsUploader.s
+	}
+	s1, s2 := new(Server), new(Server)
+	if !s1.claimMetricsUpload() || !s1.claimMetricsUpload() {
+		t.Fatal("first server can't upload metrics")
+	}
+	if s2.claimMetricsUpload() {
+		t.Fatal("second server can upload metrics too")
+	}
+	s2.releaseMetricsUpload()
+	if got := uploader(); got != s1 {
+		t.Fatalf("uploader after releasing non-uploader = %p; want %p", got, s1)
+	}
+	s1.releaseMetricsUpload()
+	if !s2.claimMetricsUpload() {
+		t.Fatal("second server can't take over the metrics upload")
+	}
+	s2.releaseMetricsUpload()
+	if got := uploader(); got != nil {
+		t.Fatalf("uploader = %p; want nil", got)
+	}
+}
+
+func TestNamespaceLogs(t *testing.T) {
+	var lines []string
+	s := &Server{
+		Namespace: "ns",
+		Logf: func(format string, a ...any) {
+			lines = append(lines, fmt.Sprintf(format, a...))
+		},
+	}
+	s.logf("hello %d", 1)
+	if want := []string{"ns: hello 1"}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("logged %q; want %q", lines, want)
+	}
+}
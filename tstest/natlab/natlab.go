@@ -200,6 +200,10 @@ func (n *Network) write(p *Packet) (num int, err error) {
 		iface = n.defaultGW
 	}
 
+	if iface.dropOnLink(p) {
+		return len(p.Payload), nil
+	}
+
 	// Pretend it went across the network. Make a copy so nobody
 	// can later mess with caller's memory.
 	p.Trace("-> mach=%s if=%s", iface.machine.Name, iface.name)
@@ -212,6 +216,58 @@ type Interface struct {
 	net     *Network
 	name    string       // optional
 	ips     []netip.Addr // static; not mutated once created
+
+	linkMu sync.Mutex
+	link   Link
+	rnd    *rand.Rand // for link.LossRate; nil if zero
+}
+
+// Link describes the impairments of the link between an Interface and
+// its Network. They apply to packets in both directions.
+type Link struct {
+	// LossRate is the probability, from 0 to 1, that the link drops
+	// a packet.
+	LossRate float64
+	// MTU is the largest IP packet, in bytes, that the link carries.
+	// Larger packets are dropped, as there's no fragmentation. Zero
+	// means no limit.
+	MTU int
+	// Seed seeds the random source of packet loss, to make runs
+	// reproducible.
+	Seed int64
+}
+
+// SetLink sets the impairments of f's link to its network.
+func (f *Interface) SetLink(l Link) {
+	f.linkMu.Lock()
+	defer f.linkMu.Unlock()
+	f.link = l
+	f.rnd = nil
+	if l.LossRate > 0 {
+		f.rnd = rand.New(rand.NewSource(l.Seed))
+	}
+}
+
+// dropOnLink reports whether f's link drops p.
+func (f *Interface) dropOnLink(p *Packet) bool {
+	f.linkMu.Lock()
+	defer f.linkMu.Unlock()
+	if mtu := f.link.MTU; mtu > 0 {
+		// IP and UDP header sizes.
+		size := len(p.Payload) + 20 + 8
+		if p.Dst.Addr().Is6() {
+			size += 20
+		}
+		if size > mtu {
+			p.Trace("drop, %d bytes exceeds MTU %d of if=%s", size, mtu, f)
+			return true
+		}
+	}
+	if f.rnd != nil && f.rnd.Float64() < f.link.LossRate {
+		p.Trace("drop, lost on if=%s", f)
+		return true
+	}
+	return false
 }
 
 func (f *Interface) Machine() *Machine {
@@ -438,6 +494,9 @@ func (m *Machine) forwardPacket(p *Packet, iif *Interface) {
 		return
 	}
 
+	if oif.dropOnLink(p) {
+		return
+	}
 	p.Trace("-> net=%s oif=%s", oif.net.Name, oif)
 	oif.net.write(p)
 }
@@ -557,6 +616,9 @@ func (m *Machine) writePacket(p *Packet) (n int, err error) {
 		}
 	}
 
+	if iface.dropOnLink(p) {
+		return len(p.Payload), nil
+	}
 	p.Trace("-> net=%s if=%s", iface.net.Name, iface)
 	return iface.net.write(p)
 }
@@ -0,0 +1,294 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package natlab
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/netip"
+	"os"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Scenario describes a virtual network: its networks, the machines
+// attached to them, the NATs and firewalls of those machines, and the
+// impairments of each link. Scenarios are written in YAML, so that
+// reported NAT traversal failures can be reproduced in tests without
+// writing Go. See testdata/scenario.yaml for an example.
+type Scenario struct {
+	// Name is a description of the scenario, for logs.
+	Name string `json:"name"`
+	// Seed seeds the random source of packet loss on all links. Runs
+	// of the same scenario with the same seed lose the same packets,
+	// given the same traffic.
+	Seed int64 `json:"seed"`
+	// Networks are the networks other than "internet", which every
+	// scenario has, as returned by NewInternet.
+	Networks []ScenarioNetwork `json:"networks"`
+	// Machines are the machines of the scenario. Their interfaces are
+	// attached in order, so the first one is their default route.
+	Machines []ScenarioMachine `json:"machines"`
+}
+
+// ScenarioNetwork describes a Network of a Scenario.
+type ScenarioNetwork struct {
+	Name    string       `json:"name"`
+	Prefix4 netip.Prefix `json:"prefix4"`
+	Prefix6 netip.Prefix `json:"prefix6"`
+	// Gateway, if non-empty, is the name of the machine whose
+	// interface on this network is the network's default gateway.
+	Gateway string `json:"gateway"`
+}
+
+// ScenarioMachine describes a Machine of a Scenario.
+type ScenarioMachine struct {
+	Name       string              `json:"name"`
+	Interfaces []ScenarioInterface `json:"interfaces"`
+	// NAT, if non-nil, makes the machine a NAT.
+	NAT *ScenarioNAT `json:"nat"`
+	// Firewall, if non-empty, is the FirewallType of the machine's
+	// stateful firewall, as named by ParseFirewallType. NATs always
+	// have a firewall, which defaults to "address-and-port-dependent".
+	Firewall string `json:"firewall"`
+}
+
+// ScenarioNAT describes the SNAT44 of a ScenarioMachine.
+type ScenarioNAT struct {
+	// Type is the NATType, as named by ParseNATType.
+	Type string `json:"type"`
+	// WAN is the name of the NAT's external interface. The NAT's
+	// firewall trusts its only other interface.
+	WAN string `json:"wan"`
+}
+
+// ScenarioInterface describes an Interface of a ScenarioMachine.
+type ScenarioInterface struct {
+	Name string `json:"name"`
+	// Network is the name of the network the interface is attached to.
+	Network string `json:"network"`
+	// Loss is the probability, from 0 to 1, that the interface's link
+	// drops a packet. See Link.LossRate.
+	Loss float64 `json:"loss"`
+	// MTU is the MTU of the interface's link, or 0 for no limit. See
+	// Link.MTU.
+	MTU int `json:"mtu"`
+}
+
+// LoadScenario reads the YAML Scenario in the file at path.
+func LoadScenario(path string) (*Scenario, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s, err := ParseScenario(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// ParseScenario parses the YAML Scenario in b.
+func ParseScenario(b []byte) (*Scenario, error) {
+	s := new(Scenario)
+	if err := yaml.UnmarshalStrict(b, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ParseNATType returns the NATType with the given name: one of
+// "endpoint-independent", "address-dependent" and
+// "address-and-port-dependent".
+func ParseNATType(name string) (NATType, error) {
+	switch name {
+	case "endpoint-independent":
+		return EndpointIndependentNAT, nil
+	case "address-dependent":
+		return AddressDependentNAT, nil
+	case "address-and-port-dependent":
+		return AddressAndPortDependentNAT, nil
+	}
+	return 0, fmt.Errorf("unknown NAT type %q", name)
+}
+
+// ParseFirewallType returns the FirewallType with the given name: one
+// of "endpoint-independent", "address-dependent" and
+// "address-and-port-dependent".
+func ParseFirewallType(name string) (FirewallType, error) {
+	switch name {
+	case "endpoint-independent":
+		return EndpointIndependentFirewall, nil
+	case "address-dependent":
+		return AddressDependentFirewall, nil
+	case "address-and-port-dependent":
+		return AddressAndPortDependentFirewall, nil
+	}
+	return 0, fmt.Errorf("unknown firewall type %q", name)
+}
+
+// Lab is a virtual network built from a Scenario.
+type Lab struct {
+	networks map[string]*Network
+	machines map[string]*Machine
+	ifaces   map[string][]*Interface // by machine name, in order
+}
+
+// Network returns the network with the given name, or nil if none.
+func (l *Lab) Network(name string) *Network { return l.networks[name] }
+
+// Machine returns the machine with the given name, or nil if none.
+func (l *Lab) Machine(name string) *Machine { return l.machines[name] }
+
+// Interface returns the named interface of the named machine, or nil if
+// none.
+func (l *Lab) Interface(machine, name string) *Interface {
+	for _, f := range l.ifaces[machine] {
+		if f.name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// IP returns the first IPv4 address of the named machine, that of its
+// first interface, or the zero value if none.
+func (l *Lab) IP(machine string) netip.Addr {
+	fs := l.ifaces[machine]
+	if len(fs) == 0 {
+		return netip.Addr{}
+	}
+	return fs[0].V4()
+}
+
+// Build builds the virtual network that s describes.
+func (s *Scenario) Build() (*Lab, error) {
+	l := &Lab{
+		networks: map[string]*Network{"internet": NewInternet()},
+		machines: map[string]*Machine{},
+		ifaces:   map[string][]*Interface{},
+	}
+	for _, sn := range s.Networks {
+		if sn.Name == "" {
+			return nil, errors.New("network without a name")
+		}
+		if _, dup := l.networks[sn.Name]; dup {
+			return nil, fmt.Errorf("duplicate network %q", sn.Name)
+		}
+		l.networks[sn.Name] = &Network{
+			Name:    sn.Name,
+			Prefix4: sn.Prefix4,
+			Prefix6: sn.Prefix6,
+		}
+	}
+
+	for _, sm := range s.Machines {
+		if sm.Name == "" {
+			return nil, errors.New("machine without a name")
+		}
+		if _, dup := l.machines[sm.Name]; dup {
+			return nil, fmt.Errorf("duplicate machine %q", sm.Name)
+		}
+		m := &Machine{Name: sm.Name}
+		l.machines[sm.Name] = m
+		for _, si := range sm.Interfaces {
+			n := l.networks[si.Network]
+			if n == nil {
+				return nil, fmt.Errorf("machine %q: interface %q: unknown network %q", sm.Name, si.Name, si.Network)
+			}
+			if l.Interface(sm.Name, si.Name) != nil {
+				return nil, fmt.Errorf("machine %q: duplicate interface %q", sm.Name, si.Name)
+			}
+			f := m.Attach(si.Name, n)
+			f.SetLink(Link{
+				LossRate: si.Loss,
+				MTU:      si.MTU,
+				Seed:     s.Seed ^ linkSeed(sm.Name, si.Name),
+			})
+			l.ifaces[sm.Name] = append(l.ifaces[sm.Name], f)
+		}
+		h, err := l.packetHandler(sm)
+		if err != nil {
+			return nil, fmt.Errorf("machine %q: %w", sm.Name, err)
+		}
+		m.PacketHandler = h
+	}
+
+	for _, sn := range s.Networks {
+		if sn.Gateway == "" {
+			continue
+		}
+		var gw *Interface
+		for _, f := range l.ifaces[sn.Gateway] {
+			if f.net.Name == sn.Name {
+				gw = f
+				break
+			}
+		}
+		if gw == nil {
+			return nil, fmt.Errorf("network %q: gateway %q has no interface on it", sn.Name, sn.Gateway)
+		}
+		l.networks[sn.Name].SetDefaultGateway(gw)
+	}
+	return l, nil
+}
+
+// packetHandler returns the PacketHandler of the Machine for sm, which
+// must already be attached to its networks, or nil if none.
+func (l *Lab) packetHandler(sm ScenarioMachine) (PacketHandler, error) {
+	var fwType FirewallType
+	if sm.Firewall != "" {
+		var err error
+		if fwType, err = ParseFirewallType(sm.Firewall); err != nil {
+			return nil, err
+		}
+	}
+	if sm.NAT == nil {
+		if sm.Firewall == "" {
+			return nil, nil
+		}
+		return &Firewall{Type: fwType}, nil
+	}
+
+	natType, err := ParseNATType(sm.NAT.Type)
+	if err != nil {
+		return nil, err
+	}
+	wan := l.Interface(sm.Name, sm.NAT.WAN)
+	if wan == nil {
+		return nil, fmt.Errorf("NAT: unknown WAN interface %q", sm.NAT.WAN)
+	}
+	var lan *Interface
+	for _, f := range l.ifaces[sm.Name] {
+		if f == wan {
+			continue
+		}
+		if lan != nil {
+			return nil, errors.New("NAT: more than one LAN interface")
+		}
+		lan = f
+	}
+	if lan == nil {
+		return nil, errors.New("NAT: no LAN interface")
+	}
+	return &SNAT44{
+		Machine:           l.machines[sm.Name],
+		ExternalInterface: wan,
+		Type:              natType,
+		Firewall: &Firewall{
+			Type:             fwType,
+			TrustedInterface: lan,
+		},
+	}, nil
+}
+
+// linkSeed returns the part of the seed of the link of the named
+// interface that differs between links, so they don't all lose the same
+// packets.
+func linkSeed(machine, iface string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(machine + "/" + iface))
+	return int64(h.Sum64())
+}
@@ -0,0 +1,200 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package natlab
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScenario(t *testing.T) {
+	s, err := LoadScenario("testdata/scenario.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lab, err := s.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nat1, ok := lab.Machine("nat1").PacketHandler.(*SNAT44)
+	if !ok {
+		t.Fatalf("nat1 handler = %T; want *SNAT44", lab.Machine("nat1").PacketHandler)
+	}
+	if nat1.Type != AddressAndPortDependentNAT || nat1.ExternalInterface != lab.Interface("nat1", "wan") {
+		t.Errorf("nat1 = %+v; want address-and-port-dependent NAT on wan", nat1)
+	}
+	if fw := nat1.Firewall.(*Firewall); fw.TrustedInterface != lab.Interface("nat1", "lan") {
+		t.Errorf("nat1 firewall trusts %v; want lan", fw.TrustedInterface)
+	}
+	if fw, ok := lab.Machine("m1").PacketHandler.(*Firewall); !ok || fw.Type != AddressAndPortDependentFirewall {
+		t.Errorf("m1 handler = %#v; want address-and-port-dependent firewall", lab.Machine("m1").PacketHandler)
+	}
+	if h := lab.Machine("m2").PacketHandler; h != nil {
+		t.Errorf("m2 handler = %#v; want nil", h)
+	}
+
+	// m2 reaches the STUN server through nat2, which the STUN server
+	// sees it as.
+	ctx := context.Background()
+	stunAddr := netip.AddrPortFrom(lab.IP("stun"), 3478)
+	stunPC, err := lab.Machine("stun").ListenPacket(ctx, "udp4", stunAddr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stunPC.Close()
+	m2PC, err := lab.Machine("m2").ListenPacket(ctx, "udp4", netip.AddrPortFrom(lab.IP("m2"), 1234).String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m2PC.Close()
+	if _, err := m2PC.WriteTo([]byte("hello"), net.UDPAddrFromAddrPort(stunAddr)); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 100)
+	_, from, err := stunPC.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := from.(*net.UDPAddr).AddrPort().Addr(), lab.Interface("nat2", "wan").V4(); got != want {
+		t.Errorf("STUN server saw m2 as %v; want nat2's WAN address %v", got, want)
+	}
+}
+
+func TestScenarioErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{
+			name:    "unknown_field",
+			yaml:    "machines: [{name: m1, interfaces: [{name: eth0, network: internet, lossy: 1}]}]",
+			wantErr: "unknown field",
+		},
+		{
+			name:    "unknown_network",
+			yaml:    "machines: [{name: m1, interfaces: [{name: eth0, network: lan}]}]",
+			wantErr: `unknown network "lan"`,
+		},
+		{
+			name:    "bad_nat_type",
+			yaml:    "machines: [{name: n, nat: {type: easy, wan: wan}, interfaces: [{name: wan, network: internet}]}]",
+			wantErr: `unknown NAT type "easy"`,
+		},
+		{
+			name:    "nat_without_lan",
+			yaml:    "machines: [{name: n, nat: {type: endpoint-independent, wan: wan}, interfaces: [{name: wan, network: internet}]}]",
+			wantErr: "no LAN interface",
+		},
+		{
+			name:    "gateway_not_on_network",
+			yaml:    "networks: [{name: lan, prefix4: 10.0.0.0/24, gateway: m1}]\nmachines: [{name: m1, interfaces: [{name: eth0, network: internet}]}]",
+			wantErr: `gateway "m1" has no interface on it`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ParseScenario([]byte(tt.yaml))
+			if err == nil {
+				_, err = s.Build()
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v; want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLink(t *testing.T) {
+	// received sends count packets of size bytes over a link with l's
+	// impairments and returns which of them arrived.
+	received := func(l Link, count, size int) []bool {
+		internet := NewInternet()
+		foo := &Machine{Name: "foo"}
+		bar := &Machine{Name: "bar"}
+		ifFoo := foo.Attach("eth0", internet)
+		ifBar := bar.Attach("eth0", internet)
+		ifFoo.SetLink(l)
+
+		ctx := context.Background()
+		fooPC, err := foo.ListenPacket(ctx, "udp4", netip.AddrPortFrom(ifFoo.V4(), 123).String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer fooPC.Close()
+		barAddr := netip.AddrPortFrom(ifBar.V4(), 456)
+		barPC, err := bar.ListenPacket(ctx, "udp4", barAddr.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer barPC.Close()
+
+		// natlab conns don't support read deadlines, so read until
+		// barPC is closed, once the packets had time to arrive.
+		got := make([]bool, count)
+		done := make(chan error, 1)
+		go func() {
+			buf := make([]byte, size+1)
+			for {
+				n, _, err := barPC.ReadFrom(buf)
+				if err != nil {
+					done <- nil
+					return
+				}
+				if n != size || int(buf[0]) >= count {
+					done <- fmt.Errorf("got packet %d of %d bytes; want one of %d bytes", buf[0], n, size)
+					return
+				}
+				got[buf[0]] = true
+			}
+		}()
+		buf := make([]byte, size)
+		for i := 0; i < count; i++ {
+			buf[0] = byte(i)
+			if _, err := fooPC.WriteTo(buf, net.UDPAddrFromAddrPort(barAddr)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		time.Sleep(100 * time.Millisecond)
+		barPC.Close()
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	countTrue := func(bs []bool) (n int) {
+		for _, b := range bs {
+			if b {
+				n++
+			}
+		}
+		return n
+	}
+
+	lossy := Link{LossRate: 0.5, Seed: 1}
+	got1 := received(lossy, 50, 10)
+	if n := countTrue(got1); n < 10 || n > 40 {
+		t.Errorf("%d of 50 packets arrived at 50%% loss", n)
+	}
+	got2 := received(lossy, 50, 10)
+	for i := range got1 {
+		if got1[i] != got2[i] {
+			t.Fatalf("packet %d arrived %v, then %v with the same seed", i, got1[i], got2[i])
+		}
+	}
+
+	small := Link{MTU: 1280}
+	if n := countTrue(received(small, 5, 1280-28)); n != 5 {
+		t.Errorf("%d of 5 packets that fit the MTU arrived", n)
+	}
+	if n := countTrue(received(small, 5, 1280-27)); n != 0 {
+		t.Errorf("%d of 5 packets over the MTU arrived", n)
+	}
+}
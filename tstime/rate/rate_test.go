@@ -94,6 +94,27 @@ func TestLimiterBurst1(t *testing.T) {
 	})
 }
 
+func TestLimiterAllowN(t *testing.T) {
+	lim := NewLimiter(10, 5)
+	for i, tt := range []struct {
+		t  mono.Time
+		n  int
+		ok bool
+	}{
+		{t0, 3, true},
+		{t0, 3, false}, // only two tokens left
+		{t0, 2, true},
+		{t1, 2, false},
+		{t2, 2, true},
+		{t9, 6, false}, // more than the burst
+		{t9, 5, true},
+	} {
+		if ok := lim.allowN(tt.t, tt.n); ok != tt.ok {
+			t.Errorf("step %d: lim.allowN(%v, %d) = %v want %v", i, tt.t, tt.n, ok, tt.ok)
+		}
+	}
+}
+
 func TestLimiterJumpBackwards(t *testing.T) {
 	run(t, NewLimiter(10, 3), []allow{
 		{t1, true}, // start at t1
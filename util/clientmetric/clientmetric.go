@@ -124,6 +124,9 @@ func (m *Metric) Publish() {
 	if _, dup := metrics[m.name]; dup {
 		panic("duplicate metric " + m.name)
 	}
+	if _, dup := histograms[m.name]; dup {
+		panic("duplicate metric " + m.name)
+	}
 	metrics[m.name] = m
 	sortedDirty = true
 
@@ -167,6 +170,9 @@ func HasPublished(name string) bool {
 	mu.Lock()
 	defer mu.Unlock()
 	_, ok := metrics[name]
+	if !ok {
+		_, ok = histograms[name]
+	}
 	return ok
 }
 
@@ -223,8 +229,8 @@ func NewGaugeFunc(name string, f func() int64) *Metric {
 	return m
 }
 
-// WritePrometheusExpositionFormat writes all client metrics to w in
-// the Prometheus text-based exposition format.
+// WritePrometheusExpositionFormat writes all client metrics and histograms
+// to w in the Prometheus text-based exposition format.
 //
 // See https://github.com/prometheus/docs/blob/main/content/docs/instrumenting/exposition_formats.md
 func WritePrometheusExpositionFormat(w io.Writer) {
@@ -237,6 +243,9 @@ func WritePrometheusExpositionFormat(w io.Writer) {
 		}
 		fmt.Fprintf(w, "%s %v\n", m.Name(), m.Value())
 	}
+	for _, h := range Histograms() {
+		h.writePrometheus(w)
+	}
 }
 
 const (
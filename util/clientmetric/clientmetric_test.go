@@ -4,6 +4,8 @@
 package clientmetric
 
 import (
+	"math"
+	"strings"
 	"testing"
 	"time"
 )
@@ -31,6 +33,7 @@ func clearMetrics() {
 	mu.Lock()
 	defer mu.Unlock()
 	metrics = map[string]*Metric{}
+	histograms = map[string]*Histogram{}
 	numWireID = 0
 	lastDelta = time.Time{}
 	sorted = nil
@@ -107,3 +110,67 @@ func TestWithFunc(t *testing.T) {
 		t.Errorf("second = %q; want %q", got, want)
 	}
 }
+
+func TestHistogram(t *testing.T) {
+	clearMetrics()
+
+	h := NewHistogram("latency", []float64{1, 2, 4})
+	if got := h.Quantile(0.5); !math.IsNaN(got) {
+		t.Errorf("Quantile of empty histogram = %v; want NaN", got)
+	}
+	for _, v := range []float64{0.5, 1, 1.5, 3, 10} {
+		h.Observe(v)
+	}
+	if got, want := h.Count(), uint64(5); got != want {
+		t.Errorf("Count = %v; want %v", got, want)
+	}
+	if got, want := h.Sum(), 16.0; got != want {
+		t.Errorf("Sum = %v; want %v", got, want)
+	}
+
+	tests := []struct {
+		q    float64
+		want float64
+	}{
+		{0, 0},
+		{0.2, 0.5}, // halfway through the first bucket's two values
+		{0.5, 1.5}, // halfway through the (1, 2] bucket
+		{0.7, 3},
+		{1, 4}, // overflow is reported as the largest bound
+	}
+	for _, tt := range tests {
+		if got := h.Quantile(tt.q); got != tt.want {
+			t.Errorf("Quantile(%v) = %v; want %v", tt.q, got, tt.want)
+		}
+	}
+
+	var sb strings.Builder
+	WritePrometheusExpositionFormat(&sb)
+	const want = `# TYPE latency histogram
+latency_bucket{le="1"} 2
+latency_bucket{le="2"} 3
+latency_bucket{le="4"} 4
+latency_bucket{le="+Inf"} 5
+latency_sum 16
+latency_count 5
+`
+	if got := sb.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	if !HasPublished("latency") {
+		t.Error("HasPublished = false; want true")
+	}
+}
+
+func TestHistogramDuplicate(t *testing.T) {
+	clearMetrics()
+
+	NewCounter("foo")
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for histogram with same name as metric")
+		}
+	}()
+	NewHistogram("foo", DurationBuckets)
+}
@@ -0,0 +1,162 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package clientmetric
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// histograms are the published histograms, by name. Guarded by mu.
+	// Histogram names share the namespace of metrics.
+	histograms = map[string]*Histogram{}
+)
+
+// Histogram tracks the distribution of observed values in a fixed set of
+// buckets, using a constant amount of memory regardless of how many values
+// are observed.
+//
+// Unlike Metric, histograms are not uploaded in log deltas; they're only
+// exported by WritePrometheusExpositionFormat.
+//
+// It's safe for concurrent use.
+type Histogram struct {
+	name    string
+	bounds  []float64       // sorted upper bounds (inclusive) of each bucket
+	buckets []atomic.Uint64 // len(bounds)+1; the last is the +Inf bucket
+	count   atomic.Uint64
+	sumBits atomic.Uint64 // math.Float64bits of the sum of observations
+}
+
+// DurationBuckets are histogram bucket bounds, in seconds, suitable for
+// network latencies and other short durations.
+var DurationBuckets = []float64{
+	0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10,
+}
+
+// NewHistogram returns a new published histogram whose buckets have the
+// provided upper bounds, which must be sorted in increasing order. It
+// panics if the name is illegal or a duplicate anywhere in the process.
+func NewHistogram(name string, bounds []float64) *Histogram {
+	if i := strings.IndexFunc(name, isIllegalMetricRune); name == "" || i != -1 {
+		panic(fmt.Sprintf("illegal metric name %q (index %v)", name, i))
+	}
+	if len(bounds) == 0 || !sort.Float64sAreSorted(bounds) {
+		panic(fmt.Sprintf("histogram %q: bounds must be non-empty and sorted", name))
+	}
+	h := &Histogram{
+		name:    name,
+		bounds:  append([]float64(nil), bounds...),
+		buckets: make([]atomic.Uint64, len(bounds)+1),
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if _, dup := metrics[name]; dup {
+		panic("duplicate metric " + name)
+	}
+	if _, dup := histograms[name]; dup {
+		panic("duplicate metric " + name)
+	}
+	histograms[name] = h
+	return h
+}
+
+func (h *Histogram) Name() string { return h.name }
+
+// Observe records the value v in h.
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v) // first bound >= v
+	h.buckets[i].Add(1)
+	h.count.Add(1)
+	for {
+		old := h.sumBits.Load()
+		sum := math.Float64bits(math.Float64frombits(old) + v)
+		if h.sumBits.CompareAndSwap(old, sum) {
+			return
+		}
+	}
+}
+
+// ObserveDuration records d in h, in seconds.
+func (h *Histogram) ObserveDuration(d time.Duration) {
+	h.Observe(d.Seconds())
+}
+
+// Count returns the number of observed values.
+func (h *Histogram) Count() uint64 { return h.count.Load() }
+
+// Sum returns the sum of the observed values.
+func (h *Histogram) Sum() float64 { return math.Float64frombits(h.sumBits.Load()) }
+
+// Quantile returns an estimate of the q-quantile (0 <= q <= 1) of the
+// observed values, interpolating linearly within the bucket that contains
+// it. Values in the overflow bucket are reported as the largest bound. It
+// returns NaN if no values have been observed.
+func (h *Histogram) Quantile(q float64) float64 {
+	counts := make([]uint64, len(h.buckets))
+	var total uint64
+	for i := range h.buckets {
+		counts[i] = h.buckets[i].Load()
+		total += counts[i]
+	}
+	if total == 0 {
+		return math.NaN()
+	}
+	q = math.Max(0, math.Min(1, q))
+	rank := q * float64(total)
+	var cum uint64
+	for i, c := range counts {
+		if c == 0 || float64(cum+c) < rank {
+			cum += c
+			continue
+		}
+		if i == len(h.bounds) {
+			break
+		}
+		lo := 0.0
+		if i > 0 {
+			lo = h.bounds[i-1]
+		}
+		hi := h.bounds[i]
+		return lo + (hi-lo)*(rank-float64(cum))/float64(c)
+	}
+	return h.bounds[len(h.bounds)-1]
+}
+
+// writePrometheus writes h to w in the Prometheus text-based exposition
+// format.
+func (h *Histogram) writePrometheus(w io.Writer) {
+	fmt.Fprintf(w, "# TYPE %s histogram\n", h.name)
+	var cum uint64
+	for i := range h.buckets {
+		cum += h.buckets[i].Load()
+		le := "+Inf"
+		if i < len(h.bounds) {
+			le = strconv.FormatFloat(h.bounds[i], 'g', -1, 64)
+		}
+		fmt.Fprintf(w, "%s_bucket{le=%q} %d\n", h.name, le, cum)
+	}
+	fmt.Fprintf(w, "%s_sum %v\n", h.name, h.Sum())
+	fmt.Fprintf(w, "%s_count %d\n", h.name, cum)
+}
+
+// Histograms returns the published histograms, sorted by name.
+func Histograms() []*Histogram {
+	mu.Lock()
+	defer mu.Unlock()
+	ret := make([]*Histogram, 0, len(histograms))
+	for _, h := range histograms {
+		ret = append(ret, h)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].name < ret[j].name })
+	return ret
+}
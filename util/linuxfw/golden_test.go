@@ -0,0 +1,142 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build linux
+
+package linuxfw
+
+import (
+	"flag"
+	"net/netip"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tailscale.com/types/logger"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files in testdata")
+
+// goldenRunner is the part of the netfilter runners exercised by
+// TestGoldenRules.
+type goldenRunner interface {
+	HasIPV6() bool
+	AddChains() error
+	AddHooks() error
+	AddBase(tunname string) error
+	AddLoopbackRule(addr netip.Addr) error
+	AddSNATRule() error
+	AddMSSClampRule(tunname string) error
+	DelMSSClampRule(tunname string) error
+	DelSNATRule() error
+	DelLoopbackRule(addr netip.Addr) error
+	DelBase() error
+	DelHooks(logf logger.Logf) error
+	DelChains() error
+}
+
+var (
+	goldenLoopback4 = netip.MustParseAddr("100.64.0.1")
+	goldenLoopback6 = netip.MustParseAddr("fd7a:115c:a1e0::1")
+)
+
+// TestGoldenRules snapshots the exact rules that both runners install for a
+// subnet router with SNAT and MSS clamping, with and without IPv6 (NAT)
+// support. Run with -update to regenerate the snapshots after intended
+// changes, and review the diff.
+func TestGoldenRules(t *testing.T) {
+	scenarios := []struct {
+		name      string
+		v6, v6NAT bool
+	}{
+		{"dual-stack", true, true},
+		{"v6-without-nat", true, false},
+		{"v4-only", false, false},
+	}
+	for _, sc := range scenarios {
+		t.Run("iptables-"+sc.name, func(t *testing.T) {
+			ipt4, ipt6 := newIPTables(t), newIPTables(t)
+			r := &iptablesRunner{ipt4, ipt6, sc.v6, sc.v6 && sc.v6NAT}
+			testGoldenRules(t, r, func() string {
+				return "# iptables\n" + ipt4.dump() + "# ip6tables\n" + ipt6.dump()
+			})
+		})
+		t.Run("nftables-"+sc.name, func(t *testing.T) {
+			r, f := newNftablesRunnerWithFake(sc.v6, sc.v6NAT)
+			testGoldenRules(t, r, f.dump)
+		})
+	}
+}
+
+// testGoldenRules sets up the rules of a subnet router with r, compares them
+// to the golden file named after the test, then tears them down and checks
+// that no Tailscale chains or rules are left.
+func testGoldenRules(t *testing.T, r goldenRunner, dump func() string) {
+	const tunname = "tailscale0"
+	steps := []func() error{
+		r.AddChains,
+		r.AddHooks,
+		func() error { return r.AddBase(tunname) },
+		func() error { return r.AddLoopbackRule(goldenLoopback4) },
+		func() error {
+			if r.HasIPV6() {
+				return r.AddLoopbackRule(goldenLoopback6)
+			}
+			return nil
+		},
+		r.AddSNATRule,
+		func() error { return r.AddMSSClampRule(tunname) },
+	}
+	for i, step := range steps {
+		if err := step(); err != nil {
+			t.Fatalf("setup step %d: %v", i, err)
+		}
+	}
+
+	checkGolden(t, dump())
+
+	steps = []func() error{
+		func() error { return r.DelMSSClampRule(tunname) },
+		r.DelSNATRule,
+		func() error {
+			if r.HasIPV6() {
+				return r.DelLoopbackRule(goldenLoopback6)
+			}
+			return nil
+		},
+		func() error { return r.DelLoopbackRule(goldenLoopback4) },
+		r.DelBase,
+		func() error { return r.DelHooks(t.Logf) },
+		r.DelChains,
+	}
+	for i, step := range steps {
+		if err := step(); err != nil {
+			t.Fatalf("teardown step %d: %v", i, err)
+		}
+	}
+	if got := dump(); strings.Contains(got, "ts-") {
+		t.Errorf("Tailscale chains or rules left after teardown:\n%s", got)
+	}
+}
+
+// checkGolden compares got to testdata/<subtest name>.golden, or writes it
+// there with -update.
+func checkGolden(t *testing.T, got string) {
+	t.Helper()
+	file := filepath.Join("testdata", path.Base(t.Name())+".golden")
+	if *updateGolden {
+		if err := os.WriteFile(file, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("%v; run with -update to create it", err)
+	}
+	if got != string(want) {
+		t.Errorf("rules differ from %s; run with -update if the change is intended:\n%s", file, linediff(got, string(want)))
+	}
+}
@@ -405,6 +405,45 @@ func (i *iptablesRunner) DelSNATRule() error {
 	return nil
 }
 
+// mssClampRules returns the rules that clamp the MSS of TCP SYN packets
+// forwarded into or out of tunname to the path MTU.
+func mssClampRules(tunname string) [][]string {
+	var rules [][]string
+	for _, dir := range []string{"-i", "-o"} {
+		rules = append(rules, []string{dir, tunname, "-p", "tcp", "--tcp-flags", "SYN,RST", "SYN", "-j", "TCPMSS", "--clamp-mss-to-pmtu"})
+	}
+	return rules
+}
+
+// AddMSSClampRule adds netfilter rules that clamp the MSS of TCP
+// connections forwarded through tunname to the path MTU, so that
+// subnet routed connections work over links with a small MTU, such as
+// PPPoE links, even if ICMP "packet too big" messages are dropped.
+func (i *iptablesRunner) AddMSSClampRule(tunname string) error {
+	for _, ipt := range i.getTables() {
+		for _, args := range mssClampRules(tunname) {
+			if err := ipt.Insert("filter", "ts-forward", 1, args...); err != nil {
+				return fmt.Errorf("adding %v in filter/ts-forward: %w", args, err)
+			}
+		}
+	}
+	return nil
+}
+
+// DelMSSClampRule removes the netfilter rules that clamp the MSS of
+// TCP connections forwarded through tunname. An error is returned if
+// the rules do not exist.
+func (i *iptablesRunner) DelMSSClampRule(tunname string) error {
+	for _, ipt := range i.getTables() {
+		for _, args := range mssClampRules(tunname) {
+			if err := ipt.Delete("filter", "ts-forward", args...); err != nil {
+				return fmt.Errorf("deleting %v in filter/ts-forward: %w", args, err)
+			}
+		}
+	}
+	return nil
+}
+
 // IPTablesCleanup removes all Tailscale added iptables rules.
 // Any errors that occur are logged to the provided logf.
 func IPTablesCleanup(logf logger.Logf) {
@@ -7,7 +7,9 @@
 
 import (
 	"errors"
+	"fmt"
 	"net/netip"
+	"slices"
 	"strings"
 	"testing"
 
@@ -141,6 +143,38 @@ func (n *fakeIPTables) DeleteChain(table, chain string) error {
 	}
 }
 
+// dump returns the chains and rules of n in the format of iptables-save,
+// without policies and counters, for golden tests. Tables and chains are
+// sorted by name.
+func (n *fakeIPTables) dump() string {
+	tables := map[string][]string{} // table => chains
+	for k := range n.n {
+		table, chain, _ := strings.Cut(k, "/")
+		tables[table] = append(tables[table], chain)
+	}
+	var names []string
+	for table := range tables {
+		names = append(names, table)
+	}
+	slices.Sort(names)
+	var sb strings.Builder
+	for _, table := range names {
+		chains := tables[table]
+		slices.Sort(chains)
+		fmt.Fprintf(&sb, "*%s\n", table)
+		for _, chain := range chains {
+			fmt.Fprintf(&sb, ":%s\n", chain)
+		}
+		for _, chain := range chains {
+			for _, rule := range n.n[table+"/"+chain] {
+				fmt.Fprintf(&sb, "-A %s %s\n", chain, rule)
+			}
+		}
+		sb.WriteString("COMMIT\n")
+	}
+	return sb.String()
+}
+
 func newFakeIPTablesRunner(t *testing.T) *iptablesRunner {
 	ipt4 := newIPTables(t)
 	ipt6 := newIPTables(t)
@@ -418,3 +452,52 @@ func TestAddAndDelSNATRule(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestAddAndDelMSSClampRule(t *testing.T) {
+	iptr := newFakeIPTablesRunner(t)
+
+	if err := iptr.AddChains(); err != nil {
+		t.Fatal(err)
+	}
+
+	rules := []fakeRule{ // table/chain/rule
+		{"filter", "ts-forward", []string{"-i", "tailscale0", "-p", "tcp", "--tcp-flags", "SYN,RST", "SYN", "-j", "TCPMSS", "--clamp-mss-to-pmtu"}},
+		{"filter", "ts-forward", []string{"-o", "tailscale0", "-p", "tcp", "--tcp-flags", "SYN,RST", "SYN", "-j", "TCPMSS", "--clamp-mss-to-pmtu"}},
+	}
+
+	// Add MSS clamp rules
+	if err := iptr.AddMSSClampRule("tailscale0"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Check that the rules were created for ipt4 and ipt6
+	for _, proto := range []iptablesInterface{iptr.ipt4, iptr.ipt6} {
+		for _, rule := range rules {
+			if exist, err := proto.Exists(rule.table, rule.chain, rule.args...); err != nil {
+				t.Fatal(err)
+			} else if !exist {
+				t.Errorf("rule %s/%s/%s doesn't exist", rule.table, rule.chain, strings.Join(rule.args, " "))
+			}
+		}
+	}
+
+	// Delete MSS clamp rules
+	if err := iptr.DelMSSClampRule("tailscale0"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Check that the rules were deleted for ipt4 and ipt6
+	for _, proto := range []iptablesInterface{iptr.ipt4, iptr.ipt6} {
+		for _, rule := range rules {
+			if exist, err := proto.Exists(rule.table, rule.chain, rule.args...); err != nil {
+				t.Fatal(err)
+			} else if exist {
+				t.Errorf("rule %s/%s/%s still exists", rule.table, rule.chain, strings.Join(rule.args, " "))
+			}
+		}
+	}
+
+	if err := iptr.DelChains(); err != nil {
+		t.Fatal(err)
+	}
+}
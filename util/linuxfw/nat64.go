@@ -0,0 +1,149 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build linux
+
+package linuxfw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+
+	"github.com/tailscale/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// WellKnownNAT64Prefix is the NAT64 prefix of RFC 6052, which NAT64
+// gateways use unless their network is configured with another one.
+var WellKnownNAT64Prefix = netip.MustParsePrefix("64:ff9b::/96")
+
+// ipv4OnlyArpaAddrs are the IPv4 addresses of ipv4only.arpa, which a DNS64
+// resolver embeds in the AAAA records it synthesizes for the name (RFC 7050).
+var ipv4OnlyArpaAddrs = []netip.Addr{
+	netip.AddrFrom4([4]byte{192, 0, 0, 170}),
+	netip.AddrFrom4([4]byte{192, 0, 0, 171}),
+}
+
+// nat64PrefixLens are the NAT64 prefix lengths of RFC 6052, most common
+// first.
+var nat64PrefixLens = []int{96, 64, 56, 48, 40, 32}
+
+// ErrNoNAT64 is returned by DiscoverNAT64Prefix when the network has no
+// DNS64 resolver, and so presumably no NAT64 gateway.
+var ErrNoNAT64 = errors.New("no NAT64 prefix found")
+
+// IsV6Only reports whether the host has an IPv6 default route but no IPv4
+// one in the main routing table, as on IPv6-only cloud instances. Such a
+// host can only reach IPv4 destinations outside the tailnet through a NAT64
+// gateway, such as with the addresses returned by NAT64Addr.
+func IsV6Only() (bool, error) {
+	routes4, err := mainTableRoutes(netlink.FAMILY_V4)
+	if err != nil {
+		return false, err
+	}
+	routes6, err := mainTableRoutes(netlink.FAMILY_V6)
+	if err != nil {
+		return false, err
+	}
+	return !hasDefaultRoute(routes4) && hasDefaultRoute(routes6), nil
+}
+
+func mainTableRoutes(family int) ([]netlink.Route, error) {
+	routes, err := netlink.RouteListFiltered(family, &netlink.Route{Table: unix.RT_TABLE_MAIN}, netlink.RT_FILTER_TABLE)
+	if err != nil {
+		return nil, fmt.Errorf("listing routes: %w", err)
+	}
+	return routes, nil
+}
+
+// hasDefaultRoute reports whether routes has a default route.
+func hasDefaultRoute(routes []netlink.Route) bool {
+	for _, r := range routes {
+		if r.Dst == nil {
+			return true
+		}
+		if ones, _ := r.Dst.Mask.Size(); ones == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// DiscoverNAT64Prefix returns the NAT64 prefix of the network, as found by
+// asking r for the AAAA records of ipv4only.arpa (RFC 7050). If r is nil,
+// net.DefaultResolver is used. It returns ErrNoNAT64 if the resolver doesn't
+// synthesize AAAA records, which means the network has no DNS64.
+func DiscoverNAT64Prefix(ctx context.Context, r *net.Resolver) (netip.Prefix, error) {
+	if r == nil {
+		r = net.DefaultResolver
+	}
+	addrs, err := r.LookupNetIP(ctx, "ip6", "ipv4only.arpa")
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return netip.Prefix{}, ErrNoNAT64
+		}
+		return netip.Prefix{}, err
+	}
+	if p, ok := nat64PrefixFromAddrs(addrs); ok {
+		return p, nil
+	}
+	return netip.Prefix{}, ErrNoNAT64
+}
+
+// nat64PrefixFromAddrs returns the NAT64 prefix that a DNS64 resolver used
+// to synthesize addrs, the AAAA records of ipv4only.arpa.
+func nat64PrefixFromAddrs(addrs []netip.Addr) (_ netip.Prefix, ok bool) {
+	for _, a := range addrs {
+		if !a.Is6() || a.Is4In6() {
+			continue
+		}
+		for _, bits := range nat64PrefixLens {
+			if bits < 96 && a.As16()[8] != 0 {
+				// Bits 64 to 71 must be zero (RFC 6052, section 2.2).
+				continue
+			}
+			p := netip.PrefixFrom(a, bits).Masked()
+			for _, want := range ipv4OnlyArpaAddrs {
+				if NAT64Addr(p, want) == a.WithZone("") {
+					return p, true
+				}
+			}
+		}
+	}
+	return netip.Prefix{}, false
+}
+
+// NAT64Addr returns the IPv6 address by which a host can reach the IPv4
+// address v4 through the NAT64 gateway of prefix pfx, such as
+// WellKnownNAT64Prefix or one returned by DiscoverNAT64Prefix (RFC 6052).
+// It returns the zero Addr if pfx isn't an IPv6 prefix of one of the
+// lengths of RFC 6052 or v4 isn't an IPv4 address.
+func NAT64Addr(pfx netip.Prefix, v4 netip.Addr) netip.Addr {
+	if !pfx.Addr().Is6() || !v4.Is4() || !validNAT64PrefixLen(pfx.Bits()) {
+		return netip.Addr{}
+	}
+	b := pfx.Masked().Addr().As16()
+	v := v4.As4()
+	j := pfx.Bits() / 8
+	for _, octet := range v {
+		if j == 8 {
+			j++ // skip bits 64 to 71
+		}
+		b[j] = octet
+		j++
+	}
+	return netip.AddrFrom16(b)
+}
+
+func validNAT64PrefixLen(bits int) bool {
+	for _, n := range nat64PrefixLens {
+		if bits == n {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build linux
+
+package linuxfw
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/tailscale/netlink"
+)
+
+func TestNAT64Addr(t *testing.T) {
+	v4 := netip.MustParseAddr("192.0.2.33")
+	// Examples of RFC 6052, section 2.4.
+	tests := []struct {
+		pfx  string
+		want string
+	}{
+		{"2001:db8::/32", "2001:db8:c000:221::"},
+		{"2001:db8:100::/40", "2001:db8:1c0:2:21::"},
+		{"2001:db8:122::/48", "2001:db8:122:c000:2:2100::"},
+		{"2001:db8:122:300::/56", "2001:db8:122:3c0:0:221::"},
+		{"2001:db8:122:344::/64", "2001:db8:122:344:c0:2:2100:0"},
+		{"2001:db8:122:344::/96", "2001:db8:122:344::192.0.2.33"},
+		{"64:ff9b::/96", "64:ff9b::192.0.2.33"},
+	}
+	for _, tt := range tests {
+		pfx := netip.MustParsePrefix(tt.pfx)
+		want := netip.MustParseAddr(tt.want)
+		got := NAT64Addr(pfx, v4)
+		if got != want {
+			t.Errorf("NAT64Addr(%v) = %v; want %v", pfx, got, want)
+		}
+		if p, ok := nat64PrefixFromAddrs([]netip.Addr{NAT64Addr(pfx, ipv4OnlyArpaAddrs[0])}); !ok || p != pfx {
+			t.Errorf("nat64PrefixFromAddrs for %v = %v, %v", pfx, p, ok)
+		}
+	}
+	for _, bad := range []string{"2001:db8::/33", "10.0.0.0/8"} {
+		if got := NAT64Addr(netip.MustParsePrefix(bad), v4); got.IsValid() {
+			t.Errorf("NAT64Addr(%v) = %v; want zero", bad, got)
+		}
+	}
+	if _, ok := nat64PrefixFromAddrs([]netip.Addr{netip.MustParseAddr("2001:db8::1"), netip.MustParseAddr("192.0.0.170")}); ok {
+		t.Error("nat64PrefixFromAddrs found a prefix in non-synthesized addresses")
+	}
+}
+
+func TestHasDefaultRoute(t *testing.T) {
+	_, dst, _ := net.ParseCIDR("10.0.0.0/8")
+	_, def, _ := net.ParseCIDR("0.0.0.0/0")
+	if hasDefaultRoute([]netlink.Route{{Dst: dst}}) {
+		t.Error("hasDefaultRoute(10.0.0.0/8) = true")
+	}
+	if !hasDefaultRoute([]netlink.Route{{Dst: dst}, {Dst: nil}}) {
+		t.Error("hasDefaultRoute(nil Dst) = false")
+	}
+	if !hasDefaultRoute([]netlink.Route{{Dst: def}}) {
+		t.Error("hasDefaultRoute(0.0.0.0/0) = false")
+	}
+}
@@ -0,0 +1,370 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build linux
+
+package linuxfw
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/nftables"
+	"github.com/google/nftables/expr"
+)
+
+// fakeNftables is an in-memory nftablesInterface. Changes are applied
+// immediately instead of being batched until Flush, but like with a netlink
+// connection, errors are only reported by the next Flush.
+type fakeNftables struct {
+	tables     []*nftables.Table
+	chains     []*fakeChain
+	nextHandle uint64
+	err        error // first error since the last Flush
+}
+
+type fakeChain struct {
+	chain *nftables.Chain
+	rules []*nftables.Rule
+}
+
+func newFakeNftables() *fakeNftables {
+	return &fakeNftables{nextHandle: 1}
+}
+
+// newNftablesRunnerWithFake returns an nftablesRunner using an empty
+// fakeNftables, with IPv6 and IPv6 NAT support as given.
+func newNftablesRunnerWithFake(v6, v6NAT bool) (*nftablesRunner, *fakeNftables) {
+	f := newFakeNftables()
+	n := &nftablesRunner{
+		conn:           f,
+		nft4:           &nftable{Proto: nftables.TableFamilyIPv4},
+		v6Available:    v6,
+		v6NATAvailable: v6 && v6NAT,
+	}
+	if v6 {
+		n.nft6 = &nftable{Proto: nftables.TableFamilyIPv6}
+	}
+	return n, f
+}
+
+func (f *fakeNftables) fail(format string, args ...any) {
+	if f.err == nil {
+		f.err = fmt.Errorf(format, args...)
+	}
+}
+
+func sameTable(a, b *nftables.Table) bool {
+	return a.Family == b.Family && a.Name == b.Name
+}
+
+func (f *fakeNftables) findTable(t *nftables.Table) int {
+	for i, t2 := range f.tables {
+		if sameTable(t, t2) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (f *fakeNftables) findChain(c *nftables.Chain) *fakeChain {
+	for _, fc := range f.chains {
+		if sameTable(c.Table, fc.chain.Table) && c.Name == fc.chain.Name {
+			return fc
+		}
+	}
+	return nil
+}
+
+func (f *fakeNftables) AddTable(t *nftables.Table) *nftables.Table {
+	if f.findTable(t) < 0 {
+		f.tables = append(f.tables, t)
+	}
+	return t
+}
+
+func (f *fakeNftables) DelTable(t *nftables.Table) {
+	i := f.findTable(t)
+	if i < 0 {
+		f.fail("delete of unknown table %s", t.Name)
+		return
+	}
+	f.tables = append(f.tables[:i], f.tables[i+1:]...)
+	chains := f.chains[:0]
+	for _, fc := range f.chains {
+		if !sameTable(t, fc.chain.Table) {
+			chains = append(chains, fc)
+		}
+	}
+	f.chains = chains
+}
+
+func (f *fakeNftables) ListTables() ([]*nftables.Table, error) {
+	return append([]*nftables.Table(nil), f.tables...), nil
+}
+
+func (f *fakeNftables) AddChain(c *nftables.Chain) *nftables.Chain {
+	if f.findTable(c.Table) < 0 {
+		f.fail("add of chain %s to unknown table %s", c.Name, c.Table.Name)
+		return c
+	}
+	if f.findChain(c) == nil {
+		f.chains = append(f.chains, &fakeChain{chain: c})
+	}
+	return c
+}
+
+func (f *fakeNftables) DelChain(c *nftables.Chain) {
+	fc := f.findChain(c)
+	if fc == nil {
+		f.fail("delete of unknown chain %s", c.Name)
+		return
+	}
+	if len(fc.rules) > 0 {
+		f.fail("delete of non-empty chain %s", c.Name)
+		return
+	}
+	// Like the kernel, refuse to delete chains that are jumped to.
+	for _, other := range f.chains {
+		if !sameTable(c.Table, other.chain.Table) {
+			continue
+		}
+		for _, r := range other.rules {
+			for _, e := range r.Exprs {
+				if v, ok := e.(*expr.Verdict); ok && v.Chain == c.Name {
+					f.fail("delete of chain %s, which %s jumps to", c.Name, other.chain.Name)
+					return
+				}
+			}
+		}
+	}
+	for i, fc2 := range f.chains {
+		if fc2 == fc {
+			f.chains = append(f.chains[:i], f.chains[i+1:]...)
+			break
+		}
+	}
+}
+
+func (f *fakeNftables) FlushChain(c *nftables.Chain) {
+	fc := f.findChain(c)
+	if fc == nil {
+		f.fail("flush of unknown chain %s", c.Name)
+		return
+	}
+	fc.rules = nil
+}
+
+func (f *fakeNftables) ListChainsOfTableFamily(family nftables.TableFamily) ([]*nftables.Chain, error) {
+	var chains []*nftables.Chain
+	for _, fc := range f.chains {
+		if fc.chain.Table.Family == family {
+			chains = append(chains, fc.chain)
+		}
+	}
+	return chains, nil
+}
+
+// addRule adds r to the top of its chain if top, or else to the bottom.
+func (f *fakeNftables) addRule(r *nftables.Rule, top bool) *nftables.Rule {
+	fc := f.findChain(r.Chain)
+	if fc == nil {
+		f.fail("add of rule to unknown chain %s", r.Chain.Name)
+		return r
+	}
+	stored := *r
+	stored.Table = fc.chain.Table
+	stored.Chain = fc.chain
+	stored.Handle = f.nextHandle
+	f.nextHandle++
+	if top {
+		fc.rules = append([]*nftables.Rule{&stored}, fc.rules...)
+	} else {
+		fc.rules = append(fc.rules, &stored)
+	}
+	return r
+}
+
+func (f *fakeNftables) AddRule(r *nftables.Rule) *nftables.Rule {
+	return f.addRule(r, false)
+}
+
+func (f *fakeNftables) InsertRule(r *nftables.Rule) *nftables.Rule {
+	return f.addRule(r, true)
+}
+
+func (f *fakeNftables) DelRule(r *nftables.Rule) error {
+	if r.Handle == 0 {
+		return fmt.Errorf("rule's handle cannot be 0")
+	}
+	fc := f.findChain(r.Chain)
+	if fc == nil {
+		f.fail("delete of rule from unknown chain %s", r.Chain.Name)
+		return nil
+	}
+	for i, r2 := range fc.rules {
+		if r2.Handle == r.Handle {
+			fc.rules = append(fc.rules[:i], fc.rules[i+1:]...)
+			return nil
+		}
+	}
+	f.fail("delete of unknown rule %d from chain %s", r.Handle, r.Chain.Name)
+	return nil
+}
+
+func (f *fakeNftables) GetRules(t *nftables.Table, c *nftables.Chain) ([]*nftables.Rule, error) {
+	fc := f.findChain(&nftables.Chain{Table: t, Name: c.Name})
+	if fc == nil {
+		return nil, fmt.Errorf("chain %s not found in table %s", c.Name, t.Name)
+	}
+	return append([]*nftables.Rule(nil), fc.rules...), nil
+}
+
+func (f *fakeNftables) Flush() error {
+	err := f.err
+	f.err = nil
+	return err
+}
+
+var nftFamilyNames = map[nftables.TableFamily]string{
+	nftables.TableFamilyIPv4: "ip",
+	nftables.TableFamilyIPv6: "ip6",
+}
+
+var nftHookNames = map[nftables.ChainHook]string{
+	*nftables.ChainHookInput:       "input",
+	*nftables.ChainHookForward:     "forward",
+	*nftables.ChainHookPostrouting: "postrouting",
+}
+
+// dump returns the tables, chains and rules of f in a stable text form
+// for golden tests. Tables and chains are sorted by name, and rules are
+// listed in order, one expression per line, like `nft --debug=netlink`
+// does.
+func (f *fakeNftables) dump() string {
+	tables := append([]*nftables.Table(nil), f.tables...)
+	sort.Slice(tables, func(i, j int) bool {
+		a, b := tables[i], tables[j]
+		if a.Family != b.Family {
+			return nftFamilyNames[a.Family] < nftFamilyNames[b.Family]
+		}
+		return a.Name < b.Name
+	})
+	var sb strings.Builder
+	for _, t := range tables {
+		fmt.Fprintf(&sb, "table %s %s\n", nftFamilyNames[t.Family], t.Name)
+		var chains []*fakeChain
+		for _, fc := range f.chains {
+			if sameTable(t, fc.chain.Table) {
+				chains = append(chains, fc)
+			}
+		}
+		sort.Slice(chains, func(i, j int) bool { return chains[i].chain.Name < chains[j].chain.Name })
+		for _, fc := range chains {
+			c := fc.chain
+			fmt.Fprintf(&sb, "  chain %s", c.Name)
+			if c.Hooknum != nil {
+				fmt.Fprintf(&sb, " { type %s hook %s priority %d", c.Type, nftHookNames[*c.Hooknum], *c.Priority)
+				if c.Policy != nil && *c.Policy == nftables.ChainPolicyAccept {
+					sb.WriteString("; policy accept")
+				} else if c.Policy != nil {
+					sb.WriteString("; policy drop")
+				}
+				sb.WriteString(" }")
+			}
+			sb.WriteString("\n")
+			for _, r := range fc.rules {
+				sb.WriteString("    rule\n")
+				for _, e := range r.Exprs {
+					fmt.Fprintf(&sb, "      [ %s ]\n", nftExprString(e))
+				}
+			}
+		}
+	}
+	return sb.String()
+}
+
+var nftMetaKeyNames = map[expr.MetaKey]string{
+	expr.MetaKeyIIFNAME: "iifname",
+	expr.MetaKeyOIFNAME: "oifname",
+	expr.MetaKeyMARK:    "mark",
+	expr.MetaKeyL4PROTO: "l4proto",
+}
+
+var nftVerdictNames = map[expr.VerdictKind]string{
+	expr.VerdictAccept: "accept",
+	expr.VerdictDrop:   "drop",
+	expr.VerdictReturn: "return",
+	expr.VerdictJump:   "jump",
+}
+
+// nftData formats data compared against or loaded into a register, as a
+// quoted string if it's printable, such as an interface name, or else in
+// hex.
+func nftData(b []byte) string {
+	printable := len(b) > 0
+	for _, c := range b {
+		if c < 0x20 || c > 0x7e {
+			printable = false
+		}
+	}
+	if printable {
+		return fmt.Sprintf("%q", b)
+	}
+	return "0x" + hex.EncodeToString(b)
+}
+
+// nftExprString formats the expressions used by nftablesRunner, roughly
+// like `nft --debug=netlink` does.
+func nftExprString(e expr.Any) string {
+	switch e := e.(type) {
+	case *expr.Meta:
+		if e.SourceRegister {
+			return fmt.Sprintf("meta set %s with reg %d", nftMetaKeyNames[e.Key], e.Register)
+		}
+		return fmt.Sprintf("meta load %s => reg %d", nftMetaKeyNames[e.Key], e.Register)
+	case *expr.Cmp:
+		op := "eq"
+		if e.Op == expr.CmpOpNeq {
+			op = "neq"
+		}
+		return fmt.Sprintf("cmp %s reg %d %s", op, e.Register, nftData(e.Data))
+	case *expr.Payload:
+		base := "network"
+		if e.Base == expr.PayloadBaseTransportHeader {
+			base = "transport"
+		}
+		return fmt.Sprintf("payload load %db @ %s header + %d => reg %d", e.Len, base, e.Offset, e.DestRegister)
+	case *expr.Bitwise:
+		return fmt.Sprintf("bitwise reg %d = ( reg %d & %s ) ^ %s", e.DestRegister, e.SourceRegister, nftData(e.Mask), nftData(e.Xor))
+	case *expr.Counter:
+		return "counter"
+	case *expr.Verdict:
+		if e.Chain != "" {
+			return fmt.Sprintf("immediate reg 0 %s -> %s", nftVerdictNames[e.Kind], e.Chain)
+		}
+		return fmt.Sprintf("immediate reg 0 %s", nftVerdictNames[e.Kind])
+	case *expr.Masq:
+		return "masq"
+	case *expr.Rt:
+		key := "unknown"
+		if e.Key == expr.RtTCPMSS {
+			key = "tcpmss"
+		}
+		return fmt.Sprintf("rt load %s => reg %d", key, e.Register)
+	case *expr.Byteorder:
+		op := "ntoh"
+		if e.Op == expr.ByteorderHton {
+			op = "hton"
+		}
+		return fmt.Sprintf("byteorder reg %d = %s(reg %d, %d, %d)", e.DestRegister, op, e.SourceRegister, e.Size, e.Len)
+	case *expr.Exthdr:
+		if e.Op == expr.ExthdrOpTcpopt {
+			return fmt.Sprintf("exthdr write tcpopt reg %d => %db @ %d + %d", e.SourceRegister, e.Len, e.Type, e.Offset)
+		}
+		return fmt.Sprintf("exthdr reg %d %db @ %d + %d", e.SourceRegister, e.Len, e.Type, e.Offset)
+	}
+	return fmt.Sprintf("%T", e)
+}
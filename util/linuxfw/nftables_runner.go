@@ -17,6 +17,7 @@
 
 	"github.com/google/nftables"
 	"github.com/google/nftables/expr"
+	"golang.org/x/sys/unix"
 	"tailscale.com/net/tsaddr"
 	"tailscale.com/types/logger"
 )
@@ -39,6 +40,26 @@ type chainInfo struct {
 	chainPolicy   *nftables.ChainPolicy
 }
 
+// nftablesInterface is the part of *nftables.Conn that nftablesRunner uses.
+// It exists so that tests can substitute an in-memory fake for the netlink
+// connection, which needs root and the nf_tables kernel module.
+type nftablesInterface interface {
+	AddTable(t *nftables.Table) *nftables.Table
+	DelTable(t *nftables.Table)
+	ListTables() ([]*nftables.Table, error)
+	AddChain(c *nftables.Chain) *nftables.Chain
+	DelChain(c *nftables.Chain)
+	FlushChain(c *nftables.Chain)
+	ListChainsOfTableFamily(family nftables.TableFamily) ([]*nftables.Chain, error)
+	AddRule(r *nftables.Rule) *nftables.Rule
+	InsertRule(r *nftables.Rule) *nftables.Rule
+	DelRule(r *nftables.Rule) error
+	GetRules(t *nftables.Table, c *nftables.Chain) ([]*nftables.Rule, error)
+	Flush() error
+}
+
+var _ nftablesInterface = (*nftables.Conn)(nil)
+
 type nftable struct {
 	Proto  nftables.TableFamily
 	Filter *nftables.Table
@@ -61,7 +82,7 @@ type nftable struct {
 //     `iptables-nft` and `ufw`, so that those tools co-exist and do not
 //     negatively affect Tailscale function.
 type nftablesRunner struct {
-	conn *nftables.Conn
+	conn nftablesInterface
 	nft4 *nftable
 	nft6 *nftable
 
@@ -70,7 +91,7 @@ type nftablesRunner struct {
 }
 
 // createTableIfNotExist creates a nftables table via connection c if it does not exist within the given family.
-func createTableIfNotExist(c *nftables.Conn, family nftables.TableFamily, name string) (*nftables.Table, error) {
+func createTableIfNotExist(c nftablesInterface, family nftables.TableFamily, name string) (*nftables.Table, error) {
 	tables, err := c.ListTables()
 	if err != nil {
 		return nil, fmt.Errorf("get tables: %w", err)
@@ -102,7 +123,7 @@ func (e errorChainNotFound) Error() string {
 
 // getChainFromTable returns the chain with the given name from the given table.
 // Note that a chain name is unique within a table.
-func getChainFromTable(c *nftables.Conn, table *nftables.Table, name string) (*nftables.Chain, error) {
+func getChainFromTable(c nftablesInterface, table *nftables.Table, name string) (*nftables.Chain, error) {
 	chains, err := c.ListChainsOfTableFamily(table.Family)
 	if err != nil {
 		return nil, fmt.Errorf("list chains: %w", err)
@@ -119,7 +140,7 @@ func getChainFromTable(c *nftables.Conn, table *nftables.Table, name string) (*n
 }
 
 // getChainsFromTable returns all chains from the given table.
-func getChainsFromTable(c *nftables.Conn, table *nftables.Table) ([]*nftables.Chain, error) {
+func getChainsFromTable(c nftablesInterface, table *nftables.Table) ([]*nftables.Chain, error) {
 	chains, err := c.ListChainsOfTableFamily(table.Family)
 	if err != nil {
 		return nil, fmt.Errorf("list chains: %w", err)
@@ -144,7 +165,7 @@ func isTSChain(name string) bool {
 
 // createChainIfNotExist creates a chain with the given name in the given table
 // if it does not exist.
-func createChainIfNotExist(c *nftables.Conn, cinfo chainInfo) error {
+func createChainIfNotExist(c nftablesInterface, cinfo chainInfo) error {
 	chain, err := getChainFromTable(c, cinfo.table, cinfo.name)
 	if err != nil && !errors.Is(err, errorChainNotFound{cinfo.table.Name, cinfo.name}) {
 		return fmt.Errorf("get chain: %w", err)
@@ -242,7 +263,7 @@ func (n *nftablesRunner) HasIPV6NAT() bool {
 }
 
 // findRule iterates through the rules to find the rule with matching expressions.
-func findRule(conn *nftables.Conn, rule *nftables.Rule) (*nftables.Rule, error) {
+func findRule(conn nftablesInterface, rule *nftables.Rule) (*nftables.Rule, error) {
 	rules, err := conn.GetRules(rule.Table, rule.Chain)
 	if err != nil {
 		return nil, fmt.Errorf("get nftables rules: %w", err)
@@ -313,7 +334,7 @@ func createLoopbackRule(
 // insertLoopbackRule inserts the TS loop back rule into
 // the given chain as the first rule if it does not exist.
 func insertLoopbackRule(
-	conn *nftables.Conn, proto nftables.TableFamily,
+	conn nftablesInterface, proto nftables.TableFamily,
 	table *nftables.Table, chain *nftables.Chain, addr netip.Addr) error {
 
 	loopBackRule, err := createLoopbackRule(proto, table, chain, addr)
@@ -323,7 +344,7 @@ func insertLoopbackRule(
 
 	// If TestDial is set, we are running in test mode and we should not
 	// find rule because header will mismatch.
-	if conn.TestDial == nil {
+	if c, ok := conn.(*nftables.Conn); !ok || c.TestDial == nil {
 		// Check if the rule already exists.
 		rule, err := findRule(conn, loopBackRule)
 		if err != nil {
@@ -473,7 +494,7 @@ func (n *nftablesRunner) AddChains() error {
 }
 
 // deleteChainIfExists deletes a chain if it exists.
-func deleteChainIfExists(c *nftables.Conn, table *nftables.Table, name string) error {
+func deleteChainIfExists(c nftablesInterface, table *nftables.Table, name string) error {
 	chain, err := getChainFromTable(c, table, name)
 	if err != nil && !errors.Is(err, errorChainNotFound{table.Name, name}) {
 		return fmt.Errorf("get chain: %w", err)
@@ -540,7 +561,7 @@ func createHookRule(table *nftables.Table, fromChain *nftables.Chain, toChainNam
 }
 
 // addHookRule adds a rule to jump from a hooked chain to a regular chain at top of the hooked chain.
-func addHookRule(conn *nftables.Conn, table *nftables.Table, fromChain *nftables.Chain, toChainName string) error {
+func addHookRule(conn nftablesInterface, table *nftables.Table, fromChain *nftables.Chain, toChainName string) error {
 	rule := createHookRule(table, fromChain, toChainName)
 	_ = conn.InsertRule(rule)
 
@@ -589,7 +610,7 @@ func (n *nftablesRunner) AddHooks() error {
 }
 
 // delHookRule deletes a rule that jumps from a hooked chain to a regular chain.
-func delHookRule(conn *nftables.Conn, table *nftables.Table, fromChain *nftables.Chain, toChainName string) error {
+func delHookRule(conn nftablesInterface, table *nftables.Table, fromChain *nftables.Chain, toChainName string) error {
 	rule := createHookRule(table, fromChain, toChainName)
 	existingRule, err := findRule(conn, rule)
 	if err != nil {
@@ -703,7 +724,7 @@ func createRangeRule(
 
 // addReturnChromeOSVMRangeRule adds a rule to return if the source IP
 // is in the ChromeOS VM range.
-func addReturnChromeOSVMRangeRule(c *nftables.Conn, table *nftables.Table, chain *nftables.Chain, tunname string) error {
+func addReturnChromeOSVMRangeRule(c nftablesInterface, table *nftables.Table, chain *nftables.Chain, tunname string) error {
 	rule, err := createRangeRule(table, chain, tunname, tsaddr.ChromeOSVMRange(), expr.VerdictReturn)
 	if err != nil {
 		return fmt.Errorf("create rule: %w", err)
@@ -717,7 +738,7 @@ func addReturnChromeOSVMRangeRule(c *nftables.Conn, table *nftables.Table, chain
 
 // addDropCGNATRangeRule adds a rule to drop if the source IP is in the
 // CGNAT range.
-func addDropCGNATRangeRule(c *nftables.Conn, table *nftables.Table, chain *nftables.Chain, tunname string) error {
+func addDropCGNATRangeRule(c nftablesInterface, table *nftables.Table, chain *nftables.Chain, tunname string) error {
 	rule, err := createRangeRule(table, chain, tunname, tsaddr.CGNATRange(), expr.VerdictDrop)
 	if err != nil {
 		return fmt.Errorf("create rule: %w", err)
@@ -766,7 +787,7 @@ func createSetSubnetRouteMarkRule(table *nftables.Table, chain *nftables.Chain,
 
 // addSetSubnetRouteMarkRule adds a rule to set the subnet route mark
 // if the packet is from the given interface.
-func addSetSubnetRouteMarkRule(c *nftables.Conn, table *nftables.Table, chain *nftables.Chain, tunname string) error {
+func addSetSubnetRouteMarkRule(c nftablesInterface, table *nftables.Table, chain *nftables.Chain, tunname string) error {
 	rule, err := createSetSubnetRouteMarkRule(table, chain, tunname)
 	if err != nil {
 		return fmt.Errorf("create rule: %w", err)
@@ -830,7 +851,7 @@ func createDropOutgoingPacketFromCGNATRangeRuleWithTunname(table *nftables.Table
 
 // addDropOutgoingPacketFromCGNATRangeRuleWithTunname adds a rule to drop
 // outgoing packets from the CGNAT range.
-func addDropOutgoingPacketFromCGNATRangeRuleWithTunname(conn *nftables.Conn, table *nftables.Table, chain *nftables.Chain, tunname string) error {
+func addDropOutgoingPacketFromCGNATRangeRuleWithTunname(conn nftablesInterface, table *nftables.Table, chain *nftables.Chain, tunname string) error {
 	rule, err := createDropOutgoingPacketFromCGNATRangeRuleWithTunname(table, chain, tunname)
 	if err != nil {
 		return fmt.Errorf("create rule: %w", err)
@@ -866,7 +887,7 @@ func createAcceptOutgoingPacketRule(table *nftables.Table, chain *nftables.Chain
 
 // addAcceptOutgoingPacketRule adds a rule to accept outgoing packets
 // from the given interface.
-func addAcceptOutgoingPacketRule(conn *nftables.Conn, table *nftables.Table, chain *nftables.Chain, tunname string) error {
+func addAcceptOutgoingPacketRule(conn nftablesInterface, table *nftables.Table, chain *nftables.Chain, tunname string) error {
 	rule := createAcceptOutgoingPacketRule(table, chain, tunname)
 	_ = conn.AddRule(rule)
 
@@ -1030,7 +1051,7 @@ func createMatchSubnetRouteMarkRule(table *nftables.Table, chain *nftables.Chain
 
 // addMatchSubnetRouteMarkRule adds a rule that matches packets with
 // the subnet route mark and takes the specified action.
-func addMatchSubnetRouteMarkRule(conn *nftables.Conn, table *nftables.Table, chain *nftables.Chain, action MatchDecision) error {
+func addMatchSubnetRouteMarkRule(conn nftablesInterface, table *nftables.Table, chain *nftables.Chain, action MatchDecision) error {
 	rule, err := createMatchSubnetRouteMarkRule(table, chain, action)
 	if err != nil {
 		return fmt.Errorf("create match subnet route mark rule: %w", err)
@@ -1072,36 +1093,18 @@ func (n *nftablesRunner) AddSNATRule() error {
 func (n *nftablesRunner) DelSNATRule() error {
 	conn := n.conn
 
-	hexTSFwmarkMask := getTailscaleFwmarkMask()
-	hexTSSubnetRouteMark := getTailscaleSubnetRouteMark()
-
-	exprs := []expr.Any{
-		&expr.Meta{Key: expr.MetaKeyMARK, Register: 1},
-		&expr.Bitwise{
-			SourceRegister: 1,
-			DestRegister:   1,
-			Len:            4,
-			Mask:           hexTSFwmarkMask,
-		},
-		&expr.Cmp{
-			Op:       expr.CmpOpEq,
-			Register: 1,
-			Data:     hexTSSubnetRouteMark,
-		},
-		&expr.Counter{},
-		&expr.Masq{},
-	}
-
 	for _, table := range n.getNATTables() {
 		chain, err := getChainFromTable(conn, table.Nat, chainNamePostrouting)
 		if err != nil {
 			return fmt.Errorf("get postrouting chain v4: %w", err)
 		}
 
-		rule := &nftables.Rule{
-			Table: table.Nat,
-			Chain: chain,
-			Exprs: exprs,
+		// Look for the same rule that AddSNATRule adds. findRule compares
+		// expressions exactly, so a rule built separately here, such as
+		// without the bitwise Xor, never matches and is never deleted.
+		rule, err := createMatchSubnetRouteMarkRule(table.Nat, chain, Masq)
+		if err != nil {
+			return fmt.Errorf("create match subnet route mark rule: %w", err)
 		}
 
 		SNATRule, err := findRule(conn, rule)
@@ -1121,10 +1124,163 @@ func (n *nftablesRunner) DelSNATRule() error {
 	return nil
 }
 
+// createMSSClampRule creates a rule that clamps the MSS option of TCP SYN
+// packets forwarded through tunname to the path MTU. The direction, which
+// is either expr.MetaKeyIIFNAME or expr.MetaKeyOIFNAME, selects whether
+// packets from or to tunname are matched.
+func createMSSClampRule(table *nftables.Table, chain *nftables.Chain, tunname string, dir expr.MetaKey) *nftables.Rule {
+	return &nftables.Rule{
+		Table: table,
+		Chain: chain,
+		Exprs: []expr.Any{
+			&expr.Meta{Key: dir, Register: 1},
+			&expr.Cmp{
+				Op:       expr.CmpOpEq,
+				Register: 1,
+				Data:     []byte(tunname),
+			},
+			&expr.Meta{Key: expr.MetaKeyL4PROTO, Register: 1},
+			&expr.Cmp{
+				Op:       expr.CmpOpEq,
+				Register: 1,
+				Data:     []byte{unix.IPPROTO_TCP},
+			},
+			// tcp flags & (syn|rst) == syn
+			&expr.Payload{
+				DestRegister: 1,
+				Base:         expr.PayloadBaseTransportHeader,
+				Offset:       13,
+				Len:          1,
+			},
+			&expr.Bitwise{
+				SourceRegister: 1,
+				DestRegister:   1,
+				Len:            1,
+				Mask:           []byte{0x06},
+				Xor:            []byte{0x00},
+			},
+			&expr.Cmp{
+				Op:       expr.CmpOpEq,
+				Register: 1,
+				Data:     []byte{0x02},
+			},
+			// tcp option maxseg size set rt mtu
+			&expr.Rt{Register: 1, Key: expr.RtTCPMSS},
+			&expr.Byteorder{
+				SourceRegister: 1,
+				DestRegister:   1,
+				Op:             expr.ByteorderHton,
+				Len:            2,
+				Size:           2,
+			},
+			&expr.Exthdr{
+				SourceRegister: 1,
+				Type:           2, // TCP option kind of the MSS
+				Offset:         2,
+				Len:            2,
+				Op:             expr.ExthdrOpTcpopt,
+			},
+			&expr.Counter{},
+		},
+	}
+}
+
+// findMSSClampRule returns the MSS clamp rule created by createMSSClampRule
+// for tunname and dir, or nil if there is none.
+//
+// The nftables library doesn't decode rt and byteorder expressions, so rules
+// read back from the kernel lack them. They are left out of the comparison.
+func findMSSClampRule(conn nftablesInterface, table *nftables.Table, chain *nftables.Chain, tunname string, dir expr.MetaKey) (*nftables.Rule, error) {
+	rule := createMSSClampRule(table, chain, tunname, dir)
+	rules, err := conn.GetRules(table, chain)
+	if err != nil {
+		return nil, fmt.Errorf("get nftables rules: %w", err)
+	}
+	decodable := func(exprs []expr.Any) []expr.Any {
+		var out []expr.Any
+		for _, e := range exprs {
+			switch e.(type) {
+			case *expr.Rt, *expr.Byteorder, *expr.Counter:
+				continue
+			}
+			out = append(out, e)
+		}
+		return out
+	}
+	want := decodable(rule.Exprs)
+	for _, r := range rules {
+		if reflect.DeepEqual(decodable(r.Exprs), want) {
+			return r, nil
+		}
+	}
+	return nil, nil
+}
+
+// AddMSSClampRule adds netfilter rules that clamp the MSS of TCP
+// connections forwarded through tunname to the path MTU, so that
+// subnet routed connections work over links with a small MTU, such as
+// PPPoE links, even if ICMP "packet too big" messages are dropped.
+func (n *nftablesRunner) AddMSSClampRule(tunname string) error {
+	conn := n.conn
+
+	for _, table := range n.getTables() {
+		chain, err := getChainFromTable(conn, table.Filter, chainNameForward)
+		if err != nil {
+			return fmt.Errorf("get forward chain: %w", err)
+		}
+		for _, dir := range []expr.MetaKey{expr.MetaKeyIIFNAME, expr.MetaKeyOIFNAME} {
+			rule, err := findMSSClampRule(conn, table.Filter, chain, tunname, dir)
+			if err != nil {
+				return fmt.Errorf("find MSS clamp rule: %w", err)
+			}
+			if rule != nil {
+				continue
+			}
+			// Insert at the top of the chain, so that the rules
+			// run before the base rules accept the packets.
+			_ = conn.InsertRule(createMSSClampRule(table.Filter, chain, tunname, dir))
+		}
+	}
+
+	if err := conn.Flush(); err != nil {
+		return fmt.Errorf("flush add MSS clamp rule: %w", err)
+	}
+
+	return nil
+}
+
+// DelMSSClampRule removes the netfilter rules that clamp the MSS of
+// TCP connections forwarded through tunname.
+func (n *nftablesRunner) DelMSSClampRule(tunname string) error {
+	conn := n.conn
+
+	for _, table := range n.getTables() {
+		chain, err := getChainFromTable(conn, table.Filter, chainNameForward)
+		if err != nil {
+			return fmt.Errorf("get forward chain: %w", err)
+		}
+		for _, dir := range []expr.MetaKey{expr.MetaKeyIIFNAME, expr.MetaKeyOIFNAME} {
+			rule, err := findMSSClampRule(conn, table.Filter, chain, tunname, dir)
+			if err != nil {
+				return fmt.Errorf("find MSS clamp rule: %w", err)
+			}
+			if rule != nil {
+				_ = conn.DelRule(rule)
+			}
+		}
+	}
+
+	if err := conn.Flush(); err != nil {
+		return fmt.Errorf("flush del MSS clamp rule: %w", err)
+	}
+
+	return nil
+}
+
 // cleanupChain removes a jump rule from hookChainName to tsChainName, and then
 // the entire chain tsChainName. Errors are logged, but attempts to remove both
 // the jump rule and chain continue even if one errors.
-func cleanupChain(logf logger.Logf, conn *nftables.Conn, table *nftables.Table, hookChainName, tsChainName string) {
+func cleanupChain(logf logger.Logf, conn nftablesInterface, table *nftables.Table, hookChainName, tsChainName string) {
 	// remove the jump first, before removing the jump destination.
 	defaultChain, err := getChainFromTable(conn, table, hookChainName)
 	if err != nil && !errors.Is(err, errorChainNotFound{table.Name, hookChainName}) {
@@ -914,3 +914,100 @@ func TestNFTAddAndDelHookRule(t *testing.T) {
 		t.Fatalf("expected 0 rule in POSTROUTING chain, got %v", len(postroutingChainRules))
 	}
 }
+
+func TestNFTAddAndDelMSSClampRule(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip(t.Name(), " requires privileges to create a namespace in order to run")
+		return
+	}
+
+	conn := newSysConn(t)
+
+	runner := newFakeNftablesRunner(t, conn)
+	runner.AddChains()
+	defer runner.DelChains()
+	runner.AddBase("testTunn")
+	defer runner.DelBase()
+
+	countRules := func() int {
+		n := 0
+		for _, table := range runner.getTables() {
+			forward, err := getChainFromTable(conn, table.Filter, chainNameForward)
+			if err != nil {
+				t.Fatalf("getChainFromTable() failed: %v", err)
+			}
+			rules, err := conn.GetRules(table.Filter, forward)
+			if err != nil {
+				t.Fatalf("GetRules() failed: %v", err)
+			}
+			n += len(rules)
+		}
+		return n
+	}
+
+	if err := runner.AddMSSClampRule("testTunn"); err != nil {
+		t.Fatalf("AddMSSClampRule() failed: %v", err)
+	}
+	n := countRules()
+	if err := runner.AddMSSClampRule("testTunn"); err != nil {
+		t.Fatalf("AddMSSClampRule() failed: %v", err)
+	}
+	if got := countRules(); got != n {
+		t.Fatalf("got %d rules after adding MSS clamp rules twice, want %d", got, n)
+	}
+
+	for _, table := range runner.getTables() {
+		forward, err := getChainFromTable(conn, table.Filter, chainNameForward)
+		if err != nil {
+			t.Fatalf("getChainFromTable() failed: %v", err)
+		}
+		for _, dir := range []expr.MetaKey{expr.MetaKeyIIFNAME, expr.MetaKeyOIFNAME} {
+			rule, err := findMSSClampRule(conn, table.Filter, forward, "testTunn", dir)
+			if err != nil {
+				t.Fatalf("findMSSClampRule() failed: %v", err)
+			}
+			if rule == nil {
+				t.Fatalf("MSS clamp rule for %v not found", dir)
+			}
+		}
+	}
+
+	if err := runner.DelMSSClampRule("testTunn"); err != nil {
+		t.Fatalf("DelMSSClampRule() failed: %v", err)
+	}
+
+	for _, table := range runner.getTables() {
+		forward, err := getChainFromTable(conn, table.Filter, chainNameForward)
+		if err != nil {
+			t.Fatalf("getChainFromTable() failed: %v", err)
+		}
+		for _, dir := range []expr.MetaKey{expr.MetaKeyIIFNAME, expr.MetaKeyOIFNAME} {
+			rule, err := findMSSClampRule(conn, table.Filter, forward, "testTunn", dir)
+			if err != nil {
+				t.Fatalf("findMSSClampRule() failed: %v", err)
+			}
+			if rule != nil {
+				t.Fatalf("MSS clamp rule for %v still exists", dir)
+			}
+		}
+	}
+}
+
+func TestNFTDelSNATRuleDeletesAddedRule(t *testing.T) {
+	r, f := newNftablesRunnerWithFake(true, true)
+	if err := r.AddChains(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.AddSNATRule(); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(f.dump(), "masq"); got != 2 {
+		t.Fatalf("%d masquerade rules after AddSNATRule; want 2:\n%s", got, f.dump())
+	}
+	if err := r.DelSNATRule(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(f.dump(), "masq") {
+		t.Errorf("masquerade rule left after DelSNATRule:\n%s", f.dump())
+	}
+}
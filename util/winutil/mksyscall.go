@@ -8,3 +8,4 @@
 
 //sys queryServiceConfig2(hService windows.Handle, infoLevel uint32, buf *byte, bufLen uint32, bytesNeeded *uint32) (err error) [failretval==0] = advapi32.QueryServiceConfig2W
 //sys registerApplicationRestart(cmdLineExclExeName *uint16, flags uint32) (ret wingoes.HRESULT) = kernel32.RegisterApplicationRestart
+//sys refreshPolicyEx(bMachine bool, flags uint32) (err error) [int32(failretval)==0] = userenv.RefreshPolicyEx
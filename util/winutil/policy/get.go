@@ -0,0 +1,59 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package policy
+
+import (
+	"fmt"
+	"log"
+
+	"tailscale.com/util/winutil"
+)
+
+// mustLookup returns the definition of k, which must be of type t. It panics
+// otherwise, as that's a bug in the caller.
+func mustLookup(k Key, t ...Type) *Definition {
+	d, ok := Lookup(k)
+	if !ok {
+		panic(fmt.Sprintf("unknown policy %q", k))
+	}
+	for _, typ := range t {
+		if d.Type == typ {
+			return d
+		}
+	}
+	panic(fmt.Sprintf("policy %q is of type %v, not %v", k, d.Type, t))
+}
+
+// GetString returns the value of the system policy k, or its default if it's
+// not set or is set to an invalid value. It panics if k is not a known
+// string-valued policy.
+//
+// System policies are only read on Windows; on other platforms, GetString
+// always returns the default.
+func GetString(k Key) string {
+	d := mustLookup(k, StringType, PreferenceOptionType, VisibilityType, DurationType, IPAddrType)
+	v, err := winutil.GetPolicyString(string(k))
+	if err != nil || v == "" {
+		return d.Default
+	}
+	if err := d.Validate(v); err != nil {
+		log.Printf("%v; using default", err)
+		return d.Default
+	}
+	return v
+}
+
+// GetBoolean returns the value of the system policy k, or its default if
+// it's not set. It panics if k is not a known boolean policy.
+//
+// System policies are only read on Windows; on other platforms, GetBoolean
+// always returns the default.
+func GetBoolean(k Key) bool {
+	d := mustLookup(k, BooleanType)
+	v, err := winutil.GetPolicyInteger(string(k))
+	if err != nil {
+		return d.Default == "1"
+	}
+	return v != 0
+}
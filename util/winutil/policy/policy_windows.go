@@ -6,8 +6,6 @@
 
 import (
 	"time"
-
-	"tailscale.com/util/winutil"
 )
 
 // PreferenceOptionPolicy is a policy that governs whether a boolean variable
@@ -48,12 +46,9 @@ func (p PreferenceOptionPolicy) ShouldEnable(userChoice bool) bool {
 // the authority to set. It describes user-decides/always/never options, where
 // "always" and "never" remove the user's ability to make a selection. If not
 // present or set to a different value, "user-decides" is the default.
-func GetPreferenceOptionPolicy(name string) PreferenceOptionPolicy {
-	opt, err := winutil.GetPolicyString(name)
-	if opt == "" || err != nil {
-		return showChoiceByPolicy
-	}
-	switch opt {
+func GetPreferenceOptionPolicy(k Key) PreferenceOptionPolicy {
+	mustLookup(k, PreferenceOptionType)
+	switch GetString(k) {
 	case "always":
 		return alwaysByPolicy
 	case "never":
@@ -83,12 +78,9 @@ func (p VisibilityPolicy) Show() bool {
 // for UI elements. The registry value should be a string set to "show" (return
 // true) or "hide" (return true). If not present or set to a different value,
 // "show" (return false) is the default.
-func GetVisibilityPolicy(name string) VisibilityPolicy {
-	opt, err := winutil.GetPolicyString(name)
-	if opt == "" || err != nil {
-		return visibleByPolicy
-	}
-	switch opt {
+func GetVisibilityPolicy(k Key) VisibilityPolicy {
+	mustLookup(k, VisibilityType)
+	switch GetString(k) {
 	case "hide":
 		return hiddenByPolicy
 	default:
@@ -101,13 +93,14 @@ func GetVisibilityPolicy(name string) VisibilityPolicy {
 // action. The registry value should be a string that time.ParseDuration
 // understands. If the registry value is "" or can not be processed,
 // defaultValue is returned instead.
-func GetDurationPolicy(name string, defaultValue time.Duration) time.Duration {
-	opt, err := winutil.GetPolicyString(name)
-	if opt == "" || err != nil {
+func GetDurationPolicy(k Key, defaultValue time.Duration) time.Duration {
+	mustLookup(k, DurationType)
+	opt := GetString(k)
+	if opt == "" {
 		return defaultValue
 	}
 	v, err := time.ParseDuration(opt)
-	if err != nil || v < 0 {
+	if err != nil {
 		return defaultValue
 	}
 	return v
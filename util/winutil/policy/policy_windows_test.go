@@ -3,7 +3,11 @@
 
 package policy
 
-import "testing"
+import (
+	"testing"
+
+	"tailscale.com/util/winutil"
+)
 
 func TestSelectControlURL(t *testing.T) {
 	tests := []struct {
@@ -36,3 +40,45 @@ func TestSelectControlURL(t *testing.T) {
 		}
 	}
 }
+
+func TestSetPolicy(t *testing.T) {
+	if !winutil.IsCurrentProcessElevated() {
+		t.Skip("setting system policies requires an elevated process")
+	}
+	for _, k := range []Key{UnattendedMode, LogSCMInteractions} {
+		k := k
+		if _, err := winutil.GetPolicyString(string(k)); err == nil {
+			t.Skipf("policy %q is already set on this machine", k)
+		}
+		if _, err := winutil.GetPolicyInteger(string(k)); err == nil {
+			t.Skipf("policy %q is already set on this machine", k)
+		}
+		t.Cleanup(func() { Delete(k) })
+	}
+
+	if err := SetString(UnattendedMode, "always"); err != nil {
+		t.Fatal(err)
+	}
+	if got := GetString(UnattendedMode); got != "always" {
+		t.Errorf("GetString(UnattendedMode) = %q; want always", got)
+	}
+	if err := SetBoolean(LogSCMInteractions, true); err != nil {
+		t.Fatal(err)
+	}
+	if !GetBoolean(LogSCMInteractions) {
+		t.Error("GetBoolean(LogSCMInteractions) = false; want true")
+	}
+	if err := winutil.RefreshPolicy(); err != nil {
+		t.Errorf("RefreshPolicy: %v", err)
+	}
+
+	if err := Delete(UnattendedMode); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := GetString(UnattendedMode), mustLookup(UnattendedMode, PreferenceOptionType).Default; got != want {
+		t.Errorf("after Delete, GetString(UnattendedMode) = %q; want default %q", got, want)
+	}
+	if err := Delete(UnattendedMode); err != nil {
+		t.Errorf("deleting an unset policy: %v", err)
+	}
+}
@@ -0,0 +1,334 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package policy
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Key is the name of a system policy, as set by administrators in the
+// registry on Windows.
+type Key string
+
+// Keys of the known system policies. See definitions for their types and
+// defaults.
+const (
+	// ControlURL is the URL of the control server.
+	ControlURL Key = "LoginURL"
+	// EnableIncomingConnections is whether incoming connections are
+	// allowed. It's the negation of the ShieldsUp preference.
+	EnableIncomingConnections Key = "AllowIncomingConnections"
+	// UnattendedMode is whether tailscaled keeps running when the user
+	// logs out. It maps to the ForceDaemon preference.
+	UnattendedMode Key = "UnattendedMode"
+	// ExitNodeIP is the IP address of the exit node to use.
+	ExitNodeIP Key = "ExitNodeIP"
+	// ExitNodeFailover is a comma-separated list of the stable node IDs of
+	// exit nodes to fail over to, in order.
+	ExitNodeFailover Key = "ExitNodeFailover"
+	// LogSCMInteractions is whether the Windows service logs its
+	// interactions with the Service Control Manager to the event log.
+	LogSCMInteractions Key = "LogSCMInteractions"
+	// DNSMode is the kind of DNS manager tailscaled uses on Linux. It
+	// takes precedence over the DNSMode preference.
+	DNSMode Key = "DNSMode"
+	// FlushDNSOnSessionUnlock is whether the DNS cache is flushed when a
+	// Windows session is unlocked.
+	FlushDNSOnSessionUnlock Key = "FlushDNSOnSessionUnlock"
+	// AdminOnlySettings is whether only local administrators can change
+	// the node's state through the LocalAPI. Other users can still view it.
+	AdminOnlySettings Key = "AdminOnlySettings"
+	// TaildropAutoAcceptDir is the directory received Taildrop files are
+	// moved to automatically. It and the other TaildropAutoAccept
+	// policies take precedence over the TaildropAutoAccept preference.
+	TaildropAutoAcceptDir Key = "TaildropAutoAcceptDir"
+	// TaildropAutoAcceptConflict is what to do with a received file when
+	// the TaildropAutoAcceptDir already has one of the same name.
+	TaildropAutoAcceptConflict Key = "TaildropAutoAcceptConflict"
+	// TaildropAutoAcceptMaxBytes is the most that the files in the
+	// TaildropAutoAcceptDir may add up to, in bytes.
+	TaildropAutoAcceptMaxBytes Key = "TaildropAutoAcceptMaxBytes"
+	// RouteMetric is the metric of the routes Tailscale adds on Windows.
+	RouteMetric Key = "RouteMetric"
+	// ExcludedRoutes is a comma-separated list of IP prefixes that are never
+	// routed into the Tailscale interface on Windows.
+	ExcludedRoutes Key = "ExcludedRoutes"
+	// DERPHomeRegion is the ID of the DERP region to use as the node's home.
+	// It takes precedence over the DERPHomeRegion preference.
+	DERPHomeRegion Key = "DERPHomeRegion"
+	// DERPExcludeRegions is a comma-separated list of the IDs of DERP regions
+	// never to use as the node's home, in addition to those in the
+	// DERPExcludeRegions preference.
+	DERPExcludeRegions Key = "DERPExcludeRegions"
+	// KeyExpirationNoticeTime is how long before the node key expires that
+	// the node warns about it and acts to renew it.
+	KeyExpirationNoticeTime Key = "KeyExpirationNotice"
+	// ServeDeniedTargets is a comma-separated list of IP prefixes and host
+	// names that serve and funnel handlers may not proxy or forward to.
+	ServeDeniedTargets Key = "ServeDeniedTargets"
+	// ServeAllowedPaths is a comma-separated list of the directories that
+	// serve and funnel handlers may serve files from.
+	ServeAllowedPaths Key = "ServeAllowedPaths"
+	// PostureChecking is whether device posture attributes are collected
+	// and sent to the control server. It takes precedence over the
+	// PostureChecking preference.
+	PostureChecking Key = "PostureChecking"
+)
+
+// Type is the type of the value of a system policy.
+type Type int
+
+const (
+	// StringType is a free-form string value.
+	StringType Type = iota
+	// BooleanType is an integer value, where non-zero means true.
+	BooleanType
+	// PreferenceOptionType is one of "always", "never" or "user-decides".
+	// See PreferenceOptionPolicy.
+	PreferenceOptionType
+	// VisibilityType is one of "show" or "hide". See VisibilityPolicy.
+	VisibilityType
+	// DurationType is a string that time.ParseDuration understands.
+	DurationType
+	// IPAddrType is a string that netip.ParseAddr understands.
+	IPAddrType
+)
+
+func (t Type) String() string {
+	switch t {
+	case StringType:
+		return "string"
+	case BooleanType:
+		return "boolean"
+	case PreferenceOptionType:
+		return "preference option"
+	case VisibilityType:
+		return "visibility"
+	case DurationType:
+		return "duration"
+	case IPAddrType:
+		return "IP address"
+	}
+	return fmt.Sprintf("Type(%d)", int(t))
+}
+
+// IsInteger reports whether values of type t are stored as integers rather
+// than strings.
+func (t Type) IsInteger() bool { return t == BooleanType }
+
+// Definition describes a system policy.
+type Definition struct {
+	Key  Key
+	Type Type
+
+	// Default is the value used when the policy isn't set, or is set to an
+	// invalid value. For BooleanType, it's "0" or "1".
+	Default string
+
+	// AllowedValues, if non-empty, are the only values the policy may be
+	// set to. It's implied for PreferenceOptionType and VisibilityType.
+	AllowedValues []string
+
+	// Platforms are the GOOS values of the platforms the policy applies to.
+	Platforms []string
+
+	// Description is a human-readable description of the policy, for
+	// documentation and administrative templates.
+	Description string
+}
+
+// definitions are the known system policies, sorted by key.
+var definitions = []*Definition{
+	{
+		Key:         AdminOnlySettings,
+		Type:        BooleanType,
+		Default:     "0",
+		Platforms:   []string{"windows"},
+		Description: "Whether only members of the local Administrators group can change Tailscale settings, log in or out, or connect and disconnect. Other users can still view the status.",
+	},
+	{
+		Key:         EnableIncomingConnections,
+		Type:        PreferenceOptionType,
+		Default:     "user-decides",
+		Platforms:   []string{"windows"},
+		Description: "Whether other devices on the tailnet can connect to this device. \"never\" blocks incoming connections, like 'tailscale up --shields-up'.",
+	},
+	{
+		Key:         DERPExcludeRegions,
+		Type:        StringType,
+		Platforms:   []string{"windows"},
+		Description: "Comma-separated IDs of DERP regions that are never used as the device's home region, such as regions blocked on the local network. Peers homed in them are still reached through them.",
+	},
+	{
+		Key:         DERPHomeRegion,
+		Type:        StringType,
+		Platforms:   []string{"windows"},
+		Description: "ID of the DERP region to use as the device's home region, instead of the one with the lowest latency. It's ignored if the DERP map has no such region. If not set, the user's preference applies.",
+	},
+	{
+		Key:           DNSMode,
+		Type:          StringType,
+		AllowedValues: []string{"direct", "systemd-resolved", "network-manager", "debian-resolvconf", "openresolv", "resolvconf"},
+		Platforms:     []string{"linux"},
+		Description:   "Kind of DNS manager to use on Linux instead of detecting one, for systems where detection picks the wrong one. \"resolvconf\" picks the installed flavor of resolvconf. Takes effect when tailscaled starts.",
+	},
+	{
+		Key:         ExcludedRoutes,
+		Type:        StringType,
+		Platforms:   []string{"windows"},
+		Description: "Comma-separated IP prefixes, such as \"10.20.0.0/16,192.168.1.0/24\", that Tailscale never routes into its interface, even if a peer advertises a route that covers them. Use it to keep traffic to another VPN's networks on that VPN.",
+	},
+	{
+		Key:         ExitNodeFailover,
+		Type:        StringType,
+		Platforms:   []string{"windows"},
+		Description: "Comma-separated list of the stable node IDs of exit nodes to switch to, in order, when the current exit node goes offline.",
+	},
+	{
+		Key:         ExitNodeIP,
+		Type:        IPAddrType,
+		Platforms:   []string{"windows"},
+		Description: "IP address of the exit node to use by default.",
+	},
+	{
+		Key:         FlushDNSOnSessionUnlock,
+		Type:        BooleanType,
+		Default:     "0",
+		Platforms:   []string{"windows"},
+		Description: "Whether to flush the DNS cache when a Windows session is unlocked.",
+	},
+	{
+		Key:         KeyExpirationNoticeTime,
+		Type:        DurationType,
+		Default:     "24h",
+		Platforms:   []string{"windows"},
+		Description: "How long before the node key expires to warn about it and renew it, as a Go duration such as \"72h\": Tailscale runs the key expiry hook of tailscaled, if any, or else starts an interactive login. \"0s\" turns the warning off.",
+	},
+	{
+		Key:         LogSCMInteractions,
+		Type:        BooleanType,
+		Default:     "0",
+		Platforms:   []string{"windows"},
+		Description: "Whether the Tailscale service logs its interactions with the Service Control Manager to the Windows event log.",
+	},
+	{
+		Key:         ControlURL,
+		Type:        StringType,
+		Platforms:   []string{"windows"},
+		Description: "URL of the control server to use instead of the Tailscale one, such as a self-hosted coordination server.",
+	},
+	{
+		Key:         PostureChecking,
+		Type:        PreferenceOptionType,
+		Default:     "user-decides",
+		Platforms:   []string{"windows"},
+		Description: "Whether Tailscale collects device posture attributes, such as whether the disk is encrypted, whether the firewall is on and the serial number, and sends them to the control server for use in access rules. \"always\" collects them without asking the user, and \"never\" keeps the user from turning collection on.",
+	},
+	{
+		Key:         RouteMetric,
+		Type:        StringType,
+		Platforms:   []string{"windows"},
+		Description: "Metric of the routes that Tailscale adds, as a decimal number. Windows prefers the route with the lowest metric among routes to the same prefix, so raising it lets another VPN's routes win. If not set, the metric is 0.",
+	},
+	{
+		Key:         ServeAllowedPaths,
+		Type:        StringType,
+		Platforms:   []string{"windows"},
+		Description: "Comma-separated absolute paths of the directories, such as \"C:\\srv\", that 'tailscale serve' and 'tailscale funnel' may serve files and directories from, including their subdirectories. If not set, any path may be served.",
+	},
+	{
+		Key:         ServeDeniedTargets,
+		Type:        StringType,
+		Platforms:   []string{"windows"},
+		Description: "Comma-separated IP prefixes and host names, such as \"169.254.0.0/16,metadata.internal\", that 'tailscale serve' and 'tailscale funnel' may not proxy or forward connections to. Host names are matched as written in the serve config, not resolved, so deny the names of denied addresses too.",
+	},
+	{
+		Key:           TaildropAutoAcceptConflict,
+		Type:          StringType,
+		AllowedValues: []string{"skip", "overwrite", "rename"},
+		Platforms:     []string{"windows", "linux"},
+		Description:   "What to do with a received Taildrop file when the auto-accept directory already has a file of the same name: \"skip\" leaves it in the Taildrop inbox, \"overwrite\" replaces the existing file, and \"rename\" gives it a number-suffixed name. If not set, the user's preference applies, which defaults to \"skip\".",
+	},
+	{
+		Key:         TaildropAutoAcceptDir,
+		Type:        StringType,
+		Platforms:   []string{"windows", "linux"},
+		Description: "Absolute path of a directory to automatically move received Taildrop files to, for unattended machines. If not set, the user's preference applies.",
+	},
+	{
+		Key:         TaildropAutoAcceptMaxBytes,
+		Type:        StringType,
+		Platforms:   []string{"windows", "linux"},
+		Description: "Most bytes that the files in the Taildrop auto-accept directory may add up to, as a decimal number. Received files that would exceed it stay in the Taildrop inbox. If not set, the user's preference applies.",
+	},
+	{
+		Key:         UnattendedMode,
+		Type:        PreferenceOptionType,
+		Default:     "user-decides",
+		Platforms:   []string{"windows"},
+		Description: "Whether Tailscale keeps running after the user logs out of Windows. \"always\" runs it in unattended mode.",
+	},
+}
+
+// Definitions returns the definitions of all known system policies, sorted
+// by key.
+func Definitions() []*Definition {
+	return slices.Clone(definitions)
+}
+
+// Lookup returns the definition of the system policy k.
+func Lookup(k Key) (_ *Definition, ok bool) {
+	for _, d := range definitions {
+		if d.Key == k {
+			return d, true
+		}
+	}
+	return nil, false
+}
+
+// Allowed returns the values that d may be set to, or nil if any value of
+// its type is allowed.
+func (d *Definition) Allowed() []string {
+	if len(d.AllowedValues) > 0 {
+		return d.AllowedValues
+	}
+	switch d.Type {
+	case PreferenceOptionType:
+		return []string{"always", "never", "user-decides"}
+	case VisibilityType:
+		return []string{"show", "hide"}
+	}
+	return nil
+}
+
+// AppliesTo reports whether d applies to the platform goos.
+func (d *Definition) AppliesTo(goos string) bool {
+	return slices.Contains(d.Platforms, goos)
+}
+
+// Validate reports whether v is a valid value for d.
+func (d *Definition) Validate(v string) error {
+	if allowed := d.Allowed(); len(allowed) > 0 && !slices.Contains(allowed, v) {
+		return fmt.Errorf("policy %s: invalid value %q, want one of %s", d.Key, v, strings.Join(allowed, ", "))
+	}
+	switch d.Type {
+	case BooleanType:
+		if v != "0" && v != "1" {
+			return fmt.Errorf("policy %s: invalid boolean %q", d.Key, v)
+		}
+	case DurationType:
+		if dur, err := time.ParseDuration(v); err != nil || dur < 0 {
+			return fmt.Errorf("policy %s: invalid duration %q", d.Key, v)
+		}
+	case IPAddrType:
+		if _, err := netip.ParseAddr(v); err != nil {
+			return fmt.Errorf("policy %s: invalid IP address %q", d.Key, v)
+		}
+	}
+	return nil
+}
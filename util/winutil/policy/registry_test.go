@@ -0,0 +1,94 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package policy
+
+import (
+	"cmp"
+	"slices"
+	"testing"
+)
+
+func TestDefinitions(t *testing.T) {
+	keys := []Key{
+		ControlURL,
+		EnableIncomingConnections,
+		UnattendedMode,
+		ExitNodeIP,
+		ExitNodeFailover,
+		LogSCMInteractions,
+		FlushDNSOnSessionUnlock,
+		DNSMode,
+		AdminOnlySettings,
+		TaildropAutoAcceptDir,
+		TaildropAutoAcceptConflict,
+		TaildropAutoAcceptMaxBytes,
+		RouteMetric,
+		ExcludedRoutes,
+		DERPHomeRegion,
+		DERPExcludeRegions,
+		KeyExpirationNoticeTime,
+		ServeDeniedTargets,
+		ServeAllowedPaths,
+		PostureChecking,
+	}
+	for _, k := range keys {
+		if _, ok := Lookup(k); !ok {
+			t.Errorf("policy %q has no definition", k)
+		}
+	}
+	if len(definitions) != len(keys) {
+		t.Errorf("got %d definitions, want %d", len(definitions), len(keys))
+	}
+	if !slices.IsSortedFunc(definitions, func(a, b *Definition) int {
+		return cmp.Compare(a.Key, b.Key)
+	}) {
+		t.Error("definitions aren't sorted by key")
+	}
+	for _, d := range definitions {
+		if d.Default != "" {
+			if err := d.Validate(d.Default); err != nil {
+				t.Errorf("invalid default: %v", err)
+			}
+		}
+		if len(d.Platforms) == 0 {
+			t.Errorf("policy %q has no platforms", d.Key)
+		}
+		if d.Description == "" {
+			t.Errorf("policy %q has no description", d.Key)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		key     Key
+		v       string
+		wantErr bool
+	}{
+		{ControlURL, "https://example.com", false},
+		{EnableIncomingConnections, "always", false},
+		{EnableIncomingConnections, "never", false},
+		{EnableIncomingConnections, "user-decides", false},
+		{EnableIncomingConnections, "sometimes", true},
+		{ExitNodeIP, "100.64.0.1", false},
+		{ExitNodeIP, "fd7a:115c:a1e0::1", false},
+		{ExitNodeIP, "exit-node", true},
+		{LogSCMInteractions, "1", false},
+		{LogSCMInteractions, "2", true},
+		{DNSMode, "systemd-resolved", false},
+		{DNSMode, "bogus", true},
+		{KeyExpirationNoticeTime, "72h", false},
+		{KeyExpirationNoticeTime, "3 days", true},
+	}
+	for _, tt := range tests {
+		d, ok := Lookup(tt.key)
+		if !ok {
+			t.Fatalf("unknown policy %q", tt.key)
+		}
+		err := d.Validate(tt.v)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Validate(%s, %q) = %v; wantErr %v", tt.key, tt.v, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package policy
+
+import (
+	"fmt"
+
+	"tailscale.com/util/winutil"
+)
+
+// SetString sets the string-valued system policy k to v, as a sysadmin
+// would via GPO or an MDM solution. It's meant for tests and tooling, and
+// returns an error if v isn't valid for k. It panics if k is not a known
+// string-valued policy.
+//
+// Call winutil.RefreshPolicy afterwards to have the change applied as a
+// Group Policy update would be.
+func SetString(k Key, v string) error {
+	d := mustLookup(k, StringType, PreferenceOptionType, VisibilityType, DurationType, IPAddrType)
+	if err := d.Validate(v); err != nil {
+		return err
+	}
+	return winutil.SetPolicyString(string(k), v)
+}
+
+// SetBoolean sets the boolean system policy k to v. See SetString.
+func SetBoolean(k Key, v bool) error {
+	mustLookup(k, BooleanType)
+	var i uint64
+	if v {
+		i = 1
+	}
+	return winutil.SetPolicyInteger(string(k), i)
+}
+
+// Delete removes the system policy k, so that its default applies again.
+// It's not an error if k isn't set. It panics if k is not a known policy.
+func Delete(k Key) error {
+	if _, ok := Lookup(k); !ok {
+		panic(fmt.Sprintf("unknown policy %q", k))
+	}
+	return winutil.DeletePolicyValue(string(k))
+}
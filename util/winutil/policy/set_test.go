@@ -0,0 +1,21 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package policy
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+)
+
+func TestSetStringValidates(t *testing.T) {
+	if err := SetString(UnattendedMode, "sometimes"); err == nil {
+		t.Error("SetString accepted an invalid value")
+	}
+	if runtime.GOOS != "windows" {
+		if err := SetString(UnattendedMode, "always"); !errors.Is(err, errors.ErrUnsupported) {
+			t.Errorf("SetString on %s: got %v; want ErrUnsupported", runtime.GOOS, err)
+		}
+	}
+}
@@ -38,6 +38,46 @@ func GetPolicyInteger(name string) (uint64, error) {
 	return getPolicyInteger(name)
 }
 
+// SetPolicyString sets a string registry value in the local machine's path
+// for system policies, as a sysadmin would via GPO or an MDM solution. It's
+// meant for tests and tooling; tailscaled itself only reads policies.
+// Call RefreshPolicy afterwards to notify Group Policy clients of the change.
+//
+// This function will only work on GOOS=windows. Trying to run it on any other
+// OS will always return errors.ErrUnsupported.
+func SetPolicyString(name, value string) error {
+	return setPolicyString(name, value)
+}
+
+// SetPolicyInteger sets an integer registry value in the local machine's
+// path for system policies. Values that fit in 32 bits are stored as
+// REG_DWORD, as GPO does; larger ones as REG_QWORD. See SetPolicyString.
+//
+// This function will only work on GOOS=windows. Trying to run it on any other
+// OS will always return errors.ErrUnsupported.
+func SetPolicyInteger(name string, value uint64) error {
+	return setPolicyInteger(name, value)
+}
+
+// DeletePolicyValue removes a registry value set by SetPolicyString or
+// SetPolicyInteger. It's not an error if the value doesn't exist.
+//
+// This function will only work on GOOS=windows. Trying to run it on any other
+// OS will always return errors.ErrUnsupported.
+func DeletePolicyValue(name string) error {
+	return deletePolicyValue(name)
+}
+
+// RefreshPolicy asks Windows to reapply the machine's Group Policy, as
+// "gpupdate /target:computer /force" does, which makes Group Policy clients
+// see policy values changed by the functions above.
+//
+// This function will only work on GOOS=windows. Trying to run it on any other
+// OS will always return errors.ErrUnsupported.
+func RefreshPolicy() error {
+	return refreshPolicy()
+}
+
 // GetRegString looks up a registry path in the local machine path, or returns
 // an empty string and error.
 //
@@ -24,6 +24,14 @@ func getRegString(name string) (string, error) { return "", ErrNoValue }
 
 func getRegInteger(name string) (uint64, error) { return 0, ErrNoValue }
 
+func setPolicyString(name, value string) error { return errors.ErrUnsupported }
+
+func setPolicyInteger(name string, value uint64) error { return errors.ErrUnsupported }
+
+func deletePolicyValue(name string) error { return errors.ErrUnsupported }
+
+func refreshPolicy() error { return errors.ErrUnsupported }
+
 func isSIDValidPrincipal(uid string) bool { return false }
 
 func lookupPseudoUser(uid string) (*user.User, error) {
@@ -7,6 +7,7 @@
 	"errors"
 	"fmt"
 	"log"
+	"math"
 	"os"
 	"os/exec"
 	"os/user"
@@ -150,6 +151,39 @@ func setRegStringsInternal(subKey, name string, values []string) error {
 	return key.SetStringsValue(name, values)
 }
 
+func setPolicyString(name, value string) error {
+	key, _, err := registry.CreateKey(registry.LOCAL_MACHINE, regPolicyBase, registry.SET_VALUE)
+	if err != nil {
+		return err
+	}
+	defer key.Close()
+	return key.SetStringValue(name, value)
+}
+
+func setPolicyInteger(name string, value uint64) error {
+	key, _, err := registry.CreateKey(registry.LOCAL_MACHINE, regPolicyBase, registry.SET_VALUE)
+	if err != nil {
+		return err
+	}
+	defer key.Close()
+	if value <= math.MaxUint32 {
+		return key.SetDWordValue(name, uint32(value))
+	}
+	return key.SetQWordValue(name, value)
+}
+
+func deletePolicyValue(name string) error {
+	return deleteRegValueInternal(regPolicyBase, name)
+}
+
+// rpForce is the RP_FORCE option of RefreshPolicyEx, which reapplies all
+// policies even if they haven't changed.
+const rpForce = 1
+
+func refreshPolicy() error {
+	return refreshPolicyEx(true, rpForce)
+}
+
 // DeleteRegValue removes a registry value in the local machine path.
 func DeleteRegValue(name string) error {
 	return deleteRegValueInternal(regBase, name)
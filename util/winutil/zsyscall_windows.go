@@ -41,9 +41,11 @@ func errnoErr(e syscall.Errno) error {
 var (
 	modadvapi32 = windows.NewLazySystemDLL("advapi32.dll")
 	modkernel32 = windows.NewLazySystemDLL("kernel32.dll")
+	moduserenv  = windows.NewLazySystemDLL("userenv.dll")
 
 	procQueryServiceConfig2W       = modadvapi32.NewProc("QueryServiceConfig2W")
 	procRegisterApplicationRestart = modkernel32.NewProc("RegisterApplicationRestart")
+	procRefreshPolicyEx            = moduserenv.NewProc("RefreshPolicyEx")
 )
 
 func queryServiceConfig2(hService windows.Handle, infoLevel uint32, buf *byte, bufLen uint32, bytesNeeded *uint32) (err error) {
@@ -59,3 +61,15 @@ func registerApplicationRestart(cmdLineExclExeName *uint16, flags uint32) (ret w
 	ret = wingoes.HRESULT(r0)
 	return
 }
+
+func refreshPolicyEx(bMachine bool, flags uint32) (err error) {
+	var _p0 uint32
+	if bMachine {
+		_p0 = 1
+	}
+	r1, _, e1 := syscall.Syscall(procRefreshPolicyEx.Addr(), 2, uintptr(_p0), uintptr(flags), 0)
+	if int32(r1) == 0 {
+		err = errnoErr(e1)
+	}
+	return
+}
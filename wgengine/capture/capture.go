@@ -10,12 +10,15 @@
 	"encoding/binary"
 	"io"
 	"net/http"
+	"net/netip"
+	"slices"
 	"sync"
 	"time"
 
 	_ "embed"
 
 	"tailscale.com/net/packet"
+	"tailscale.com/types/ipproto"
 	"tailscale.com/util/set"
 )
 
@@ -95,10 +98,62 @@ type Sink struct {
 	ctxCancel context.CancelFunc
 
 	mu         sync.Mutex
-	outputs    set.HandleSet[io.Writer]
+	outputs    set.HandleSet[output]
 	flushTimer *time.Timer // or nil if none running
 }
 
+// output is an output registered with a Sink.
+type output struct {
+	w      io.Writer
+	filter *Filter // or nil for all packets
+}
+
+// Filter selects the packets that are written to an output. A nil Filter
+// selects all packets.
+type Filter struct {
+	// Hosts, if non-empty, selects only the IP packets from or to one of
+	// these addresses. The addresses of packets before NAT also count.
+	Hosts []netip.Addr
+
+	// Ports, if non-empty, selects only the TCP, UDP and SCTP packets
+	// from or to one of these ports.
+	Ports []uint16
+}
+
+// match reports whether f selects the packet p, which was logged with
+// meta. p is zero if the packet isn't an IP packet.
+func (f *Filter) match(p *packet.Parsed, meta packet.CaptureMeta) bool {
+	if f == nil {
+		return true
+	}
+	if p.IPVersion == 0 {
+		return false
+	}
+	if len(f.Hosts) > 0 {
+		addrs := []netip.Addr{p.Src.Addr(), p.Dst.Addr()}
+		if meta.DidSNAT {
+			addrs = append(addrs, meta.OriginalSrc.Addr())
+		}
+		if meta.DidDNAT {
+			addrs = append(addrs, meta.OriginalDst.Addr())
+		}
+		if !slices.ContainsFunc(addrs, func(a netip.Addr) bool { return slices.Contains(f.Hosts, a) }) {
+			return false
+		}
+	}
+	if len(f.Ports) > 0 {
+		switch p.IPProto {
+		case ipproto.TCP, ipproto.UDP, ipproto.SCTP:
+		default:
+			return false
+		}
+		if !slices.Contains(f.Ports, p.Src.Port()) && !slices.Contains(f.Ports, p.Dst.Port()) {
+			return false
+		}
+	}
+	return true
+}
+
 // RegisterOutput connects an output to this sink, which
 // will be written to with a pcap stream as packets are logged.
 // A function is returned which unregisters the output when
@@ -108,6 +163,12 @@ type Sink struct {
 // or when the sink is closed. If w implements http.Flusher,
 // it will be flushed periodically.
 func (s *Sink) RegisterOutput(w io.Writer) (unregister func()) {
+	return s.RegisterFilteredOutput(w, nil)
+}
+
+// RegisterFilteredOutput is like RegisterOutput, but only the packets
+// selected by f are written to w.
+func (s *Sink) RegisterFilteredOutput(w io.Writer, f *Filter) (unregister func()) {
 	select {
 	case <-s.ctx.Done():
 		return func() {}
@@ -116,7 +177,7 @@ func (s *Sink) RegisterOutput(w io.Writer) (unregister func()) {
 
 	writePcapHeader(w)
 	s.mu.Lock()
-	hnd := s.outputs.Add(w)
+	hnd := s.outputs.Add(output{w, f})
 	s.mu.Unlock()
 
 	return func() {
@@ -146,8 +207,8 @@ func (s *Sink) Close() error {
 	}
 
 	for _, o := range s.outputs {
-		if o, ok := o.(io.Closer); ok {
-			o.Close()
+		if c, ok := o.w.(io.Closer); ok {
+			c.Close()
 		}
 	}
 	s.outputs = nil
@@ -209,16 +270,28 @@ func (s *Sink) LogPacket(path Path, when time.Time, data []byte, meta packet.Cap
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	var parsed *packet.Parsed // decoded on first use by a filter
 	var hadError []set.Handle
 	for hnd, o := range s.outputs {
-		if _, err := o.Write(b.Bytes()); err != nil {
+		if o.filter != nil {
+			if parsed == nil {
+				parsed = new(packet.Parsed)
+				if path != PathDisco {
+					parsed.Decode(data)
+				}
+			}
+			if !o.filter.match(parsed, meta) {
+				continue
+			}
+		}
+		if _, err := o.w.Write(b.Bytes()); err != nil {
 			hadError = append(hadError, hnd)
 			continue
 		}
 	}
 	for _, hnd := range hadError {
-		if o, ok := s.outputs[hnd].(io.Closer); ok {
-			o.Close()
+		if c, ok := s.outputs[hnd].w.(io.Closer); ok {
+			c.Close()
 		}
 		delete(s.outputs, hnd)
 	}
@@ -228,7 +301,7 @@ func (s *Sink) LogPacket(path Path, when time.Time, data []byte, meta packet.Cap
 			s.mu.Lock()
 			defer s.mu.Unlock()
 			for _, o := range s.outputs {
-				if f, ok := o.(http.Flusher); ok {
+				if f, ok := o.w.(http.Flusher); ok {
 					f.Flush()
 				}
 			}
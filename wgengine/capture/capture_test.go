@@ -0,0 +1,63 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package capture
+
+import (
+	"bytes"
+	"net/netip"
+	"testing"
+	"time"
+
+	"tailscale.com/net/packet"
+	"tailscale.com/types/ipproto"
+)
+
+func TestFilteredOutput(t *testing.T) {
+	udp := func(src, dst string, sport, dport uint16) []byte {
+		return packet.Generate(packet.UDP4Header{
+			IP4Header: packet.IP4Header{
+				IPProto: ipproto.UDP,
+				Src:     netip.MustParseAddr(src),
+				Dst:     netip.MustParseAddr(dst),
+			},
+			SrcPort: sport,
+			DstPort: dport,
+		}, []byte("hi"))
+	}
+	s := New()
+	defer s.Close()
+
+	var all, byHost, byPort, both bytes.Buffer
+	s.RegisterOutput(&all)
+	s.RegisterFilteredOutput(&byHost, &Filter{Hosts: []netip.Addr{netip.MustParseAddr("100.64.0.2")}})
+	s.RegisterFilteredOutput(&byPort, &Filter{Ports: []uint16{53}})
+	s.RegisterFilteredOutput(&both, &Filter{Hosts: []netip.Addr{netip.MustParseAddr("100.64.0.2")}, Ports: []uint16{53}})
+	headerLen := all.Len()
+
+	now := time.Now()
+	s.LogPacket(FromLocal, now, udp("100.64.0.1", "100.64.0.2", 1000, 53), packet.CaptureMeta{})
+	s.LogPacket(FromPeer, now, udp("100.64.0.3", "100.64.0.1", 53, 1000), packet.CaptureMeta{})
+	s.LogPacket(FromPeer, now, udp("100.64.0.2", "100.64.0.1", 80, 1000), packet.CaptureMeta{})
+	s.LogPacket(PathDisco, now, []byte("disco"), packet.CaptureMeta{})
+
+	// Each packet record has the same length, but for the disco frame.
+	recLen := 16 + 4 + 28 + 2
+	tests := []struct {
+		name string
+		buf  *bytes.Buffer
+		want int // packet records
+	}{
+		{"host", &byHost, 2},
+		{"port", &byPort, 2},
+		{"both", &both, 1},
+	}
+	for _, tt := range tests {
+		if got := tt.buf.Len() - headerLen; got != tt.want*recLen {
+			t.Errorf("%s: wrote %d bytes of records; want %d records of %d bytes", tt.name, got, tt.want, recLen)
+		}
+	}
+	if got, want := all.Len()-headerLen, 3*recLen+16+4+len("disco"); got != want {
+		t.Errorf("unfiltered: wrote %d bytes of records; want %d", got, want)
+	}
+}
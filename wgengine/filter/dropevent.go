@@ -0,0 +1,86 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package filter
+
+import (
+	"fmt"
+	"net/netip"
+	"time"
+
+	"tailscale.com/net/flowtrack"
+	"tailscale.com/net/packet"
+	"tailscale.com/tstime/rate"
+	"tailscale.com/types/ipproto"
+)
+
+// DropEvent describes a flow dropped by the packet filter.
+// See Filter.SetDropEventFunc.
+type DropEvent struct {
+	Time time.Time
+
+	// Dir is the direction of the flow: "in" for packets from a
+	// Tailscale peer to this node, or "out" for packets from this node.
+	Dir string
+
+	Proto ipproto.Proto
+	Src   netip.AddrPort
+	Dst   netip.AddrPort
+
+	// Reason is why the flow was dropped, such as "no rules matched" or
+	// "destination not allowed".
+	Reason string
+}
+
+func (e DropEvent) String() string {
+	return fmt.Sprintf("%s %v %v => %v: %s", e.Dir, e.Proto, e.Src, e.Dst, e.Reason)
+}
+
+const (
+	// dropEventFlowInterval is how often at most a DropEvent is sent for
+	// the packets of a single flow, such as the retried SYNs of a TCP
+	// connection.
+	dropEventFlowInterval = 10 * time.Second
+
+	// dropEventFlowsMax is the number of flows whose last DropEvent time
+	// is remembered.
+	dropEventFlowsMax = 256
+)
+
+// dropEventBucket limits the rate of DropEvents across all flows.
+var dropEventBucket = rate.NewLimiter(rate.Every(time.Second), 20)
+
+// SetDropEventFunc sets the func that's called, rate limited, with a
+// DropEvent for each flow that f drops. Flows to or from IPs that aren't
+// allowed in logs, and spammy local traffic like multicast, are omitted.
+// It must be called before f is in use. fn must not block, as it runs on
+// the packet processing path.
+func (f *Filter) SetDropEventFunc(fn func(DropEvent)) {
+	f.onDrop = fn
+}
+
+// noteDrop sends a DropEvent for q, which is being dropped for the reason
+// why, unless one was sent recently for its flow or too many were sent
+// recently overall.
+func (f *Filter) noteDrop(q *packet.Parsed, dir direction, why string) {
+	now := time.Now()
+	t := flowtrack.Tuple{Proto: q.IPProto, Src: q.Src, Dst: q.Dst}
+	f.state.mu.Lock()
+	last, ok := f.state.dropEvents.Get(t)
+	recent := ok && now.Sub(*last) < dropEventFlowInterval
+	if !recent {
+		f.state.dropEvents.Add(t, now)
+	}
+	f.state.mu.Unlock()
+	if recent || !dropEventBucket.Allow() {
+		return
+	}
+	f.onDrop(DropEvent{
+		Time:   now,
+		Dir:    dir.String(),
+		Proto:  q.IPProto,
+		Src:    q.Src,
+		Dst:    q.Dst,
+		Reason: why,
+	})
+}
@@ -56,12 +56,18 @@ type Filter struct {
 	state *filterState
 
 	shieldsUp bool
+
+	onDrop func(DropEvent) // or nil; see SetDropEventFunc
 }
 
 // filterState is a state cache of past seen packets.
 type filterState struct {
 	mu  sync.Mutex
 	lru *flowtrack.Cache[struct{}] // from flowtrack.Tuple -> struct{}
+
+	// dropEvents is the time of the last DropEvent of recently dropped
+	// flows, to send at most one per dropEventFlowInterval per flow.
+	dropEvents *flowtrack.Cache[time.Time]
 }
 
 // lruMax is the size of the LRU cache in filterState.
@@ -178,7 +184,8 @@ func New(matches []Match, localNets *netipx.IPSet, logIPs *netipx.IPSet, shareSt
 		state = shareStateWith.state
 	} else {
 		state = &filterState{
-			lru: &flowtrack.Cache[struct{}]{MaxEntries: lruMax},
+			lru:        &flowtrack.Cache[struct{}]{MaxEntries: lruMax},
+			dropEvents: &flowtrack.Cache[time.Time]{MaxEntries: dropEventFlowsMax},
 		}
 	}
 	f := &Filter{
@@ -276,6 +283,10 @@ func (f *Filter) logRateLimit(runflags RunFlags, q *packet.Parsed, dir direction
 		return
 	}
 
+	if r == Drop && f.onDrop != nil {
+		f.noteDrop(q, dir, why)
+	}
+
 	var verdict string
 	if r == Drop && (runflags&LogDrops) != 0 && dropBucket.Allow() {
 		verdict = "Drop"
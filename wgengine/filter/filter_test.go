@@ -7,10 +7,12 @@
 	"encoding/hex"
 	"fmt"
 	"net/netip"
+	"reflect"
 	"slices"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"go4.org/netipx"
@@ -196,6 +198,29 @@ func TestUDPState(t *testing.T) {
 	}
 }
 
+func TestDropEvents(t *testing.T) {
+	acl := newFilter(t.Logf)
+	var got []DropEvent
+	acl.SetDropEventFunc(func(ev DropEvent) {
+		ev.Time = time.Time{}
+		got = append(got, ev)
+	})
+
+	denied := parsed(ipproto.TCP, "8.1.1.1", "1.2.3.4", 999, 21)
+	allowed := parsed(ipproto.TCP, "8.1.1.1", "1.2.3.4", 999, 22)
+	otherDenied := parsed(ipproto.TCP, "8.3.3.3", "1.2.3.4", 999, 22)
+	for _, p := range []packet.Parsed{denied, denied, allowed, otherDenied} {
+		acl.RunIn(&p, 0)
+	}
+	want := []DropEvent{
+		{Dir: "in", Proto: ipproto.TCP, Src: denied.Src, Dst: denied.Dst, Reason: "no rules matched"},
+		{Dir: "in", Proto: ipproto.TCP, Src: otherDenied.Src, Dst: otherDenied.Dst, Reason: "no rules matched"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("drop events:\n got %v\nwant %v", got, want)
+	}
+}
+
 func TestNoAllocs(t *testing.T) {
 	acl := newFilter(t.Logf)
 
@@ -69,6 +69,17 @@ type D struct {
 	}
 	fmt.Fprintf(w, "</ul>\n")
 
+	fmt.Fprintf(w, "<h2 id=holepunch><a href=#holepunch>#</a> hole punching</h2>")
+	{
+		k := c.holePunchKey()
+		st := c.holePunchStrategy(k.nat)
+		fmt.Fprintf(w, "<p>NAT: %v; strategy: predict %d ports, probe spacing %v</p><ul>\n", k, st.predictPorts, st.probeSpacing)
+		for _, s := range holePunchStatsSnapshot() {
+			fmt.Fprintf(w, "<li>%v: %d/%d attempts succeeded</li>\n", s.key, s.successes, s.attempts)
+		}
+		fmt.Fprintf(w, "</ul>\n")
+	}
+
 	fmt.Fprintf(w, "<h2 id=ipport><a href=#ipport>#</a> ip:port to endpoint</h2><ul>")
 	{
 		type kv struct {
@@ -56,6 +56,9 @@
 	debugEnablePMTUD = envknob.RegisterOptBool("TS_DEBUG_ENABLE_PMTUD")
 	// debugPMTUD prints extra debugging about peer MTU path discovery.
 	debugPMTUD = envknob.RegisterBool("TS_DEBUG_PMTUD")
+	// debugHolePunchStrategy tunes hole punching per local NAT type, in the
+	// format described at parseHolePunchStrategies.
+	debugHolePunchStrategy = envknob.RegisterString("TS_DEBUG_HOLEPUNCH_STRATEGY")
 	// Hey you! Adding a new debugknob? Make sure to stub it out in the
 	// debugknobs_stubs.go file too.
 )
@@ -13,6 +13,7 @@
 	"net/netip"
 	"reflect"
 	"runtime"
+	"slices"
 	"sort"
 	"sync"
 	"time"
@@ -23,6 +24,7 @@
 	"tailscale.com/health"
 	"tailscale.com/logtail/backoff"
 	"tailscale.com/net/dnscache"
+	"tailscale.com/net/netcheck"
 	"tailscale.com/net/tsaddr"
 	"tailscale.com/syncs"
 	"tailscale.com/tailcfg"
@@ -116,15 +118,65 @@ func (c *Conn) pickDERPFallback() int {
 	// We used to do the above for legacy clients, but never updated
 	// it for disco.
 
-	if c.myDerp != 0 {
+	if c.myDerp != 0 && !slices.Contains(c.derpHomeExclude, c.myDerp) {
 		return c.myDerp
 	}
 
+	ids = slices.DeleteFunc(ids, func(id int) bool {
+		return slices.Contains(c.derpHomeExclude, id)
+	})
+	if len(ids) == 0 {
+		// All regions excluded.
+		return 0
+	}
 	h := fnv.New64()
 	fmt.Fprintf(h, "%p/%d", c, processStartUnixNano) // arbitrary
 	return ids[rand.New(rand.NewSource(int64(h.Sum64()))).Intn(len(ids))]
 }
 
+// SetDERPHomePrefs sets the DERP region to use as the home region, if pin is
+// non-zero, and the regions never to use as it. A pinned region that isn't in
+// the DERP map is ignored. Peers whose home is in an excluded region are still
+// reached through it.
+func (c *Conn) SetDERPHomePrefs(pin int, exclude []int) {
+	c.mu.Lock()
+	if c.derpHomePin == pin && slices.Equal(c.derpHomeExclude, exclude) {
+		c.mu.Unlock()
+		return
+	}
+	c.derpHomePin = pin
+	c.derpHomeExclude = slices.Clone(exclude)
+	c.mu.Unlock()
+	c.ReSTUN("derp-home-prefs")
+}
+
+// pickDERPHome returns the DERP region to use as home, given the latest
+// netcheck report: the pinned region if there is one, and otherwise the
+// report's preferred region or, if that's excluded, the lowest latency
+// region that isn't. It returns 0 if there's no such region.
+//
+// c.mu must NOT be held.
+func (c *Conn) pickDERPHome(report *netcheck.Report) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.derpHomePin != 0 && c.derpMap != nil && c.derpMap.Regions[c.derpHomePin] != nil {
+		return c.derpHomePin
+	}
+	if !slices.Contains(c.derpHomeExclude, report.PreferredDERP) {
+		return report.PreferredDERP
+	}
+	best, bestLatency := 0, time.Duration(0)
+	for id, d := range report.RegionLatency {
+		if slices.Contains(c.derpHomeExclude, id) {
+			continue
+		}
+		if best == 0 || d < bestLatency || (d == bestLatency && id < best) {
+			best, bestLatency = id, d
+		}
+	}
+	return best
+}
+
 func (c *Conn) derpRegionCodeLocked(regionID int) string {
 	if c.derpMap == nil {
 		return ""
@@ -664,6 +716,7 @@ func (c *Conn) processDERPReadResult(dm derpReadResult, b []byte) (n int, ep *en
 	}
 
 	ep.noteRecvActivity(ipp)
+	ep.linkStats.rxBytes.Add(int64(dm.n))
 	if stats := c.stats.Load(); stats != nil {
 		stats.UpdateRxPhysical(ep.nodeAddr, ipp, dm.n)
 	}
@@ -73,6 +73,11 @@ type endpoint struct {
 	endpointState      map[netip.AddrPort]*endpointState
 	isCallMeMaybeEP    map[netip.AddrPort]bool
 
+	holePunchStart mono.Time    // start of the hole-punch attempt in progress; zero if none
+	holePunchKey   holePunchKey // statistics key of the attempt in progress
+
+	linkStats linkStats // partially guarded by mu; see its docs
+
 	// The following fields are related to the new "silent disco"
 	// implementation that's a WIP as of 2022-10-20.
 	// See #540 for background.
@@ -504,18 +509,22 @@ func (de *endpoint) send(buffs [][]byte) error {
 		}
 
 		// TODO(raggi): needs updating for accuracy, as in error conditions we may have partial sends.
-		if stats := de.c.stats.Load(); err == nil && stats != nil {
+		if err == nil {
 			var txBytes int
 			for _, b := range buffs {
 				txBytes += len(b)
 			}
-			stats.UpdateTxPhysical(de.nodeAddr, udpAddr, txBytes)
+			de.linkStats.txBytes.Add(int64(txBytes))
+			if stats := de.c.stats.Load(); stats != nil {
+				stats.UpdateTxPhysical(de.nodeAddr, udpAddr, txBytes)
+			}
 		}
 	}
 	if derpAddr.IsValid() {
 		allOk := true
 		for _, buff := range buffs {
 			ok, _ := de.c.sendAddr(derpAddr, de.publicKey, buff)
+			de.linkStats.txBytes.Add(int64(len(buff)))
 			if stats := de.c.stats.Load(); stats != nil {
 				stats.UpdateTxPhysical(de.nodeAddr, derpAddr, len(buff))
 			}
@@ -540,6 +549,7 @@ func (de *endpoint) discoPingTimeout(txid stun.TxID) {
 	if debugDisco() || !de.bestAddr.IsValid() || mono.Now().After(de.trustBestAddrUntil) {
 		de.c.dlogf("[v1] magicsock: disco: timeout waiting for pong %x from %v (%v, %v)", txid[:6], sp.to, de.publicKey.ShortString(), de.discoShort())
 	}
+	de.linkStats.pingsLost++
 	de.removeSentDiscoPingLocked(txid, sp)
 }
 
@@ -549,6 +559,8 @@ func (de *endpoint) forgetDiscoPing(txid stun.TxID) {
 	de.mu.Lock()
 	defer de.mu.Unlock()
 	if sp, ok := de.sentPing[txid]; ok {
+		// The ping was never sent, so it doesn't count.
+		de.linkStats.pingsSent--
 		de.removeSentDiscoPingLocked(txid, sp)
 	}
 }
@@ -636,6 +648,7 @@ func (de *endpoint) startDiscoPingLocked(ep netip.AddrPort, now mono.Time, purpo
 		res:     res,
 		cb:      cb,
 	}
+	de.linkStats.pingsSent++
 
 	logLevel := discoLog
 	if purpose == pingHeartbeat {
@@ -647,7 +660,12 @@ func (de *endpoint) startDiscoPingLocked(ep netip.AddrPort, now mono.Time, purpo
 // sendDiscoPingsLocked starts pinging all of ep's endpoints.
 func (de *endpoint) sendDiscoPingsLocked(now mono.Time, sendCallMeMaybe bool) {
 	de.lastFullPing = now
-	var sentAny bool
+	var (
+		sentAny bool
+		numSent int
+	)
+	// spacing is the delay between pings, per the hole-punch strategy.
+	spacing := de.c.holePunchStrategy(de.c.holePunchKey().nat).probeSpacing
 	for ep, st := range de.endpointState {
 		if st.shouldDeleteLocked() {
 			de.deleteEndpointLocked("sendPingsLocked", ep)
@@ -665,9 +683,28 @@ func (de *endpoint) sendDiscoPingsLocked(now mono.Time, sendCallMeMaybe bool) {
 
 		if firstPing && sendCallMeMaybe {
 			de.c.dlogf("[v1] magicsock: disco: send, starting discovery for %v (%v)", de.publicKey.ShortString(), de.discoShort())
+			if !de.bestAddr.IsValid() || now.After(de.trustBestAddrUntil) {
+				de.noteHolePunchStartLocked(now)
+			}
 		}
 
-		de.startDiscoPingLocked(ep, now, pingDiscovery, 0, nil, nil)
+		if spacing > 0 && numSent > 0 {
+			// Pace the pings of this round per the hole-punch strategy.
+			// Mark the endpoint as pinged now, so the next round doesn't
+			// schedule it again in the meantime.
+			st.lastPing = now
+			ep := ep
+			time.AfterFunc(time.Duration(numSent)*spacing, func() {
+				de.mu.Lock()
+				defer de.mu.Unlock()
+				if _, ok := de.endpointState[ep]; ok {
+					de.startDiscoPingLocked(ep, mono.Now(), pingDiscovery, 0, nil, nil)
+				}
+			})
+		} else {
+			de.startDiscoPingLocked(ep, now, pingDiscovery, 0, nil, nil)
+		}
+		numSent++
 	}
 	derpAddr := de.derpAddr
 	if sentAny && sendCallMeMaybe && derpAddr.IsValid() {
@@ -972,6 +1009,7 @@ func (de *endpoint) handlePongConnLocked(m *disco.Pong, di *discoInfo, src netip
 
 	now := mono.Now()
 	latency := now.Sub(sp.at)
+	de.linkStats.notePongLocked(latency)
 
 	if !isDerp {
 		st, ok := de.endpointState[sp.to]
@@ -988,6 +1026,7 @@ func (de *endpoint) handlePongConnLocked(m *disco.Pong, di *discoInfo, src netip
 			from:    src,
 			pongSrc: m.Src,
 		})
+		de.noteHolePunchSuccessLocked(now)
 	}
 
 	if sp.purpose != pingHeartbeat {
@@ -1126,8 +1165,14 @@ func (de *endpoint) handleCallMeMaybe(m *disco.CallMeMaybe) {
 	for ep := range de.isCallMeMaybeEP {
 		de.isCallMeMaybeEP[ep] = false // mark for deletion
 	}
+	eps := m.MyNumber
+	if n := de.c.holePunchStrategy(de.c.holePunchKey().nat).predictPorts; n > 0 {
+		// Also try the ports that a NAT allocating ports sequentially
+		// is likely to have mapped for the peer's more recent flows.
+		eps = append(eps[:len(eps):len(eps)], predictedPorts(m.MyNumber, n)...)
+	}
 	var newEPs []netip.AddrPort
-	for _, ep := range m.MyNumber {
+	for _, ep := range eps {
 		if ep.Addr().Is6() && ep.Addr().IsLinkLocalUnicast() {
 			// We send these out, but ignore them for now.
 			// TODO: teach the ping code to ping on all interfaces
@@ -1183,6 +1228,7 @@ func (de *endpoint) populatePeerStatus(ps *ipnstate.PeerStatus) {
 	defer de.mu.Unlock()
 
 	ps.Relay = de.c.derpRegionCodeOfIDLocked(int(de.derpAddr.Port()))
+	ps.LinkStats = de.linkStats.asPeerLinkStatsLocked()
 
 	if de.lastSend.IsZero() {
 		return
@@ -0,0 +1,270 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"tailscale.com/tstime/mono"
+	"tailscale.com/util/clientmetric"
+)
+
+// natType is the kind of NAT the local node is behind, as last measured by
+// netcheck. It's what hole-punching statistics and strategies are keyed by.
+type natType string
+
+const (
+	natUnknown natType = "unknown" // no netcheck report yet, or inconclusive
+	natEasy    natType = "easy"    // endpoint-independent mapping
+	natHard    natType = "hard"    // mapping varies by destination IP
+)
+
+var natTypes = []natType{natEasy, natHard, natUnknown}
+
+// holePunchKey is what hole-punch statistics are grouped by. It
+// deliberately contains nothing that identifies the node or its peers.
+type holePunchKey struct {
+	nat        natType
+	portMapped bool // whether a NAT-PMP/PCP/UPnP mapping was available
+}
+
+func (k holePunchKey) String() string {
+	if k.portMapped {
+		return string(k.nat) + "_portmapped"
+	}
+	return string(k.nat) + "_noportmap"
+}
+
+// holePunchCounters are the statistics for a holePunchKey.
+type holePunchCounters struct {
+	attempts  *clientmetric.Metric
+	successes *clientmetric.Metric
+}
+
+var holePunchStats struct {
+	mu sync.Mutex
+	m  map[holePunchKey]*holePunchCounters // created lazily, as clientmetrics can't be unregistered
+}
+
+// holePunchCountersFor returns the counters for k, registering them on
+// first use.
+func holePunchCountersFor(k holePunchKey) *holePunchCounters {
+	holePunchStats.mu.Lock()
+	defer holePunchStats.mu.Unlock()
+	if hc, ok := holePunchStats.m[k]; ok {
+		return hc
+	}
+	hc := &holePunchCounters{
+		attempts:  clientmetric.NewCounter("magicsock_holepunch_attempts_nat_" + k.String()),
+		successes: clientmetric.NewCounter("magicsock_holepunch_successes_nat_" + k.String()),
+	}
+	if holePunchStats.m == nil {
+		holePunchStats.m = make(map[holePunchKey]*holePunchCounters)
+	}
+	holePunchStats.m[k] = hc
+	return hc
+}
+
+// metricHolePunchDuration is the time from the start of a successful
+// hole-punch attempt to the first direct pong.
+var metricHolePunchDuration = clientmetric.NewHistogram("magicsock_holepunch_duration_seconds", clientmetric.DurationBuckets)
+
+// holePunchKey returns the current hole-punch statistics key of c.
+func (c *Conn) holePunchKey() holePunchKey {
+	k := holePunchKey{nat: natUnknown}
+	if r := c.lastNetCheckReport.Load(); r != nil {
+		if varies, ok := r.MappingVariesByDestIP.Get(); ok {
+			k.nat = natEasy
+			if varies {
+				k.nat = natHard
+			}
+		}
+	}
+	if c.portMapper != nil {
+		k.portMapped = c.portMapper.HaveMapping()
+	}
+	return k
+}
+
+// noteHolePunchStartLocked records the start of an attempt to establish a
+// direct path to de, if one isn't already in progress.
+//
+// de.mu must be held.
+func (de *endpoint) noteHolePunchStartLocked(now mono.Time) {
+	if !de.holePunchStart.IsZero() && now.Sub(de.holePunchStart) < pingTimeoutDuration {
+		return
+	}
+	de.holePunchStart = now
+	de.holePunchKey = de.c.holePunchKey()
+	holePunchCountersFor(de.holePunchKey).attempts.Add(1)
+}
+
+// noteHolePunchSuccessLocked records that a direct pong was received from
+// de, completing any attempt in progress.
+//
+// de.mu must be held.
+func (de *endpoint) noteHolePunchSuccessLocked(now mono.Time) {
+	if de.holePunchStart.IsZero() {
+		return
+	}
+	if d := now.Sub(de.holePunchStart); d < pingTimeoutDuration {
+		holePunchCountersFor(de.holePunchKey).successes.Add(1)
+		metricHolePunchDuration.ObserveDuration(d)
+	}
+	de.holePunchStart = 0
+}
+
+// holePunchStat is the hole-punch statistics for a holePunchKey, as
+// shown on the debug page.
+type holePunchStat struct {
+	key                 holePunchKey
+	attempts, successes int64
+}
+
+func holePunchStatsSnapshot() []holePunchStat {
+	holePunchStats.mu.Lock()
+	defer holePunchStats.mu.Unlock()
+	ret := make([]holePunchStat, 0, len(holePunchStats.m))
+	for k, hc := range holePunchStats.m {
+		ret = append(ret, holePunchStat{k, hc.attempts.Value(), hc.successes.Value()})
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].key.String() < ret[j].key.String() })
+	return ret
+}
+
+// holePunchStrategy tunes how discovery tries to establish a direct path
+// to peers.
+type holePunchStrategy struct {
+	// predictPorts is the number of ports following each of a peer's
+	// public IPv4 endpoints that are also probed, for NATs that allocate
+	// ports sequentially. Zero disables port prediction.
+	predictPorts int
+
+	// probeSpacing is the delay between successive discovery pings in a
+	// round. Zero sends them all at once.
+	probeSpacing time.Duration
+}
+
+// maxPredictPorts bounds holePunchStrategy.predictPorts, so a typo can't
+// make discovery flood a peer.
+const maxPredictPorts = 256
+
+// parseHolePunchStrategies parses the value of TS_DEBUG_HOLEPUNCH_STRATEGY,
+// a semicolon-separated list of rules of the form
+//
+//	<nat>:<key>=<value>[,<key>=<value>...]
+//
+// where <nat> is "easy", "hard", "unknown" or "all", and the keys are
+// "predict" (the number of ports to predict) and "spacing" (a duration).
+// Later rules override earlier ones. For example:
+//
+//	all:spacing=10ms;hard:predict=16
+func parseHolePunchStrategies(s string) (map[natType]holePunchStrategy, error) {
+	ret := make(map[natType]holePunchStrategy)
+	for _, rule := range strings.Split(s, ";") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		nat, settings, ok := strings.Cut(rule, ":")
+		if !ok {
+			return nil, fmt.Errorf("rule %q: missing NAT type", rule)
+		}
+		var targets []natType
+		switch nt := natType(nat); nt {
+		case "all":
+			targets = natTypes
+		case natEasy, natHard, natUnknown:
+			targets = []natType{nt}
+		default:
+			return nil, fmt.Errorf("rule %q: unknown NAT type %q", rule, nat)
+		}
+		for _, kv := range strings.Split(settings, ",") {
+			k, v, ok := strings.Cut(kv, "=")
+			if !ok {
+				return nil, fmt.Errorf("rule %q: setting %q is not key=value", rule, kv)
+			}
+			var apply func(*holePunchStrategy)
+			switch k {
+			case "predict":
+				n, err := strconv.Atoi(v)
+				if err != nil || n < 0 || n > maxPredictPorts {
+					return nil, fmt.Errorf("rule %q: predict must be between 0 and %d", rule, maxPredictPorts)
+				}
+				apply = func(st *holePunchStrategy) { st.predictPorts = n }
+			case "spacing":
+				d, err := time.ParseDuration(v)
+				if err != nil || d < 0 || d > pingTimeoutDuration {
+					return nil, fmt.Errorf("rule %q: spacing must be a duration between 0 and %v", rule, pingTimeoutDuration)
+				}
+				apply = func(st *holePunchStrategy) { st.probeSpacing = d }
+			default:
+				return nil, fmt.Errorf("rule %q: unknown setting %q", rule, k)
+			}
+			for _, nt := range targets {
+				st := ret[nt]
+				apply(&st)
+				ret[nt] = st
+			}
+		}
+	}
+	return ret, nil
+}
+
+var holePunchStrategies struct {
+	mu  sync.Mutex
+	raw string // last parsed value of TS_DEBUG_HOLEPUNCH_STRATEGY
+	m   map[natType]holePunchStrategy
+}
+
+// holePunchStrategy returns the hole-punch strategy to use while the local
+// node is behind the provided kind of NAT.
+func (c *Conn) holePunchStrategy(nt natType) holePunchStrategy {
+	raw := debugHolePunchStrategy()
+	holePunchStrategies.mu.Lock()
+	defer holePunchStrategies.mu.Unlock()
+	if raw != holePunchStrategies.raw {
+		m, err := parseHolePunchStrategies(raw)
+		if err != nil {
+			c.logf("magicsock: ignoring invalid TS_DEBUG_HOLEPUNCH_STRATEGY: %v", err)
+		}
+		holePunchStrategies.raw = raw
+		holePunchStrategies.m = m
+	}
+	return holePunchStrategies.m[nt]
+}
+
+// predictedPorts returns the endpoints that port prediction adds to eps: up
+// to n ports following the port of each public IPv4 endpoint, skipping
+// those already in eps.
+func predictedPorts(eps []netip.AddrPort, n int) []netip.AddrPort {
+	if n <= 0 {
+		return nil
+	}
+	have := make(map[netip.AddrPort]bool, len(eps))
+	for _, ep := range eps {
+		have[ep] = true
+	}
+	var ret []netip.AddrPort
+	for _, ep := range eps {
+		ip := ep.Addr()
+		if !ip.Is4() || ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() {
+			continue
+		}
+		for p := int(ep.Port()) + 1; p <= int(ep.Port())+n && p <= 65535; p++ {
+			pep := netip.AddrPortFrom(ip, uint16(p))
+			if !have[pep] {
+				have[pep] = true
+				ret = append(ret, pep)
+			}
+		}
+	}
+	return ret
+}
@@ -0,0 +1,86 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseHolePunchStrategies(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    map[natType]holePunchStrategy
+		wantErr bool
+	}{
+		{
+			in:   "",
+			want: map[natType]holePunchStrategy{},
+		},
+		{
+			in: "hard:predict=16",
+			want: map[natType]holePunchStrategy{
+				natHard: {predictPorts: 16},
+			},
+		},
+		{
+			in: "all:spacing=10ms; hard:predict=16,spacing=50ms",
+			want: map[natType]holePunchStrategy{
+				natEasy:    {probeSpacing: 10 * time.Millisecond},
+				natHard:    {predictPorts: 16, probeSpacing: 50 * time.Millisecond},
+				natUnknown: {probeSpacing: 10 * time.Millisecond},
+			},
+		},
+		{
+			in: "easy:predict=4;all:predict=0",
+			want: map[natType]holePunchStrategy{
+				natEasy:    {},
+				natHard:    {},
+				natUnknown: {},
+			},
+		},
+		{in: "predict=16", wantErr: true},
+		{in: "symmetric:predict=16", wantErr: true},
+		{in: "hard:predict", wantErr: true},
+		{in: "hard:predict=-1", wantErr: true},
+		{in: "hard:predict=100000", wantErr: true},
+		{in: "hard:spacing=1h", wantErr: true},
+		{in: "hard:birthday=on", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseHolePunchStrategies(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseHolePunchStrategies(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseHolePunchStrategies(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestPredictedPorts(t *testing.T) {
+	eps := []netip.AddrPort{
+		netip.MustParseAddrPort("1.2.3.4:1000"),
+		netip.MustParseAddrPort("1.2.3.4:1001"),
+		netip.MustParseAddrPort("5.6.7.8:65534"),
+		netip.MustParseAddrPort("192.168.1.2:1000"),
+		netip.MustParseAddrPort("[2001:db8::1]:1000"),
+	}
+	if got := predictedPorts(eps, 0); got != nil {
+		t.Errorf("predictedPorts(n=0) = %v, want nil", got)
+	}
+	got := predictedPorts(eps, 3)
+	want := []netip.AddrPort{
+		netip.MustParseAddrPort("1.2.3.4:1002"),
+		netip.MustParseAddrPort("1.2.3.4:1003"),
+		netip.MustParseAddrPort("1.2.3.4:1004"),
+		netip.MustParseAddrPort("5.6.7.8:65535"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("predictedPorts(n=3) = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"sync/atomic"
+	"time"
+
+	"tailscale.com/ipn/ipnstate"
+)
+
+// linkStats are the statistics of the quality of the link to an endpoint's
+// peer, reported as ipnstate.PeerLinkStats.
+//
+// Packet loss is inferred from disco pings: magicsock can't see WireGuard's
+// or the inner transport's retransmissions, but it does see which of its
+// own pings go unanswered.
+type linkStats struct {
+	txBytes atomic.Int64
+	rxBytes atomic.Int64
+
+	// The following fields are guarded by endpoint.mu.
+	pingsSent int64
+	pingsLost int64
+	latency   time.Duration // of the last answered ping; 0 if none
+	jitter    time.Duration
+}
+
+// notePongLocked records the answer to a ping with round-trip time latency.
+func (s *linkStats) notePongLocked(latency time.Duration) {
+	if s.latency != 0 {
+		// The interarrival jitter estimator of RFC 3550, section 6.4.1.
+		d := latency - s.latency
+		if d < 0 {
+			d = -d
+		}
+		s.jitter += (d - s.jitter) / 16
+	}
+	s.latency = latency
+}
+
+// asPeerLinkStatsLocked returns the statistics of s as reported in
+// ipnstate.PeerStatus.
+func (s *linkStats) asPeerLinkStatsLocked() *ipnstate.PeerLinkStats {
+	return &ipnstate.PeerLinkStats{
+		TxBytes:   s.txBytes.Load(),
+		RxBytes:   s.rxBytes.Load(),
+		PingsSent: s.pingsSent,
+		PingsLost: s.pingsLost,
+		Latency:   s.latency,
+		Jitter:    s.jitter,
+	}
+}
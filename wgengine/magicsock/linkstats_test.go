@@ -0,0 +1,41 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLinkStats(t *testing.T) {
+	var s linkStats
+	s.txBytes.Add(100)
+	s.rxBytes.Add(200)
+	s.pingsSent = 4
+	s.pingsLost = 1
+
+	// A steady round-trip time has no jitter.
+	for i := 0; i < 3; i++ {
+		s.notePongLocked(10 * time.Millisecond)
+	}
+	if s.jitter != 0 {
+		t.Errorf("jitter = %v; want 0", s.jitter)
+	}
+	// A change moves the jitter by 1/16th of the difference.
+	s.notePongLocked(26 * time.Millisecond)
+	if want := time.Millisecond; s.jitter != want {
+		t.Errorf("jitter = %v; want %v", s.jitter, want)
+	}
+
+	ps := s.asPeerLinkStatsLocked()
+	if ps.TxBytes != 100 || ps.RxBytes != 200 {
+		t.Errorf("bytes = %d tx, %d rx; want 100 tx, 200 rx", ps.TxBytes, ps.RxBytes)
+	}
+	if ps.Latency != 26*time.Millisecond {
+		t.Errorf("latency = %v; want 26ms", ps.Latency)
+	}
+	if got := ps.Loss(); got != 0.25 {
+		t.Errorf("loss = %v; want 0.25", got)
+	}
+}
@@ -18,6 +18,7 @@
 	"net/http/httptest"
 	"net/netip"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
@@ -44,6 +45,7 @@
 	"tailscale.com/ipn/ipnstate"
 	"tailscale.com/net/connstats"
 	"tailscale.com/net/netaddr"
+	"tailscale.com/net/netcheck"
 	"tailscale.com/net/packet"
 	"tailscale.com/net/ping"
 	"tailscale.com/net/stun/stuntest"
@@ -476,11 +478,62 @@ func TestPickDERPFallback(t *testing.T) {
 		t.Errorf("not sticky: got %v; want %v", got, someNode)
 	}
 
+	// Test that excluded regions are never picked, even if sticky.
+	c.derpHomeExclude = []int{someNode, 1, 2, 3, 4, 5, 6, 7}
+	if got := c.pickDERPFallback(); got != 8 {
+		t.Errorf("with all but region 8 excluded, got %v; want 8", got)
+	}
+	c.derpHomeExclude = append(c.derpHomeExclude, 8)
+	if got := c.pickDERPFallback(); got != 0 {
+		t.Errorf("with all regions excluded, got %v; want 0", got)
+	}
+
 	// TODO: test that disco-based clients changing to a new DERP
 	// region causes this fallback to also move, once disco clients
 	// have fixed DERP fallback logic.
 }
 
+func TestPickDERPHome(t *testing.T) {
+	c := newConn()
+	c.derpMap = &tailcfg.DERPMap{
+		Regions: map[int]*tailcfg.DERPRegion{
+			1: {},
+			2: {},
+			3: {},
+		},
+	}
+	report := &netcheck.Report{
+		PreferredDERP: 1,
+		RegionLatency: map[int]time.Duration{
+			1: 10 * time.Millisecond,
+			2: 30 * time.Millisecond,
+			3: 20 * time.Millisecond,
+		},
+	}
+	tests := []struct {
+		name    string
+		pin     int
+		exclude []int
+		want    int
+	}{
+		{name: "default", want: 1},
+		{name: "pinned", pin: 2, want: 2},
+		{name: "pinned_not_in_map", pin: 99, want: 1},
+		{name: "pinned_and_excluded_other", pin: 2, exclude: []int{1}, want: 2},
+		{name: "preferred_excluded", exclude: []int{1}, want: 3},
+		{name: "two_excluded", exclude: []int{1, 3}, want: 2},
+		{name: "all_excluded", exclude: []int{1, 2, 3}, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c.derpHomePin, c.derpHomeExclude = tt.pin, tt.exclude
+			if got := c.pickDERPHome(report); got != tt.want {
+				t.Errorf("pickDERPHome = %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 // TestDeviceStartStop exercises the startup and shutdown logic of
 // wireguard-go, which is intimately intertwined with magicsock's own
 // lifecycle. We seem to be good at generating deadlocks here, so if
@@ -816,6 +869,41 @@ func TestActiveDiscovery(t *testing.T) {
 	})
 }
 
+// TestActiveDiscoveryScenarios runs testActiveDiscovery in each of the
+// natlab scenarios in testdata/natlab, which must have machines named
+// m1, m2 and stun. Add a scenario there to reproduce a reported NAT
+// traversal failure.
+func TestActiveDiscoveryScenarios(t *testing.T) {
+	files, err := filepath.Glob("testdata/natlab/*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		t.Run(strings.TrimSuffix(filepath.Base(file), ".yaml"), func(t *testing.T) {
+			sc, err := natlab.LoadScenario(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lab, err := sc.Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			m1, m2, mstun := lab.Machine("m1"), lab.Machine("m2"), lab.Machine("stun")
+			if m1 == nil || m2 == nil || mstun == nil {
+				t.Fatalf("scenario %q lacks machines m1, m2 and stun", sc.Name)
+			}
+			testActiveDiscovery(t, &devices{
+				m1:     m1,
+				m1IP:   lab.IP("m1"),
+				m2:     m2,
+				m2IP:   lab.IP("m2"),
+				stun:   mstun,
+				stunIP: lab.IP("stun"),
+			})
+		})
+	}
+}
+
 type devices struct {
 	m1   nettype.PacketListener
 	m1IP netip.Addr
@@ -16,6 +16,7 @@
 	"os"
 	"os/exec"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -37,6 +38,7 @@
 	"gvisor.dev/gvisor/pkg/waiter"
 	"tailscale.com/envknob"
 	"tailscale.com/ipn/ipnlocal"
+	"tailscale.com/ipn/ipnstate"
 	"tailscale.com/net/dns"
 	"tailscale.com/net/netaddr"
 	"tailscale.com/net/packet"
@@ -50,6 +52,7 @@
 	"tailscale.com/types/logger"
 	"tailscale.com/types/netmap"
 	"tailscale.com/types/nettype"
+	"tailscale.com/util/set"
 	"tailscale.com/version/distro"
 	"tailscale.com/wgengine"
 	"tailscale.com/wgengine/filter"
@@ -130,6 +133,7 @@ type Impl struct {
 	ctxCancel context.CancelFunc     // called on Close
 	lb        *ipnlocal.LocalBackend // or nil
 	dns       *dns.Manager
+	tcpRcvWnd int // initial receive window of forwarded TCP conns
 
 	peerapiPort4Atomic atomic.Uint32 // uint16 port number for IPv4 peerapi
 	peerapiPort6Atomic atomic.Uint32 // uint16 port number for IPv6 peerapi
@@ -146,6 +150,8 @@ type Impl struct {
 	// TCP connections, so they can be unregistered when connections are
 	// closed.
 	connsOpenBySubnetIP map[netip.Addr]int
+	// flows are the TCP and UDP flows being forwarded to backends.
+	flows set.Set[*flow]
 }
 
 const nicID = 1
@@ -156,6 +162,77 @@ type Impl struct {
 // have a UDP packet as big as the MTU.
 const maxUDPPacketSize = tstun.MaxPacketSize
 
+// Defaults of the TCP buffer tuning knobs. gVisor's own defaults (1MB
+// buffers without auto-tuning) cap a connection's window well below the
+// bandwidth-delay product of fast, high latency links, so the receive
+// buffer is auto-tuned and both buffers may grow to several MB.
+const (
+	tcpRXBufMinSize = tcp.MinBufferSize
+	tcpRXBufDefSize = tcp.DefaultReceiveBufferSize
+	tcpRXBufMaxSize = 8 << 20 // 8MiB
+
+	tcpTXBufMinSize = tcp.MinBufferSize
+	tcpTXBufDefSize = tcp.DefaultSendBufferSize
+	tcpTXBufMaxSize = 6 << 20 // 6MiB
+
+	// linkQueueLen is the number of outbound packets that the netstack
+	// NIC queues for the TUN device.
+	linkQueueLen = 512
+)
+
+// tcpBufSizes returns the TCP buffer size range set by the envknobs
+// envMax (the maximum, in bytes) and envMin, or the given defaults. The
+// default size is clamped to the range.
+func tcpBufSizes(envMin, envMax string, lo, def, hi int) (tcpip.TCPReceiveBufferSizeRangeOption, error) {
+	if v, ok := envknob.LookupIntSized(envMin, 10, 32); ok {
+		lo = v
+	}
+	if v, ok := envknob.LookupIntSized(envMax, 10, 32); ok {
+		hi = v
+	}
+	if lo < tcp.MinBufferSize || hi < lo {
+		return tcpip.TCPReceiveBufferSizeRangeOption{}, fmt.Errorf("invalid TCP buffer sizes %s=%d, %s=%d", envMin, lo, envMax, hi)
+	}
+	return tcpip.TCPReceiveBufferSizeRangeOption{Min: lo, Default: max(lo, min(def, hi)), Max: hi}, nil
+}
+
+// setTCPOptions applies the TCP tuning knobs to ipstack:
+//
+//   - TS_NETSTACK_TCP_RECV_BUF_MIN and TS_NETSTACK_TCP_RECV_BUF_MAX bound
+//     the receive buffer (and so the advertised window), in bytes.
+//   - TS_NETSTACK_TCP_SEND_BUF_MIN and TS_NETSTACK_TCP_SEND_BUF_MAX bound
+//     the send buffer, in bytes.
+//   - TS_NETSTACK_TCP_MODERATE_RECV_BUF=false turns off receive buffer
+//     auto-tuning, leaving receive buffers at their default size.
+//
+// It returns the default receive buffer size.
+func setTCPOptions(ipstack *stack.Stack) (rcvWnd int, err error) {
+	rx, err := tcpBufSizes("TS_NETSTACK_TCP_RECV_BUF_MIN", "TS_NETSTACK_TCP_RECV_BUF_MAX", tcpRXBufMinSize, tcpRXBufDefSize, tcpRXBufMaxSize)
+	if err != nil {
+		return 0, err
+	}
+	if tcpipErr := ipstack.SetTransportProtocolOption(tcp.ProtocolNumber, &rx); tcpipErr != nil {
+		return 0, fmt.Errorf("could not set TCP receive buffer sizes: %v", tcpipErr)
+	}
+	txr, err := tcpBufSizes("TS_NETSTACK_TCP_SEND_BUF_MIN", "TS_NETSTACK_TCP_SEND_BUF_MAX", tcpTXBufMinSize, tcpTXBufDefSize, tcpTXBufMaxSize)
+	if err != nil {
+		return 0, err
+	}
+	tx := tcpip.TCPSendBufferSizeRangeOption(txr)
+	if tcpipErr := ipstack.SetTransportProtocolOption(tcp.ProtocolNumber, &tx); tcpipErr != nil {
+		return 0, fmt.Errorf("could not set TCP send buffer sizes: %v", tcpipErr)
+	}
+	moderate := true
+	if v, ok := envknob.LookupBool("TS_NETSTACK_TCP_MODERATE_RECV_BUF"); ok {
+		moderate = v
+	}
+	moderateOpt := tcpip.TCPModerateReceiveBufferOption(moderate)
+	if tcpipErr := ipstack.SetTransportProtocolOption(tcp.ProtocolNumber, &moderateOpt); tcpipErr != nil {
+		return 0, fmt.Errorf("could not set TCP receive buffer moderation: %v", tcpipErr)
+	}
+	return rx.Default, nil
+}
+
 // Create creates and populates a new Impl.
 func Create(logf logger.Logf, tundev *tstun.Wrapper, e wgengine.Engine, mc *magicsock.Conn, dialer *tsdial.Dialer, dns *dns.Manager, pm *proxymap.Mapper) (*Impl, error) {
 	if mc == nil {
@@ -185,7 +262,15 @@ func Create(logf logger.Logf, tundev *tstun.Wrapper, e wgengine.Engine, mc *magi
 	if tcpipErr != nil {
 		return nil, fmt.Errorf("could not enable TCP SACK: %v", tcpipErr)
 	}
-	linkEP := channel.New(512, uint32(tstun.DefaultTUNMTU()), "")
+	tcpRcvWnd, err := setTCPOptions(ipstack)
+	if err != nil {
+		return nil, err
+	}
+	queueLen := linkQueueLen
+	if v, ok := envknob.LookupIntSized("TS_NETSTACK_LINK_QUEUE_LEN", 10, 32); ok && v > 0 {
+		queueLen = v
+	}
+	linkEP := channel.New(queueLen, uint32(tstun.DefaultTUNMTU()), "")
 	if tcpipProblem := ipstack.CreateNIC(nicID, linkEP); tcpipProblem != nil {
 		return nil, fmt.Errorf("could not create netstack NIC: %v", tcpipProblem)
 	}
@@ -220,6 +305,7 @@ func Create(logf logger.Logf, tundev *tstun.Wrapper, e wgengine.Engine, mc *magi
 		dialer:              dialer,
 		connsOpenBySubnetIP: make(map[netip.Addr]int),
 		dns:                 dns,
+		tcpRcvWnd:           tcpRcvWnd,
 	}
 	ns.ctx, ns.ctxCancel = context.WithCancel(context.Background())
 	ns.atomicIsLocalIPFunc.Store(tsaddr.FalseContainsIPFunc())
@@ -261,10 +347,8 @@ func (ns *Impl) Start(lb *ipnlocal.LocalBackend) error {
 		panic("nil LocalBackend")
 	}
 	ns.lb = lb
-	// size = 0 means use default buffer size
-	const tcpReceiveBufferSize = 0
 	const maxInFlightConnectionAttempts = 1024
-	tcpFwd := tcp.NewForwarder(ns.ipstack, tcpReceiveBufferSize, maxInFlightConnectionAttempts, ns.acceptTCP)
+	tcpFwd := tcp.NewForwarder(ns.ipstack, ns.tcpRcvWnd, maxInFlightConnectionAttempts, ns.acceptTCP)
 	udpFwd := udp.NewForwarder(ns.ipstack, ns.acceptUDP)
 	ns.ipstack.SetTransportProtocolHandler(tcp.ProtocolNumber, ns.wrapProtoHandler(tcpFwd.HandlePacket))
 	ns.ipstack.SetTransportProtocolHandler(udp.ProtocolNumber, ns.wrapProtoHandler(udpFwd.HandlePacket))
@@ -935,12 +1019,13 @@ func (ns *Impl) acceptTCP(r *tcp.ForwarderRequest) {
 	}
 	dialAddr := netip.AddrPortFrom(dialIP, uint16(reqDetails.LocalPort))
 
-	if !ns.forwardTCP(getConnOrReset, clientRemoteIP, &wq, dialAddr) {
+	if !ns.forwardTCP(getConnOrReset, clientRemoteAddrPort, dstAddrPort, &wq, dialAddr) {
 		r.Complete(true) // sends a RST
 	}
 }
 
-func (ns *Impl) forwardTCP(getClient func(...tcpip.SettableSocketOption) *gonet.TCPConn, clientRemoteIP netip.Addr, wq *waiter.Queue, dialAddr netip.AddrPort) (handled bool) {
+func (ns *Impl) forwardTCP(getClient func(...tcpip.SettableSocketOption) *gonet.TCPConn, clientAddr, dstAddr netip.AddrPort, wq *waiter.Queue, dialAddr netip.AddrPort) (handled bool) {
+	clientRemoteIP := clientAddr.Addr()
 	dialAddrStr := dialAddr.String()
 	if debugNetstack() {
 		ns.logf("[v2] netstack: forwarding incoming connection to %s", dialAddrStr)
@@ -967,6 +1052,17 @@ func (ns *Impl) forwardTCP(getClient func(...tcpip.SettableSocketOption) *gonet.
 		cancel()
 	}()
 
+	f := &flow{
+		proto:   "tcp",
+		src:     clientAddr,
+		dst:     dstAddr,
+		backend: dialAddrStr,
+		started: time.Now(),
+	}
+	f.state.Store("dialing")
+	ns.addFlow(f)
+	defer ns.removeFlow(f)
+
 	// Attempt to dial the outbound connection before we accept the inbound one.
 	var stdDialer net.Dialer
 	server, err := stdDialer.DialContext(ctx, "tcp", dialAddrStr)
@@ -993,16 +1089,18 @@ func (ns *Impl) forwardTCP(getClient func(...tcpip.SettableSocketOption) *gonet.
 	backendLocalIPPort := netaddr.Unmap(backendLocalAddr.AddrPort())
 	ns.pm.RegisterIPPortIdentity(backendLocalIPPort, clientRemoteIP)
 	defer ns.pm.UnregisterIPPortIdentity(backendLocalIPPort)
+	f.state.Store("established")
 	connClosed := make(chan error, 2)
 	go func() {
-		_, err := io.Copy(server, client)
+		_, err := io.Copy(countingWriter{server, &f.rx}, client)
 		connClosed <- err
 	}()
 	go func() {
-		_, err := io.Copy(client, server)
+		_, err := io.Copy(countingWriter{client, &f.tx}, server)
 		connClosed <- err
 	}()
 	err = <-connClosed
+	f.state.Store("closing")
 	if err != nil {
 		ns.logf("proxy connection closed with error: %v", err)
 	}
@@ -1175,11 +1273,25 @@ func (ns *Impl) forwardUDP(client *gonet.UDPConn, clientAddr, dstAddr netip.Addr
 		client.Close()
 		backendConn.Close()
 	})
-	extend := func() {
-		timer.Reset(idleTimeout)
+	f := &flow{
+		proto:   "udp",
+		src:     clientAddr,
+		dst:     dstAddr,
+		backend: backendRemoteAddr.String(),
+		started: time.Now(),
+	}
+	f.state.Store("active")
+	ns.addFlow(f)
+	context.AfterFunc(ctx, func() { ns.removeFlow(f) })
+
+	extend := func(n *atomic.Int64) func(int) {
+		return func(size int) {
+			n.Add(int64(size))
+			timer.Reset(idleTimeout)
+		}
 	}
-	startPacketCopy(ctx, cancel, client, net.UDPAddrFromAddrPort(clientAddr), backendConn, ns.logf, extend)
-	startPacketCopy(ctx, cancel, backendConn, backendRemoteAddr, client, ns.logf, extend)
+	startPacketCopy(ctx, cancel, client, net.UDPAddrFromAddrPort(clientAddr), backendConn, ns.logf, extend(&f.tx))
+	startPacketCopy(ctx, cancel, backendConn, backendRemoteAddr, client, ns.logf, extend(&f.rx))
 	if isLocal {
 		// Wait for the copies to be done before decrementing the
 		// subnet address count to potentially remove the route.
@@ -1188,7 +1300,9 @@ func (ns *Impl) forwardUDP(client *gonet.UDPConn, clientAddr, dstAddr netip.Addr
 	}
 }
 
-func startPacketCopy(ctx context.Context, cancel context.CancelFunc, dst net.PacketConn, dstAddr net.Addr, src net.PacketConn, logf logger.Logf, extend func()) {
+// startPacketCopy copies packets from src to dstAddr via dst until ctx is
+// done, calling extend with the size of each packet copied.
+func startPacketCopy(ctx context.Context, cancel context.CancelFunc, dst net.PacketConn, dstAddr net.Addr, src net.PacketConn, logf logger.Logf, extend func(n int)) {
 	if debugNetstack() {
 		logf("[v2] netstack: startPacketCopy to %v (%T) from %T", dstAddr, dst, src)
 	}
@@ -1221,7 +1335,7 @@ func startPacketCopy(ctx context.Context, cancel context.CancelFunc, dst net.Pac
 				if debugNetstack() {
 					logf("[v2] wrote UDP packet %s -> %s", srcAddr, dstAddr)
 				}
-				extend()
+				extend(n)
 			}
 		}
 	}()
@@ -1248,3 +1362,66 @@ func ipPortOfNetstackAddr(a tcpip.Address, port uint16) (ipp netip.AddrPort, ok
 		return ipp, false
 	}
 }
+
+// flow is a TCP or UDP flow that netstack forwards to a backend.
+type flow struct {
+	proto    string
+	src, dst netip.AddrPort
+	backend  string
+	started  time.Time
+
+	state  syncs.AtomicValue[string]
+	rx, tx atomic.Int64 // bytes from and to src
+}
+
+func (ns *Impl) addFlow(f *flow) {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	if ns.flows == nil {
+		ns.flows = make(set.Set[*flow])
+	}
+	ns.flows.Add(f)
+}
+
+func (ns *Impl) removeFlow(f *flow) {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	ns.flows.Delete(f)
+}
+
+// Conns returns the TCP and UDP flows that ns currently forwards to
+// backends, oldest first. It implements tsd.NetstackImpl.
+func (ns *Impl) Conns() []ipnstate.NetstackConn {
+	ns.mu.Lock()
+	ret := make([]ipnstate.NetstackConn, 0, len(ns.flows))
+	for f := range ns.flows {
+		ret = append(ret, ipnstate.NetstackConn{
+			Proto:   f.proto,
+			Src:     f.src,
+			Dst:     f.dst,
+			Backend: f.backend,
+			State:   f.state.Load(),
+			Started: f.started,
+			RxBytes: f.rx.Load(),
+			TxBytes: f.tx.Load(),
+		})
+	}
+	ns.mu.Unlock()
+	slices.SortFunc(ret, func(a, b ipnstate.NetstackConn) int {
+		return a.Started.Compare(b.Started)
+	})
+	return ret
+}
+
+// countingWriter is an io.Writer that adds the number of bytes written to
+// w to n.
+type countingWriter struct {
+	w io.Writer
+	n *atomic.Int64
+}
+
+func (c countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n.Add(int64(n))
+	return n, err
+}
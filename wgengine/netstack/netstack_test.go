@@ -5,12 +5,20 @@
 
 import (
 	"fmt"
+	"io"
 	"net/netip"
+	"reflect"
 	"runtime"
 	"testing"
+	"time"
 
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
+	"tailscale.com/envknob"
 	"tailscale.com/ipn"
 	"tailscale.com/ipn/ipnlocal"
+	"tailscale.com/ipn/ipnstate"
 	"tailscale.com/ipn/store/mem"
 	"tailscale.com/net/packet"
 	"tailscale.com/net/tsaddr"
@@ -455,3 +463,103 @@ func TestShouldProcessInbound(t *testing.T) {
 		})
 	}
 }
+
+func TestSetTCPOptions(t *testing.T) {
+	newStack := func() *stack.Stack {
+		s := stack.New(stack.Options{TransportProtocols: []stack.TransportProtocolFactory{tcp.NewProtocol}})
+		t.Cleanup(s.Close)
+		return s
+	}
+	s := newStack()
+	rcvWnd, err := setTCPOptions(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rcvWnd != tcpRXBufDefSize {
+		t.Errorf("receive window = %d; want %d", rcvWnd, tcpRXBufDefSize)
+	}
+	var rx tcpip.TCPReceiveBufferSizeRangeOption
+	s.TransportProtocolOption(tcp.ProtocolNumber, &rx)
+	if want := (tcpip.TCPReceiveBufferSizeRangeOption{Min: tcpRXBufMinSize, Default: tcpRXBufDefSize, Max: tcpRXBufMaxSize}); rx != want {
+		t.Errorf("receive buffer sizes = %+v; want %+v", rx, want)
+	}
+	var moderate tcpip.TCPModerateReceiveBufferOption
+	s.TransportProtocolOption(tcp.ProtocolNumber, &moderate)
+	if !moderate {
+		t.Error("receive buffer moderation is off")
+	}
+
+	setenv := func(k, v string) {
+		envknob.Setenv(k, v)
+		t.Cleanup(func() { envknob.Setenv(k, "") })
+	}
+	setenv("TS_NETSTACK_TCP_RECV_BUF_MAX", "65536")
+	setenv("TS_NETSTACK_TCP_SEND_BUF_MAX", "131072")
+	setenv("TS_NETSTACK_TCP_MODERATE_RECV_BUF", "false")
+	s = newStack()
+	rcvWnd, err = setTCPOptions(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rcvWnd != 65536 {
+		t.Errorf("receive window = %d; want clamped to 65536", rcvWnd)
+	}
+	var tx tcpip.TCPSendBufferSizeRangeOption
+	s.TransportProtocolOption(tcp.ProtocolNumber, &tx)
+	if want := (tcpip.TCPSendBufferSizeRangeOption{Min: tcpTXBufMinSize, Default: 131072, Max: 131072}); tx != want {
+		t.Errorf("send buffer sizes = %+v; want %+v", tx, want)
+	}
+	s.TransportProtocolOption(tcp.ProtocolNumber, &moderate)
+	if moderate {
+		t.Error("receive buffer moderation is on")
+	}
+
+	setenv("TS_NETSTACK_TCP_RECV_BUF_MIN", "1048576")
+	if _, err := setTCPOptions(newStack()); err == nil {
+		t.Error("setTCPOptions succeeded with min > max")
+	}
+}
+
+func TestConns(t *testing.T) {
+	ns := makeNetstack(t, nil)
+	if got := ns.Conns(); len(got) != 0 {
+		t.Fatalf("Conns = %v; want none", got)
+	}
+	now := time.Now()
+	newer := &flow{
+		proto:   "udp",
+		src:     netip.MustParseAddrPort("100.64.0.2:5000"),
+		dst:     netip.MustParseAddrPort("10.0.0.1:53"),
+		backend: "10.0.0.1:53",
+		started: now,
+	}
+	newer.state.Store("active")
+	older := &flow{
+		proto:   "tcp",
+		src:     netip.MustParseAddrPort("100.64.0.3:40000"),
+		dst:     netip.MustParseAddrPort("100.64.0.1:22"),
+		backend: "127.0.0.1:22",
+		started: now.Add(-time.Minute),
+	}
+	older.state.Store("established")
+	ns.addFlow(newer)
+	ns.addFlow(older)
+
+	w := countingWriter{io.Discard, &older.rx}
+	io.WriteString(w, "hello")
+	io.WriteString(w, "world")
+	older.tx.Add(3)
+
+	want := []ipnstate.NetstackConn{
+		{Proto: "tcp", Src: older.src, Dst: older.dst, Backend: "127.0.0.1:22", State: "established", Started: older.started, RxBytes: 10, TxBytes: 3},
+		{Proto: "udp", Src: newer.src, Dst: newer.dst, Backend: "10.0.0.1:53", State: "active", Started: now},
+	}
+	if got := ns.Conns(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Conns = %+v; want %+v", got, want)
+	}
+
+	ns.removeFlow(older)
+	if got := ns.Conns(); len(got) != 1 || got[0].Proto != "udp" {
+		t.Errorf("after removing TCP flow, Conns = %+v; want the UDP flow", got)
+	}
+}
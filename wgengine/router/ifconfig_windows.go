@@ -238,7 +238,10 @@ func interfaceFromLUID(luid winipcfg.LUID, flags winipcfg.GAAFlags) (*winipcfg.I
 	return nil, fmt.Errorf("interfaceFromLUID: interface with LUID %v not found", luid)
 }
 
-var networkCategoryWarning = health.NewWarnable(health.WithMapDebugFlag("warn-network-category-unhealthy"))
+var networkCategoryWarning = health.NewWarnable(
+	health.WithName("network-category"),
+	health.WithMapDebugFlag("warn-network-category-unhealthy"),
+)
 
 func configureInterface(cfg *Config, tun *tun.NativeTun) (retErr error) {
 	var mtu = tstun.DefaultTUNMTU()
@@ -367,7 +370,7 @@ func configureInterface(cfg *Config, tun *tun.NativeTun) (retErr error) {
 		r := &winipcfg.RouteData{
 			Destination: route,
 			NextHop:     gateway,
-			Metric:      0,
+			Metric:      cfg.RouteMetric,
 		}
 		if r.Destination.Addr().Unmap() == gateway {
 			// no need to add a route for the interface's
@@ -75,7 +75,11 @@ type Config struct {
 	// Linux-only things below, ignored on other platforms.
 	SubnetRoutes     []netip.Prefix         // subnets being advertised to other Tailscale nodes
 	SNATSubnetRoutes bool                   // SNAT traffic to local subnets
+	ClampMSSToPMTU   bool                   // clamp MSS of forwarded TCP connections to the path MTU
 	NetfilterMode    preftype.NetfilterMode // how much to manage netfilter rules
+
+	// Windows-only things below, ignored on other platforms.
+	RouteMetric uint32 // metric of the routes in Routes; 0 is the default
 }
 
 func (a *Config) Equal(b *Config) bool {
@@ -50,6 +50,8 @@ type netfilterRunner interface {
 	DelBase() error
 	AddSNATRule() error
 	DelSNATRule() error
+	AddMSSClampRule(tunname string) error
+	DelMSSClampRule(tunname string) error
 
 	HasIPV6() bool
 	HasIPV6NAT() bool
@@ -186,6 +188,7 @@ type linuxRouter struct {
 	routes           map[netip.Prefix]bool
 	localRoutes      map[netip.Prefix]bool
 	snatSubnetRoutes bool
+	clampMSS         bool
 	netfilterMode    preftype.NetfilterMode
 
 	// ruleRestorePending is whether a timer has been started to
@@ -515,13 +518,28 @@ func (r *linuxRouter) Set(cfg *Config) error {
 	}
 	r.snatSubnetRoutes = cfg.SNATSubnetRoutes
 
+	switch {
+	case cfg.ClampMSSToPMTU == r.clampMSS:
+		// state already correct, nothing to do.
+	case cfg.ClampMSSToPMTU:
+		if err := r.addMSSClampRule(); err != nil {
+			errs = append(errs, err)
+		}
+	default:
+		if err := r.delMSSClampRule(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	r.clampMSS = cfg.ClampMSSToPMTU
+
 	return multierr.New(errs...)
 }
 
 // setNetfilterMode switches the router to the given netfilter
 // mode. Netfilter state is created or deleted appropriately to
-// reflect the new mode, and r.snatSubnetRoutes is updated to reflect
-// the current state of subnet SNATing.
+// reflect the new mode, and r.snatSubnetRoutes and r.clampMSS are
+// updated to reflect the current state of subnet SNATing and MSS
+// clamping.
 func (r *linuxRouter) setNetfilterMode(mode preftype.NetfilterMode) error {
 	if distro.Get() == distro.Synology {
 		mode = netfilterOff
@@ -567,6 +585,7 @@ func (r *linuxRouter) setNetfilterMode(mode preftype.NetfilterMode) error {
 			}
 		}
 		r.snatSubnetRoutes = false
+		r.clampMSS = false
 	case netfilterNoDivert:
 		switch r.netfilterMode {
 		case netfilterOff:
@@ -578,6 +597,7 @@ func (r *linuxRouter) setNetfilterMode(mode preftype.NetfilterMode) error {
 				return err
 			}
 			r.snatSubnetRoutes = false
+			r.clampMSS = false
 		case netfilterOn:
 			if err := r.nfr.DelHooks(r.logf); err != nil {
 				return err
@@ -608,6 +628,7 @@ func (r *linuxRouter) setNetfilterMode(mode preftype.NetfilterMode) error {
 				return err
 			}
 			r.snatSubnetRoutes = false
+			r.clampMSS = false
 		case netfilterNoDivert:
 			reprocess = true
 			if err := r.nfr.DelBase(); err != nil {
@@ -620,6 +641,7 @@ func (r *linuxRouter) setNetfilterMode(mode preftype.NetfilterMode) error {
 				return err
 			}
 			r.snatSubnetRoutes = false
+			r.clampMSS = false
 		}
 	default:
 		panic("unhandled netfilter mode")
@@ -1320,6 +1342,33 @@ func (r *linuxRouter) delSNATRule() error {
 	return nil
 }
 
+// addMSSClampRule adds the netfilter rules to clamp the MSS of TCP
+// connections forwarded through the Tailscale interface.
+func (r *linuxRouter) addMSSClampRule() error {
+	if r.netfilterMode == netfilterOff {
+		return nil
+	}
+
+	if err := r.nfr.AddMSSClampRule(r.tunname); err != nil {
+		return err
+	}
+	return nil
+}
+
+// delMSSClampRule removes the netfilter rules to clamp the MSS of TCP
+// connections forwarded through the Tailscale interface. Fails if the
+// rules do not exist.
+func (r *linuxRouter) delMSSClampRule() error {
+	if r.netfilterMode == netfilterOff {
+		return nil
+	}
+
+	if err := r.nfr.DelMSSClampRule(r.tunname); err != nil {
+		return err
+	}
+	return nil
+}
+
 // cidrDiff calls add and del as needed to make the set of prefixes in
 // old and new match. Returns a map reflecting the actual new state
 // (which may be somewhere in between old and new if some commands
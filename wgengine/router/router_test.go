@@ -22,7 +22,8 @@ func mustCIDRs(ss ...string) []netip.Prefix {
 func TestConfigEqual(t *testing.T) {
 	testedFields := []string{
 		"LocalAddrs", "Routes", "LocalRoutes", "NewMTU",
-		"SubnetRoutes", "SNATSubnetRoutes", "NetfilterMode",
+		"SubnetRoutes", "SNATSubnetRoutes", "ClampMSSToPMTU", "NetfilterMode",
+		"RouteMetric",
 	}
 	configType := reflect.TypeOf(Config{})
 	configFields := []string{}
@@ -124,6 +125,17 @@ func TestConfigEqual(t *testing.T) {
 			true,
 		},
 
+		{
+			&Config{ClampMSSToPMTU: false},
+			&Config{ClampMSSToPMTU: true},
+			false,
+		},
+		{
+			&Config{ClampMSSToPMTU: true},
+			&Config{ClampMSSToPMTU: true},
+			true,
+		},
+
 		{
 			&Config{NetfilterMode: preftype.NetfilterOff},
 			&Config{NetfilterMode: preftype.NetfilterNoDivert},
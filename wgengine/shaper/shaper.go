@@ -0,0 +1,155 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+// Package shaper implements bandwidth limits for traffic to and from peers
+// or subnet routes, enforced in the data path.
+//
+// Limits are enforced by policing: packets over a limit are dropped rather
+// than queued, and the transports inside the tunnel back off in response.
+package shaper
+
+import (
+	"cmp"
+	"fmt"
+	"net/netip"
+	"slices"
+	"sync"
+
+	"tailscale.com/net/packet"
+	"tailscale.com/tstime/rate"
+	"tailscale.com/util/lru"
+)
+
+// Rule is a bandwidth limit.
+type Rule struct {
+	// Prefix is the range of addresses the limit applies to, such as a
+	// peer's Tailscale IP or an advertised subnet route. A packet matches
+	// if its source or destination is in Prefix.
+	Prefix netip.Prefix
+
+	// BytesPerSecond is the limit, applied separately to each direction.
+	BytesPerSecond int64
+
+	// PerAddr is whether each address in Prefix gets its own limit, rather
+	// than all of them sharing one. For instance, an exit node can cap
+	// each of its clients with a PerAddr rule for 100.64.0.0/10.
+	PerAddr bool
+}
+
+func (r Rule) String() string {
+	s := fmt.Sprintf("%v=%dB/s", r.Prefix, r.BytesPerSecond)
+	if r.PerAddr {
+		s += "/addr"
+	}
+	return s
+}
+
+// minBurst is the minimum burst size of a limiter, in bytes, so that a
+// maximum-size packet can always pass a limiter whose bucket is full.
+const minBurst = 64 << 10
+
+// maxPerAddrBuckets is the maximum number of addresses that a PerAddr rule
+// tracks. When more addresses send or receive traffic, the buckets of the
+// least recently active ones are dropped, and those addresses start over with
+// full buckets if they come back.
+const maxPerAddrBuckets = 4096
+
+// bucket is the pair of token buckets of one limit.
+type bucket struct {
+	in, out *rate.Limiter
+}
+
+func newBucket(bytesPerSecond int64) *bucket {
+	burst := max(int(bytesPerSecond), minBurst)
+	return &bucket{
+		in:  rate.NewLimiter(rate.Limit(bytesPerSecond), burst),
+		out: rate.NewLimiter(rate.Limit(bytesPerSecond), burst),
+	}
+}
+
+type rule struct {
+	Rule
+
+	shared *bucket // if !PerAddr
+
+	mu      sync.Mutex
+	perAddr lru.Cache[netip.Addr, *bucket] // if PerAddr
+}
+
+func (r *rule) bucket(a netip.Addr) *bucket {
+	if !r.PerAddr {
+		return r.shared
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b, ok := r.perAddr.GetOk(a)
+	if !ok {
+		b = newBucket(r.BytesPerSecond)
+		r.perAddr.Set(a, b)
+	}
+	return b
+}
+
+// Shaper enforces a set of Rules. Its methods are safe for concurrent use.
+type Shaper struct {
+	rules []*rule // most specific first
+}
+
+// New returns a Shaper that enforces rules. When several rules match a
+// packet, only the one with the longest prefix applies. Rules with invalid
+// prefixes or non-positive limits are ignored.
+func New(rules []Rule) *Shaper {
+	s := new(Shaper)
+	for _, r := range rules {
+		if !r.Prefix.IsValid() || r.BytesPerSecond <= 0 {
+			continue
+		}
+		rr := &rule{Rule: r}
+		rr.perAddr.MaxEntries = maxPerAddrBuckets
+		rr.Prefix = r.Prefix.Masked()
+		if !r.PerAddr {
+			rr.shared = newBucket(r.BytesPerSecond)
+		}
+		s.rules = append(s.rules, rr)
+	}
+	slices.SortStableFunc(s.rules, func(a, b *rule) int {
+		return cmp.Compare(b.Prefix.Bits(), a.Prefix.Bits())
+	})
+	return s
+}
+
+// match returns the most specific rule that matches a packet between the
+// remote and local addresses, and the address it matched. The remote address
+// is preferred, so that a PerAddr rule covering both limits each peer
+// rather than this node.
+func (s *Shaper) match(remote, local netip.Addr) (_ *rule, addr netip.Addr) {
+	for _, r := range s.rules {
+		if r.Prefix.Contains(remote) {
+			return r, remote
+		}
+		if r.Prefix.Contains(local) {
+			return r, local
+		}
+	}
+	return nil, netip.Addr{}
+}
+
+// AllowIn reports whether the packet p, received from WireGuard, is
+// within the limits.
+func (s *Shaper) AllowIn(p *packet.Parsed) bool {
+	r, addr := s.match(p.Src.Addr(), p.Dst.Addr())
+	if r == nil {
+		return true
+	}
+	return r.bucket(addr).in.AllowN(len(p.Buffer()))
+}
+
+// AllowOut reports whether the packet p, to be sent over WireGuard, is
+// within the limits.
+func (s *Shaper) AllowOut(p *packet.Parsed) bool {
+	r, addr := s.match(p.Dst.Addr(), p.Src.Addr())
+	if r == nil {
+		return true
+	}
+	return r.bucket(addr).out.AllowN(len(p.Buffer()))
+}
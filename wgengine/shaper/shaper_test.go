@@ -0,0 +1,109 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package shaper
+
+import (
+	"net/netip"
+	"testing"
+
+	"tailscale.com/net/packet"
+	"tailscale.com/types/ipproto"
+)
+
+func udp(src, dst string, size int) *packet.Parsed {
+	h := &packet.UDP4Header{
+		IP4Header: packet.IP4Header{
+			IPProto: ipproto.UDP,
+			Src:     netip.MustParseAddr(src),
+			Dst:     netip.MustParseAddr(dst),
+		},
+		SrcPort: 1234,
+		DstPort: 5678,
+	}
+	p := new(packet.Parsed)
+	p.Decode(packet.Generate(h, make([]byte, size-h.Len())))
+	return p
+}
+
+// allowed returns how many bytes of packets of size n are allowed by f
+// before the first one is dropped.
+func allowed(f func(*packet.Parsed) bool, p *packet.Parsed) int {
+	var n int
+	for f(p) {
+		n += len(p.Buffer())
+	}
+	return n
+}
+
+func TestShaper(t *testing.T) {
+	const (
+		self    = "100.64.0.1"
+		peerA   = "100.64.0.2"
+		peerB   = "100.64.0.3"
+		subnet  = "10.0.0.5"
+		inet    = "8.8.8.8"
+		limit   = 100 << 10 // above minBurst
+		special = 200 << 10
+	)
+	s := New([]Rule{
+		{Prefix: netip.MustParsePrefix("100.64.0.0/10"), BytesPerSecond: limit, PerAddr: true},
+		{Prefix: netip.MustParsePrefix(peerB + "/32"), BytesPerSecond: special},
+		{Prefix: netip.MustParsePrefix("10.0.0.0/24"), BytesPerSecond: limit},
+		{Prefix: netip.MustParsePrefix("0.0.0.0/0"), BytesPerSecond: 0}, // ignored
+	})
+
+	tests := []struct {
+		name string
+		f    func(*packet.Parsed) bool
+		p    *packet.Parsed
+		want int
+	}{
+		{"peerA-to-exit", s.AllowIn, udp(peerA, inet, 1000), limit},
+		{"exit-to-peerA", s.AllowOut, udp(inet, peerA, 1000), limit},
+		{"self-to-peerA-separate-from-peerA-in", s.AllowOut, udp(self, peerA, 1000), 0}, // peerA's out bucket is already used up
+		{"peerB-more-specific", s.AllowIn, udp(peerB, self, 1000), special},
+		{"subnet-more-specific", s.AllowIn, udp(peerA, subnet, 1000), limit},
+		{"unlimited", s.AllowIn, udp(inet, "1.1.1.1", 1000), -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.want < 0 {
+				for i := 0; i < 10000; i++ {
+					if !tt.f(tt.p) {
+						t.Fatalf("packet %d dropped; want unlimited", i)
+					}
+				}
+				return
+			}
+			got := allowed(tt.f, tt.p)
+			// Allow for the tokens refilled while the test runs.
+			if got < tt.want-1000 || got > tt.want+10000 {
+				t.Errorf("allowed %d bytes; want about %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPerAddrBucketsBounded(t *testing.T) {
+	const limit = 100 << 10
+	s := New([]Rule{
+		{Prefix: netip.MustParsePrefix("100.64.0.0/10"), BytesPerSecond: limit, PerAddr: true},
+	})
+	first := netip.MustParseAddr("100.64.0.1")
+	a := first
+	for i := 0; i < maxPerAddrBuckets+100; i++ {
+		s.AllowOut(udp("100.64.0.0", a.String(), 1000))
+		a = a.Next()
+	}
+	r := s.rules[0]
+	if got := r.perAddr.Len(); got != maxPerAddrBuckets {
+		t.Errorf("tracking %d addresses, want %d", got, maxPerAddrBuckets)
+	}
+	if r.perAddr.Contains(first) {
+		t.Errorf("least recently active address %v still tracked", first)
+	}
+	if last := a.Prev(); !r.perAddr.Contains(last) {
+		t.Errorf("most recently active address %v not tracked", last)
+	}
+}
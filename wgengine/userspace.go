@@ -50,6 +50,7 @@
 	"tailscale.com/wgengine/magicsock"
 	"tailscale.com/wgengine/netlog"
 	"tailscale.com/wgengine/router"
+	"tailscale.com/wgengine/shaper"
 	"tailscale.com/wgengine/wgcfg"
 	"tailscale.com/wgengine/wgint"
 	"tailscale.com/wgengine/wglog"
@@ -966,6 +967,10 @@ func (e *userspaceEngine) SetFilter(filt *filter.Filter) {
 	e.tundev.SetFilter(filt)
 }
 
+func (e *userspaceEngine) SetShaper(s *shaper.Shaper) {
+	e.tundev.SetShaper(s)
+}
+
 func (e *userspaceEngine) SetStatusCallback(cb StatusCallback) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
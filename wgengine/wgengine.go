@@ -15,6 +15,7 @@
 	"tailscale.com/wgengine/capture"
 	"tailscale.com/wgengine/filter"
 	"tailscale.com/wgengine/router"
+	"tailscale.com/wgengine/shaper"
 	"tailscale.com/wgengine/wgcfg"
 )
 
@@ -76,6 +77,10 @@ type Engine interface {
 	// SetFilter updates the packet filter.
 	SetFilter(*filter.Filter)
 
+	// SetShaper sets the bandwidth limits to enforce in the data path.
+	// Nil means no limits.
+	SetShaper(*shaper.Shaper)
+
 	// SetStatusCallback sets the function to call when the
 	// WireGuard status changes.
 	SetStatusCallback(StatusCallback)